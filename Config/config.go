@@ -36,6 +36,37 @@ func (c *Config) IsPaymobEnabled() bool {
 	return c.Payment.Paymob.Enabled
 }
 
+// GetSandboxConfig returns the sandbox gateway settings. Without URLs the checkout
+// page and callbacks point at this server, and callbacks are signed with the JWT
+// secret.
+func (c *Config) GetSandboxConfig() SandboxConfig {
+	cfg := c.Payment.Sandbox
+	if cfg.Outcome == "" {
+		cfg.Outcome = "success"
+	}
+	if cfg.CheckoutURL == "" {
+		cfg.CheckoutURL = "http://localhost" + c.GetServerPort() + "/api/payment/sandbox/checkout"
+	}
+	if cfg.CallbackURL == "" {
+		cfg.CallbackURL = "http://localhost" + c.GetServerPort() + "/api/payment/sandbox/callback"
+	}
+	if cfg.Secret == "" {
+		cfg.Secret = c.GetJWTSecret()
+	}
+	cfg.CheckoutURL = strings.TrimRight(cfg.CheckoutURL, "/")
+	return cfg
+}
+
+// GetOfflineConfig returns the offline payment settings. Proof of a transfer is
+// due within three days unless configured otherwise.
+func (c *Config) GetOfflineConfig() OfflineConfig {
+	cfg := c.Payment.Offline
+	if cfg.ProofWindow == "" {
+		cfg.ProofWindow = "72h"
+	}
+	return cfg
+}
+
 // Global config instance
 var globalConfig *Config
 var configFilename string
@@ -353,6 +384,30 @@ func (c *Config) applyDefaults() {
 	if c.RabbitMQ.Vhost == "" {
 		c.RabbitMQ.Vhost = "/"
 	}
+
+	// Payment defaults
+	if c.Payment.Currency == "" {
+		c.Payment.Currency = "EGP"
+	}
+
+	// Abandoned cart defaults
+	if c.Jobs.AbandonedCart.MaxReminders == 0 {
+		c.Jobs.AbandonedCart.MaxReminders = 3
+	}
+	if c.Jobs.AbandonedCart.CouponPercent == 0 {
+		c.Jobs.AbandonedCart.CouponPercent = 10
+	}
+	if c.Jobs.AbandonedCart.CouponValidDays == 0 {
+		c.Jobs.AbandonedCart.CouponValidDays = 7
+	}
+	if c.Jobs.AbandonedCart.CouponReminder == 0 {
+		c.Jobs.AbandonedCart.CouponReminder = 2
+	}
+
+	// Low stock defaults
+	if c.Jobs.LowStock.SalesWindowDays == 0 {
+		c.Jobs.LowStock.SalesWindowDays = 30
+	}
 }
 
 // GetOAuthConfig returns initialized OAuth configurations
@@ -571,3 +626,205 @@ func (c *Config) GetRabbitMQURL() string {
 func (c *Config) IsRabbitMQEnabled() bool {
 	return c.RabbitMQ.Enabled
 }
+
+// parseDurationOr parses a duration string, falling back to def when empty or invalid
+func parseDurationOr(value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return def
+	}
+	return duration
+}
+
+func (c *Config) GetAbandonedCartConfig() AbandonedCartConfig {
+	return c.Jobs.AbandonedCart
+}
+
+func (c *Config) IsAbandonedCartEnabled() bool {
+	return c.Jobs.AbandonedCart.Enabled
+}
+
+// GetAbandonedCartCheckInterval returns how often the abandoned cart job runs
+func (c *Config) GetAbandonedCartCheckInterval() time.Duration {
+	return parseDurationOr(c.Jobs.AbandonedCart.CheckInterval, 15*time.Minute)
+}
+
+// GetAbandonedCartIdleThreshold returns how long a cart must be idle to count as abandoned
+func (c *Config) GetAbandonedCartIdleThreshold() time.Duration {
+	return parseDurationOr(c.Jobs.AbandonedCart.IdleThreshold, time.Hour)
+}
+
+// GetAbandonedCartReminderInterval returns the gap between consecutive reminders
+func (c *Config) GetAbandonedCartReminderInterval() time.Duration {
+	return parseDurationOr(c.Jobs.AbandonedCart.ReminderInterval, 24*time.Hour)
+}
+
+// GetBaseCurrency returns the platform currency, also used by stores that did not choose one
+func (c *Config) GetBaseCurrency() string {
+	return c.Payment.Currency
+}
+
+func (c *Config) IsLowStockAlertEnabled() bool {
+	return c.Jobs.LowStock.Enabled
+}
+
+// GetLowStockCheckInterval returns how often stock levels are checked against reorder points
+func (c *Config) GetLowStockCheckInterval() time.Duration {
+	return parseDurationOr(c.Jobs.LowStock.CheckInterval, time.Hour)
+}
+
+// GetSalesWindowDays returns the number of days of sales used for reorder suggestions
+func (c *Config) GetSalesWindowDays() int {
+	return c.Jobs.LowStock.SalesWindowDays
+}
+
+func (c *Config) IsShipmentTrackingEnabled() bool {
+	return c.Jobs.Shipments.Enabled
+}
+
+// GetShipmentTrackingInterval returns how often open shipments are refreshed from their carrier
+func (c *Config) GetShipmentTrackingInterval() time.Duration {
+	return parseDurationOr(c.Jobs.Shipments.CheckInterval, 30*time.Minute)
+}
+
+func (c *Config) IsPaymentReconciliationEnabled() bool {
+	return c.Jobs.Payments.Enabled
+}
+
+// GetPaymentReconciliationInterval returns how often pending payments are checked with their gateway
+func (c *Config) GetPaymentReconciliationInterval() time.Duration {
+	return parseDurationOr(c.Jobs.Payments.CheckInterval, 15*time.Minute)
+}
+
+// GetPaymentStaleAfter returns how long a payment stays pending before its gateway is asked
+func (c *Config) GetPaymentStaleAfter() time.Duration {
+	return parseDurationOr(c.Jobs.Payments.StaleAfter, 30*time.Minute)
+}
+
+func (c *Config) IsPaymentReportEnabled() bool {
+	return c.Jobs.Payments.ReportEnabled
+}
+
+// GetPaymentReportInterval returns how often the previous day's reconciliation report is looked for
+func (c *Config) GetPaymentReportInterval() time.Duration {
+	return parseDurationOr(c.Jobs.Payments.ReportInterval, time.Hour)
+}
+
+func (c *Config) IsPackageChangeJobEnabled() bool {
+	return c.Jobs.PackageChange.Enabled
+}
+
+// GetPackageChangeInterval returns how often scheduled package changes are applied
+func (c *Config) GetPackageChangeInterval() time.Duration {
+	return parseDurationOr(c.Jobs.PackageChange.CheckInterval, time.Hour)
+}
+
+func (c *Config) GetShippingConfig() ShippingConfig {
+	return c.Shipping
+}
+
+// GetReceiptsConfig returns the receipt delivery settings. Without public URLs the
+// links point at this server, and without a signing key tokens are signed with the
+// JWT secret.
+func (c *Config) GetReceiptsConfig() ReceiptsConfig {
+	cfg := c.Receipts
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = "http://localhost" + c.GetServerPort() + "/api/receipts/public"
+	}
+	if cfg.VerifyURL == "" {
+		cfg.VerifyURL = "http://localhost" + c.GetServerPort() + "/api/receipts/verify"
+	}
+	if cfg.SigningKey == "" {
+		cfg.SigningKey = c.GetJWTSecret()
+	}
+	cfg.PublicURL = strings.TrimRight(cfg.PublicURL, "/")
+	cfg.VerifyURL = strings.TrimRight(cfg.VerifyURL, "/")
+	return cfg
+}
+
+// GetEInvoiceConfig returns the e-invoicing settings. Documents go to the local
+// stand-in unless the ETA submitter is configured.
+func (c *Config) GetEInvoiceConfig() EInvoiceConfig {
+	cfg := c.EInvoice
+	if cfg.Submitter == "" {
+		cfg.Submitter = "local"
+	}
+	if cfg.DocumentVersion == "" {
+		cfg.DocumentVersion = "0.9"
+	}
+	if cfg.Platform.BranchID == "" {
+		cfg.Platform.BranchID = "0"
+	}
+	if cfg.Platform.TaxRate == 0 {
+		cfg.Platform.TaxRate = 14
+	}
+	cfg.IdentityURL = strings.TrimRight(cfg.IdentityURL, "/")
+	cfg.APIURL = strings.TrimRight(cfg.APIURL, "/")
+	return cfg
+}
+
+func (c *Config) IsBillingEnabled() bool {
+	return c.Billing.Enabled
+}
+
+// GetBillingCheckInterval returns how often renewals and dunning are processed
+func (c *Config) GetBillingCheckInterval() time.Duration {
+	return parseDurationOr(c.Billing.CheckInterval, time.Hour)
+}
+
+// GetRenewBefore returns how long before a period ends its renewal invoice is issued
+func (c *Config) GetRenewBefore() time.Duration {
+	return parseDurationOr(c.Billing.RenewBefore, 72*time.Hour)
+}
+
+// GetRenewalRetryInterval returns the wait between payment attempts of an unpaid invoice
+func (c *Config) GetRenewalRetryInterval() time.Duration {
+	return parseDurationOr(c.Billing.RetryInterval, 48*time.Hour)
+}
+
+// GetRenewalMaxAttempts returns the number of payment attempts per renewal invoice
+func (c *Config) GetRenewalMaxAttempts() int {
+	if c.Billing.MaxAttempts <= 0 {
+		return 3
+	}
+	return c.Billing.MaxAttempts
+}
+
+// GetGracePeriod returns how long paid features are kept after an unpaid period ends
+func (c *Config) GetGracePeriod() time.Duration {
+	return parseDurationOr(c.Billing.GracePeriod, 7*24*time.Hour)
+}
+
+// ShouldSuspendOnFailure reports whether unpaid subscriptions are suspended
+// instead of downgraded to the free package, as they must be without one
+func (c *Config) ShouldSuspendOnFailure() bool {
+	return c.Billing.OnFailure == "suspend" || c.Billing.FreePackageID == 0
+}
+
+// GetFreePackageID returns the zero-price package users are downgraded to, or 0
+// when none is configured
+func (c *Config) GetFreePackageID() uint {
+	return c.Billing.FreePackageID
+}
+
+// GetReportsAddonID returns the add-on analytics reports are metered against, or 0
+func (c *Config) GetReportsAddonID() uint {
+	return c.Addons.ReportsAddonID
+}
+
+// GetEmailsAddonID returns the add-on emails sent on request are metered against, or 0
+func (c *Config) GetEmailsAddonID() uint {
+	return c.Addons.EmailsAddonID
+}
+
+// GetRenewalPaymentMethod returns the gateway used for renewals when the user's last one is not enabled
+func (c *Config) GetRenewalPaymentMethod() string {
+	return c.Billing.PaymentMethod
+}
+
+func (c *Config) IsEmailEnabled() bool {
+	return c.Email.SMTPHost != "" && c.Email.FromEmail != ""
+}
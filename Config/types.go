@@ -10,6 +10,12 @@ type Config struct {
 	Storage   StorageConfig   `yaml:"storage"`
 	Payment   PaymentConfig   `yaml:"payment"`
 	RabbitMQ  RabbitMQConfig  `yaml:"rabbitmq"`
+	Shipping  ShippingConfig  `yaml:"shipping"`
+	Receipts  ReceiptsConfig  `yaml:"receipts"`
+	EInvoice  EInvoiceConfig  `yaml:"einvoice"`
+	Billing   BillingConfig   `yaml:"billing"`
+	Addons    AddonsConfig    `yaml:"addons"`
+	Jobs      JobsConfig      `yaml:"jobs"`
 }
 
 type DatabaseConfig struct {
@@ -90,8 +96,11 @@ type OAuthProviderConfig struct {
 }
 
 type PaymentConfig struct {
-	Fawry  FawryConfig  `yaml:"fawry"`
-	Paymob PaymobConfig `yaml:"paymob"`
+	Currency string        `yaml:"currency"` // Platform currency: package and add-on charges, default store currency
+	Fawry    FawryConfig   `yaml:"fawry"`
+	Paymob   PaymobConfig  `yaml:"paymob"`
+	Sandbox  SandboxConfig `yaml:"sandbox"`
+	Offline  OfflineConfig `yaml:"offline"`
 }
 
 type FawryConfig struct {
@@ -112,6 +121,32 @@ type PaymobConfig struct {
 	Enabled       bool   `yaml:"enabled"`
 }
 
+// SandboxConfig enables the built-in gateway that simulates payments without a
+// merchant account. Never enable it in production.
+type SandboxConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Outcome      string `yaml:"outcome"`       // success, failure or pending
+	Delay        string `yaml:"delay"`         // Wait before the simulated callback, e.g. 5s
+	AutoComplete bool   `yaml:"auto_complete"` // Call back without visiting the checkout page
+	CheckoutURL  string `yaml:"checkout_url"`
+	CallbackURL  string `yaml:"callback_url"`
+	Secret       string `yaml:"secret"` // Signs simulated callbacks
+}
+
+// OfflineConfig enables payments made outside a gateway and confirmed by hand.
+// The account receives transfers for platform charges; stores give their own
+// account for storefront orders.
+type OfflineConfig struct {
+	CashOnDelivery  bool   `yaml:"cash_on_delivery"` // Storefront orders only
+	BankTransfer    bool   `yaml:"bank_transfer"`
+	InstaPay        bool   `yaml:"instapay"`
+	ProofWindow     string `yaml:"proof_window"` // Time to upload proof of a transfer, e.g. 72h
+	BankName        string `yaml:"bank_name"`
+	AccountName     string `yaml:"account_name"`
+	AccountNumber   string `yaml:"account_number"` // Account number or IBAN
+	InstaPayAddress string `yaml:"instapay_address"`
+}
+
 type RabbitMQConfig struct {
 	URL      string `yaml:"url"`
 	Enabled  bool   `yaml:"enabled"`
@@ -121,3 +156,120 @@ type RabbitMQConfig struct {
 	Password string `yaml:"password"`
 	Vhost    string `yaml:"vhost"`
 }
+
+// ShippingConfig lists the couriers shipments can be booked with
+type ShippingConfig struct {
+	DefaultCarrier string          `yaml:"default_carrier"`
+	Carriers       []CarrierConfig `yaml:"carriers"`
+}
+
+type CarrierConfig struct {
+	Name      string            `yaml:"name"`
+	Type      string            `yaml:"type"` // mock or http
+	BaseURL   string            `yaml:"base_url"`
+	APIKey    string            `yaml:"api_key"`
+	Timeout   string            `yaml:"timeout"`    // e.g. 15s
+	StatusMap map[string]string `yaml:"status_map"` // Courier status code -> shipment status, e.g. "OFD": OUT_FOR_DELIVERY
+	Enabled   bool              `yaml:"enabled"`
+}
+
+// ReceiptsConfig controls how receipts reach customers
+type ReceiptsConfig struct {
+	PublicURL        string `yaml:"public_url"`         // Public receipt endpoint; the receipt token is appended
+	EmailOnPaid      bool   `yaml:"email_on_paid"`      // Email the receipt to the customer when the order is paid
+	EmailOnDelivered bool   `yaml:"email_on_delivered"` // Email it on delivery when it was not sent on payment
+	VerifyURL        string `yaml:"verify_url"`         // Public verification endpoint encoded in the QR code; the token is appended
+	SigningKey       string `yaml:"signing_key"`        // Signs verification tokens; changing it invalidates printed QR codes
+}
+
+// EInvoiceConfig controls Egyptian Tax Authority (ETA) e-invoicing
+type EInvoiceConfig struct {
+	Submitter       string               `yaml:"submitter"`    // local (in-memory stand-in) or eta
+	IdentityURL     string               `yaml:"identity_url"` // ETA identity service, e.g. https://id.preprod.eta.gov.eg
+	APIURL          string               `yaml:"api_url"`      // ETA invoicing API, e.g. https://api.preprod.invoicing.eta.gov.eg
+	ClientID        string               `yaml:"client_id"`    // ERP system credentials registered with the ETA
+	ClientSecret    string               `yaml:"client_secret"`
+	Timeout         string               `yaml:"timeout"`          // e.g. 30s
+	DocumentVersion string               `yaml:"document_version"` // 0.9 is unsigned (pre-production); 1.0 needs a signature
+	Platform        EInvoiceIssuerConfig `yaml:"platform"`         // Issuer of invoices for package payments
+}
+
+// EInvoiceIssuerConfig is the platform's own taxpayer registration
+type EInvoiceIssuerConfig struct {
+	TaxRegistrationNumber string  `yaml:"tax_registration_number"`
+	Name                  string  `yaml:"name"`
+	ActivityCode          string  `yaml:"activity_code"`
+	BranchID              string  `yaml:"branch_id"`
+	Governate             string  `yaml:"governate"`
+	RegionCity            string  `yaml:"region_city"`
+	Street                string  `yaml:"street"`
+	BuildingNumber        string  `yaml:"building_number"`
+	TaxRate               float64 `yaml:"tax_rate"`           // VAT percent, e.g. 14
+	PricesIncludeTax      bool    `yaml:"prices_include_tax"` // Package prices already include VAT
+}
+
+// BillingConfig controls package renewals and dunning
+type BillingConfig struct {
+	Enabled       bool   `yaml:"enabled"`         // Run the renewal job
+	CheckInterval string `yaml:"check_interval"`  // How often renewals, dunning and period ends are processed, e.g. 1h
+	RenewBefore   string `yaml:"renew_before"`    // Renewal invoices are issued this long before the period ends, e.g. 72h
+	RetryInterval string `yaml:"retry_interval"`  // Between payment attempts of an unpaid invoice, e.g. 48h
+	MaxAttempts   int    `yaml:"max_attempts"`    // Payment attempts per invoice, the first included
+	GracePeriod   string `yaml:"grace_period"`    // Paid features are kept this long after an unpaid period ends, e.g. 168h
+	OnFailure     string `yaml:"on_failure"`      // After the grace period: downgrade (to the free package) or suspend
+	FreePackageID uint   `yaml:"free_package_id"` // Zero-price package users are downgraded to; unset suspends instead
+	PaymentMethod string `yaml:"payment_method"`  // Gateway for renewals when the user's last one is not enabled
+}
+
+// AddonsConfig names the usage-priced add-ons that metered routes draw on: each
+// request reserves one unit. A route whose add-on is unset is not metered.
+type AddonsConfig struct {
+	ReportsAddonID uint `yaml:"reports_addon_id"` // Analytics reports, e.g. the cart recovery report
+	EmailsAddonID  uint `yaml:"emails_addon_id"`  // Emails sent on request, e.g. an order receipt
+}
+
+// JobsConfig holds settings for background jobs started with the server
+type JobsConfig struct {
+	AbandonedCart AbandonedCartConfig `yaml:"abandoned_cart"`
+	LowStock      LowStockConfig      `yaml:"low_stock"`
+	Shipments     ShipmentJobConfig   `yaml:"shipments"`
+	Payments      PaymentJobConfig    `yaml:"payments"`
+	PackageChange PackageChangeConfig `yaml:"package_changes"`
+}
+
+type AbandonedCartConfig struct {
+	Enabled          bool    `yaml:"enabled"`
+	CheckInterval    string  `yaml:"check_interval"`    // How often the job runs, e.g. 15m
+	IdleThreshold    string  `yaml:"idle_threshold"`    // Cart idle time before it counts as abandoned, e.g. 1h
+	ReminderInterval string  `yaml:"reminder_interval"` // Gap between reminders, e.g. 24h
+	MaxReminders     int     `yaml:"max_reminders"`
+	RestoreURL       string  `yaml:"restore_url"` // Storefront page that restores a cart; the token is appended
+	CouponEnabled    bool    `yaml:"coupon_enabled"`
+	CouponPercent    float64 `yaml:"coupon_percent"`
+	CouponValidDays  int     `yaml:"coupon_valid_days"`
+	CouponReminder   int     `yaml:"coupon_reminder"` // Reminder number that first carries the coupon
+}
+
+type LowStockConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	CheckInterval   string `yaml:"check_interval"`    // How often stock levels are checked, e.g. 1h
+	SalesWindowDays int    `yaml:"sales_window_days"` // Days of sales used to compute velocity for reorder suggestions
+}
+
+type ShipmentJobConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	CheckInterval string `yaml:"check_interval"` // How often open shipments are tracked with their carrier, e.g. 30m
+}
+
+type PaymentJobConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	CheckInterval  string `yaml:"check_interval"`  // How often pending payments are checked with their gateway, e.g. 15m
+	StaleAfter     string `yaml:"stale_after"`     // Age at which a pending payment is checked, e.g. 30m
+	ReportEnabled  bool   `yaml:"report_enabled"`  // Build a daily reconciliation report of the previous day
+	ReportInterval string `yaml:"report_interval"` // How often a missing daily report is looked for, e.g. 1h
+}
+
+type PackageChangeConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	CheckInterval string `yaml:"check_interval"` // How often scheduled downgrades are applied once their period ends, e.g. 1h
+}
@@ -6,7 +6,8 @@ import "time"
 
 // DashboardStats represents user dashboard statistics
 type DashboardStats struct {
-	UserID uint `json:"user_id"`
+	UserID   uint   `json:"user_id"`
+	Currency string `json:"currency"` // Revenue figures are in the store currency
 
 	// Orders
 	TotalOrders     int64   `json:"total_orders"`
@@ -48,6 +49,11 @@ type DashboardStats struct {
 	// Addons
 	ActiveAddons int64 `json:"active_addons"`
 
+	// Abandoned carts
+	AbandonedCarts   int64   `json:"abandoned_carts"`
+	RecoveredCarts   int64   `json:"recovered_carts"`
+	RecoveredRevenue float64 `json:"recovered_revenue"`
+
 	// Generated at
 	GeneratedAt time.Time `json:"generated_at"`
 }
@@ -1,28 +1,39 @@
 package dbmodels
 
-import "time"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 type Order struct {
-	ID                uint        `gorm:"primaryKey"`
-	ClientID          uint        `gorm:"not null"`
-	Client            Client      `gorm:"foreignKey:ClientID"`
-	UserID            uint        `gorm:"not null"`
-	User              User        `gorm:"foreignKey:UserID"`
-	Total             float64     `gorm:"not null"`
-	Status            OrderStatus `gorm:"not null"` // Enum as int
+	ID                uint            `gorm:"primaryKey"`
+	ClientID          uint            `gorm:"not null"`
+	Client            Client          `gorm:"foreignKey:ClientID"`
+	UserID            uint            `gorm:"not null"`
+	User              User            `gorm:"foreignKey:UserID"`
+	Total             decimal.Decimal `gorm:"type:numeric(14,2);not null"`
+	Status            OrderStatus     `gorm:"not null"` // Enum as int
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
-	Items             []OrderItem `gorm:"foreignKey:OrderID"`
-	Address           string      `gorm:"type:text"` // Shipping address
-	Phone             string      `gorm:"size:20"`   // Shipping phone
-	Notes             string      `gorm:"type:text"` // Order notes
-	PaymentStatus     string      `gorm:"size:50"`   // Payment status
-	PaymentAmount     float64     `gorm:"default:0"` // Payment amount
-	PaymentMethodId   int64       `gorm:"default:0"` // Payment method identifier
-	PaymentMethodDesc string      `gorm:"type:text"` // Payment method description
-	PaymentDate       *time.Time  // Date of payment
-	PaymentRef        string      `gorm:"size:255"` // Payment reference number
-
+	Items             []OrderItem     `gorm:"foreignKey:OrderID"`
+	Address           string          `gorm:"type:text"`                             // Shipping address
+	Phone             string          `gorm:"size:20"`                               // Shipping phone
+	Notes             string          `gorm:"type:text"`                             // Order notes
+	PaymentStatus     string          `gorm:"size:50"`                               // Payment status
+	PaymentAmount     decimal.Decimal `gorm:"type:numeric(14,2);not null;default:0"` // Payment amount
+	PaymentMethodId   int64           `gorm:"default:0"`                             // Payment method identifier
+	PaymentMethodDesc string          `gorm:"type:text"`                             // Payment method description
+	PaymentDate       *time.Time      // Date of payment
+	PaymentRef        string          `gorm:"size:255"` // Payment reference number
+	Payments          []Payment       `gorm:"foreignKey:OrderID"`
+	CheckoutToken     string          `gorm:"size:64;index" json:"-"`                // Lets a guest shopper access their own order
+	Discount          decimal.Decimal `gorm:"type:numeric(14,2);not null;default:0"` // Coupon discount already taken off Total
+	CouponCode        string          `gorm:"size:50"`
+	Currency          string          `gorm:"size:3;not null;default:'EGP'"`         // Currency the shopper was charged in
+	ExchangeRate      decimal.Decimal `gorm:"type:numeric(18,8);not null;default:1"` // Units of Currency per unit of BaseCurrency at checkout
+	BaseCurrency      string          `gorm:"size:3;not null;default:'EGP'"`         // Store currency when the order was placed
+	BaseTotal         decimal.Decimal `gorm:"type:numeric(14,2);not null;default:0"` // Total converted to BaseCurrency, used for reporting
 }
 
 type OrderStatus int32
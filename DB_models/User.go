@@ -51,6 +51,11 @@ type User struct {
 	Bio      string `gorm:"type:text" json:"Bio,omitempty"`
 	Website  string `gorm:"size:500" json:"Website,omitempty"`
 	Location string `gorm:"size:255" json:"Location,omitempty"`
+
+	// Store settings
+	Currency string `gorm:"size:3" json:"Currency,omitempty"` // Store base currency; empty uses the platform currency
+	Language string `gorm:"size:5" json:"Language,omitempty"` // Receipt language; empty follows the request
+	Numerals string `gorm:"size:4" json:"Numerals,omitempty"` // Receipt digits: latn or arab
 }
 
 func (u *User) HashPassword(password string) error {
@@ -94,11 +99,16 @@ type Permission struct {
 	UpdatedAt time.Time
 }
 type Client struct {
-	ID        uint   `gorm:"primaryKey"`
-	Name      string `gorm:"size:255;not null"`
-	Email     string `gorm:"size:255;not null"`
-	UserID    uint   `gorm:"not null"`
-	User      User   `gorm:"foreignKey:UserID"`
+	ID        uint            `gorm:"primaryKey"`
+	Name      string          `gorm:"size:255;not null"`
+	Email     string          `gorm:"size:255;not null"`
+	Phone     string          `gorm:"size:20"`
+	Address   string          `gorm:"type:text"`
+	Company   string          `gorm:"size:255"`
+	Tags      string          `gorm:"type:text"` // JSON array of tags
+	UserID    uint            `gorm:"not null"`  // Store owner
+	User      User            `gorm:"foreignKey:UserID"`
+	Addresses []ClientAddress `gorm:"foreignKey:ClientID"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
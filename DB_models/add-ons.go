@@ -1,41 +1,62 @@
 package dbmodels
 
-import "time"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 // ========== ADD-ONS SYSTEM ==========
 
 // Addon represents an add-on service/feature that users can subscribe to
 type Addon struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	Title        string    `gorm:"size:255;not null" json:"title"`
-	Description  string    `gorm:"type:text" json:"description"`
-	Logo         string    `gorm:"size:500" json:"logo"`                 // URL to logo image
-	Photo        string    `gorm:"size:500" json:"photo"`                // Main photo URL
-	Category     string    `gorm:"size:100" json:"category"`             // e.g., "AI", "Integration", "Marketing"
-	PricingType  string    `gorm:"size:50;not null" json:"pricing_type"` // "time" or "usage"
-	BasePrice    float64   `gorm:"not null" json:"base_price"`           // Base price
-	Currency     string    `gorm:"size:10;default:'EGP'" json:"currency"`
-	BillingCycle int       `gorm:"default:30" json:"billing_cycle"` // Days for time-based
-	UsageUnit    string    `gorm:"size:50" json:"usage_unit"`       // e.g., "requests", "messages", "credits"
-	Features     string    `gorm:"type:text" json:"features"`       // JSON array of features
-	IsActive     bool      `gorm:"default:true" json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           uint            `gorm:"primaryKey" json:"id"`
+	Title        string          `gorm:"size:255;not null" json:"title"`
+	Description  string          `gorm:"type:text" json:"description"`
+	Logo         string          `gorm:"size:500" json:"logo"`                          // URL to logo image
+	Photo        string          `gorm:"size:500" json:"photo"`                         // Main photo URL
+	Category     string          `gorm:"size:100" json:"category"`                      // e.g., "AI", "Integration", "Marketing"
+	PricingType  string          `gorm:"size:50;not null" json:"pricing_type"`          // "time" or "usage"
+	BasePrice    decimal.Decimal `gorm:"type:numeric(14,2);not null" json:"base_price"` // Base price
+	Currency     string          `gorm:"size:10;default:'EGP'" json:"currency"`
+	BillingCycle int             `gorm:"default:30" json:"billing_cycle"`                            // Days for time-based
+	UsageUnit    string          `gorm:"size:50" json:"usage_unit"`                                  // e.g., "requests", "messages", "credits"
+	Features     string          `gorm:"type:text" json:"features"`                                  // JSON array of features
+	OveragePrice decimal.Decimal `gorm:"type:numeric(14,2);not null;default:0" json:"overage_price"` // Per unit past the usage limit; zero refuses usage past it
+	OverageLimit int             `gorm:"not null;default:0" json:"overage_limit"`                    // Units past the limit allowed per period; 0 is no cap
+	IsActive     bool            `gorm:"default:true" json:"is_active"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// UsagePeriod returns the billing period of a subscription that contains at:
+// consecutive BillingCycle days from its start date
+func (a *Addon) UsagePeriod(start, at time.Time) (time.Time, time.Time) {
+	cycle := a.BillingCycle
+	if cycle <= 0 {
+		cycle = 30
+	}
+	periodStart := start
+	periodEnd := start.AddDate(0, 0, cycle)
+	for !periodEnd.After(at) {
+		periodStart, periodEnd = periodEnd, periodEnd.AddDate(0, 0, cycle)
+	}
+	return periodStart, periodEnd
 }
 
 // AddonPricingTier represents volume/duration discounts
 type AddonPricingTier struct {
-	ID            uint      `gorm:"primaryKey" json:"id"`
-	AddonID       uint      `gorm:"not null" json:"addon_id"`
-	Addon         Addon     `gorm:"foreignKey:AddonID" json:"addon,omitempty"`
-	MinQuantity   int       `gorm:"not null" json:"min_quantity"`          // Min units/months
-	MaxQuantity   int       `json:"max_quantity"`                          // Max units/months (0 = unlimited)
-	DiscountType  string    `gorm:"size:20;not null" json:"discount_type"` // "percentage" or "fixed"
-	DiscountValue float64   `gorm:"not null" json:"discount_value"`
-	FinalPrice    float64   `gorm:"not null" json:"final_price"` // Calculated price after discount
-	Description   string    `gorm:"size:255" json:"description"` // e.g., "3 months - 10% off"
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            uint            `gorm:"primaryKey" json:"id"`
+	AddonID       uint            `gorm:"not null" json:"addon_id"`
+	Addon         Addon           `gorm:"foreignKey:AddonID" json:"addon,omitempty"`
+	MinQuantity   int             `gorm:"not null" json:"min_quantity"`                      // Min units/months
+	MaxQuantity   int             `json:"max_quantity"`                                      // Max units/months (0 = unlimited)
+	DiscountType  string          `gorm:"size:20;not null" json:"discount_type"`             // "percentage" or "fixed"
+	DiscountValue decimal.Decimal `gorm:"type:numeric(14,2);not null" json:"discount_value"` // Percent or fixed amount
+	FinalPrice    decimal.Decimal `gorm:"type:numeric(14,2);not null" json:"final_price"`    // Calculated price after discount
+	Description   string          `gorm:"size:255" json:"description"`                       // e.g., "3 months - 10% off"
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
 }
 
 // UserAddonSubscription represents a user's subscription to an add-on
@@ -49,7 +70,7 @@ type UserAddonSubscription struct {
 	PricingTier   *AddonPricingTier       `gorm:"foreignKey:PricingTierID" json:"pricing_tier,omitempty"`
 	Status        AddonSubscriptionStatus `gorm:"not null;default:0" json:"status"`
 	Quantity      int                     `gorm:"not null" json:"quantity"` // Months or units purchased
-	TotalPrice    float64                 `gorm:"not null" json:"total_price"`
+	TotalPrice    decimal.Decimal         `gorm:"type:numeric(14,2);not null" json:"total_price"`
 	StartDate     time.Time               `gorm:"not null" json:"start_date"`
 	EndDate       *time.Time              `json:"end_date,omitempty"`    // For time-based
 	UsageLimit    *int                    `json:"usage_limit,omitempty"` // For usage-based
@@ -88,8 +109,51 @@ type AddonUsageLog struct {
 	ID             uint                  `gorm:"primaryKey" json:"id"`
 	SubscriptionID uint                  `gorm:"not null" json:"subscription_id"`
 	Subscription   UserAddonSubscription `gorm:"foreignKey:SubscriptionID" json:"subscription,omitempty"`
+	PeriodID       *uint                 `gorm:"index" json:"period_id,omitempty"`
 	UsageAmount    int                   `gorm:"not null" json:"usage_amount"`
+	OverageUnits   int                   `gorm:"not null;default:0" json:"overage_units"` // Part of UsageAmount past the usage limit
 	Description    string                `gorm:"size:500" json:"description"`
 	Metadata       string                `gorm:"type:text" json:"metadata"` // JSON for additional data
 	CreatedAt      time.Time             `json:"created_at"`
 }
+
+// AddonUsagePeriod sums a subscription's usage over one billing period. Overage
+// of ended periods is billed with the user's next renewal invoice.
+type AddonUsagePeriod struct {
+	ID             uint              `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint              `gorm:"not null;uniqueIndex:idx_usage_period" json:"subscription_id"`
+	UserID         uint              `gorm:"not null;index" json:"user_id"`
+	AddonID        uint              `gorm:"not null;index" json:"addon_id"`
+	Addon          *Addon            `gorm:"foreignKey:AddonID" json:"addon,omitempty"`
+	PeriodStart    time.Time         `gorm:"not null;uniqueIndex:idx_usage_period" json:"period_start"`
+	PeriodEnd      time.Time         `gorm:"not null;index" json:"period_end"`
+	UsedUnits      int               `gorm:"not null;default:0" json:"used_units"`
+	OverageUnits   int               `gorm:"not null;default:0" json:"overage_units"`
+	UnitPrice      decimal.Decimal   `gorm:"type:numeric(14,2);not null;default:0" json:"unit_price"` // Overage price when the period opened
+	OverageAmount  decimal.Decimal   `gorm:"type:numeric(14,2);not null;default:0" json:"overage_amount"`
+	Currency       string            `gorm:"size:10;default:'EGP'" json:"currency"` // The add-on's currency
+	Status         UsagePeriodStatus `gorm:"not null;default:0;index" json:"status"`
+	InvoiceID      *uint             `gorm:"index" json:"invoice_id,omitempty"` // Renewal invoice the overage was billed with
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+type UsagePeriodStatus int32
+
+const (
+	UsagePeriodStatus_OPEN     UsagePeriodStatus = 0 // Current, or ended with overage not billed yet
+	UsagePeriodStatus_CLOSED   UsagePeriodStatus = 1 // Ended with nothing to bill
+	UsagePeriodStatus_INVOICED UsagePeriodStatus = 2
+)
+
+var (
+	UsagePeriodStatus_name = map[int32]string{
+		0: "OPEN",
+		1: "CLOSED",
+		2: "INVOICED",
+	}
+)
+
+func (x UsagePeriodStatus) String() string {
+	return UsagePeriodStatus_name[int32(x)]
+}
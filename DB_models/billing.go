@@ -0,0 +1,132 @@
+package dbmodels
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ========== SUBSCRIPTION BILLING ==========
+
+type SubscriptionStatus int32
+
+const (
+	SubscriptionStatus_ACTIVE    SubscriptionStatus = 0
+	SubscriptionStatus_PAST_DUE  SubscriptionStatus = 1 // Period ended unpaid; paid features kept during the grace period
+	SubscriptionStatus_SUSPENDED SubscriptionStatus = 2 // Grace period ended unpaid; paid features are withheld
+	SubscriptionStatus_ENDED     SubscriptionStatus = 3 // Renewed, replaced by a package change or downgraded
+)
+
+var (
+	SubscriptionStatus_name = map[int32]string{
+		0: "ACTIVE",
+		1: "PAST_DUE",
+		2: "SUSPENDED",
+		3: "ENDED",
+	}
+)
+
+func (x SubscriptionStatus) String() string {
+	return SubscriptionStatus_name[int32(x)]
+}
+
+// SubscriptionInvoice bills the next period of a subscription. Each collection
+// attempt is a new gateway payment linked through Payment.InvoiceID.
+type SubscriptionInvoice struct {
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	UserID         uint            `gorm:"not null;index" json:"user_id"`
+	SubscriptionID uint            `gorm:"not null;index" json:"subscription_id"` // Subscription being renewed
+	PackageID      uint            `gorm:"not null" json:"package_id"`
+	Package        *Package        `gorm:"foreignKey:PackageID" json:"package,omitempty"`
+	Amount         decimal.Decimal `gorm:"type:numeric(14,2);not null" json:"amount"`                 // Package price plus UsageAmount
+	UsageAmount    decimal.Decimal `gorm:"type:numeric(14,2);not null;default:0" json:"usage_amount"` // Add-on overage of ended usage periods
+	Currency       string          `gorm:"size:10;default:'EGP'" json:"currency"`
+	PeriodStart    time.Time       `gorm:"not null" json:"period_start"`
+	PeriodEnd      time.Time       `gorm:"not null" json:"period_end"`
+	DueAt          time.Time       `gorm:"not null" json:"due_at"` // End of the current period
+	Status         InvoiceStatus   `gorm:"not null;default:0;index" json:"status"`
+	Attempts       int             `gorm:"not null;default:0" json:"attempts"`
+	PaymentID      *uint           `json:"payment_id,omitempty"` // Latest payment attempt
+	Payment        *Payment        `gorm:"foreignKey:PaymentID" json:"payment,omitempty"`
+	NextAttemptAt  *time.Time      `gorm:"index" json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	PaidAt         *time.Time      `json:"paid_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+type InvoiceStatus int32
+
+const (
+	InvoiceStatus_OPEN          InvoiceStatus = 0
+	InvoiceStatus_PAID          InvoiceStatus = 1
+	InvoiceStatus_VOID          InvoiceStatus = 2 // Not needed any more, e.g. cancelled or replaced by a package change
+	InvoiceStatus_UNCOLLECTIBLE InvoiceStatus = 3 // Unpaid when the grace period ended
+)
+
+var (
+	InvoiceStatus_name = map[int32]string{
+		0: "OPEN",
+		1: "PAID",
+		2: "VOID",
+		3: "UNCOLLECTIBLE",
+	}
+	InvoiceStatus_value = map[string]int32{
+		"OPEN":          0,
+		"PAID":          1,
+		"VOID":          2,
+		"UNCOLLECTIBLE": 3,
+	}
+)
+
+func (x InvoiceStatus) String() string {
+	return InvoiceStatus_name[int32(x)]
+}
+
+// SubscriptionEvent records one step of a subscription's billing lifecycle
+type SubscriptionEvent struct {
+	ID             uint                  `gorm:"primaryKey" json:"id"`
+	UserID         uint                  `gorm:"not null;index" json:"user_id"`
+	SubscriptionID *uint                 `gorm:"index" json:"subscription_id,omitempty"`
+	InvoiceID      *uint                 `gorm:"index" json:"invoice_id,omitempty"`
+	PaymentID      *uint                 `json:"payment_id,omitempty"`
+	Type           SubscriptionEventType `gorm:"not null;default:0" json:"type"`
+	Message        string                `gorm:"type:text" json:"message"`
+	CreatedAt      time.Time             `json:"created_at"`
+}
+
+type SubscriptionEventType int32
+
+const (
+	SubscriptionEventType_INVOICE_ISSUED    SubscriptionEventType = 0
+	SubscriptionEventType_PAYMENT_REQUESTED SubscriptionEventType = 1 // A payment attempt was started and the user asked to pay
+	SubscriptionEventType_PAYMENT_FAILED    SubscriptionEventType = 2
+	SubscriptionEventType_RENEWED           SubscriptionEventType = 3
+	SubscriptionEventType_GRACE_STARTED     SubscriptionEventType = 4
+	SubscriptionEventType_SUSPENDED         SubscriptionEventType = 5
+	SubscriptionEventType_DOWNGRADED        SubscriptionEventType = 6
+	SubscriptionEventType_REACTIVATED       SubscriptionEventType = 7  // Paid after suspension or downgrade
+	SubscriptionEventType_CANCELLED         SubscriptionEventType = 8  // Renewal turned off by the user
+	SubscriptionEventType_RESUMED           SubscriptionEventType = 9  // Renewal turned back on
+	SubscriptionEventType_DUPLICATE_PAYMENT SubscriptionEventType = 10 // Paid an invoice that was already paid or void; to be refunded
+)
+
+var (
+	SubscriptionEventType_name = map[int32]string{
+		0:  "INVOICE_ISSUED",
+		1:  "PAYMENT_REQUESTED",
+		2:  "PAYMENT_FAILED",
+		3:  "RENEWED",
+		4:  "GRACE_STARTED",
+		5:  "SUSPENDED",
+		6:  "DOWNGRADED",
+		7:  "REACTIVATED",
+		8:  "CANCELLED",
+		9:  "RESUMED",
+		10: "DUPLICATE_PAYMENT",
+	}
+)
+
+func (x SubscriptionEventType) String() string {
+	return SubscriptionEventType_name[int32(x)]
+}
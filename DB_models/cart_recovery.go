@@ -0,0 +1,66 @@
+package dbmodels
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ========== ABANDONED CART RECOVERY ==========
+
+// CartRecovery tracks an idle cart, the reminders sent for it and whether it was recovered
+type CartRecovery struct {
+	ID               uint               `gorm:"primaryKey" json:"id"`
+	UserID           *uint              `gorm:"index" json:"user_id,omitempty"`
+	SessionID        string             `gorm:"size:255;index" json:"session_id,omitempty"`
+	StoreOwnerID     uint               `gorm:"not null;index" json:"store_owner_id"`
+	Email            string             `gorm:"size:255" json:"email,omitempty"` // Captured for guest carts
+	RestoreToken     string             `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	CartTotal        decimal.Decimal    `gorm:"type:numeric(14,2);not null;default:0" json:"cart_total"`
+	ItemCount        int                `gorm:"default:0" json:"item_count"`
+	Status           CartRecoveryStatus `gorm:"not null;default:0" json:"status"`
+	ReminderCount    int                `gorm:"default:0" json:"reminder_count"`
+	LastActivityAt   time.Time          `json:"last_activity_at"`
+	LastReminderAt   *time.Time         `json:"last_reminder_at,omitempty"`
+	CouponID         *uint              `json:"coupon_id,omitempty"`
+	Coupon           *Coupon            `gorm:"foreignKey:CouponID" json:"coupon,omitempty"`
+	RecoveredOrderID *uint              `json:"recovered_order_id,omitempty"`
+	RecoveredAmount  decimal.Decimal    `gorm:"type:numeric(14,2);not null;default:0" json:"recovered_amount"`
+	RecoveredAt      *time.Time         `json:"recovered_at,omitempty"`
+	CreatedAt        time.Time          `json:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at"`
+}
+
+type CartRecoveryStatus int32
+
+const (
+	CartRecoveryStatus_OPEN      CartRecoveryStatus = 0
+	CartRecoveryStatus_RECOVERED CartRecoveryStatus = 1
+	CartRecoveryStatus_EXPIRED   CartRecoveryStatus = 2
+)
+
+var (
+	CartRecoveryStatus_name = map[int32]string{
+		0: "OPEN",
+		1: "RECOVERED",
+		2: "EXPIRED",
+	}
+	CartRecoveryStatus_value = map[string]int32{
+		"OPEN":      0,
+		"RECOVERED": 1,
+		"EXPIRED":   2,
+	}
+)
+
+func (x CartRecoveryStatus) String() string {
+	return CartRecoveryStatus_name[int32(x)]
+}
+
+// CartRecoveryStats summarizes abandoned cart recovery for a store
+type CartRecoveryStats struct {
+	AbandonedCarts   int64   `json:"abandoned_carts"`
+	RemindedCarts    int64   `json:"reminded_carts"`
+	RecoveredCarts   int64   `json:"recovered_carts"`
+	RecoveredRevenue float64 `json:"recovered_revenue"`
+	RecoveryRate     float64 `json:"recovery_rate"` // Recovered / reminded, in percent
+}
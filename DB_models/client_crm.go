@@ -0,0 +1,75 @@
+package dbmodels
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ========== CLIENT CRM ==========
+
+// ClientAddress is one of a client's shipping or billing addresses
+type ClientAddress struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ClientID   uint      `gorm:"not null;index" json:"client_id"`
+	Label      string    `gorm:"size:100" json:"label"` // home, work, billing...
+	Line1      string    `gorm:"size:500;not null" json:"line1"`
+	Line2      string    `gorm:"size:500" json:"line2"`
+	City       string    `gorm:"size:255" json:"city"`
+	State      string    `gorm:"size:255" json:"state"`
+	PostalCode string    `gorm:"size:20" json:"postal_code"`
+	Country    string    `gorm:"size:100;default:'Egypt'" json:"country"`
+	IsDefault  bool      `gorm:"default:false" json:"is_default"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ClientNote is a free-form note a store owner keeps on a client
+type ClientNote struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ClientID  uint      `gorm:"not null;index" json:"client_id"`
+	AuthorID  uint      `gorm:"not null" json:"author_id"`
+	Body      string    `gorm:"type:text;not null" json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ClientListItem is a client row with its computed order metrics
+type ClientListItem struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Phone         string     `json:"phone"`
+	Company       string     `json:"company"`
+	Tags          string     `json:"tags"`
+	CreatedAt     time.Time  `json:"created_at"`
+	OrderCount    int64      `json:"order_count"`
+	LifetimeValue float64    `json:"lifetime_value"`
+	LastOrderAt   *time.Time `json:"last_order_at,omitempty"`
+}
+
+// ClientMetrics are computed from the client's non-canceled orders
+type ClientMetrics struct {
+	OrderCount        int64      `json:"order_count"`
+	LifetimeValue     float64    `json:"lifetime_value"`
+	AverageOrderValue float64    `json:"average_order_value"`
+	FirstOrderAt      *time.Time `json:"first_order_at,omitempty"`
+	LastOrderAt       *time.Time `json:"last_order_at,omitempty"`
+}
+
+// ClientTimelineEntry is one event in a client's history
+type ClientTimelineEntry struct {
+	Type        string           `json:"type"` // order, receipt, message, note
+	ReferenceID uint             `json:"reference_id"`
+	Title       string           `json:"title"`
+	Description string           `json:"description,omitempty"`
+	Amount      *decimal.Decimal `json:"amount,omitempty"`
+	OccurredAt  time.Time        `json:"occurred_at"`
+}
+
+// ClientDuplicateGroup is a set of a store's clients sharing an email or phone number
+type ClientDuplicateGroup struct {
+	MatchedOn string   `json:"matched_on"` // email or phone
+	Value     string   `json:"value"`
+	Clients   []Client `json:"clients"`
+}
@@ -0,0 +1,28 @@
+package dbmodels
+
+import "time"
+
+// ========== COUPONS ==========
+
+// Coupon is a percentage discount a store grants on storefront orders
+type Coupon struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	Code            string     `gorm:"size:50;uniqueIndex;not null" json:"code"`
+	UserID          uint       `gorm:"not null;index" json:"user_id"` // Store owner
+	DiscountPercent float64    `gorm:"not null" json:"discount_percent"`
+	MaxUses         int        `gorm:"not null;default:1" json:"max_uses"`
+	UsedCount       int        `gorm:"not null;default:0" json:"used_count"`
+	Source          string     `gorm:"size:50" json:"source,omitempty"` // e.g. 'cart_recovery'
+	IsActive        bool       `gorm:"default:true" json:"is_active"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// IsUsable reports whether the coupon can still be redeemed for the given store
+func (c *Coupon) IsUsable(storeOwnerID uint) bool {
+	if !c.IsActive || c.UserID != storeOwnerID || c.UsedCount >= c.MaxUses {
+		return false
+	}
+	return c.ExpiresAt == nil || c.ExpiresAt.After(time.Now())
+}
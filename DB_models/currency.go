@@ -0,0 +1,52 @@
+package dbmodels
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ========== CURRENCIES & EXCHANGE RATES ==========
+
+// ExchangeRate is the number of QuoteCurrency units one BaseCurrency unit buys.
+// Rates are maintained by admins; the reverse direction is derived from the same row.
+type ExchangeRate struct {
+	ID            uint            `gorm:"primaryKey" json:"id"`
+	BaseCurrency  string          `gorm:"size:3;not null;uniqueIndex:idx_exchange_pair" json:"base_currency"`
+	QuoteCurrency string          `gorm:"size:3;not null;uniqueIndex:idx_exchange_pair" json:"quote_currency"`
+	Rate          decimal.Decimal `gorm:"type:numeric(18,8);not null" json:"rate"`
+	Source        string          `gorm:"size:100" json:"source"` // "manual", "import" or the provider name
+	UpdatedByID   *uint           `json:"updated_by_id,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// ProductPrice is a fixed price for a product in a currency other than the store's base currency.
+// Products without one are shown at their base price converted with the current exchange rate.
+type ProductPrice struct {
+	ID            uint            `gorm:"primaryKey" json:"id"`
+	ProductID     uint            `gorm:"not null;uniqueIndex:idx_product_currency" json:"product_id"`
+	Currency      string          `gorm:"size:3;not null;uniqueIndex:idx_product_currency" json:"currency"`
+	Price         decimal.Decimal `gorm:"type:numeric(14,2);not null" json:"price"`
+	DiscountPrice decimal.Decimal `gorm:"type:numeric(14,2);not null;default:0" json:"discount_price,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// EffectivePrice is the listed price in this currency, taking a valid discount into account
+func (p *ProductPrice) EffectivePrice() decimal.Decimal {
+	if p.DiscountPrice.IsPositive() && p.DiscountPrice.LessThan(p.Price) {
+		return p.DiscountPrice
+	}
+	return p.Price
+}
+
+// PriceQuote is a product price shown to a shopper in their currency
+type PriceQuote struct {
+	ProductID     uint            `json:"product_id"`
+	Currency      string          `json:"currency"`
+	Price         decimal.Decimal `json:"price"`
+	DiscountPrice decimal.Decimal `json:"discount_price,omitempty"`
+	ExchangeRate  decimal.Decimal `json:"exchange_rate"`
+	FromPriceList bool            `json:"from_price_list"` // false when converted from the base price
+}
@@ -1,6 +1,10 @@
 package dbmodels
 
-import "time"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 // SiteConfig model for storing customer website configurations
 type SiteConfig struct {
@@ -15,14 +19,14 @@ type SiteConfig struct {
 
 // CartItem model for shopping cart functionality
 type CartItem struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    *uint     `json:"user_id,omitempty"` // null for guest carts
-	User      *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	SessionID string    `gorm:"size:255" json:"session_id"` // For guest users
-	ProductID uint      `gorm:"not null" json:"product_id"`
-	Product   *Product  `gorm:"foreignKey:ProductID" json:"product,omitempty"`
-	Quantity  int       `gorm:"not null" json:"quantity"`
-	Price     float64   `gorm:"not null" json:"price"` // Price snapshot at time of adding
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	UserID    *uint           `json:"user_id,omitempty"` // null for guest carts
+	User      *User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	SessionID string          `gorm:"size:255" json:"session_id"` // For guest users
+	ProductID uint            `gorm:"not null" json:"product_id"`
+	Product   *Product        `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Quantity  int             `gorm:"not null" json:"quantity"`
+	Price     decimal.Decimal `gorm:"type:numeric(14,2);not null" json:"price"` // Price snapshot at time of adding
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
 }
@@ -0,0 +1,80 @@
+package dbmodels
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ========== E-INVOICING (EGYPTIAN TAX AUTHORITY) ==========
+
+// EInvoiceProfile is a store's taxpayer registration, used as the issuer of its
+// e-invoices. The address is the registered branch address.
+type EInvoiceProfile struct {
+	ID                    uint            `gorm:"primaryKey" json:"id"`
+	UserID                uint            `gorm:"not null;uniqueIndex" json:"user_id"`
+	Enabled               bool            `gorm:"default:false" json:"enabled"`
+	IssuerType            string          `gorm:"size:1;default:'B'" json:"issuer_type"` // B business, F foreigner
+	TaxRegistrationNumber string          `gorm:"size:30" json:"tax_registration_number"`
+	Name                  string          `gorm:"size:255" json:"name"`                 // Name as registered with the ETA
+	ActivityCode          string          `gorm:"size:10" json:"activity_code"`         // Taxpayer activity code, e.g. 4791
+	BranchID              string          `gorm:"size:20;default:'0'" json:"branch_id"` // 0 is the head office
+	Governate             string          `gorm:"size:100" json:"governate"`
+	RegionCity            string          `gorm:"size:100" json:"region_city"`
+	Street                string          `gorm:"size:255" json:"street"`
+	BuildingNumber        string          `gorm:"size:50" json:"building_number"`
+	PostalCode            string          `gorm:"size:20" json:"postal_code"`
+	ItemCodeType          string          `gorm:"size:5;default:'EGS'" json:"item_code_type"`            // EGS (EG-<RIN>-<SKU>) or GS1 (SKU is the GTIN)
+	TaxRate               decimal.Decimal `gorm:"type:numeric(5,2);not null;default:14" json:"tax_rate"` // VAT percent (T1, V009)
+	PricesIncludeTax      bool            `json:"prices_include_tax"`                                    // Item prices already include VAT
+	CreatedAt             time.Time       `json:"created_at"`
+	UpdatedAt             time.Time       `json:"updated_at"`
+}
+
+// E-invoice document sources
+const (
+	EInvoiceSourceOrder   = "order"
+	EInvoiceSourcePayment = "payment"
+)
+
+// E-invoice document types, as named by the ETA
+const (
+	EInvoiceTypeInvoice    = "I"
+	EInvoiceTypeCreditNote = "C" // Issued for refunds, referencing the original invoice
+)
+
+// E-invoice document statuses
+const (
+	EInvoiceStatusDraft     = "DRAFT"     // Generated, not yet submitted
+	EInvoiceStatusSubmitted = "SUBMITTED" // Accepted for validation
+	EInvoiceStatusValid     = "VALID"
+	EInvoiceStatusInvalid   = "INVALID"
+	EInvoiceStatusRejected  = "REJECTED"
+	EInvoiceStatusCancelled = "CANCELLED"
+)
+
+// EInvoiceDocument is an ETA document generated for an order or a payment. Document
+// holds the JSON exactly as it is submitted, and Hash is the SHA-256 of its
+// canonical serialization.
+type EInvoiceDocument struct {
+	ID              uint            `gorm:"primaryKey" json:"id"`
+	UserID          uint            `gorm:"not null;index" json:"user_id"`  // Store the document concerns
+	Source          string          `gorm:"size:20;not null" json:"source"` // order or payment
+	OrderID         *uint           `gorm:"index" json:"order_id,omitempty"`
+	PaymentID       *uint           `gorm:"index" json:"payment_id,omitempty"`
+	DocumentType    string          `gorm:"size:1;not null" json:"document_type"` // I invoice, C credit note
+	InternalID      string          `gorm:"size:50;uniqueIndex;not null" json:"internal_id"`
+	ReferenceID     *uint           `json:"reference_id,omitempty"` // Invoice a credit note corrects
+	Document        string          `gorm:"type:text" json:"-"`
+	Hash            string          `gorm:"size:64" json:"hash"`
+	TotalAmount     decimal.Decimal `gorm:"type:numeric(18,5);not null;default:0" json:"total_amount"` // In EGP
+	Status          string          `gorm:"size:20;default:'DRAFT'" json:"status"`
+	UUID            string          `gorm:"size:64;index" json:"uuid,omitempty"` // Assigned by the ETA on submission
+	LongID          string          `gorm:"size:100" json:"long_id,omitempty"`
+	SubmissionID    string          `gorm:"size:64" json:"submission_id,omitempty"`
+	Error           string          `gorm:"type:text" json:"error,omitempty"`
+	SubmittedAt     *time.Time      `json:"submitted_at,omitempty"`
+	StatusCheckedAt *time.Time      `json:"status_checked_at,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
@@ -0,0 +1,125 @@
+package dbmodels
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ========== PACKAGE ENTITLEMENTS ==========
+
+// Entitlement is a resource a package limits the number or size of
+type Entitlement string
+
+const (
+	Entitlement_PRODUCTS        Entitlement = "products"
+	Entitlement_BLOGS           Entitlement = "blogs"
+	Entitlement_SITES           Entitlement = "sites"
+	Entitlement_CALENDAR_EVENTS Entitlement = "calendar_events"
+	Entitlement_CLIENTS         Entitlement = "clients"
+	Entitlement_STORAGE         Entitlement = "storage" // Bytes of uploaded files
+)
+
+// Entitlements lists the limited resources in the order they are reported
+var Entitlements = []Entitlement{
+	Entitlement_PRODUCTS,
+	Entitlement_BLOGS,
+	Entitlement_SITES,
+	Entitlement_CALENDAR_EVENTS,
+	Entitlement_CLIENTS,
+	Entitlement_STORAGE,
+}
+
+// Feature is a part of the platform a package can leave out
+type Feature string
+
+const (
+	Feature_RECEIPTS       Feature = "receipts"
+	Feature_EINVOICE       Feature = "einvoice"
+	Feature_SHIPPING       Feature = "shipping"
+	Feature_MULTI_CURRENCY Feature = "multi_currency"
+	Feature_CLIENT_IMPORT  Feature = "client_import"
+)
+
+// Features lists the features in the order they are reported
+var Features = []Feature{
+	Feature_RECEIPTS,
+	Feature_EINVOICE,
+	Feature_SHIPPING,
+	Feature_MULTI_CURRENCY,
+	Feature_CLIENT_IMPORT,
+}
+
+// PackageEntitlements is the typed form of Package.Benefits. A limit left out
+// is unlimited and a feature left out is included, so a package only lists
+// what it restricts.
+type PackageEntitlements struct {
+	Highlights        []string         `json:"highlights,omitempty"` // Selling points shown with the package
+	MaxProducts       *int             `json:"max_products,omitempty"`
+	MaxBlogs          *int             `json:"max_blogs,omitempty"`
+	MaxSites          *int             `json:"max_sites,omitempty"`
+	MaxCalendarEvents *int             `json:"max_calendar_events,omitempty"`
+	MaxClients        *int             `json:"max_clients,omitempty"`
+	MaxStorageMB      *int             `json:"max_storage_mb,omitempty"`
+	Features          map[Feature]bool `json:"features,omitempty"`
+}
+
+// Limit returns the package's limit on a resource, nil when unlimited.
+// Storage is returned in bytes.
+func (e *PackageEntitlements) Limit(resource Entitlement) *int64 {
+	var limit *int
+	switch resource {
+	case Entitlement_PRODUCTS:
+		limit = e.MaxProducts
+	case Entitlement_BLOGS:
+		limit = e.MaxBlogs
+	case Entitlement_SITES:
+		limit = e.MaxSites
+	case Entitlement_CALENDAR_EVENTS:
+		limit = e.MaxCalendarEvents
+	case Entitlement_CLIENTS:
+		limit = e.MaxClients
+	case Entitlement_STORAGE:
+		limit = e.MaxStorageMB
+	}
+	if limit == nil {
+		return nil
+	}
+	value := int64(*limit)
+	if resource == Entitlement_STORAGE {
+		value <<= 20
+	}
+	return &value
+}
+
+// HasFeature reports whether the package includes a feature
+func (e *PackageEntitlements) HasFeature(feature Feature) bool {
+	included, listed := e.Features[feature]
+	return !listed || included
+}
+
+// Entitlements parses the package's Benefits. Benefits written before
+// entitlements existed are a JSON array of selling points; they are read as
+// highlights with nothing restricted.
+func (p *Package) Entitlements() (PackageEntitlements, error) {
+	var entitlements PackageEntitlements
+	benefits := strings.TrimSpace(p.Benefits)
+	if benefits == "" {
+		return entitlements, nil
+	}
+	if strings.HasPrefix(benefits, "[") {
+		err := json.Unmarshal([]byte(benefits), &entitlements.Highlights)
+		return entitlements, err
+	}
+	err := json.Unmarshal([]byte(benefits), &entitlements)
+	return entitlements, err
+}
+
+// StoredFile is a file a user uploaded, counted against their package's storage
+type StoredFile struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	FileName  string    `gorm:"size:500;not null;uniqueIndex" json:"file_name"` // Object name in file storage
+	Size      int64     `gorm:"not null" json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -3,6 +3,7 @@ package dbmodels
 import (
 	"time"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -40,6 +41,10 @@ type Models struct {
 
 // Migrator runs auto-migration for all models
 func Migrator(db *gorm.DB) error {
+	if err := migrateMoneyColumns(db); err != nil {
+		return err
+	}
+
 	modelsToMigrate := GetMod()
 
 	// Loop through the models and auto-migrate each one
@@ -49,20 +54,25 @@ func Migrator(db *gorm.DB) error {
 			return err
 		}
 	}
-	return nil
+	if err := backfillOrderBaseTotals(db); err != nil {
+		return err
+	}
+	return backfillPaymentPurposes(db)
 }
 
 type Subscription struct {
-	ID        uint      `gorm:"primaryKey"`
-	UserID    uint      `gorm:"not null"`
-	User      User      `gorm:"foreignKey:UserID"`
-	PackageID uint      `gorm:"not null"`
-	Package   Package   `gorm:"foreignKey:PackageID"`
-	StartDate time.Time `gorm:"not null"`
-	EndDate   time.Time `gorm:"not null"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Price     float64 `gorm:"not null"`
+	ID                uint               `gorm:"primaryKey" json:"id"`
+	UserID            uint               `gorm:"not null;index" json:"user_id"`
+	User              User               `gorm:"foreignKey:UserID" json:"-"`
+	PackageID         uint               `gorm:"not null" json:"package_id"`
+	Package           Package            `gorm:"foreignKey:PackageID" json:"package,omitempty"`
+	StartDate         time.Time          `gorm:"not null" json:"start_date"`
+	EndDate           time.Time          `gorm:"not null" json:"end_date"`
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+	Price             decimal.Decimal    `gorm:"type:numeric(14,2);not null" json:"price"`
+	Status            SubscriptionStatus `gorm:"not null;default:0;index" json:"status"`
+	CancelAtPeriodEnd bool               `gorm:"not null;default:false" json:"cancel_at_period_end"` // Not renewed; the user moves to the free package when it ends
 }
 
 // Blog model for blog posts
@@ -122,36 +132,48 @@ type OAuthProfile struct {
 
 // Product model for e-commerce products
 type Product struct {
-	ID            uint      `gorm:"primaryKey" json:"id"`
-	Name          string    `gorm:"size:255;not null" json:"name"`
-	Description   string    `gorm:"type:text" json:"description"`
-	Price         float64   `gorm:"not null" json:"price"`
-	DiscountPrice float64   `json:"discount_price,omitempty"`
-	Quantity      int       `gorm:"not null;default:0" json:"quantity"`
-	SKU           string    `gorm:"size:100;unique;not null" json:"sku"`
-	Category      string    `gorm:"size:255" json:"category"`
-	Brand         string    `gorm:"size:255" json:"brand"`
-	Images        string    `gorm:"type:text" json:"images"` // JSON array of image URLs
-	IsActive      bool      `gorm:"default:true" json:"is_active"`
-	Weight        float64   `gorm:"default:0" json:"weight"`
-	Tags          string    `gorm:"type:text" json:"tags"` // JSON array of tags
-	UserID        uint      `gorm:"not null" json:"user_id"`
-	User          User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
-	Favorite      bool      `json:"favorite,omitempty"`
+	ID              uint            `gorm:"primaryKey" json:"id"`
+	Name            string          `gorm:"size:255;not null" json:"name"`
+	Description     string          `gorm:"type:text" json:"description"`
+	Price           decimal.Decimal `gorm:"type:numeric(14,2);not null" json:"price"`
+	DiscountPrice   decimal.Decimal `gorm:"type:numeric(14,2);not null;default:0" json:"discount_price,omitempty"`
+	Quantity        int             `gorm:"not null;default:0" json:"quantity"`
+	SKU             string          `gorm:"size:100;unique;not null" json:"sku"`
+	Category        string          `gorm:"size:255" json:"category"`
+	Brand           string          `gorm:"size:255" json:"brand"`
+	Images          string          `gorm:"type:text" json:"images"` // JSON array of image URLs
+	IsActive        bool            `gorm:"default:true" json:"is_active"`
+	Weight          float64         `gorm:"default:0" json:"weight"`
+	Tags            string          `gorm:"type:text" json:"tags"` // JSON array of tags
+	UserID          uint            `gorm:"not null" json:"user_id"`
+	User            User            `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	RatingAverage   float64         `gorm:"default:0;index" json:"rating_average"` // Average of approved reviews
+	RatingCount     int             `gorm:"default:0" json:"rating_count"`         // Number of approved reviews
+	ReorderPoint    *int            `json:"reorder_point,omitempty"`               // Overrides the category/store default
+	ReorderQuantity *int            `json:"reorder_quantity,omitempty"`            // Overrides the category/store default
+	LowStockAlertAt *time.Time      `json:"low_stock_alert_at,omitempty"`          // Set while a low-stock alert is outstanding
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// EffectivePrice is the price a shopper currently pays, taking a valid discount into account
+func (p *Product) EffectivePrice() decimal.Decimal {
+	if p.DiscountPrice.IsPositive() && p.DiscountPrice.LessThan(p.Price) {
+		return p.DiscountPrice
+	}
+	return p.Price
 }
 
 // Enhanced Order model
 type OrderItem struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	OrderID   uint      `gorm:"not null" json:"order_id"`
-	ProductID uint      `gorm:"not null" json:"product_id"`
-	Product   Product   `gorm:"foreignKey:ProductID" json:"product,omitempty"`
-	Quantity  int       `gorm:"not null" json:"quantity"`
-	Price     float64   `gorm:"not null" json:"price"` // Price at time of order
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	OrderID   uint            `gorm:"not null" json:"order_id"`
+	ProductID uint            `gorm:"not null" json:"product_id"`
+	Product   Product         `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Quantity  int             `gorm:"not null" json:"quantity"`
+	Price     decimal.Decimal `gorm:"type:numeric(14,2);not null" json:"price"` // Price at time of order
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
 }
 
 // To do model for task management
@@ -171,23 +193,63 @@ type Todo struct {
 
 // Payment model for tracking payment transactions
 type Payment struct {
-	ID              uint          `gorm:"primaryKey" json:"id"`
-	UserID          uint          `gorm:"not null" json:"user_id"`
-	User            User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	PackageID       uint          `gorm:"not null" json:"package_id"`
-	Package         Package       `gorm:"foreignKey:PackageID" json:"package,omitempty"`
-	Amount          float64       `gorm:"not null" json:"amount"`
-	Currency        string        `gorm:"size:10;default:'EGP'" json:"currency"`
-	PaymentMethod   string        `gorm:"size:50;not null" json:"payment_method"` // 'fawry', 'paymob'
-	PaymentStatus   PaymentStatus `gorm:"not null;default:0" json:"payment_status"`
-	TransactionID   string        `gorm:"size:255" json:"transaction_id"`
-	ReferenceNumber string        `gorm:"size:255;unique" json:"reference_number"` // Fawry reference
-	PaymobOrderID   string        `gorm:"size:255" json:"paymob_order_id"`
-	PaymentData     string        `gorm:"type:text" json:"payment_data"` // JSON for additional data
-	ExpiresAt       *time.Time    `json:"expires_at,omitempty"`
-	PaidAt          *time.Time    `json:"paid_at,omitempty"`
-	CreatedAt       time.Time     `json:"created_at"`
-	UpdatedAt       time.Time     `json:"updated_at"`
+	ID              uint            `gorm:"primaryKey" json:"id"`
+	UserID          uint            `gorm:"not null" json:"user_id"`
+	User            User            `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Purpose         PaymentPurpose  `gorm:"not null;default:0;index" json:"purpose"` // What the payment completes once paid
+	PackageID       *uint           `json:"package_id,omitempty"`
+	Package         *Package        `gorm:"foreignKey:PackageID" json:"package,omitempty"`
+	OrderID         *uint           `gorm:"index" json:"order_id,omitempty"` // Set when paying for a storefront order
+	Order           *Order          `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	Amount          decimal.Decimal `gorm:"type:numeric(14,2);not null" json:"amount"`
+	Currency        string          `gorm:"size:10;default:'EGP'" json:"currency"`
+	PaymentMethod   string          `gorm:"size:50;not null" json:"payment_method"` // Gateway name: 'fawry', 'paymob', 'sandbox', or 'wallet', 'cod', 'bank_transfer', 'instapay'
+	PaymentStatus   PaymentStatus   `gorm:"not null;default:0" json:"payment_status"`
+	TransactionID   string          `gorm:"size:255" json:"transaction_id"`
+	ReferenceNumber string          `gorm:"size:255;unique" json:"reference_number"` // Our merchant reference sent to the gateway
+	PaymobOrderID   string          `gorm:"size:255" json:"paymob_order_id"`         // Gateway's own order ID, e.g. the Paymob order or Fawry reference
+	PaymentData     string          `gorm:"type:text" json:"payment_data"`           // JSON for additional data
+	ExpiresAt       *time.Time      `json:"expires_at,omitempty"`
+	LastCheckedAt   *time.Time      `json:"last_checked_at,omitempty"`                        // Last time the gateway was asked for the status
+	InvoiceID       *uint           `gorm:"index" json:"invoice_id,omitempty"`                // Set when paying a subscription renewal invoice
+	NeedsRefund     bool            `gorm:"not null;default:false;index" json:"needs_refund"` // Paid an order another payment had already paid
+	PaidAt          *time.Time      `json:"paid_at,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// PaymentPurpose is what a payment pays for. The record it completes is found
+// through OrderID or InvoiceID, or through its own PaymentID (package changes and
+// add-on subscriptions).
+type PaymentPurpose int32
+
+const (
+	PaymentPurpose_PACKAGE_CHANGE       PaymentPurpose = 0
+	PaymentPurpose_ADDON_SUBSCRIPTION   PaymentPurpose = 1
+	PaymentPurpose_ORDER                PaymentPurpose = 2
+	PaymentPurpose_WALLET_TOPUP         PaymentPurpose = 3
+	PaymentPurpose_SUBSCRIPTION_RENEWAL PaymentPurpose = 4
+)
+
+var (
+	PaymentPurpose_name = map[int32]string{
+		0: "PACKAGE_CHANGE",
+		1: "ADDON_SUBSCRIPTION",
+		2: "ORDER",
+		3: "WALLET_TOPUP",
+		4: "SUBSCRIPTION_RENEWAL",
+	}
+	PaymentPurpose_value = map[string]int32{
+		"PACKAGE_CHANGE":       0,
+		"ADDON_SUBSCRIPTION":   1,
+		"ORDER":                2,
+		"WALLET_TOPUP":         3,
+		"SUBSCRIPTION_RENEWAL": 4,
+	}
+)
+
+func (x PaymentPurpose) String() string {
+	return PaymentPurpose_name[int32(x)]
 }
 
 type PaymentStatus int32
@@ -224,6 +286,27 @@ func (x PaymentStatus) String() string {
 	return PaymentStatus_name[int32(x)]
 }
 
+// CanTransitionTo reports whether a payment may move from x to next. Statuses
+// only move forward: a pending payment settles once, a late success still wins
+// over failure or expiry (the customer was charged), and only a paid payment
+// can be refunded.
+func (x PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+	switch x {
+	case PaymentStatus_PENDING:
+		return next != PaymentStatus_PENDING && next != PaymentStatus_REFUNDED
+	case PaymentStatus_FAILED, PaymentStatus_CANCELLED, PaymentStatus_EXPIRED:
+		return next == PaymentStatus_PAID
+	case PaymentStatus_PAID:
+		return next == PaymentStatus_REFUNDED
+	}
+	return false
+}
+
+// IsSettled reports whether money moved: the payment was paid, or paid and refunded
+func (x PaymentStatus) IsSettled() bool {
+	return x == PaymentStatus_PAID || x == PaymentStatus_REFUNDED
+}
+
 // PackageChange model to track package upgrade/downgrade requests
 type PackageChange struct {
 	ID           uint         `gorm:"primaryKey" json:"id"`
@@ -238,8 +321,37 @@ type PackageChange struct {
 	Status       ChangeStatus `gorm:"not null;default:0" json:"status"`
 	ChangeReason string       `gorm:"type:text" json:"change_reason,omitempty"`
 	ApprovedAt   *time.Time   `json:"approved_at,omitempty"`
-	CreatedAt    time.Time    `json:"created_at"`
-	UpdatedAt    time.Time    `json:"updated_at"`
+
+	// Proration, fixed when the change is requested
+	ChangeType      PackageChangeType `gorm:"not null;default:0" json:"change_type"`
+	NewPackagePrice decimal.Decimal   `gorm:"type:numeric(14,2);not null;default:0" json:"new_package_price"`
+	CreditAmount    decimal.Decimal   `gorm:"type:numeric(14,2);not null;default:0" json:"credit_amount"` // Unused value of the current period
+	AmountDue       decimal.Decimal   `gorm:"type:numeric(14,2);not null;default:0" json:"amount_due"`
+	UnusedDays      int               `gorm:"not null;default:0" json:"unused_days"`
+	PeriodDays      int               `gorm:"not null;default:0" json:"period_days"`
+	PeriodEnd       *time.Time        `json:"period_end,omitempty"`   // End of the current subscription period
+	EffectiveAt     *time.Time        `json:"effective_at,omitempty"` // When the user moves to the new package
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PackageChangeType int32
+
+const (
+	PackageChangeType_UPGRADE   PackageChangeType = 0 // Applied once paid, with credit for the unused period
+	PackageChangeType_DOWNGRADE PackageChangeType = 1 // Applied when the current period ends
+)
+
+var (
+	PackageChangeType_name = map[int32]string{
+		0: "UPGRADE",
+		1: "DOWNGRADE",
+	}
+)
+
+func (x PackageChangeType) String() string {
+	return PackageChangeType_name[int32(x)]
 }
 
 type ChangeStatus int32
@@ -249,6 +361,7 @@ const (
 	ChangeStatus_APPROVED  ChangeStatus = 1
 	ChangeStatus_REJECTED  ChangeStatus = 2
 	ChangeStatus_COMPLETED ChangeStatus = 3
+	ChangeStatus_SCHEDULED ChangeStatus = 4 // Paid, waiting for the current period to end
 )
 
 var (
@@ -257,6 +370,7 @@ var (
 		1: "APPROVED",
 		2: "REJECTED",
 		3: "COMPLETED",
+		4: "SCHEDULED",
 	}
 )
 
@@ -291,9 +405,12 @@ func GetMod() []interface{} {
 		&AddonPricingTier{},
 		&UserAddonSubscription{},
 		&AddonUsageLog{},
+		&AddonUsagePeriod{},
 		&CalendarEvent{},
 		&EventAttendee{},
 		&OrderReceipt{},
+		&ReceiptBranding{},
+		&ReceiptDelivery{},
 		&Notification{},
 		&Message{},
 		&MessageFolder{},
@@ -303,5 +420,30 @@ func GetMod() []interface{} {
 		&BannerClick{},
 		&SiteConfig{},
 		&CartItem{},
+		&Coupon{},
+		&CartRecovery{},
+		&Wishlist{},
+		&WishlistItem{},
+		&ProductReview{},
+		&ExchangeRate{},
+		&ProductPrice{},
+		&ClientAddress{},
+		&ClientNote{},
+		&StockSetting{},
+		&Shipment{},
+		&ShipmentItem{},
+		&ShipmentEvent{},
+		&EInvoiceProfile{},
+		&EInvoiceDocument{},
+		&PaymentEvent{},
+		&PaymentReconciliation{},
+		&PaymentReconciliationItem{},
+		&SubscriptionInvoice{},
+		&SubscriptionEvent{},
+		&Wallet{},
+		&WalletTransaction{},
+		&StoredFile{},
+		&OfflinePayment{},
+		&PaymentAccount{},
 	}
 }
@@ -0,0 +1,83 @@
+package dbmodels
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// ========== MONEY COLUMNS ==========
+
+// moneyColumns lists every column holding an amount. They are stored as numeric(14,2).
+var moneyColumns = map[string][]string{
+	"products":                 {"price", "discount_price"},
+	"orders":                   {"total", "payment_amount", "discount", "base_total"},
+	"order_items":              {"price"},
+	"cart_items":               {"price"},
+	"payments":                 {"amount"},
+	"packages":                 {"price"},
+	"subscriptions":            {"price"},
+	"addons":                   {"base_price"},
+	"addon_pricing_tiers":      {"discount_value", "final_price"},
+	"user_addon_subscriptions": {"total_price"},
+	"wishlist_items":           {"price_when_added", "last_notified_price"},
+	"cart_recoveries":          {"cart_total", "recovered_amount"},
+	"product_prices":           {"price", "discount_price"},
+}
+
+// migrateMoneyColumns converts legacy floating-point money columns to numeric(14,2).
+// Values are rounded half away from zero to whole piasters; rows whose value changes
+// by that rounding are logged. Columns that are already numeric(14,2) are left alone.
+func migrateMoneyColumns(db *gorm.DB) error {
+	for table, columns := range moneyColumns {
+		if !db.Migrator().HasTable(table) {
+			continue
+		}
+		for _, column := range columns {
+			var info struct {
+				DataType         string
+				NumericPrecision *int
+				NumericScale     *int
+			}
+			err := db.Raw(`SELECT data_type, numeric_precision, numeric_scale
+				FROM information_schema.columns
+				WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND column_name = ?`, table, column).
+				Scan(&info).Error
+			if err != nil {
+				return fmt.Errorf("inspect %s.%s: %w", table, column, err)
+			}
+			if info.DataType == "" {
+				continue // Column is created by AutoMigrate
+			}
+			if info.DataType == "numeric" && info.NumericPrecision != nil && *info.NumericPrecision == 14 &&
+				info.NumericScale != nil && *info.NumericScale == 2 {
+				continue
+			}
+
+			var adjusted int64
+			db.Raw(fmt.Sprintf(`SELECT COUNT(*) FROM %q WHERE %q IS NOT NULL AND %q::numeric <> ROUND(%q::numeric, 2)`,
+				table, column, column, column)).Scan(&adjusted)
+
+			if err := db.Exec(fmt.Sprintf(`ALTER TABLE %q ALTER COLUMN %q TYPE numeric(14,2) USING ROUND(%q::numeric, 2)`,
+				table, column, column)).Error; err != nil {
+				return fmt.Errorf("convert %s.%s to numeric: %w", table, column, err)
+			}
+			log.Printf("✓ Converted %s.%s to numeric(14,2) (%d value(s) rounded to the piaster)", table, column, adjusted)
+		}
+	}
+	return nil
+}
+
+// backfillOrderBaseTotals fills BaseTotal for orders placed before multi-currency support.
+// Those orders were all in the store currency, so the base total is the order total.
+func backfillOrderBaseTotals(db *gorm.DB) error {
+	result := db.Exec(`UPDATE orders SET base_total = total WHERE base_total = 0 AND total <> 0 AND currency = base_currency`)
+	if result.Error != nil {
+		return fmt.Errorf("backfill order base totals: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("✓ Backfilled base totals of %d order(s)", result.RowsAffected)
+	}
+	return nil
+}
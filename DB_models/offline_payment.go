@@ -0,0 +1,89 @@
+package dbmodels
+
+import "time"
+
+// ========== OFFLINE PAYMENTS ==========
+
+// Offline payment methods are settled outside a gateway and confirmed by hand
+const (
+	CashOnDeliveryPaymentMethod = "cod" // Collected by the courier; storefront orders only
+	BankTransferPaymentMethod   = "bank_transfer"
+	InstaPayPaymentMethod       = "instapay"
+)
+
+// OfflinePayment tracks a payment made outside a gateway until it is reviewed.
+// The customer uploads proof of a transfer, or the courier reports a cash on
+// delivery collection; the payee confirms or rejects it from the review queue.
+type OfflinePayment struct {
+	ID                uint                 `gorm:"primaryKey" json:"id"`
+	PaymentID         uint                 `gorm:"not null;uniqueIndex" json:"payment_id"`
+	Payment           *Payment             `gorm:"foreignKey:PaymentID" json:"payment,omitempty"`
+	Method            string               `gorm:"size:50;not null" json:"method"`
+	Status            OfflinePaymentStatus `gorm:"not null;default:0;index" json:"status"`
+	ProofFile         string               `gorm:"size:500" json:"-"` // MinIO object name, served through the proof endpoint
+	ProofContentType  string               `gorm:"size:100" json:"proof_content_type,omitempty"`
+	SenderName        string               `gorm:"size:255" json:"sender_name,omitempty"`
+	TransferReference string               `gorm:"size:255" json:"transfer_reference,omitempty"` // Bank or InstaPay transaction reference
+	Note              string               `gorm:"type:text" json:"note,omitempty"`
+	CollectedBy       string               `gorm:"size:255" json:"collected_by,omitempty"` // Carrier and tracking number of a cash on delivery collection
+	SubmittedAt       *time.Time           `json:"submitted_at,omitempty"`                 // Proof uploaded or collection reported
+	ReviewedBy        *uint                `json:"reviewed_by,omitempty"`
+	ReviewedAt        *time.Time           `json:"reviewed_at,omitempty"`
+	RejectionReason   string               `gorm:"type:text" json:"rejection_reason,omitempty"`
+	CreatedAt         time.Time            `json:"created_at"`
+	UpdatedAt         time.Time            `json:"updated_at"`
+}
+
+// HasProof reports whether the customer uploaded proof of payment
+func (o *OfflinePayment) HasProof() bool {
+	return o.ProofFile != ""
+}
+
+type OfflinePaymentStatus int32
+
+const (
+	OfflinePaymentStatus_AWAITING_PROOF      OfflinePaymentStatus = 0 // Transfer not yet evidenced by the customer
+	OfflinePaymentStatus_AWAITING_COLLECTION OfflinePaymentStatus = 1 // Cash on delivery not yet collected
+	OfflinePaymentStatus_IN_REVIEW           OfflinePaymentStatus = 2
+	OfflinePaymentStatus_CONFIRMED           OfflinePaymentStatus = 3
+	OfflinePaymentStatus_REJECTED            OfflinePaymentStatus = 4
+)
+
+var (
+	OfflinePaymentStatus_name = map[int32]string{
+		0: "AWAITING_PROOF",
+		1: "AWAITING_COLLECTION",
+		2: "IN_REVIEW",
+		3: "CONFIRMED",
+		4: "REJECTED",
+	}
+	OfflinePaymentStatus_value = map[string]int32{
+		"AWAITING_PROOF":      0,
+		"AWAITING_COLLECTION": 1,
+		"IN_REVIEW":           2,
+		"CONFIRMED":           3,
+		"REJECTED":            4,
+	}
+)
+
+func (x OfflinePaymentStatus) String() string {
+	return OfflinePaymentStatus_name[int32(x)]
+}
+
+// IsOpen reports whether the payment can still be confirmed or rejected
+func (x OfflinePaymentStatus) IsOpen() bool {
+	return x != OfflinePaymentStatus_CONFIRMED && x != OfflinePaymentStatus_REJECTED
+}
+
+// PaymentAccount is where a store's customers send bank transfers and InstaPay
+// payments for its orders. Platform charges go to the account in configuration.
+type PaymentAccount struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	UserID          uint      `gorm:"not null;uniqueIndex" json:"user_id"`
+	BankName        string    `gorm:"size:255" json:"bank_name"`
+	AccountName     string    `gorm:"size:255" json:"account_name"`
+	AccountNumber   string    `gorm:"size:100" json:"account_number"` // Account number or IBAN
+	InstaPayAddress string    `gorm:"size:255" json:"instapay_address"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
@@ -0,0 +1,62 @@
+package dbmodels
+
+import "time"
+
+// ========== PAYMENT GATEWAY EVENTS ==========
+
+// PaymentEvent is a gateway callback as received. Events are unique per gateway
+// and event ID, so a retried callback is recognised instead of applied twice.
+// The raw request is kept so an event can be verified and replayed later.
+type PaymentEvent struct {
+	ID             uint               `gorm:"primaryKey" json:"id"`
+	Gateway        string             `gorm:"size:50;not null;uniqueIndex:idx_payment_event_gateway_event" json:"gateway"`
+	EventID        string             `gorm:"size:255;not null;uniqueIndex:idx_payment_event_gateway_event" json:"event_id"`
+	PaymentID      *uint              `gorm:"index" json:"payment_id,omitempty"`
+	ReportedStatus PaymentStatus      `gorm:"not null;default:0" json:"reported_status"` // Status the gateway reported
+	TransactionID  string             `gorm:"size:255" json:"transaction_id"`
+	Payload        string             `gorm:"type:text" json:"payload"` // Raw request body
+	Query          string             `gorm:"type:text" json:"query"`   // Raw query string
+	Headers        string             `gorm:"type:text" json:"headers"` // Request headers as JSON
+	Status         PaymentEventStatus `gorm:"not null;default:0;index" json:"status"`
+	Error          string             `gorm:"type:text" json:"error,omitempty"`
+	Attempts       int                `gorm:"not null;default:0" json:"attempts"`
+	ProcessedAt    *time.Time         `json:"processed_at,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+type PaymentEventStatus int32
+
+const (
+	PaymentEventStatus_RECEIVED  PaymentEventStatus = 0 // Stored, not processed yet
+	PaymentEventStatus_PROCESSED PaymentEventStatus = 1 // Status change applied
+	PaymentEventStatus_IGNORED   PaymentEventStatus = 2 // Not a forward transition, e.g. FAILED after PAID
+	PaymentEventStatus_FAILED    PaymentEventStatus = 3 // Processing failed; a retry or replay may succeed
+	PaymentEventStatus_INVALID   PaymentEventStatus = 4 // Signature or payload rejected
+)
+
+var (
+	PaymentEventStatus_name = map[int32]string{
+		0: "RECEIVED",
+		1: "PROCESSED",
+		2: "IGNORED",
+		3: "FAILED",
+		4: "INVALID",
+	}
+	PaymentEventStatus_value = map[string]int32{
+		"RECEIVED":  0,
+		"PROCESSED": 1,
+		"IGNORED":   2,
+		"FAILED":    3,
+		"INVALID":   4,
+	}
+)
+
+func (x PaymentEventStatus) String() string {
+	return PaymentEventStatus_name[int32(x)]
+}
+
+// IsSettled reports whether a redelivered event needs no further processing
+func (x PaymentEventStatus) IsSettled() bool {
+	return x == PaymentEventStatus_PROCESSED || x == PaymentEventStatus_IGNORED || x == PaymentEventStatus_INVALID
+}
@@ -0,0 +1,34 @@
+package dbmodels
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// backfillPaymentPurposes sets the purpose of payments made before it was
+// recorded. They all defaulted to PACKAGE_CHANGE; the others are recognised by
+// the order, invoice or add-on subscription they paid for.
+func backfillPaymentPurposes(db *gorm.DB) error {
+	backfills := []struct {
+		purpose PaymentPurpose
+		where   string
+	}{
+		{PaymentPurpose_ORDER, "order_id IS NOT NULL"},
+		{PaymentPurpose_SUBSCRIPTION_RENEWAL, "invoice_id IS NOT NULL"},
+		{PaymentPurpose_ADDON_SUBSCRIPTION, "id IN (SELECT payment_id FROM user_addon_subscriptions WHERE payment_id IS NOT NULL)"},
+	}
+
+	for _, backfill := range backfills {
+		result := db.Exec(fmt.Sprintf(`UPDATE payments SET purpose = ? WHERE purpose = ? AND %s`, backfill.where),
+			backfill.purpose, PaymentPurpose_PACKAGE_CHANGE)
+		if result.Error != nil {
+			return fmt.Errorf("backfill %s payment purposes: %w", backfill.purpose, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("✓ Backfilled purpose of %d %s payment(s)", result.RowsAffected, backfill.purpose)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package dbmodels
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ========== PAYMENT RECONCILIATION ==========
+
+// PaymentReconciliation compares the payments created on one day with what their
+// gateways report. There is one report per day; running it again replaces it.
+type PaymentReconciliation struct {
+	ID          uint                        `gorm:"primaryKey" json:"id"`
+	ReportDate  time.Time                   `gorm:"type:date;not null;uniqueIndex" json:"report_date"`
+	PeriodStart time.Time                   `gorm:"not null" json:"period_start"`
+	PeriodEnd   time.Time                   `gorm:"not null" json:"period_end"`
+	Checked     int                         `gorm:"not null;default:0" json:"checked"`    // Payments compared with their gateway
+	Matched     int                         `gorm:"not null;default:0" json:"matched"`    // Payments that agree with their gateway
+	Mismatched  int                         `gorm:"not null;default:0" json:"mismatched"` // Status, amount or missing at gateway
+	Failed      int                         `gorm:"not null;default:0" json:"failed"`     // Gateway could not be queried
+	Items       []PaymentReconciliationItem `gorm:"foreignKey:ReconciliationID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+	CreatedAt   time.Time                   `json:"created_at"`
+}
+
+// PaymentReconciliationItem is one payment that does not agree with its gateway
+type PaymentReconciliationItem struct {
+	ID               uint                   `gorm:"primaryKey" json:"id"`
+	ReconciliationID uint                   `gorm:"not null;index" json:"reconciliation_id"`
+	PaymentID        uint                   `gorm:"not null;index" json:"payment_id"`
+	Gateway          string                 `gorm:"size:50;not null" json:"gateway"`
+	ReferenceNumber  string                 `gorm:"size:255" json:"reference_number"`
+	Mismatch         ReconciliationMismatch `gorm:"not null;default:0" json:"mismatch"`
+	OurStatus        PaymentStatus          `gorm:"not null;default:0" json:"our_status"`
+	GatewayStatus    PaymentStatus          `gorm:"not null;default:0" json:"gateway_status"`
+	OurAmount        decimal.Decimal        `gorm:"type:numeric(14,2);not null;default:0" json:"our_amount"`
+	GatewayAmount    decimal.Decimal        `gorm:"type:numeric(14,2);not null;default:0" json:"gateway_amount"`
+	Note             string                 `gorm:"type:text" json:"note,omitempty"`
+	CreatedAt        time.Time              `json:"created_at"`
+}
+
+type ReconciliationMismatch int32
+
+const (
+	ReconciliationMismatch_STATUS       ReconciliationMismatch = 0 // Settled on one side only, or settled differently
+	ReconciliationMismatch_AMOUNT       ReconciliationMismatch = 1 // Settled amount differs from ours
+	ReconciliationMismatch_MISSING      ReconciliationMismatch = 2 // Paid here, unknown to the gateway
+	ReconciliationMismatch_QUERY_FAILED ReconciliationMismatch = 3 // Gateway could not be queried
+)
+
+var (
+	ReconciliationMismatch_name = map[int32]string{
+		0: "STATUS",
+		1: "AMOUNT",
+		2: "MISSING",
+		3: "QUERY_FAILED",
+	}
+	ReconciliationMismatch_value = map[string]int32{
+		"STATUS":       0,
+		"AMOUNT":       1,
+		"MISSING":      2,
+		"QUERY_FAILED": 3,
+	}
+)
+
+func (x ReconciliationMismatch) String() string {
+	return ReconciliationMismatch_name[int32(x)]
+}
@@ -6,15 +6,69 @@ import "time"
 
 // OrderReceipt stores receipt metadata for PDF generation
 type OrderReceipt struct {
-	ID              uint       `gorm:"primaryKey" json:"id"`
-	OrderID         uint       `gorm:"not null;unique" json:"order_id"`
-	Order           Order      `gorm:"foreignKey:OrderID" json:"order,omitempty"`
-	ReceiptNumber   string     `gorm:"size:100;unique;not null" json:"receipt_number"`
-	PDFPath         string     `gorm:"size:500" json:"pdf_path"` // Path to generated PDF
-	GeneratedAt     *time.Time `json:"generated_at,omitempty"`
-	TemplateVersion string     `gorm:"size:50;default:'v1'" json:"template_version"`
-	CompanyInfo     string     `gorm:"type:text" json:"company_info"` // JSON with company details
-	Notes           string     `gorm:"type:text" json:"notes"`
-	CreatedAt       time.Time  `json:"created_at"`
-	UpdatedAt       time.Time  `json:"updated_at"`
+	ID                uint              `gorm:"primaryKey" json:"id"`
+	OrderID           uint              `gorm:"not null;unique" json:"order_id"`
+	Order             Order             `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	ReceiptNumber     string            `gorm:"size:100;unique;not null" json:"receipt_number"`
+	PDFPath           string            `gorm:"size:500" json:"pdf_path"` // Path to generated PDF
+	GeneratedAt       *time.Time        `json:"generated_at,omitempty"`
+	TemplateVersion   string            `gorm:"size:50;default:'v1'" json:"template_version"` // Layout and version it was rendered with, e.g. a4-classic.v2
+	CompanyInfo       string            `gorm:"type:text" json:"company_info"`                // JSON with company details
+	Language          string            `gorm:"size:5;default:'en'" json:"language"`
+	Numerals          string            `gorm:"size:4;default:'latn'" json:"numerals"` // latn or arab
+	Notes             string            `gorm:"type:text" json:"notes"`
+	PublicToken       string            `gorm:"size:64;index" json:"-"`             // Token of the public link sent to the customer
+	VerificationToken string            `gorm:"size:150" json:"verification_token"` // Signed receipt number printed as a QR code
+	LastSentAt        *time.Time        `json:"last_sent_at,omitempty"`
+	LastSentTo        string            `gorm:"size:255" json:"last_sent_to,omitempty"`
+	Deliveries        []ReceiptDelivery `gorm:"foreignKey:ReceiptID" json:"deliveries,omitempty"`
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// Receipt delivery triggers
+const (
+	ReceiptTriggerPaid      = "paid"      // Sent automatically when the order was paid
+	ReceiptTriggerDelivered = "delivered" // Sent automatically when the order was delivered
+	ReceiptTriggerManual    = "manual"    // Resent by the store
+)
+
+// Receipt delivery statuses
+const (
+	ReceiptDeliverySent   = "SENT"
+	ReceiptDeliveryFailed = "FAILED"
+)
+
+// ReceiptDelivery records each time a receipt was sent to a customer, and where
+type ReceiptDelivery struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ReceiptID uint      `gorm:"not null;index" json:"receipt_id"`
+	Channel   string    `gorm:"size:20;default:'email'" json:"channel"`
+	Recipient string    `gorm:"size:255" json:"recipient"`
+	Trigger   string    `gorm:"size:20" json:"trigger"` // paid, delivered or manual
+	Status    string    `gorm:"size:20" json:"status"`  // SENT or FAILED
+	Error     string    `gorm:"type:text" json:"error,omitempty"`
+	SentBy    *uint     `json:"sent_by,omitempty"` // User who resent it; empty for automatic sends
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReceiptBranding is a store's saved receipt design. Empty details fall back to the
+// owner's profile; the logo is a MinIO object in the branding category.
+type ReceiptBranding struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"not null;uniqueIndex" json:"user_id"`
+	Layout       string    `gorm:"size:50" json:"layout"` // Layout ID, e.g. a4-classic or thermal-80mm
+	Name         string    `gorm:"size:255" json:"name"`
+	Address      string    `gorm:"size:500" json:"address"`
+	Phone        string    `gorm:"size:50" json:"phone"`
+	Email        string    `gorm:"size:255" json:"email"`
+	Website      string    `gorm:"size:255" json:"website"`
+	TaxID        string    `gorm:"size:100" json:"tax_id"`
+	Logo         string    `gorm:"size:500" json:"logo"`        // MinIO object name
+	PrimaryColor string    `gorm:"size:7" json:"primary_color"` // #RRGGBB headings and titles
+	AccentColor  string    `gorm:"size:7" json:"accent_color"`  // #RRGGBB table header and rules
+	FooterText   string    `gorm:"type:text" json:"footer_text"`
+	ReturnPolicy string    `gorm:"type:text" json:"return_policy"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -0,0 +1,61 @@
+package dbmodels
+
+import "time"
+
+// ========== PRODUCT REVIEWS ==========
+
+// ProductReview is a verified-purchase review left by a client for a delivered order item
+type ProductReview struct {
+	ID                 uint         `gorm:"primaryKey" json:"id"`
+	ProductID          uint         `gorm:"not null;index;uniqueIndex:idx_review_order_product" json:"product_id"`
+	Product            *Product     `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	StoreOwnerID       uint         `gorm:"not null;index" json:"store_owner_id"`
+	OrderID            uint         `gorm:"not null;uniqueIndex:idx_review_order_product" json:"order_id"`
+	ClientID           uint         `gorm:"not null;index" json:"client_id"`
+	ReviewerName       string       `gorm:"size:255" json:"reviewer_name"`
+	Rating             int          `gorm:"not null" json:"rating"` // 1-5 stars
+	Title              string       `gorm:"size:255" json:"title"`
+	Body               string       `gorm:"type:text" json:"body"`
+	Photos             string       `gorm:"type:text" json:"photos"` // JSON array of photo URLs
+	IsVerifiedPurchase bool         `gorm:"default:true" json:"is_verified_purchase"`
+	Status             ReviewStatus `gorm:"not null;default:0;index" json:"status"`
+	ModerationNote     string       `gorm:"type:text" json:"moderation_note,omitempty"`
+	ModeratedAt        *time.Time   `json:"moderated_at,omitempty"`
+	Reply              string       `gorm:"type:text" json:"reply,omitempty"` // Public reply from the store
+	RepliedAt          *time.Time   `json:"replied_at,omitempty"`
+	CreatedAt          time.Time    `json:"created_at"`
+	UpdatedAt          time.Time    `json:"updated_at"`
+}
+
+type ReviewStatus int32
+
+const (
+	ReviewStatus_PENDING  ReviewStatus = 0
+	ReviewStatus_APPROVED ReviewStatus = 1
+	ReviewStatus_REJECTED ReviewStatus = 2
+)
+
+// Enum value maps for ReviewStatus.
+var (
+	ReviewStatus_name = map[int32]string{
+		0: "PENDING",
+		1: "APPROVED",
+		2: "REJECTED",
+	}
+	ReviewStatus_value = map[string]int32{
+		"PENDING":  0,
+		"APPROVED": 1,
+		"REJECTED": 2,
+	}
+)
+
+func (x ReviewStatus) String() string {
+	return ReviewStatus_name[int32(x)]
+}
+
+// RatingSummary is the star distribution of a product's approved reviews
+type RatingSummary struct {
+	Average      float64     `json:"average"`
+	Count        int64       `json:"count"`
+	Distribution map[int]int `json:"distribution"` // stars -> number of reviews
+}
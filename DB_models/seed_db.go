@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -132,14 +133,57 @@ func seedRolesAndPermissions(db *gorm.DB) error {
 func seedPackages(db *gorm.DB) error {
 	fmt.Println("📦 Seeding packages...")
 
-	benefits1, _ := json.Marshal([]string{"5 Users", "50 Products", "Email Support", "Basic Analytics"})
-	benefits2, _ := json.Marshal([]string{"15 Users", "200 Products", "Priority Support", "Advanced Analytics", "API Access"})
-	benefits3, _ := json.Marshal([]string{"Unlimited Users", "Unlimited Products", "24/7 Premium Support", "Custom Integrations", "Dedicated Account Manager"})
+	limit := func(n int) *int { return &n }
+	benefits1, _ := json.Marshal(PackageEntitlements{
+		Highlights:        []string{"5 Users", "50 Products", "Email Support", "Basic Analytics"},
+		MaxProducts:       limit(50),
+		MaxBlogs:          limit(10),
+		MaxSites:          limit(1),
+		MaxCalendarEvents: limit(100),
+		MaxClients:        limit(250),
+		MaxStorageMB:      limit(500),
+		Features: map[Feature]bool{
+			Feature_EINVOICE:       false,
+			Feature_SHIPPING:       false,
+			Feature_MULTI_CURRENCY: false,
+			Feature_CLIENT_IMPORT:  false,
+		},
+	})
+	benefits2, _ := json.Marshal(PackageEntitlements{
+		Highlights:        []string{"15 Users", "200 Products", "Priority Support", "Advanced Analytics", "API Access"},
+		MaxProducts:       limit(200),
+		MaxBlogs:          limit(50),
+		MaxSites:          limit(3),
+		MaxCalendarEvents: limit(1000),
+		MaxClients:        limit(2000),
+		MaxStorageMB:      limit(5000),
+		Features: map[Feature]bool{
+			Feature_EINVOICE: false,
+		},
+	})
+	benefits3, _ := json.Marshal(PackageEntitlements{
+		Highlights: []string{"Unlimited Users", "Unlimited Products", "24/7 Premium Support", "Custom Integrations", "Dedicated Account Manager"},
+	})
+	benefitsFree, _ := json.Marshal(PackageEntitlements{
+		Highlights:        []string{"1 User", "10 Products", "Community Support"},
+		MaxProducts:       limit(10),
+		MaxBlogs:          limit(3),
+		MaxSites:          limit(1),
+		MaxCalendarEvents: limit(20),
+		MaxClients:        limit(50),
+		MaxStorageMB:      limit(100),
+		Features: map[Feature]bool{
+			Feature_EINVOICE:       false,
+			Feature_SHIPPING:       false,
+			Feature_MULTI_CURRENCY: false,
+			Feature_CLIENT_IMPORT:  false,
+		},
+	})
 
 	packages := []Package{
 		{
 			Name:           "Starter",
-			Price:          299.99,
+			Price:          decimal.RequireFromString("299.99"),
 			Duration:       30,
 			Benefits:       string(benefits1),
 			Description:    "Perfect for small businesses just getting started",
@@ -148,7 +192,7 @@ func seedPackages(db *gorm.DB) error {
 		},
 		{
 			Name:           "Professional",
-			Price:          899.99,
+			Price:          decimal.RequireFromString("899.99"),
 			Duration:       30,
 			Benefits:       string(benefits2),
 			Description:    "Ideal for growing businesses with advanced needs",
@@ -157,13 +201,23 @@ func seedPackages(db *gorm.DB) error {
 		},
 		{
 			Name:           "Enterprise",
-			Price:          2499.99,
+			Price:          decimal.RequireFromString("2499.99"),
 			Duration:       30,
 			Benefits:       string(benefits3),
 			Description:    "Full-featured solution for large organizations",
 			IsActive:       true,
 			PricePerClient: true,
 		},
+		// billing.free_package_id: where cancelled and unpaid subscriptions end up
+		{
+			Name:           "Free",
+			Price:          decimal.Zero,
+			Duration:       30,
+			Benefits:       string(benefitsFree),
+			Description:    "The basics to keep a small store online",
+			IsActive:       true,
+			PricePerClient: false,
+		},
 	}
 
 	for i := range packages {
@@ -329,8 +383,8 @@ func seedProducts(db *gorm.DB) error {
 		{
 			Name:          "Premium Smartphone X1",
 			Description:   "Latest flagship smartphone with advanced features",
-			Price:         15999.99,
-			DiscountPrice: 13999.99,
+			Price:         decimal.RequireFromString("15999.99"),
+			DiscountPrice: decimal.RequireFromString("13999.99"),
 			Quantity:      50,
 			SKU:           "PHONE-X1-001",
 			Category:      "Electronics",
@@ -340,13 +394,12 @@ func seedProducts(db *gorm.DB) error {
 			Weight:        0.180,
 			Tags:          string(tags1),
 			UserID:        2,
-			Favorite:      true,
 		},
 		{
 			Name:          "Professional Laptop Pro 15",
 			Description:   "High-performance laptop for professionals",
-			Price:         32999.99,
-			DiscountPrice: 29999.99,
+			Price:         decimal.RequireFromString("32999.99"),
+			DiscountPrice: decimal.RequireFromString("29999.99"),
 			Quantity:      25,
 			SKU:           "LAPTOP-PRO15-001",
 			Category:      "Computers",
@@ -360,7 +413,7 @@ func seedProducts(db *gorm.DB) error {
 		{
 			Name:        "Wireless Earbuds Elite",
 			Description: "Premium wireless earbuds with noise cancellation",
-			Price:       2499.99,
+			Price:       decimal.RequireFromString("2499.99"),
 			Quantity:    100,
 			SKU:         "EARBUDS-ELITE-001",
 			Category:    "Audio",
@@ -370,13 +423,12 @@ func seedProducts(db *gorm.DB) error {
 			Weight:      0.05,
 			Tags:        string(tags3),
 			UserID:      2,
-			Favorite:    false,
 		},
 		{
 			Name:          "Smart Watch Series 5",
 			Description:   "Feature-rich smartwatch with health tracking",
-			Price:         4999.99,
-			DiscountPrice: 4499.99,
+			Price:         decimal.RequireFromString("4999.99"),
+			DiscountPrice: decimal.RequireFromString("4499.99"),
 			Quantity:      75,
 			SKU:           "WATCH-S5-001",
 			Category:      "Wearables",
@@ -390,7 +442,7 @@ func seedProducts(db *gorm.DB) error {
 		{
 			Name:        "Portable Charger 20000mAh",
 			Description: "High-capacity power bank for mobile devices",
-			Price:       799.99,
+			Price:       decimal.RequireFromString("799.99"),
 			Quantity:    200,
 			SKU:         "CHARGER-20K-001",
 			Category:    "Accessories",
@@ -429,13 +481,13 @@ func seedOrders(db *gorm.DB) error {
 		{
 			ClientID:          1,
 			UserID:            2,
-			Total:             18999.98,
+			Total:             decimal.RequireFromString("18999.98"),
 			Status:            OrderStatus_DELIVERED,
 			Address:           "123 Main Street, Cairo, Egypt",
 			Phone:             "+201001234567",
 			Notes:             "Please call before delivery",
 			PaymentStatus:     "PAID",
-			PaymentAmount:     18999.98,
+			PaymentAmount:     decimal.RequireFromString("18999.98"),
 			PaymentMethodId:   1,
 			PaymentMethodDesc: "Credit Card",
 			PaymentDate:       &paymentDate1,
@@ -444,12 +496,12 @@ func seedOrders(db *gorm.DB) error {
 		{
 			ClientID:          2,
 			UserID:            2,
-			Total:             32999.99,
+			Total:             decimal.RequireFromString("32999.99"),
 			Status:            OrderStatus_SHIPPED,
 			Address:           "456 Business Ave, Alexandria, Egypt",
 			Phone:             "+201009876543",
 			PaymentStatus:     "PAID",
-			PaymentAmount:     32999.99,
+			PaymentAmount:     decimal.RequireFromString("32999.99"),
 			PaymentMethodId:   2,
 			PaymentMethodDesc: "Fawry",
 			PaymentDate:       &paymentDate2,
@@ -458,7 +510,7 @@ func seedOrders(db *gorm.DB) error {
 		{
 			ClientID:      3,
 			UserID:        2,
-			Total:         2499.99,
+			Total:         decimal.RequireFromString("2499.99"),
 			Status:        OrderStatus_PENDING,
 			Address:       "789 Tech Street, Giza, Egypt",
 			Phone:         "+201112345678",
@@ -467,13 +519,13 @@ func seedOrders(db *gorm.DB) error {
 		{
 			ClientID:          4,
 			UserID:            2,
-			Total:             5299.98,
+			Total:             decimal.RequireFromString("5299.98"),
 			Status:            OrderStatus_DELIVERED,
 			Address:           "321 Commerce Blvd, Mansoura, Egypt",
 			Phone:             "+201098765432",
 			Notes:             "Leave at reception",
 			PaymentStatus:     "PAID",
-			PaymentAmount:     5299.98,
+			PaymentAmount:     decimal.RequireFromString("5299.98"),
 			PaymentMethodId:   1,
 			PaymentMethodDesc: "Paymob",
 			PaymentDate:       &paymentDate1,
@@ -482,6 +534,7 @@ func seedOrders(db *gorm.DB) error {
 	}
 
 	for i := range orders {
+		orders[i].BaseTotal = orders[i].Total
 		if err := db.Save(&orders[i]).Error; err != nil {
 			return fmt.Errorf("failed to seed order: %w", err)
 		}
@@ -489,12 +542,12 @@ func seedOrders(db *gorm.DB) error {
 
 	// Create order items
 	orderItems := []OrderItem{
-		{OrderID: 15, ProductID: 1, Quantity: 1, Price: 13999.99},
-		{OrderID: 15, ProductID: 3, Quantity: 2, Price: 2499.99},
-		{OrderID: 16, ProductID: 2, Quantity: 1, Price: 32999.99},
-		{OrderID: 17, ProductID: 3, Quantity: 1, Price: 2499.99},
-		{OrderID: 18, ProductID: 4, Quantity: 1, Price: 4499.99},
-		{OrderID: 19, ProductID: 5, Quantity: 1, Price: 799.99},
+		{OrderID: 15, ProductID: 1, Quantity: 1, Price: decimal.RequireFromString("13999.99")},
+		{OrderID: 15, ProductID: 3, Quantity: 2, Price: decimal.RequireFromString("2499.99")},
+		{OrderID: 16, ProductID: 2, Quantity: 1, Price: decimal.RequireFromString("32999.99")},
+		{OrderID: 17, ProductID: 3, Quantity: 1, Price: decimal.RequireFromString("2499.99")},
+		{OrderID: 18, ProductID: 4, Quantity: 1, Price: decimal.RequireFromString("4499.99")},
+		{OrderID: 19, ProductID: 5, Quantity: 1, Price: decimal.RequireFromString("799.99")},
 	}
 
 	for i := range orderItems {
@@ -522,7 +575,7 @@ func seedAddons(db *gorm.DB) error {
 			Photo:        "https://picsum.photos/400/300?random=11",
 			Category:     "AI",
 			PricingType:  "time",
-			BasePrice:    499.99,
+			BasePrice:    decimal.RequireFromString("499.99"),
 			Currency:     "EGP",
 			BillingCycle: 30,
 			Features:     string(features1),
@@ -535,7 +588,7 @@ func seedAddons(db *gorm.DB) error {
 			Photo:        "https://picsum.photos/400/300?random=13",
 			Category:     "Integration",
 			PricingType:  "time",
-			BasePrice:    299.99,
+			BasePrice:    decimal.RequireFromString("299.99"),
 			Currency:     "EGP",
 			BillingCycle: 30,
 			Features:     string(features2),
@@ -548,7 +601,7 @@ func seedAddons(db *gorm.DB) error {
 			Photo:       "https://picsum.photos/400/300?random=15",
 			Category:    "Analytics",
 			PricingType: "usage",
-			BasePrice:   0.99,
+			BasePrice:   decimal.RequireFromString("0.99"),
 			Currency:    "EGP",
 			UsageUnit:   "reports",
 			Features:    string(features3),
@@ -561,7 +614,7 @@ func seedAddons(db *gorm.DB) error {
 			Photo:       "https://picsum.photos/400/300?random=17",
 			Category:    "Marketing",
 			PricingType: "usage",
-			BasePrice:   0.05,
+			BasePrice:   decimal.RequireFromString("0.05"),
 			Currency:    "EGP",
 			UsageUnit:   "emails",
 			Features:    string(features1),
@@ -582,10 +635,10 @@ func seedAddons(db *gorm.DB) error {
 
 	// Create addon pricing tiers
 	tiers := []AddonPricingTier{
-		{AddonID: 1, MinQuantity: 3, MaxQuantity: 6, DiscountType: "percentage", DiscountValue: 10, FinalPrice: 1349.97, Description: "3 months - 10% off"},
-		{AddonID: 1, MinQuantity: 6, MaxQuantity: 12, DiscountType: "percentage", DiscountValue: 15, FinalPrice: 2549.94, Description: "6 months - 15% off"},
-		{AddonID: 2, MinQuantity: 3, MaxQuantity: 6, DiscountType: "percentage", DiscountValue: 10, FinalPrice: 809.97, Description: "3 months - 10% off"},
-		{AddonID: 2, MinQuantity: 6, MaxQuantity: 12, DiscountType: "percentage", DiscountValue: 20, FinalPrice: 1439.95, Description: "6 months - 20% off"},
+		{AddonID: 1, MinQuantity: 3, MaxQuantity: 6, DiscountType: "percentage", DiscountValue: decimal.RequireFromString("10"), FinalPrice: decimal.RequireFromString("1349.97"), Description: "3 months - 10% off"},
+		{AddonID: 1, MinQuantity: 6, MaxQuantity: 12, DiscountType: "percentage", DiscountValue: decimal.RequireFromString("15"), FinalPrice: decimal.RequireFromString("2549.94"), Description: "6 months - 15% off"},
+		{AddonID: 2, MinQuantity: 3, MaxQuantity: 6, DiscountType: "percentage", DiscountValue: decimal.RequireFromString("10"), FinalPrice: decimal.RequireFromString("809.97"), Description: "3 months - 10% off"},
+		{AddonID: 2, MinQuantity: 6, MaxQuantity: 12, DiscountType: "percentage", DiscountValue: decimal.RequireFromString("20"), FinalPrice: decimal.RequireFromString("1439.95"), Description: "6 months - 20% off"},
 	}
 
 	for i := range tiers {
@@ -612,7 +665,7 @@ func seedAddonSubscriptions(db *gorm.DB) error {
 			AddonID:    1,
 			Status:     AddonSubscriptionStatus_ACTIVE,
 			Quantity:   1,
-			TotalPrice: 499.99,
+			TotalPrice: decimal.RequireFromString("499.99"),
 			StartDate:  now,
 			EndDate:    &endDate1,
 			AutoRenew:  true,
@@ -623,7 +676,7 @@ func seedAddonSubscriptions(db *gorm.DB) error {
 			AddonID:    2,
 			Status:     AddonSubscriptionStatus_ACTIVE,
 			Quantity:   3,
-			TotalPrice: 809.97,
+			TotalPrice: decimal.RequireFromString("809.97"),
 			StartDate:  now,
 			EndDate:    &endDate2,
 			AutoRenew:  false,
@@ -634,7 +687,7 @@ func seedAddonSubscriptions(db *gorm.DB) error {
 			AddonID:    3,
 			Status:     AddonSubscriptionStatus_ACTIVE,
 			Quantity:   500,
-			TotalPrice: 495.00,
+			TotalPrice: decimal.RequireFromString("495.00"),
 			StartDate:  now,
 			UsageLimit: &usageLimit,
 			UsageCount: 234,
@@ -645,7 +698,7 @@ func seedAddonSubscriptions(db *gorm.DB) error {
 			AddonID:    1,
 			Status:     AddonSubscriptionStatus_PENDING,
 			Quantity:   1,
-			TotalPrice: 499.99,
+			TotalPrice: decimal.RequireFromString("499.99"),
 			StartDate:  now,
 			EndDate:    &endDate1,
 			AutoRenew:  false,
@@ -672,12 +725,13 @@ func seedPayments(db *gorm.DB) error {
 	paidAt1 := now.Add(-2 * 24 * time.Hour)
 	paidAt2 := now.Add(-5 * 24 * time.Hour)
 	expiresAt := now.Add(24 * time.Hour)
+	pkgStarter, pkgProfessional, pkgEnterprise := uint(1), uint(2), uint(3)
 
 	payments := []Payment{
 		{
 			UserID:          2,
-			PackageID:       3,
-			Amount:          2499.99,
+			PackageID:       &pkgEnterprise,
+			Amount:          decimal.RequireFromString("2499.99"),
 			Currency:        "EGP",
 			PaymentMethod:   "fawry",
 			PaymentStatus:   PaymentStatus_PAID,
@@ -687,8 +741,8 @@ func seedPayments(db *gorm.DB) error {
 		},
 		{
 			UserID:        2,
-			PackageID:     2,
-			Amount:        899.99,
+			PackageID:     &pkgProfessional,
+			Amount:        decimal.RequireFromString("899.99"),
 			Currency:      "EGP",
 			PaymentMethod: "paymob",
 			PaymentStatus: PaymentStatus_PAID,
@@ -698,8 +752,8 @@ func seedPayments(db *gorm.DB) error {
 		},
 		{
 			UserID:          3,
-			PackageID:       1,
-			Amount:          299.99,
+			PackageID:       &pkgStarter,
+			Amount:          decimal.RequireFromString("299.99"),
 			Currency:        "EGP",
 			PaymentMethod:   "fawry",
 			PaymentStatus:   PaymentStatus_PENDING,
@@ -708,8 +762,8 @@ func seedPayments(db *gorm.DB) error {
 		},
 		{
 			UserID:        3,
-			PackageID:     2,
-			Amount:        899.99,
+			PackageID:     &pkgProfessional,
+			Amount:        decimal.RequireFromString("899.99"),
 			Currency:      "EGP",
 			PaymentMethod: "paymob",
 			PaymentStatus: PaymentStatus_FAILED,
@@ -0,0 +1,90 @@
+package dbmodels
+
+import "time"
+
+// ========== SHIPMENTS ==========
+
+// Shipment is a parcel booked with a carrier for some or all items of an order
+type Shipment struct {
+	ID               uint            `gorm:"primaryKey" json:"id"`
+	OrderID          uint            `gorm:"not null;index" json:"order_id"`
+	StoreOwnerID     uint            `gorm:"not null;index" json:"store_owner_id"`
+	Carrier          string          `gorm:"size:50;not null" json:"carrier"`
+	TrackingNumber   string          `gorm:"size:100;index" json:"tracking_number"`
+	CarrierReference string          `gorm:"size:255" json:"carrier_reference,omitempty"` // Carrier's own shipment ID, when it differs from the tracking number
+	Status           ShipmentStatus  `gorm:"not null;default:0;index" json:"status"`
+	LabelPath        string          `gorm:"size:500" json:"-"`
+	Notes            string          `gorm:"type:text" json:"notes,omitempty"`
+	ShippedAt        time.Time       `json:"shipped_at"`
+	DeliveredAt      *time.Time      `json:"delivered_at,omitempty"`
+	CanceledAt       *time.Time      `json:"canceled_at,omitempty"`
+	LastTrackedAt    *time.Time      `json:"last_tracked_at,omitempty"`
+	Items            []ShipmentItem  `gorm:"foreignKey:ShipmentID" json:"items,omitempty"`
+	Events           []ShipmentEvent `gorm:"foreignKey:ShipmentID" json:"events,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+// ShipmentItem is the quantity of an order item packed in a shipment
+type ShipmentItem struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ShipmentID  uint      `gorm:"not null;index" json:"shipment_id"`
+	OrderItemID uint      `gorm:"not null;index" json:"order_item_id"`
+	ProductID   uint      `gorm:"not null" json:"product_id"`
+	Quantity    int       `gorm:"not null" json:"quantity"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ShipmentEvent is one tracking checkpoint reported by the carrier
+type ShipmentEvent struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	ShipmentID  uint           `gorm:"not null;index" json:"shipment_id"`
+	Status      ShipmentStatus `gorm:"not null" json:"status"`
+	Description string         `gorm:"size:500" json:"description"`
+	Location    string         `gorm:"size:255" json:"location,omitempty"`
+	OccurredAt  time.Time      `gorm:"not null" json:"occurred_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+type ShipmentStatus int32
+
+const (
+	ShipmentStatus_CREATED          ShipmentStatus = 0
+	ShipmentStatus_IN_TRANSIT       ShipmentStatus = 1
+	ShipmentStatus_OUT_FOR_DELIVERY ShipmentStatus = 2
+	ShipmentStatus_DELIVERED        ShipmentStatus = 3
+	ShipmentStatus_FAILED           ShipmentStatus = 4 // Delivery attempt failed; the carrier will retry
+	ShipmentStatus_RETURNED         ShipmentStatus = 5
+	ShipmentStatus_CANCELED         ShipmentStatus = 6
+)
+
+// Enum value maps for ShipmentStatus.
+var (
+	ShipmentStatus_name = map[int32]string{
+		0: "CREATED",
+		1: "IN_TRANSIT",
+		2: "OUT_FOR_DELIVERY",
+		3: "DELIVERED",
+		4: "FAILED",
+		5: "RETURNED",
+		6: "CANCELED",
+	}
+	ShipmentStatus_value = map[string]int32{
+		"CREATED":          0,
+		"IN_TRANSIT":       1,
+		"OUT_FOR_DELIVERY": 2,
+		"DELIVERED":        3,
+		"FAILED":           4,
+		"RETURNED":         5,
+		"CANCELED":         6,
+	}
+)
+
+func (x ShipmentStatus) String() string {
+	return ShipmentStatus_name[int32(x)]
+}
+
+// IsFinal reports whether the carrier will not report further progress
+func (x ShipmentStatus) IsFinal() bool {
+	return x == ShipmentStatus_DELIVERED || x == ShipmentStatus_RETURNED || x == ShipmentStatus_CANCELED
+}
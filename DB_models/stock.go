@@ -0,0 +1,41 @@
+package dbmodels
+
+import "time"
+
+// ========== STOCK LEVELS ==========
+
+// Fallbacks used when neither the product, its category nor the store define reorder settings
+const (
+	DefaultReorderPoint    = 10
+	DefaultReorderQuantity = 20
+)
+
+// StockSetting holds a store's reorder point and quantity for a category.
+// The row with an empty Category is the store-wide default.
+type StockSetting struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	UserID          uint      `gorm:"not null;uniqueIndex:idx_stock_setting_category" json:"user_id"`
+	Category        string    `gorm:"size:255;uniqueIndex:idx_stock_setting_category" json:"category"`
+	ReorderPoint    int       `gorm:"not null" json:"reorder_point"`
+	ReorderQuantity int       `gorm:"not null" json:"reorder_quantity"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// StockLevel is a product with its effective reorder settings and sales velocity
+type StockLevel struct {
+	ProductID       uint       `json:"product_id"`
+	Name            string     `json:"name"`
+	SKU             string     `json:"sku"`
+	Category        string     `json:"category"`
+	UserID          uint       `json:"user_id"`
+	Quantity        int        `json:"quantity"`
+	ReorderPoint    int        `json:"reorder_point"`
+	ReorderQuantity int        `json:"reorder_quantity"`
+	LowStockAlertAt *time.Time `json:"-"`
+	UnitsSold       int        `json:"units_sold"`         // Within the sales window
+	DailyVelocity   float64    `json:"daily_velocity"`     // Units sold per day
+	DaysOfStockLeft *float64   `json:"days_of_stock_left"` // Nil when the product has not sold
+	SuggestedOrder  int        `json:"suggested_order"`
+	BelowReorder    bool       `json:"below_reorder_point"`
+}
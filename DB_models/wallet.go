@@ -0,0 +1,81 @@
+package dbmodels
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ========== WALLET ==========
+
+// WalletPaymentMethod pays from the user's wallet instead of a gateway
+const WalletPaymentMethod = "wallet"
+
+// Wallet is a user's prepaid balance in the platform currency. The balance only
+// changes together with a WalletTransaction, so it always equals its ledger.
+type Wallet struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	UserID    uint            `gorm:"not null;uniqueIndex" json:"user_id"`
+	Balance   decimal.Decimal `gorm:"type:numeric(14,2);not null;default:0" json:"balance"`
+	Currency  string          `gorm:"size:10;default:'EGP'" json:"currency"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// WalletTransaction is one ledger entry of a wallet
+type WalletTransaction struct {
+	ID           uint              `gorm:"primaryKey" json:"id"`
+	WalletID     uint              `gorm:"not null;index" json:"wallet_id"`
+	UserID       uint              `gorm:"not null;index" json:"user_id"`
+	Type         WalletEntryType   `gorm:"not null" json:"type"`
+	Reason       WalletEntryReason `gorm:"not null" json:"reason"`
+	Amount       decimal.Decimal   `gorm:"type:numeric(14,2);not null" json:"amount"` // Always positive; Type gives the direction
+	BalanceAfter decimal.Decimal   `gorm:"type:numeric(14,2);not null" json:"balance_after"`
+	PaymentID    *uint             `gorm:"index" json:"payment_id,omitempty"` // Top-up, payment or refund this entry is for
+	Reference    string            `gorm:"size:255" json:"reference"`
+	Note         string            `gorm:"type:text" json:"note"`
+	CreatedBy    *uint             `json:"created_by,omitempty"` // Admin who made an adjustment
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+type WalletEntryType int32
+
+const (
+	WalletEntryType_CREDIT WalletEntryType = 0
+	WalletEntryType_DEBIT  WalletEntryType = 1
+)
+
+var (
+	WalletEntryType_name = map[int32]string{
+		0: "CREDIT",
+		1: "DEBIT",
+	}
+)
+
+func (x WalletEntryType) String() string {
+	return WalletEntryType_name[int32(x)]
+}
+
+type WalletEntryReason int32
+
+const (
+	WalletEntryReason_TOP_UP        WalletEntryReason = 0
+	WalletEntryReason_PAYMENT       WalletEntryReason = 1 // Paid a package, add-on, renewal or order
+	WalletEntryReason_REFUND        WalletEntryReason = 2 // A payment refunded to the wallet
+	WalletEntryReason_ADJUSTMENT    WalletEntryReason = 3 // Made by an admin
+	WalletEntryReason_TOP_UP_REVERT WalletEntryReason = 4 // A top-up refunded through its gateway
+)
+
+var (
+	WalletEntryReason_name = map[int32]string{
+		0: "TOP_UP",
+		1: "PAYMENT",
+		2: "REFUND",
+		3: "ADJUSTMENT",
+		4: "TOP_UP_REVERT",
+	}
+)
+
+func (x WalletEntryReason) String() string {
+	return WalletEntryReason_name[int32(x)]
+}
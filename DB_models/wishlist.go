@@ -0,0 +1,39 @@
+package dbmodels
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ========== WISHLISTS ==========
+
+// Wishlist is a named list of products owned by a user or a guest session
+type Wishlist struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	UserID     *uint          `gorm:"index" json:"user_id,omitempty"`
+	SessionID  string         `gorm:"size:255;index" json:"session_id,omitempty"`
+	Name       string         `gorm:"size:255;not null" json:"name"`
+	IsDefault  bool           `gorm:"default:false" json:"is_default"`
+	IsPublic   bool           `gorm:"default:false" json:"is_public"`
+	ShareToken string         `gorm:"size:64;uniqueIndex;not null" json:"share_token"`
+	Items      []WishlistItem `gorm:"foreignKey:WishlistID" json:"items,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// WishlistItem is a product saved to a wishlist, with the state used for stock and price alerts
+type WishlistItem struct {
+	ID                uint            `gorm:"primaryKey" json:"id"`
+	WishlistID        uint            `gorm:"not null;uniqueIndex:idx_wishlist_product" json:"wishlist_id"`
+	Wishlist          *Wishlist       `gorm:"foreignKey:WishlistID" json:"wishlist,omitempty"`
+	ProductID         uint            `gorm:"not null;uniqueIndex:idx_wishlist_product;index" json:"product_id"`
+	Product           *Product        `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Note              string          `gorm:"type:text" json:"note,omitempty"`
+	PriceWhenAdded    decimal.Decimal `gorm:"type:numeric(14,2);not null;default:0" json:"price_when_added"`
+	LastNotifiedPrice decimal.Decimal `gorm:"type:numeric(14,2);not null;default:0" json:"-"` // Price at the last price-drop alert
+	NotifyBackInStock bool            `gorm:"default:true" json:"notify_back_in_stock"`
+	NotifyPriceDrop   bool            `gorm:"default:true" json:"notify_price_drop"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
@@ -33,10 +33,14 @@ type PhotoUploadResult struct {
 type PhotoCategory string
 
 const (
-	CategoryBlog    PhotoCategory = "blogs"
-	CategoryAvatar  PhotoCategory = "avatars"
-	CategoryPackage PhotoCategory = "packages"
-	CategoryGeneral PhotoCategory = "general"
+	CategoryBlog     PhotoCategory = "blogs"
+	CategoryAvatar   PhotoCategory = "avatars"
+	CategoryPackage  PhotoCategory = "packages"
+	CategoryGeneral  PhotoCategory = "general"
+	CategoryReview   PhotoCategory = "reviews"
+	CategoryBranding PhotoCategory = "branding"
+	// Proof of offline payments; served only through the payment proof endpoint
+	CategoryPaymentProof PhotoCategory = "payment-proofs"
 )
 
 // NewPhotoService creates and initializes a new MinIO photo service
@@ -4,15 +4,21 @@ import (
 	"context"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mohammedrefaat/hamber/i18n"
 )
 
 const (
 	LanguageKey = "language"
 )
 
+// LanguageMiddleware stores the request language: the lang query parameter when
+// given, otherwise the first supported language of the Accept-Language header
 func LanguageMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		lang := c.Request.Header.Get("Accept-Language") // Get language from header
+		lang := i18n.NormalizeLanguage(c.Query("lang"))
+		if lang == "" {
+			lang = i18n.NormalizeLanguage(c.Request.Header.Get("Accept-Language")) // Get language from header
+		}
 		if lang == "" {
 			lang = "en" // default language
 		}
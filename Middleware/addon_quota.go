@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammedrefaat/hamber/stores"
+)
+
+// AddonQuota reserves units of an add-on for the signed-in user before each
+// request, against their active subscription to it. A request over quota is
+// refused with 402 (no subscription or usage limit reached) or 429 (overage
+// allowed this period used up) and the remaining quota; a request that then
+// fails gets its units back. An add-on ID of 0 meters nothing. Must run after
+// JWTMiddleware.
+func AddonQuota(store *stores.DbStore, addonID uint, units int) gin.HandlerFunc {
+	if addonID == 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "User not found in context",
+			})
+			c.Abort()
+			return
+		}
+
+		usageLog, quota, err := store.ReserveUserAddonUsage(userID.(uint), addonID, units, c.Request.Method+" "+c.FullPath())
+		if err != nil {
+			code := http.StatusInternalServerError
+			if customErr, ok := err.(*stores.CustomError); ok {
+				code = customErr.Code
+			}
+			response := gin.H{"error": err.Error()}
+			if quota != nil {
+				response["quota"] = quota
+				if code == http.StatusTooManyRequests {
+					c.Header("Retry-After", strconv.Itoa(int(time.Until(quota.PeriodEnd).Seconds())+1))
+				}
+			}
+			c.JSON(code, response)
+			c.Abort()
+			return
+		}
+
+		if quota.Remaining != nil {
+			c.Header("X-Quota-Remaining", strconv.Itoa(*quota.Remaining))
+		}
+		c.Set("addon_usage_log_id", usageLog.ID)
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusBadRequest {
+			store.ReleaseAddonUsage(usageLog.ID)
+		}
+	}
+}
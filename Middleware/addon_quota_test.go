@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestAddonQuota(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	store, err := stores.NewDbStore(db)
+	if err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+
+	pkg := dbmodels.Package{Name: "Starter", Price: decimal.RequireFromString("299.99"), Duration: 30, IsActive: true}
+	mustCreate(t, db, &pkg)
+	user := dbmodels.User{Name: "Mona", Email: "mona@example.com", Password: "x", Subdomain: "mona", RoleID: 1, PackageID: pkg.ID}
+	mustCreate(t, db, &user)
+
+	// subscribe gives the user an add-on with one included unit
+	subscribe := func(title string, overagePrice string, overageLimit int) (dbmodels.Addon, dbmodels.UserAddonSubscription) {
+		addon := dbmodels.Addon{
+			Title:        title,
+			PricingType:  "usage",
+			BasePrice:    decimal.RequireFromString("0.99"),
+			Currency:     "EGP",
+			BillingCycle: 30,
+			UsageUnit:    "reports",
+			OveragePrice: decimal.RequireFromString(overagePrice),
+			OverageLimit: overageLimit,
+			IsActive:     true,
+		}
+		mustCreate(t, db, &addon)
+		limit := 1
+		subscription := dbmodels.UserAddonSubscription{
+			UserID:     user.ID,
+			AddonID:    addon.ID,
+			Status:     dbmodels.AddonSubscriptionStatus_ACTIVE,
+			Quantity:   1,
+			TotalPrice: addon.BasePrice,
+			StartDate:  time.Now().Add(-time.Hour),
+			UsageLimit: &limit,
+		}
+		mustCreate(t, db, &subscription)
+		return addon, subscription
+	}
+
+	// request calls a metered handler that responds with status
+	request := func(addonID uint, status int) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set("user_id", user.ID) })
+		router.GET("/report", AddonQuota(store, addonID, 1), func(c *gin.Context) {
+			c.Status(status)
+		})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/report", nil))
+		return recorder
+	}
+	usageCount := func(id uint) int {
+		var subscription dbmodels.UserAddonSubscription
+		if err := db.First(&subscription, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		return subscription.UsageCount
+	}
+
+	t.Run("no subscription", func(t *testing.T) {
+		addon := dbmodels.Addon{Title: "Unsubscribed", PricingType: "usage", BasePrice: decimal.RequireFromString("1"), IsActive: true}
+		mustCreate(t, db, &addon)
+		if recorder := request(addon.ID, http.StatusOK); recorder.Code != http.StatusPaymentRequired {
+			t.Errorf("got %d, want 402", recorder.Code)
+		}
+	})
+
+	t.Run("usage limit reached", func(t *testing.T) {
+		addon, subscription := subscribe("No overage", "0", 0)
+		recorder := request(addon.ID, http.StatusOK)
+		if recorder.Code != http.StatusOK || recorder.Header().Get("X-Quota-Remaining") != "0" {
+			t.Fatalf("first request: %d with %q remaining, want 200 with 0", recorder.Code, recorder.Header().Get("X-Quota-Remaining"))
+		}
+		recorder = request(addon.ID, http.StatusOK)
+		if recorder.Code != http.StatusPaymentRequired || !hasQuota(recorder) {
+			t.Errorf("over the limit: %d %s, want 402 with the quota", recorder.Code, recorder.Body)
+		}
+		if used := usageCount(subscription.ID); used != 1 {
+			t.Errorf("used %d, want 1", used)
+		}
+	})
+
+	t.Run("overage used up", func(t *testing.T) {
+		addon, subscription := subscribe("Capped overage", "0.50", 1)
+		for i := 0; i < 2; i++ {
+			if recorder := request(addon.ID, http.StatusOK); recorder.Code != http.StatusOK {
+				t.Fatalf("request %d: %d, want 200", i+1, recorder.Code)
+			}
+		}
+		recorder := request(addon.ID, http.StatusOK)
+		if recorder.Code != http.StatusTooManyRequests || !hasQuota(recorder) {
+			t.Errorf("past the overage cap: %d %s, want 429 with the quota", recorder.Code, recorder.Body)
+		}
+		if retryAfter, err := strconv.Atoi(recorder.Header().Get("Retry-After")); err != nil || retryAfter <= 0 {
+			t.Errorf("Retry-After %q, want the seconds until the period ends", recorder.Header().Get("Retry-After"))
+		}
+		if used := usageCount(subscription.ID); used != 2 {
+			t.Errorf("used %d, want 2", used)
+		}
+	})
+
+	t.Run("released when the handler fails", func(t *testing.T) {
+		addon, subscription := subscribe("Released", "0", 0)
+		if recorder := request(addon.ID, http.StatusInternalServerError); recorder.Code != http.StatusInternalServerError {
+			t.Fatalf("got %d, want the handler's 500", recorder.Code)
+		}
+		if used := usageCount(subscription.ID); used != 0 {
+			t.Errorf("used %d after a failed request, want 0", used)
+		}
+		var logs int64
+		db.Model(&dbmodels.AddonUsageLog{}).Where("subscription_id = ?", subscription.ID).Count(&logs)
+		if logs != 0 {
+			t.Errorf("%d usage logs kept for a failed request, want 0", logs)
+		}
+		if recorder := request(addon.ID, http.StatusOK); recorder.Code != http.StatusOK {
+			t.Errorf("request after the release: %d, want 200", recorder.Code)
+		}
+	})
+
+	t.Run("no add-on configured", func(t *testing.T) {
+		if recorder := request(0, http.StatusOK); recorder.Code != http.StatusOK || recorder.Header().Get("X-Quota-Remaining") != "" {
+			t.Errorf("got %d with %q remaining, want an unmetered 200", recorder.Code, recorder.Header().Get("X-Quota-Remaining"))
+		}
+	})
+}
+
+func hasQuota(recorder *httptest.ResponseRecorder) bool {
+	var response struct {
+		Quota *stores.UsageQuota `json:"quota"`
+	}
+	return json.Unmarshal(recorder.Body.Bytes(), &response) == nil && response.Quota != nil
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
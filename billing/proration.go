@@ -0,0 +1,107 @@
+// Package billing holds the pricing rules for package subscriptions.
+package billing
+
+import (
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/shopspring/decimal"
+)
+
+// ========== PRORATION ==========
+
+const day = 24 * time.Hour
+
+// Quote is the proration of a package change
+type Quote struct {
+	ChangeType       dbmodels.PackageChangeType `json:"change_type"`
+	ChangeTypeName   string                     `json:"change_type_name"`
+	CurrentPackageID uint                       `json:"current_package_id"`
+	NewPackageID     uint                       `json:"new_package_id"`
+	NewPackagePrice  decimal.Decimal            `json:"new_package_price"`
+	CreditAmount     decimal.Decimal            `json:"credit_amount"` // Unused value of the current period
+	AmountDue        decimal.Decimal            `json:"amount_due"`
+	UnusedDays       int                        `json:"unused_days"`
+	PeriodDays       int                        `json:"period_days"`
+	PeriodEnd        *time.Time                 `json:"period_end,omitempty"`
+	EffectiveAt      time.Time                  `json:"effective_at"`
+	Immediate        bool                       `json:"immediate"` // Applied as soon as it is paid
+}
+
+// QuotePackageChange prices a move from the current package to a new one.
+//
+// Packages are compared by daily price. An upgrade is charged now, less the
+// unused value of the current subscription, and applies once paid. A downgrade
+// is charged in full and applies when the current period ends, so nothing is
+// credited. Without an active subscription the new package is charged in full
+// and applies once paid.
+func QuotePackageChange(current *dbmodels.Subscription, oldPackage, newPackage *dbmodels.Package, now time.Time) *Quote {
+	quote := &Quote{
+		ChangeType:       dbmodels.PackageChangeType_UPGRADE,
+		CurrentPackageID: oldPackage.ID,
+		NewPackageID:     newPackage.ID,
+		NewPackagePrice:  newPackage.Price,
+		CreditAmount:     decimal.Zero,
+		AmountDue:        newPackage.Price,
+		EffectiveAt:      now,
+		Immediate:        true,
+	}
+	if dailyPrice(newPackage).LessThan(dailyPrice(oldPackage)) {
+		quote.ChangeType = dbmodels.PackageChangeType_DOWNGRADE
+	}
+	quote.ChangeTypeName = quote.ChangeType.String()
+
+	if current == nil || current.PackageID != oldPackage.ID || !now.Before(current.EndDate) {
+		return quote
+	}
+
+	periodEnd := current.EndDate
+	quote.PeriodEnd = &periodEnd
+	quote.PeriodDays = int(current.EndDate.Sub(current.StartDate).Round(day) / day)
+	quote.UnusedDays = int(current.EndDate.Sub(now) / day)
+	if quote.UnusedDays > quote.PeriodDays {
+		quote.UnusedDays = quote.PeriodDays
+	}
+
+	if quote.ChangeType == dbmodels.PackageChangeType_DOWNGRADE {
+		quote.EffectiveAt = periodEnd
+		quote.Immediate = false
+		return quote
+	}
+
+	if quote.PeriodDays > 0 {
+		quote.CreditAmount = money.Round(current.Price.
+			Mul(decimal.NewFromInt(int64(quote.UnusedDays))).
+			Div(decimal.NewFromInt(int64(quote.PeriodDays))))
+	}
+	// Credit beyond the new price is not refunded
+	if quote.CreditAmount.GreaterThan(newPackage.Price) {
+		quote.CreditAmount = newPackage.Price
+	}
+	quote.AmountDue = newPackage.Price.Sub(quote.CreditAmount)
+	return quote
+}
+
+// Apply copies the breakdown onto a package change
+func (q *Quote) Apply(change *dbmodels.PackageChange) {
+	effectiveAt := q.EffectiveAt
+	change.ChangeType = q.ChangeType
+	change.NewPackagePrice = q.NewPackagePrice
+	change.CreditAmount = q.CreditAmount
+	change.AmountDue = q.AmountDue
+	change.UnusedDays = q.UnusedDays
+	change.PeriodDays = q.PeriodDays
+	change.PeriodEnd = q.PeriodEnd
+	if !q.Immediate {
+		change.EffectiveAt = &effectiveAt
+	}
+}
+
+// dailyPrice is the package price per day of its duration
+func dailyPrice(pkg *dbmodels.Package) decimal.Decimal {
+	if pkg.Duration <= 0 {
+		return pkg.Price
+	}
+	return pkg.Price.Div(decimal.NewFromInt(int64(pkg.Duration)))
+}
@@ -0,0 +1,391 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/notification"
+	"github.com/mohammedrefaat/hamber/payment"
+	"github.com/mohammedrefaat/hamber/stores"
+)
+
+// ========== RENEWALS AND DUNNING ==========
+
+// renewalBatch caps the subscriptions or invoices handled by each step of a run
+const renewalBatch = 200
+
+// Renewals bills the next period of paid subscriptions. Invoices are issued
+// before a period ends and collected through the user's gateway; unpaid ones are
+// retried on a schedule, the subscription turns past due when its period ends,
+// and once the grace period is over it is suspended or downgraded to the free
+// package. Paying an invoice renews the subscription through TransitionPayment.
+type Renewals struct {
+	store        *stores.DbStore
+	gateways     *payment.Registry
+	config       *config.Config
+	emailService *notification.EmailService
+	notifService *notification.NotificationService
+}
+
+// RenewalSummary counts what one run did
+type RenewalSummary struct {
+	InvoicesIssued    int `json:"invoices_issued"`
+	PaymentsRequested int `json:"payments_requested"`
+	PaymentsFailed    int `json:"payments_failed"`
+	FreeRenewed       int `json:"free_renewed"`
+	Cancelled         int `json:"cancelled"` // Ended without renewal at the user's request
+	GraceStarted      int `json:"grace_started"`
+	Suspended         int `json:"suspended"`
+	Downgraded        int `json:"downgraded"`
+}
+
+func NewRenewals(store *stores.DbStore, gateways *payment.Registry, cfg *config.Config, emailService *notification.EmailService, notifService *notification.NotificationService) *Renewals {
+	if cfg.GetFreePackageID() == 0 {
+		log.Println("⚠️ Billing: no free_package_id; unpaid subscriptions are suspended and cancelled ones are not ended")
+	}
+	return &Renewals{
+		store:        store,
+		gateways:     gateways,
+		config:       cfg,
+		emailService: emailService,
+		notifService: notifService,
+	}
+}
+
+// Run issues due invoices, attempts their payment and moves unpaid
+// subscriptions through the grace period. Each step carries on past failures of
+// single subscriptions; the error is that of the first step that could not run.
+func (r *Renewals) Run(ctx context.Context, now time.Time) (*RenewalSummary, error) {
+	summary := &RenewalSummary{}
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	keep(r.issueInvoices(now, summary))
+	keep(r.collectInvoices(ctx, now, summary))
+	keep(r.endPeriods(now, summary))
+	keep(r.expireGrace(now, summary))
+	return summary, firstErr
+}
+
+// issueInvoices bills the next period of subscriptions ending soon
+func (r *Renewals) issueInvoices(now time.Time, summary *RenewalSummary) error {
+	subscriptions, err := r.store.GetRenewableSubscriptions(now.Add(r.config.GetRenewBefore()), renewalBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		nextAttemptAt := now
+		invoice := &dbmodels.SubscriptionInvoice{
+			UserID:         subscription.UserID,
+			SubscriptionID: subscription.ID,
+			PackageID:      subscription.PackageID,
+			Amount:         subscription.Package.Price,
+			Currency:       r.config.GetBaseCurrency(),
+			PeriodStart:    subscription.EndDate,
+			PeriodEnd:      subscription.EndDate.AddDate(0, 0, subscription.Package.Duration),
+			DueAt:          subscription.EndDate,
+			Status:         dbmodels.InvoiceStatus_OPEN,
+			NextAttemptAt:  &nextAttemptAt,
+		}
+		if err := r.store.CreateSubscriptionInvoice(invoice); err != nil {
+			log.Printf("Renewals: invoice for subscription %d not issued: %v", subscription.ID, err)
+			continue
+		}
+		summary.InvoicesIssued++
+	}
+	return nil
+}
+
+// collectInvoices starts a payment for every invoice whose attempt is due
+func (r *Renewals) collectInvoices(ctx context.Context, now time.Time, summary *RenewalSummary) error {
+	maxAttempts := r.config.GetRenewalMaxAttempts()
+	invoices, err := r.store.GetDueInvoices(now, maxAttempts, renewalBatch)
+	if err != nil {
+		return err
+	}
+
+	for i := range invoices {
+		invoice := &invoices[i]
+
+		// The last attempt leaves the invoice to the grace period
+		var nextAttemptAt *time.Time
+		if invoice.Attempts+1 < maxAttempts {
+			next := now.Add(r.config.GetRenewalRetryInterval())
+			nextAttemptAt = &next
+		}
+
+		paymentdb, result, err := r.startPayment(ctx, invoice, r.paymentMethod(invoice.UserID))
+		event := &dbmodels.SubscriptionEvent{
+			UserID:         invoice.UserID,
+			SubscriptionID: &invoice.SubscriptionID,
+			InvoiceID:      &invoice.ID,
+			Type:           dbmodels.SubscriptionEventType_PAYMENT_REQUESTED,
+		}
+		var paymentID *uint
+		if paymentdb != nil {
+			paymentID = &paymentdb.ID
+			event.PaymentID = paymentID
+		}
+		if err != nil {
+			event.Type = dbmodels.SubscriptionEventType_PAYMENT_FAILED
+			event.Message = fmt.Sprintf("Attempt %d: %v", invoice.Attempts+1, err)
+		} else {
+			event.Message = fmt.Sprintf("Attempt %d via %s", invoice.Attempts+1, paymentdb.PaymentMethod)
+		}
+
+		if err := r.store.RecordInvoiceAttempt(invoice, paymentID, nextAttemptAt, event); err != nil {
+			log.Printf("Renewals: attempt on invoice %d not recorded: %v", invoice.ID, err)
+			continue
+		}
+
+		if err != nil {
+			summary.PaymentsFailed++
+			log.Printf("Renewals: payment for invoice %d not started: %v", invoice.ID, err)
+			continue
+		}
+		summary.PaymentsRequested++
+		r.remind(invoice, result)
+	}
+	return nil
+}
+
+// PayInvoice starts a payment for an open or uncollectible invoice at the
+// user's request. It does not count as a dunning attempt.
+func (r *Renewals) PayInvoice(ctx context.Context, invoice *dbmodels.SubscriptionInvoice, method string) (*dbmodels.Payment, *payment.InitiateResult, error) {
+	paymentdb, result, err := r.startPayment(ctx, invoice, method)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.store.RecordSubscriptionEvent(&dbmodels.SubscriptionEvent{
+		UserID:         invoice.UserID,
+		SubscriptionID: &invoice.SubscriptionID,
+		InvoiceID:      &invoice.ID,
+		PaymentID:      &paymentdb.ID,
+		Type:           dbmodels.SubscriptionEventType_PAYMENT_REQUESTED,
+		Message:        fmt.Sprintf("Requested by the user via %s", method),
+	})
+	return paymentdb, result, nil
+}
+
+// startPayment stores a pending payment for the invoice and registers it with
+// the gateway. It expires when the next attempt is due, so attempts do not overlap.
+// The payment is returned even when the gateway rejected it.
+func (r *Renewals) startPayment(ctx context.Context, invoice *dbmodels.SubscriptionInvoice, method string) (*dbmodels.Payment, *payment.InitiateResult, error) {
+	if method == "" {
+		return nil, nil, fmt.Errorf("no payment gateway enabled")
+	}
+	user, err := r.store.GetUser(invoice.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expiresAt := time.Now().Add(r.config.GetRenewalRetryInterval())
+	paymentdb := &dbmodels.Payment{
+		UserID:          invoice.UserID,
+		Purpose:         dbmodels.PaymentPurpose_SUBSCRIPTION_RENEWAL,
+		PackageID:       &invoice.PackageID,
+		InvoiceID:       &invoice.ID,
+		Amount:          invoice.Amount,
+		Currency:        invoice.Currency,
+		PaymentMethod:   method,
+		PaymentStatus:   dbmodels.PaymentStatus_PENDING,
+		ReferenceNumber: payment.NewReference(fmt.Sprintf("REN-%d", invoice.UserID)),
+		ExpiresAt:       &expiresAt,
+	}
+	if err := r.store.CreatePayment(paymentdb); err != nil {
+		return nil, nil, err
+	}
+
+	packageName := fmt.Sprintf("Package %d", invoice.PackageID)
+	if invoice.Package != nil {
+		packageName = invoice.Package.Name
+	}
+	result, err := r.gateways.Start(ctx, r.store, paymentdb, payment.InitiateRequest{
+		Description: fmt.Sprintf("Renewal: %s until %s", packageName, invoice.PeriodEnd.Format("2006-01-02")),
+		Customer: payment.Customer{
+			Name:  user.Name,
+			Email: user.Email,
+			Phone: user.Phone,
+		},
+		Items: []payment.Item{{
+			ID:       fmt.Sprintf("PKG-%d", invoice.PackageID),
+			Name:     packageName,
+			Price:    invoice.Amount,
+			Quantity: 1,
+		}},
+	})
+	if err != nil {
+		return paymentdb, nil, err
+	}
+	return paymentdb, result, nil
+}
+
+// paymentMethod picks the gateway for a renewal: the one the user last paid a
+// package with, else the configured one, else any enabled gateway. Offline
+// methods are left out, as nobody is at hand to pay an automatic renewal by
+// hand; the user can still pay the invoice that way.
+func (r *Renewals) paymentMethod(userID uint) string {
+	if method := r.store.GetLastPackagePaymentMethod(userID); r.online(method) {
+		return method
+	}
+	if method := r.config.GetRenewalPaymentMethod(); r.online(method) {
+		return method
+	}
+	for _, name := range r.gateways.Names() {
+		if r.online(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// online reports whether a payment method is an enabled gateway that settles by itself
+func (r *Renewals) online(method string) bool {
+	return r.gateways.Has(method) && !r.gateways.IsOffline(method)
+}
+
+// endPeriods handles subscriptions whose period ended with no successor: free
+// ones start another period, cancelled ones move to the free package and unpaid
+// ones enter the grace period
+func (r *Renewals) endPeriods(now time.Time, summary *RenewalSummary) error {
+	subscriptions, err := r.store.GetEndedSubscriptions(now, renewalBatch)
+	if err != nil {
+		return err
+	}
+
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		switch {
+		case subscription.CancelAtPeriodEnd:
+			if _, err := r.store.DowngradeSubscription(subscription, r.config.GetFreePackageID(), dbmodels.InvoiceStatus_VOID,
+				fmt.Sprintf("%s ended without renewal", subscription.Package.Name)); err != nil {
+				log.Printf("Renewals: cancelled subscription %d not ended: %v", subscription.ID, err)
+				continue
+			}
+			summary.Cancelled++
+			r.notify(subscription.UserID, "Subscription Ended",
+				fmt.Sprintf("Your %s subscription ended and your account moved to the free package", subscription.Package.Name), "info")
+
+		case !subscription.Package.Price.IsPositive():
+			if subscription.Package.Duration <= 0 {
+				r.store.SetSubscriptionStatus(subscription.ID, dbmodels.SubscriptionStatus_ENDED, nil)
+				continue
+			}
+			if _, err := r.store.RenewFreeSubscription(subscription); err != nil {
+				log.Printf("Renewals: free subscription %d not renewed: %v", subscription.ID, err)
+				continue
+			}
+			summary.FreeRenewed++
+
+		default:
+			graceEnds := subscription.EndDate.Add(r.config.GetGracePeriod())
+			if err := r.store.SetSubscriptionStatus(subscription.ID, dbmodels.SubscriptionStatus_PAST_DUE, &dbmodels.SubscriptionEvent{
+				UserID:         subscription.UserID,
+				SubscriptionID: &subscription.ID,
+				Type:           dbmodels.SubscriptionEventType_GRACE_STARTED,
+				Message:        fmt.Sprintf("Unpaid renewal; features kept until %s", graceEnds.Format("2006-01-02 15:04")),
+			}); err != nil {
+				log.Printf("Renewals: subscription %d not marked past due: %v", subscription.ID, err)
+				continue
+			}
+			summary.GraceStarted++
+			r.notify(subscription.UserID, "Subscription Payment Overdue",
+				fmt.Sprintf("Your %s subscription ended unpaid. Pay the renewal before %s to keep your features", subscription.Package.Name, graceEnds.Format("2006-01-02")), "warning")
+		}
+	}
+	return nil
+}
+
+// expireGrace suspends or downgrades past due subscriptions whose grace period is over
+func (r *Renewals) expireGrace(now time.Time, summary *RenewalSummary) error {
+	subscriptions, err := r.store.GetGraceExpiredSubscriptions(now.Add(-r.config.GetGracePeriod()), renewalBatch)
+	if err != nil {
+		return err
+	}
+
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		message := fmt.Sprintf("Renewal of %s was not paid within the grace period", subscription.Package.Name)
+
+		if r.config.ShouldSuspendOnFailure() {
+			if err := r.store.SuspendSubscription(subscription, message); err != nil {
+				log.Printf("Renewals: subscription %d not suspended: %v", subscription.ID, err)
+				continue
+			}
+			summary.Suspended++
+			r.notify(subscription.UserID, "Subscription Suspended",
+				fmt.Sprintf("Your %s subscription is suspended. Pay the open renewal invoice to reactivate it", subscription.Package.Name), "error")
+			continue
+		}
+
+		if _, err := r.store.DowngradeSubscription(subscription, r.config.GetFreePackageID(), dbmodels.InvoiceStatus_UNCOLLECTIBLE, message); err != nil {
+			log.Printf("Renewals: subscription %d not downgraded: %v", subscription.ID, err)
+			continue
+		}
+		summary.Downgraded++
+		r.notify(subscription.UserID, "Subscription Downgraded",
+			fmt.Sprintf("Your %s subscription was not paid and your account moved to the free package. Paying the renewal invoice restores it", subscription.Package.Name), "error")
+	}
+	return nil
+}
+
+// remind tells the user how to pay a renewal that was just requested
+func (r *Renewals) remind(invoice *dbmodels.SubscriptionInvoice, result *payment.InitiateResult) {
+	packageName := "package"
+	if invoice.Package != nil {
+		packageName = invoice.Package.Name
+	}
+	message := fmt.Sprintf("Your %s subscription renews on %s for %s %s",
+		packageName, invoice.DueAt.Format("2006-01-02"), money.Format(invoice.Amount), invoice.Currency)
+	if invoice.DueAt.Before(time.Now()) {
+		message = fmt.Sprintf("Your %s renewal of %s %s is overdue",
+			packageName, money.Format(invoice.Amount), invoice.Currency)
+	}
+	if result.PaymentURL != "" {
+		message += ". Pay here: " + result.PaymentURL
+	} else if result.ReferenceNumber != "" {
+		message += ". Pay with reference " + result.ReferenceNumber
+	}
+	r.notify(invoice.UserID, "Subscription Renewal", message, "info")
+}
+
+// notify sends an in-app notification and, when email is configured, an email.
+// Without RabbitMQ the notification is written directly.
+func (r *Renewals) notify(userID uint, title, message, notifType string) {
+	if r.notifService != nil {
+		if err := r.notifService.NotifySubscriptionBilling(userID, title, message, notifType); err != nil {
+			log.Printf("Renewals: notification for user %d failed: %v", userID, err)
+		}
+	} else if err := r.store.CreateNotification(&dbmodels.Notification{
+		UserID:  userID,
+		Title:   title,
+		Message: message,
+		Type:    notifType,
+		Link:    "/profile/subscription",
+	}); err != nil {
+		log.Printf("Renewals: notification for user %d failed: %v", userID, err)
+	}
+
+	if r.emailService == nil || !r.emailService.IsConfigured() {
+		return
+	}
+	user, err := r.store.GetUser(userID)
+	if err != nil || user.Email == "" {
+		return
+	}
+	body := fmt.Sprintf("<h2>%s</h2><p>%s</p>", html.EscapeString(title), html.EscapeString(message))
+	if err := r.emailService.Send(user.Email, title, body); err != nil {
+		log.Printf("Renewals: email to %s failed: %v", user.Email, err)
+	}
+}
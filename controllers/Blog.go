@@ -43,6 +43,7 @@ type UpdateBlogRequest struct {
 // @Success      201 {object} map[string]interface{} "Blog created"
 // @Failure      400 {object} map[string]interface{} "Invalid request"
 // @Failure      409 {object} map[string]interface{} "Slug already exists"
+// @Failure      402 {object} map[string]interface{} "Upgrade required"
 // @Router       /blogs [post]
 func CreateBlog(c *gin.Context) {
 	var req CreateBlogRequest
@@ -61,6 +62,10 @@ func CreateBlog(c *gin.Context) {
 		return
 	}
 
+	if !requireEntitlement(c, userID.(uint), dbmodels.Entitlement_BLOGS, 1) {
+		return
+	}
+
 	blog := dbmodels.Blog{
 		Title:       req.Title,
 		Content:     req.Content,
@@ -104,6 +109,7 @@ func CreateBlog(c *gin.Context) {
 // @Success      201 {object} map[string]interface{} "Blog created with photos"
 // @Failure      400 {object} map[string]interface{} "Invalid request"
 // @Failure      401 {object} map[string]interface{} "Unauthorized"
+// @Failure      402 {object} map[string]interface{} "Upgrade required"
 // @Router       /blogs [post]
 func CreateBlogWithPhotos(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -144,6 +150,12 @@ func CreateBlogWithPhotos(c *gin.Context) {
 		isPublished = true
 	}
 
+	files := c.Request.MultipartForm.File["photos"]
+	if !requireEntitlement(c, userID.(uint), dbmodels.Entitlement_BLOGS, 1) ||
+		!requireEntitlement(c, userID.(uint), dbmodels.Entitlement_STORAGE, multipartFilesSize(files)) {
+		return
+	}
+
 	// Create blog
 	blog := dbmodels.Blog{
 		Title:       title,
@@ -168,9 +180,6 @@ func CreateBlogWithPhotos(c *gin.Context) {
 		return
 	}
 
-	// Get uploaded photos
-	files := c.Request.MultipartForm.File["photos"]
-
 	// If photos were uploaded, process them
 	if len(files) > 0 {
 		photoService := globalStore.PhotoSrv
@@ -182,6 +191,8 @@ func CreateBlogWithPhotos(c *gin.Context) {
 			// Log error but don't fail the blog creation
 			fmt.Printf("Warning: Failed to upload photos: %v\n", err)
 		} else {
+			recordStoredFiles(blog.AuthorID, uploadResults)
+
 			// Extract URLs from upload results
 			var photoURLs []string
 			for _, result := range uploadResults {
@@ -430,6 +441,7 @@ func DeleteBlog(c *gin.Context) {
 		})
 		return
 	}
+	releaseStoredFiles(decodePhotoURLs(blog.Photos))
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Blog post deleted successfully",
@@ -449,6 +461,7 @@ func DeleteBlog(c *gin.Context) {
 // @Failure      400 {object} map[string]interface{} "Invalid request"
 // @Failure      403 {object} map[string]interface{} "Not authorized"
 // @Failure      404 {object} map[string]interface{} "Blog not found"
+// @Failure      402 {object} map[string]interface{} "Upgrade required"
 // @Router       /blogs/{id}/photos [post]
 func UploadBlogPhoto(c *gin.Context) {
 	blogID := c.Param("id")
@@ -649,6 +662,9 @@ func UploadBlogPhotoV2(c *gin.Context) {
 		})
 		return
 	}
+	if !requireEntitlement(c, blog.AuthorID, dbmodels.Entitlement_STORAGE, multipartFilesSize(files)) {
+		return
+	}
 
 	// Get photo service
 	photoService := globalStore.PhotoSrv
@@ -662,6 +678,7 @@ func UploadBlogPhotoV2(c *gin.Context) {
 		})
 		return
 	}
+	recordStoredFiles(blog.AuthorID, uploadResults)
 
 	// Get existing photos
 	var existingPhotos []string
@@ -858,6 +875,7 @@ func DeleteBlogPhoto(c *gin.Context) {
 			fmt.Printf("Warning: Failed to delete photo from MinIO: %v\n", err)
 		}
 	}
+	releaseStoredFiles([]string{photoToDelete})
 
 	// Update blog
 	photosJSON, _ := json.Marshal(newPhotos)
@@ -45,6 +45,7 @@ type EventAttendeeInput struct {
 // @Param        request body CreateEventRequest true "Event details"
 // @Success      201 {object} map[string]interface{} "Event created"
 // @Failure      400 {object} map[string]interface{} "Invalid request"
+// @Failure      402 {object} map[string]interface{} "Upgrade required"
 // @Router       /calendar/events [post]
 func CreateCalendarEvent(c *gin.Context) {
 	claims, err := utils.GetclamsFromContext(c)
@@ -68,6 +69,9 @@ func CreateCalendarEvent(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create public events"})
 		return
 	}
+	if !requireEntitlement(c, claims.UserID, dbmodels.Entitlement_CALENDAR_EVENTS, 1) {
+		return
+	}
 
 	event := &dbmodels.CalendarEvent{
 		UserID:         claims.UserID,
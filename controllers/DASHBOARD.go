@@ -30,6 +30,7 @@ func GetUserDashboard(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dashboard stats"})
 		return
 	}
+	stats.Currency = storeCurrency(claims.UserID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"stats": stats,
@@ -59,7 +60,8 @@ func GetRevenueChart(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"data": chartData,
+		"data":     chartData,
+		"currency": storeCurrency(claims.UserID),
 	})
 }
 
@@ -114,6 +116,7 @@ func GetTopProducts(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"products": products,
+		"currency": storeCurrency(claims.UserID),
 	})
 }
 
@@ -248,7 +251,7 @@ func GetAdminDashboard(c *gin.Context) {
 		return
 	}
 
-	stats, err := globalStore.StStore.GetAdminDashboardStats()
+	stats, err := globalStore.StStore.GetAdminDashboardStats(globalStore.Config.GetBaseCurrency())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch admin stats"})
 		return
@@ -280,7 +283,7 @@ func GetPlatformAnalytics(c *gin.Context) {
 		return
 	}
 
-	analytics, err := globalStore.StStore.GetPlatformAnalytics()
+	analytics, err := globalStore.StStore.GetPlatformAnalytics(globalStore.Config.GetBaseCurrency())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
 		return
@@ -344,7 +347,7 @@ func GetRevenueBreakdown(c *gin.Context) {
 		return
 	}
 
-	breakdown, err := globalStore.StStore.GetRevenueBreakdown()
+	breakdown, err := globalStore.StStore.GetRevenueBreakdown(globalStore.Config.GetBaseCurrency())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revenue breakdown"})
 		return
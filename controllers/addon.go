@@ -11,23 +11,29 @@ import (
 	"github.com/gin-gonic/gin"
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
 	db "github.com/mohammedrefaat/hamber/Db"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/payment"
+	"github.com/mohammedrefaat/hamber/stores"
 	"github.com/mohammedrefaat/hamber/utils"
+	"github.com/shopspring/decimal"
 )
 
 // ========== ADD-ON CONTROLLERS ==========
 
 type CreateAddonRequest struct {
-	Title        string   `json:"title" binding:"required"`
-	Description  string   `json:"description"`
-	Logo         string   `json:"logo"`
-	Photo        string   `json:"photo"`
-	Category     string   `json:"category"`
-	PricingType  string   `json:"pricing_type" binding:"required,oneof=time usage"`
-	BasePrice    float64  `json:"base_price" binding:"required"`
-	Currency     string   `json:"currency"`
-	BillingCycle int      `json:"billing_cycle"`
-	UsageUnit    string   `json:"usage_unit"`
-	Features     []string `json:"features"`
+	Title        string          `json:"title" binding:"required"`
+	Description  string          `json:"description"`
+	Logo         string          `json:"logo"`
+	Photo        string          `json:"photo"`
+	Category     string          `json:"category"`
+	PricingType  string          `json:"pricing_type" binding:"required,oneof=time usage"`
+	BasePrice    decimal.Decimal `json:"base_price" binding:"required"`
+	Currency     string          `json:"currency"`
+	BillingCycle int             `json:"billing_cycle"`
+	UsageUnit    string          `json:"usage_unit"`
+	Features     []string        `json:"features"`
+	OveragePrice decimal.Decimal `json:"overage_price"` // Per unit past the usage limit; zero refuses usage past it
+	OverageLimit int             `json:"overage_limit"` // Units past the limit allowed per billing cycle; 0 is no cap
 }
 
 func CreateAddon(c *gin.Context) {
@@ -91,11 +97,13 @@ func CreateAddon(c *gin.Context) {
 		Photo:        imagesJSON,
 		Category:     req.Category,
 		PricingType:  req.PricingType,
-		BasePrice:    req.BasePrice,
+		BasePrice:    money.Round(req.BasePrice),
 		Currency:     req.Currency,
 		BillingCycle: req.BillingCycle,
 		UsageUnit:    req.UsageUnit,
 		Features:     string(featuresJSON),
+		OveragePrice: money.Round(req.OveragePrice),
+		OverageLimit: req.OverageLimit,
 		IsActive:     true,
 	}
 
@@ -189,12 +197,12 @@ func GetAddon(c *gin.Context) {
 // ========== PRICING TIER CONTROLLERS ==========
 
 type CreatePricingTierRequest struct {
-	AddonID       uint    `json:"addon_id" binding:"required"`
-	MinQuantity   int     `json:"min_quantity" binding:"required"`
-	MaxQuantity   int     `json:"max_quantity"`
-	DiscountType  string  `json:"discount_type" binding:"required,oneof=percentage fixed"`
-	DiscountValue float64 `json:"discount_value" binding:"required"`
-	Description   string  `json:"description"`
+	AddonID       uint            `json:"addon_id" binding:"required"`
+	MinQuantity   int             `json:"min_quantity" binding:"required"`
+	MaxQuantity   int             `json:"max_quantity"`
+	DiscountType  string          `json:"discount_type" binding:"required,oneof=percentage fixed"`
+	DiscountValue decimal.Decimal `json:"discount_value" binding:"required"`
+	Description   string          `json:"description"`
 }
 
 func CreatePricingTier(c *gin.Context) {
@@ -223,9 +231,9 @@ func CreatePricingTier(c *gin.Context) {
 	// Calculate final price
 	finalPrice := addon.BasePrice
 	if req.DiscountType == "percentage" {
-		finalPrice = addon.BasePrice * (1 - req.DiscountValue/100)
+		finalPrice = addon.BasePrice.Sub(money.Percent(addon.BasePrice, req.DiscountValue.InexactFloat64()))
 	} else {
-		finalPrice = addon.BasePrice - req.DiscountValue
+		finalPrice = money.Round(addon.BasePrice.Sub(req.DiscountValue))
 	}
 
 	tier := dbmodels.AddonPricingTier{
@@ -255,7 +263,7 @@ type SubscribeAddonRequest struct {
 	AddonID       uint   `json:"addon_id" binding:"required"`
 	PricingTierID *uint  `json:"pricing_tier_id"` // Optional, for discounted pricing
 	Quantity      int    `json:"quantity" binding:"required,min=1"`
-	PaymentMethod string `json:"payment_method" binding:"required,oneof=fawry paymob"`
+	PaymentMethod string `json:"payment_method" binding:"required"` // Gateway name, e.g. fawry, paymob or sandbox, bank_transfer or instapay, or wallet
 }
 
 // SubscribeToAddon godoc
@@ -281,6 +289,10 @@ func SubscribeToAddon(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := checkPaymentMethodOrWallet(req.PaymentMethod); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Get addon details
 	addon, err := globalStore.StStore.GetAddon(req.AddonID)
@@ -295,7 +307,7 @@ func SubscribeToAddon(c *gin.Context) {
 	}
 
 	// Calculate total price
-	var totalPrice float64
+	var totalPrice decimal.Decimal
 	var pricingTier *dbmodels.AddonPricingTier
 
 	if req.PricingTierID != nil {
@@ -320,32 +332,41 @@ func SubscribeToAddon(c *gin.Context) {
 			return
 		}
 
-		totalPrice = pricingTier.FinalPrice * float64(req.Quantity)
+		totalPrice = money.Multiply(pricingTier.FinalPrice, req.Quantity)
 	} else {
-		totalPrice = addon.BasePrice * float64(req.Quantity)
+		totalPrice = money.Multiply(addon.BasePrice, req.Quantity)
 	}
 
-	// Create payment record
-	payment := &dbmodels.Payment{
-		UserID:        claims.UserID,
-		PackageID:     1, // Use a default package or create addon-specific payment type
-		Amount:        totalPrice,
-		Currency:      addon.Currency,
-		PaymentMethod: req.PaymentMethod,
-		PaymentStatus: dbmodels.PaymentStatus_PENDING,
+	// Add-ons are charged in the platform currency
+	currency := globalStore.Config.GetBaseCurrency()
+	if addon.Currency != "" && addon.Currency != currency {
+		rate, err := globalStore.StStore.GetExchangeRate(addon.Currency, currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		totalPrice = money.Convert(totalPrice, rate)
 	}
 
-	if err := globalStore.StStore.CreatePayment(payment); err != nil {
+	// Create payment record; the subscription is activated when it is paid
+	expiresAt := time.Now().Add(24 * time.Hour)
+	paymentdb := &dbmodels.Payment{
+		UserID:          claims.UserID,
+		Purpose:         dbmodels.PaymentPurpose_ADDON_SUBSCRIPTION,
+		Amount:          totalPrice,
+		Currency:        currency,
+		PaymentMethod:   req.PaymentMethod,
+		PaymentStatus:   dbmodels.PaymentStatus_PENDING,
+		ReferenceNumber: payment.NewReference(fmt.Sprintf("ADD-%d", claims.UserID)),
+		ExpiresAt:       &expiresAt,
+	}
+
+	if err := globalStore.StStore.CreatePayment(paymentdb); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
 		return
 	}
 
-	// NEW: Send notification
-	if addon != nil && globalStore.NotifService != nil {
-		endDate := time.Now().AddDate(0, 0, addon.BillingCycle*req.Quantity)
-		go globalStore.NotifService.NotifyAddonSubscription(claims.UserID, addon.Title, endDate)
-	}
-	// Create subscription
+	// Create subscription; its period starts once the payment is confirmed
 	subscription := &dbmodels.UserAddonSubscription{
 		UserID:        claims.UserID,
 		AddonID:       req.AddonID,
@@ -354,14 +375,11 @@ func SubscribeToAddon(c *gin.Context) {
 		Quantity:      req.Quantity,
 		TotalPrice:    totalPrice,
 		StartDate:     time.Now(),
-		PaymentID:     &payment.ID,
+		PaymentID:     &paymentdb.ID,
 	}
 
-	// Set end date or usage limit based on addon type
-	if addon.PricingType == "time" {
-		endDate := time.Now().AddDate(0, 0, addon.BillingCycle*req.Quantity)
-		subscription.EndDate = &endDate
-	} else if addon.PricingType == "usage" {
+	// Usage-based add-ons are limited by the units bought
+	if addon.PricingType == "usage" {
 		usageLimit := req.Quantity
 		subscription.UsageLimit = &usageLimit
 	}
@@ -371,11 +389,71 @@ func SubscribeToAddon(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	response := gin.H{
 		"subscription": subscription,
-		"payment":      payment,
-		"message":      "Subscription created. Please complete payment.",
-	})
+		"payment":      paymentdb,
+		"expires_at":   &expiresAt,
+	}
+
+	if totalPrice.IsPositive() && req.PaymentMethod == dbmodels.WalletPaymentMethod {
+		if _, err := payFromWallet(paymentdb, claims.UserID); err != nil {
+			c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+			return
+		}
+		if activated, err := globalStore.StStore.GetAddonSubscription(subscription.ID); err == nil {
+			response["subscription"] = activated
+		}
+		response["message"] = "Add-on activated (paid from wallet)"
+	} else if totalPrice.IsPositive() {
+		customer := payment.Customer{Email: claims.Email}
+		if user, err := globalStore.StStore.GetUser(claims.UserID); err == nil {
+			customer = payment.Customer{Name: user.Name, Email: user.Email, Phone: user.Phone}
+		}
+		result, err := startGatewayPayment(c.Request.Context(), paymentdb, payment.InitiateRequest{
+			Description: fmt.Sprintf("Add-on: %s", addon.Title),
+			Customer:    customer,
+			Items: []payment.Item{{
+				ID:          fmt.Sprintf("ADD-%d", addon.ID),
+				Name:        fmt.Sprintf("%s x %d", addon.Title, req.Quantity),
+				Description: addon.Description,
+				Price:       totalPrice,
+				Quantity:    1,
+			}},
+		})
+		if err != nil {
+			c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+			return
+		}
+		response["payment_url"] = result.PaymentURL
+		response["reference_number"] = result.ReferenceNumber
+		response["message"] = result.Message
+		response["expires_at"] = paymentdb.ExpiresAt
+	} else {
+		// Free add-ons are activated immediately
+		if _, err := applyPaymentResult(paymentdb, dbmodels.PaymentStatus_PAID, "NO_PAYMENT_REQUIRED", 0); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if activated, err := globalStore.StStore.GetAddonSubscription(subscription.ID); err == nil {
+			response["subscription"] = activated
+		}
+		response["message"] = "Add-on activated (no payment required)"
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// notifyAddonActivated tells the user an add-on subscription they paid for is active
+func notifyAddonActivated(subscriptionID uint) {
+	subscription, err := globalStore.StStore.GetAddonSubscription(subscriptionID)
+	if err != nil || subscription.Status != dbmodels.AddonSubscriptionStatus_ACTIVE || globalStore.NotifService == nil {
+		return
+	}
+	expiry := time.Time{}
+	if subscription.EndDate != nil {
+		expiry = *subscription.EndDate
+	}
+	go globalStore.NotifService.NotifyAddonSubscription(subscription.UserID, subscription.Addon.Title, expiry)
 }
 
 // GetUserSubscriptions godoc
@@ -489,7 +567,8 @@ func CancelSubscription(c *gin.Context) {
 	})
 }
 
-// LogUsage logs usage for usage-based addons
+// LogUsage logs usage for usage-based addons. Usage past the quota is refused
+// with 402 or 429 and the remaining quota.
 func LogUsage(c *gin.Context) {
 	claims, err := utils.GetclamsFromContext(c)
 	if err != nil {
@@ -526,40 +605,169 @@ func LogUsage(c *gin.Context) {
 		return
 	}
 
-	// Check if subscription is active
-	if subscription.Status != dbmodels.AddonSubscriptionStatus_ACTIVE {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Subscription is not active"})
+	// Reserved against the usage limit and the overage allowed this period
+	metadataJSON, _ := json.Marshal(req.Metadata)
+	usageLog, quota, err := globalStore.StStore.ReserveAddonUsage(subscription.ID, req.UsageAmount, req.Description, string(metadataJSON))
+	if err != nil {
+		respondQuotaError(c, err, quota)
 		return
 	}
 
-	// Check usage limit
-	if subscription.UsageLimit != nil {
-		if subscription.UsageCount+req.UsageAmount > *subscription.UsageLimit {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Usage limit exceeded"})
-			return
+	c.JSON(http.StatusCreated, gin.H{
+		"usage_log": usageLog,
+		"quota":     quota,
+		"message":   "Usage logged successfully",
+	})
+}
+
+// respondQuotaError writes a refused usage reservation: 402 when the usage limit
+// is reached, 429 when the overage allowed this period is used up, with the
+// remaining quota
+func respondQuotaError(c *gin.Context, err error, quota *stores.UsageQuota) {
+	customErr, ok := err.(*stores.CustomError)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := gin.H{"error": customErr.Message}
+	if quota != nil {
+		response["quota"] = quota
+		if customErr.Code == http.StatusTooManyRequests {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(quota.PeriodEnd).Seconds())+1))
 		}
 	}
+	c.JSON(customErr.Code, response)
+}
 
-	// Create usage log
-	metadataJSON, _ := json.Marshal(req.Metadata)
-	usageLog := &dbmodels.AddonUsageLog{
-		SubscriptionID: subscription.ID,
-		UsageAmount:    req.UsageAmount,
-		Description:    req.Description,
-		Metadata:       string(metadataJSON),
+// GetUsageQuota godoc
+// @Summary      Get a subscription's usage quota
+// @Description  Units used and left within the usage limit, and the overage used and allowed in the current billing period
+// @Tags         Add-on Subscriptions
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Subscription ID"
+// @Success      200 {object} stores.UsageQuota "Quota"
+// @Failure      404 {object} map[string]interface{} "Subscription not found"
+// @Router       /subscriptions/{id}/quota [get]
+func GetUsageQuota(c *gin.Context) {
+	subscription, ok := loadOwnAddonSubscription(c)
+	if !ok {
+		return
 	}
 
-	if err := globalStore.StStore.LogAddonUsage(usageLog); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log usage"})
+	quota, err := globalStore.StStore.GetUsageQuota(subscription.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, quota)
+}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"usage_log": usageLog,
-		"message":   "Usage logged successfully",
+// ReleaseUsage godoc
+// @Summary      Release reserved usage (Admin)
+// @Description  Gives back the units of a usage log, e.g. when the work they were reserved for failed. Usage of a billed period cannot be released. Subscribers cannot release their own usage, as that would reset their quota and overage.
+// @Tags         Add-on Subscriptions
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Subscription ID"
+// @Param        log_id path int true "Usage log ID"
+// @Success      200 {object} stores.UsageQuota "Quota after the release"
+// @Failure      409 {object} map[string]interface{} "Period already billed"
+// @Router       /admin/addon-subscriptions/{id}/usage/{log_id} [delete]
+func ReleaseUsage(c *gin.Context) {
+	subscription, ok := loadOwnAddonSubscription(c)
+	if !ok {
+		return
+	}
+
+	logID, err := strconv.ParseUint(c.Param("log_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid usage log ID"})
+		return
+	}
+	usageLog, err := globalStore.StStore.GetAddonUsageLog(uint(logID))
+	if err != nil || usageLog.SubscriptionID != subscription.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usage log not found"})
+		return
+	}
+
+	if err := globalStore.StStore.ReleaseAddonUsage(usageLog.ID); err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+
+	quota, _ := globalStore.StStore.GetUsageQuota(subscription.ID)
+	c.JSON(http.StatusOK, quota)
+}
+
+// GetUsagePeriods godoc
+// @Summary      Get usage summaries
+// @Description  Units used and overage charged per billing period, newest first. Overage of ended periods is billed with the next package renewal invoice.
+// @Tags         Add-on Subscriptions
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Subscription ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Usage periods"
+// @Router       /subscriptions/{id}/usage-periods [get]
+func GetUsagePeriods(c *gin.Context) {
+	subscription, ok := loadOwnAddonSubscription(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	periods, total, err := globalStore.StStore.GetUsagePeriods(subscription.ID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"periods":     periods,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (int(total) + limit - 1) / limit,
 	})
 }
 
+// loadOwnAddonSubscription loads the subscription in the :id path parameter when
+// it belongs to the user or the user is an admin, writing the error response otherwise
+func loadOwnAddonSubscription(c *gin.Context) (*dbmodels.UserAddonSubscription, bool) {
+	claims, err := utils.GetclamsFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return nil, false
+	}
+
+	subscription, err := globalStore.StStore.GetAddonSubscription(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return nil, false
+	}
+	if subscription.UserID != claims.UserID && claims.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return subscription, true
+}
+
 // GetUsageLogs returns usage logs for a subscription
 func GetUsageLogs(c *gin.Context) {
 	claims, err := utils.GetclamsFromContext(c)
@@ -615,7 +823,7 @@ func convertAddnToResponse(ctx context.Context, photoService *db.PhotoSrv, addon
 	for _, url := range photoURLs {
 		base64Photo, err := downloadPhotoAsBase64(ctx, photoService, url)
 		if err != nil {
-			fmt.Println("Warning: Failed to convert photo to base64: %v\n", err)
+			fmt.Printf("Warning: Failed to convert photo to base64: %v\n", err)
 			continue
 		}
 		base64Photos = base64Photo
@@ -629,7 +837,7 @@ func convertAddnToResponse(ctx context.Context, photoService *db.PhotoSrv, addon
 	for _, url := range logoURLs {
 		base64Photo, err := downloadPhotoAsBase64(ctx, photoService, url)
 		if err != nil {
-			fmt.Println("Warning: Failed to convert photo to base64: %v\n", err)
+			fmt.Printf("Warning: Failed to convert photo to base64: %v\n", err)
 			continue
 		}
 		base64Logo = base64Photo
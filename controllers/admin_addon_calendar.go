@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mohammedrefaat/hamber/money"
 	"github.com/mohammedrefaat/hamber/utils"
 )
 
@@ -49,12 +50,15 @@ func UpdateAddon(c *gin.Context) {
 	addon.Photo = req.Photo
 	addon.Category = req.Category
 	addon.PricingType = req.PricingType
-	addon.BasePrice = req.BasePrice
+	addon.BasePrice = money.Round(req.BasePrice)
 	if req.Currency != "" {
 		addon.Currency = req.Currency
 	}
 	addon.BillingCycle = req.BillingCycle
 	addon.UsageUnit = req.UsageUnit
+	// A new overage price applies from the next usage period
+	addon.OveragePrice = money.Round(req.OveragePrice)
+	addon.OverageLimit = req.OverageLimit
 
 	if len(req.Features) > 0 {
 		featuresJSON, _ := json.Marshal(req.Features)
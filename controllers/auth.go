@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 
@@ -8,7 +9,12 @@ import (
 	config "github.com/mohammedrefaat/hamber/Config"
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
 	db "github.com/mohammedrefaat/hamber/Db"
+	"github.com/mohammedrefaat/hamber/billing"
+	"github.com/mohammedrefaat/hamber/einvoice"
 	"github.com/mohammedrefaat/hamber/notification"
+	"github.com/mohammedrefaat/hamber/payment"
+	"github.com/mohammedrefaat/hamber/receipts"
+	"github.com/mohammedrefaat/hamber/shipping"
 	"github.com/mohammedrefaat/hamber/stores"
 	"github.com/mohammedrefaat/hamber/utils"
 )
@@ -21,6 +27,13 @@ type GlobalService struct {
 	Config       *config.Config
 	PhotoSrv     *db.PhotoSrv
 	NotifService *notification.NotificationService
+	EmailService *notification.EmailService
+	Shipping     *shipping.Tracker
+	Receipts     *receipts.Service
+	EInvoices    *einvoice.Service
+	Payments     *payment.Registry
+	Reconciler   *payment.Reconciler
+	Renewals     *billing.Renewals
 }
 
 // SetStore initializes the global store
@@ -103,6 +116,8 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	mergeGuestCart(c, user.ID)
+
 	c.JSON(http.StatusOK, AuthResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
@@ -182,6 +197,8 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	mergeGuestCart(c, user.ID)
+
 	c.JSON(http.StatusCreated, AuthResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
@@ -189,6 +206,20 @@ func Register(c *gin.Context) {
 	})
 }
 
+// mergeGuestCart moves the shopper's guest cart (X-Session-ID) into their account
+func mergeGuestCart(c *gin.Context, userID uint) {
+	sessionID := c.GetHeader("X-Session-ID")
+	if sessionID == "" {
+		return
+	}
+	if err := globalStore.StStore.MigrateGuestCart(sessionID, userID); err != nil {
+		log.Printf("Failed to merge guest cart for user %d: %v", userID, err)
+	}
+	if err := globalStore.StStore.MigrateGuestWishlists(sessionID, userID); err != nil {
+		log.Printf("Failed to merge guest wishlists for user %d: %v", userID, err)
+	}
+}
+
 // RefreshToken godoc
 // @Summary      Refresh access token
 // @Description  Get a new access token using refresh token
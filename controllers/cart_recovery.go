@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/utils"
+	"github.com/shopspring/decimal"
+)
+
+// ========== ABANDONED CART RECOVERY ==========
+
+type CartEmailRequest struct {
+	Email string `json:"email" binding:"required,email" example:"mona@example.com"`
+}
+
+// SaveCartEmail stores a guest's email so abandoned cart reminders can reach them
+// @Summary Save guest cart email
+// @Description Attaches a contact email to a guest cart so reminder emails can be sent if the cart is abandoned
+// @Tags Shopping Cart
+// @Accept json
+// @Produce json
+// @Param X-Session-ID header string true "Guest session ID" example("guest-session-abc123")
+// @Param request body CartEmailRequest true "Contact email"
+// @Success 200 {object} map[string]string "Email saved"
+// @Failure 400 {object} map[string]string "Bad request - missing session or empty cart"
+// @Router /api/customer-website/cart/email [post]
+func SaveCartEmail(c *gin.Context) {
+	sessionID := c.GetHeader("X-Session-ID")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Session ID required for guest users"})
+		return
+	}
+
+	var req CartEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cartItems, err := globalStore.StStore.GetCart(nil, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
+	}
+	if len(cartItems) == 0 || cartItems[0].Product == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		return
+	}
+
+	recovery, err := globalStore.StStore.GetOpenCartRecovery(nil, sessionID)
+	if err != nil {
+		recovery = &dbmodels.CartRecovery{
+			SessionID:      sessionID,
+			StoreOwnerID:   cartItems[0].Product.UserID,
+			RestoreToken:   utils.GenerateToken(24),
+			Status:         dbmodels.CartRecoveryStatus_OPEN,
+			LastActivityAt: time.Now(),
+		}
+	}
+	recovery.Email = req.Email
+
+	if recovery.ID == 0 {
+		err = globalStore.StStore.CreateCartRecovery(recovery)
+	} else {
+		err = globalStore.StStore.UpdateCartRecovery(recovery)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email saved"})
+}
+
+// RestoreCart resolves a restore link from a reminder
+// @Summary Restore an abandoned cart
+// @Description Resolves the token from a cart reminder. Guests receive the session ID to continue with; any reminder coupon still usable is returned too.
+// @Tags Shopping Cart
+// @Produce json
+// @Param token path string true "Restore token from the reminder link"
+// @Success 200 {object} map[string]interface{} "Cart restored"
+// @Failure 404 {object} map[string]string "Invalid link"
+// @Router /api/customer-website/cart/restore/{token} [get]
+func RestoreCart(c *gin.Context) {
+	recovery, err := globalStore.StStore.GetCartRecoveryByToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	cartItems, err := globalStore.StStore.GetCart(recovery.UserID, recovery.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
+	}
+
+	subtotal := decimal.Zero
+	for _, item := range cartItems {
+		subtotal = subtotal.Add(money.Multiply(item.Price, item.Quantity))
+	}
+
+	response := gin.H{
+		"cart_items":     cartItems,
+		"subtotal":       subtotal,
+		"item_count":     len(cartItems),
+		"login_required": recovery.UserID != nil,
+	}
+	if recovery.UserID == nil {
+		response["session_id"] = recovery.SessionID
+	}
+	if recovery.Coupon != nil && recovery.Coupon.IsUsable(recovery.StoreOwnerID) {
+		response["coupon_code"] = recovery.Coupon.Code
+		response["discount_percent"] = recovery.Coupon.DiscountPercent
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetCartRecoveryReport godoc
+// @Summary      Get abandoned cart recovery report
+// @Description  Abandoned, reminded and recovered carts with recovered revenue for the current store
+// @Tags         Dashboard
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        days query int false "Look-back window in days" default(30)
+// @Success      200 {object} dbmodels.CartRecoveryStats "Recovery report"
+// @Failure      402 {object} map[string]interface{} "No reports add-on quota left"
+// @Failure      429 {object} map[string]interface{} "Reports add-on overage for this period used up"
+// @Router       /dashboard/cart-recovery [get]
+func GetCartRecoveryReport(c *gin.Context) {
+	claims, err := utils.GetclamsFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if days < 1 || days > 365 {
+		days = 30
+	}
+
+	stats, err := globalStore.StStore.GetCartRecoveryStats(claims.UserID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart recovery report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":  days,
+		"stats": stats,
+	})
+}
@@ -0,0 +1,782 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== CLIENT CRM ==========
+
+const maxClientImportRows = 5000
+
+type ClientRequest struct {
+	Name    string   `json:"name" binding:"required" example:"Mona Ahmed"`
+	Email   string   `json:"email" binding:"required,email" example:"mona@example.com"`
+	Phone   string   `json:"phone" example:"+201001234567"`
+	Address string   `json:"address" example:"12 Tahrir St, Cairo"`
+	Company string   `json:"company" example:"Nile Traders"`
+	Tags    []string `json:"tags" example:"vip,wholesale"`
+}
+
+type UpdateClientRequest struct {
+	Name    string   `json:"name" example:"Mona Ahmed"`
+	Email   string   `json:"email" binding:"omitempty,email" example:"mona@example.com"`
+	Phone   *string  `json:"phone" example:"+201001234567"`
+	Address *string  `json:"address" example:"12 Tahrir St, Cairo"`
+	Company *string  `json:"company" example:"Nile Traders"`
+	Tags    []string `json:"tags" example:"vip"`
+}
+
+type ClientAddressRequest struct {
+	Label      string `json:"label" example:"home"`
+	Line1      string `json:"line1" binding:"required" example:"12 Tahrir St"`
+	Line2      string `json:"line2" example:"Apartment 4"`
+	City       string `json:"city" example:"Cairo"`
+	State      string `json:"state" example:"Cairo"`
+	PostalCode string `json:"postal_code" example:"11511"`
+	Country    string `json:"country" example:"Egypt"`
+	IsDefault  bool   `json:"is_default" example:"true"`
+}
+
+type ClientNoteRequest struct {
+	Body string `json:"body" binding:"required" example:"Prefers delivery after 5pm"`
+}
+
+type MergeClientsRequest struct {
+	PrimaryID    uint   `json:"primary_id" binding:"required" example:"3"`
+	DuplicateIDs []uint `json:"duplicate_ids" binding:"required,min=1" example:"7,9"`
+}
+
+type ClientImportResult struct {
+	Created int      `json:"created"`
+	Updated int      `json:"updated"`
+	Skipped int      `json:"skipped"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// loadStoreClient fetches the :id client of the current store owner
+func loadStoreClient(c *gin.Context) (*dbmodels.Client, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return nil, false
+	}
+
+	client, err := globalStore.StStore.GetStoreClient(uint(id), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		return nil, false
+	}
+	return client, true
+}
+
+func respondClientError(c *gin.Context, err error, fallback string) {
+	if customErr, ok := err.(*stores.CustomError); ok {
+		c.JSON(customErr.Code, gin.H{"error": customErr.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+}
+
+func encodeTags(tags []string) string {
+	return stores.MergeTags("[]", mustJSON(tags))
+}
+
+func mustJSON(v interface{}) string {
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+// GetClients godoc
+// @Summary      Search clients
+// @Description  Lists the store's clients with lifetime value, order count and last-order date
+// @Tags         Clients
+// @Produce      json
+// @Security     Bearer
+// @Param        q query string false "Search name, email, phone or company"
+// @Param        tag query string false "Only clients with this tag"
+// @Param        sort query string false "newest, name, lifetime_value, order_count or last_order" default(newest)
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Clients"
+// @Router       /clients [get]
+func GetClients(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	clients, total, err := globalStore.StStore.SearchClients(userID, strings.TrimSpace(c.Query("q")), c.Query("tag"), c.DefaultQuery("sort", "newest"), page, limit)
+	if err != nil {
+		respondClientError(c, err, "Failed to fetch clients")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"clients":     clients,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (int(total) + limit - 1) / limit,
+	})
+}
+
+// CreateClient godoc
+// @Summary      Create client
+// @Tags         Clients
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body ClientRequest true "Client details"
+// @Success      201 {object} map[string]interface{} "Client created"
+// @Failure      409 {object} map[string]interface{} "Email already used by another client"
+// @Failure      402 {object} map[string]interface{} "Upgrade required"
+// @Router       /clients [post]
+func CreateClient(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !requireEntitlement(c, userID, dbmodels.Entitlement_CLIENTS, 1) {
+		return
+	}
+
+	client := &dbmodels.Client{
+		Name:    req.Name,
+		Email:   req.Email,
+		Phone:   req.Phone,
+		Address: req.Address,
+		Company: req.Company,
+		Tags:    encodeTags(req.Tags),
+		UserID:  userID,
+	}
+	if err := globalStore.StStore.CreateClient(client); err != nil {
+		respondClientError(c, err, "Failed to create client")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Client created successfully",
+		"client":  client,
+	})
+}
+
+// GetClient godoc
+// @Summary      Get client profile
+// @Description  Client details, addresses, notes and computed order metrics
+// @Tags         Clients
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Client ID"
+// @Success      200 {object} map[string]interface{} "Client profile"
+// @Failure      404 {object} map[string]interface{} "Client not found"
+// @Router       /clients/{id} [get]
+func GetClient(c *gin.Context) {
+	client, ok := loadStoreClient(c)
+	if !ok {
+		return
+	}
+
+	metrics, err := globalStore.StStore.GetClientMetrics(client.ID)
+	if err != nil {
+		respondClientError(c, err, "Failed to compute client metrics")
+		return
+	}
+	notes, err := globalStore.StStore.GetClientNotes(client.ID)
+	if err != nil {
+		respondClientError(c, err, "Failed to fetch notes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"client":  client,
+		"metrics": metrics,
+		"notes":   notes,
+	})
+}
+
+// UpdateClient godoc
+// @Summary      Update client
+// @Tags         Clients
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Client ID"
+// @Param        request body UpdateClientRequest true "Fields to update"
+// @Success      200 {object} map[string]interface{} "Client updated"
+// @Router       /clients/{id} [put]
+func UpdateClient(c *gin.Context) {
+	client, ok := loadStoreClient(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Email != "" && !strings.EqualFold(req.Email, client.Email) {
+		existing, err := globalStore.StStore.GetClientByEmail(client.UserID, req.Email)
+		if err != nil {
+			respondClientError(c, err, "Failed to update client")
+			return
+		}
+		if existing != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "A client with this email already exists"})
+			return
+		}
+		client.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	}
+	if req.Name != "" {
+		client.Name = req.Name
+	}
+	if req.Phone != nil {
+		client.Phone = *req.Phone
+	}
+	if req.Address != nil {
+		client.Address = *req.Address
+	}
+	if req.Company != nil {
+		client.Company = *req.Company
+	}
+	if req.Tags != nil {
+		client.Tags = encodeTags(req.Tags)
+	}
+
+	if err := globalStore.StStore.UpdateClient(client); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update client"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Client updated successfully",
+		"client":  client,
+	})
+}
+
+// DeleteClient godoc
+// @Summary      Delete client
+// @Description  Deletes a client that has no orders
+// @Tags         Clients
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Client ID"
+// @Success      200 {object} map[string]interface{} "Client deleted"
+// @Failure      409 {object} map[string]interface{} "Client has orders"
+// @Router       /clients/{id} [delete]
+func DeleteClient(c *gin.Context) {
+	client, ok := loadStoreClient(c)
+	if !ok {
+		return
+	}
+
+	if err := globalStore.StStore.DeleteClient(client.ID); err != nil {
+		respondClientError(c, err, "Failed to delete client")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Client deleted successfully"})
+}
+
+// GetClientTimeline godoc
+// @Summary      Client timeline
+// @Description  Orders, receipts, messages and notes of a client, newest first
+// @Tags         Clients
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Client ID"
+// @Param        limit query int false "Maximum number of entries" default(50)
+// @Success      200 {object} map[string]interface{} "Timeline"
+// @Router       /clients/{id}/timeline [get]
+func GetClientTimeline(c *gin.Context) {
+	client, ok := loadStoreClient(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	timeline, err := globalStore.StStore.GetClientTimeline(client, limit)
+	if err != nil {
+		respondClientError(c, err, "Failed to fetch timeline")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"client_id": client.ID,
+		"timeline":  timeline,
+	})
+}
+
+// AddClientNote godoc
+// @Summary      Add client note
+// @Tags         Clients
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Client ID"
+// @Param        request body ClientNoteRequest true "Note"
+// @Success      201 {object} map[string]interface{} "Note added"
+// @Router       /clients/{id}/notes [post]
+func AddClientNote(c *gin.Context) {
+	client, ok := loadStoreClient(c)
+	if !ok {
+		return
+	}
+
+	var req ClientNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	note := &dbmodels.ClientNote{
+		ClientID: client.ID,
+		AuthorID: client.UserID,
+		Body:     req.Body,
+	}
+	if err := globalStore.StStore.CreateClientNote(note); err != nil {
+		respondClientError(c, err, "Failed to add note")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Note added",
+		"note":    note,
+	})
+}
+
+// DeleteClientNote godoc
+// @Summary      Delete client note
+// @Tags         Clients
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Client ID"
+// @Param        note_id path int true "Note ID"
+// @Success      200 {object} map[string]interface{} "Note deleted"
+// @Router       /clients/{id}/notes/{note_id} [delete]
+func DeleteClientNote(c *gin.Context) {
+	client, ok := loadStoreClient(c)
+	if !ok {
+		return
+	}
+
+	noteID, err := strconv.ParseUint(c.Param("note_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
+
+	if err := globalStore.StStore.DeleteClientNote(uint(noteID), client.ID); err != nil {
+		respondClientError(c, err, "Failed to delete note")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Note deleted"})
+}
+
+// AddClientAddress godoc
+// @Summary      Add client address
+// @Tags         Clients
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Client ID"
+// @Param        request body ClientAddressRequest true "Address"
+// @Success      201 {object} map[string]interface{} "Address added"
+// @Router       /clients/{id}/addresses [post]
+func AddClientAddress(c *gin.Context) {
+	client, ok := loadStoreClient(c)
+	if !ok {
+		return
+	}
+
+	var req ClientAddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	address := &dbmodels.ClientAddress{ClientID: client.ID}
+	applyClientAddress(address, &req)
+	// The first address becomes the default
+	if len(client.Addresses) == 0 {
+		address.IsDefault = true
+	}
+
+	if err := globalStore.StStore.SaveClientAddress(address); err != nil {
+		respondClientError(c, err, "Failed to save address")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Address added",
+		"address": address,
+	})
+}
+
+// UpdateClientAddress godoc
+// @Summary      Update client address
+// @Tags         Clients
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Client ID"
+// @Param        address_id path int true "Address ID"
+// @Param        request body ClientAddressRequest true "Address"
+// @Success      200 {object} map[string]interface{} "Address updated"
+// @Router       /clients/{id}/addresses/{address_id} [put]
+func UpdateClientAddress(c *gin.Context) {
+	address, ok := loadClientAddress(c)
+	if !ok {
+		return
+	}
+
+	var req ClientAddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	applyClientAddress(address, &req)
+
+	if err := globalStore.StStore.SaveClientAddress(address); err != nil {
+		respondClientError(c, err, "Failed to save address")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Address updated",
+		"address": address,
+	})
+}
+
+// DeleteClientAddress godoc
+// @Summary      Delete client address
+// @Tags         Clients
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Client ID"
+// @Param        address_id path int true "Address ID"
+// @Success      200 {object} map[string]interface{} "Address deleted"
+// @Router       /clients/{id}/addresses/{address_id} [delete]
+func DeleteClientAddress(c *gin.Context) {
+	address, ok := loadClientAddress(c)
+	if !ok {
+		return
+	}
+
+	if err := globalStore.StStore.DeleteClientAddress(address.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted"})
+}
+
+func loadClientAddress(c *gin.Context) (*dbmodels.ClientAddress, bool) {
+	client, ok := loadStoreClient(c)
+	if !ok {
+		return nil, false
+	}
+
+	addressID, err := strconv.ParseUint(c.Param("address_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return nil, false
+	}
+
+	address, err := globalStore.StStore.GetClientAddress(uint(addressID), client.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return nil, false
+	}
+	return address, true
+}
+
+func applyClientAddress(address *dbmodels.ClientAddress, req *ClientAddressRequest) {
+	address.Label = req.Label
+	address.Line1 = req.Line1
+	address.Line2 = req.Line2
+	address.City = req.City
+	address.State = req.State
+	address.PostalCode = req.PostalCode
+	address.Country = req.Country
+	if address.Country == "" {
+		address.Country = "Egypt"
+	}
+	address.IsDefault = req.IsDefault
+}
+
+// GetDuplicateClients godoc
+// @Summary      Find duplicate clients
+// @Description  Groups of clients sharing an email or phone number
+// @Tags         Clients
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "Duplicate groups"
+// @Router       /clients/duplicates [get]
+func GetDuplicateClients(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	groups, err := globalStore.StStore.FindDuplicateClients(userID)
+	if err != nil {
+		respondClientError(c, err, "Failed to find duplicates")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"groups": groups,
+		"count":  len(groups),
+	})
+}
+
+// MergeClients godoc
+// @Summary      Merge duplicate clients
+// @Description  Moves orders, reviews, addresses and notes of the duplicates into the primary client and deletes the duplicates
+// @Tags         Clients
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body MergeClientsRequest true "Primary and duplicate client IDs"
+// @Success      200 {object} map[string]interface{} "Clients merged"
+// @Router       /clients/merge [post]
+func MergeClients(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req MergeClientsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, id := range req.DuplicateIDs {
+		if id == req.PrimaryID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Primary client cannot also be a duplicate"})
+			return
+		}
+	}
+
+	primary, err := globalStore.StStore.GetStoreClient(req.PrimaryID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Primary client not found"})
+		return
+	}
+	duplicates, err := globalStore.StStore.GetStoreClientsByIDs(req.DuplicateIDs, userID)
+	if err != nil {
+		respondClientError(c, err, "Failed to fetch clients")
+		return
+	}
+	if len(duplicates) != len(req.DuplicateIDs) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "One or more duplicate clients not found"})
+		return
+	}
+
+	if err := globalStore.StStore.MergeClients(primary, duplicates); err != nil {
+		respondClientError(c, err, "Failed to merge clients")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Merged %d client(s)", len(duplicates)),
+		"client":  primary,
+	})
+}
+
+// ImportClients godoc
+// @Summary      Import clients from CSV
+// @Description  Upload a CSV with a header row. Recognised columns: name, email, phone, address, company, tags (separated by ;). Clients are matched on email and updated, otherwise created.
+// @Tags         Clients
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     Bearer
+// @Param        file formData file true "CSV file"
+// @Success      200 {object} ClientImportResult "Import result"
+// @Failure      402 {object} map[string]interface{} "Upgrade required"
+// @Router       /clients/import [post]
+func ImportClients(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !requireFeature(c, userID, dbmodels.Feature_CLIENT_IMPORT) {
+		return
+	}
+	room, ok := entitlementRoom(c, userID, dbmodels.Entitlement_CLIENTS)
+	if !ok {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file is required"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file is empty or invalid"})
+		return
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV must have an email column"})
+		return
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	result := ClientImportResult{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if line-1 > maxClientImportRows {
+			result.Errors = append(result.Errors, fmt.Sprintf("stopped after %d rows", maxClientImportRows))
+			break
+		}
+		if err != nil {
+			result.Skipped++
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+
+		email := field(record, "email")
+		name := field(record, "name")
+		if email == "" || !strings.Contains(email, "@") {
+			result.Skipped++
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: invalid email", line))
+			continue
+		}
+
+		var tags []string
+		if raw := field(record, "tags"); raw != "" {
+			tags = strings.Split(raw, ";")
+		}
+
+		existing, err := globalStore.StStore.GetClientByEmail(userID, email)
+		if err != nil {
+			result.Skipped++
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+
+		if existing == nil {
+			if room == 0 {
+				result.Skipped++
+				result.Errors = append(result.Errors, fmt.Sprintf("line %d: your package's client limit is reached", line))
+				continue
+			}
+			if name == "" {
+				name = email
+			}
+			client := &dbmodels.Client{
+				Name:    name,
+				Email:   email,
+				Phone:   field(record, "phone"),
+				Address: field(record, "address"),
+				Company: field(record, "company"),
+				Tags:    encodeTags(tags),
+				UserID:  userID,
+			}
+			if err := globalStore.StStore.CreateClient(client); err != nil {
+				result.Skipped++
+				result.Errors = append(result.Errors, fmt.Sprintf("line %d: %v", line, err))
+				continue
+			}
+			result.Created++
+			if room > 0 {
+				room--
+			}
+			continue
+		}
+
+		// Only non-empty values overwrite the existing client
+		if name != "" {
+			existing.Name = name
+		}
+		if phone := field(record, "phone"); phone != "" {
+			existing.Phone = phone
+		}
+		if address := field(record, "address"); address != "" {
+			existing.Address = address
+		}
+		if company := field(record, "company"); company != "" {
+			existing.Company = company
+		}
+		existing.Tags = stores.MergeTags(existing.Tags, mustJSON(tags))
+		if err := globalStore.StStore.UpdateClient(existing); err != nil {
+			result.Skipped++
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		result.Updated++
+	}
+
+	c.JSON(http.StatusOK, result)
+}
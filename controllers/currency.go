@@ -0,0 +1,578 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+	"github.com/shopspring/decimal"
+)
+
+// ========== CURRENCIES & EXCHANGE RATES ==========
+
+const maxExchangeRateImportRows = 500
+
+type ExchangeRateRequest struct {
+	BaseCurrency  string          `json:"base_currency" binding:"required" example:"EGP"`
+	QuoteCurrency string          `json:"quote_currency" binding:"required" example:"USD"`
+	Rate          decimal.Decimal `json:"rate" binding:"required" example:"0.0205"` // QuoteCurrency units per BaseCurrency unit
+}
+
+type ImportExchangeRatesRequest struct {
+	Source string                `json:"source" example:"central-bank"`
+	Rates  []ExchangeRateRequest `json:"rates" binding:"required,min=1,dive"`
+}
+
+type StoreCurrencyRequest struct {
+	Currency string `json:"currency" binding:"required" example:"EGP"`
+}
+
+type ProductPriceRequest struct {
+	Currency      string          `json:"currency" binding:"required" example:"USD"`
+	Price         decimal.Decimal `json:"price" binding:"required" example:"19.99"`
+	DiscountPrice decimal.Decimal `json:"discount_price" example:"17.99"`
+}
+
+// toExchangeRate validates a requested rate and normalizes its currency codes
+func (req ExchangeRateRequest) toExchangeRate(source string, userID uint) (*dbmodels.ExchangeRate, error) {
+	base := money.NormalizeCurrency(req.BaseCurrency)
+	quote := money.NormalizeCurrency(req.QuoteCurrency)
+	if !money.IsCurrencyCode(base) || !money.IsCurrencyCode(quote) {
+		return nil, fmt.Errorf("invalid currency pair %q/%q", req.BaseCurrency, req.QuoteCurrency)
+	}
+	if base == quote {
+		return nil, fmt.Errorf("%s/%s: currencies must differ", base, quote)
+	}
+	if !req.Rate.IsPositive() {
+		return nil, fmt.Errorf("%s/%s: rate must be positive", base, quote)
+	}
+	return &dbmodels.ExchangeRate{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		Rate:          req.Rate.Round(money.RateScale),
+		Source:        source,
+		UpdatedByID:   &userID,
+	}, nil
+}
+
+func respondCurrencyError(c *gin.Context, err error) {
+	code := http.StatusInternalServerError
+	if customErr, ok := err.(*stores.CustomError); ok {
+		code = customErr.Code
+	}
+	c.JSON(code, gin.H{"error": err.Error()})
+}
+
+// storeCurrency returns a store's base currency, falling back to the platform currency
+func storeCurrency(storeOwnerID uint) string {
+	return globalStore.StStore.GetStoreCurrency(storeOwnerID, globalStore.Config.GetBaseCurrency())
+}
+
+// GetExchangeRates godoc
+// @Summary      List exchange rates
+// @Description  Current exchange rates. Each rate is the number of quote currency units one base currency unit buys.
+// @Tags         Currencies
+// @Produce      json
+// @Success      200 {object} map[string]interface{} "Exchange rates"
+// @Router       /api/customer-website/exchange-rates [get]
+func GetExchangeRates(c *gin.Context) {
+	rates, err := globalStore.StStore.GetExchangeRates()
+	if err != nil {
+		respondCurrencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"platform_currency": globalStore.Config.GetBaseCurrency(),
+		"rates":             rates,
+	})
+}
+
+// SaveExchangeRate godoc
+// @Summary      Set an exchange rate (Admin)
+// @Description  Creates or replaces the rate of a currency pair. A rate stored for the opposite direction is removed.
+// @Tags         Currencies
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body ExchangeRateRequest true "Exchange rate"
+// @Success      200 {object} map[string]interface{} "Rate saved"
+// @Router       /admin/exchange-rates [put]
+func SaveExchangeRate(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ExchangeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rate, err := req.toExchangeRate("manual", userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := globalStore.StStore.SaveExchangeRate(rate); err != nil {
+		respondCurrencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Exchange rate saved",
+		"rate":    rate,
+	})
+}
+
+// ImportExchangeRates godoc
+// @Summary      Import exchange rates (Admin)
+// @Description  Replaces rates in bulk, either as JSON or as a CSV file with base_currency, quote_currency and rate columns. Nothing is saved if any row is invalid.
+// @Tags         Currencies
+// @Accept       json,mpfd
+// @Produce      json
+// @Security     Bearer
+// @Param        request body ImportExchangeRatesRequest false "Rates (JSON)"
+// @Param        file formData file false "Rates (CSV)"
+// @Param        source formData string false "Where the rates come from"
+// @Success      200 {object} map[string]interface{} "Rates imported"
+// @Failure      400 {object} map[string]interface{} "Invalid rows"
+// @Router       /admin/exchange-rates/import [post]
+func ImportExchangeRates(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ImportExchangeRatesRequest
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		req.Source = c.PostForm("source")
+		req.Rates, err = readExchangeRatesCSV(c)
+	} else {
+		err = c.ShouldBindJSON(&req)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Rates) > maxExchangeRateImportRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d rates can be imported at once", maxExchangeRateImportRows)})
+		return
+	}
+
+	source := strings.TrimSpace(req.Source)
+	if source == "" {
+		source = "import"
+	}
+
+	var problems []string
+	rates := make([]dbmodels.ExchangeRate, 0, len(req.Rates))
+	seen := map[string]bool{}
+	for i, row := range req.Rates {
+		rate, err := row.toExchangeRate(source, userID)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("row %d: %v", i+1, err))
+			continue
+		}
+		pair := rate.BaseCurrency + "/" + rate.QuoteCurrency
+		reverse := rate.QuoteCurrency + "/" + rate.BaseCurrency
+		if seen[pair] || seen[reverse] {
+			problems = append(problems, fmt.Sprintf("row %d: %s appears more than once", i+1, pair))
+			continue
+		}
+		seen[pair] = true
+		rates = append(rates, *rate)
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "No rates were imported",
+			"errors": problems,
+		})
+		return
+	}
+
+	if err := globalStore.StStore.ImportExchangeRates(rates); err != nil {
+		respondCurrencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Exchange rates imported",
+		"imported": len(rates),
+		"rates":    rates,
+	})
+}
+
+// readExchangeRatesCSV reads the uploaded "file" into rate rows
+func readExchangeRatesCSV(c *gin.Context) ([]ExchangeRateRequest, error) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("CSV file is required")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file")
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CSV file is empty or invalid")
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range []string{"base_currency", "quote_currency", "rate"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV must have base_currency, quote_currency and rate columns")
+		}
+	}
+
+	var rows []ExchangeRateRequest
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rate, err := decimal.NewFromString(strings.TrimSpace(record[columns["rate"]]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[columns["rate"]])
+		}
+		rows = append(rows, ExchangeRateRequest{
+			BaseCurrency:  record[columns["base_currency"]],
+			QuoteCurrency: record[columns["quote_currency"]],
+			Rate:          rate,
+		})
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("CSV file has no rates")
+	}
+	return rows, nil
+}
+
+// DeleteExchangeRate godoc
+// @Summary      Delete an exchange rate (Admin)
+// @Tags         Currencies
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Exchange rate ID"
+// @Success      200 {object} map[string]interface{} "Rate deleted"
+// @Router       /admin/exchange-rates/{id} [delete]
+func DeleteExchangeRate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exchange rate ID"})
+		return
+	}
+
+	if err := globalStore.StStore.DeleteExchangeRate(uint(id)); err != nil {
+		respondCurrencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate deleted"})
+}
+
+// GetStoreCurrency godoc
+// @Summary      Get store currency
+// @Description  The currency product prices and dashboard revenue are expressed in
+// @Tags         Currencies
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "Store currency"
+// @Router       /profile/currency [get]
+func GetStoreCurrency(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency":          storeCurrency(userID),
+		"platform_currency": globalStore.Config.GetBaseCurrency(),
+	})
+}
+
+// UpdateStoreCurrency godoc
+// @Summary      Set store currency
+// @Description  Sets the store base currency. Existing product prices are not converted; past orders keep the currency they were placed in.
+// @Tags         Currencies
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body StoreCurrencyRequest true "Currency"
+// @Success      200 {object} map[string]interface{} "Currency updated"
+// @Router       /profile/currency [put]
+func UpdateStoreCurrency(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req StoreCurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency := money.NormalizeCurrency(req.Currency)
+	if !money.IsCurrencyCode(currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency must be a three-letter ISO code"})
+		return
+	}
+	// Revenue must stay convertible for platform reports
+	if _, err := globalStore.StStore.GetExchangeRate(currency, globalStore.Config.GetBaseCurrency()); err != nil {
+		respondCurrencyError(c, err)
+		return
+	}
+
+	if err := globalStore.StStore.UpdateStoreCurrency(userID, currency); err != nil {
+		respondCurrencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Store currency updated",
+		"currency": currency,
+	})
+}
+
+// loadOwnedProduct loads a product of the signed-in store owner
+func loadOwnedProduct(c *gin.Context) (*dbmodels.Product, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return nil, false
+	}
+
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	product, err := globalStore.StStore.GetProduct(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return nil, false
+	}
+	if product.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to manage this product"})
+		return nil, false
+	}
+	return product, true
+}
+
+// GetProductPrices godoc
+// @Summary      Get product price list
+// @Description  Fixed prices of a product in other currencies
+// @Tags         Products
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Product ID"
+// @Success      200 {object} map[string]interface{} "Price list"
+// @Router       /products/{id}/prices [get]
+func GetProductPrices(c *gin.Context) {
+	product, ok := loadOwnedProduct(c)
+	if !ok {
+		return
+	}
+
+	prices, err := globalStore.StStore.GetProductPrices(product.ID)
+	if err != nil {
+		respondCurrencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency": storeCurrency(product.UserID),
+		"price":    product.Price,
+		"prices":   prices,
+	})
+}
+
+// SaveProductPrice godoc
+// @Summary      Set product price in a currency
+// @Description  Fixes the product price in a currency instead of converting it with the exchange rate
+// @Tags         Products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Product ID"
+// @Param        request body ProductPriceRequest true "Price"
+// @Success      200 {object} map[string]interface{} "Price saved"
+// @Failure      402 {object} map[string]interface{} "Upgrade required"
+// @Router       /products/{id}/prices [put]
+func SaveProductPrice(c *gin.Context) {
+	product, ok := loadOwnedProduct(c)
+	if !ok || !requireFeature(c, product.UserID, dbmodels.Feature_MULTI_CURRENCY) {
+		return
+	}
+
+	var req ProductPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency := money.NormalizeCurrency(req.Currency)
+	if !money.IsCurrencyCode(currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency must be a three-letter ISO code"})
+		return
+	}
+	if currency == storeCurrency(product.UserID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use the product price for the store currency"})
+		return
+	}
+	if !req.Price.IsPositive() || req.DiscountPrice.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price must be positive and discount_price not negative"})
+		return
+	}
+
+	price := &dbmodels.ProductPrice{
+		ProductID:     product.ID,
+		Currency:      currency,
+		Price:         money.Round(req.Price),
+		DiscountPrice: money.Round(req.DiscountPrice),
+	}
+	if err := globalStore.StStore.SaveProductPrice(price); err != nil {
+		respondCurrencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Price saved",
+		"price":   price,
+	})
+}
+
+// DeleteProductPrice godoc
+// @Summary      Remove product price in a currency
+// @Description  The product price in that currency is converted with the exchange rate again
+// @Tags         Products
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Product ID"
+// @Param        currency path string true "Currency code"
+// @Success      200 {object} map[string]interface{} "Price removed"
+// @Router       /products/{id}/prices/{currency} [delete]
+func DeleteProductPrice(c *gin.Context) {
+	product, ok := loadOwnedProduct(c)
+	if !ok {
+		return
+	}
+
+	if err := globalStore.StStore.DeleteProductPrice(product.ID, money.NormalizeCurrency(c.Param("currency"))); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove price"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price removed"})
+}
+
+// GetProductPriceQuotes godoc
+// @Summary      Get product prices in a currency
+// @Description  Prices for the storefront in the shopper's currency, from the store's price list or converted with the current exchange rate
+// @Tags         Currencies
+// @Produce      json
+// @Param        ids query string true "Comma-separated product IDs" example("1,2,3")
+// @Param        currency query string true "Currency code" example("USD")
+// @Success      200 {object} map[string]interface{} "Price quotes"
+// @Failure      400 {object} map[string]interface{} "Unknown currency"
+// @Router       /api/customer-website/prices [get]
+func GetProductPriceQuotes(c *gin.Context) {
+	currency := money.NormalizeCurrency(c.Query("currency"))
+	if !money.IsCurrencyCode(currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency must be a three-letter ISO code"})
+		return
+	}
+
+	var ids []uint
+	for _, part := range strings.Split(c.Query("ids"), ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	if len(ids) == 0 || len(ids) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids must list between 1 and 100 product IDs"})
+		return
+	}
+
+	products, err := globalStore.StStore.GetActiveProductsByIDs(ids)
+	if err != nil {
+		respondCurrencyError(c, err)
+		return
+	}
+
+	// Products may come from several stores, each with its own currency
+	byStore := map[uint][]dbmodels.Product{}
+	for _, product := range products {
+		byStore[product.UserID] = append(byStore[product.UserID], product)
+	}
+
+	quotes := make([]dbmodels.PriceQuote, 0, len(products))
+	for ownerID, storeProducts := range byStore {
+		storeQuotes, err := globalStore.StStore.QuoteProducts(storeProducts, storeCurrency(ownerID), currency)
+		if err != nil {
+			respondCurrencyError(c, err)
+			return
+		}
+		quotes = append(quotes, storeQuotes...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency": currency,
+		"prices":   quotes,
+	})
+}
+
+// priceCartInCurrency prices cart items in the shopper's currency. Items with a listed price use it;
+// the others convert their cart price with rate (currency units per store currency unit).
+func priceCartInCurrency(cartItems []*dbmodels.CartItem, baseCurrency, currency string, rate decimal.Decimal) ([]decimal.Decimal, error) {
+	prices := make([]decimal.Decimal, len(cartItems))
+	if currency == baseCurrency {
+		for i, item := range cartItems {
+			prices[i] = item.Price
+		}
+		return prices, nil
+	}
+
+	ids := make([]uint, 0, len(cartItems))
+	for _, item := range cartItems {
+		ids = append(ids, item.ProductID)
+	}
+	listed, err := globalStore.StStore.GetPriceList(ids, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, item := range cartItems {
+		if price, ok := listed[item.ProductID]; ok {
+			prices[i] = price.EffectivePrice()
+		} else {
+			prices[i] = money.Convert(item.Price, rate)
+		}
+	}
+	return prices, nil
+}
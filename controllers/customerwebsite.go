@@ -2,24 +2,29 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/stores"
 	"github.com/mohammedrefaat/hamber/utils"
+	"github.com/shopspring/decimal"
 )
 
 // ========== SITE CONFIGURATION ==========
 
 type SiteConfigRequest struct {
 	SiteName string                 `json:"site_name" binding:"required" example:"my-store"`
-	SiteData map[string]interface{} `json:"site_data" binding:"required" swaggertype:"object,string" example:"{\\"theme\\":\\"dark\\",\\"logo\\":\\"https://example.com/logo.png\\"}"`
+	SiteData map[string]interface{} `json:"site_data" binding:"required" swaggertype:"object,string" example:"{\"theme\":\"dark\",\"logo\":\"https://example.com/logo.png\"}"`
 }
 
 type SiteConfigResponse struct {
 	SiteName  string                 `json:"site_name" example:"my-store"`
-	SiteData  map[string]interface{} `json:"site_data" swaggertype:"object,string" example:"{\\"theme\\":\\"dark\\",\\"logo\\":\\"https://example.com/logo.png\\"}"`
+	SiteData  map[string]interface{} `json:"site_data" swaggertype:"object,string" example:"{\"theme\":\"dark\",\"logo\":\"https://example.com/logo.png\"}"`
 	UpdatedAt time.Time              `json:"updated_at" example:"2025-11-15T17:30:00Z"`
 }
 
@@ -83,6 +88,7 @@ func GetSiteJSON(c *gin.Context) {
 // @Failure 401 {object} map[string]string "Unauthorized - missing or invalid token"
 // @Failure 403 {object} map[string]string "Forbidden - cannot update other user's site"
 // @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 402 {object} map[string]interface{} "Upgrade required"
 // @Router /api/admin/sites [post]
 func CreateOrUpdateSiteJSON(c *gin.Context) {
 	claims, err := utils.GetclamsFromContext(c)
@@ -111,6 +117,10 @@ func CreateOrUpdateSiteJSON(c *gin.Context) {
 	err = globalStore.StStore.GetSiteConfig(req.SiteName, &existingConfig)
 
 	if err != nil {
+		if !requireEntitlement(c, claims.UserID, dbmodels.Entitlement_SITES, 1) {
+			return
+		}
+
 		// Create new site config
 		siteConfig := dbmodels.SiteConfig{
 			UserID:   claims.UserID,
@@ -162,7 +172,7 @@ type CartItemResponse struct {
 	SessionID string            `json:"session_id" example:"guest-session-123"`
 	ProductID uint              `json:"product_id" example:"10"`
 	Quantity  int               `json:"quantity" example:"2"`
-	Price     float64           `json:"price" example:"29.99"`
+	Price     decimal.Decimal   `json:"price" example:"29.99"`
 	CreatedAt time.Time         `json:"created_at" example:"2025-11-15T17:30:00Z"`
 	UpdatedAt time.Time         `json:"updated_at" example:"2025-11-15T17:30:00Z"`
 	Product   *dbmodels.Product `json:"product,omitempty"`
@@ -179,20 +189,32 @@ type UpdateCartRequest struct {
 
 type CartResponse struct {
 	CartItems []CartItemResponse `json:"cart_items"`
-	Subtotal  float64            `json:"subtotal" example:"89.97"`
+	Subtotal  decimal.Decimal    `json:"subtotal" example:"89.97"`
 	ItemCount int                `json:"item_count" example:"3"`
 }
 
 type CheckoutRequest struct {
-	ClientID uint   `json:"client_id" binding:"required" example:"5"`
+	// Existing client, used when the store owner checks out for them; otherwise the client is matched or created from the contact details below
+	ClientID uint   `json:"client_id" example:"5"`
+	Name     string `json:"name" example:"Mona Adel"`
+	Email    string `json:"email" binding:"omitempty,email" example:"mona@example.com"`
 	Address  string `json:"address" example:"123 Main St, City, Country"`
 	Phone    string `json:"phone" example:"+201234567890"`
 	Notes    string `json:"notes" example:"Please deliver between 2-5 PM"`
+	// Optional coupon, e.g. one sent with an abandoned cart reminder
+	CouponCode string `json:"coupon_code" example:"CART-1A2B3C4D"`
+	// Optional: start a payment right after the order is created, online or
+	// offline (cod, bank_transfer, instapay)
+	PaymentMethod string `json:"payment_method" example:"paymob"`
+	// Optional currency to pay in; defaults to the store currency
+	Currency string `json:"currency" example:"USD"`
 }
 
 type OrderResponse struct {
-	Message string         `json:"message" example:"Order created successfully"`
-	Order   dbmodels.Order `json:"order"`
+	Message    string                `json:"message" example:"Order created successfully"`
+	Order      dbmodels.Order        `json:"order"`
+	OrderToken string                `json:"order_token,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015"`
+	Payment    *OrderPaymentResponse `json:"payment,omitempty"`
 }
 
 // AddToCart adds a product to the shopping cart
@@ -251,48 +273,58 @@ func AddToCart(c *gin.Context) {
 		return
 	}
 
-	// Check if item already exists in cart
-	existingItem, err := globalStore.StStore.GetCartItem(userID, sessionID, req.ProductID)
-	if err == nil && existingItem != nil {
-		// Update quantity
-		existingItem.Quantity += req.Quantity
-		if err := globalStore.StStore.UpdateCartItem(existingItem); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to update cart",
-			})
-			return
-		}
+	cartItem, created, err := addProductToCart(userID, sessionID, product, req.Quantity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
+	if !created {
 		c.JSON(http.StatusOK, gin.H{
 			"message":   "Cart updated successfully",
-			"cart_item": existingItem,
+			"cart_item": cartItem,
 		})
 		return
 	}
 
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Item added to cart successfully",
+		"cart_item": cartItem,
+	})
+}
+
+// addProductToCart adds quantity of a product to the cart, combining it with an existing line.
+// created reports whether a new cart line was inserted.
+func addProductToCart(userID *uint, sessionID string, product *dbmodels.Product, quantity int) (*dbmodels.CartItem, bool, error) {
+	// Check if item already exists in cart
+	existingItem, err := globalStore.StStore.GetCartItem(userID, sessionID, product.ID)
+	if err == nil && existingItem != nil {
+		// Update quantity
+		existingItem.Quantity += quantity
+		if err := globalStore.StStore.UpdateCartItem(existingItem); err != nil {
+			return nil, false, errors.New("Failed to update cart")
+		}
+		return existingItem, false, nil
+	}
+
 	// Add new item to cart
 	cartItem := &dbmodels.CartItem{
 		UserID:    userID,
 		SessionID: sessionID,
-		ProductID: req.ProductID,
-		Quantity:  req.Quantity,
+		ProductID: product.ID,
+		Quantity:  quantity,
 		Price:     product.Price,
 	}
 
 	if err := globalStore.StStore.AddToCart(cartItem); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to add to cart",
-		})
-		return
+		return nil, false, errors.New("Failed to add to cart")
 	}
 
 	// Load product details
 	cartItem.Product = product
-
-	c.JSON(http.StatusCreated, gin.H{
-		"message":   "Item added to cart successfully",
-		"cart_item": cartItem,
-	})
+	return cartItem, true, nil
 }
 
 // GetCart retrieves the current user's cart
@@ -303,6 +335,7 @@ func AddToCart(c *gin.Context) {
 // @Produce json
 // @Param Authorization header string false "Bearer token (optional for guests)" example("Bearer eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9...")
 // @Param X-Session-ID header string false "Session ID for guest users" example("guest-session-abc123")
+// @Param currency query string false "Also show prices in this currency" example("USD")
 // @Success 200 {object} CartResponse "Cart retrieved successfully"
 // @Failure 400 {object} map[string]string "Bad request - Session ID required for guests"
 // @Failure 500 {object} map[string]string "Failed to fetch cart"
@@ -331,16 +364,47 @@ func GetCart(c *gin.Context) {
 	}
 
 	// Calculate totals
-	var subtotal float64
+	subtotal := decimal.Zero
 	for _, item := range cartItems {
-		subtotal += item.Price * float64(item.Quantity)
+		subtotal = subtotal.Add(money.Multiply(item.Price, item.Quantity))
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"cart_items": cartItems,
 		"subtotal":   subtotal,
 		"item_count": len(cartItems),
-	})
+	}
+
+	// Cart prices are in the store currency; optionally show them in the shopper's currency too
+	if len(cartItems) > 0 && cartItems[0].Product != nil {
+		baseCurrency := storeCurrency(cartItems[0].Product.UserID)
+		response["currency"] = baseCurrency
+
+		if currency := money.NormalizeCurrency(c.Query("currency")); currency != "" && currency != baseCurrency {
+			rate, err := globalStore.StStore.GetExchangeRate(baseCurrency, currency)
+			if err != nil {
+				respondCurrencyError(c, err)
+				return
+			}
+			prices, err := priceCartInCurrency(cartItems, baseCurrency, currency, rate)
+			if err != nil {
+				respondCurrencyError(c, err)
+				return
+			}
+			converted := decimal.Zero
+			for i, item := range cartItems {
+				converted = converted.Add(money.Multiply(prices[i], item.Quantity))
+			}
+			response["converted"] = gin.H{
+				"currency":      currency,
+				"exchange_rate": rate,
+				"prices":        prices,
+				"subtotal":      converted,
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // UpdateCartItem updates the quantity of a cart item
@@ -532,30 +596,36 @@ func ClearCart(c *gin.Context) {
 
 // CreateOrderFromCart creates an order from the current cart
 // @Summary Checkout - Create order from cart
-// @Description Creates an order from all items in the shopping cart. Requires authentication. Automatically updates inventory and clears cart.
+// @Description Creates an order from all items in the shopping cart. Guests identified by X-Session-ID check out with name, email, phone and address, and a client is matched or created for the store. Authenticated store users may pass an existing client_id instead. Automatically updates inventory and clears cart. When payment_method is set, a payment is initiated for the new order; with cod, bank_transfer or instapay it waits for the courier or for proof of the transfer.
 // @Tags Shopping Cart
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param Authorization header string true "Bearer token" example("Bearer eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9...")
-// @Param X-Session-ID header string false "Session ID (optional, used to migrate guest cart)" example("guest-session-abc123")
+// @Param Authorization header string false "Bearer token" example("Bearer eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9...")
+// @Param X-Session-ID header string false "Session ID (required for guest checkout)" example("guest-session-abc123")
 // @Param request body CheckoutRequest true "Order Details"
 // @Success 201 {object} OrderResponse "Order created successfully"
 // @Failure 400 {object} map[string]interface{} "Bad request - cart is empty or validation error"
-// @Failure 401 {object} map[string]string "Authentication required to create order"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/customer-website/checkout [post]
 func CreateOrderFromCart(c *gin.Context) {
+	// Authentication is optional; guests are identified by their session
+	var userID *uint
 	claims, err := utils.GetclamsFromContext(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required to create order"})
-		return
+	if err == nil {
+		userID = &claims.UserID
 	}
 
 	sessionID := c.GetHeader("X-Session-ID")
+	if userID == nil && sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "X-Session-ID header is required for guest checkout",
+		})
+		return
+	}
 
 	// Get cart items
-	cartItems, err := globalStore.StStore.GetCart(&claims.UserID, sessionID)
+	cartItems, err := globalStore.StStore.GetCart(userID, sessionID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to fetch cart",
@@ -570,56 +640,137 @@ func CreateOrderFromCart(c *gin.Context) {
 		return
 	}
 
-	// Get client ID from request
 	var req CheckoutRequest
-
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.PaymentMethod != "" {
+		if err := checkOrderPaymentMethod(req.PaymentMethod); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.PaymentMethod == dbmodels.WalletPaymentMethod && userID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sign in to pay from your wallet"})
+			return
+		}
+	}
 
-	// Calculate total
-	var total float64
+	// All items must come from the same store
 	for _, item := range cartItems {
-		total += item.Price * float64(item.Quantity)
+		if item.Product == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "A product in your cart is no longer available",
+			})
+			return
+		}
 	}
-
-	// Create order
-	order := dbmodels.Order{
-		ClientID: req.ClientID,
-		UserID:   claims.UserID,
-		Total:    total,
-		Status:   dbmodels.OrderStatus_PENDING,
-		Address:  req.Address,
-		Phone:    req.Phone,
-		Notes:    req.Notes,
+	storeOwnerID := cartItems[0].Product.UserID
+	for _, item := range cartItems {
+		if item.Product.UserID != storeOwnerID {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Cart contains products from more than one store",
+			})
+			return
+		}
 	}
 
-	if err := globalStore.StStore.CreateOrder(&order); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to create order",
-		})
+	// Price the order in the shopper's currency; the store currency is kept for reporting
+	baseCurrency := storeCurrency(storeOwnerID)
+	currency := baseCurrency
+	if req.Currency != "" {
+		currency = money.NormalizeCurrency(req.Currency)
+	}
+	rate, err := globalStore.StStore.GetExchangeRate(baseCurrency, currency)
+	if err != nil {
+		respondCurrencyError(c, err)
+		return
+	}
+	prices, err := priceCartInCurrency(cartItems, baseCurrency, currency, rate)
+	if err != nil {
+		respondCurrencyError(c, err)
 		return
 	}
 
-	// Create order items
-	for _, cartItem := range cartItems {
-		orderItem := dbmodels.OrderItem{
-			OrderID:   order.ID,
-			ProductID: cartItem.ProductID,
-			Quantity:  cartItem.Quantity,
-			Price:     cartItem.Price,
+	// Resolve the client: the store owner may reference one of their clients,
+	// everyone else is matched or created from the checkout details
+	var clientID uint
+	checkoutToken := ""
+	if claims != nil && req.ClientID != 0 && claims.UserID == storeOwnerID {
+		if client, err := globalStore.StStore.GetStoreClient(req.ClientID, storeOwnerID); err == nil {
+			clientID = client.ID
 		}
-
-		if err := globalStore.StStore.CreateOrderItem(&orderItem); err != nil {
-			// Rollback order if order items fail
-			globalStore.StStore.DeleteOrder(order.ID)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to create order items",
+	}
+	if clientID == 0 {
+		if req.Name == "" || req.Email == "" || req.Phone == "" || req.Address == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "name, email, phone and address are required for checkout",
 			})
 			return
 		}
 
+		client, err := globalStore.StStore.FindOrCreateClient(storeOwnerID, req.Name, req.Email, req.Phone, req.Address)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		clientID = client.ID
+		checkoutToken = utils.GenerateToken(16)
+	}
+
+	// Calculate total
+	total := decimal.Zero
+	for i, item := range cartItems {
+		total = total.Add(money.Multiply(prices[i], item.Quantity))
+	}
+
+	// Apply coupon; it is redeemed with the order
+	discount := decimal.Zero
+	var couponID uint
+	if req.CouponCode != "" {
+		coupon, err := globalStore.StStore.GetCouponByCode(req.CouponCode)
+		if err != nil || !coupon.IsUsable(storeOwnerID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired coupon"})
+			return
+		}
+		couponID = coupon.ID
+		discount = money.Percent(total, coupon.DiscountPercent)
+		total = total.Sub(discount)
+	}
+
+	// Create order
+	order := dbmodels.Order{
+		ClientID:      clientID,
+		UserID:        storeOwnerID,
+		Total:         total,
+		Status:        dbmodels.OrderStatus_PENDING,
+		Address:       req.Address,
+		Phone:         req.Phone,
+		Notes:         req.Notes,
+		CheckoutToken: checkoutToken,
+		Discount:      discount,
+		CouponCode:    strings.ToUpper(strings.TrimSpace(req.CouponCode)),
+		Currency:      currency,
+		ExchangeRate:  rate,
+		BaseCurrency:  baseCurrency,
+		BaseTotal:     money.Round(total.Div(rate)),
+	}
+
+	orderItems := make([]dbmodels.OrderItem, 0, len(cartItems))
+	for i, cartItem := range cartItems {
+		orderItems = append(orderItems, dbmodels.OrderItem{
+			ProductID: cartItem.ProductID,
+			Quantity:  cartItem.Quantity,
+			Price:     prices[i],
+		})
+	}
+
+	if err := globalStore.StStore.CreateCheckoutOrder(&order, orderItems, couponID); err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, cartItem := range cartItems {
 		// Update product quantity
 		product, _ := globalStore.StStore.GetProduct(cartItem.ProductID)
 		if product != nil {
@@ -628,16 +779,35 @@ func CreateOrderFromCart(c *gin.Context) {
 		}
 	}
 
-	// Clear cart after order creation
-	globalStore.StStore.ClearCart(&claims.UserID, sessionID)
+	// Clear cart after order creation, crediting any abandoned cart reminder
+	globalStore.StStore.MarkCartRecovered(userID, sessionID, order.ID, order.BaseTotal)
+	globalStore.StStore.ClearCart(userID, sessionID)
 
 	// Send notification
 	if globalStore.NotifService != nil {
-		go globalStore.NotifService.NotifyNewOrder(claims.UserID, order.ID, order.Total)
+		go globalStore.NotifService.NotifyNewOrder(order.UserID, order.ID, order.Total, order.Currency)
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	response := gin.H{
 		"message": "Order created successfully",
 		"order":   order,
-	})
+	}
+	if checkoutToken != "" {
+		response["order_token"] = checkoutToken
+	}
+
+	// Start the online payment if the shopper chose one
+	if req.PaymentMethod != "" {
+		fullOrder, err := globalStore.StStore.GetOrderWithItems(order.ID)
+		if err == nil {
+			paymentResp, err := initiateOrderPayment(c.Request.Context(), fullOrder, req.PaymentMethod, userID)
+			if err != nil {
+				response["payment_error"] = err.Error()
+			} else {
+				response["payment"] = paymentResp
+			}
+		}
+	}
+
+	c.JSON(http.StatusCreated, response)
 }
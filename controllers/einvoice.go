@@ -0,0 +1,563 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/einvoice"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+	"github.com/shopspring/decimal"
+)
+
+// ========== E-INVOICING ==========
+
+type EInvoiceProfileRequest struct {
+	Enabled               bool            `json:"enabled"`
+	IssuerType            string          `json:"issuer_type" binding:"omitempty,oneof=B F" example:"B"`
+	TaxRegistrationNumber string          `json:"tax_registration_number" binding:"max=30" example:"123456789"`
+	Name                  string          `json:"name" binding:"max=255" example:"Hamber Store LLC"`
+	ActivityCode          string          `json:"activity_code" binding:"max=10" example:"4791"`
+	BranchID              string          `json:"branch_id" binding:"max=20" example:"0"`
+	Governate             string          `json:"governate" binding:"max=100" example:"Cairo"`
+	RegionCity            string          `json:"region_city" binding:"max=100" example:"Nasr City"`
+	Street                string          `json:"street" binding:"max=255" example:"12 Abbas El Akkad St"`
+	BuildingNumber        string          `json:"building_number" binding:"max=50" example:"12"`
+	PostalCode            string          `json:"postal_code" binding:"max=20"`
+	ItemCodeType          string          `json:"item_code_type" binding:"omitempty,oneof=EGS GS1" example:"EGS"`
+	TaxRate               decimal.Decimal `json:"tax_rate" swaggertype:"number" example:"14"`
+	PricesIncludeTax      bool            `json:"prices_include_tax" example:"true"`
+}
+
+// EInvoiceReceiverRequest overrides the customer's details on an order invoice.
+// Person receivers need a national ID from 50,000 EGP; businesses their RIN and address.
+type EInvoiceReceiverRequest struct {
+	Type           string `json:"type" binding:"omitempty,oneof=B P F" example:"P"`
+	ID             string `json:"id" binding:"max=30" example:"29001011234567"`
+	Name           string `json:"name" binding:"max=255"`
+	Governate      string `json:"governate" binding:"max=100"`
+	RegionCity     string `json:"region_city" binding:"max=100"`
+	Street         string `json:"street" binding:"max=255"`
+	BuildingNumber string `json:"building_number" binding:"max=50"`
+	PostalCode     string `json:"postal_code" binding:"max=20"`
+}
+
+// respondEInvoiceError reports validation problems with the document, or a store error
+func respondEInvoiceError(c *gin.Context, err error) {
+	var invalid *einvoice.ValidationError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "The document would be rejected by the tax authority",
+			"problems": invalid.Problems,
+		})
+		return
+	}
+	code := http.StatusInternalServerError
+	if customErr, ok := err.(*stores.CustomError); ok {
+		code = customErr.Code
+	}
+	c.JSON(code, gin.H{"error": err.Error()})
+}
+
+// loadEInvoiceDocument loads a document for its store, or an admin
+func loadEInvoiceDocument(c *gin.Context) (*dbmodels.EInvoiceDocument, bool) {
+	claims, err := utils.GetclamsFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return nil, false
+	}
+
+	document, err := globalStore.StStore.GetEInvoiceDocument(uint(id))
+	if err != nil {
+		respondEInvoiceError(c, err)
+		return nil, false
+	}
+	if document.UserID != claims.UserID && claims.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return document, true
+}
+
+// GetEInvoiceProfile godoc
+// @Summary      Get e-invoice profile
+// @Description  The store's Egyptian Tax Authority registration used as the issuer of its e-invoices
+// @Tags         E-Invoices
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "E-invoice profile; null until saved"
+// @Router       /profile/einvoice [get]
+func GetEInvoiceProfile(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile, _ := globalStore.StStore.GetEInvoiceProfile(userID)
+	c.JSON(http.StatusOK, gin.H{
+		"profile":   profile,
+		"submitter": globalStore.EInvoices.SubmitterName(),
+	})
+}
+
+// UpdateEInvoiceProfile godoc
+// @Summary      Save e-invoice profile
+// @Description  Saves the store's tax registration number, activity code, branch address and VAT settings. Orders can be e-invoiced once the profile is enabled.
+// @Tags         E-Invoices
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body EInvoiceProfileRequest true "Profile"
+// @Success      200 {object} map[string]interface{} "Profile saved"
+// @Failure      400 {object} map[string]interface{} "Invalid profile"
+// @Router       /profile/einvoice [put]
+func UpdateEInvoiceProfile(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req EInvoiceProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TaxRate.IsNegative() || req.TaxRate.GreaterThan(decimal.NewFromInt(100)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tax rate must be between 0 and 100"})
+		return
+	}
+	if req.Enabled && (strings.TrimSpace(req.TaxRegistrationNumber) == "" || strings.TrimSpace(req.ActivityCode) == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tax registration number and activity code are required to enable e-invoicing"})
+		return
+	}
+
+	profile := &dbmodels.EInvoiceProfile{
+		UserID:                userID,
+		Enabled:               req.Enabled,
+		IssuerType:            req.IssuerType,
+		TaxRegistrationNumber: strings.TrimSpace(req.TaxRegistrationNumber),
+		Name:                  strings.TrimSpace(req.Name),
+		ActivityCode:          strings.TrimSpace(req.ActivityCode),
+		BranchID:              strings.TrimSpace(req.BranchID),
+		Governate:             strings.TrimSpace(req.Governate),
+		RegionCity:            strings.TrimSpace(req.RegionCity),
+		Street:                strings.TrimSpace(req.Street),
+		BuildingNumber:        strings.TrimSpace(req.BuildingNumber),
+		PostalCode:            strings.TrimSpace(req.PostalCode),
+		ItemCodeType:          req.ItemCodeType,
+		TaxRate:               req.TaxRate,
+		PricesIncludeTax:      req.PricesIncludeTax,
+	}
+	if profile.IssuerType == "" {
+		profile.IssuerType = einvoice.PartyBusiness
+	}
+	if profile.BranchID == "" {
+		profile.BranchID = "0"
+	}
+	if profile.ItemCodeType == "" {
+		profile.ItemCodeType = einvoice.ItemTypeEGS
+	}
+
+	if err := globalStore.StStore.SaveEInvoiceProfile(profile); err != nil {
+		respondEInvoiceError(c, err)
+		return
+	}
+
+	saved, _ := globalStore.StStore.GetEInvoiceProfile(userID)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "E-invoice profile saved",
+		"profile": saved,
+	})
+}
+
+// IssueOrderEInvoice godoc
+// @Summary      Generate order e-invoice
+// @Description  Maps the order to an ETA invoice issued by the store, validates it and stores it as a draft with its canonical hash. Regenerating replaces a draft until it is accepted.
+// @Tags         E-Invoices
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        order_id path int true "Order ID"
+// @Param        request body EInvoiceReceiverRequest false "Receiver details"
+// @Success      201 {object} map[string]interface{} "Document generated"
+// @Failure      409 {object} map[string]interface{} "E-invoicing not set up, order canceled or invoice already submitted"
+// @Failure      422 {object} map[string]interface{} "Document would be rejected"
+// @Failure      402 {object} map[string]interface{} "Upgrade required"
+// @Router       /einvoices/orders/{order_id} [post]
+func IssueOrderEInvoice(c *gin.Context) {
+	order, ok := loadEInvoiceOrder(c)
+	if !ok || !requireFeature(c, order.UserID, dbmodels.Feature_EINVOICE) {
+		return
+	}
+
+	var req EInvoiceReceiverRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	receiver := &einvoice.Party{
+		Type: req.Type,
+		ID:   strings.TrimSpace(req.ID),
+		Name: strings.TrimSpace(req.Name),
+		Address: einvoice.Address{
+			Governate:      strings.TrimSpace(req.Governate),
+			RegionCity:     strings.TrimSpace(req.RegionCity),
+			Street:         strings.TrimSpace(req.Street),
+			BuildingNumber: strings.TrimSpace(req.BuildingNumber),
+			PostalCode:     strings.TrimSpace(req.PostalCode),
+		},
+	}
+	document, err := globalStore.EInvoices.IssueForOrder(order.ID, receiver)
+	if err != nil {
+		respondEInvoiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "E-invoice generated",
+		"document": document,
+	})
+}
+
+// IssueOrderCreditNote godoc
+// @Summary      Generate order credit note
+// @Description  Reverses the order's submitted e-invoice after a refund or cancellation
+// @Tags         E-Invoices
+// @Produce      json
+// @Security     Bearer
+// @Param        order_id path int true "Order ID"
+// @Success      201 {object} map[string]interface{} "Credit note generated"
+// @Failure      409 {object} map[string]interface{} "Order not refunded or invoice not submitted"
+// @Router       /einvoices/orders/{order_id}/credit-note [post]
+func IssueOrderCreditNote(c *gin.Context) {
+	// Not limited by the package: an invoice already submitted must stay correctable
+	order, ok := loadEInvoiceOrder(c)
+	if !ok {
+		return
+	}
+
+	document, err := globalStore.EInvoices.IssueOrderCreditNote(order.ID)
+	if err != nil {
+		respondEInvoiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Credit note generated",
+		"document": document,
+	})
+}
+
+// loadEInvoiceOrder loads the order in the path for its store, or an admin
+func loadEInvoiceOrder(c *gin.Context) (*dbmodels.Order, bool) {
+	claims, err := utils.GetclamsFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	orderID, err := strconv.ParseUint(c.Param("order_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return nil, false
+	}
+
+	order, err := globalStore.StStore.GetOrderByID(uint(orderID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return nil, false
+	}
+	if order.UserID != claims.UserID && claims.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return order, true
+}
+
+// IssuePaymentEInvoice godoc
+// @Summary      Generate package payment e-invoice (Admin)
+// @Description  The platform's invoice to a store for a paid package, or with credit_note=true the credit note for a refunded one
+// @Tags         E-Invoices
+// @Produce      json
+// @Security     Bearer
+// @Param        payment_id path int true "Payment ID"
+// @Param        credit_note query bool false "Generate the credit note for a refunded payment"
+// @Success      201 {object} map[string]interface{} "Document generated"
+// @Failure      409 {object} map[string]interface{} "Payment not invoiceable"
+// @Failure      422 {object} map[string]interface{} "Document would be rejected"
+// @Router       /admin/einvoices/payments/{payment_id} [post]
+func IssuePaymentEInvoice(c *gin.Context) {
+	paymentID, err := strconv.ParseUint(c.Param("payment_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	var document *dbmodels.EInvoiceDocument
+	if c.Query("credit_note") == "true" {
+		document, err = globalStore.EInvoices.IssuePaymentCreditNote(uint(paymentID))
+	} else {
+		document, err = globalStore.EInvoices.IssueForPayment(uint(paymentID))
+	}
+	if err != nil {
+		respondEInvoiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "E-invoice generated",
+		"document": document,
+	})
+}
+
+// GetEInvoiceDocuments godoc
+// @Summary      List e-invoice documents
+// @Description  The store's invoices and credit notes, newest first. Admins see every store's, or one store's with user_id.
+// @Tags         E-Invoices
+// @Produce      json
+// @Security     Bearer
+// @Param        status query string false "DRAFT, SUBMITTED, VALID, INVALID, REJECTED or CANCELLED"
+// @Param        source query string false "order or payment"
+// @Param        type query string false "I (invoice) or C (credit note)"
+// @Param        from query string false "Created from (YYYY-MM-DD)"
+// @Param        to query string false "Created until, inclusive (YYYY-MM-DD)"
+// @Param        user_id query int false "Store (admins only)"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Documents"
+// @Router       /einvoices [get]
+func GetEInvoiceDocuments(c *gin.Context) {
+	filter, ok := eInvoiceFilter(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	documents, total, err := globalStore.StStore.GetEInvoiceDocuments(filter, page, limit)
+	if err != nil {
+		respondEInvoiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"documents":   documents,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (int(total) + limit - 1) / limit,
+	})
+}
+
+// ExportEInvoiceDocuments godoc
+// @Summary      Export e-invoice documents
+// @Description  Downloads the matching documents as submitted to the tax authority, {"documents": [...]}, for accounting or signing tools
+// @Tags         E-Invoices
+// @Produce      json
+// @Security     Bearer
+// @Param        status query string false "Document status"
+// @Param        source query string false "order or payment"
+// @Param        type query string false "I or C"
+// @Param        from query string false "Created from (YYYY-MM-DD)"
+// @Param        to query string false "Created until, inclusive (YYYY-MM-DD)"
+// @Param        user_id query int false "Store (admins only)"
+// @Success      200 {file} file "Documents JSON"
+// @Router       /einvoices/export [get]
+func ExportEInvoiceDocuments(c *gin.Context) {
+	filter, ok := eInvoiceFilter(c)
+	if !ok {
+		return
+	}
+
+	documents, _, err := globalStore.StStore.GetEInvoiceDocuments(filter, 1, 0)
+	if err != nil {
+		respondEInvoiceError(c, err)
+		return
+	}
+
+	data, err := einvoice.Bundle(documents)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export documents"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=einvoices-%s.json", time.Now().Format("20060102")))
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// eInvoiceFilter reads the listing filters. Stores only see their own documents.
+func eInvoiceFilter(c *gin.Context) (stores.EInvoiceFilter, bool) {
+	claims, err := utils.GetclamsFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return stores.EInvoiceFilter{}, false
+	}
+
+	filter := stores.EInvoiceFilter{
+		UserID:       claims.UserID,
+		Source:       c.Query("source"),
+		DocumentType: strings.ToUpper(c.Query("type")),
+		Status:       strings.ToUpper(c.Query("status")),
+	}
+	if claims.Role == "admin" {
+		filter.UserID = 0
+		if userID, err := strconv.ParseUint(c.Query("user_id"), 10, 32); err == nil {
+			filter.UserID = uint(userID)
+		}
+	}
+
+	if from := c.Query("from"); from != "" {
+		date, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be YYYY-MM-DD"})
+			return filter, false
+		}
+		filter.From = &date
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be YYYY-MM-DD"})
+			return filter, false
+		}
+		end := date.AddDate(0, 0, 1)
+		filter.To = &end
+	}
+	return filter, true
+}
+
+// GetEInvoiceDocument godoc
+// @Summary      Get e-invoice document
+// @Description  The document record with its ETA JSON and canonical serialization
+// @Tags         E-Invoices
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Document ID"
+// @Success      200 {object} map[string]interface{} "Document"
+// @Failure      404 {object} map[string]interface{} "Document not found"
+// @Router       /einvoices/{id} [get]
+func GetEInvoiceDocument(c *gin.Context) {
+	document, ok := loadEInvoiceDocument(c)
+	if !ok {
+		return
+	}
+
+	canonical, err := einvoice.Canonicalize([]byte(document.Document))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Stored document is unreadable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"document":  document,
+		"content":   json.RawMessage(document.Document),
+		"canonical": canonical,
+	})
+}
+
+// DownloadEInvoiceDocument godoc
+// @Summary      Download e-invoice document
+// @Description  The document's ETA JSON exactly as hashed and submitted, or its canonical serialization with format=canonical
+// @Tags         E-Invoices
+// @Produce      json,text/plain
+// @Security     Bearer
+// @Param        id path int true "Document ID"
+// @Param        format query string false "json or canonical" default(json)
+// @Success      200 {file} file "Document"
+// @Router       /einvoices/{id}/download [get]
+func DownloadEInvoiceDocument(c *gin.Context) {
+	document, ok := loadEInvoiceDocument(c)
+	if !ok {
+		return
+	}
+
+	if c.Query("format") == "canonical" {
+		canonical, err := einvoice.Canonicalize([]byte(document.Document))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Stored document is unreadable"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.txt", document.InternalID))
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(canonical))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", document.InternalID))
+	c.Data(http.StatusOK, "application/json", []byte(document.Document))
+}
+
+// SubmitEInvoiceDocument godoc
+// @Summary      Submit e-invoice document
+// @Description  Sends a draft, or a rejected or invalid document after regenerating it, to the tax authority
+// @Tags         E-Invoices
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Document ID"
+// @Success      200 {object} map[string]interface{} "Submitted or rejected"
+// @Failure      409 {object} map[string]interface{} "Already submitted"
+// @Failure      502 {object} map[string]interface{} "Tax authority unreachable"
+// @Router       /einvoices/{id}/submit [post]
+func SubmitEInvoiceDocument(c *gin.Context) {
+	document, ok := loadEInvoiceDocument(c)
+	if !ok {
+		return
+	}
+
+	document, err := globalStore.EInvoices.Submit(c.Request.Context(), document)
+	if err != nil {
+		respondEInvoiceError(c, err)
+		return
+	}
+
+	message := "Document submitted"
+	if document.Status == dbmodels.EInvoiceStatusRejected {
+		message = "Document rejected"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  message,
+		"document": document,
+	})
+}
+
+// RefreshEInvoiceStatus godoc
+// @Summary      Refresh e-invoice status
+// @Description  Asks the tax authority whether a submitted document is valid, and records any validation errors
+// @Tags         E-Invoices
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Document ID"
+// @Success      200 {object} map[string]interface{} "Document"
+// @Failure      409 {object} map[string]interface{} "Not submitted"
+// @Router       /einvoices/{id}/status [post]
+func RefreshEInvoiceStatus(c *gin.Context) {
+	document, ok := loadEInvoiceDocument(c)
+	if !ok {
+		return
+	}
+
+	document, err := globalStore.EInvoices.RefreshStatus(c.Request.Context(), document)
+	if err != nil {
+		respondEInvoiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"document": document})
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	db "github.com/mohammedrefaat/hamber/Db"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== PACKAGE ENTITLEMENTS ==========
+
+// GetMyEntitlements godoc
+// @Summary      Get my package entitlements
+// @Description  Limits of the user's package with how much of each is used, and the features it includes. Storage is in bytes.
+// @Tags         User
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} stores.UserEntitlements "Entitlements"
+// @Router       /profile/entitlements [get]
+func GetMyEntitlements(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	entitlements, err := globalStore.StStore.GetEntitlements(userID, globalStore.Config.GetFreePackageID())
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entitlements)
+}
+
+// requireEntitlement checks that the user's package has room to add to a
+// resource, writing the upgrade-required response when not. Admins are not
+// limited.
+func requireEntitlement(c *gin.Context, userID uint, resource dbmodels.Entitlement, adding int64) bool {
+	if role, _ := c.Get("user_role"); role == "admin" {
+		return true
+	}
+	usage, err := globalStore.StStore.CheckEntitlement(userID, globalStore.Config.GetFreePackageID(), resource, adding)
+	if err != nil {
+		respondUpgradeRequired(c, err, gin.H{"resource": resource, "usage": usage})
+		return false
+	}
+	return true
+}
+
+// entitlementRoom returns how much more of a resource the user's package
+// allows, -1 when unlimited, writing the error response when it cannot tell
+func entitlementRoom(c *gin.Context, userID uint, resource dbmodels.Entitlement) (int64, bool) {
+	if role, _ := c.Get("user_role"); role == "admin" {
+		return -1, true
+	}
+	usage, err := globalStore.StStore.CheckEntitlement(userID, globalStore.Config.GetFreePackageID(), resource, 0)
+	if err != nil {
+		respondUpgradeRequired(c, err, gin.H{"resource": resource, "usage": usage})
+		return 0, false
+	}
+	if usage == nil {
+		return -1, true
+	}
+	return *usage.Remaining, true
+}
+
+// requireFeature checks that the user's package includes a feature, writing the
+// upgrade-required response when not. Admins are not limited.
+func requireFeature(c *gin.Context, userID uint, feature dbmodels.Feature) bool {
+	if role, _ := c.Get("user_role"); role == "admin" {
+		return true
+	}
+	if err := globalStore.StStore.CheckFeature(userID, globalStore.Config.GetFreePackageID(), feature); err != nil {
+		respondUpgradeRequired(c, err, gin.H{"feature": feature})
+		return false
+	}
+	return true
+}
+
+// respondUpgradeRequired writes a refused entitlement check: 402 with what was
+// refused, or the error of a failed check
+func respondUpgradeRequired(c *gin.Context, err error, details gin.H) {
+	customErr, ok := err.(*stores.CustomError)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if customErr.Code != http.StatusPaymentRequired {
+		c.JSON(customErr.Code, gin.H{"error": customErr.Message})
+		return
+	}
+	response := gin.H{"error": customErr.Message, "upgrade_required": true}
+	for key, value := range details {
+		response[key] = value
+	}
+	c.JSON(customErr.Code, response)
+}
+
+// recordStoredFiles counts uploaded files against the user's storage
+func recordStoredFiles(userID uint, results []*db.PhotoUploadResult) {
+	for _, result := range results {
+		if err := globalStore.StStore.RecordStoredFile(userID, result.FileName, result.Size); err != nil {
+			fmt.Printf("Warning: Failed to record stored file %s: %v\n", result.FileName, err)
+		}
+	}
+}
+
+// releaseStoredFiles stops counting the files behind photo URLs against storage
+func releaseStoredFiles(photoURLs []string) {
+	if err := globalStore.StStore.ReleaseStoredFiles(photoFileNames(photoURLs)); err != nil {
+		fmt.Printf("Warning: Failed to release stored files: %v\n", err)
+	}
+}
+
+// photoFileNames returns the storage object names behind photo URLs
+func photoFileNames(photoURLs []string) []string {
+	var fileNames []string
+	for _, url := range photoURLs {
+		if fileName := extractFileNameFromURL(url); fileName != "" {
+			fileNames = append(fileNames, fileName)
+		}
+	}
+	return fileNames
+}
+
+// decodePhotoURLs reads a JSON array of photo URLs, as stored on products and blogs
+func decodePhotoURLs(photosJSON string) []string {
+	var photoURLs []string
+	if photosJSON != "" && photosJSON != "[]" {
+		json.Unmarshal([]byte(photosJSON), &photoURLs)
+	}
+	return photoURLs
+}
+
+// base64PhotosSize is the most base64 photos can take up once decoded
+func base64PhotosSize(base64Photos []string) int64 {
+	var size int64
+	for _, photo := range base64Photos {
+		if idx := strings.Index(photo, ","); idx != -1 {
+			photo = photo[idx+1:]
+		}
+		size += int64(base64.StdEncoding.DecodedLen(len(photo)))
+	}
+	return size
+}
+
+// multipartFilesSize is the size of uploaded files
+func multipartFilesSize(files []*multipart.FileHeader) int64 {
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	return size
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/mohammedrefaat/hamber/Middleware"
+	"github.com/mohammedrefaat/hamber/i18n"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== RECEIPT LOCALE ==========
+
+type StoreLocaleRequest struct {
+	Language string `json:"language" example:"ar"`   // en or ar; empty follows the shopper's request
+	Numerals string `json:"numerals" example:"arab"` // latn (0-9) or arab (٠-٩)
+}
+
+// receiptLocale picks the language of a receipt: ?lang= on the request, then the
+// store's setting, then the language detected from Accept-Language.
+// ?numerals= overrides the store's numbering system.
+func receiptLocale(c *gin.Context, ownerID uint) i18n.Locale {
+	language, numerals := globalStore.StStore.GetStoreLocale(ownerID)
+	if language == "" || i18n.NormalizeLanguage(c.Query("lang")) != "" {
+		language, _ = c.Request.Context().Value(middleware.LanguageKey).(string)
+	}
+	return localeFromQuery(c, i18n.NewLocale(language, numerals))
+}
+
+// localeFromQuery applies ?lang= and ?numerals= on top of a locale
+func localeFromQuery(c *gin.Context, locale i18n.Locale) i18n.Locale {
+	if language := i18n.NormalizeLanguage(c.Query("lang")); language != "" {
+		locale.Language = language
+	}
+	if numerals := c.Query("numerals"); i18n.IsValidNumerals(numerals) {
+		locale.Numerals = numerals
+	}
+	return locale
+}
+
+// GetStoreLocale godoc
+// @Summary      Get receipt language
+// @Description  The language and digits receipts are printed in when the request does not ask for one
+// @Tags         Receipts
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "Receipt locale"
+// @Router       /profile/locale [get]
+func GetStoreLocale(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	language, numerals := globalStore.StStore.GetStoreLocale(userID)
+	c.JSON(http.StatusOK, gin.H{
+		"language":  language,
+		"numerals":  globalStore.Receipts.Locale(userID).Numerals,
+		"languages": []string{i18n.English, i18n.Arabic},
+		"is_set":    language != "" || numerals != "",
+	})
+}
+
+// UpdateStoreLocale godoc
+// @Summary      Set receipt language
+// @Description  Sets the language and digits of the store's receipts. A ?lang= or ?numerals= on a receipt request still wins.
+// @Tags         Receipts
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body StoreLocaleRequest true "Locale"
+// @Success      200 {object} map[string]interface{} "Locale updated"
+// @Router       /profile/locale [put]
+func UpdateStoreLocale(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req StoreLocaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Language != "" && !i18n.IsSupported(req.Language) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "language must be en or ar"})
+		return
+	}
+	if req.Numerals != "" && !i18n.IsValidNumerals(req.Numerals) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "numerals must be latn or arab"})
+		return
+	}
+
+	if err := globalStore.StStore.UpdateStoreLocale(userID, req.Language, req.Numerals); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Receipt language updated",
+		"language": req.Language,
+		"numerals": req.Numerals,
+	})
+}
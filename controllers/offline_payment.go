@@ -0,0 +1,478 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	db "github.com/mohammedrefaat/hamber/Db"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== OFFLINE PAYMENTS ==========
+
+// maxProofSize is the largest proof of payment accepted
+const maxProofSize = 10 << 20
+
+// proofContentTypes are the files accepted as proof of payment: screenshots,
+// photos of a receipt or a bank's PDF advice
+var proofContentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+type PaymentAccountRequest struct {
+	BankName        string `json:"bank_name" example:"CIB"`
+	AccountName     string `json:"account_name" example:"Mona's Boutique LLC"`
+	AccountNumber   string `json:"account_number" example:"EG380019000500000000263180002"` // Account number or IBAN
+	InstaPayAddress string `json:"instapay_address" example:"monasboutique@instapay"`
+}
+
+type RejectOfflinePaymentRequest struct {
+	Reason string `json:"reason" binding:"required" example:"No transfer with this reference arrived"`
+}
+
+// GetPaymentAccount godoc
+// @Summary      Get my payment account
+// @Description  The account the store's customers send bank transfers and InstaPay payments to for its orders
+// @Tags         Payments
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} dbmodels.PaymentAccount "Payment account"
+// @Failure      404 {object} map[string]interface{} "Payment account not set"
+// @Router       /payment/offline/account [get]
+func GetPaymentAccount(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := globalStore.StStore.GetPaymentAccount(userID)
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// SavePaymentAccount godoc
+// @Summary      Save my payment account
+// @Description  Sets the account the store's customers send bank transfers and InstaPay payments to. Without an account number the store does not offer bank_transfer, and without an InstaPay address it does not offer instapay.
+// @Tags         Payments
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body PaymentAccountRequest true "Payment account"
+// @Success      200 {object} dbmodels.PaymentAccount "Payment account saved"
+// @Failure      400 {object} map[string]interface{} "Invalid request"
+// @Router       /payment/offline/account [put]
+func SavePaymentAccount(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req PaymentAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account := dbmodels.PaymentAccount{
+		UserID:          userID,
+		BankName:        strings.TrimSpace(req.BankName),
+		AccountName:     strings.TrimSpace(req.AccountName),
+		AccountNumber:   strings.ReplaceAll(strings.TrimSpace(req.AccountNumber), " ", ""),
+		InstaPayAddress: strings.TrimSpace(req.InstaPayAddress),
+	}
+	if err := globalStore.StStore.SavePaymentAccount(&account); err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := globalStore.StStore.GetPaymentAccount(userID)
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Payment account saved",
+		"account": saved,
+	})
+}
+
+// SubmitPaymentProof godoc
+// @Summary      Upload proof of payment
+// @Description  Attaches proof of a bank transfer or InstaPay payment (PNG, JPEG, WEBP or PDF, up to 10MB) and sends the payment for review. Proof can be replaced until the payment is reviewed.
+// @Tags         Payments
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Payment ID"
+// @Param        proof formData file true "Transfer receipt or screenshot"
+// @Param        sender_name formData string false "Name the transfer was sent from"
+// @Param        transfer_reference formData string false "Bank or InstaPay transaction reference"
+// @Param        note formData string false "Note for the reviewer"
+// @Success      200 {object} map[string]interface{} "Proof submitted"
+// @Failure      400 {object} map[string]interface{} "Invalid file"
+// @Failure      403 {object} map[string]interface{} "Access denied"
+// @Failure      409 {object} map[string]interface{} "Payment already reviewed"
+// @Router       /payment/offline/{id}/proof [post]
+func SubmitPaymentProof(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	paymentdb, ok := loadPayment(c)
+	if !ok {
+		return
+	}
+	if paymentdb.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access to payment"})
+		return
+	}
+
+	submitPaymentProof(c, paymentdb.ID)
+}
+
+// SubmitOrderPaymentProof godoc
+// @Summary      Upload proof of an order payment
+// @Description  Attaches proof of the bank transfer or InstaPay payment of an order (PNG, JPEG, WEBP or PDF, up to 10MB) and sends it to the store for review. Guests authorize with the order_token returned at checkout.
+// @Tags         Shopping Cart
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path int true "Order ID"
+// @Param        X-Order-Token header string false "Order token returned by guest checkout"
+// @Param        proof formData file true "Transfer receipt or screenshot"
+// @Param        sender_name formData string false "Name the transfer was sent from"
+// @Param        transfer_reference formData string false "Bank or InstaPay transaction reference"
+// @Param        note formData string false "Note for the store"
+// @Success      200 {object} map[string]interface{} "Proof submitted"
+// @Failure      400 {object} map[string]interface{} "Invalid file"
+// @Failure      403 {object} map[string]string "Access denied"
+// @Failure      404 {object} map[string]string "No offline payment for this order"
+// @Failure      409 {object} map[string]interface{} "Payment already reviewed"
+// @Router       /api/customer-website/orders/{id}/payment-proof [post]
+func SubmitOrderPaymentProof(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	order, err := globalStore.StStore.GetOrderByID(uint(orderID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if !canAccessOrder(c, order) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	offline, err := globalStore.StStore.GetOrderOfflinePayment(order.ID)
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+
+	submitPaymentProof(c, offline.PaymentID)
+}
+
+// submitPaymentProof stores the uploaded proof of a payment and sends it for
+// review, telling the store owner when it is an order payment
+func submitPaymentProof(c *gin.Context, paymentID uint) {
+	if globalStore.PhotoSrv == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "File storage is not available"})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("proof")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get proof file"})
+		return
+	}
+	defer file.Close()
+
+	// Check the content rather than the header
+	if header.Size > maxProofSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Proof must be 10MB or smaller"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxProofSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read proof file"})
+		return
+	}
+	contentType := http.DetectContentType(data)
+	if !proofContentTypes[contentType] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Proof must be a PNG, JPEG or WEBP image or a PDF"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := globalStore.PhotoSrv.UploadFromReader(ctx, bytes.NewReader(data), header.Filename, int64(len(data)), contentType, db.CategoryPaymentProof)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload proof: " + err.Error()})
+		return
+	}
+
+	offline, replaced, err := globalStore.StStore.SubmitPaymentProof(paymentID, stores.PaymentProof{
+		File:              result.FileName,
+		ContentType:       contentType,
+		SenderName:        strings.TrimSpace(c.PostForm("sender_name")),
+		TransferReference: strings.TrimSpace(c.PostForm("transfer_reference")),
+		Note:              strings.TrimSpace(c.PostForm("note")),
+	})
+	if err != nil {
+		globalStore.PhotoSrv.DeletePhoto(ctx, result.FileName)
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+	if replaced != "" {
+		globalStore.PhotoSrv.DeletePhoto(ctx, replaced)
+	}
+
+	paid := offline.Payment
+	if paid.Purpose == dbmodels.PaymentPurpose_ORDER && paid.OrderID != nil && globalStore.NotifService != nil {
+		go globalStore.NotifService.NotifyPaymentReview(paid.UserID, paid.ID,
+			fmt.Sprintf("Proof of a %s %s payment was uploaded for order #%d", money.Format(paid.Amount), paid.Currency, *paid.OrderID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Proof of payment submitted for review",
+		"offline_payment": offline,
+	})
+}
+
+// GetPaymentProof godoc
+// @Summary      Download proof of payment
+// @Description  The proof uploaded for an offline payment, for its payer, its store or an admin
+// @Tags         Payments
+// @Produce      application/octet-stream
+// @Security     Bearer
+// @Param        id path int true "Payment ID"
+// @Success      200 {file} file "Proof of payment"
+// @Failure      403 {object} map[string]interface{} "Access denied"
+// @Failure      404 {object} map[string]interface{} "No proof uploaded"
+// @Router       /payment/offline/{id}/proof [get]
+func GetPaymentProof(c *gin.Context) {
+	offline, ok := loadOfflinePayment(c, false)
+	if !ok {
+		return
+	}
+	if !offline.HasProof() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No proof of payment uploaded"})
+		return
+	}
+	if globalStore.PhotoSrv == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "File storage is not available"})
+		return
+	}
+
+	reader, err := globalStore.PhotoSrv.GetPhoto(c.Request.Context(), offline.ProofFile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, -1, offline.ProofContentType, reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`inline; filename="payment-%d-proof"`, offline.PaymentID),
+	})
+}
+
+// GetOfflinePaymentQueue godoc
+// @Summary      List my offline payments to review
+// @Description  Offline payments of the store's orders, oldest submission first. Defaults to those in review: proof uploaded or cash collected.
+// @Tags         Payments
+// @Produce      json
+// @Security     Bearer
+// @Param        status query string false "AWAITING_PROOF, AWAITING_COLLECTION, IN_REVIEW, CONFIRMED or REJECTED" default(IN_REVIEW)
+// @Param        method query string false "cod, bank_transfer or instapay"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Offline payments"
+// @Router       /payment/offline/reviews [get]
+func GetOfflinePaymentQueue(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	listOfflinePayments(c, userID)
+}
+
+// GetAllOfflinePayments godoc
+// @Summary      List offline payments to review
+// @Description  Offline payments of every purpose, oldest submission first. Defaults to those in review: proof uploaded or cash collected.
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        status query string false "AWAITING_PROOF, AWAITING_COLLECTION, IN_REVIEW, CONFIRMED or REJECTED" default(IN_REVIEW)
+// @Param        method query string false "cod, bank_transfer or instapay"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Offline payments"
+// @Router       /admin/payments/offline [get]
+func GetAllOfflinePayments(c *gin.Context) {
+	listOfflinePayments(c, 0)
+}
+
+// listOfflinePayments writes a page of the review queue, of one store's orders
+// or of everything when storeID is 0
+func listOfflinePayments(c *gin.Context, storeID uint) {
+	status := dbmodels.OfflinePaymentStatus_IN_REVIEW
+	if value := c.Query("status"); value != "" {
+		parsed, ok := dbmodels.OfflinePaymentStatus_value[strings.ToUpper(value)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offline payment status"})
+			return
+		}
+		status = dbmodels.OfflinePaymentStatus(parsed)
+	}
+	filter := stores.OfflinePaymentFilter{StoreID: storeID, Status: &status, Method: c.Query("method")}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	payments, total, err := globalStore.StStore.GetOfflinePayments(filter, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"offline_payments": payments,
+		"total":            total,
+		"page":             page,
+		"limit":            limit,
+		"total_pages":      (int(total) + limit - 1) / limit,
+	})
+}
+
+// ConfirmOfflinePayment godoc
+// @Summary      Confirm an offline payment
+// @Description  Marks an offline payment as paid once the money arrived, completing what it paid for exactly like a gateway callback: the order is paid and its receipt issued, or the package change, add-on, renewal or wallet top-up is applied. Order payments are confirmed by their store, other payments by an admin.
+// @Tags         Payments
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Payment ID"
+// @Success      200 {object} map[string]interface{} "Payment confirmed"
+// @Failure      403 {object} map[string]interface{} "Access denied"
+// @Failure      404 {object} map[string]interface{} "Offline payment not found"
+// @Failure      409 {object} map[string]interface{} "Payment already reviewed"
+// @Router       /payment/offline/{id}/confirm [post]
+// @Router       /admin/payments/{id}/confirm [post]
+func ConfirmOfflinePayment(c *gin.Context) {
+	reviewOfflinePayment(c, true, "")
+}
+
+// RejectOfflinePayment godoc
+// @Summary      Reject an offline payment
+// @Description  Marks an offline payment as failed, e.g. when the transfer never arrived or the courier collected nothing. What it was for is given up as for a failed gateway payment, and the payer is told the reason.
+// @Tags         Payments
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Payment ID"
+// @Param        request body RejectOfflinePaymentRequest true "Reason"
+// @Success      200 {object} map[string]interface{} "Payment rejected"
+// @Failure      400 {object} map[string]interface{} "Invalid request"
+// @Failure      403 {object} map[string]interface{} "Access denied"
+// @Failure      404 {object} map[string]interface{} "Offline payment not found"
+// @Failure      409 {object} map[string]interface{} "Payment already reviewed"
+// @Router       /payment/offline/{id}/reject [post]
+// @Router       /admin/payments/{id}/reject [post]
+func RejectOfflinePayment(c *gin.Context) {
+	var req RejectOfflinePaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reviewOfflinePayment(c, false, strings.TrimSpace(req.Reason))
+}
+
+// reviewOfflinePayment confirms or rejects the offline payment in the :id path
+// parameter and sends the same follow-ups as a gateway callback
+func reviewOfflinePayment(c *gin.Context, confirm bool, reason string) {
+	reviewerID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	offline, ok := loadOfflinePayment(c, true)
+	if !ok {
+		return
+	}
+
+	transition, reviewed, err := globalStore.StStore.ReviewOfflinePayment(offline.PaymentID, reviewerID, confirm, reason)
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+	followUpPaymentTransition(transition)
+
+	message := "Payment confirmed"
+	if !confirm {
+		message = "Payment rejected"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":         message,
+		"offline_payment": reviewed,
+	})
+}
+
+// loadOfflinePayment loads the offline payment of the payment in the :id path
+// parameter for its reviewer: the store for an order payment, or an admin. Unless
+// review is set, the payer may load it too. Writes the error response when it
+// cannot.
+func loadOfflinePayment(c *gin.Context, review bool) (*dbmodels.OfflinePayment, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	paymentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return nil, false
+	}
+
+	offline, err := globalStore.StStore.GetOfflinePayment(uint(paymentID))
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	owner := offline.Payment.UserID == userID
+	allowed := owner && (!review || offline.Payment.Purpose == dbmodels.PaymentPurpose_ORDER)
+	if role, _ := c.Get("user_role"); role == "admin" {
+		allowed = true
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return offline, true
+}
@@ -1,29 +1,33 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
 	"github.com/mohammedrefaat/hamber/stores"
 	"github.com/mohammedrefaat/hamber/utils"
+	"github.com/shopspring/decimal"
 )
 
 type CreateOrderRequest struct {
-	ClientID uint    `json:"client_id" binding:"required"`
-	Total    float64 `json:"total" binding:"required"`
+	ClientID uint            `json:"client_id" binding:"required"`
+	Total    decimal.Decimal `json:"total" binding:"required"`
 }
 
 // UpdateOrderPaymentRequest represents the payment update payload
 type UpdateOrderPaymentRequest struct {
-	PaymentStatus string     `json:"payment_status" binding:"required" example:"paid"`
-	Amount        float64    `json:"amount" binding:"required" example:"99.99"`
-	PaymentRef    string     `json:"payment_ref" example:"REF123456"`
-	PaymentDate   *time.Time `json:"payment_date" example:"2024-11-03T00:00:00Z"`
-	PaymentMethod int64      `json:"payment_method" example:"1"`
-	PaymentDesc   string     `json:"payment_desc" example:"Credit card payment"`
+	PaymentStatus string          `json:"payment_status" binding:"required" example:"paid"`
+	Amount        decimal.Decimal `json:"amount" binding:"required" example:"99.99"`
+	PaymentRef    string          `json:"payment_ref" example:"REF123456"`
+	PaymentDate   *time.Time      `json:"payment_date" example:"2024-11-03T00:00:00Z"`
+	PaymentMethod int64           `json:"payment_method" example:"1"`
+	PaymentDesc   string          `json:"payment_desc" example:"Credit card payment"`
 }
 
 // CreateOrder godoc
@@ -56,13 +60,16 @@ func CreateOrder(c *gin.Context) {
 	order := dbmodels.Order{
 		ClientID: req.ClientID,
 		UserID:   userID,
-		Total:    req.Total,
+		Total:    money.Round(req.Total),
 		Status:   dbmodels.OrderStatus_PENDING,
 	}
+	order.Currency = storeCurrency(userID)
+	order.BaseCurrency = order.Currency
+	order.BaseTotal = order.Total
 
 	//   Send notification
 	if globalStore.NotifService != nil {
-		go globalStore.NotifService.NotifyNewOrder(userID, order.ID, order.Total)
+		go globalStore.NotifService.NotifyNewOrder(userID, order.ID, order.Total, order.Currency)
 	}
 	if err := globalStore.StStore.CreateOrder(&order); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
@@ -110,7 +117,8 @@ func GetOrders(c *gin.Context) {
 
 // UpdateOrderStatus godoc
 // @Summary      Update order status
-// @Description  Update the status of an order
+// @Description  Update the status of an order. Marking an order SHIPPED books its unshipped items with a carrier
+// @Description  (the default one unless "carrier" is given); use the shipments endpoints for partial shipments.
 // @Tags         Orders
 // @Accept       json
 // @Produce      json
@@ -128,7 +136,8 @@ func UpdateOrderStatus(c *gin.Context) {
 	}
 
 	var req struct {
-		Status string `json:"status" binding:"required"`
+		Status  string `json:"status" binding:"required"`
+		Carrier string `json:"carrier"` // Used when marking SHIPPED
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -157,6 +166,38 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
+	// Shipping goes through a carrier so there is a tracking number and label on
+	// record; stores whose package leaves out shipping, or platforms without a
+	// carrier, ship orders themselves
+	if status == dbmodels.OrderStatus_SHIPPED && globalStore.Shipping.Carriers.HasCarriers() &&
+		globalStore.StStore.CheckFeature(order.UserID, globalStore.Config.GetFreePackageID(), dbmodels.Feature_SHIPPING) == nil {
+		shipped, err := globalStore.StStore.GetShippedQuantities(order.ID)
+		if err != nil {
+			respondShipmentError(c, err)
+			return
+		}
+		if len(shipped) == 0 {
+			order, err = globalStore.StStore.GetOrderWithItems(order.ID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+				return
+			}
+			shipment, err := shipOrder(c.Request.Context(), order, req.Carrier, nil, "")
+			if err != nil {
+				respondShipmentError(c, err)
+				return
+			}
+			if globalStore.NotifService != nil {
+				go globalStore.NotifService.NotifyOrderStatusChange(order.UserID, order.ID, req.Status)
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"message":  "Order status updated successfully",
+				"shipment": shipment,
+			})
+			return
+		}
+	}
+
 	if err := globalStore.StStore.UpdateOrderStatus(uint(id), status); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
 		return
@@ -166,6 +207,13 @@ func UpdateOrderStatus(c *gin.Context) {
 	if globalStore.NotifService != nil {
 		go globalStore.NotifService.NotifyOrderStatusChange(order.UserID, order.ID, req.Status)
 	}
+	if status == dbmodels.OrderStatus_DELIVERED {
+		go globalStore.Receipts.SendAutomatically(order.ID, dbmodels.ReceiptTriggerDelivered)
+		// Delivered without carrier tracking: cash on delivery goes to the review queue
+		if _, err := globalStore.StStore.ReportCashCollected(order.ID, "store"); err != nil {
+			log.Printf("Failed to record cash collection for order %d: %v", order.ID, err)
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully"})
 }
@@ -271,7 +319,7 @@ func UpdateOrderPayment(c *gin.Context) {
 	// Update order payment details
 	if err := globalStore.StStore.UpdateOrderPayment(uint(id), stores.PaymentUpdate{
 		PaymentStatus: req.PaymentStatus,
-		Amount:        req.Amount,
+		Amount:        money.Round(req.Amount),
 		PaymentRef:    req.PaymentRef,
 		PaymentDate:   req.PaymentDate,
 		PaymentMethod: req.PaymentMethod,
@@ -281,5 +329,9 @@ func UpdateOrderPayment(c *gin.Context) {
 		return
 	}
 
+	if strings.EqualFold(req.PaymentStatus, dbmodels.PaymentStatus_PAID.String()) {
+		go globalStore.Receipts.SendAutomatically(uint(id), dbmodels.ReceiptTriggerPaid)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Order payment updated successfully"})
 }
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/payment"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+	"github.com/shopspring/decimal"
+)
+
+// ========== STOREFRONT ORDER PAYMENT ==========
+
+type OrderPaymentRequest struct {
+	PaymentMethod string `json:"payment_method" binding:"required" example:"paymob"` // Gateway name, e.g. fawry, paymob or sandbox, wallet, or an offline method: cod, bank_transfer or instapay
+}
+
+type OrderPaymentResponse struct {
+	OrderID         uint            `json:"order_id" example:"42"`
+	PaymentID       uint            `json:"payment_id" example:"17"`
+	PaymentURL      string          `json:"payment_url,omitempty"`
+	ReferenceNumber string          `json:"reference_number,omitempty"`
+	Amount          decimal.Decimal `json:"amount" example:"249.50"`
+	Message         string          `json:"message"`
+	ExpiresAt       *time.Time      `json:"expires_at,omitempty"`
+}
+
+// PayOrder starts an online payment for a storefront order
+// @Summary Pay for an order online
+// @Description Initiates a payment through one of the enabled gateways (fawry, paymob, sandbox) for an unpaid order. The gateway callback marks the order as paid and generates its receipt. Guests authorize with the order_token returned at checkout. Signed-in shoppers may pay with "wallet", which debits their wallet and marks the order paid at once. Offline methods (cod, bank_transfer, instapay) return payment instructions; the order is paid once the store confirms the courier's collection or the uploaded proof of transfer. Starting a payment cancels the order's pending one; a payment that still completes afterwards while the order is already paid is flagged with needs_refund instead of settling the order again.
+// @Tags Shopping Cart
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Param X-Order-Token header string false "Order token returned by guest checkout"
+// @Param request body OrderPaymentRequest true "Payment method"
+// @Success 200 {object} OrderPaymentResponse "Payment initiated"
+// @Failure 400 {object} map[string]string "Invalid request or order already paid"
+// @Failure 402 {object} map[string]string "Insufficient wallet balance"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Order not found"
+// @Failure 409 {object} map[string]string "Proof of a transfer for this order is awaiting review"
+// @Router /api/customer-website/orders/{id}/pay [post]
+func PayOrder(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req OrderPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := globalStore.StStore.GetOrderWithItems(uint(orderID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if !canAccessOrder(c, order) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	var payerID *uint
+	if claims, err := utils.GetclamsFromContext(c); err == nil {
+		payerID = &claims.UserID
+	}
+
+	response, err := initiateOrderPayment(c.Request.Context(), order, req.PaymentMethod, payerID)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if customErr, ok := err.(*stores.CustomError); ok {
+			code = customErr.Code
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// canAccessOrder allows the store owner, or a guest holding the order's checkout token
+func canAccessOrder(c *gin.Context, order *dbmodels.Order) bool {
+	if claims, err := utils.GetclamsFromContext(c); err == nil && claims.UserID == order.UserID {
+		return true
+	}
+	token := c.GetHeader("X-Order-Token")
+	return token != "" && order.CheckoutToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(order.CheckoutToken)) == 1
+}
+
+// initiateOrderPayment creates a pending Payment linked to the order and
+// registers it with the chosen gateway, or pays it from the signed-in payer's
+// wallet. The order must be loaded with items and client.
+func initiateOrderPayment(ctx context.Context, order *dbmodels.Order, method string, payerID *uint) (*OrderPaymentResponse, error) {
+	if order.PaymentStatus == dbmodels.PaymentStatus_PAID.String() {
+		return nil, &stores.CustomError{Message: "Order is already paid", Code: http.StatusBadRequest}
+	}
+	if order.Status == dbmodels.OrderStatus_CANCELED {
+		return nil, &stores.CustomError{Message: "Order is canceled", Code: http.StatusBadRequest}
+	}
+
+	if err := checkOrderPaymentMethod(method); err != nil {
+		return nil, err
+	}
+	if method == dbmodels.WalletPaymentMethod && payerID == nil {
+		return nil, &stores.CustomError{Message: "Sign in to pay from your wallet", Code: http.StatusUnauthorized}
+	}
+	payee, err := storePayee(order.UserID, method)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	paymentdb := dbmodels.Payment{
+		UserID:          order.UserID,
+		Purpose:         dbmodels.PaymentPurpose_ORDER,
+		OrderID:         &order.ID,
+		Amount:          order.Total,
+		Currency:        order.Currency,
+		PaymentMethod:   method,
+		PaymentStatus:   dbmodels.PaymentStatus_PENDING,
+		ReferenceNumber: payment.NewReference(fmt.Sprintf("ORD-%d", order.ID)),
+		ExpiresAt:       &expiresAt,
+	}
+
+	if err := globalStore.StStore.CreateOrderPayment(&paymentdb); err != nil {
+		return nil, err
+	}
+
+	if method == dbmodels.WalletPaymentMethod {
+		if _, err := payFromWallet(&paymentdb, *payerID); err != nil {
+			return nil, err
+		}
+		return &OrderPaymentResponse{
+			OrderID:   order.ID,
+			PaymentID: paymentdb.ID,
+			Amount:    paymentdb.Amount,
+			Message:   "Order paid from wallet",
+		}, nil
+	}
+
+	items := make([]payment.Item, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, payment.Item{
+			ID:          fmt.Sprintf("PRD-%d", item.ProductID),
+			Name:        item.Product.Name,
+			Description: item.Product.Description,
+			Price:       item.Price,
+			Quantity:    item.Quantity,
+		})
+	}
+
+	result, err := startGatewayPayment(ctx, &paymentdb, payment.InitiateRequest{
+		Description: fmt.Sprintf("Order #%d", order.ID),
+		Customer: payment.Customer{
+			Name:    order.Client.Name,
+			Email:   order.Client.Email,
+			Phone:   order.Phone,
+			Address: order.Address,
+		},
+		Items: items,
+		Payee: payee,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &OrderPaymentResponse{
+		OrderID:         order.ID,
+		PaymentID:       paymentdb.ID,
+		PaymentURL:      result.PaymentURL,
+		ReferenceNumber: result.ReferenceNumber,
+		Amount:          paymentdb.Amount,
+		Message:         result.Message,
+		ExpiresAt:       paymentdb.ExpiresAt,
+	}, nil
+}
+
+// storePayee returns the store's account for an order paid by bank transfer or
+// InstaPay, which goes to the store rather than the platform. Other methods
+// have no payee.
+func storePayee(storeID uint, method string) (*payment.TransferAccount, error) {
+	offline, ok := globalStore.Payments.Offline(method)
+	if !ok || offline.CashOnDelivery() {
+		return nil, nil
+	}
+	payee := &payment.TransferAccount{}
+	if account, err := globalStore.StStore.GetPaymentAccount(storeID); err == nil {
+		payee = &payment.TransferAccount{
+			BankName:        account.BankName,
+			AccountName:     account.AccountName,
+			AccountNumber:   account.AccountNumber,
+			InstaPayAddress: account.InstaPayAddress,
+		}
+	}
+	if !payee.Accepts(method) {
+		return nil, &stores.CustomError{
+			Message: fmt.Sprintf("This store does not accept %s payments", strings.ReplaceAll(method, "_", " ")),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return payee, nil
+}
+
+// completeOrderPayment follows up an order payment once it is recorded: it
+// notifies the store, generates the receipt if one does not exist yet and emails
+// it to the customer.
+func completeOrderPayment(paymentdb *dbmodels.Payment) {
+	order, err := globalStore.StStore.GetOrderWithItems(*paymentdb.OrderID)
+	if err != nil {
+		log.Printf("Failed to load paid order %d: %v", *paymentdb.OrderID, err)
+		return
+	}
+
+	if globalStore.NotifService != nil {
+		go globalStore.NotifService.NotifyOrderPaid(order.UserID, order.ID, paymentdb.Amount, paymentdb.Currency)
+	}
+
+	// The gateway has already been paid; a receipt failure should not fail the callback
+	if _, err := globalStore.Receipts.IssueForOrder(order); err != nil {
+		log.Printf("Failed to generate receipt for order %d: %v", order.ID, err)
+	}
+	go globalStore.Receipts.SendAutomatically(order.ID, dbmodels.ReceiptTriggerPaid)
+}
@@ -2,37 +2,51 @@
 package controllers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/billing"
+	"github.com/mohammedrefaat/hamber/money"
 	"github.com/mohammedrefaat/hamber/payment"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/shopspring/decimal"
 )
 
 // ========== PACKAGE CHANGE REQUEST ==========
 
 type ChangePackageRequest struct {
 	NewPackageID  uint   `json:"new_package_id" binding:"required"`
-	PaymentMethod string `json:"payment_method" binding:"required,oneof=fawry paymob"`
+	PaymentMethod string `json:"payment_method" binding:"required"` // Gateway name, e.g. fawry, paymob or sandbox, bank_transfer or instapay, or wallet
 	Reason        string `json:"reason"`
 }
 
 type ChangePackageResponse struct {
-	PackageChangeID uint       `json:"package_change_id"`
-	PaymentID       uint       `json:"payment_id"`
-	PaymentURL      string     `json:"payment_url,omitempty"`
-	ReferenceNumber string     `json:"reference_number,omitempty"`
-	Message         string     `json:"message"`
-	Amount          float64    `json:"amount"`
-	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	PackageChangeID uint            `json:"package_change_id"`
+	PaymentID       uint            `json:"payment_id"`
+	PaymentURL      string          `json:"payment_url,omitempty"`
+	ReferenceNumber string          `json:"reference_number,omitempty"`
+	Message         string          `json:"message"`
+	Amount          decimal.Decimal `json:"amount"`
+	Quote           *billing.Quote  `json:"quote"`
+	ExpiresAt       *time.Time      `json:"expires_at,omitempty"`
 }
 
 // RequestPackageChange godoc
 // @Summary      Request package change
-// @Description  Request to upgrade or downgrade package
+// @Description  Request to upgrade or downgrade package. Upgrades are charged now, less credit for the unused days of the current subscription, and apply once paid; downgrades are charged in full and apply when the current period ends.
 // @Tags         Payments
 // @Accept       json
 // @Produce      json
@@ -40,6 +54,7 @@ type ChangePackageResponse struct {
 // @Param        request body ChangePackageRequest true "Package change request"
 // @Success      200 {object} ChangePackageResponse "Change request created"
 // @Failure      400 {object} map[string]interface{} "Invalid request"
+// @Failure      409 {object} map[string]interface{} "A package change is already scheduled"
 // @Router       /payment/change-package [post]
 func RequestPackageChange(c *gin.Context) {
 	userID, _ := c.Get("user_id")
@@ -52,58 +67,40 @@ func RequestPackageChange(c *gin.Context) {
 		return
 	}
 
-	// Get current user
-	user, err := globalStore.StStore.GetUser(userID.(uint))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "User not found",
-		})
-		return
-	}
-
-	// Check if user is trying to change to the same package
-	if user.PackageID == req.NewPackageID {
+	if err := checkPaymentMethodOrWallet(req.PaymentMethod); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "You are already on this package",
-		})
-		return
-	}
-
-	// Get new package details
-	newPackage, err := globalStore.StStore.GetPackage(req.NewPackageID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Package not found",
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// Get old package details
-	//oldPackage
-	_, err = globalStore.StStore.GetPackage(user.PackageID)
+	user, newPackage, quote, err := preparePackageChange(userID.(uint), req.NewPackageID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Current package not found",
+		c.JSON(err.(*stores.CustomError).Code, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// Calculate payment amount
-	amount := newPackage.Price
+	// Upgrades are charged less the unused part of the current period;
+	// downgrades are charged in full and start when the period ends
+	amount := quote.AmountDue
 
-	// Check if payment is required (free packages or downgrades might not require payment)
-	requiresPayment := amount > 0
+	// Check if payment is required (free packages or fully credited upgrades)
+	requiresPayment := amount.IsPositive()
 
 	// Create payment record
 	expiresAt := time.Now().Add(24 * time.Hour)
 	paymentdb := dbmodels.Payment{
-		UserID:        user.ID,
-		PackageID:     req.NewPackageID,
-		Amount:        amount,
-		Currency:      "EGP",
-		PaymentMethod: req.PaymentMethod,
-		PaymentStatus: dbmodels.PaymentStatus_PENDING,
-		ExpiresAt:     &expiresAt,
+		UserID:          user.ID,
+		Purpose:         dbmodels.PaymentPurpose_PACKAGE_CHANGE,
+		PackageID:       &req.NewPackageID,
+		Amount:          amount,
+		Currency:        globalStore.Config.GetBaseCurrency(),
+		PaymentMethod:   req.PaymentMethod,
+		PaymentStatus:   dbmodels.PaymentStatus_PENDING,
+		ReferenceNumber: payment.NewReference(fmt.Sprintf("PKG-%d", user.ID)),
+		ExpiresAt:       &expiresAt,
 	}
 
 	if err := globalStore.StStore.CreatePayment(&paymentdb); err != nil {
@@ -122,6 +119,7 @@ func RequestPackageChange(c *gin.Context) {
 		Status:       dbmodels.ChangeStatus_PENDING,
 		ChangeReason: req.Reason,
 	}
+	quote.Apply(&packageChange)
 
 	if err := globalStore.StStore.CreatePackageChange(&packageChange); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -134,146 +132,255 @@ func RequestPackageChange(c *gin.Context) {
 		PackageChangeID: packageChange.ID,
 		PaymentID:       paymentdb.ID,
 		Amount:          amount,
+		Quote:           quote,
 		ExpiresAt:       &expiresAt,
 	}
 
-	// If payment is required, initiate payment with chosen method
-	if requiresPayment {
-		switch req.PaymentMethod {
-		case "fawry":
-			if !globalStore.Config.IsFawryEnabled() {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": "Fawry payment is not enabled",
-				})
-				return
-			}
+	// If payment is required, pay from the wallet or initiate payment with chosen gateway
+	if requiresPayment && req.PaymentMethod == dbmodels.WalletPaymentMethod {
+		if _, err := payFromWallet(&paymentdb, user.ID); err != nil {
+			c.JSON(err.(*stores.CustomError).Code, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		response.Message = "Package changed successfully (paid from wallet)"
+		if !quote.Immediate {
+			response.Message = fmt.Sprintf("Package change scheduled for %s (paid from wallet)", quote.EffectiveAt.Format("2006-01-02"))
+		}
+	} else if requiresPayment {
+		result, err := startGatewayPayment(c.Request.Context(), &paymentdb, payment.InitiateRequest{
+			Description: fmt.Sprintf("Package: %s", newPackage.Name),
+			Customer: payment.Customer{
+				Name:  user.Name,
+				Email: user.Email,
+				Phone: user.Phone,
+			},
+			Items: []payment.Item{{
+				ID:          fmt.Sprintf("PKG-%d", newPackage.ID),
+				Name:        newPackage.Name,
+				Description: newPackage.Description,
+				Price:       amount,
+				Quantity:    1,
+			}},
+		})
+		if err != nil {
+			c.JSON(err.(*stores.CustomError).Code, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 
-			fawryService := payment.NewFawryService(globalStore.Config.GetFawryConfig())
-			fawryResp, err := fawryService.InitiatePayment(&paymentdb, user, newPackage)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": "Failed to initiate Fawry payment: " + err.Error(),
-				})
-				return
-			}
+		response.PaymentURL = result.PaymentURL
+		response.ReferenceNumber = result.ReferenceNumber
+		response.Message = result.Message
+		response.ExpiresAt = paymentdb.ExpiresAt
+	} else {
+		// No payment required, approve immediately
+		if _, err := applyPaymentResult(&paymentdb, dbmodels.PaymentStatus_PAID, "NO_PAYMENT_REQUIRED", 0); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		response.Message = "Package changed successfully (no payment required)"
+		if !quote.Immediate {
+			response.Message = fmt.Sprintf("Package change scheduled for %s (no payment required)", quote.EffectiveAt.Format("2006-01-02"))
+		}
+	}
 
-			// Update payment with reference number
-			paymentdb.ReferenceNumber = fawryResp.ReferenceNumber
-			globalStore.StStore.UpdatePaymentStatus(paymentdb.ID, dbmodels.PaymentStatus_PENDING, "")
+	c.JSON(http.StatusOK, response)
+}
 
-			response.ReferenceNumber = fawryResp.ReferenceNumber
-			response.Message = fmt.Sprintf("Please pay at any Fawry location using reference number: %s", fawryResp.ReferenceNumber)
+// GetPackageChangeQuote godoc
+// @Summary      Preview a package change
+// @Description  Prices a move to another package without committing to it. Upgrades are charged now, less credit for the unused days of the current subscription; downgrades are charged in full and start when the current period ends.
+// @Tags         Payments
+// @Produce      json
+// @Security     Bearer
+// @Param        package_id query int true "New package ID"
+// @Success      200 {object} billing.Quote "Proration breakdown"
+// @Failure      400 {object} map[string]interface{} "Invalid request"
+// @Failure      409 {object} map[string]interface{} "A package change is already scheduled"
+// @Router       /payment/change-package/quote [get]
+func GetPackageChangeQuote(c *gin.Context) {
+	userID, _ := c.Get("user_id")
 
-		case "paymob":
-			if !globalStore.Config.IsPaymobEnabled() {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": "Paymob payment is not enabled",
-				})
-				return
-			}
+	packageID, err := strconv.ParseUint(c.Query("package_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid package ID"})
+		return
+	}
 
-			paymobService := payment.NewPaymobService(globalStore.Config.GetPaymobConfig())
-			paymentURL, err := paymobService.InitiatePayment(&paymentdb, user, newPackage)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": "Failed to initiate Paymob payment: " + err.Error(),
-				})
-				return
-			}
+	_, _, quote, err := preparePackageChange(userID.(uint), uint(packageID))
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, quote)
+}
+
+// preparePackageChange checks that the user can move to the new package and
+// prices the move from their active subscription. Errors are *stores.CustomError.
+func preparePackageChange(userID, newPackageID uint) (*dbmodels.User, *dbmodels.Package, *billing.Quote, error) {
+	// Get current user
+	user, err := globalStore.StStore.GetUser(userID)
+	if err != nil {
+		return nil, nil, nil, &stores.CustomError{Message: "User not found", Code: http.StatusNotFound}
+	}
+
+	// Check if user is trying to change to the same package
+	if user.PackageID == newPackageID {
+		return nil, nil, nil, &stores.CustomError{Message: "You are already on this package", Code: http.StatusBadRequest}
+	}
 
-			response.PaymentURL = paymentURL
-			response.Message = "Please complete payment using the provided URL"
+	// One change at a time: a scheduled downgrade is already paid for
+	if scheduled, err := globalStore.StStore.GetScheduledPackageChange(user.ID); err == nil {
+		return nil, nil, nil, &stores.CustomError{
+			Message: fmt.Sprintf("A change to %s is already scheduled for %s", scheduled.NewPackage.Name, scheduled.EffectiveAt.Format("2006-01-02")),
+			Code:    http.StatusConflict,
 		}
-	} else {
-		// No payment required, approve immediately
-		globalStore.StStore.UpdatePaymentStatus(paymentdb.ID, dbmodels.PaymentStatus_PAID, "NO_PAYMENT_REQUIRED")
-		globalStore.StStore.CompletePackageChange(packageChange.ID, req.NewPackageID)
-		response.Message = "Package changed successfully (no payment required)"
 	}
 
-	c.JSON(http.StatusOK, response)
+	// Get new package details
+	newPackage, err := globalStore.StStore.GetPackage(newPackageID)
+	if err != nil {
+		return nil, nil, nil, &stores.CustomError{Message: "Package not found", Code: http.StatusNotFound}
+	}
+
+	// Get old package details
+	oldPackage, err := globalStore.StStore.GetPackage(user.PackageID)
+	if err != nil {
+		return nil, nil, nil, &stores.CustomError{Message: "Current package not found", Code: http.StatusNotFound}
+	}
+
+	now := time.Now()
+	current, _ := globalStore.StStore.GetActiveSubscription(user.ID, now)
+	return user, newPackage, billing.QuotePackageChange(current, oldPackage, newPackage, now), nil
 }
 
-// ========== FAWRY CALLBACK ==========
-
-type FawryCallbackRequest struct {
-	RequestID        string  `json:"requestId"`
-	FawryRefNumber   string  `json:"fawryRefNumber"`
-	MerchantRefNum   string  `json:"merchantRefNumber"`
-	OrderAmount      float64 `json:"orderAmount"`
-	PaymentAmount    float64 `json:"paymentAmount"`
-	OrderStatus      string  `json:"orderStatus"`
-	PaymentMethod    string  `json:"paymentMethod"`
-	MessageSignature string  `json:"messageSignature"`
+// checkPaymentMethod rejects payment methods without an enabled gateway. Cash on
+// delivery is only for storefront orders, see checkOrderPaymentMethod.
+func checkPaymentMethod(method string) error {
+	if method == dbmodels.CashOnDeliveryPaymentMethod && globalStore.Payments.Has(method) {
+		return &stores.CustomError{
+			Message: "Cash on delivery is only available for storefront orders",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	if !globalStore.Payments.Has(method) {
+		return &stores.CustomError{
+			Message: fmt.Sprintf("Unsupported payment method %q, available: %s", method, strings.Join(globalStore.Payments.Names(), ", ")),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return nil
 }
 
-func FawryCallback(c *gin.Context) {
-	var req FawryCallbackRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid callback data",
-		})
-		return
+// checkOrderPaymentMethod is checkPaymentMethodOrWallet that also accepts cash
+// on delivery, for storefront orders
+func checkOrderPaymentMethod(method string) error {
+	if method == dbmodels.CashOnDeliveryPaymentMethod && globalStore.Payments.Has(method) {
+		return nil
 	}
+	return checkPaymentMethodOrWallet(method)
+}
 
-	fawryService := payment.NewFawryService(globalStore.Config.GetFawryConfig())
-	if !fawryService.VerifyCallback(req.MessageSignature, req.FawryRefNumber, req.PaymentAmount, req.OrderStatus) {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid signature",
+// startGatewayPayment registers a stored pending payment with its gateway and
+// records the gateway's order ID, so callbacks and status queries can find it.
+// Errors are *stores.CustomError.
+func startGatewayPayment(ctx context.Context, paymentdb *dbmodels.Payment, req payment.InitiateRequest) (*payment.InitiateResult, error) {
+	return globalStore.Payments.Start(ctx, globalStore.StStore, paymentdb, req)
+}
+
+// ========== GATEWAY CALLBACK ==========
+
+// PaymentCallback godoc
+// @Summary      Payment gateway callback
+// @Description  Server-to-server notification from a payment gateway (fawry, paymob, sandbox). The gateway verifies the signature; a paid payment completes its order or package change.
+// @Tags         Payments
+// @Accept       json
+// @Produce      json
+// @Param        gateway path string true "Gateway name"
+// @Success      200 {object} map[string]interface{} "Callback processed"
+// @Failure      400 {object} map[string]interface{} "Invalid callback data, or the amount or currency does not match the payment"
+// @Failure      401 {object} map[string]interface{} "Invalid signature"
+// @Failure      404 {object} map[string]interface{} "Unknown gateway or payment"
+// @Router       /payment/{gateway}/callback [post]
+func PaymentCallback(c *gin.Context) {
+	gateway, err := globalStore.Payments.Get(c.Param("gateway"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Unknown payment gateway",
 		})
 		return
 	}
 
-	payment, err := globalStore.StStore.GetPaymentByReference(req.FawryRefNumber)
+	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Payment not found",
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid callback data",
 		})
 		return
 	}
 
-	var newStatus dbmodels.PaymentStatus
-	switch req.OrderStatus {
-	case "PAID":
-		newStatus = dbmodels.PaymentStatus_PAID
-		// NEW: Send success notification
-		if globalStore.NotifService != nil {
-			go globalStore.NotifService.NotifyPaymentSuccess(payment.UserID, payment.ID, payment.Amount)
-		}
-	case "FAILED":
-		newStatus = dbmodels.PaymentStatus_FAILED
-		// NEW: Send failure notification
-		if globalStore.NotifService != nil {
-			go globalStore.NotifService.NotifyPaymentFailed(payment.UserID, payment.ID, "Payment processing failed")
+	// Every callback is stored as received, valid or not
+	callback := payment.Callback{
+		Body:   body,
+		Query:  c.Request.URL.Query(),
+		Header: c.Request.Header,
+	}
+	event := newPaymentEvent(gateway.Name(), callback)
+	result, verifyErr := gateway.VerifyCallback(callback)
+	if verifyErr != nil {
+		// Rejected events are keyed by their content, so a forged callback cannot
+		// take the event ID of a genuine one
+		event.EventID = "invalid-" + payloadHash(body)
+		event.Status = dbmodels.PaymentEventStatus_INVALID
+		event.Error = verifyErr.Error()
+		globalStore.StStore.RecordPaymentEvent(event)
+
+		if errors.Is(verifyErr, payment.ErrInvalidSignature) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid signature",
+			})
+			return
 		}
-	case "CANCELED":
-		newStatus = dbmodels.PaymentStatus_CANCELLED
-	case "EXPIRED":
-		newStatus = dbmodels.PaymentStatus_EXPIRED
-	default:
-		newStatus = dbmodels.PaymentStatus_PENDING
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid callback data",
+		})
+		return
+	}
+
+	event.EventID = result.EventID
+	if event.EventID == "" {
+		event.EventID = payloadHash(body)
 	}
+	event.ReportedStatus = result.Status
+	event.TransactionID = result.TransactionID
 
-	if err := globalStore.StStore.UpdatePaymentStatus(payment.ID, newStatus, req.FawryRefNumber); err != nil {
+	isNew, err := globalStore.StStore.RecordPaymentEvent(event)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to update payment status",
+			"error": err.Error(),
+		})
+		return
+	}
+	if !isNew && event.Status.IsSettled() {
+		// A redelivery of an event already handled: acknowledge it so the gateway stops retrying
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "duplicate",
+			"message": "Payment callback already processed",
 		})
 		return
 	}
 
-	if newStatus == dbmodels.PaymentStatus_PAID {
-		if err := globalStore.StStore.CompletePackageChange(payment.ID, payment.PackageID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to complete package change",
-			})
-			return
-		}
-
-		// Get package info for notification
-		pkg, _ := globalStore.StStore.GetPackage(payment.PackageID)
-		if pkg != nil && globalStore.NotifService != nil {
-			go globalStore.NotifService.NotifyPackageChange(payment.UserID, "old", pkg.Name)
-		}
+	code, err := processPaymentEvent(gateway, event, result)
+	if err != nil {
+		c.JSON(code, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -282,88 +389,158 @@ func FawryCallback(c *gin.Context) {
 	})
 }
 
-// ========== PAYMOB CALLBACK ==========
+// newPaymentEvent stores the raw request of a callback. Credentials are not kept.
+func newPaymentEvent(gateway string, callback payment.Callback) *dbmodels.PaymentEvent {
+	headers := callback.Header.Clone()
+	headers.Del("Authorization")
+	headers.Del("Cookie")
+	headersJSON, _ := json.Marshal(headers)
 
-type PaymobCallbackRequest struct {
-	Type   string                 `json:"type"`
-	Object map[string]interface{} `json:"obj"`
+	return &dbmodels.PaymentEvent{
+		Gateway: gateway,
+		Payload: string(callback.Body),
+		Query:   callback.Query.Encode(),
+		Headers: string(headersJSON),
+		Status:  dbmodels.PaymentEventStatus_RECEIVED,
+	}
 }
 
-func PaymobCallback(c *gin.Context) {
-	var req PaymobCallbackRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid callback data",
-		})
-		return
-	}
+// payloadHash keys events the gateway gives no ID for
+func payloadHash(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
 
-	// Extract data from callback
-	obj := req.Object
-	success := obj["success"].(string)
-	amountCents := fmt.Sprintf("%.0f", obj["amount_cents"].(float64))
-	currency := obj["currency"].(string)
-	orderId := fmt.Sprintf("%.0f", obj["order"].(map[string]interface{})["id"].(float64))
-	merchantOrderId := obj["order"].(map[string]interface{})["merchant_order_id"].(string)
-	hmac := obj["hmac"].(string)
+// processPaymentEvent applies a verified event to its payment. A failure is
+// recorded on the event, which stays open for a gateway retry or a replay.
+func processPaymentEvent(gateway payment.Gateway, event *dbmodels.PaymentEvent, result *payment.CallbackResult) (int, error) {
+	paymentdb, err := findCallbackPayment(result)
+	if err != nil || paymentdb.PaymentMethod != gateway.Name() {
+		globalStore.StStore.MarkPaymentEvent(event.ID, dbmodels.PaymentEventStatus_FAILED, "payment not found")
+		return http.StatusNotFound, fmt.Errorf("Payment not found")
+	}
+	if event.PaymentID == nil {
+		globalStore.StStore.SetPaymentEventPayment(event.ID, paymentdb.ID)
+		event.PaymentID = &paymentdb.ID
+	}
 
-	// Verify HMAC
-	paymobService := payment.NewPaymobService(globalStore.Config.GetPaymobConfig())
-	if !paymobService.VerifyCallback(hmac, amountCents, currency, success, orderId, merchantOrderId) {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid HMAC signature",
-		})
-		return
+	// A genuine notification for a different charge must not settle this payment
+	if mismatch := callbackMismatch(paymentdb, result); mismatch != "" {
+		log.Printf("Payment %d: %s callback rejected, %s", paymentdb.ID, gateway.Name(), mismatch)
+		globalStore.StStore.MarkPaymentEvent(event.ID, dbmodels.PaymentEventStatus_INVALID, mismatch)
+		return http.StatusBadRequest, fmt.Errorf("Payment amount does not match")
 	}
 
-	// Extract transaction ID
-	transactionID := fmt.Sprintf("%.0f", obj["id"].(float64))
+	if _, err := applyPaymentResult(paymentdb, result.Status, result.TransactionID, event.ID); err != nil {
+		globalStore.StStore.MarkPaymentEvent(event.ID, dbmodels.PaymentEventStatus_FAILED, err.Error())
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
 
-	// Find payment by merchant order ID or transaction ID
-	// Parse payment ID from merchant order ID (format: PKG-{userID}-{timestamp})
-	var payment *dbmodels.Payment
-	// You might need to store paymob_order_id in payment table to find it easier
+// callbackMismatch describes how a callback's amount or currency differs from the
+// payment, or returns "" when they match or the gateway did not report them
+func callbackMismatch(paymentdb *dbmodels.Payment, result *payment.CallbackResult) string {
+	if !result.Amount.IsZero() && !result.Amount.Equal(paymentdb.Amount) {
+		return fmt.Sprintf("amount %s does not match %s", money.Format(result.Amount), money.Format(paymentdb.Amount))
+	}
+	if result.Currency != "" && !strings.EqualFold(result.Currency, paymentdb.Currency) {
+		return fmt.Sprintf("currency %s does not match %s", result.Currency, paymentdb.Currency)
+	}
+	return ""
+}
 
-	// For now, we'll try to find by transaction ID
-	payment, err := globalStore.StStore.GetPaymentByTransactionID(transactionID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Payment not found",
-		})
-		return
+// findCallbackPayment looks a payment up by our reference, then by the gateway's
+// order ID, then by transaction ID. Payments made before merchant references were
+// stored kept the Fawry reference number as their reference.
+func findCallbackPayment(result *payment.CallbackResult) (*dbmodels.Payment, error) {
+	if result.ReferenceNumber != "" {
+		if found, err := globalStore.StStore.GetPaymentByReference(result.ReferenceNumber); err == nil {
+			return found, nil
+		}
 	}
+	if result.GatewayOrderID != "" {
+		if found, err := globalStore.StStore.GetPaymentByGatewayOrderID(result.GatewayOrderID); err == nil {
+			return found, nil
+		}
+		if found, err := globalStore.StStore.GetPaymentByReference(result.GatewayOrderID); err == nil {
+			return found, nil
+		}
+	}
+	if result.TransactionID != "" {
+		return globalStore.StStore.GetPaymentByTransactionID(result.TransactionID)
+	}
+	return nil, &stores.CustomError{Message: "Payment not found", Code: http.StatusNotFound}
+}
 
-	// Update payment status
-	var newStatus dbmodels.PaymentStatus
-	if success == "true" {
-		newStatus = dbmodels.PaymentStatus_PAID
-	} else {
-		newStatus = dbmodels.PaymentStatus_FAILED
+// applyPaymentResult moves the payment to the new status and completes whatever
+// it paid for in one transaction, then sends the notifications. Repeated or
+// out-of-order results are not applied, so it is safe for every callback, status
+// sync and replay. eventID marks the gateway event handled, when there is one.
+func applyPaymentResult(paymentdb *dbmodels.Payment, newStatus dbmodels.PaymentStatus, transactionID string, eventID uint) (*stores.PaymentTransition, error) {
+	transition, err := globalStore.StStore.TransitionPayment(paymentdb.ID, newStatus, transactionID, eventID)
+	if err != nil {
+		return nil, err
 	}
+	followUpPaymentTransition(transition)
+	return transition, nil
+}
 
-	if err := globalStore.StStore.UpdatePaymentStatus(payment.ID, newStatus, transactionID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to update payment status",
-		})
+// followUpPaymentTransition sends the notifications for an applied transition and
+// completes a paid order
+func followUpPaymentTransition(transition *stores.PaymentTransition) {
+	if !transition.Applied {
 		return
 	}
 
-	// If payment is successful, complete package change
-	if newStatus == dbmodels.PaymentStatus_PAID {
-		if err := globalStore.StStore.CompletePackageChange(payment.ID, payment.PackageID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to complete package change",
-			})
-			return
+	paid := &transition.Payment
+	if transition.WalletEntry != nil && globalStore.NotifService != nil {
+		go globalStore.NotifService.NotifyWalletBalance(transition.WalletEntry.UserID, transition.WalletEntry, paid.Currency)
+	}
+	switch paid.PaymentStatus {
+	case dbmodels.PaymentStatus_PAID:
+		if globalStore.NotifService != nil {
+			go globalStore.NotifService.NotifyPaymentSuccess(paid.UserID, paid.ID, paid.Amount, paid.Currency)
+		}
+		if paid.NeedsRefund {
+			log.Printf("Payment %d paid order %d a second time and needs a refund", paid.ID, *paid.OrderID)
+			if globalStore.NotifService != nil {
+				go globalStore.NotifService.NotifyDuplicatePayment(paid.UserID, paid.ID, *paid.OrderID, paid.Amount, paid.Currency)
+			}
+		} else if paid.Purpose == dbmodels.PaymentPurpose_ORDER {
+			completeOrderPayment(paid)
+		}
+		if transition.AddonSubscriptionID != 0 {
+			notifyAddonActivated(transition.AddonSubscriptionID)
+		}
+		if transition.PackageChangeID != 0 {
+			// A scheduled change is announced when it takes effect
+			change, _ := globalStore.StStore.GetPackageChange(transition.PackageChangeID)
+			if change != nil && change.Status == dbmodels.ChangeStatus_COMPLETED && globalStore.NotifService != nil {
+				go globalStore.NotifService.NotifyPackageChange(paid.UserID, change.OldPackage.Name, change.NewPackage.Name)
+			}
+		}
+	case dbmodels.PaymentStatus_FAILED:
+		reason := "Payment processing failed"
+		if transition.FailureReason != "" {
+			reason = transition.FailureReason
+		}
+		if globalStore.NotifService != nil {
+			go globalStore.NotifService.NotifyPaymentFailed(paid.UserID, paid.ID, reason)
+		}
+	case dbmodels.PaymentStatus_EXPIRED:
+		// Only a package change or add-on subscription is undone by expiry; the
+		// user can start it again
+		if (transition.PackageChangeID != 0 || transition.AddonSubscriptionID != 0) && globalStore.NotifService != nil {
+			go globalStore.NotifService.NotifyPaymentFailed(paid.UserID, paid.ID, "Payment expired before it was completed")
 		}
-
-		// TODO: Send confirmation email to user
 	}
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "Payment callback processed",
-	})
+// ApplyPaymentStatus applies a status found by querying a gateway, for the
+// background reconciliation
+func ApplyPaymentStatus(paymentdb *dbmodels.Payment, status dbmodels.PaymentStatus, transactionID string) (*stores.PaymentTransition, error) {
+	return applyPaymentResult(paymentdb, status, transactionID, 0)
 }
 
 // ========== GET PAYMENT STATUS ==========
@@ -482,3 +659,203 @@ func GetAllPayments(c *gin.Context) {
 		"status":  status,
 	})
 }
+
+// ========== ADMIN: GATEWAY STATUS AND REFUNDS ==========
+
+type RefundPaymentRequest struct {
+	Reason   string `json:"reason" example:"Customer request"`
+	ToWallet bool   `json:"to_wallet" example:"false"` // Credit the user's wallet instead of refunding through the gateway
+}
+
+// loadPayment loads the payment in the :id path parameter, writing the error
+// response when it is missing
+func loadPayment(c *gin.Context) (*dbmodels.Payment, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return nil, false
+	}
+	paymentdb, err := globalStore.StStore.GetPayment(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return nil, false
+	}
+	return paymentdb, true
+}
+
+// loadGatewayPayment loads the payment in the :id path parameter with its gateway,
+// writing the error response when either is missing
+func loadGatewayPayment(c *gin.Context) (*dbmodels.Payment, payment.Gateway, bool) {
+	paymentdb, ok := loadPayment(c)
+	if !ok {
+		return nil, nil, false
+	}
+	gateway, err := globalStore.Payments.Get(paymentdb.PaymentMethod)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment gateway is not enabled: " + paymentdb.PaymentMethod})
+		return nil, nil, false
+	}
+	return paymentdb, gateway, true
+}
+
+// SyncPaymentStatus godoc
+// @Summary      Sync a payment with its gateway
+// @Description  Asks the payment's gateway for its current status and applies it, e.g. when a callback was missed
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Payment ID"
+// @Success      200 {object} map[string]interface{} "Gateway status"
+// @Failure      404 {object} map[string]interface{} "Payment not found"
+// @Failure      502 {object} map[string]interface{} "Gateway error"
+// @Router       /admin/payments/{id}/sync [post]
+func SyncPaymentStatus(c *gin.Context) {
+	paymentdb, gateway, ok := loadGatewayPayment(c)
+	if !ok {
+		return
+	}
+
+	status, err := gateway.QueryStatus(c.Request.Context(), paymentdb)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to query payment status: " + err.Error()})
+		return
+	}
+	globalStore.StStore.MarkPaymentChecked(paymentdb.ID, time.Now())
+
+	transition, err := applyPaymentResult(paymentdb, status.Status, status.TransactionID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"payment_id":     paymentdb.ID,
+		"gateway":        gateway.Name(),
+		"gateway_status": status.Status.String(),
+		"transaction_id": status.TransactionID,
+		"updated":        transition.Applied,
+	})
+}
+
+// RefundPayment godoc
+// @Summary      Refund a payment
+// @Description  Refunds the full amount of a paid payment through its gateway, or into the user's wallet with to_wallet. Wallet payments always go back to the wallet they were paid from. A refunded order payment marks the order as refunded, unless it was a duplicate flagged with needs_refund.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Payment ID"
+// @Param        request body RefundPaymentRequest false "Refund reason"
+// @Success      200 {object} map[string]interface{} "Payment refunded"
+// @Failure      400 {object} map[string]interface{} "Payment is not refundable"
+// @Failure      502 {object} map[string]interface{} "Gateway error"
+// @Router       /admin/payments/{id}/refund [post]
+func RefundPayment(c *gin.Context) {
+	var req RefundPaymentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	paymentdb, ok := loadPayment(c)
+	if !ok {
+		return
+	}
+	if paymentdb.PaymentStatus != dbmodels.PaymentStatus_PAID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only paid payments can be refunded"})
+		return
+	}
+
+	if req.ToWallet || paymentdb.PaymentMethod == dbmodels.WalletPaymentMethod {
+		transition, err := globalStore.StStore.RefundToWallet(paymentdb.ID, req.Reason)
+		if err != nil {
+			c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+			return
+		}
+		followUpPaymentTransition(transition)
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Payment refunded to wallet",
+			"payment_id":     paymentdb.ID,
+			"amount":         transition.WalletEntry.Amount,
+			"wallet_entry":   transition.WalletEntry,
+			"wallet_balance": transition.WalletEntry.BalanceAfter,
+		})
+		return
+	}
+
+	gateway, err := globalStore.Payments.Get(paymentdb.PaymentMethod)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment gateway is not enabled: " + paymentdb.PaymentMethod})
+		return
+	}
+
+	refund, err := gateway.Refund(c.Request.Context(), paymentdb, paymentdb.Amount, req.Reason)
+	if errors.Is(err, payment.ErrNotRefundable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to refund payment: " + err.Error()})
+		return
+	}
+
+	if _, err := applyPaymentResult(paymentdb, dbmodels.PaymentStatus_REFUNDED, "", 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Payment refunded",
+		"payment_id": paymentdb.ID,
+		"refund_id":  refund.RefundID,
+		"amount":     refund.Amount,
+	})
+}
+
+// ========== SANDBOX CHECKOUT ==========
+
+// SandboxCheckout godoc
+// @Summary      Sandbox checkout page
+// @Description  Simulated hosted payment page of the sandbox gateway. Posting an outcome (success or failure) sends the signed callback after the configured delay. Only available when the sandbox gateway is enabled.
+// @Tags         Payments
+// @Accept       x-www-form-urlencoded
+// @Produce      text/html
+// @Param        reference path string true "Payment reference"
+// @Param        outcome formData string false "success or failure"
+// @Success      200 {string} string "Checkout page"
+// @Failure      404 {object} map[string]interface{} "Unknown payment"
+// @Router       /payment/sandbox/checkout/{reference} [get]
+// @Router       /payment/sandbox/checkout/{reference} [post]
+func SandboxCheckout(c *gin.Context) {
+	sandbox, ok := globalStore.Payments.Sandbox()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sandbox gateway is not enabled"})
+		return
+	}
+
+	reference := c.Param("reference")
+	message := ""
+	if c.Request.Method == http.MethodPost {
+		outcome := c.DefaultPostForm("outcome", c.Query("outcome"))
+		if err := sandbox.Complete(reference, outcome); err != nil {
+			message = err.Error()
+		} else {
+			message = "Payment " + outcome + " submitted, the store is notified shortly"
+		}
+	}
+
+	sandboxPayment, err := sandbox.Lookup(reference)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := payment.RenderSandboxCheckout(&buf, sandboxPayment, message); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate HTML"})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/payment"
+	"github.com/mohammedrefaat/hamber/stores"
+)
+
+// ========== ADMIN: PAYMENT GATEWAY EVENTS ==========
+
+// GetPaymentEvents godoc
+// @Summary      List payment gateway events
+// @Description  Callbacks received from payment gateways, newest first, with their raw payload and processing status
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        gateway query string false "Gateway name"
+// @Param        status query string false "RECEIVED, PROCESSED, IGNORED, FAILED or INVALID"
+// @Param        payment_id query int false "Payment ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Events"
+// @Router       /admin/payment-events [get]
+func GetPaymentEvents(c *gin.Context) {
+	filter := stores.PaymentEventFilter{Gateway: c.Query("gateway")}
+	if value := c.Query("status"); value != "" {
+		status, ok := dbmodels.PaymentEventStatus_value[strings.ToUpper(value)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event status"})
+			return
+		}
+		eventStatus := dbmodels.PaymentEventStatus(status)
+		filter.Status = &eventStatus
+	}
+	if value := c.Query("payment_id"); value != "" {
+		paymentID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+			return
+		}
+		filter.PaymentID = uint(paymentID)
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	events, total, err := globalStore.StStore.GetPaymentEvents(filter, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":      events,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (int(total) + limit - 1) / limit,
+	})
+}
+
+// GetPaymentEvent godoc
+// @Summary      Get a payment gateway event
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Event ID"
+// @Success      200 {object} dbmodels.PaymentEvent "Event"
+// @Failure      404 {object} map[string]interface{} "Event not found"
+// @Router       /admin/payment-events/{id} [get]
+func GetPaymentEvent(c *gin.Context) {
+	event, ok := loadPaymentEvent(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, event)
+}
+
+// ReplayPaymentEvent godoc
+// @Summary      Replay a payment gateway event
+// @Description  Verifies the stored callback again and reapplies it. Only forward status changes are applied, so replaying an event that was already handled changes nothing.
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Event ID"
+// @Success      200 {object} map[string]interface{} "Replay result"
+// @Failure      400 {object} map[string]interface{} "Event cannot be verified"
+// @Failure      404 {object} map[string]interface{} "Event or payment not found"
+// @Router       /admin/payment-events/{id}/replay [post]
+func ReplayPaymentEvent(c *gin.Context) {
+	event, ok := loadPaymentEvent(c)
+	if !ok {
+		return
+	}
+
+	gateway, err := globalStore.Payments.Get(event.Gateway)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment gateway is not enabled: " + event.Gateway})
+		return
+	}
+
+	callback := payment.Callback{Body: []byte(event.Payload), Header: http.Header{}}
+	callback.Query, _ = url.ParseQuery(event.Query)
+	if event.Headers != "" {
+		json.Unmarshal([]byte(event.Headers), &callback.Header)
+	}
+
+	result, err := gateway.VerifyCallback(callback)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event cannot be verified: " + err.Error()})
+		return
+	}
+
+	if code, err := processPaymentEvent(gateway, event, result); err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, err = globalStore.StStore.GetPaymentEvent(event.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Payment event replayed",
+		"event":   event,
+	})
+}
+
+func loadPaymentEvent(c *gin.Context) (*dbmodels.PaymentEvent, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return nil, false
+	}
+	event, err := globalStore.StStore.GetPaymentEvent(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment event not found"})
+		return nil, false
+	}
+	return event, true
+}
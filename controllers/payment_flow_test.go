@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/payment"
+	"github.com/mohammedrefaat/hamber/receipts"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newSandboxService wires the controllers to a migrated SQLite database and a
+// sandbox gateway whose signed callbacks reach PaymentCallback over HTTP
+func newSandboxService(t *testing.T) (*gorm.DB, *payment.SandboxGateway, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	t.Chdir(dir) // Receipts are saved under ./uploads
+
+	dsn := "file:" + filepath.Join(dir, "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	store, err := stores.NewDbStore(db)
+	if err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+
+	router := gin.New()
+	router.POST("/api/payment/:gateway/callback", PaymentCallback)
+	server := httptest.NewServer(router)
+	// Close waits for callbacks still completing their order, such as the receipt
+	t.Cleanup(server.Close)
+	callbackURL := server.URL + "/api/payment/sandbox/callback"
+
+	cfg := &config.Config{}
+	cfg.Payment.Sandbox = config.SandboxConfig{
+		Enabled:     true,
+		Outcome:     payment.SandboxOutcomeSuccess,
+		Delay:       "0s",
+		CallbackURL: callbackURL,
+		Secret:      "sandbox-test-secret",
+	}
+	registry := payment.NewRegistry(cfg)
+	SetStore(&GlobalService{
+		StStore:  store,
+		Config:   cfg,
+		Payments: registry,
+		Receipts: receipts.NewService(store, nil, nil, config.ReceiptsConfig{}),
+	})
+
+	gateway, err := registry.Get("sandbox")
+	if err != nil {
+		t.Fatalf("sandbox gateway: %v", err)
+	}
+	return db, gateway.(*payment.SandboxGateway), callbackURL
+}
+
+// createTestOrder stores an unpaid storefront order and loads it the way the
+// payment handlers do
+func createTestOrder(t *testing.T, db *gorm.DB) *dbmodels.Order {
+	t.Helper()
+	pkg := dbmodels.Package{Name: "Starter", Price: decimal.RequireFromString("299.99"), Duration: 30, IsActive: true}
+	mustCreate(t, db, &pkg)
+	owner := dbmodels.User{Name: "Mona", Email: "mona@example.com", Password: "x", Subdomain: "mona", RoleID: 1, PackageID: pkg.ID}
+	mustCreate(t, db, &owner)
+	client := dbmodels.Client{Name: "Karim", Email: "karim@example.com", UserID: owner.ID}
+	mustCreate(t, db, &client)
+	product := dbmodels.Product{Name: "Mug", Price: decimal.RequireFromString("125"), Quantity: 10, SKU: "MUG-1", UserID: owner.ID}
+	mustCreate(t, db, &product)
+	order := dbmodels.Order{
+		ClientID: client.ID,
+		UserID:   owner.ID,
+		Total:    decimal.RequireFromString("250"),
+		Status:   dbmodels.OrderStatus_PENDING,
+		Currency: "EGP",
+		Items:    []dbmodels.OrderItem{{ProductID: product.ID, Quantity: 2, Price: product.Price}},
+	}
+	mustCreate(t, db, &order)
+
+	loaded, err := globalStore.StStore.GetOrderWithItems(order.ID)
+	if err != nil {
+		t.Fatalf("load order: %v", err)
+	}
+	return loaded
+}
+
+func TestSandboxOrderPaymentCallback(t *testing.T) {
+	db, sandbox, callbackURL := newSandboxService(t)
+	order := createTestOrder(t, db)
+
+	started, err := initiateOrderPayment(context.Background(), order, "sandbox", nil)
+	if err != nil {
+		t.Fatalf("initiateOrderPayment: %v", err)
+	}
+	paymentdb := paymentByID(t, db, started.PaymentID)
+	if err := sandbox.Complete(paymentdb.ReferenceNumber, payment.SandboxOutcomeSuccess); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	paid := waitForPaymentStatus(t, db, paymentdb.ID, dbmodels.PaymentStatus_PAID)
+
+	var settled dbmodels.Order
+	if err := db.First(&settled, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if settled.PaymentStatus != dbmodels.PaymentStatus_PAID.String() || settled.PaymentRef != paid.TransactionID || !settled.PaymentAmount.Equal(order.Total) {
+		t.Fatalf("order settled as %s %s %s, want PAID %s %s", settled.PaymentStatus, settled.PaymentRef, settled.PaymentAmount, paid.TransactionID, order.Total)
+	}
+	if paid.NeedsRefund {
+		t.Errorf("the first payment of an order is flagged for refund")
+	}
+
+	// The gateway redelivers the same event
+	completed, err := sandbox.Lookup(paid.ReferenceNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := payment.SandboxCallback{
+		EventID:        completed.TransactionID + "-" + dbmodels.PaymentStatus_PAID.String(),
+		Reference:      completed.Reference,
+		GatewayOrderID: completed.GatewayOrderID,
+		TransactionID:  completed.TransactionID,
+		Status:         dbmodels.PaymentStatus_PAID.String(),
+		Amount:         completed.Amount,
+		Currency:       completed.Currency,
+	}
+	code, status := postSandboxCallback(t, sandbox, callbackURL, callback, true)
+	if code != http.StatusOK || status != "duplicate" {
+		t.Errorf("replayed callback returned %d %q, want 200 duplicate", code, status)
+	}
+	var events int64
+	db.Model(&dbmodels.PaymentEvent{}).Where("payment_id = ?", paid.ID).Count(&events)
+	if events != 1 {
+		t.Errorf("%d events recorded for the payment, want the replay to reuse 1", events)
+	}
+
+	// A failure reported after the success is out of order and ignored
+	callback.EventID = completed.TransactionID + "-" + dbmodels.PaymentStatus_FAILED.String()
+	callback.Status = dbmodels.PaymentStatus_FAILED.String()
+	if code, status := postSandboxCallback(t, sandbox, callbackURL, callback, true); code != http.StatusOK || status != "success" {
+		t.Errorf("out-of-order callback returned %d %q, want 200 success", code, status)
+	}
+	if current := paymentByID(t, db, paid.ID); current.PaymentStatus != dbmodels.PaymentStatus_PAID {
+		t.Errorf("payment moved to %s after a late failure, want PAID", current.PaymentStatus)
+	}
+	var ignored dbmodels.PaymentEvent
+	if err := db.Where("event_id = ?", callback.EventID).First(&ignored).Error; err != nil || ignored.Status != dbmodels.PaymentEventStatus_IGNORED {
+		t.Errorf("late failure event recorded as %s (%v), want IGNORED", ignored.Status, err)
+	}
+
+	// A forged callback is rejected before it reaches the payment
+	callback.EventID = completed.TransactionID + "-forged"
+	if code, _ := postSandboxCallback(t, sandbox, callbackURL, callback, false); code != http.StatusUnauthorized {
+		t.Errorf("unsigned callback returned %d, want 401", code)
+	}
+
+	order.PaymentStatus = settled.PaymentStatus
+	if _, err := initiateOrderPayment(context.Background(), order, "sandbox", nil); !hasCode(err, http.StatusBadRequest) {
+		t.Errorf("paying a paid order: %v, want 400", err)
+	}
+}
+
+func TestSandboxLatePaymentOfReplacedAttempt(t *testing.T) {
+	db, sandbox, _ := newSandboxService(t)
+	order := createTestOrder(t, db)
+	ctx := context.Background()
+
+	first, err := initiateOrderPayment(ctx, order, "sandbox", nil)
+	if err != nil {
+		t.Fatalf("first attempt: %v", err)
+	}
+	second, err := initiateOrderPayment(ctx, order, "sandbox", nil)
+	if err != nil {
+		t.Fatalf("second attempt: %v", err)
+	}
+	replaced := paymentByID(t, db, first.PaymentID)
+	if replaced.PaymentStatus != dbmodels.PaymentStatus_CANCELLED {
+		t.Fatalf("replaced attempt is %s, want CANCELLED", replaced.PaymentStatus)
+	}
+
+	current := paymentByID(t, db, second.PaymentID)
+	if err := sandbox.Complete(current.ReferenceNumber, payment.SandboxOutcomeSuccess); err != nil {
+		t.Fatal(err)
+	}
+	current = waitForPaymentStatus(t, db, current.ID, dbmodels.PaymentStatus_PAID)
+
+	// The shopper also finishes the abandoned checkout page
+	if err := sandbox.Complete(replaced.ReferenceNumber, payment.SandboxOutcomeSuccess); err != nil {
+		t.Fatal(err)
+	}
+	late := waitForPaymentStatus(t, db, replaced.ID, dbmodels.PaymentStatus_PAID)
+	if !late.NeedsRefund {
+		t.Errorf("late payment of a paid order is not flagged for refund")
+	}
+
+	var settled dbmodels.Order
+	if err := db.First(&settled, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if settled.PaymentRef != current.TransactionID {
+		t.Errorf("order payment ref = %s, want the first settled payment %s", settled.PaymentRef, current.TransactionID)
+	}
+}
+
+func TestSandboxCallbackForAnotherCharge(t *testing.T) {
+	db, sandbox, callbackURL := newSandboxService(t)
+	order := createTestOrder(t, db)
+
+	started, err := initiateOrderPayment(context.Background(), order, "sandbox", nil)
+	if err != nil {
+		t.Fatalf("initiateOrderPayment: %v", err)
+	}
+	pending, err := sandbox.Lookup(paymentByID(t, db, started.PaymentID).ReferenceNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := payment.SandboxCallback{
+		Reference:      pending.Reference,
+		GatewayOrderID: pending.GatewayOrderID,
+		TransactionID:  pending.GatewayOrderID + "-TX",
+		Status:         dbmodels.PaymentStatus_PAID.String(),
+		Amount:         pending.Amount,
+		Currency:       pending.Currency,
+	}
+
+	mismatched := map[string]func(*payment.SandboxCallback){
+		"smaller amount":     func(cb *payment.SandboxCallback) { cb.Amount = decimal.RequireFromString("1") },
+		"different currency": func(cb *payment.SandboxCallback) { cb.Currency = "USD" },
+	}
+	for name, change := range mismatched {
+		signed := callback
+		signed.EventID = "mismatch-" + name
+		change(&signed)
+		if code, _ := postSandboxCallback(t, sandbox, callbackURL, signed, true); code != http.StatusBadRequest {
+			t.Errorf("%s: callback returned %d, want 400", name, code)
+		}
+		if current := paymentByID(t, db, started.PaymentID); current.PaymentStatus != dbmodels.PaymentStatus_PENDING {
+			t.Fatalf("%s: payment moved to %s, want PENDING", name, current.PaymentStatus)
+		}
+		var event dbmodels.PaymentEvent
+		if err := db.Where("event_id = ?", signed.EventID).First(&event).Error; err != nil || event.Status != dbmodels.PaymentEventStatus_INVALID {
+			t.Errorf("%s: event recorded as %s (%v), want INVALID", name, event.Status, err)
+		}
+		// The gateway's retry is acknowledged without being applied
+		if code, status := postSandboxCallback(t, sandbox, callbackURL, signed, true); code != http.StatusOK || status != "duplicate" {
+			t.Errorf("%s: retry returned %d %q, want 200 duplicate", name, code, status)
+		}
+	}
+
+	callback.EventID = "matching"
+	if code, status := postSandboxCallback(t, sandbox, callbackURL, callback, true); code != http.StatusOK || status != "success" {
+		t.Fatalf("matching callback returned %d %q, want 200 success", code, status)
+	}
+	if current := paymentByID(t, db, started.PaymentID); current.PaymentStatus != dbmodels.PaymentStatus_PAID {
+		t.Errorf("payment is %s after the matching callback, want PAID", current.PaymentStatus)
+	}
+}
+
+// postSandboxCallback sends a callback as the sandbox would, or unsigned, and
+// returns the response code and status
+func postSandboxCallback(t *testing.T, sandbox *payment.SandboxGateway, callbackURL string, callback payment.SandboxCallback, signed bool) (int, string) {
+	t.Helper()
+	body, err := json.Marshal(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if signed {
+		req.Header.Set(payment.SandboxSignatureHeader, sandbox.Sign(body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post callback: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Status string `json:"status"`
+	}
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp.StatusCode, response.Status
+}
+
+// waitForPaymentStatus waits for the sandbox callback, which is sent in the background
+func waitForPaymentStatus(t *testing.T, db *gorm.DB, id uint, status dbmodels.PaymentStatus) *dbmodels.Payment {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		found := paymentByID(t, db, id)
+		if found.PaymentStatus == status {
+			return found
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("payment %d is %s, want %s", id, found.PaymentStatus, status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func paymentByID(t *testing.T, db *gorm.DB, id uint) *dbmodels.Payment {
+	t.Helper()
+	var found dbmodels.Payment
+	if err := db.First(&found, id).Error; err != nil {
+		t.Fatalf("load payment %d: %v", id, err)
+	}
+	return &found
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
+
+func hasCode(err error, code int) bool {
+	customErr, ok := err.(*stores.CustomError)
+	return ok && customErr.Code == code
+}
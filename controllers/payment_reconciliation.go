@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== ADMIN: PAYMENT RECONCILIATION ==========
+
+// pendingReconcileLimit caps the pending payments checked by one manual run
+const pendingReconcileLimit = 200
+
+type RunPaymentReconciliationRequest struct {
+	Date string `json:"date"` // YYYY-MM-DD, defaults to yesterday
+}
+
+// GetPaymentReconciliations godoc
+// @Summary      List payment reconciliation reports
+// @Description  Daily reports comparing payments with their gateways, newest day first, without their mismatches
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Reports"
+// @Router       /admin/payment-reconciliations [get]
+func GetPaymentReconciliations(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	reports, total, err := globalStore.StStore.GetPaymentReconciliations(page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports":     reports,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (int(total) + limit - 1) / limit,
+	})
+}
+
+// GetPaymentReconciliation godoc
+// @Summary      Get a payment reconciliation report
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Report ID"
+// @Success      200 {object} dbmodels.PaymentReconciliation "Report with its mismatches"
+// @Failure      404 {object} map[string]interface{} "Report not found"
+// @Router       /admin/payment-reconciliations/{id} [get]
+func GetPaymentReconciliation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+		return
+	}
+	report, err := globalStore.StStore.GetPaymentReconciliation(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reconciliation report not found"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// RunPaymentReconciliation godoc
+// @Summary      Build a payment reconciliation report
+// @Description  Compares the payments created on a day with their gateways now, replacing the stored report for that day
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body RunPaymentReconciliationRequest false "Day to reconcile"
+// @Success      200 {object} dbmodels.PaymentReconciliation "Report"
+// @Failure      400 {object} map[string]interface{} "Invalid date"
+// @Router       /admin/payment-reconciliations [post]
+func RunPaymentReconciliation(c *gin.Context) {
+	var req RunPaymentReconciliationRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	day := time.Now().AddDate(0, 0, -1)
+	if req.Date != "" {
+		date, err := time.ParseInLocation("2006-01-02", req.Date, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+			return
+		}
+		if date.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Date must not be in the future"})
+			return
+		}
+		day = date
+	}
+
+	report, err := globalStore.Reconciler.ReportDay(c.Request.Context(), day)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ReconcilePendingPayments godoc
+// @Summary      Reconcile pending payments now
+// @Description  Asks the gateways of stale pending payments for their status, applies it and expires payments past their deadline, as the background job does
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} payment.PendingSummary "What was done"
+// @Router       /admin/payments/reconcile [post]
+func ReconcilePendingPayments(c *gin.Context) {
+	staleBefore := time.Now().Add(-globalStore.Config.GetPaymentStaleAfter())
+	summary, err := globalStore.Reconciler.ReconcilePending(c.Request.Context(), staleBefore, pendingReconcileLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
@@ -14,57 +14,58 @@ import (
 	"github.com/gin-gonic/gin"
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
 	db "github.com/mohammedrefaat/hamber/Db"
+	"github.com/mohammedrefaat/hamber/money"
 	"github.com/mohammedrefaat/hamber/utils"
+	"github.com/shopspring/decimal"
 )
 
 type CreateProductRequest struct {
-	Name          string   `json:"name" binding:"required"`
-	Description   string   `json:"description"`
-	Price         float64  `json:"price" binding:"required"`
-	DiscountPrice float64  `json:"discount_price"`
-	Quantity      int      `json:"quantity" binding:"required"`
-	SKU           string   `json:"sku" binding:"required"`
-	Category      string   `json:"category"`
-	Brand         string   `json:"brand"`
-	Photos        []string `json:"photos"` // Array of base64 encoded images
-	Weight        float64  `json:"weight"`
-	Tags          string   `json:"tags"`
-	Fevorite      bool     `json:"fevorite"`
+	Name          string          `json:"name" binding:"required"`
+	Description   string          `json:"description"`
+	Price         decimal.Decimal `json:"price" binding:"required"`
+	DiscountPrice decimal.Decimal `json:"discount_price"`
+	Quantity      int             `json:"quantity" binding:"required"`
+	SKU           string          `json:"sku" binding:"required"`
+	Category      string          `json:"category"`
+	Brand         string          `json:"brand"`
+	Photos        []string        `json:"photos"` // Array of base64 encoded images
+	Weight        float64         `json:"weight"`
+	Tags          string          `json:"tags"`
 }
 
 type UpdateProductRequest struct {
-	Name          string   `json:"name"`
-	Description   string   `json:"description"`
-	Price         float64  `json:"price"`
-	DiscountPrice float64  `json:"discount_price"`
-	Quantity      int      `json:"quantity"`
-	SKU           string   `json:"sku"`
-	Category      string   `json:"category"`
-	Brand         string   `json:"brand"`
-	Photos        []string `json:"photos"` // Array of base64 encoded images
-	Weight        float64  `json:"weight"`
-	Tags          string   `json:"tags"`
-	Favorite      bool     `json:"favorite"`
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	Price         decimal.Decimal `json:"price"`
+	DiscountPrice decimal.Decimal `json:"discount_price"`
+	Quantity      int             `json:"quantity"`
+	SKU           string          `json:"sku"`
+	Category      string          `json:"category"`
+	Brand         string          `json:"brand"`
+	Photos        []string        `json:"photos"` // Array of base64 encoded images
+	Weight        float64         `json:"weight"`
+	Tags          string          `json:"tags"`
 }
 
 type ProductResponse struct {
-	ID            uint     `json:"id"`
-	Name          string   `json:"name"`
-	Description   string   `json:"description"`
-	Price         float64  `json:"price"`
-	DiscountPrice float64  `json:"discount_price"`
-	Quantity      int      `json:"quantity"`
-	SKU           string   `json:"sku"`
-	Category      string   `json:"category"`
-	Brand         string   `json:"brand"`
-	Photos        []string `json:"photos"` // Array of base64 encoded images
-	Weight        float64  `json:"weight"`
-	Tags          string   `json:"tags"`
-	UserID        uint     `json:"user_id"`
-	IsActive      bool     `json:"is_active"`
-	CreatedAt     string   `json:"created_at"`
-	UpdatedAt     string   `json:"updated_at"`
-	Favorite      bool     `json:"favorite"`
+	ID            uint            `json:"id"`
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	Price         decimal.Decimal `json:"price"`
+	DiscountPrice decimal.Decimal `json:"discount_price"`
+	Quantity      int             `json:"quantity"`
+	SKU           string          `json:"sku"`
+	Category      string          `json:"category"`
+	Brand         string          `json:"brand"`
+	Photos        []string        `json:"photos"` // Array of base64 encoded images
+	Weight        float64         `json:"weight"`
+	Tags          string          `json:"tags"`
+	UserID        uint            `json:"user_id"`
+	IsActive      bool            `json:"is_active"`
+	RatingAverage float64         `json:"rating_average"`
+	RatingCount   int             `json:"rating_count"`
+	CreatedAt     string          `json:"created_at"`
+	UpdatedAt     string          `json:"updated_at"`
 }
 
 // CreateProduct creates a new product with base64 photos
@@ -74,6 +75,10 @@ func CreateProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !req.Price.IsPositive() || req.DiscountPrice.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price must be positive and discount_price not negative"})
+		return
+	}
 
 	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
@@ -81,20 +86,28 @@ func CreateProduct(c *gin.Context) {
 		return
 	}
 
+	if !requireEntitlement(c, userID, dbmodels.Entitlement_PRODUCTS, 1) ||
+		!requireEntitlement(c, userID, dbmodels.Entitlement_STORAGE, base64PhotosSize(req.Photos)) {
+		return
+	}
+
 	ctx := context.Background()
 	photoService := globalStore.PhotoSrv
 
 	// Upload photos to MinIO and get URLs
 	var photoURLs []string
 	if len(req.Photos) > 0 {
-		uploadedURLs, err := uploadBase64Photos(ctx, photoService, req.Photos, db.CategoryPackage)
+		uploaded, err := uploadBase64PhotoResults(ctx, photoService, req.Photos, db.CategoryPackage)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to upload photos: " + err.Error(),
 			})
 			return
 		}
-		photoURLs = uploadedURLs
+		recordStoredFiles(userID, uploaded)
+		for _, result := range uploaded {
+			photoURLs = append(photoURLs, result.URL)
+		}
 	}
 
 	// Convert photo URLs to JSON string for storage
@@ -107,8 +120,8 @@ func CreateProduct(c *gin.Context) {
 	product := dbmodels.Product{
 		Name:          req.Name,
 		Description:   req.Description,
-		Price:         req.Price,
-		DiscountPrice: req.DiscountPrice,
+		Price:         money.Round(req.Price),
+		DiscountPrice: money.Round(req.DiscountPrice),
 		Quantity:      req.Quantity,
 		SKU:           req.SKU,
 		Category:      req.Category,
@@ -118,7 +131,6 @@ func CreateProduct(c *gin.Context) {
 		Tags:          req.Tags,
 		UserID:        userID,
 		IsActive:      true,
-		Favorite:      req.Fevorite,
 	}
 
 	if err := globalStore.StStore.CreateProduct(&product); err != nil {
@@ -149,6 +161,7 @@ func CreateProduct(c *gin.Context) {
 // @Param        page query int false "Page number" default(1)
 // @Param        limit query int false "Items per page" default(10)
 // @Param        category query string false "Filter by category"
+// @Param        sort query string false "Sort order: newest, rating, reviews, price_asc, price_desc" default(newest)
 // @Success      200 {object} map[string]interface{} "Products list"
 // @Failure      401 {object} map[string]interface{} "Unauthorized"
 // @Router       /products [get]
@@ -156,10 +169,11 @@ func GetProducts(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	category := c.Query("category")
+	sort := c.DefaultQuery("sort", "newest")
 
 	userID, _ := utils.GetUserIDFromContext(c)
 
-	products, total, err := globalStore.StStore.GetProducts(page, limit, userID, category, nil)
+	products, total, err := globalStore.StStore.GetProducts(page, limit, userID, category, nil, sort)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
@@ -271,6 +285,7 @@ func UpdateProduct(c *gin.Context) {
 
 	ctx := context.Background()
 	photoService := globalStore.PhotoSrv
+	previous := *product
 
 	// Update basic fields
 	if req.Name != "" {
@@ -279,8 +294,8 @@ func UpdateProduct(c *gin.Context) {
 	if req.Description != "" {
 		product.Description = req.Description
 	}
-	if req.Price > 0 {
-		product.Price = req.Price
+	if req.Price.IsPositive() {
+		product.Price = money.Round(req.Price)
 	}
 	if req.Quantity >= 0 {
 		product.Quantity = req.Quantity
@@ -300,37 +315,45 @@ func UpdateProduct(c *gin.Context) {
 	if req.Tags != "" {
 		product.Tags = req.Tags
 	}
-	if req.DiscountPrice >= 0 {
-		product.DiscountPrice = req.DiscountPrice
-	}
-	if req.Favorite {
-		product.Favorite = req.Favorite
+	if !req.DiscountPrice.IsNegative() {
+		product.DiscountPrice = money.Round(req.DiscountPrice)
 	}
 	// Handle photo updates
 	if req.Photos != nil {
+		// The new photos replace the old ones in the storage allowance
+		oldPhotoURLs := decodePhotoURLs(product.Images)
+		oldSize, err := globalStore.StStore.GetStoredFilesSize(photoFileNames(oldPhotoURLs))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !requireEntitlement(c, product.UserID, dbmodels.Entitlement_STORAGE, base64PhotosSize(req.Photos)-oldSize) {
+			return
+		}
+
 		// Delete old photos from MinIO
-		var oldPhotoURLs []string
-		if product.Images != "" && product.Images != "[]" {
-			json.Unmarshal([]byte(product.Images), &oldPhotoURLs)
-			for _, url := range oldPhotoURLs {
-				fileName := extractFileNameFromURL(url)
-				if fileName != "" {
-					photoService.DeletePhoto(ctx, fileName)
-				}
+		for _, url := range oldPhotoURLs {
+			fileName := extractFileNameFromURL(url)
+			if fileName != "" {
+				photoService.DeletePhoto(ctx, fileName)
 			}
 		}
+		releaseStoredFiles(oldPhotoURLs)
 
 		// Upload new photos
 		var photoURLs []string
 		if len(req.Photos) > 0 {
-			uploadedURLs, err := uploadBase64Photos(ctx, photoService, req.Photos, db.CategoryPackage)
+			uploaded, err := uploadBase64PhotoResults(ctx, photoService, req.Photos, db.CategoryPackage)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": "Failed to upload photos: " + err.Error(),
 				})
 				return
 			}
-			photoURLs = uploadedURLs
+			recordStoredFiles(product.UserID, uploaded)
+			for _, result := range uploaded {
+				photoURLs = append(photoURLs, result.URL)
+			}
 		}
 
 		// Update images JSON
@@ -347,6 +370,9 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
+	updated := *product
+	go notifyWishlistWatchers(&previous, &updated)
+
 	response, err := convertProductToResponse(ctx, photoService, product)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product photos"})
@@ -398,16 +424,14 @@ func DeleteProduct(c *gin.Context) {
 	// Optional: Delete photos from MinIO when deleting product
 	ctx := context.Background()
 	photoService := globalStore.PhotoSrv
-	var photoURLs []string
-	if product.Images != "" && product.Images != "[]" {
-		json.Unmarshal([]byte(product.Images), &photoURLs)
-		for _, url := range photoURLs {
-			fileName := extractFileNameFromURL(url)
-			if fileName != "" {
-				photoService.DeletePhoto(ctx, fileName)
-			}
+	photoURLs := decodePhotoURLs(product.Images)
+	for _, url := range photoURLs {
+		fileName := extractFileNameFromURL(url)
+		if fileName != "" {
+			photoService.DeletePhoto(ctx, fileName)
 		}
 	}
+	releaseStoredFiles(photoURLs)
 
 	if err := globalStore.StStore.DeleteProduct(uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
@@ -467,6 +491,10 @@ func UpdateProductQuantity(c *gin.Context) {
 		return
 	}
 
+	updated := *product
+	updated.Quantity = req.Quantity
+	go notifyWishlistWatchers(product, &updated)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Product quantity updated successfully"})
 }
 
@@ -474,7 +502,21 @@ func UpdateProductQuantity(c *gin.Context) {
 
 // uploadBase64Photos uploads an array of base64 encoded photos to MinIO
 func uploadBase64Photos(ctx context.Context, photoService *db.PhotoSrv, base64Photos []string, category db.PhotoCategory) ([]string, error) {
+	results, err := uploadBase64PhotoResults(ctx, photoService, base64Photos, category)
+	if err != nil {
+		return nil, err
+	}
+
 	var photoURLs []string
+	for _, result := range results {
+		photoURLs = append(photoURLs, result.URL)
+	}
+	return photoURLs, nil
+}
+
+// uploadBase64PhotoResults is uploadBase64Photos returning the stored files
+func uploadBase64PhotoResults(ctx context.Context, photoService *db.PhotoSrv, base64Photos []string, category db.PhotoCategory) ([]*db.PhotoUploadResult, error) {
+	var results []*db.PhotoUploadResult
 
 	for i, base64Photo := range base64Photos {
 		// Remove data URL prefix if present (e.g., "data:image/jpeg;base64,")
@@ -515,10 +557,10 @@ func uploadBase64Photos(ctx context.Context, photoService *db.PhotoSrv, base64Ph
 			return nil, fmt.Errorf("failed to upload photo %d: %v", i, err)
 		}
 
-		photoURLs = append(photoURLs, result.URL)
+		results = append(results, result)
 	}
 
-	return photoURLs, nil
+	return results, nil
 }
 
 // downloadPhotoAsBase64 downloads a photo from MinIO and converts to base64
@@ -586,9 +628,10 @@ func convertProductToResponse(ctx context.Context, photoService *db.PhotoSrv, pr
 		Tags:          product.Tags,
 		UserID:        product.UserID,
 		IsActive:      product.IsActive,
+		RatingAverage: product.RatingAverage,
+		RatingCount:   product.RatingCount,
 		CreatedAt:     product.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		UpdatedAt:     product.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-		Favorite:      product.Favorite,
 		DiscountPrice: product.DiscountPrice,
 	}, nil
 }
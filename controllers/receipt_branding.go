@@ -0,0 +1,340 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	db "github.com/mohammedrefaat/hamber/Db"
+	"github.com/mohammedrefaat/hamber/receipts"
+	"github.com/mohammedrefaat/hamber/utils"
+	"github.com/shopspring/decimal"
+)
+
+// ========== RECEIPT BRANDING ==========
+
+type ReceiptBrandingRequest struct {
+	Layout       string `json:"layout" example:"a4-classic"` // Empty uses the default layout
+	Name         string `json:"name" binding:"max=255" example:"Hamber Store"`
+	Address      string `json:"address" binding:"max=500" example:"12 Tahrir St, Cairo"`
+	Phone        string `json:"phone" binding:"max=50" example:"+20 100 000 0000"`
+	Email        string `json:"email" binding:"omitempty,email,max=255" example:"sales@store.com"`
+	Website      string `json:"website" binding:"max=255" example:"www.store.com"`
+	TaxID        string `json:"tax_id" binding:"max=100" example:"123-456-789"`
+	PrimaryColor string `json:"primary_color" example:"#1f4e79"` // #RRGGBB
+	AccentColor  string `json:"accent_color" example:"#d9e2f3"`  // #RRGGBB
+	FooterText   string `json:"footer_text" binding:"max=1000" example:"Follow us @store"`
+	ReturnPolicy string `json:"return_policy" binding:"max=2000" example:"Returns accepted within 14 days with the receipt."`
+}
+
+// receiptLayout applies ?layout= on top of a layout. It returns false for an unknown layout.
+func receiptLayout(c *gin.Context, layout receipts.Layout) (receipts.Layout, bool) {
+	id := c.Query("layout")
+	if id == "" {
+		return layout, true
+	}
+	return receipts.LookupLayout(id)
+}
+
+// GetReceiptLayouts godoc
+// @Summary      List receipt layouts
+// @Description  Layouts a store can print receipts with
+// @Tags         Receipts
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "Layouts"
+// @Router       /receipts/layouts [get]
+func GetReceiptLayouts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"layouts": receipts.Layouts(),
+		"default": receipts.DefaultLayout,
+	})
+}
+
+// GetReceiptBranding godoc
+// @Summary      Get receipt branding
+// @Description  The store's saved receipt branding and the details receipts are actually printed with
+// @Tags         Receipts
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "Receipt branding"
+// @Router       /profile/receipt-branding [get]
+func GetReceiptBranding(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, _ := globalStore.StStore.GetReceiptBranding(userID)
+	branding, layout := globalStore.Receipts.Design(userID)
+	logoURL := globalStore.Receipts.LogoURL(branding.Logo)
+
+	c.JSON(http.StatusOK, gin.H{
+		"branding":  saved,
+		"effective": branding,
+		"layout":    layout,
+		"logo_url":  logoURL,
+		"layouts":   receipts.Layouts(),
+	})
+}
+
+// UpdateReceiptBranding godoc
+// @Summary      Save receipt branding
+// @Description  Saves the store's receipt details, colours, footer, return policy and layout. Receipts already issued keep the branding they were printed with.
+// @Tags         Receipts
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body ReceiptBrandingRequest true "Branding"
+// @Success      200 {object} map[string]interface{} "Branding saved"
+// @Failure      400 {object} map[string]interface{} "Invalid layout or colour"
+// @Router       /profile/receipt-branding [put]
+func UpdateReceiptBranding(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ReceiptBrandingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Layout != "" {
+		if _, ok := receipts.LookupLayout(req.Layout); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown receipt layout"})
+			return
+		}
+	}
+	if !receipts.IsValidColor(req.PrimaryColor) || !receipts.IsValidColor(req.AccentColor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Colours must be in #RRGGBB format"})
+		return
+	}
+
+	branding := &dbmodels.ReceiptBranding{
+		UserID:       userID,
+		Layout:       req.Layout,
+		Name:         strings.TrimSpace(req.Name),
+		Address:      strings.TrimSpace(req.Address),
+		Phone:        strings.TrimSpace(req.Phone),
+		Email:        strings.TrimSpace(req.Email),
+		Website:      strings.TrimSpace(req.Website),
+		TaxID:        strings.TrimSpace(req.TaxID),
+		FooterText:   strings.TrimSpace(req.FooterText),
+		ReturnPolicy: strings.TrimSpace(req.ReturnPolicy),
+	}
+	// Store colours in one canonical form
+	if color, ok := receipts.ParseColor(req.PrimaryColor); ok {
+		branding.PrimaryColor = color.Hex()
+	}
+	if color, ok := receipts.ParseColor(req.AccentColor); ok {
+		branding.AccentColor = color.Hex()
+	}
+
+	if err := globalStore.StStore.SaveReceiptBranding(branding); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, _ := globalStore.StStore.GetReceiptBranding(userID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Receipt branding saved",
+		"branding": saved,
+	})
+}
+
+// UploadReceiptLogo godoc
+// @Summary      Upload receipt logo
+// @Description  Uploads the logo printed on receipts. PNG or JPEG, up to 2MB.
+// @Tags         Receipts
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     Bearer
+// @Param        logo formData file true "Logo image"
+// @Success      200 {object} map[string]interface{} "Logo uploaded"
+// @Failure      400 {object} map[string]interface{} "Invalid image"
+// @Failure      402 {object} map[string]interface{} "Upgrade required"
+// @Router       /profile/receipt-branding/logo [post]
+func UploadReceiptLogo(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if globalStore.PhotoSrv == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "File storage is not available"})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("logo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get logo file"})
+		return
+	}
+	defer file.Close()
+
+	// The PDF renderer draws PNG and JPEG; check the content rather than the header
+	if header.Size > receipts.MaxLogoSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Logo must be 2MB or smaller"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, receipts.MaxLogoSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read logo file"})
+		return
+	}
+	contentType := http.DetectContentType(data)
+	if contentType != "image/png" && contentType != "image/jpeg" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Logo must be a PNG or JPEG image"})
+		return
+	}
+
+	// The new logo takes the place of the current one in the storage allowance
+	var previousLogo []string
+	if saved, err := globalStore.StStore.GetReceiptBranding(userID); err == nil && saved.Logo != "" {
+		previousLogo = []string{saved.Logo}
+	}
+	previousSize, err := globalStore.StStore.GetStoredFilesSize(previousLogo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !requireEntitlement(c, userID, dbmodels.Entitlement_STORAGE, int64(len(data))-previousSize) {
+		return
+	}
+
+	ctx := context.Background()
+	result, err := globalStore.PhotoSrv.UploadFromReader(ctx, bytes.NewReader(data), header.Filename, int64(len(data)), contentType, db.CategoryBranding)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload logo: " + err.Error()})
+		return
+	}
+
+	// The previous logo stays in storage: issued receipts keep a copy of the branding
+	// they were printed with and still point at it
+	if err := globalStore.StStore.UpdateReceiptLogo(userID, result.FileName); err != nil {
+		globalStore.PhotoSrv.DeletePhoto(ctx, result.FileName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// A replaced logo is kept for issued receipts but no longer counts against storage
+	recordStoredFiles(userID, []*db.PhotoUploadResult{result})
+	globalStore.StStore.ReleaseStoredFiles(previousLogo)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Receipt logo uploaded",
+		"logo":    result,
+	})
+}
+
+// DeleteReceiptLogo godoc
+// @Summary      Remove receipt logo
+// @Description  New receipts are printed without a logo. The image is kept for receipts already issued with it.
+// @Tags         Receipts
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "Logo removed"
+// @Router       /profile/receipt-branding/logo [delete]
+func DeleteReceiptLogo(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := globalStore.StStore.GetReceiptBranding(userID)
+	if err != nil || saved.Logo == "" {
+		c.JSON(http.StatusOK, gin.H{"message": "No receipt logo set"})
+		return
+	}
+
+	if err := globalStore.StStore.UpdateReceiptLogo(userID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	globalStore.StStore.ReleaseStoredFiles([]string{saved.Logo})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Receipt logo removed"})
+}
+
+// PreviewReceipt godoc
+// @Summary      Preview receipt design
+// @Description  Renders a sample order with the store's branding, to compare layouts before saving one
+// @Tags         Receipts
+// @Produce      text/html,application/pdf
+// @Security     Bearer
+// @Param        layout query string false "Layout ID; defaults to the store setting"
+// @Param        format query string false "html or pdf" default(html)
+// @Param        lang query string false "Receipt language (en, ar)"
+// @Param        numerals query string false "Digits: latn or arab"
+// @Success      200 {file} file "Preview"
+// @Router       /profile/receipt-branding/preview [get]
+func PreviewReceipt(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	branding, layout := globalStore.Receipts.Design(userID)
+	layout, ok := receiptLayout(c, layout)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown receipt layout"})
+		return
+	}
+	locale := receiptLocale(c, userID)
+	doc := globalStore.Receipts.Document(sampleReceiptOrder(userID), branding, layout, locale, "RCP-0-PREVIEW", time.Now())
+
+	var buf bytes.Buffer
+	if c.Query("format") == "pdf" {
+		pdf, err := receipts.RenderPDF(doc)
+		if err == nil {
+			err = pdf.Output(&buf)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF"})
+			return
+		}
+		c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+		return
+	}
+
+	if err := receipts.RenderHTML(&buf, doc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate HTML"})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// sampleReceiptOrder is a paid order in the store's currency used for previews
+func sampleReceiptOrder(ownerID uint) *dbmodels.Order {
+	now := time.Now()
+	currency := globalStore.StStore.GetStoreCurrency(ownerID, globalStore.Config.GetBaseCurrency())
+	return &dbmodels.Order{
+		ID:                1001,
+		UserID:            ownerID,
+		Currency:          currency,
+		Client:            dbmodels.Client{Name: "Sample Customer", Email: "customer@example.com"},
+		Phone:             "01000000000",
+		Address:           "1 Sample St, Cairo",
+		Total:             decimal.RequireFromString("1150.00"),
+		Discount:          decimal.RequireFromString("50.00"),
+		PaymentStatus:     "PAID",
+		PaymentMethodDesc: "Card",
+		PaymentDate:       &now,
+		CreatedAt:         now,
+		Items: []dbmodels.OrderItem{
+			{Quantity: 2, Price: decimal.RequireFromString("400.00"), Product: dbmodels.Product{Name: "Sample Product"}},
+			{Quantity: 1, Price: decimal.RequireFromString("400.00"), Product: dbmodels.Product{Name: "Another Product"}},
+		},
+	}
+}
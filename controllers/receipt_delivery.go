@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/i18n"
+	"github.com/mohammedrefaat/hamber/receipts"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== RECEIPT DELIVERY ==========
+
+type SendReceiptRequest struct {
+	Email string `json:"email" binding:"omitempty,email" example:"customer@example.com"` // Defaults to the order's customer
+}
+
+// SendOrderReceipt godoc
+// @Summary      Resend receipt
+// @Description  Emails the receipt PDF and its public link to the customer, or to another address. The receipt is generated first if the order has none. Every attempt is recorded on the receipt.
+// @Tags         Receipts
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        order_id path int true "Order ID"
+// @Param        request body SendReceiptRequest false "Recipient"
+// @Success      200 {object} map[string]interface{} "Receipt sent"
+// @Failure      400 {object} map[string]interface{} "No recipient"
+// @Failure      502 {object} map[string]interface{} "Email could not be sent"
+// @Failure      503 {object} map[string]interface{} "Email is not configured"
+// @Failure      402 {object} map[string]interface{} "Upgrade required, or no emails add-on quota left"
+// @Failure      429 {object} map[string]interface{} "Emails add-on overage for this period used up"
+// @Router       /receipts/order/{order_id}/send [post]
+func SendOrderReceipt(c *gin.Context) {
+	claims, err := utils.GetclamsFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	orderID, err := strconv.ParseUint(c.Param("order_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req SendReceiptRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := globalStore.StStore.GetOrderWithItems(uint(orderID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	// Verify ownership
+	if order.UserID != claims.UserID && claims.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+	if !requireFeature(c, order.UserID, dbmodels.Feature_RECEIPTS) {
+		return
+	}
+
+	if !globalStore.EmailService.IsConfigured() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Email is not configured"})
+		return
+	}
+
+	receipt, err := globalStore.Receipts.IssueForOrder(order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	receipt.Order = *order
+
+	delivery, err := globalStore.Receipts.Send(receipt, req.Email, dbmodels.ReceiptTriggerManual, &claims.UserID)
+	if errors.Is(err, receipts.ErrNoRecipient) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The order has no customer email; send the receipt to an address in the request"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":    "Failed to send receipt",
+			"delivery": delivery,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Receipt sent",
+		"delivery": delivery,
+	})
+}
+
+// GetPublicReceipt godoc
+// @Summary      Open a receipt from its link
+// @Description  The link emailed to customers. Shows the receipt PDF, or HTML with format=html, without signing in.
+// @Tags         Receipts
+// @Produce      application/pdf,text/html
+// @Param        token path string true "Receipt link token"
+// @Param        format query string false "pdf or html" default(pdf)
+// @Param        lang query string false "Show the HTML in another language (en, ar)"
+// @Success      200 {file} file "Receipt"
+// @Failure      404 {object} map[string]interface{} "Receipt not found"
+// @Router       /receipts/public/{token} [get]
+func GetPublicReceipt(c *gin.Context) {
+	receipt, err := globalStore.StStore.GetOrderReceiptByToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found"})
+		return
+	}
+
+	if c.Query("format") == "html" {
+		locale := localeFromQuery(c, i18n.NewLocale(receipt.Language, receipt.Numerals))
+		doc := globalStore.Receipts.IssuedDocument(receipt, &receipt.Order, receipts.LayoutForVersion(receipt.TemplateVersion), locale)
+
+		var buf bytes.Buffer
+		if err := receipts.RenderHTML(&buf, doc); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate HTML"})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+		return
+	}
+
+	pdf, err := globalStore.Receipts.PDF(receipt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s.pdf", receipt.ReceiptNumber))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/mohammedrefaat/hamber/Middleware"
+	"github.com/mohammedrefaat/hamber/i18n"
+	"github.com/mohammedrefaat/hamber/receipts"
+)
+
+// ========== RECEIPT VERIFICATION ==========
+
+// VerifyReceipt godoc
+// @Summary      Verify a receipt
+// @Description  Opened from the QR code printed on receipts. Checks the token's signature and shows the receipt number, store, date, total and whether the receipt is valid or void, without other order details. Browsers get a page, API clients JSON.
+// @Tags         Receipts
+// @Produce      json,text/html
+// @Param        token path string true "Verification token from the QR code"
+// @Param        lang query string false "Page language (en, ar); defaults to the receipt's"
+// @Success      200 {object} receipts.Verification "Receipt is genuine"
+// @Failure      404 {object} map[string]interface{} "Receipt could not be verified"
+// @Router       /receipts/verify/{token} [get]
+func VerifyReceipt(c *gin.Context) {
+	verification, receipt, ok := globalStore.Receipts.Verify(c.Param("token"))
+
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEJSON {
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": "INVALID",
+				"error":  "Receipt could not be verified",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, verification)
+		return
+	}
+
+	status := http.StatusOK
+	language, _ := c.Request.Context().Value(middleware.LanguageKey).(string)
+	locale := i18n.NewLocale(language, "")
+	if ok {
+		locale = i18n.NewLocale(receipt.Language, receipt.Numerals)
+	} else {
+		status = http.StatusNotFound
+	}
+
+	var buf bytes.Buffer
+	if err := receipts.RenderVerification(&buf, verification, localeFromQuery(c, locale)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate HTML"})
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
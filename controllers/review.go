@@ -0,0 +1,368 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	db "github.com/mohammedrefaat/hamber/Db"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== PRODUCT REVIEWS ==========
+
+const maxReviewPhotos = 5
+
+type CreateReviewRequest struct {
+	OrderID      uint     `json:"order_id" binding:"required" example:"12"`
+	Rating       int      `json:"rating" binding:"required,min=1,max=5" example:"5"`
+	Title        string   `json:"title" example:"Great quality"`
+	Body         string   `json:"body" example:"Fits perfectly and arrived quickly."`
+	ReviewerName string   `json:"reviewer_name" example:"Mona A."` // Defaults to the client name
+	Photos       []string `json:"photos"`                          // Array of base64 encoded images
+}
+
+type ModerateReviewRequest struct {
+	Status string `json:"status" binding:"required,oneof=APPROVED REJECTED" example:"APPROVED"`
+	Note   string `json:"note" example:"Contains contact details"`
+}
+
+type ReviewReplyRequest struct {
+	Reply string `json:"reply" example:"Thank you for your feedback!"`
+}
+
+// CreateProductReview submits a verified-purchase review
+// @Summary Review a purchased product
+// @Description Creates a review for a product from a delivered order. The caller must own the order (bearer token) or present its X-Order-Token. Reviews are published after the store approves them.
+// @Tags Product Reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param X-Order-Token header string false "Guest order token returned at checkout"
+// @Param request body CreateReviewRequest true "Review"
+// @Success 201 {object} map[string]interface{} "Review submitted for moderation"
+// @Failure 400 {object} map[string]string "Order not delivered or product not in order"
+// @Failure 403 {object} map[string]string "Not allowed to review this order"
+// @Failure 409 {object} map[string]string "Already reviewed"
+// @Router /api/customer-website/products/{id}/reviews [post]
+func CreateProductReview(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req CreateReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Photos) > maxReviewPhotos {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A review can have at most 5 photos"})
+		return
+	}
+
+	product, err := globalStore.StStore.GetProduct(uint(productID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	order, err := globalStore.StStore.GetOrderWithItems(req.OrderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if !canAccessOrder(c, order) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to review this order"})
+		return
+	}
+	// The store cannot review its own products
+	if claims, err := utils.GetclamsFromContext(c); err == nil && claims.UserID == product.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Store owners cannot review their own products"})
+		return
+	}
+
+	// Verified purchase: the product must be an item of a delivered order
+	if order.Status != dbmodels.OrderStatus_DELIVERED {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only delivered orders can be reviewed"})
+		return
+	}
+	purchased := false
+	for _, item := range order.Items {
+		if item.ProductID == product.ID {
+			purchased = true
+			break
+		}
+	}
+	if !purchased {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product is not part of this order"})
+		return
+	}
+
+	review := &dbmodels.ProductReview{
+		ProductID:          product.ID,
+		StoreOwnerID:       product.UserID,
+		OrderID:            order.ID,
+		ClientID:           order.ClientID,
+		ReviewerName:       strings.TrimSpace(req.ReviewerName),
+		Rating:             req.Rating,
+		Title:              req.Title,
+		Body:               req.Body,
+		Photos:             "[]",
+		IsVerifiedPurchase: true,
+		Status:             dbmodels.ReviewStatus_PENDING,
+	}
+	if review.ReviewerName == "" {
+		review.ReviewerName = order.Client.Name
+	}
+
+	if len(req.Photos) > 0 {
+		photoURLs, err := uploadBase64Photos(context.Background(), globalStore.PhotoSrv, req.Photos, db.CategoryReview)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		photosJSON, _ := json.Marshal(photoURLs)
+		review.Photos = string(photosJSON)
+	}
+
+	if err := globalStore.StStore.CreateReview(review); err != nil {
+		code := http.StatusInternalServerError
+		if customErr, ok := err.(*stores.CustomError); ok {
+			code = customErr.Code
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+
+	if globalStore.NotifService != nil {
+		go globalStore.NotifService.NotifyNewReview(product.UserID, review.ID, product.Name, review.Rating)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Review submitted and awaiting moderation",
+		"review":  review,
+	})
+}
+
+// GetProductReviews lists the published reviews of a product
+// @Summary List product reviews
+// @Description Approved reviews of a product with the rating summary
+// @Tags Product Reviews
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(10)
+// @Param sort query string false "newest, oldest, highest or lowest" default(newest)
+// @Success 200 {object} map[string]interface{} "Reviews and rating summary"
+// @Router /api/customer-website/products/{id}/reviews [get]
+func GetProductReviews(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	reviews, total, err := globalStore.StStore.GetProductReviews(uint(productID), page, limit, c.DefaultQuery("sort", "newest"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	summary, err := globalStore.StStore.GetProductRatingSummary(uint(productID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews":     reviews,
+		"summary":     summary,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (int(total) + limit - 1) / limit,
+	})
+}
+
+// GetReviewQueue godoc
+// @Summary      Review moderation queue
+// @Description  Reviews of the current store's products, pending ones by default
+// @Tags         Product Reviews
+// @Produce      json
+// @Security     Bearer
+// @Param        status query string false "PENDING, APPROVED, REJECTED or ALL" default(PENDING)
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Reviews"
+// @Router       /dashboard/reviews [get]
+func GetReviewQueue(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var status *dbmodels.ReviewStatus
+	statusParam := strings.ToUpper(c.DefaultQuery("status", "PENDING"))
+	if statusParam != "ALL" {
+		value, ok := dbmodels.ReviewStatus_value[statusParam]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+		reviewStatus := dbmodels.ReviewStatus(value)
+		status = &reviewStatus
+	}
+
+	reviews, total, err := globalStore.StStore.GetStoreReviews(userID, status, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews":     reviews,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (int(total) + limit - 1) / limit,
+	})
+}
+
+// ModerateReview godoc
+// @Summary      Approve or reject a review
+// @Description  Publishes or hides a review and refreshes the product rating
+// @Tags         Product Reviews
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Review ID"
+// @Param        request body ModerateReviewRequest true "Moderation decision"
+// @Success      200 {object} map[string]interface{} "Review moderated"
+// @Failure      403 {object} map[string]interface{} "Not your store's review"
+// @Router       /dashboard/reviews/{id}/moderate [put]
+func ModerateReview(c *gin.Context) {
+	review, ok := loadStoreReview(c)
+	if !ok {
+		return
+	}
+
+	var req ModerateReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	review.Status = dbmodels.ReviewStatus(dbmodels.ReviewStatus_value[req.Status])
+	review.ModerationNote = req.Note
+	review.ModeratedAt = &now
+
+	if err := globalStore.StStore.UpdateReview(review); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+		return
+	}
+	if err := globalStore.StStore.RefreshProductRating(review.ProductID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh product rating"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Review " + strings.ToLower(req.Status),
+		"review":  review,
+	})
+}
+
+// ReplyToReview godoc
+// @Summary      Reply to a review
+// @Description  Sets the store's public reply on a review. An empty reply removes it.
+// @Tags         Product Reviews
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Review ID"
+// @Param        request body ReviewReplyRequest true "Reply"
+// @Success      200 {object} map[string]interface{} "Reply saved"
+// @Failure      403 {object} map[string]interface{} "Not your store's review"
+// @Router       /dashboard/reviews/{id}/reply [put]
+func ReplyToReview(c *gin.Context) {
+	review, ok := loadStoreReview(c)
+	if !ok {
+		return
+	}
+
+	var req ReviewReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	review.Reply = strings.TrimSpace(req.Reply)
+	review.RepliedAt = nil
+	if review.Reply != "" {
+		now := time.Now()
+		review.RepliedAt = &now
+	}
+
+	if err := globalStore.StStore.UpdateReview(review); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reply"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Reply saved",
+		"review":  review,
+	})
+}
+
+// loadStoreReview fetches the :id review and checks it belongs to the caller's store
+func loadStoreReview(c *gin.Context) (*dbmodels.ProductReview, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return nil, false
+	}
+
+	review, err := globalStore.StStore.GetReview(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return nil, false
+	}
+	if review.StoreOwnerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to manage this review"})
+		return nil, false
+	}
+	return review, true
+}
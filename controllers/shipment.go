@@ -0,0 +1,500 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/shipping"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== SHIPMENTS ==========
+
+const labelDir = "./uploads/labels"
+
+type ShipmentItemRequest struct {
+	OrderItemID uint `json:"order_item_id" binding:"required" example:"12"`
+	Quantity    int  `json:"quantity" binding:"required,min=1" example:"1"`
+}
+
+type CreateShipmentRequest struct {
+	Carrier string                `json:"carrier" example:"mock"` // Empty uses the default carrier
+	Items   []ShipmentItemRequest `json:"items"`                  // Empty ships everything not shipped yet
+	Notes   string                `json:"notes" example:"Fragile"`
+}
+
+func respondShipmentError(c *gin.Context, err error) {
+	code := http.StatusInternalServerError
+	if customErr, ok := err.(*stores.CustomError); ok {
+		code = customErr.Code
+	}
+	c.JSON(code, gin.H{"error": err.Error()})
+}
+
+// loadShippableOrder loads an order with its items for the store owner, or an admin
+func loadShippableOrder(c *gin.Context) (*dbmodels.Order, bool) {
+	claims, err := utils.GetclamsFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return nil, false
+	}
+
+	order, err := globalStore.StStore.GetOrderWithItems(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return nil, false
+	}
+	if order.UserID != claims.UserID && claims.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return order, true
+}
+
+// loadOrderShipment loads a shipment of an order the caller may manage
+func loadOrderShipment(c *gin.Context) (*dbmodels.Order, *dbmodels.Shipment, bool) {
+	order, ok := loadShippableOrder(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	shipmentID, err := strconv.ParseUint(c.Param("shipment_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return nil, nil, false
+	}
+	shipment, err := globalStore.StStore.GetShipment(uint(shipmentID))
+	if err != nil || shipment.OrderID != order.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+		return nil, nil, false
+	}
+	return order, shipment, true
+}
+
+// shipOrder books the items with a carrier and records the shipment. Without items,
+// every unit not shipped yet is included. The order must be loaded with items, user and client.
+func shipOrder(ctx context.Context, order *dbmodels.Order, carrierName string, items []ShipmentItemRequest, notes string) (*dbmodels.Shipment, error) {
+	if order.Status == dbmodels.OrderStatus_CANCELED {
+		return nil, &stores.CustomError{Message: "Order is canceled", Code: http.StatusBadRequest}
+	}
+
+	shipped, err := globalStore.StStore.GetShippedQuantities(order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	orderItems := make(map[uint]dbmodels.OrderItem, len(order.Items))
+	for _, item := range order.Items {
+		orderItems[item.ID] = item
+	}
+	if len(items) == 0 {
+		for _, item := range order.Items {
+			if remaining := item.Quantity - shipped[item.ID]; remaining > 0 {
+				items = append(items, ShipmentItemRequest{OrderItemID: item.ID, Quantity: remaining})
+			}
+		}
+		if len(items) == 0 {
+			return nil, &stores.CustomError{Message: "All items of this order are already shipped", Code: http.StatusBadRequest}
+		}
+	}
+
+	// Merge repeated lines, then check against what is left to ship
+	quantities := map[uint]int{}
+	var ids []uint
+	for _, item := range items {
+		if _, ok := orderItems[item.OrderItemID]; !ok {
+			return nil, &stores.CustomError{Message: fmt.Sprintf("Order item %d is not part of this order", item.OrderItemID), Code: http.StatusBadRequest}
+		}
+		if _, seen := quantities[item.OrderItemID]; !seen {
+			ids = append(ids, item.OrderItemID)
+		}
+		quantities[item.OrderItemID] += item.Quantity
+	}
+
+	shipmentItems := make([]dbmodels.ShipmentItem, 0, len(ids))
+	parcelItems := make([]shipping.ParcelItem, 0, len(ids))
+	for _, id := range ids {
+		orderItem := orderItems[id]
+		if remaining := orderItem.Quantity - shipped[id]; quantities[id] > remaining {
+			return nil, &stores.CustomError{
+				Message: fmt.Sprintf("Order item %d has only %d unit(s) left to ship", id, remaining),
+				Code:    http.StatusBadRequest,
+			}
+		}
+		shipmentItems = append(shipmentItems, dbmodels.ShipmentItem{
+			OrderItemID: id,
+			ProductID:   orderItem.ProductID,
+			Quantity:    quantities[id],
+		})
+		parcelItems = append(parcelItems, shipping.ParcelItem{
+			SKU:      orderItem.Product.SKU,
+			Name:     orderItem.Product.Name,
+			Quantity: quantities[id],
+		})
+	}
+
+	carrier, err := globalStore.Shipping.Carriers.Get(carrierName)
+	if err != nil {
+		return nil, &stores.CustomError{Message: err.Error(), Code: http.StatusBadRequest}
+	}
+
+	recipientAddress := order.Address
+	if recipientAddress == "" {
+		recipientAddress = order.Client.Address
+	}
+	recipientPhone := order.Phone
+	if recipientPhone == "" {
+		recipientPhone = order.Client.Phone
+	}
+	result, err := carrier.CreateShipment(ctx, shipping.ShipmentRequest{
+		Reference: fmt.Sprintf("ORD-%d-%d", order.ID, time.Now().Unix()),
+		Sender: shipping.Address{
+			Name:  order.User.Name,
+			Phone: order.User.Phone,
+			Email: order.User.Email,
+		},
+		Recipient: shipping.Address{
+			Name:    order.Client.Name,
+			Phone:   recipientPhone,
+			Email:   order.Client.Email,
+			Address: recipientAddress,
+		},
+		Items:          parcelItems,
+		Notes:          notes,
+		CashOnDelivery: cashOnDelivery(order, shipped, quantities),
+	})
+	if err != nil {
+		log.Printf("Shipments: booking order %d with %s failed: %v", order.ID, carrier.Name(), err)
+		return nil, &stores.CustomError{Message: "Carrier rejected the shipment: " + err.Error(), Code: http.StatusBadGateway}
+	}
+
+	labelPath, err := saveShippingLabel(carrier.Name(), result.TrackingNumber, result.Label)
+	if err != nil {
+		log.Printf("Shipments: failed to save label for %s: %v", result.TrackingNumber, err)
+	}
+
+	now := time.Now()
+	shipment := &dbmodels.Shipment{
+		OrderID:          order.ID,
+		StoreOwnerID:     order.UserID,
+		Carrier:          carrier.Name(),
+		TrackingNumber:   result.TrackingNumber,
+		CarrierReference: result.CarrierReference,
+		Status:           dbmodels.ShipmentStatus_CREATED,
+		LabelPath:        labelPath,
+		Notes:            notes,
+		ShippedAt:        now,
+		Items:            shipmentItems,
+		Events: []dbmodels.ShipmentEvent{{
+			Status:      dbmodels.ShipmentStatus_CREATED,
+			Description: fmt.Sprintf("Shipment created with %s", carrier.Name()),
+			OccurredAt:  now,
+		}},
+	}
+	if err := globalStore.StStore.CreateShipment(shipment); err != nil {
+		// Do not leave a booked parcel behind that we have no record of
+		if cancelErr := carrier.Cancel(ctx, result.TrackingNumber); cancelErr != nil {
+			log.Printf("Shipments: failed to cancel unrecorded parcel %s: %v", result.TrackingNumber, cancelErr)
+		}
+		if labelPath != "" {
+			os.Remove(labelPath)
+		}
+		return nil, err
+	}
+
+	go globalStore.Shipping.NotifyCustomer(shipment, shipment.Events[0])
+	return shipment, nil
+}
+
+// saveShippingLabel writes the label PDF next to generated receipts
+func saveShippingLabel(carrier, trackingNumber string, label []byte) (string, error) {
+	if len(label) == 0 {
+		return "", nil
+	}
+	if err := os.MkdirAll(labelDir, 0755); err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(carrier + "-" + trackingNumber)
+	path := filepath.Join(labelDir, name+".pdf")
+	if err := os.WriteFile(path, label, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// cashOnDelivery returns what the courier collects with a parcel: the order total,
+// on the parcel that ships the last of a cash on delivery order still awaiting
+// collection
+func cashOnDelivery(order *dbmodels.Order, shipped, quantities map[uint]int) *shipping.CashCollection {
+	for _, item := range order.Items {
+		if shipped[item.ID]+quantities[item.ID] < item.Quantity {
+			return nil
+		}
+	}
+	offline, err := globalStore.StStore.GetOrderOfflinePayment(order.ID)
+	if err != nil || offline.Status != dbmodels.OfflinePaymentStatus_AWAITING_COLLECTION ||
+		offline.Payment.PaymentStatus != dbmodels.PaymentStatus_PENDING {
+		return nil
+	}
+	return &shipping.CashCollection{Amount: offline.Payment.Amount, Currency: offline.Payment.Currency}
+}
+
+// CreateShipment godoc
+// @Summary      Ship order items
+// @Description  Books a parcel with a carrier for some or all remaining items of an order and stores its label. A pending order becomes SHIPPED.
+// @Tags         Shipments
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Order ID"
+// @Param        request body CreateShipmentRequest false "Carrier and items"
+// @Success      201 {object} map[string]interface{} "Shipment created"
+// @Failure      400 {object} map[string]interface{} "Invalid items"
+// @Failure      502 {object} map[string]interface{} "Carrier error"
+// @Failure      402 {object} map[string]interface{} "Upgrade required"
+// @Router       /orders/{id}/shipments [post]
+func CreateShipment(c *gin.Context) {
+	order, ok := loadShippableOrder(c)
+	if !ok || !requireFeature(c, order.UserID, dbmodels.Feature_SHIPPING) {
+		return
+	}
+
+	var req CreateShipmentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	shipment, err := shipOrder(c.Request.Context(), order, strings.TrimSpace(req.Carrier), req.Items, req.Notes)
+	if err != nil {
+		respondShipmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Shipment created",
+		"shipment": shipment,
+	})
+}
+
+// GetOrderShipments godoc
+// @Summary      List order shipments
+// @Description  Shipments of an order with their items and tracking history
+// @Tags         Shipments
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Order ID"
+// @Success      200 {object} map[string]interface{} "Shipments"
+// @Router       /orders/{id}/shipments [get]
+func GetOrderShipments(c *gin.Context) {
+	order, ok := loadShippableOrder(c)
+	if !ok {
+		return
+	}
+
+	shipments, err := globalStore.StStore.GetOrderShipments(order.ID)
+	if err != nil {
+		respondShipmentError(c, err)
+		return
+	}
+	shipped, err := globalStore.StStore.GetShippedQuantities(order.ID)
+	if err != nil {
+		respondShipmentError(c, err)
+		return
+	}
+
+	remaining := []gin.H{}
+	for _, item := range order.Items {
+		if left := item.Quantity - shipped[item.ID]; left > 0 {
+			remaining = append(remaining, gin.H{
+				"order_item_id": item.ID,
+				"product_id":    item.ProductID,
+				"name":          item.Product.Name,
+				"quantity":      left,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"shipments": shipments,
+		"remaining": remaining,
+		"carriers":  globalStore.Shipping.Carriers.Names(),
+	})
+}
+
+// GetCustomerOrderShipments godoc
+// @Summary      Track my order
+// @Description  Shipments and tracking history of an order, for the shopper holding its order token
+// @Tags         Shipments
+// @Produce      json
+// @Param        id path int true "Order ID"
+// @Param        X-Order-Token header string false "Order token returned at checkout"
+// @Success      200 {object} map[string]interface{} "Shipments"
+// @Failure      403 {object} map[string]interface{} "Access denied"
+// @Router       /customer-website/orders/{id}/shipments [get]
+func GetCustomerOrderShipments(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	order, err := globalStore.StStore.GetOrderByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if !canAccessOrder(c, order) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	shipments, err := globalStore.StStore.GetOrderShipments(order.ID)
+	if err != nil {
+		respondShipmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id":     order.ID,
+		"order_status": order.Status.String(),
+		"shipments":    shipments,
+	})
+}
+
+// DownloadShippingLabel godoc
+// @Summary      Download shipping label
+// @Tags         Shipments
+// @Produce      application/pdf
+// @Security     Bearer
+// @Param        id path int true "Order ID"
+// @Param        shipment_id path int true "Shipment ID"
+// @Success      200 {file} file "PDF file"
+// @Failure      404 {object} map[string]interface{} "Label not found"
+// @Router       /orders/{id}/shipments/{shipment_id}/label [get]
+func DownloadShippingLabel(c *gin.Context) {
+	_, shipment, ok := loadOrderShipment(c)
+	if !ok {
+		return
+	}
+	if shipment.LabelPath == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Label not found"})
+		return
+	}
+	if _, err := os.Stat(shipment.LabelPath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Label not found"})
+		return
+	}
+
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=label-%s.pdf", shipment.TrackingNumber))
+	c.File(shipment.LabelPath)
+}
+
+// TrackShipment godoc
+// @Summary      Refresh shipment tracking
+// @Description  Asks the carrier for the latest status now instead of waiting for the tracking job
+// @Tags         Shipments
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Order ID"
+// @Param        shipment_id path int true "Shipment ID"
+// @Success      200 {object} map[string]interface{} "Tracking refreshed"
+// @Failure      502 {object} map[string]interface{} "Carrier error"
+// @Router       /orders/{id}/shipments/{shipment_id}/track [post]
+func TrackShipment(c *gin.Context) {
+	_, shipment, ok := loadOrderShipment(c)
+	if !ok {
+		return
+	}
+	if shipment.Status.IsFinal() {
+		c.JSON(http.StatusOK, gin.H{"shipment": shipment, "new_events": 0})
+		return
+	}
+
+	added, err := globalStore.Shipping.Refresh(c.Request.Context(), shipment)
+	if err != nil {
+		if _, ok := err.(*stores.CustomError); ok {
+			respondShipmentError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Tracking failed: " + err.Error()})
+		return
+	}
+
+	shipment, err = globalStore.StStore.GetShipment(shipment.ID)
+	if err != nil {
+		respondShipmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"shipment":   shipment,
+		"new_events": len(added),
+	})
+}
+
+// CancelShipment godoc
+// @Summary      Cancel a shipment
+// @Description  Cancels the parcel with the carrier so its items can be shipped again. An order left without shipments goes back to PENDING.
+// @Tags         Shipments
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Order ID"
+// @Param        shipment_id path int true "Shipment ID"
+// @Success      200 {object} map[string]interface{} "Shipment canceled"
+// @Failure      409 {object} map[string]interface{} "Already picked up"
+// @Router       /orders/{id}/shipments/{shipment_id}/cancel [post]
+func CancelShipment(c *gin.Context) {
+	_, shipment, ok := loadOrderShipment(c)
+	if !ok {
+		return
+	}
+	if shipment.Status.IsFinal() {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Shipment is already %s", shipment.Status)})
+		return
+	}
+
+	carrier, err := globalStore.Shipping.Carriers.Get(shipment.Carrier)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// A parcel the carrier no longer knows about is canceled on our side only
+	if err := carrier.Cancel(c.Request.Context(), shipment.TrackingNumber); err != nil && !errors.Is(err, shipping.ErrUnknownShipment) {
+		if errors.Is(err, shipping.ErrNotCancelable) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The carrier can no longer cancel this shipment"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Carrier cancel failed: " + err.Error()})
+		return
+	}
+
+	if err := globalStore.StStore.CancelShipment(shipment); err != nil {
+		respondShipmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Shipment canceled",
+		"shipment": shipment,
+	})
+}
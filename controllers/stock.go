@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== LOW STOCK & REORDER ==========
+
+type StockSettingRequest struct {
+	Category        string `json:"category" example:"Electronics"` // Empty sets the store-wide default
+	ReorderPoint    int    `json:"reorder_point" binding:"min=0" example:"5"`
+	ReorderQuantity int    `json:"reorder_quantity" binding:"required,min=1" example:"25"`
+}
+
+type ProductStockSettingsRequest struct {
+	ReorderPoint    *int `json:"reorder_point" binding:"omitempty,min=0" example:"5"`     // null falls back to the category default
+	ReorderQuantity *int `json:"reorder_quantity" binding:"omitempty,min=1" example:"25"` // null falls back to the category default
+}
+
+// GetReorderSuggestions godoc
+// @Summary      Get reorder suggestions
+// @Description  Products ranked by days of stock left, computed from sales velocity over the last days
+// @Tags         Dashboard
+// @Produce      json
+// @Security     Bearer
+// @Param        days query int false "Sales window in days" default(30)
+// @Param        cover_days query int false "Days of sales a reorder should cover" default(30)
+// @Param        only_low query bool false "Only products at or below their reorder point"
+// @Success      200 {object} map[string]interface{} "Reorder suggestions"
+// @Router       /dashboard/reorder-suggestions [get]
+func GetReorderSuggestions(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	days, _ := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(globalStore.Config.GetSalesWindowDays())))
+	if days < 1 || days > 365 {
+		days = globalStore.Config.GetSalesWindowDays()
+	}
+	coverDays, _ := strconv.Atoi(c.DefaultQuery("cover_days", "30"))
+	if coverDays < 1 || coverDays > 365 {
+		coverDays = 30
+	}
+
+	suggestions, err := globalStore.StStore.GetReorderSuggestions(userID, days, coverDays)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("only_low") == "true" {
+		filtered := suggestions[:0]
+		for _, suggestion := range suggestions {
+			if suggestion.BelowReorder {
+				filtered = append(filtered, suggestion)
+			}
+		}
+		suggestions = filtered
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":        days,
+		"cover_days":  coverDays,
+		"suggestions": suggestions,
+		"count":       len(suggestions),
+	})
+}
+
+// GetStockSettings godoc
+// @Summary      List reorder defaults
+// @Description  Store-wide (empty category) and per-category reorder points and quantities
+// @Tags         Products
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "Stock settings"
+// @Router       /products/stock-settings [get]
+func GetStockSettings(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := globalStore.StStore.GetStockSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings": settings,
+		"defaults": gin.H{
+			"reorder_point":    dbmodels.DefaultReorderPoint,
+			"reorder_quantity": dbmodels.DefaultReorderQuantity,
+		},
+	})
+}
+
+// SaveStockSetting godoc
+// @Summary      Set reorder defaults
+// @Description  Creates or replaces the reorder point and quantity for a category, or for the whole store when category is empty
+// @Tags         Products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body StockSettingRequest true "Reorder defaults"
+// @Success      200 {object} map[string]interface{} "Setting saved"
+// @Router       /products/stock-settings [put]
+func SaveStockSetting(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req StockSettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setting := &dbmodels.StockSetting{
+		UserID:          userID,
+		Category:        strings.TrimSpace(req.Category),
+		ReorderPoint:    req.ReorderPoint,
+		ReorderQuantity: req.ReorderQuantity,
+	}
+	if err := globalStore.StStore.SaveStockSetting(setting); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Stock setting saved",
+		"setting": setting,
+	})
+}
+
+// DeleteStockSetting godoc
+// @Summary      Remove reorder defaults
+// @Tags         Products
+// @Produce      json
+// @Security     Bearer
+// @Param        category query string false "Category; empty removes the store-wide default"
+// @Success      200 {object} map[string]interface{} "Setting removed"
+// @Router       /products/stock-settings [delete]
+func DeleteStockSetting(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := globalStore.StStore.DeleteStockSetting(userID, strings.TrimSpace(c.Query("category"))); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove stock setting"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Stock setting removed"})
+}
+
+// UpdateProductStockSettings godoc
+// @Summary      Set product reorder point
+// @Description  Overrides the reorder point and quantity of one product. Null values fall back to the category or store default.
+// @Tags         Products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Product ID"
+// @Param        request body ProductStockSettingsRequest true "Reorder settings"
+// @Success      200 {object} map[string]interface{} "Settings updated"
+// @Failure      403 {object} map[string]interface{} "Not authorized"
+// @Router       /products/{id}/stock-settings [put]
+func UpdateProductStockSettings(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ProductStockSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := globalStore.StStore.GetProduct(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if product.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to update this product"})
+		return
+	}
+
+	if err := globalStore.StStore.UpdateProductReorderSettings(product.ID, req.ReorderPoint, req.ReorderQuantity); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Stock settings updated",
+		"reorder_point":    req.ReorderPoint,
+		"reorder_quantity": req.ReorderQuantity,
+	})
+}
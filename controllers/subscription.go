@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/stores"
+)
+
+// ========== SUBSCRIPTION BILLING ==========
+
+type PayInvoiceRequest struct {
+	PaymentMethod string `json:"payment_method" binding:"required"` // fawry, paymob, sandbox, bank_transfer or instapay
+}
+
+type PayInvoiceResponse struct {
+	InvoiceID       uint       `json:"invoice_id"`
+	PaymentID       uint       `json:"payment_id"`
+	PaymentURL      string     `json:"payment_url,omitempty"`
+	ReferenceNumber string     `json:"reference_number,omitempty"`
+	Message         string     `json:"message"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+}
+
+// GetMySubscription godoc
+// @Summary      Get the current subscription
+// @Description  The user's newest subscription with its renewal state and unpaid renewal invoices. A past due subscription keeps its features until grace_ends_at.
+// @Tags         Payments
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "Subscription and open invoices"
+// @Failure      404 {object} map[string]interface{} "No subscription"
+// @Router       /payment/subscription [get]
+func GetMySubscription(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	subscription, err := globalStore.StStore.GetLatestSubscription(userID.(uint))
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+
+	open := dbmodels.InvoiceStatus_OPEN
+	invoices, _, err := globalStore.StStore.GetSubscriptionInvoices(stores.InvoiceFilter{UserID: userID.(uint), Status: &open}, 1, 100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"subscription":  subscription,
+		"status_name":   subscription.Status.String(),
+		"open_invoices": invoices,
+	}
+	if subscription.Status == dbmodels.SubscriptionStatus_PAST_DUE {
+		response["grace_ends_at"] = subscription.EndDate.Add(globalStore.Config.GetGracePeriod())
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelSubscriptionRenewal godoc
+// @Summary      Turn off renewal
+// @Description  The paid subscription runs to the end of its period and the account then moves to the free package. The open renewal invoice is voided.
+// @Tags         Payments
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "Renewal turned off"
+// @Failure      400 {object} map[string]interface{} "Subscription cannot be cancelled"
+// @Router       /payment/subscription/cancel [post]
+func CancelSubscriptionRenewal(c *gin.Context) {
+	setSubscriptionRenewal(c, true)
+}
+
+// ResumeSubscriptionRenewal godoc
+// @Summary      Turn renewal back on
+// @Description  Undoes a cancellation before the period ends; a renewal invoice is issued again when it is due
+// @Tags         Payments
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} map[string]interface{} "Renewal turned on"
+// @Failure      400 {object} map[string]interface{} "Subscription is not cancelled"
+// @Router       /payment/subscription/resume [post]
+func ResumeSubscriptionRenewal(c *gin.Context) {
+	setSubscriptionRenewal(c, false)
+}
+
+func setSubscriptionRenewal(c *gin.Context, cancel bool) {
+	userID, _ := c.Get("user_id")
+
+	subscription, err := globalStore.StStore.GetLatestSubscription(userID.(uint))
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+	if subscription.Status != dbmodels.SubscriptionStatus_ACTIVE || !subscription.EndDate.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Subscription is not active"})
+		return
+	}
+	if !subscription.Package.Price.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Free subscriptions are not billed"})
+		return
+	}
+	if subscription.CancelAtPeriodEnd == cancel {
+		message := "Renewal is already on"
+		if cancel {
+			message = "Renewal is already off"
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+
+	if err := globalStore.StStore.SetCancelAtPeriodEnd(subscription, cancel); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	subscription.CancelAtPeriodEnd = cancel
+
+	message := "Renewal turned back on"
+	if cancel {
+		message = "Your subscription ends on " + subscription.EndDate.Format("2006-01-02") + " without renewal"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":      message,
+		"subscription": subscription,
+	})
+}
+
+// GetMyInvoices godoc
+// @Summary      List renewal invoices
+// @Tags         Payments
+// @Produce      json
+// @Security     Bearer
+// @Param        status query string false "OPEN, PAID, VOID or UNCOLLECTIBLE"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Invoices"
+// @Router       /payment/invoices [get]
+func GetMyInvoices(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	listInvoices(c, userID.(uint))
+}
+
+// PayInvoice godoc
+// @Summary      Pay a renewal invoice
+// @Description  Starts a payment for an open invoice now instead of waiting for the next automatic attempt. Paying an invoice left unpaid by a suspension or downgrade restores the package from now on.
+// @Tags         Payments
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id path int true "Invoice ID"
+// @Param        request body PayInvoiceRequest true "Payment method"
+// @Success      200 {object} PayInvoiceResponse "How to pay"
+// @Failure      400 {object} map[string]interface{} "Invoice cannot be paid"
+// @Failure      404 {object} map[string]interface{} "Invoice not found"
+// @Router       /payment/invoices/{id}/pay [post]
+func PayInvoice(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var req PayInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkPaymentMethod(req.PaymentMethod); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invoice, err := globalStore.StStore.GetSubscriptionInvoice(uint(id))
+	if err != nil || invoice.UserID != userID.(uint) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+	if err := checkInvoicePayable(invoice); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	paymentdb, result, err := globalStore.Renewals.PayInvoice(c.Request.Context(), invoice, req.PaymentMethod)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if customErr, ok := err.(*stores.CustomError); ok {
+			code = customErr.Code
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, PayInvoiceResponse{
+		InvoiceID:       invoice.ID,
+		PaymentID:       paymentdb.ID,
+		PaymentURL:      result.PaymentURL,
+		ReferenceNumber: result.ReferenceNumber,
+		Message:         result.Message,
+		ExpiresAt:       paymentdb.ExpiresAt,
+	})
+}
+
+// checkInvoicePayable allows open invoices, and uncollectible ones while the
+// user is still suspended or on the free package they were downgraded to
+func checkInvoicePayable(invoice *dbmodels.SubscriptionInvoice) error {
+	switch invoice.Status {
+	case dbmodels.InvoiceStatus_OPEN:
+		return nil
+	case dbmodels.InvoiceStatus_UNCOLLECTIBLE:
+		latest, err := globalStore.StStore.GetLatestSubscription(invoice.UserID)
+		if err == nil && (latest.Status == dbmodels.SubscriptionStatus_SUSPENDED || latest.PackageID == globalStore.Config.GetFreePackageID()) {
+			return nil
+		}
+		return &stores.CustomError{Message: "Invoice was replaced by a later package change", Code: http.StatusBadRequest}
+	default:
+		return &stores.CustomError{Message: "Invoice is " + invoice.Status.String(), Code: http.StatusBadRequest}
+	}
+}
+
+// GetMySubscriptionEvents godoc
+// @Summary      Subscription billing history
+// @Description  Invoices issued, payment attempts, renewals, grace periods, suspensions and downgrades, newest first
+// @Tags         Payments
+// @Produce      json
+// @Security     Bearer
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Events"
+// @Router       /payment/subscription/events [get]
+func GetMySubscriptionEvents(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	listSubscriptionEvents(c, userID.(uint))
+}
+
+// ========== ADMIN: SUBSCRIPTION BILLING ==========
+
+// GetBillingInvoices godoc
+// @Summary      List renewal invoices of all users
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        user_id query int false "Filter by user"
+// @Param        status query string false "OPEN, PAID, VOID or UNCOLLECTIBLE"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Invoices"
+// @Router       /admin/billing/invoices [get]
+func GetBillingInvoices(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Query("user_id"), 10, 32)
+	listInvoices(c, uint(userID))
+}
+
+// GetBillingEvents godoc
+// @Summary      Subscription billing events of all users
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        user_id query int false "Filter by user"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Events"
+// @Router       /admin/billing/events [get]
+func GetBillingEvents(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Query("user_id"), 10, 32)
+	listSubscriptionEvents(c, uint(userID))
+}
+
+// RunBilling godoc
+// @Summary      Run renewals now
+// @Description  Issues due renewal invoices, attempts their payment and applies grace period ends, as the background job does
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} billing.RenewalSummary "What was done"
+// @Router       /admin/billing/run [post]
+func RunBilling(c *gin.Context) {
+	summary, err := globalStore.Renewals.Run(c.Request.Context(), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "summary": summary})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// listInvoices writes a page of invoices; userID 0 lists all users
+func listInvoices(c *gin.Context, userID uint) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := stores.InvoiceFilter{UserID: userID}
+	if status := c.Query("status"); status != "" {
+		value, ok := dbmodels.InvoiceStatus_value[strings.ToUpper(status)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+		invoiceStatus := dbmodels.InvoiceStatus(value)
+		filter.Status = &invoiceStatus
+	}
+
+	invoices, total, err := globalStore.StStore.GetSubscriptionInvoices(filter, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invoices":    invoices,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (int(total) + limit - 1) / limit,
+	})
+}
+
+// listSubscriptionEvents writes a page of billing events; userID 0 lists all users
+func listSubscriptionEvents(c *gin.Context, userID uint) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	events, total, err := globalStore.StStore.GetSubscriptionEvents(userID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":      events,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (int(total) + limit - 1) / limit,
+	})
+}
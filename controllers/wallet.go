@@ -0,0 +1,310 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/payment"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/shopspring/decimal"
+)
+
+// ========== WALLET ==========
+
+type WalletTopUpRequest struct {
+	Amount        decimal.Decimal `json:"amount" binding:"required" example:"250.00"`
+	PaymentMethod string          `json:"payment_method" binding:"required" example:"paymob"` // Gateway name, e.g. fawry, paymob or sandbox, bank_transfer or instapay
+}
+
+type WalletTopUpResponse struct {
+	PaymentID       uint            `json:"payment_id"`
+	PaymentURL      string          `json:"payment_url,omitempty"`
+	ReferenceNumber string          `json:"reference_number,omitempty"`
+	Amount          decimal.Decimal `json:"amount"`
+	Currency        string          `json:"currency"`
+	Message         string          `json:"message"`
+	ExpiresAt       *time.Time      `json:"expires_at,omitempty"`
+}
+
+type WalletAdjustmentRequest struct {
+	Amount decimal.Decimal `json:"amount" binding:"required" example:"-50.00"` // Positive credits, negative debits
+	Note   string          `json:"note" binding:"required" example:"Goodwill credit for the outage"`
+}
+
+// checkPaymentMethodOrWallet is checkPaymentMethod that also accepts the wallet
+func checkPaymentMethodOrWallet(method string) error {
+	if method == dbmodels.WalletPaymentMethod {
+		return nil
+	}
+	return checkPaymentMethod(method)
+}
+
+// payFromWallet settles a stored pending wallet payment from the payer's wallet
+// and sends the same follow-ups as a gateway callback. When the wallet cannot
+// pay, the payment is failed so what it was for is given up. Errors are
+// *stores.CustomError.
+func payFromWallet(paymentdb *dbmodels.Payment, payerID uint) (*stores.PaymentTransition, error) {
+	transition, err := globalStore.StStore.PayWithWallet(paymentdb.ID, payerID)
+	if err != nil {
+		applyPaymentResult(paymentdb, dbmodels.PaymentStatus_FAILED, "", 0)
+		return nil, err
+	}
+	followUpPaymentTransition(transition)
+	return transition, nil
+}
+
+// GetMyWallet godoc
+// @Summary      Get my wallet
+// @Description  Prepaid balance in the platform currency, usable as the "wallet" payment method for packages, add-ons and storefront orders
+// @Tags         Wallet
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} dbmodels.Wallet "Wallet"
+// @Router       /wallet [get]
+func GetMyWallet(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	wallet, err := globalStore.StStore.GetWallet(userID.(uint), globalStore.Config.GetBaseCurrency())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, wallet)
+}
+
+// GetMyWalletTransactions godoc
+// @Summary      Get my wallet ledger
+// @Description  Credits and debits of the wallet with their reason, reference and the balance after each, newest first
+// @Tags         Wallet
+// @Produce      json
+// @Security     Bearer
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Ledger entries"
+// @Router       /wallet/transactions [get]
+func GetMyWalletTransactions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	listWalletTransactions(c, userID.(uint))
+}
+
+// TopUpWallet godoc
+// @Summary      Top up my wallet
+// @Description  Starts a gateway payment for the amount, in the platform currency. The wallet is credited once the gateway confirms the payment.
+// @Tags         Wallet
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body WalletTopUpRequest true "Amount and gateway"
+// @Success      200 {object} WalletTopUpResponse "Payment initiated"
+// @Failure      400 {object} map[string]interface{} "Invalid request"
+// @Router       /wallet/top-up [post]
+func TopUpWallet(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req WalletTopUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	amount := money.Round(req.Amount)
+	if !amount.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be positive"})
+		return
+	}
+	// A wallet cannot top itself up
+	if err := checkPaymentMethod(req.PaymentMethod); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := globalStore.StStore.GetUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	currency := globalStore.Config.GetBaseCurrency()
+	expiresAt := time.Now().Add(24 * time.Hour)
+	paymentdb := dbmodels.Payment{
+		UserID:          user.ID,
+		Purpose:         dbmodels.PaymentPurpose_WALLET_TOPUP,
+		Amount:          amount,
+		Currency:        currency,
+		PaymentMethod:   req.PaymentMethod,
+		PaymentStatus:   dbmodels.PaymentStatus_PENDING,
+		ReferenceNumber: payment.NewReference(fmt.Sprintf("WLT-%d", user.ID)),
+		ExpiresAt:       &expiresAt,
+	}
+	if err := globalStore.StStore.CreatePayment(&paymentdb); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment record"})
+		return
+	}
+
+	result, err := startGatewayPayment(c.Request.Context(), &paymentdb, payment.InitiateRequest{
+		Description: "Wallet top-up",
+		Customer: payment.Customer{
+			Name:  user.Name,
+			Email: user.Email,
+			Phone: user.Phone,
+		},
+		Items: []payment.Item{{
+			ID:       fmt.Sprintf("WLT-%d", user.ID),
+			Name:     "Wallet top-up",
+			Price:    amount,
+			Quantity: 1,
+		}},
+	})
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, WalletTopUpResponse{
+		PaymentID:       paymentdb.ID,
+		PaymentURL:      result.PaymentURL,
+		ReferenceNumber: result.ReferenceNumber,
+		Amount:          amount,
+		Currency:        currency,
+		Message:         result.Message,
+		ExpiresAt:       paymentdb.ExpiresAt,
+	})
+}
+
+// ========== ADMIN: WALLETS ==========
+
+// GetUserWallet godoc
+// @Summary      Get a user's wallet
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        user_id path int true "User ID"
+// @Success      200 {object} dbmodels.Wallet "Wallet"
+// @Router       /admin/wallets/{user_id} [get]
+func GetUserWallet(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	wallet, err := globalStore.StStore.GetWallet(uint(userID), globalStore.Config.GetBaseCurrency())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, wallet)
+}
+
+// GetUserWalletTransactions godoc
+// @Summary      Get a user's wallet ledger
+// @Tags         Admin
+// @Produce      json
+// @Security     Bearer
+// @Param        user_id path int true "User ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200 {object} map[string]interface{} "Ledger entries"
+// @Router       /admin/wallets/{user_id}/transactions [get]
+func GetUserWalletTransactions(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	listWalletTransactions(c, uint(userID))
+}
+
+// AdjustWallet godoc
+// @Summary      Adjust a user's wallet
+// @Description  Credits a positive amount or debits a negative one, recorded as an ADJUSTMENT with the admin and note. A debit cannot take the balance below zero.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        user_id path int true "User ID"
+// @Param        request body WalletAdjustmentRequest true "Adjustment"
+// @Success      200 {object} dbmodels.WalletTransaction "Ledger entry"
+// @Failure      402 {object} map[string]interface{} "Insufficient balance"
+// @Router       /admin/wallets/{user_id}/adjust [post]
+func AdjustWallet(c *gin.Context) {
+	adminID, _ := c.Get("user_id")
+
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req WalletAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	amount := money.Round(req.Amount)
+	if amount.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must not be zero"})
+		return
+	}
+
+	if _, err := globalStore.StStore.GetUser(uint(userID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	createdBy := adminID.(uint)
+	entry := stores.WalletEntry{
+		Type:      dbmodels.WalletEntryType_CREDIT,
+		Reason:    dbmodels.WalletEntryReason_ADJUSTMENT,
+		Amount:    amount,
+		Reference: fmt.Sprintf("ADJ-%d", createdBy),
+		Note:      req.Note,
+		CreatedBy: &createdBy,
+	}
+	if amount.IsNegative() {
+		entry.Type = dbmodels.WalletEntryType_DEBIT
+		entry.Amount = amount.Neg()
+	}
+
+	currency := globalStore.Config.GetBaseCurrency()
+	posted, err := globalStore.StStore.PostWalletEntry(uint(userID), currency, entry)
+	if err != nil {
+		c.JSON(err.(*stores.CustomError).Code, gin.H{"error": err.Error()})
+		return
+	}
+
+	if globalStore.NotifService != nil {
+		go globalStore.NotifService.NotifyWalletBalance(posted.UserID, posted, currency)
+	}
+	c.JSON(http.StatusOK, posted)
+}
+
+// listWalletTransactions writes a page of a user's wallet ledger
+func listWalletTransactions(c *gin.Context, userID uint) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	entries, total, err := globalStore.StStore.GetWalletTransactions(userID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": entries,
+		"total":        total,
+		"page":         page,
+		"limit":        limit,
+		"total_pages":  (int(total) + limit - 1) / limit,
+	})
+}
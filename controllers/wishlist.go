@@ -0,0 +1,531 @@
+package controllers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== WISHLISTS ==========
+
+type CreateWishlistRequest struct {
+	Name     string `json:"name" binding:"required" example:"Birthday ideas"`
+	IsPublic bool   `json:"is_public" example:"false"`
+}
+
+type UpdateWishlistRequest struct {
+	Name     string `json:"name" example:"Birthday ideas"`
+	IsPublic *bool  `json:"is_public" example:"true"`
+}
+
+type AddWishlistItemRequest struct {
+	ProductID         uint   `json:"product_id" binding:"required" example:"1"`
+	Note              string `json:"note" example:"Size M"`
+	NotifyBackInStock *bool  `json:"notify_back_in_stock" example:"true"`
+	NotifyPriceDrop   *bool  `json:"notify_price_drop" example:"true"`
+}
+
+type MoveToCartRequest struct {
+	Quantity int  `json:"quantity" example:"1"`
+	Keep     bool `json:"keep" example:"false"` // Keep the item on the wishlist after moving
+}
+
+// wishlistOwner resolves the shopper from the bearer token or the guest X-Session-ID header
+func wishlistOwner(c *gin.Context) (*uint, string, bool) {
+	var userID *uint
+	if claims, err := utils.GetclamsFromContext(c); err == nil {
+		userID = &claims.UserID
+	}
+
+	sessionID := c.GetHeader("X-Session-ID")
+	if sessionID == "" && userID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Session ID required for guest users"})
+		return nil, "", false
+	}
+	return userID, sessionID, true
+}
+
+// loadOwnedWishlist fetches the :id wishlist and makes sure it belongs to the caller
+func loadOwnedWishlist(c *gin.Context) (*dbmodels.Wishlist, bool) {
+	userID, sessionID, ok := wishlistOwner(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wishlist ID"})
+		return nil, false
+	}
+
+	wishlist, err := globalStore.StStore.GetWishlist(uint(id), userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist not found"})
+		return nil, false
+	}
+	return wishlist, true
+}
+
+// GetWishlists lists the shopper's wishlists
+// @Summary List wishlists
+// @Description Lists all wishlists of the authenticated user or guest session, with their items
+// @Tags Wishlists
+// @Produce json
+// @Param Authorization header string false "Bearer token (optional for guests)"
+// @Param X-Session-ID header string false "Session ID for guest users" example("guest-session-abc123")
+// @Success 200 {object} map[string]interface{} "Wishlists"
+// @Failure 400 {object} map[string]string "Session ID required for guests"
+// @Router /api/customer-website/wishlists [get]
+func GetWishlists(c *gin.Context) {
+	userID, sessionID, ok := wishlistOwner(c)
+	if !ok {
+		return
+	}
+
+	wishlists, err := globalStore.StStore.GetWishlists(userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wishlists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"wishlists": wishlists,
+		"count":     len(wishlists),
+	})
+}
+
+// CreateWishlist creates a named wishlist
+// @Summary Create wishlist
+// @Description Creates a named wishlist. The first wishlist of a shopper becomes the default one.
+// @Tags Wishlists
+// @Accept json
+// @Produce json
+// @Param Authorization header string false "Bearer token (optional for guests)"
+// @Param X-Session-ID header string false "Session ID for guest users" example("guest-session-abc123")
+// @Param request body CreateWishlistRequest true "Wishlist details"
+// @Success 201 {object} map[string]interface{} "Wishlist created"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Router /api/customer-website/wishlists [post]
+func CreateWishlist(c *gin.Context) {
+	userID, sessionID, ok := wishlistOwner(c)
+	if !ok {
+		return
+	}
+
+	var req CreateWishlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := globalStore.StStore.GetDefaultWishlist(userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	wishlist := newWishlist(userID, sessionID, req.Name, existing == nil)
+	wishlist.IsPublic = req.IsPublic
+	if err := globalStore.StStore.CreateWishlist(wishlist); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Wishlist created successfully",
+		"wishlist": wishlist,
+	})
+}
+
+// GetWishlist returns one of the shopper's wishlists
+// @Summary Get wishlist
+// @Tags Wishlists
+// @Produce json
+// @Param id path int true "Wishlist ID"
+// @Param Authorization header string false "Bearer token (optional for guests)"
+// @Param X-Session-ID header string false "Session ID for guest users"
+// @Success 200 {object} map[string]interface{} "Wishlist"
+// @Failure 404 {object} map[string]string "Wishlist not found"
+// @Router /api/customer-website/wishlists/{id} [get]
+func GetWishlist(c *gin.Context) {
+	wishlist, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"wishlist": wishlist})
+}
+
+// UpdateWishlist renames a wishlist or toggles its public share link
+// @Summary Update wishlist
+// @Tags Wishlists
+// @Accept json
+// @Produce json
+// @Param id path int true "Wishlist ID"
+// @Param Authorization header string false "Bearer token (optional for guests)"
+// @Param X-Session-ID header string false "Session ID for guest users"
+// @Param request body UpdateWishlistRequest true "Fields to update"
+// @Success 200 {object} map[string]interface{} "Wishlist updated"
+// @Failure 404 {object} map[string]string "Wishlist not found"
+// @Router /api/customer-website/wishlists/{id} [put]
+func UpdateWishlist(c *gin.Context) {
+	wishlist, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateWishlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != "" {
+		wishlist.Name = req.Name
+	}
+	if req.IsPublic != nil {
+		wishlist.IsPublic = *req.IsPublic
+	}
+
+	if err := globalStore.StStore.UpdateWishlist(wishlist); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Wishlist updated successfully",
+		"wishlist": wishlist,
+	})
+}
+
+// DeleteWishlist removes a wishlist and its items
+// @Summary Delete wishlist
+// @Tags Wishlists
+// @Produce json
+// @Param id path int true "Wishlist ID"
+// @Param Authorization header string false "Bearer token (optional for guests)"
+// @Param X-Session-ID header string false "Session ID for guest users"
+// @Success 200 {object} map[string]string "Wishlist deleted"
+// @Failure 404 {object} map[string]string "Wishlist not found"
+// @Router /api/customer-website/wishlists/{id} [delete]
+func DeleteWishlist(c *gin.Context) {
+	wishlist, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+
+	if err := globalStore.StStore.DeleteWishlist(wishlist.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Wishlist deleted successfully"})
+}
+
+// AddToDefaultWishlist saves a product to the shopper's default wishlist, creating it if needed
+// @Summary Add product to default wishlist
+// @Description Replaces the old product favorite flag. Creates a "My Wishlist" list on first use.
+// @Tags Wishlists
+// @Accept json
+// @Produce json
+// @Param Authorization header string false "Bearer token (optional for guests)"
+// @Param X-Session-ID header string false "Session ID for guest users"
+// @Param request body AddWishlistItemRequest true "Product to save"
+// @Success 201 {object} map[string]interface{} "Item saved"
+// @Failure 404 {object} map[string]string "Product not found"
+// @Router /api/customer-website/wishlists/items [post]
+func AddToDefaultWishlist(c *gin.Context) {
+	userID, sessionID, ok := wishlistOwner(c)
+	if !ok {
+		return
+	}
+
+	var req AddWishlistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wishlist, err := globalStore.StStore.GetDefaultWishlist(userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if wishlist == nil {
+		wishlist = newWishlist(userID, sessionID, "My Wishlist", true)
+		if err := globalStore.StStore.CreateWishlist(wishlist); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	addWishlistItem(c, wishlist, &req)
+}
+
+// AddWishlistItem saves a product to a specific wishlist
+// @Summary Add product to wishlist
+// @Tags Wishlists
+// @Accept json
+// @Produce json
+// @Param id path int true "Wishlist ID"
+// @Param Authorization header string false "Bearer token (optional for guests)"
+// @Param X-Session-ID header string false "Session ID for guest users"
+// @Param request body AddWishlistItemRequest true "Product to save"
+// @Success 201 {object} map[string]interface{} "Item saved"
+// @Failure 404 {object} map[string]string "Wishlist or product not found"
+// @Router /api/customer-website/wishlists/{id}/items [post]
+func AddWishlistItem(c *gin.Context) {
+	wishlist, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+
+	var req AddWishlistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	addWishlistItem(c, wishlist, &req)
+}
+
+func addWishlistItem(c *gin.Context, wishlist *dbmodels.Wishlist, req *AddWishlistItemRequest) {
+	product, err := globalStore.StStore.GetProduct(req.ProductID)
+	if err != nil || !product.IsActive {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	item := &dbmodels.WishlistItem{
+		WishlistID:        wishlist.ID,
+		ProductID:         product.ID,
+		Note:              req.Note,
+		PriceWhenAdded:    product.EffectivePrice(),
+		LastNotifiedPrice: product.EffectivePrice(),
+		NotifyBackInStock: req.NotifyBackInStock == nil || *req.NotifyBackInStock,
+		NotifyPriceDrop:   req.NotifyPriceDrop == nil || *req.NotifyPriceDrop,
+	}
+	if err := globalStore.StStore.AddWishlistItem(item); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	item.Product = product
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Item added to wishlist",
+		"wishlist_id": wishlist.ID,
+		"item":        item,
+	})
+}
+
+// RemoveWishlistItem removes a product from a wishlist
+// @Summary Remove wishlist item
+// @Tags Wishlists
+// @Produce json
+// @Param id path int true "Wishlist ID"
+// @Param item_id path int true "Wishlist item ID"
+// @Param Authorization header string false "Bearer token (optional for guests)"
+// @Param X-Session-ID header string false "Session ID for guest users"
+// @Success 200 {object} map[string]string "Item removed"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /api/customer-website/wishlists/{id}/items/{item_id} [delete]
+func RemoveWishlistItem(c *gin.Context) {
+	wishlist, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+
+	itemID, err := strconv.ParseUint(c.Param("item_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	item, err := globalStore.StStore.GetWishlistItem(uint(itemID), wishlist.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := globalStore.StStore.DeleteWishlistItem(item.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item removed from wishlist"})
+}
+
+// MoveWishlistItemToCart adds a wishlist item to the cart and removes it from the wishlist
+// @Summary Move wishlist item to cart
+// @Tags Wishlists
+// @Accept json
+// @Produce json
+// @Param id path int true "Wishlist ID"
+// @Param item_id path int true "Wishlist item ID"
+// @Param Authorization header string false "Bearer token (optional for guests)"
+// @Param X-Session-ID header string false "Session ID for guest users"
+// @Param request body MoveToCartRequest false "Quantity (default 1) and whether to keep the wishlist item"
+// @Success 200 {object} map[string]interface{} "Item moved to cart"
+// @Failure 400 {object} map[string]interface{} "Insufficient stock"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /api/customer-website/wishlists/{id}/items/{item_id}/move-to-cart [post]
+func MoveWishlistItemToCart(c *gin.Context) {
+	wishlist, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+
+	itemID, err := strconv.ParseUint(c.Param("item_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	var req MoveToCartRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Quantity < 1 {
+		req.Quantity = 1
+	}
+
+	item, err := globalStore.StStore.GetWishlistItem(uint(itemID), wishlist.ID)
+	if err != nil || item.Product == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist item not found"})
+		return
+	}
+
+	product := item.Product
+	if !product.IsActive || product.Quantity < req.Quantity {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Insufficient stock",
+			"available": product.Quantity,
+		})
+		return
+	}
+
+	cartItem, _, err := addProductToCart(wishlist.UserID, wishlist.SessionID, product, req.Quantity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.Keep {
+		if err := globalStore.StStore.DeleteWishlistItem(item.ID); err != nil {
+			log.Printf("Failed to remove wishlist item %d after moving to cart: %v", item.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Item moved to cart",
+		"cart_item": cartItem,
+	})
+}
+
+// GetSharedWishlist shows a public wishlist through its share link
+// @Summary View shared wishlist
+// @Description Public, read-only view of a wishlist that its owner marked as public
+// @Tags Wishlists
+// @Produce json
+// @Param token path string true "Share token"
+// @Success 200 {object} map[string]interface{} "Wishlist"
+// @Failure 404 {object} map[string]string "Wishlist not found"
+// @Router /api/customer-website/wishlists/shared/{token} [get]
+func GetSharedWishlist(c *gin.Context) {
+	wishlist, err := globalStore.StStore.GetPublicWishlist(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist not found"})
+		return
+	}
+
+	// Hide the owner's identity from visitors
+	wishlist.UserID = nil
+	wishlist.SessionID = ""
+
+	c.JSON(http.StatusOK, gin.H{"wishlist": wishlist})
+}
+
+func newWishlist(userID *uint, sessionID, name string, isDefault bool) *dbmodels.Wishlist {
+	wishlist := &dbmodels.Wishlist{
+		UserID:     userID,
+		Name:       name,
+		IsDefault:  isDefault,
+		ShareToken: utils.GenerateToken(16),
+	}
+	// Lists of signed-in users are not tied to the browser session
+	if userID == nil {
+		wishlist.SessionID = sessionID
+	}
+	return wishlist
+}
+
+// notifyWishlistWatchers sends back-in-stock and price-drop alerts after a product changed
+func notifyWishlistWatchers(before, after *dbmodels.Product) {
+	backInStock := before.Quantity <= 0 && after.Quantity > 0
+	newPrice := after.EffectivePrice()
+	if !backInStock && newPrice.GreaterThanOrEqual(before.EffectivePrice()) {
+		return
+	}
+
+	items, err := globalStore.StStore.GetWishlistItemsForProduct(after.ID)
+	if err != nil {
+		log.Printf("Wishlist alerts for product %d: %v", after.ID, err)
+		return
+	}
+	currency := globalStore.StStore.GetStoreCurrency(after.UserID, globalStore.Config.GetBaseCurrency())
+
+	for _, item := range items {
+		if item.Wishlist == nil || item.Wishlist.UserID == nil {
+			continue
+		}
+		userID := *item.Wishlist.UserID
+
+		if backInStock && item.NotifyBackInStock {
+			sendWishlistAlert(userID, fmt.Sprintf("%s is back in stock", after.Name),
+				fmt.Sprintf("<p>Good news! <strong>%s</strong> from your wishlist \"%s\" is available again.</p>", html.EscapeString(after.Name), html.EscapeString(item.Wishlist.Name)))
+			if globalStore.NotifService != nil {
+				globalStore.NotifService.NotifyBackInStock(userID, after.ID, after.Name)
+			}
+		}
+
+		// Only alert once per lower price
+		lastPrice := item.LastNotifiedPrice
+		if !lastPrice.IsPositive() {
+			lastPrice = item.PriceWhenAdded
+		}
+		if item.NotifyPriceDrop && newPrice.IsPositive() && newPrice.LessThan(lastPrice) {
+			sendWishlistAlert(userID, fmt.Sprintf("Price drop on %s", after.Name),
+				fmt.Sprintf("<p><strong>%s</strong> from your wishlist \"%s\" dropped from %s to %s %s.</p>", html.EscapeString(after.Name), html.EscapeString(item.Wishlist.Name), money.Format(lastPrice), money.Format(newPrice), currency))
+			if globalStore.NotifService != nil {
+				globalStore.NotifService.NotifyPriceDrop(userID, after.ID, after.Name, lastPrice, newPrice, currency)
+			}
+			item.LastNotifiedPrice = newPrice
+			item.Wishlist = nil
+			if err := globalStore.StStore.UpdateWishlistItem(&item); err != nil {
+				log.Printf("Failed to update wishlist item %d: %v", item.ID, err)
+			}
+		}
+	}
+}
+
+func sendWishlistAlert(userID uint, subject, body string) {
+	if globalStore.EmailService == nil || !globalStore.EmailService.IsConfigured() {
+		return
+	}
+	user, err := globalStore.StStore.GetUser(userID)
+	if err != nil || user.Email == "" {
+		return
+	}
+	if err := globalStore.EmailService.Send(user.Email, subject, body); err != nil {
+		log.Printf("Wishlist alert email to %s failed: %v", user.Email, err)
+	}
+}
@@ -0,0 +1,310 @@
+package einvoice
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/shopspring/decimal"
+)
+
+// ========== DOCUMENT BUILDER ==========
+
+var (
+	one     = decimal.NewFromInt(1)
+	hundred = decimal.NewFromInt(100)
+)
+
+// Issuer is who issues a document, and how its lines are coded and taxed
+type Issuer struct {
+	Party            Party
+	ActivityCode     string
+	ItemCodeType     string // EGS or GS1
+	TaxRate          decimal.Decimal
+	PricesIncludeTax bool
+}
+
+// IssuerFromProfile makes a store the issuer of its documents
+func IssuerFromProfile(profile *dbmodels.EInvoiceProfile) Issuer {
+	return Issuer{
+		Party: Party{
+			Type: profile.IssuerType,
+			ID:   profile.TaxRegistrationNumber,
+			Name: profile.Name,
+			Address: Address{
+				BranchID:       profile.BranchID,
+				Country:        "EG",
+				Governate:      profile.Governate,
+				RegionCity:     profile.RegionCity,
+				Street:         profile.Street,
+				BuildingNumber: profile.BuildingNumber,
+				PostalCode:     profile.PostalCode,
+			},
+		},
+		ActivityCode:     profile.ActivityCode,
+		ItemCodeType:     profile.ItemCodeType,
+		TaxRate:          profile.TaxRate,
+		PricesIncludeTax: profile.PricesIncludeTax,
+	}
+}
+
+// IssuerFromConfig makes the platform the issuer, for package payments
+func IssuerFromConfig(cfg config.EInvoiceIssuerConfig) Issuer {
+	return Issuer{
+		Party: Party{
+			Type: PartyBusiness,
+			ID:   cfg.TaxRegistrationNumber,
+			Name: cfg.Name,
+			Address: Address{
+				BranchID:       cfg.BranchID,
+				Country:        "EG",
+				Governate:      cfg.Governate,
+				RegionCity:     cfg.RegionCity,
+				Street:         cfg.Street,
+				BuildingNumber: cfg.BuildingNumber,
+			},
+		},
+		ActivityCode:     cfg.ActivityCode,
+		ItemCodeType:     ItemTypeEGS,
+		TaxRate:          decimal.NewFromFloat(cfg.TaxRate),
+		PricesIncludeTax: cfg.PricesIncludeTax,
+	}
+}
+
+// ReceiverFromProfile makes a registered store the receiver, e.g. of the platform's
+// invoice for its package
+func ReceiverFromProfile(profile *dbmodels.EInvoiceProfile) Party {
+	party := IssuerFromProfile(profile).Party
+	party.Address.BranchID = ""
+	return party
+}
+
+// Line is one item sold, priced in the sale currency
+type Line struct {
+	Description string
+	Code        string // Internal code, e.g. the product SKU
+	Quantity    int
+	UnitPrice   decimal.Decimal // As charged; includes VAT when the issuer's prices do
+}
+
+// Sale is what a document is built from
+type Sale struct {
+	DocumentType string // I or C
+	InternalID   string
+	IssuedAt     time.Time
+	Receiver     Party
+	Lines        []Line
+	Discount     decimal.Decimal // Order-level discount in the sale currency
+	Currency     string
+	RateToEGP    decimal.Decimal // EGP per unit of Currency; ignored for EGP
+	References   []string        // Invoice UUIDs a credit note corrects
+	OrderRef     string          // Purchase order reference, e.g. the order number
+}
+
+// Build maps a sale to an ETA document. Amounts are converted to EGP and VAT is
+// taken out of, or added to, the prices as the issuer's settings say.
+func Build(issuer Issuer, sale Sale, version string) (*Document, error) {
+	currency := money.NormalizeCurrency(sale.Currency)
+	if currency == "" {
+		currency = "EGP"
+	}
+	foreign := currency != "EGP"
+	if foreign && !sale.RateToEGP.IsPositive() {
+		return nil, fmt.Errorf("no EGP exchange rate for %s", currency)
+	}
+	toEGP := func(amount decimal.Decimal) decimal.Decimal {
+		if !foreign {
+			return amount
+		}
+		return amount.Mul(sale.RateToEGP)
+	}
+
+	rate := issuer.TaxRate
+	taxFactor := one.Add(rate.Div(hundred))
+
+	doc := &Document{
+		Issuer:                 issuer.Party,
+		Receiver:               sale.Receiver,
+		DocumentType:           sale.DocumentType,
+		DocumentTypeVersion:    version,
+		DateTimeIssued:         sale.IssuedAt.UTC().Format("2006-01-02T15:04:05Z"),
+		TaxpayerActivityCode:   issuer.ActivityCode,
+		InternalID:             sale.InternalID,
+		PurchaseOrderReference: sale.OrderRef,
+		References:             sale.References,
+	}
+	if doc.Receiver.Address.Country == "" {
+		doc.Receiver.Address.Country = "EG"
+	}
+
+	taxTotal := decimal.Zero
+	for _, item := range sale.Lines {
+		quantity := decimal.NewFromInt(int64(item.Quantity))
+
+		unitSold := item.UnitPrice
+		if issuer.PricesIncludeTax {
+			unitSold = unitSold.Div(taxFactor)
+		}
+		unitEGP := toEGP(unitSold).Round(Scale)
+		salesTotal := unitEGP.Mul(quantity).Round(Scale)
+
+		// With VAT-inclusive prices the tax is what is left of the gross amount, so
+		// line totals add up to what the customer paid
+		tax := salesTotal.Mul(rate).Div(hundred).Round(Scale)
+		if issuer.PricesIncludeTax {
+			tax = toEGP(item.UnitPrice).Mul(quantity).Round(Scale).Sub(salesTotal)
+		}
+
+		line := InvoiceLine{
+			Description:  item.Description,
+			ItemType:     issuer.ItemCodeType,
+			ItemCode:     itemCode(issuer, item.Code),
+			UnitType:     UnitEach,
+			Quantity:     quantity,
+			InternalCode: item.Code,
+			SalesTotal:   salesTotal,
+			NetTotal:     salesTotal,
+			Total:        salesTotal.Add(tax),
+			UnitValue:    UnitValue{CurrencySold: currency, AmountEGP: unitEGP},
+			TaxableItems: []TaxableItem{{
+				TaxType: TaxTypeVAT,
+				Amount:  tax,
+				SubType: TaxSubtypeVATStd,
+				Rate:    rate,
+			}},
+		}
+		if foreign {
+			amountSold := unitSold.Round(Scale)
+			exchangeRate := sale.RateToEGP.Round(Scale)
+			line.UnitValue.AmountSold = &amountSold
+			line.UnitValue.CurrencyExchangeRate = &exchangeRate
+		}
+		doc.InvoiceLines = append(doc.InvoiceLines, line)
+
+		doc.TotalSalesAmount = doc.TotalSalesAmount.Add(line.SalesTotal)
+		doc.NetAmount = doc.NetAmount.Add(line.NetTotal)
+		taxTotal = taxTotal.Add(tax)
+	}
+
+	doc.TaxTotals = []TaxTotal{{TaxType: TaxTypeVAT, Amount: taxTotal}}
+	doc.ExtraDiscountAmount = toEGP(sale.Discount).Round(Scale)
+	doc.TotalAmount = doc.NetAmount.Add(taxTotal).Sub(doc.ExtraDiscountAmount)
+	return doc, nil
+}
+
+// itemCode is the code the ETA knows the item by
+func itemCode(issuer Issuer, code string) string {
+	if issuer.ItemCodeType == ItemTypeGS1 {
+		return code
+	}
+	return "EG-" + issuer.Party.ID + "-" + code
+}
+
+// ValidationError lists why a document would be rejected
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid e-invoice document: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the rules the ETA applies to document structure and totals
+func Validate(doc *Document) error {
+	var problems []string
+	require := func(value, field string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, field+" is required")
+		}
+	}
+
+	require(doc.Issuer.ID, "issuer.id")
+	require(doc.Issuer.Name, "issuer.name")
+	require(doc.Issuer.Address.BranchID, "issuer.address.branchID")
+	validateAddress(doc.Issuer.Address, "issuer", require)
+	require(doc.TaxpayerActivityCode, "taxpayerActivityCode")
+	require(doc.InternalID, "internalID")
+	require(doc.DateTimeIssued, "dateTimeIssued")
+
+	switch doc.Receiver.Type {
+	case PartyBusiness, PartyForeigner:
+		require(doc.Receiver.ID, "receiver.id")
+		require(doc.Receiver.Name, "receiver.name")
+		validateAddress(doc.Receiver.Address, "receiver", require)
+	case PartyPerson:
+		if doc.TotalAmount.GreaterThanOrEqual(ReceiverIDThreshold) {
+			require(doc.Receiver.ID, "receiver.id (national ID from 50,000 EGP)")
+		}
+	default:
+		problems = append(problems, "receiver.type must be B, P or F")
+	}
+
+	switch doc.DocumentType {
+	case dbmodels.EInvoiceTypeInvoice:
+	case dbmodels.EInvoiceTypeCreditNote:
+		if len(doc.References) == 0 {
+			problems = append(problems, "credit notes must reference the invoice they correct")
+		}
+	default:
+		problems = append(problems, "documentType must be I or C")
+	}
+
+	if len(doc.InvoiceLines) == 0 {
+		problems = append(problems, "invoiceLines must not be empty")
+	}
+	sales, net, tax := decimal.Zero, decimal.Zero, decimal.Zero
+	for i, line := range doc.InvoiceLines {
+		field := fmt.Sprintf("invoiceLines[%d]", i)
+		require(line.ItemCode, field+".itemCode")
+		require(line.Description, field+".description")
+		if !line.Quantity.IsPositive() {
+			problems = append(problems, field+".quantity must be positive")
+		}
+		lineTax := decimal.Zero
+		for _, item := range line.TaxableItems {
+			lineTax = lineTax.Add(item.Amount)
+		}
+		if !line.NetTotal.Add(lineTax).Equal(line.Total) {
+			problems = append(problems, field+".total must equal netTotal plus taxes")
+		}
+		sales = sales.Add(line.SalesTotal)
+		net = net.Add(line.NetTotal)
+		tax = tax.Add(lineTax)
+	}
+
+	if !sales.Equal(doc.TotalSalesAmount) {
+		problems = append(problems, "totalSalesAmount must equal the sum of line sales totals")
+	}
+	if !net.Equal(doc.NetAmount) {
+		problems = append(problems, "netAmount must equal the sum of line net totals")
+	}
+	taxTotals := decimal.Zero
+	for _, total := range doc.TaxTotals {
+		taxTotals = taxTotals.Add(total.Amount)
+	}
+	if !tax.Equal(taxTotals) {
+		problems = append(problems, "taxTotals must equal the sum of line taxes")
+	}
+	if !net.Add(tax).Sub(doc.ExtraDiscountAmount).Sub(doc.TotalItemsDiscountAmount).Equal(doc.TotalAmount) {
+		problems = append(problems, "totalAmount must equal netAmount plus taxes less discounts")
+	}
+	if doc.TotalAmount.IsNegative() {
+		problems = append(problems, "totalAmount must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validateAddress(address Address, party string, require func(value, field string)) {
+	require(address.Country, party+".address.country")
+	require(address.Governate, party+".address.governate")
+	require(address.RegionCity, party+".address.regionCity")
+	require(address.Street, party+".address.street")
+	require(address.BuildingNumber, party+".address.buildingNumber")
+}
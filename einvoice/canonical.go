@@ -0,0 +1,113 @@
+package einvoice
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ========== CANONICAL SERIALIZATION ==========
+
+// Canonicalize serializes a JSON document the way the ETA hashes and signs it:
+// without braces or brackets, each property name upper-cased and quoted followed by
+// its value, each array item preceded by the array's name, and every scalar quoted
+// as written. The result depends on property order, so it must be computed from the
+// JSON that is submitted.
+func Canonicalize(data []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+	if err != nil {
+		return "", err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return "", fmt.Errorf("einvoice: document must be a JSON object")
+	}
+
+	var out strings.Builder
+	if err := canonicalObject(decoder, &out); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Hash is the hex SHA-256 of a document's canonical serialization
+func Hash(data []byte) (string, error) {
+	canonical, err := Canonicalize(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalObject writes the members of an object whose opening brace was read
+func canonicalObject(decoder *json.Decoder, out *strings.Builder) error {
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		name := `"` + strings.ToUpper(token.(string)) + `"`
+
+		value, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		out.WriteString(name)
+		if delim, ok := value.(json.Delim); ok && delim == '[' {
+			if err := canonicalArray(decoder, name, out); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := canonicalValue(decoder, value, out); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token() // closing brace
+	return err
+}
+
+// canonicalArray writes the items of an array whose opening bracket was read, each
+// preceded by the array's name
+func canonicalArray(decoder *json.Decoder, name string, out *strings.Builder) error {
+	for decoder.More() {
+		value, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		out.WriteString(name)
+		if err := canonicalValue(decoder, value, out); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token() // closing bracket
+	return err
+}
+
+func canonicalValue(decoder *json.Decoder, token json.Token, out *strings.Builder) error {
+	switch value := token.(type) {
+	case json.Delim:
+		switch value {
+		case '{':
+			return canonicalObject(decoder, out)
+		case '[':
+			return canonicalArray(decoder, "", out)
+		}
+		return fmt.Errorf("einvoice: unexpected %v", value)
+	case string:
+		out.WriteString(`"` + value + `"`)
+	case json.Number:
+		out.WriteString(`"` + value.String() + `"`)
+	case bool:
+		fmt.Fprintf(out, `"%t"`, value)
+	case nil:
+		out.WriteString(`""`)
+	}
+	return nil
+}
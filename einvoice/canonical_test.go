@@ -0,0 +1,80 @@
+package einvoice
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		document  string
+		canonical string
+		hash      string
+	}{
+		{
+			name: "nested objects, arrays and numbers as written",
+			document: `{
+				"issuer": {
+					"address": {"branchID": "0", "country": "EG", "governate": "Cairo", "regionCity": "Nasr City", "street": "580 Clementina Key", "buildingNumber": "Bldg. 0"},
+					"type": "B", "id": "113317713", "name": "Issuer Company"
+				},
+				"documentType": "I",
+				"documentTypeVersion": "0.9",
+				"dateTimeIssued": "2025-10-12T09:30:00Z",
+				"internalID": "INV-ORD-42",
+				"invoiceLines": [
+					{
+						"description": "Computer1", "itemType": "EGS", "itemCode": "EG-113317713-1", "quantity": 1.50,
+						"unitValue": {"currencySold": "EGP", "amountEGP": 100.00},
+						"taxableItems": [{"taxType": "T1", "amount": 21.00, "rate": 14}]
+					},
+					{
+						"description": "Computer2", "itemType": "EGS", "itemCode": "EG-113317713-2", "quantity": 2,
+						"unitValue": {"currencySold": "EGP", "amountEGP": 50},
+						"taxableItems": []
+					}
+				],
+				"totalAmount": 271.00
+			}`,
+			canonical: `"ISSUER""ADDRESS""BRANCHID""0""COUNTRY""EG""GOVERNATE""Cairo""REGIONCITY""Nasr City""STREET""580 Clementina Key""BUILDINGNUMBER""Bldg. 0""TYPE""B""ID""113317713""NAME""Issuer Company"` +
+				`"DOCUMENTTYPE""I""DOCUMENTTYPEVERSION""0.9""DATETIMEISSUED""2025-10-12T09:30:00Z""INTERNALID""INV-ORD-42"` +
+				`"INVOICELINES"` +
+				`"INVOICELINES""DESCRIPTION""Computer1""ITEMTYPE""EGS""ITEMCODE""EG-113317713-1""QUANTITY""1.50""UNITVALUE""CURRENCYSOLD""EGP""AMOUNTEGP""100.00""TAXABLEITEMS""TAXABLEITEMS""TAXTYPE""T1""AMOUNT""21.00""RATE""14"` +
+				`"INVOICELINES""DESCRIPTION""Computer2""ITEMTYPE""EGS""ITEMCODE""EG-113317713-2""QUANTITY""2""UNITVALUE""CURRENCYSOLD""EGP""AMOUNTEGP""50""TAXABLEITEMS"` +
+				`"TOTALAMOUNT""271.00"`,
+			hash: "3b21ee7d727b3ea50d98cca522a7ad98692773ff8c3d12c70f71232efaf37da5",
+		},
+		{
+			name:      "arabic text, null, booleans and string arrays",
+			document:  `{"receiver": {"type": "P", "name": "منى عادل", "id": null}, "references": ["8d2ba80c1f"], "signed": false}`,
+			canonical: `"RECEIVER""TYPE""P""NAME""منى عادل""ID""""REFERENCES""REFERENCES""8d2ba80c1f""SIGNED""false"`,
+			hash:      "57da0a3544c73e2bf524ed4d2b7e271805000f0f01de3fb0e8ac31c71af12b40",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			canonical, err := Canonicalize([]byte(test.document))
+			if err != nil {
+				t.Fatalf("Canonicalize: %v", err)
+			}
+			if canonical != test.canonical {
+				t.Errorf("canonical form\n got: %s\nwant: %s", canonical, test.canonical)
+			}
+
+			hash, err := Hash([]byte(test.document))
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if hash != test.hash {
+				t.Errorf("hash = %s, want %s", hash, test.hash)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeRejectsNonObjects(t *testing.T) {
+	for _, document := range []string{`["I"]`, `"I"`, ``} {
+		if _, err := Canonicalize([]byte(document)); err == nil {
+			t.Errorf("Canonicalize(%q) succeeded, want an error", document)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package einvoice maps orders and payments to Egyptian Tax Authority (ETA)
+// e-invoice documents, computes their canonical hash and submits them.
+package einvoice
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// ========== ETA DOCUMENT ==========
+
+// Scale is the number of decimal places the ETA accepts for amounts
+const Scale = 5
+
+// Party types
+const (
+	PartyBusiness  = "B" // Egyptian company; ID is the tax registration number
+	PartyPerson    = "P" // Egyptian natural person; ID is the national ID
+	PartyForeigner = "F"
+)
+
+// Item code types
+const (
+	ItemTypeEGS = "EGS" // Code registered with the ETA, EG-<issuer RIN>-<internal code>
+	ItemTypeGS1 = "GS1" // GTIN barcode
+)
+
+// Tax types applied to every line: value added tax at the general rate
+const (
+	TaxTypeVAT       = "T1"
+	TaxSubtypeVATStd = "V009"
+)
+
+// UnitEach is the ETA unit type for pieces
+const UnitEach = "EA"
+
+// ReceiverIDThreshold is the document total in EGP from which a person receiver
+// must be identified by national ID
+var ReceiverIDThreshold = decimal.NewFromInt(50000)
+
+// Document is an ETA invoice or credit note. Field order follows the ETA schema,
+// which also fixes the order of the canonical serialization.
+type Document struct {
+	Issuer                   Party           `json:"issuer"`
+	Receiver                 Party           `json:"receiver"`
+	DocumentType             string          `json:"documentType"` // I invoice, C credit note
+	DocumentTypeVersion      string          `json:"documentTypeVersion"`
+	DateTimeIssued           string          `json:"dateTimeIssued"` // UTC, 2006-01-02T15:04:05Z
+	TaxpayerActivityCode     string          `json:"taxpayerActivityCode"`
+	InternalID               string          `json:"internalID"`
+	PurchaseOrderReference   string          `json:"purchaseOrderReference,omitempty"`
+	References               []string        `json:"references,omitempty"` // UUIDs of the invoices a credit note corrects
+	InvoiceLines             []InvoiceLine   `json:"invoiceLines"`
+	TotalDiscountAmount      decimal.Decimal `json:"totalDiscountAmount"`
+	TotalSalesAmount         decimal.Decimal `json:"totalSalesAmount"`
+	NetAmount                decimal.Decimal `json:"netAmount"`
+	TaxTotals                []TaxTotal      `json:"taxTotals"`
+	TotalAmount              decimal.Decimal `json:"totalAmount"`
+	ExtraDiscountAmount      decimal.Decimal `json:"extraDiscountAmount"` // Order-level discount, e.g. a coupon
+	TotalItemsDiscountAmount decimal.Decimal `json:"totalItemsDiscountAmount"`
+	Signatures               []Signature     `json:"signatures,omitempty"`
+}
+
+type Party struct {
+	Address Address `json:"address"`
+	Type    string  `json:"type"` // B, P or F
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+}
+
+type Address struct {
+	BranchID       string `json:"branchID,omitempty"` // Issuer only
+	Country        string `json:"country"`
+	Governate      string `json:"governate"`
+	RegionCity     string `json:"regionCity"`
+	Street         string `json:"street"`
+	BuildingNumber string `json:"buildingNumber"`
+	PostalCode     string `json:"postalCode,omitempty"`
+}
+
+type InvoiceLine struct {
+	Description      string          `json:"description"`
+	ItemType         string          `json:"itemType"`
+	ItemCode         string          `json:"itemCode"`
+	UnitType         string          `json:"unitType"`
+	Quantity         decimal.Decimal `json:"quantity"`
+	InternalCode     string          `json:"internalCode"`
+	SalesTotal       decimal.Decimal `json:"salesTotal"` // Quantity × unit value
+	Total            decimal.Decimal `json:"total"`      // Net total plus taxes
+	ValueDifference  decimal.Decimal `json:"valueDifference"`
+	TotalTaxableFees decimal.Decimal `json:"totalTaxableFees"`
+	NetTotal         decimal.Decimal `json:"netTotal"` // Sales total less the discount
+	ItemsDiscount    decimal.Decimal `json:"itemsDiscount"`
+	UnitValue        UnitValue       `json:"unitValue"`
+	Discount         Discount        `json:"discount"`
+	TaxableItems     []TaxableItem   `json:"taxableItems"`
+}
+
+// UnitValue is the price of one unit before tax. Foreign currency sales also carry
+// the amount sold and the rate to EGP.
+type UnitValue struct {
+	CurrencySold         string           `json:"currencySold"`
+	AmountSold           *decimal.Decimal `json:"amountSold,omitempty"`
+	AmountEGP            decimal.Decimal  `json:"amountEGP"`
+	CurrencyExchangeRate *decimal.Decimal `json:"currencyExchangeRate,omitempty"`
+}
+
+type Discount struct {
+	Rate   decimal.Decimal `json:"rate"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+type TaxableItem struct {
+	TaxType string          `json:"taxType"`
+	Amount  decimal.Decimal `json:"amount"`
+	SubType string          `json:"subType"`
+	Rate    decimal.Decimal `json:"rate"`
+}
+
+type TaxTotal struct {
+	TaxType string          `json:"taxType"`
+	Amount  decimal.Decimal `json:"amount"`
+}
+
+// Signature is added by the taxpayer's signing token for document version 1.0
+type Signature struct {
+	SignatureType string `json:"signatureType"` // I issuer, S service provider
+	Value         string `json:"value"`
+}
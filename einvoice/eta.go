@@ -0,0 +1,243 @@
+package einvoice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+)
+
+// ========== ETA SUBMITTER ==========
+
+// ETASubmitter talks to the Egyptian Tax Authority's invoicing API. It signs in
+// with the ERP system's client credentials and reuses the token until it expires.
+//
+//	POST {identity}/connect/token               client credentials token
+//	POST {api}/api/v1/documentsubmissions       submit documents
+//	GET  {api}/api/v1/documents/{uuid}/details  validation status
+type ETASubmitter struct {
+	config config.EInvoiceConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func NewETASubmitter(cfg config.EInvoiceConfig) *ETASubmitter {
+	timeout := 30 * time.Second
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	return &ETASubmitter{
+		config: cfg,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+type etaError struct {
+	Message string     `json:"message"`
+	Target  string     `json:"target"`
+	Details []etaError `json:"details"`
+}
+
+func (e etaError) String() string {
+	messages := []string{}
+	if e.Message != "" {
+		messages = append(messages, strings.TrimSpace(e.Target+" "+e.Message))
+	}
+	for _, detail := range e.Details {
+		messages = append(messages, detail.String())
+	}
+	return strings.Join(messages, "; ")
+}
+
+type etaSubmissionResponse struct {
+	SubmissionID      string `json:"submissionId"`
+	AcceptedDocuments []struct {
+		UUID       string `json:"uuid"`
+		LongID     string `json:"longId"`
+		InternalID string `json:"internalId"`
+	} `json:"acceptedDocuments"`
+	RejectedDocuments []struct {
+		InternalID string   `json:"internalId"`
+		Error      etaError `json:"error"`
+	} `json:"rejectedDocuments"`
+}
+
+type etaDocumentDetails struct {
+	UUID              string `json:"uuid"`
+	Status            string `json:"status"`
+	ValidationResults struct {
+		ValidationSteps []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+			Error  *struct {
+				Error      string `json:"error"`
+				InnerError []struct {
+					Error string `json:"error"`
+				} `json:"innerError"`
+			} `json:"error"`
+		} `json:"validationSteps"`
+	} `json:"validationResults"`
+}
+
+func (e *ETASubmitter) Name() string {
+	return "eta"
+}
+
+func (e *ETASubmitter) Submit(ctx context.Context, documents [][]byte) (*SubmissionResult, error) {
+	// Documents are embedded as they are, so the hash the ETA computes matches ours
+	raw := make([]json.RawMessage, len(documents))
+	for i, data := range documents {
+		raw[i] = data
+	}
+
+	var resp etaSubmissionResponse
+	if err := e.do(ctx, http.MethodPost, "/api/v1/documentsubmissions", map[string]interface{}{"documents": raw}, &resp); err != nil {
+		return nil, err
+	}
+
+	result := &SubmissionResult{SubmissionID: resp.SubmissionID}
+	for _, doc := range resp.AcceptedDocuments {
+		result.Accepted = append(result.Accepted, AcceptedDocument{
+			InternalID: doc.InternalID,
+			UUID:       doc.UUID,
+			LongID:     doc.LongID,
+		})
+	}
+	for _, doc := range resp.RejectedDocuments {
+		result.Rejected = append(result.Rejected, RejectedDocument{
+			InternalID: doc.InternalID,
+			Error:      doc.Error.String(),
+		})
+	}
+	return result, nil
+}
+
+func (e *ETASubmitter) Status(ctx context.Context, uuid string) (*DocumentStatus, error) {
+	var resp etaDocumentDetails
+	if err := e.do(ctx, http.MethodGet, "/api/v1/documents/"+url.PathEscape(uuid)+"/details", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	status := &DocumentStatus{UUID: resp.UUID, Status: resp.Status}
+	for _, step := range resp.ValidationResults.ValidationSteps {
+		if step.Error == nil {
+			continue
+		}
+		status.Errors = append(status.Errors, step.Name+": "+step.Error.Error)
+		for _, inner := range step.Error.InnerError {
+			status.Errors = append(status.Errors, step.Name+": "+inner.Error)
+		}
+	}
+	return status, nil
+}
+
+// accessToken returns a cached token, signing in again shortly before it expires
+func (e *ETASubmitter) accessToken(ctx context.Context) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.token != "" && time.Now().Before(e.tokenExpiry) {
+		return e.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {e.config.ClientID},
+		"client_secret": {e.config.ClientSecret},
+		"scope":         {"InvoicingAPI"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.IdentityURL+"/connect/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ETA sign-in failed (%d): %s", resp.StatusCode, string(data))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", err
+	}
+	e.token = token.AccessToken
+	e.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return e.token, nil
+}
+
+func (e *ETASubmitter) do(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := e.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, e.config.APIURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrUnknownDocument
+	case resp.StatusCode == http.StatusUnauthorized:
+		e.mu.Lock()
+		e.token = ""
+		e.mu.Unlock()
+		return fmt.Errorf("ETA API rejected the access token")
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("ETA API error (%d): %s", resp.StatusCode, string(data))
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
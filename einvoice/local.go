@@ -0,0 +1,80 @@
+package einvoice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== LOCAL SUBMITTER ==========
+
+// LocalSubmitter stands in for the tax authority. It validates documents with the
+// same rules as Validate, keeps accepted ones in memory, and uses the document hash
+// as the UUID. Nothing leaves the server.
+type LocalSubmitter struct {
+	mu        sync.Mutex
+	documents map[string]*DocumentStatus
+}
+
+func NewLocalSubmitter() *LocalSubmitter {
+	return &LocalSubmitter{documents: map[string]*DocumentStatus{}}
+}
+
+func (l *LocalSubmitter) Name() string {
+	return "local"
+}
+
+func (l *LocalSubmitter) Submit(ctx context.Context, documents [][]byte) (*SubmissionResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := &SubmissionResult{SubmissionID: utils.GenerateToken(13)}
+	for _, data := range documents {
+		var doc Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			result.Rejected = append(result.Rejected, RejectedDocument{Error: err.Error()})
+			continue
+		}
+
+		hash, err := Hash(data)
+		if err != nil {
+			result.Rejected = append(result.Rejected, RejectedDocument{InternalID: doc.InternalID, Error: err.Error()})
+			continue
+		}
+		if _, exists := l.documents[hash]; exists {
+			result.Rejected = append(result.Rejected, RejectedDocument{InternalID: doc.InternalID, Error: "duplicate document"})
+			continue
+		}
+
+		status := &DocumentStatus{UUID: hash, Status: "Valid"}
+		var invalid *ValidationError
+		if err := Validate(&doc); errors.As(err, &invalid) {
+			status.Status = "Invalid"
+			status.Errors = invalid.Problems
+		}
+		l.documents[hash] = status
+
+		result.Accepted = append(result.Accepted, AcceptedDocument{
+			InternalID: doc.InternalID,
+			UUID:       hash,
+			LongID:     strings.ToUpper(utils.GenerateToken(20)),
+		})
+	}
+	return result, nil
+}
+
+func (l *LocalSubmitter) Status(ctx context.Context, uuid string) (*DocumentStatus, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status, ok := l.documents[uuid]
+	if !ok {
+		return nil, ErrUnknownDocument
+	}
+	copied := *status
+	return &copied, nil
+}
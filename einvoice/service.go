@@ -0,0 +1,402 @@
+package einvoice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/shopspring/decimal"
+)
+
+// ========== E-INVOICE SERVICE ==========
+
+// Service generates, stores and submits e-invoice documents. Orders are invoiced by
+// the store that sold them; package payments by the platform.
+type Service struct {
+	store     *stores.DbStore
+	submitter Submitter
+	config    config.EInvoiceConfig
+}
+
+func NewService(store *stores.DbStore, submitter Submitter, cfg config.EInvoiceConfig) *Service {
+	return &Service{store: store, submitter: submitter, config: cfg}
+}
+
+// SubmitterName is the submitter documents go to, e.g. local or eta
+func (s *Service) SubmitterName() string {
+	return s.submitter.Name()
+}
+
+// Internal IDs of the documents generated for each source
+func orderInvoiceID(orderID uint) string        { return fmt.Sprintf("INV-ORD-%d", orderID) }
+func orderCreditNoteID(orderID uint) string     { return fmt.Sprintf("CN-ORD-%d", orderID) }
+func paymentInvoiceID(paymentID uint) string    { return fmt.Sprintf("INV-PAY-%d", paymentID) }
+func paymentCreditNoteID(paymentID uint) string { return fmt.Sprintf("CN-PAY-%d", paymentID) }
+
+// IssueForOrder generates the store's invoice for an order. The customer is the
+// receiver; receiver overrides the customer's details, e.g. with a national ID.
+func (s *Service) IssueForOrder(orderID uint, receiver *Party) (*dbmodels.EInvoiceDocument, error) {
+	order, err := s.store.GetOrderWithItems(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status == dbmodels.OrderStatus_CANCELED {
+		return nil, &stores.CustomError{Message: "Canceled orders are not invoiced", Code: http.StatusConflict}
+	}
+
+	profile, err := s.profile(order.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	rateToEGP, err := orderRateToEGP(order)
+	if err != nil {
+		return nil, err
+	}
+
+	sale := Sale{
+		DocumentType: dbmodels.EInvoiceTypeInvoice,
+		InternalID:   orderInvoiceID(order.ID),
+		IssuedAt:     time.Now(),
+		Receiver:     orderReceiver(order, receiver),
+		Discount:     order.Discount,
+		Currency:     order.Currency,
+		RateToEGP:    rateToEGP,
+		OrderRef:     fmt.Sprintf("%d", order.ID),
+	}
+	for _, item := range order.Items {
+		code := item.Product.SKU
+		if code == "" {
+			code = fmt.Sprintf("P%d", item.ProductID)
+		}
+		sale.Lines = append(sale.Lines, Line{
+			Description: item.Product.Name,
+			Code:        code,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.Price,
+		})
+	}
+
+	doc, err := Build(IssuerFromProfile(profile), sale, s.config.DocumentVersion)
+	if err != nil {
+		return nil, &stores.CustomError{Message: err.Error(), Code: http.StatusUnprocessableEntity}
+	}
+	return s.save(&dbmodels.EInvoiceDocument{
+		UserID:  order.UserID,
+		Source:  dbmodels.EInvoiceSourceOrder,
+		OrderID: &order.ID,
+	}, doc)
+}
+
+// IssueOrderCreditNote reverses an order's invoice once the order was refunded or
+// canceled
+func (s *Service) IssueOrderCreditNote(orderID uint) (*dbmodels.EInvoiceDocument, error) {
+	order, err := s.store.GetOrderByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	refunded := strings.EqualFold(order.PaymentStatus, dbmodels.PaymentStatus_REFUNDED.String())
+	if !refunded && order.Status != dbmodels.OrderStatus_CANCELED {
+		return nil, &stores.CustomError{Message: "Only refunded or canceled orders get a credit note", Code: http.StatusConflict}
+	}
+
+	invoice, err := s.store.GetEInvoiceDocumentByInternalID(orderInvoiceID(order.ID))
+	if err != nil {
+		return nil, &stores.CustomError{Message: "The order has no e-invoice to credit", Code: http.StatusConflict}
+	}
+	return s.creditNote(invoice, orderCreditNoteID(order.ID))
+}
+
+// IssueForPayment generates the platform's invoice for a paid package. The store
+// is the receiver, as a business when its e-invoice profile is complete.
+func (s *Service) IssueForPayment(paymentID uint) (*dbmodels.EInvoiceDocument, error) {
+	payment, err := s.store.GetPayment(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.OrderID != nil {
+		return nil, &stores.CustomError{Message: "Order payments are invoiced with their order", Code: http.StatusConflict}
+	}
+	if payment.PackageID == nil || payment.Package == nil {
+		return nil, &stores.CustomError{Message: "Payment is not for a package", Code: http.StatusConflict}
+	}
+	if payment.PaymentStatus != dbmodels.PaymentStatus_PAID && payment.PaymentStatus != dbmodels.PaymentStatus_REFUNDED {
+		return nil, &stores.CustomError{Message: "Only paid payments are invoiced", Code: http.StatusConflict}
+	}
+
+	if currency := money.NormalizeCurrency(payment.Currency); currency != "" && currency != "EGP" {
+		return nil, &stores.CustomError{Message: "Package payments are invoiced in EGP only", Code: http.StatusUnprocessableEntity}
+	}
+
+	receiver := Party{Type: PartyPerson, Name: payment.User.Name}
+	if profile, err := s.store.GetEInvoiceProfile(payment.UserID); err == nil && profile.TaxRegistrationNumber != "" {
+		receiver = ReceiverFromProfile(profile)
+	}
+
+	sale := Sale{
+		DocumentType: dbmodels.EInvoiceTypeInvoice,
+		InternalID:   paymentInvoiceID(payment.ID),
+		IssuedAt:     time.Now(),
+		Receiver:     receiver,
+		Currency:     payment.Currency,
+		OrderRef:     payment.ReferenceNumber,
+		Lines: []Line{{
+			Description: payment.Package.Name,
+			Code:        fmt.Sprintf("PKG-%d", payment.Package.ID),
+			Quantity:    1,
+			UnitPrice:   payment.Amount,
+		}},
+	}
+
+	doc, err := Build(IssuerFromConfig(s.config.Platform), sale, s.config.DocumentVersion)
+	if err != nil {
+		return nil, &stores.CustomError{Message: err.Error(), Code: http.StatusUnprocessableEntity}
+	}
+	return s.save(&dbmodels.EInvoiceDocument{
+		UserID:    payment.UserID,
+		Source:    dbmodels.EInvoiceSourcePayment,
+		PaymentID: &payment.ID,
+	}, doc)
+}
+
+// IssuePaymentCreditNote reverses a refunded package payment's invoice
+func (s *Service) IssuePaymentCreditNote(paymentID uint) (*dbmodels.EInvoiceDocument, error) {
+	payment, err := s.store.GetPayment(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.PaymentStatus != dbmodels.PaymentStatus_REFUNDED {
+		return nil, &stores.CustomError{Message: "Only refunded payments get a credit note", Code: http.StatusConflict}
+	}
+
+	invoice, err := s.store.GetEInvoiceDocumentByInternalID(paymentInvoiceID(payment.ID))
+	if err != nil {
+		return nil, &stores.CustomError{Message: "The payment has no e-invoice to credit", Code: http.StatusConflict}
+	}
+	return s.creditNote(invoice, paymentCreditNoteID(payment.ID))
+}
+
+// creditNote copies an invoice's parties, lines and totals into a credit note that
+// references it. The invoice must have been accepted, as the reference is its UUID.
+func (s *Service) creditNote(invoice *dbmodels.EInvoiceDocument, internalID string) (*dbmodels.EInvoiceDocument, error) {
+	if invoice.UUID == "" || invoice.Status == dbmodels.EInvoiceStatusInvalid || invoice.Status == dbmodels.EInvoiceStatusRejected {
+		return nil, &stores.CustomError{Message: "Submit the invoice before issuing a credit note", Code: http.StatusConflict}
+	}
+
+	var doc Document
+	if err := json.Unmarshal([]byte(invoice.Document), &doc); err != nil {
+		return nil, &stores.CustomError{Message: "Stored invoice is unreadable", Code: http.StatusInternalServerError}
+	}
+	doc.DocumentType = dbmodels.EInvoiceTypeCreditNote
+	doc.DocumentTypeVersion = s.config.DocumentVersion
+	doc.DateTimeIssued = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	doc.InternalID = internalID
+	doc.References = []string{invoice.UUID}
+	doc.Signatures = nil
+
+	return s.save(&dbmodels.EInvoiceDocument{
+		UserID:      invoice.UserID,
+		Source:      invoice.Source,
+		OrderID:     invoice.OrderID,
+		PaymentID:   invoice.PaymentID,
+		ReferenceID: &invoice.ID,
+	}, &doc)
+}
+
+// save validates and stores a document under its internal ID. A document can be
+// regenerated until it has been accepted by the tax authority.
+func (s *Service) save(record *dbmodels.EInvoiceDocument, doc *Document) (*dbmodels.EInvoiceDocument, error) {
+	if existing, err := s.store.GetEInvoiceDocumentByInternalID(doc.InternalID); err == nil {
+		if !canSubmit(existing) {
+			return nil, &stores.CustomError{
+				Message: fmt.Sprintf("%s was already submitted", doc.InternalID),
+				Code:    http.StatusConflict,
+			}
+		}
+		record.ID = existing.ID
+		record.CreatedAt = existing.CreatedAt
+	}
+
+	if err := Validate(doc); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := Hash(data)
+	if err != nil {
+		return nil, err
+	}
+
+	record.DocumentType = doc.DocumentType
+	record.InternalID = doc.InternalID
+	record.Document = string(data)
+	record.Hash = hash
+	record.TotalAmount = doc.TotalAmount
+	record.Status = dbmodels.EInvoiceStatusDraft
+	if err := s.store.SaveEInvoiceDocument(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Submit sends a draft, or a document the tax authority turned down, for validation
+func (s *Service) Submit(ctx context.Context, record *dbmodels.EInvoiceDocument) (*dbmodels.EInvoiceDocument, error) {
+	if !canSubmit(record) {
+		return nil, &stores.CustomError{Message: "Document was already submitted", Code: http.StatusConflict}
+	}
+
+	result, err := s.submitter.Submit(ctx, [][]byte{[]byte(record.Document)})
+	if err != nil {
+		return nil, &stores.CustomError{Message: "Submission failed: " + err.Error(), Code: http.StatusBadGateway}
+	}
+
+	now := time.Now()
+	record.SubmissionID = result.SubmissionID
+	record.SubmittedAt = &now
+	record.Error = ""
+	for _, accepted := range result.Accepted {
+		if accepted.InternalID == record.InternalID {
+			record.Status = dbmodels.EInvoiceStatusSubmitted
+			record.UUID = accepted.UUID
+			record.LongID = accepted.LongID
+		}
+	}
+	for _, rejected := range result.Rejected {
+		if rejected.InternalID == record.InternalID || rejected.InternalID == "" {
+			record.Status = dbmodels.EInvoiceStatusRejected
+			record.Error = rejected.Error
+		}
+	}
+
+	if err := s.store.SaveEInvoiceDocument(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// RefreshStatus asks the tax authority whether a submitted document is valid
+func (s *Service) RefreshStatus(ctx context.Context, record *dbmodels.EInvoiceDocument) (*dbmodels.EInvoiceDocument, error) {
+	if record.UUID == "" {
+		return nil, &stores.CustomError{Message: "Document has not been submitted", Code: http.StatusConflict}
+	}
+
+	status, err := s.submitter.Status(ctx, record.UUID)
+	if errors.Is(err, ErrUnknownDocument) {
+		return nil, &stores.CustomError{Message: err.Error(), Code: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &stores.CustomError{Message: "Status check failed: " + err.Error(), Code: http.StatusBadGateway}
+	}
+
+	now := time.Now()
+	record.StatusCheckedAt = &now
+	switch strings.ToUpper(status.Status) {
+	case dbmodels.EInvoiceStatusValid, dbmodels.EInvoiceStatusInvalid, dbmodels.EInvoiceStatusRejected,
+		dbmodels.EInvoiceStatusCancelled, dbmodels.EInvoiceStatusSubmitted:
+		record.Status = strings.ToUpper(status.Status)
+	}
+	record.Error = strings.Join(status.Errors, "; ")
+
+	if err := s.store.SaveEInvoiceDocument(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Bundle wraps documents the way they are submitted, {"documents": [...]}, for
+// export to other ERP or signing tools
+func Bundle(records []dbmodels.EInvoiceDocument) ([]byte, error) {
+	documents := make([]json.RawMessage, 0, len(records))
+	for _, record := range records {
+		documents = append(documents, json.RawMessage(record.Document))
+	}
+	return json.MarshalIndent(map[string]interface{}{"documents": documents}, "", "  ")
+}
+
+// profile returns the store's e-invoice profile when e-invoicing is enabled
+func (s *Service) profile(userID uint) (*dbmodels.EInvoiceProfile, error) {
+	profile, err := s.store.GetEInvoiceProfile(userID)
+	if err != nil || !profile.Enabled {
+		return nil, &stores.CustomError{
+			Message: "E-invoicing is not set up for this store",
+			Code:    http.StatusConflict,
+		}
+	}
+	return profile, nil
+}
+
+// canSubmit reports whether a document has not been accepted by the tax authority
+func canSubmit(record *dbmodels.EInvoiceDocument) bool {
+	switch record.Status {
+	case dbmodels.EInvoiceStatusDraft, dbmodels.EInvoiceStatusRejected, dbmodels.EInvoiceStatusInvalid, "":
+		return true
+	}
+	return false
+}
+
+// orderRateToEGP is how many EGP one unit of the order currency was worth at checkout
+func orderRateToEGP(order *dbmodels.Order) (decimal.Decimal, error) {
+	currency := money.NormalizeCurrency(order.Currency)
+	if currency == "" || currency == "EGP" {
+		return decimal.NewFromInt(1), nil
+	}
+	if money.NormalizeCurrency(order.BaseCurrency) != "EGP" || !order.ExchangeRate.IsPositive() {
+		return decimal.Zero, &stores.CustomError{
+			Message: fmt.Sprintf("Order in %s has no EGP exchange rate", currency),
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+	// ExchangeRate is order currency units per EGP
+	return money.InverseRate(order.ExchangeRate), nil
+}
+
+// orderReceiver is the order's customer as a person receiver, with any details the
+// store supplied taking precedence
+func orderReceiver(order *dbmodels.Order, override *Party) Party {
+	address := order.Address
+	if address == "" {
+		address = order.Client.Address
+	}
+	receiver := Party{
+		Type:    PartyPerson,
+		Name:    order.Client.Name,
+		Address: Address{Country: "EG", Street: address},
+	}
+	if override == nil {
+		return receiver
+	}
+
+	if override.Type != "" {
+		receiver.Type = override.Type
+	}
+	if override.ID != "" {
+		receiver.ID = override.ID
+	}
+	if override.Name != "" {
+		receiver.Name = override.Name
+	}
+	fields := []struct{ value, target *string }{
+		{&override.Address.Governate, &receiver.Address.Governate},
+		{&override.Address.RegionCity, &receiver.Address.RegionCity},
+		{&override.Address.Street, &receiver.Address.Street},
+		{&override.Address.BuildingNumber, &receiver.Address.BuildingNumber},
+		{&override.Address.PostalCode, &receiver.Address.PostalCode},
+	}
+	for _, field := range fields {
+		if *field.value != "" {
+			*field.target = *field.value
+		}
+	}
+	return receiver
+}
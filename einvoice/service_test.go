@@ -0,0 +1,139 @@
+package einvoice
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestStore opens a migrated SQLite database for the test
+func newTestStore(t *testing.T) (*gorm.DB, *stores.DbStore) {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	store, err := stores.NewDbStore(db)
+	if err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+	return db, store
+}
+
+func TestServiceSubmitsToLocalSubmitter(t *testing.T) {
+	db, store := newTestStore(t)
+
+	pkg := dbmodels.Package{Name: "Professional", Price: decimal.RequireFromString("899.99"), Duration: 30, IsActive: true}
+	mustCreate(t, db, &pkg)
+	user := dbmodels.User{Name: "Mona", Email: "mona@example.com", Password: "x", Subdomain: "mona", RoleID: 1, PackageID: pkg.ID}
+	mustCreate(t, db, &user)
+	paid := dbmodels.Payment{
+		UserID:          user.ID,
+		Purpose:         dbmodels.PaymentPurpose_PACKAGE_CHANGE,
+		PackageID:       &pkg.ID,
+		Amount:          pkg.Price,
+		Currency:        "EGP",
+		PaymentMethod:   "sandbox",
+		PaymentStatus:   dbmodels.PaymentStatus_PAID,
+		ReferenceNumber: "PKG-1-1760000000-a1b2c3",
+	}
+	mustCreate(t, db, &paid)
+
+	service := NewService(store, NewLocalSubmitter(), config.EInvoiceConfig{
+		Submitter:       "local",
+		DocumentVersion: "0.9",
+		Platform: config.EInvoiceIssuerConfig{
+			TaxRegistrationNumber: "100200300",
+			Name:                  "Hamber Platform",
+			ActivityCode:          "6201",
+			BranchID:              "0",
+			Governate:             "Cairo",
+			RegionCity:            "Nasr City",
+			Street:                "Abbas El Akkad",
+			BuildingNumber:        "12",
+			TaxRate:               14,
+			PricesIncludeTax:      true,
+		},
+	})
+	ctx := context.Background()
+
+	invoice, err := service.IssueForPayment(paid.ID)
+	if err != nil {
+		t.Fatalf("IssueForPayment: %v", err)
+	}
+	if invoice.Status != dbmodels.EInvoiceStatusDraft || invoice.InternalID != paymentInvoiceID(paid.ID) {
+		t.Fatalf("issued %s %s, want a DRAFT %s", invoice.Status, invoice.InternalID, paymentInvoiceID(paid.ID))
+	}
+	if hash, err := Hash([]byte(invoice.Document)); err != nil || hash != invoice.Hash {
+		t.Fatalf("stored hash %s does not match the stored document (%s, %v)", invoice.Hash, hash, err)
+	}
+	if !invoice.TotalAmount.Equal(paid.Amount) {
+		t.Errorf("total = %s, want the VAT-inclusive price %s", invoice.TotalAmount, paid.Amount)
+	}
+
+	submitted, err := service.Submit(ctx, invoice)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if submitted.Status != dbmodels.EInvoiceStatusSubmitted || submitted.UUID != invoice.Hash || submitted.SubmissionID == "" {
+		t.Fatalf("submitted as %s with UUID %q, want SUBMITTED with the document hash", submitted.Status, submitted.UUID)
+	}
+	if _, err := service.Submit(ctx, submitted); !hasCode(err, http.StatusConflict) {
+		t.Errorf("second Submit: %v, want 409", err)
+	}
+	if _, err := service.IssueForPayment(paid.ID); !hasCode(err, http.StatusConflict) {
+		t.Errorf("reissuing a submitted invoice: %v, want 409", err)
+	}
+
+	refreshed, err := service.RefreshStatus(ctx, submitted)
+	if err != nil {
+		t.Fatalf("RefreshStatus: %v", err)
+	}
+	if refreshed.Status != dbmodels.EInvoiceStatusValid || refreshed.Error != "" {
+		t.Fatalf("validated as %s (%s), want VALID", refreshed.Status, refreshed.Error)
+	}
+
+	// A refund is credited against the accepted invoice
+	if _, err := service.IssuePaymentCreditNote(paid.ID); !hasCode(err, http.StatusConflict) {
+		t.Errorf("credit note before the refund: %v, want 409", err)
+	}
+	if err := db.Model(&paid).Update("payment_status", dbmodels.PaymentStatus_REFUNDED).Error; err != nil {
+		t.Fatal(err)
+	}
+	creditNote, err := service.IssuePaymentCreditNote(paid.ID)
+	if err != nil {
+		t.Fatalf("IssuePaymentCreditNote: %v", err)
+	}
+	if creditNote.DocumentType != dbmodels.EInvoiceTypeCreditNote || creditNote.ReferenceID == nil || *creditNote.ReferenceID != invoice.ID {
+		t.Fatalf("credit note %+v does not reference invoice %d", creditNote, invoice.ID)
+	}
+	creditNote, err = service.Submit(ctx, creditNote)
+	if err != nil {
+		t.Fatalf("Submit credit note: %v", err)
+	}
+	if creditNote.Status != dbmodels.EInvoiceStatusSubmitted || creditNote.UUID == invoice.UUID {
+		t.Errorf("credit note submitted as %s with UUID %q, want SUBMITTED under its own UUID", creditNote.Status, creditNote.UUID)
+	}
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
+
+func hasCode(err error, code int) bool {
+	customErr, ok := err.(*stores.CustomError)
+	return ok && customErr.Code == code
+}
@@ -0,0 +1,59 @@
+package einvoice
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+)
+
+// ========== SUBMITTER INTERFACE ==========
+
+var ErrUnknownDocument = errors.New("document not found at the tax authority")
+
+// Submitter sends documents to the tax authority and reports their validation status
+type Submitter interface {
+	Name() string
+	// Submit sends documents as serialized JSON, exactly as they were hashed
+	Submit(ctx context.Context, documents [][]byte) (*SubmissionResult, error)
+	Status(ctx context.Context, uuid string) (*DocumentStatus, error)
+}
+
+// SubmissionResult splits a submission into accepted and rejected documents
+type SubmissionResult struct {
+	SubmissionID string
+	Accepted     []AcceptedDocument
+	Rejected     []RejectedDocument
+}
+
+type AcceptedDocument struct {
+	InternalID string
+	UUID       string
+	LongID     string
+}
+
+type RejectedDocument struct {
+	InternalID string
+	Error      string
+}
+
+// DocumentStatus is the outcome of the tax authority's validation: Submitted,
+// Valid, Invalid, Rejected or Cancelled
+type DocumentStatus struct {
+	UUID   string
+	Status string
+	Errors []string
+}
+
+// NewSubmitter returns the configured submitter, or the local stand-in
+func NewSubmitter(cfg config.EInvoiceConfig) Submitter {
+	switch cfg.Submitter {
+	case "eta":
+		return NewETASubmitter(cfg)
+	case "local":
+	default:
+		log.Printf("⚠️ E-invoice: unknown submitter %q, using the local stand-in", cfg.Submitter)
+	}
+	return NewLocalSubmitter()
+}
@@ -0,0 +1,347 @@
+package i18n
+
+import "unicode"
+
+// ========== ARABIC SHAPING ==========
+
+// PDF fonts draw one glyph per code point and lay them out left to right, so Arabic
+// text has to be converted to its presentation forms and put in visual order first.
+
+// arabicForms holds the isolated, final, initial and medial presentation forms of
+// each letter. Letters without initial and medial forms do not join the next letter.
+var arabicForms = map[rune][4]rune{
+	0x0621: {0xFE80, 0, 0, 0},                // ء
+	0x0622: {0xFE81, 0xFE82, 0, 0},           // آ
+	0x0623: {0xFE83, 0xFE84, 0, 0},           // أ
+	0x0624: {0xFE85, 0xFE86, 0, 0},           // ؤ
+	0x0625: {0xFE87, 0xFE88, 0, 0},           // إ
+	0x0626: {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C}, // ئ
+	0x0627: {0xFE8D, 0xFE8E, 0, 0},           // ا
+	0x0628: {0xFE8F, 0xFE90, 0xFE91, 0xFE92}, // ب
+	0x0629: {0xFE93, 0xFE94, 0, 0},           // ة
+	0x062A: {0xFE95, 0xFE96, 0xFE97, 0xFE98}, // ت
+	0x062B: {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C}, // ث
+	0x062C: {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0}, // ج
+	0x062D: {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4}, // ح
+	0x062E: {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8}, // خ
+	0x062F: {0xFEA9, 0xFEAA, 0, 0},           // د
+	0x0630: {0xFEAB, 0xFEAC, 0, 0},           // ذ
+	0x0631: {0xFEAD, 0xFEAE, 0, 0},           // ر
+	0x0632: {0xFEAF, 0xFEB0, 0, 0},           // ز
+	0x0633: {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4}, // س
+	0x0634: {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8}, // ش
+	0x0635: {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC}, // ص
+	0x0636: {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0}, // ض
+	0x0637: {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4}, // ط
+	0x0638: {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8}, // ظ
+	0x0639: {0xFEC9, 0xFECA, 0xFECB, 0xFECC}, // ع
+	0x063A: {0xFECD, 0xFECE, 0xFECF, 0xFED0}, // غ
+	0x0640: {0x0640, 0x0640, 0x0640, 0x0640}, // tatweel
+	0x0641: {0xFED1, 0xFED2, 0xFED3, 0xFED4}, // ف
+	0x0642: {0xFED5, 0xFED6, 0xFED7, 0xFED8}, // ق
+	0x0643: {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC}, // ك
+	0x0644: {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0}, // ل
+	0x0645: {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4}, // م
+	0x0646: {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8}, // ن
+	0x0647: {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC}, // ه
+	0x0648: {0xFEED, 0xFEEE, 0, 0},           // و
+	0x0649: {0xFEEF, 0xFEF0, 0, 0},           // ى
+	0x064A: {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4}, // ي
+}
+
+// lamAlef holds the isolated and final lam-alef ligatures keyed by the alef
+var lamAlef = map[rune][2]rune{
+	0x0622: {0xFEF5, 0xFEF6},
+	0x0623: {0xFEF7, 0xFEF8},
+	0x0625: {0xFEF9, 0xFEFA},
+	0x0627: {0xFEFB, 0xFEFC},
+}
+
+const lam = 0x0644
+
+// isHaraka reports whether r is a diacritic, which does not affect joining
+func isHaraka(r rune) bool {
+	return (r >= 0x064B && r <= 0x065F) || r == 0x0670
+}
+
+func joinsNext(r rune) bool {
+	forms, ok := arabicForms[r]
+	return ok && forms[2] != 0
+}
+
+func joinsPrevious(r rune) bool {
+	forms, ok := arabicForms[r]
+	return ok && forms[1] != 0
+}
+
+// neighbour returns the closest letter before (step -1) or after (step 1) position i, skipping diacritics
+func neighbour(runes []rune, i, step int) (rune, int) {
+	for j := i + step; j >= 0 && j < len(runes); j += step {
+		if !isHaraka(runes[j]) {
+			return runes[j], j
+		}
+	}
+	return 0, -1
+}
+
+// Shape replaces Arabic letters with their contextual presentation forms and
+// combines lam-alef pairs. Text stays in logical order.
+func Shape(text string) string {
+	runes := []rune(text)
+	if !hasArabic(runes) {
+		return text
+	}
+
+	shaped := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		forms, ok := arabicForms[r]
+		if !ok {
+			shaped = append(shaped, r)
+			continue
+		}
+
+		prev, _ := neighbour(runes, i, -1)
+		next, nextIndex := neighbour(runes, i, 1)
+		connectsPrevious := joinsNext(prev) && joinsPrevious(r)
+
+		if r == lam {
+			if ligature, ok := lamAlef[next]; ok {
+				if connectsPrevious {
+					shaped = append(shaped, ligature[1])
+				} else {
+					shaped = append(shaped, ligature[0])
+				}
+				// Keep diacritics that sat between lam and alef
+				shaped = append(shaped, runes[i+1:nextIndex]...)
+				i = nextIndex
+				continue
+			}
+		}
+
+		connectsNext := joinsNext(r) && joinsPrevious(next)
+		switch {
+		case connectsPrevious && connectsNext:
+			shaped = append(shaped, forms[3])
+		case connectsPrevious:
+			shaped = append(shaped, forms[1])
+		case connectsNext:
+			shaped = append(shaped, forms[2])
+		default:
+			shaped = append(shaped, forms[0])
+		}
+	}
+	return string(shaped)
+}
+
+// ========== VISUAL ORDER ==========
+
+type direction int
+
+const (
+	neutral direction = iota
+	ltr
+	rtl
+	number // Digits, and the signs and separators that belong to them
+)
+
+func isArabicRune(r rune) bool {
+	return (r >= 0x0600 && r <= 0x06FF && !isDigit(r) && !isNumberSeparator(r)) ||
+		(r >= 0x0750 && r <= 0x077F) ||
+		(r >= 0xFB50 && r <= 0xFDFF) ||
+		(r >= 0xFE70 && r <= 0xFEFF)
+}
+
+func isDigit(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 0x0660 && r <= 0x0669) || (r >= 0x06F0 && r <= 0x06F9)
+}
+
+// isNumberSeparator matches the Arabic decimal and thousands separators
+func isNumberSeparator(r rune) bool {
+	return r == 0x066B || r == 0x066C
+}
+
+func isNumberPrefix(r rune) bool {
+	return r == '+' || r == '-' || r == '#' || r == '$'
+}
+
+func hasArabic(runes []rune) bool {
+	for _, r := range runes {
+		if isArabicRune(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasArabic reports whether text contains Arabic script
+func HasArabic(text string) bool {
+	return hasArabic([]rune(text))
+}
+
+// StartsRTL reports whether the first letter of text is Arabic; user-entered
+// values take their paragraph direction from it
+func StartsRTL(text string) bool {
+	for _, r := range text {
+		if isArabicRune(r) {
+			return true
+		}
+		if unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return false
+}
+
+func classify(r rune) direction {
+	switch {
+	case isArabicRune(r):
+		return rtl
+	case isDigit(r):
+		return number
+	case unicode.IsLetter(r):
+		return ltr
+	default:
+		return neutral
+	}
+}
+
+var mirrored = map[rune]rune{
+	'(': ')', ')': '(',
+	'[': ']', ']': '[',
+	'{': '}', '}': '{',
+	'<': '>', '>': '<',
+	'«': '»', '»': '«',
+}
+
+// Reorder puts a single line into visual (left to right) order. rtlBase is the
+// paragraph direction: true for Arabic documents. This is a reduced form of the
+// Unicode bidi algorithm that handles mixed Arabic, Latin and numbers on one line.
+func Reorder(text string, rtlBase bool) string {
+	runes := []rune(text)
+	if !hasArabic(runes) {
+		return text
+	}
+
+	base := ltr
+	if rtlBase {
+		base = rtl
+	}
+
+	dirs := make([]direction, len(runes))
+	for i, r := range runes {
+		dirs[i] = classify(r)
+	}
+
+	// Signs, separators and single spaces inside or touching a number belong to it,
+	// e.g. -10.00, 1,250.00, 2024-01-31, +20 123 456 or 15%
+	for i := range runes {
+		if dirs[i] != neutral {
+			continue
+		}
+		before := i > 0 && dirs[i-1] == number
+		after := i+1 < len(runes) && isDigit(runes[i+1])
+		if (before && after) || (after && isNumberPrefix(runes[i])) || (before && runes[i] == '%') {
+			dirs[i] = number
+		}
+	}
+
+	// A number after Latin text reads as part of it, e.g. "Samsung A54"
+	previous := base
+	for i := range runes {
+		switch dirs[i] {
+		case ltr, rtl:
+			previous = dirs[i]
+		case number:
+			if previous == ltr {
+				dirs[i] = ltr
+			}
+		}
+	}
+
+	// Other neutrals take the direction of the strong runes around them when both
+	// sides agree, and the paragraph direction otherwise. Numbers count as right to left.
+	strong := func(d direction) direction {
+		if d == number {
+			return rtl
+		}
+		return d
+	}
+	for i := 0; i < len(runes); {
+		if dirs[i] != neutral {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && dirs[j] == neutral {
+			j++
+		}
+		before, after := base, base
+		if i > 0 {
+			before = strong(dirs[i-1])
+		}
+		if j < len(runes) {
+			after = strong(dirs[j])
+		}
+		resolved := base
+		if before == after {
+			resolved = before
+		}
+		for k := i; k < j; k++ {
+			dirs[k] = resolved
+		}
+		i = j
+	}
+
+	// Embedding levels: even reads left to right, odd right to left
+	levels := make([]int, len(runes))
+	highest := 0
+	for i, d := range dirs {
+		switch {
+		case d == number:
+			levels[i] = 2
+		case d == rtl:
+			levels[i] = 1
+		case d == ltr && base == rtl:
+			levels[i] = 2
+		}
+		if levels[i]%2 == 1 {
+			if m, ok := mirrored[runes[i]]; ok {
+				runes[i] = m
+			}
+		}
+		if levels[i] > highest {
+			highest = levels[i]
+		}
+	}
+
+	// From the highest level down, reverse every stretch at that level or above
+	for level := highest; level >= 1; level-- {
+		for i := 0; i < len(runes); {
+			if levels[i] < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(runes) && levels[j] >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				runes[a], runes[b] = runes[b], runes[a]
+				levels[a], levels[b] = levels[b], levels[a]
+			}
+			i = j
+		}
+	}
+	return string(runes)
+}
+
+// Visual shapes a single line and puts it in visual order, ready to draw with a PDF font
+func Visual(text string, rtlBase bool) string {
+	return Reorder(Shape(text), rtlBase)
+}
+
+// VisualAuto is Visual with the direction taken from the text itself
+func VisualAuto(text string) string {
+	return Visual(text, StartsRTL(text))
+}
@@ -0,0 +1,27 @@
+package i18n
+
+import (
+	_ "embed"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// ========== PDF FONTS ==========
+
+// DejaVu Sans Condensed covers Latin and Arabic, including the presentation forms
+// produced by Shape. The fonts are distributed under the Bitstream Vera license.
+var (
+	//go:embed fonts/DejaVuSansCondensed.ttf
+	fontRegular []byte
+	//go:embed fonts/DejaVuSansCondensed-Bold.ttf
+	fontBold []byte
+)
+
+// PDFFont is the family name registered by AddPDFFonts
+const PDFFont = "dejavu"
+
+// AddPDFFonts registers the embedded Unicode fonts, regular and bold, with a document
+func AddPDFFonts(pdf *gofpdf.Fpdf) {
+	pdf.AddUTF8FontFromBytes(PDFFont, "", fontRegular)
+	pdf.AddUTF8FontFromBytes(PDFFont, "B", fontBold)
+}
@@ -0,0 +1,163 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/shopspring/decimal"
+)
+
+// ========== LOCALES ==========
+
+const (
+	English = "en"
+	Arabic  = "ar"
+
+	// Numbering systems, named as in CLDR
+	NumeralsLatin = "latn" // 0123456789
+	NumeralsArab  = "arab" // ٠١٢٣٤٥٦٧٨٩
+)
+
+// Locale decides the language, direction and digits of rendered documents
+type Locale struct {
+	Language string
+	Numerals string
+}
+
+// NewLocale builds a locale from a language tag or Accept-Language value.
+// Unsupported languages fall back to English; numerals default to Latin digits.
+func NewLocale(language, numerals string) Locale {
+	locale := Locale{Language: NormalizeLanguage(language), Numerals: NumeralsLatin}
+	if locale.Language == "" {
+		locale.Language = English
+	}
+	if numerals == NumeralsArab {
+		locale.Numerals = NumeralsArab
+	}
+	return locale
+}
+
+// NormalizeLanguage reduces "ar-EG,ar;q=0.9,en;q=0.8" to "ar". It returns an
+// empty string when the preferred language is not supported.
+func NormalizeLanguage(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if i := strings.IndexAny(tag, ",;"); i >= 0 {
+		tag = tag[:i]
+	}
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if IsSupported(tag) {
+		return tag
+	}
+	return ""
+}
+
+func IsSupported(language string) bool {
+	_, ok := messages[language]
+	return ok
+}
+
+// IsValidNumerals reports whether numerals names a supported numbering system
+func IsValidNumerals(numerals string) bool {
+	return numerals == NumeralsLatin || numerals == NumeralsArab
+}
+
+func (l Locale) IsRTL() bool {
+	return l.Language == Arabic
+}
+
+// Dir is the HTML dir attribute for the locale
+func (l Locale) Dir() string {
+	if l.IsRTL() {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// T returns the message for key in the locale's language, falling back to
+// English and then to the key itself
+func (l Locale) T(key string) string {
+	if message, ok := messages[l.Language][key]; ok {
+		return message
+	}
+	if message, ok := messages[English][key]; ok {
+		return message
+	}
+	return key
+}
+
+// Digits rewrites ASCII digits in the locale's numbering system
+func (l Locale) Digits(text string) string {
+	if l.Numerals != NumeralsArab {
+		return text
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return 0x0660 + (r - '0')
+		}
+		return r
+	}, text)
+}
+
+// Number formats an integer in the locale's numbering system
+func (l Locale) Number(n int) string {
+	return l.Digits(fmt.Sprint(n))
+}
+
+// Amount formats a money amount with two decimals and, for Arabic digits,
+// the Arabic decimal separator
+func (l Locale) Amount(amount decimal.Decimal) string {
+	formatted := money.Format(amount)
+	if l.Numerals == NumeralsArab {
+		formatted = strings.Replace(formatted, ".", "٫", 1)
+	}
+	return l.Digits(formatted)
+}
+
+// Money formats an amount followed by the currency, using the local symbol in Arabic
+func (l Locale) Money(amount decimal.Decimal, currency string) string {
+	return l.Amount(amount) + " " + l.Currency(currency)
+}
+
+func (l Locale) Currency(currency string) string {
+	if l.Language == Arabic {
+		if symbol, ok := arabicCurrencySymbols[currency]; ok {
+			return symbol
+		}
+	}
+	return currency
+}
+
+// Date formats a date as 2006-01-02 in English and "2 يناير 2006" in Arabic
+func (l Locale) Date(t time.Time) string {
+	if l.Language == Arabic {
+		return l.Digits(fmt.Sprintf("%d %s %d", t.Day(), arabicMonths[t.Month()-1], t.Year()))
+	}
+	return l.Digits(t.Format("2006-01-02"))
+}
+
+// DateTime formats a date with the time of day
+func (l Locale) DateTime(t time.Time) string {
+	return l.Date(t) + " " + l.Digits(t.Format("15:04"))
+}
+
+// Month names as used in Egypt
+var arabicMonths = [12]string{
+	"يناير", "فبراير", "مارس", "أبريل", "مايو", "يونيو",
+	"يوليو", "أغسطس", "سبتمبر", "أكتوبر", "نوفمبر", "ديسمبر",
+}
+
+var arabicCurrencySymbols = map[string]string{
+	"EGP": "ج.م",
+	"SAR": "ر.س",
+	"AED": "د.إ",
+	"KWD": "د.ك",
+	"QAR": "ر.ق",
+	"BHD": "د.ب",
+	"OMR": "ر.ع",
+	"JOD": "د.أ",
+}
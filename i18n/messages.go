@@ -0,0 +1,98 @@
+package i18n
+
+// ========== MESSAGES ==========
+
+var messages = map[string]map[string]string{
+	English: {
+		"receipt.title":              "RECEIPT",
+		"receipt.number":             "Receipt Number",
+		"receipt.date":               "Date",
+		"receipt.order_id":           "Order ID",
+		"receipt.order_date":         "Order Date",
+		"receipt.customer":           "Customer Details",
+		"receipt.name":               "Name",
+		"receipt.email":              "Email",
+		"receipt.phone":              "Phone",
+		"receipt.address":            "Address",
+		"receipt.website":            "Website",
+		"receipt.tax_id":             "Tax ID",
+		"receipt.items":              "Order Items",
+		"receipt.product":            "Product",
+		"receipt.quantity":           "Quantity",
+		"receipt.price":              "Price",
+		"receipt.total":              "Total",
+		"receipt.discount":           "Discount",
+		"receipt.total_amount":       "Total Amount",
+		"receipt.payment":            "Payment Information",
+		"receipt.payment_status":     "Payment Status",
+		"receipt.payment_method":     "Payment Method",
+		"receipt.payment_date":       "Payment Date",
+		"receipt.reference":          "Reference",
+		"receipt.notes":              "Notes",
+		"receipt.return_policy":      "Return Policy",
+		"receipt.thanks":             "Thank you for your business!",
+		"receipt.computer_generated": "This is a computer-generated receipt and does not require a signature.",
+		"receipt.print":              "Print Receipt",
+		"receipt.not_available":      "N/A",
+		"receipt.email_subject":      "Your receipt for order #%s from %s",
+		"receipt.email_greeting":     "Hello %s,",
+		"receipt.email_body":         "Thank you for your order. Your receipt is attached to this email.",
+		"receipt.email_link":         "View receipt online",
+		"receipt.scan_to_verify":     "Scan to verify this receipt",
+		"receipt.verification":       "Receipt Verification",
+		"receipt.store":              "Store",
+		"receipt.valid":              "Valid receipt",
+		"receipt.void":               "Void - the order was cancelled or refunded",
+		"receipt.not_verified":       "This receipt could not be verified",
+	},
+	Arabic: {
+		"receipt.title":              "إيصال",
+		"receipt.number":             "رقم الإيصال",
+		"receipt.date":               "التاريخ",
+		"receipt.order_id":           "رقم الطلب",
+		"receipt.order_date":         "تاريخ الطلب",
+		"receipt.customer":           "بيانات العميل",
+		"receipt.name":               "الاسم",
+		"receipt.email":              "البريد الإلكتروني",
+		"receipt.phone":              "الهاتف",
+		"receipt.address":            "العنوان",
+		"receipt.website":            "الموقع الإلكتروني",
+		"receipt.tax_id":             "الرقم الضريبي",
+		"receipt.items":              "المنتجات",
+		"receipt.product":            "المنتج",
+		"receipt.quantity":           "الكمية",
+		"receipt.price":              "السعر",
+		"receipt.total":              "الإجمالي",
+		"receipt.discount":           "الخصم",
+		"receipt.total_amount":       "المبلغ الإجمالي",
+		"receipt.payment":            "بيانات الدفع",
+		"receipt.payment_status":     "حالة الدفع",
+		"receipt.payment_method":     "طريقة الدفع",
+		"receipt.payment_date":       "تاريخ الدفع",
+		"receipt.reference":          "المرجع",
+		"receipt.notes":              "ملاحظات",
+		"receipt.return_policy":      "سياسة الاسترجاع",
+		"receipt.thanks":             "شكراً لتعاملكم معنا!",
+		"receipt.computer_generated": "هذا إيصال صادر إلكترونياً ولا يحتاج إلى توقيع.",
+		"receipt.print":              "طباعة الإيصال",
+		"receipt.not_available":      "غير متوفر",
+		"receipt.email_subject":      "إيصال طلبك رقم %s من %s",
+		"receipt.email_greeting":     "مرحباً %s،",
+		"receipt.email_body":         "شكراً لطلبك. تجد الإيصال مرفقاً بهذه الرسالة.",
+		"receipt.email_link":         "عرض الإيصال على الإنترنت",
+		"receipt.scan_to_verify":     "امسح الرمز للتحقق من الإيصال",
+		"receipt.verification":       "التحقق من الإيصال",
+		"receipt.store":              "المتجر",
+		"receipt.valid":              "إيصال صالح",
+		"receipt.void":               "ملغى - تم إلغاء الطلب أو استرداد المبلغ",
+		"receipt.not_verified":       "تعذر التحقق من هذا الإيصال",
+
+		// Payment statuses
+		"PENDING":   "قيد الانتظار",
+		"PAID":      "مدفوع",
+		"FAILED":    "فشل",
+		"CANCELLED": "ملغي",
+		"EXPIRED":   "منتهي",
+		"REFUNDED":  "مسترد",
+	},
+}
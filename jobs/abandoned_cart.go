@@ -0,0 +1,213 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/notification"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== ABANDONED CART REMINDERS ==========
+
+// AbandonedCartJob finds idle carts and sends up to MaxReminders reminders with a restore link
+type AbandonedCartJob struct {
+	store        *stores.DbStore
+	config       *config.Config
+	emailService *notification.EmailService
+	notifService *notification.NotificationService
+}
+
+func NewAbandonedCartJob(store *stores.DbStore, cfg *config.Config, emailService *notification.EmailService, notifService *notification.NotificationService) *AbandonedCartJob {
+	return &AbandonedCartJob{
+		store:        store,
+		config:       cfg,
+		emailService: emailService,
+		notifService: notifService,
+	}
+}
+
+// Run performs a single pass over all idle carts
+func (j *AbandonedCartJob) Run() {
+	cfg := j.config.GetAbandonedCartConfig()
+	now := time.Now()
+
+	if err := j.store.ExpireEmptyCartRecoveries(); err != nil {
+		log.Printf("Abandoned carts: failed to expire emptied carts: %v", err)
+	}
+
+	carts, err := j.store.GetIdleCarts(now.Add(-j.config.GetAbandonedCartIdleThreshold()))
+	if err != nil {
+		log.Printf("Abandoned carts: %v", err)
+		return
+	}
+
+	for _, cart := range carts {
+		recovery, err := j.store.GetOpenCartRecovery(cart.UserID, cart.SessionID)
+		if err != nil {
+			recovery = &dbmodels.CartRecovery{
+				UserID:       cart.UserID,
+				SessionID:    cart.SessionID,
+				StoreOwnerID: cart.StoreOwnerID,
+				RestoreToken: utils.GenerateToken(24),
+				Status:       dbmodels.CartRecoveryStatus_OPEN,
+			}
+		}
+		recovery.CartTotal = cart.CartTotal
+		recovery.ItemCount = cart.ItemCount
+		recovery.LastActivityAt = cart.LastActivityAt
+
+		if recovery.ID == 0 {
+			if err := j.store.CreateCartRecovery(recovery); err != nil {
+				log.Printf("Abandoned carts: failed to track cart: %v", err)
+				continue
+			}
+		}
+
+		if j.dueForReminder(recovery, cfg, now) {
+			if err := j.sendReminder(recovery, cfg, now); err != nil {
+				log.Printf("Abandoned carts: reminder for recovery %d not sent: %v", recovery.ID, err)
+			}
+		} else if recovery.ReminderCount >= cfg.MaxReminders && recovery.LastReminderAt != nil &&
+			now.Sub(*recovery.LastReminderAt) >= j.config.GetAbandonedCartReminderInterval() {
+			// Sequence exhausted without a purchase
+			recovery.Status = dbmodels.CartRecoveryStatus_EXPIRED
+		}
+
+		if err := j.store.UpdateCartRecovery(recovery); err != nil {
+			log.Printf("Abandoned carts: failed to update recovery %d: %v", recovery.ID, err)
+		}
+	}
+}
+
+func (j *AbandonedCartJob) dueForReminder(recovery *dbmodels.CartRecovery, cfg config.AbandonedCartConfig, now time.Time) bool {
+	if recovery.ReminderCount >= cfg.MaxReminders {
+		return false
+	}
+	// Guest carts can only be reminded once the shopper left an email
+	if recovery.UserID == nil && recovery.Email == "" {
+		return false
+	}
+	if recovery.LastReminderAt == nil {
+		return true
+	}
+	// Activity after a reminder restarts the wait
+	since := *recovery.LastReminderAt
+	if recovery.LastActivityAt.After(since) {
+		since = recovery.LastActivityAt
+	}
+	return now.Sub(since) >= j.config.GetAbandonedCartReminderInterval()
+}
+
+func (j *AbandonedCartJob) sendReminder(recovery *dbmodels.CartRecovery, cfg config.AbandonedCartConfig, now time.Time) error {
+	email := recovery.Email
+	if recovery.UserID != nil {
+		user, err := j.store.GetUser(*recovery.UserID)
+		if err == nil && email == "" {
+			email = user.Email
+		}
+	}
+
+	reminderNumber := recovery.ReminderCount + 1
+
+	// Attach a one-time coupon from the configured reminder onwards
+	if cfg.CouponEnabled && recovery.CouponID == nil && reminderNumber >= cfg.CouponReminder {
+		expiresAt := now.AddDate(0, 0, cfg.CouponValidDays)
+		coupon := &dbmodels.Coupon{
+			Code:            "CART-" + strings.ToUpper(utils.GenerateToken(4)),
+			UserID:          recovery.StoreOwnerID,
+			DiscountPercent: cfg.CouponPercent,
+			MaxUses:         1,
+			Source:          "cart_recovery",
+			IsActive:        true,
+			ExpiresAt:       &expiresAt,
+		}
+		if err := j.store.CreateCoupon(coupon); err != nil {
+			return err
+		}
+		recovery.CouponID = &coupon.ID
+		recovery.Coupon = coupon
+	}
+
+	restoreLink := restoreCartLink(cfg.RestoreURL, recovery.RestoreToken)
+
+	sent := false
+	if email != "" && j.emailService.IsConfigured() {
+		body, err := renderCartReminder(recovery, restoreLink, j.store.GetStoreCurrency(recovery.StoreOwnerID, j.config.GetBaseCurrency()))
+		if err != nil {
+			return err
+		}
+		if err := j.emailService.Send(email, "You left something in your cart", body); err != nil {
+			log.Printf("Abandoned carts: email to %s failed: %v", email, err)
+		} else {
+			sent = true
+		}
+	}
+	if recovery.UserID != nil && j.notifService != nil {
+		if err := j.notifService.NotifyCartReminder(*recovery.UserID, recovery.ItemCount, restoreLink); err == nil {
+			sent = true
+		}
+	}
+	if !sent {
+		return fmt.Errorf("no delivery channel available")
+	}
+
+	recovery.ReminderCount = reminderNumber
+	recovery.LastReminderAt = &now
+	return nil
+}
+
+// restoreCartLink appends the restore token to the configured storefront URL
+func restoreCartLink(baseURL, token string) string {
+	separator := "?"
+	if strings.Contains(baseURL, "?") {
+		separator = "&"
+	}
+	return baseURL + separator + "token=" + token
+}
+
+func renderCartReminder(recovery *dbmodels.CartRecovery, restoreLink, currency string) (string, error) {
+	tmpl, err := template.New("cart_reminder").Parse(cartReminderTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	data := map[string]interface{}{
+		"ItemCount":   recovery.ItemCount,
+		"CartTotal":   money.Format(recovery.CartTotal),
+		"Currency":    currency,
+		"RestoreLink": restoreLink,
+	}
+	if recovery.Coupon != nil {
+		data["CouponCode"] = recovery.Coupon.Code
+		data["CouponPercent"] = fmt.Sprintf("%.0f", recovery.Coupon.DiscountPercent)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+const cartReminderTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; color: #333;">
+    <h2>Your cart is waiting for you</h2>
+    <p>You left {{.ItemCount}} item(s) in your cart, worth {{.CartTotal}} {{.Currency}}.</p>
+    {{if .CouponCode}}
+    <p>Complete your order now and get <strong>{{.CouponPercent}}% off</strong> with code
+       <strong>{{.CouponCode}}</strong>. The code can be used once.</p>
+    {{end}}
+    <p><a href="{{.RestoreLink}}" style="background: #4CAF50; color: #fff; padding: 10px 20px; text-decoration: none; border-radius: 4px;">Return to your cart</a></p>
+    <p style="font-size: 12px; color: #999;">If you already completed your purchase, please ignore this email.</p>
+</body>
+</html>`
@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/notification"
+	"github.com/mohammedrefaat/hamber/stores"
+)
+
+// ========== LOW STOCK ALERTS ==========
+
+// LowStockJob alerts store owners once when products reach their reorder point.
+// The alert is re-armed after the product is restocked above it.
+type LowStockJob struct {
+	store        *stores.DbStore
+	emailService *notification.EmailService
+	notifService *notification.NotificationService
+}
+
+func NewLowStockJob(store *stores.DbStore, emailService *notification.EmailService, notifService *notification.NotificationService) *LowStockJob {
+	return &LowStockJob{
+		store:        store,
+		emailService: emailService,
+		notifService: notifService,
+	}
+}
+
+// Run performs a single pass over all stores
+func (j *LowStockJob) Run() {
+	if err := j.store.ClearRestockedAlerts(); err != nil {
+		log.Printf("Low stock: failed to re-arm restocked products: %v", err)
+	}
+
+	levels, err := j.store.GetLowStockProducts(0)
+	if err != nil {
+		log.Printf("Low stock: %v", err)
+		return
+	}
+
+	// Group products that have not been alerted yet by store owner
+	pending := map[uint][]dbmodels.StockLevel{}
+	var owners []uint
+	for _, level := range levels {
+		if level.LowStockAlertAt != nil {
+			continue
+		}
+		if _, seen := pending[level.UserID]; !seen {
+			owners = append(owners, level.UserID)
+		}
+		pending[level.UserID] = append(pending[level.UserID], level)
+	}
+
+	now := time.Now()
+	for _, ownerID := range owners {
+		products := pending[ownerID]
+		if err := j.alert(ownerID, products); err != nil {
+			log.Printf("Low stock: alert for user %d not sent: %v", ownerID, err)
+			continue
+		}
+
+		ids := make([]uint, 0, len(products))
+		for _, product := range products {
+			ids = append(ids, product.ProductID)
+		}
+		if err := j.store.SetLowStockAlert(ids, &now); err != nil {
+			log.Printf("Low stock: failed to mark products of user %d: %v", ownerID, err)
+		}
+	}
+}
+
+func (j *LowStockJob) alert(ownerID uint, products []dbmodels.StockLevel) error {
+	names := make([]string, 0, len(products))
+	for i, product := range products {
+		if i == 5 {
+			names = append(names, fmt.Sprintf("and %d more", len(products)-5))
+			break
+		}
+		names = append(names, fmt.Sprintf("%s (%d left)", product.Name, product.Quantity))
+	}
+	summary := strings.Join(names, ", ")
+
+	// Without RabbitMQ the notification is written directly
+	if j.notifService != nil {
+		if err := j.notifService.NotifyLowStock(ownerID, len(products), summary); err != nil {
+			return err
+		}
+	} else if err := j.store.CreateNotification(&dbmodels.Notification{
+		UserID:  ownerID,
+		Title:   "Low Stock Alert",
+		Message: fmt.Sprintf("%d product(s) reached their reorder point: %s", len(products), summary),
+		Type:    "warning",
+		Link:    "/dashboard/reorder-suggestions",
+	}); err != nil {
+		return err
+	}
+
+	if j.emailService.IsConfigured() {
+		owner, err := j.store.GetUser(ownerID)
+		if err == nil && owner.Email != "" {
+			if err := j.emailService.Send(owner.Email, "Low stock alert", renderLowStockEmail(products)); err != nil {
+				log.Printf("Low stock: email to %s failed: %v", owner.Email, err)
+			}
+		}
+	}
+	return nil
+}
+
+func renderLowStockEmail(products []dbmodels.StockLevel) string {
+	var rows strings.Builder
+	for _, product := range products {
+		fmt.Fprintf(&rows, "<tr><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%d</td></tr>",
+			html.EscapeString(product.Name), html.EscapeString(product.SKU),
+			product.Quantity, product.ReorderPoint, product.ReorderQuantity)
+	}
+
+	return `<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; color: #333;">
+    <h2>Products running low</h2>
+    <p>The following products reached their reorder point:</p>
+    <table cellpadding="6" style="border-collapse: collapse;" border="1">
+        <tr><th>Product</th><th>SKU</th><th>In stock</th><th>Reorder point</th><th>Reorder quantity</th></tr>
+        ` + rows.String() + `
+    </table>
+    <p>See the reorder suggestions in your dashboard for quantities based on recent sales.</p>
+</body>
+</html>`
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/mohammedrefaat/hamber/notification"
+	"github.com/mohammedrefaat/hamber/stores"
+)
+
+// ========== SCHEDULED PACKAGE CHANGES ==========
+
+// PackageChangeJob moves users to the package of a paid downgrade once their
+// current subscription period ends
+type PackageChangeJob struct {
+	store        *stores.DbStore
+	notifService *notification.NotificationService
+}
+
+func NewPackageChangeJob(store *stores.DbStore, notifService *notification.NotificationService) *PackageChangeJob {
+	return &PackageChangeJob{
+		store:        store,
+		notifService: notifService,
+	}
+}
+
+// Run applies every scheduled change that became effective
+func (j *PackageChangeJob) Run() {
+	applied, err := j.store.ApplyScheduledPackageChanges(time.Now())
+	if err != nil {
+		log.Printf("Package changes: %v", err)
+	}
+
+	for _, change := range applied {
+		if j.notifService != nil {
+			if err := j.notifService.NotifyPackageChange(change.UserID, change.OldPackage.Name, change.NewPackage.Name); err != nil {
+				log.Printf("Package changes: notification for user %d failed: %v", change.UserID, err)
+			}
+		}
+	}
+	if len(applied) > 0 {
+		log.Printf("Package changes: applied %d scheduled change(s)", len(applied))
+	}
+}
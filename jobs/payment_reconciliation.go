@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mohammedrefaat/hamber/payment"
+	"github.com/mohammedrefaat/hamber/stores"
+)
+
+// ========== PAYMENT RECONCILIATION ==========
+
+// paymentBatchSize caps the pending payments checked per run; the least recently checked go first
+const paymentBatchSize = 200
+
+// PaymentReconciliationJob settles pending payments whose callback was missed,
+// expires unpaid ones and builds the daily reconciliation report
+type PaymentReconciliationJob struct {
+	store      *stores.DbStore
+	reconciler *payment.Reconciler
+	staleAfter time.Duration
+}
+
+func NewPaymentReconciliationJob(store *stores.DbStore, reconciler *payment.Reconciler, staleAfter time.Duration) *PaymentReconciliationJob {
+	return &PaymentReconciliationJob{
+		store:      store,
+		reconciler: reconciler,
+		staleAfter: staleAfter,
+	}
+}
+
+// Run performs a single pass over stale pending payments
+func (j *PaymentReconciliationJob) Run() {
+	summary, err := j.reconciler.ReconcilePending(context.Background(), time.Now().Add(-j.staleAfter), paymentBatchSize)
+	if err != nil {
+		log.Printf("Payments: %v", err)
+		return
+	}
+	if summary.Settled > 0 || summary.Expired > 0 || summary.Failed > 0 {
+		log.Printf("Payments: checked %d pending payment(s), %d settled, %d expired, %d failed",
+			summary.Checked, summary.Settled, summary.Expired, summary.Failed)
+	}
+}
+
+// RunReport builds the report of the previous day unless it exists
+func (j *PaymentReconciliationJob) RunReport() {
+	yesterday := time.Now().AddDate(0, 0, -1)
+	year, month, day := yesterday.Date()
+	reportDate := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+
+	exists, err := j.store.HasPaymentReconciliation(reportDate)
+	if err != nil {
+		log.Printf("Payments: %v", err)
+		return
+	}
+	if exists {
+		return
+	}
+
+	report, err := j.reconciler.ReportDay(context.Background(), reportDate)
+	if err != nil {
+		log.Printf("Payments: reconciliation report for %s failed: %v", reportDate.Format("2006-01-02"), err)
+		return
+	}
+	log.Printf("Payments: reconciliation report for %s, %d checked, %d mismatched, %d failed",
+		reportDate.Format("2006-01-02"), report.Checked, report.Mismatched, report.Failed)
+}
@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mohammedrefaat/hamber/billing"
+)
+
+// ========== SUBSCRIPTION RENEWALS ==========
+
+// RenewalJob issues renewal invoices, collects them and runs unpaid
+// subscriptions through dunning and the grace period
+type RenewalJob struct {
+	renewals *billing.Renewals
+}
+
+func NewRenewalJob(renewals *billing.Renewals) *RenewalJob {
+	return &RenewalJob{renewals: renewals}
+}
+
+// Run performs a single billing pass
+func (j *RenewalJob) Run() {
+	summary, err := j.renewals.Run(context.Background(), time.Now())
+	if err != nil {
+		log.Printf("Renewals: %v", err)
+	}
+	if summary.InvoicesIssued+summary.PaymentsRequested+summary.PaymentsFailed+summary.FreeRenewed+
+		summary.Cancelled+summary.GraceStarted+summary.Suspended+summary.Downgraded > 0 {
+		log.Printf("Renewals: %d invoice(s) issued, %d payment(s) requested, %d failed, %d free renewal(s), %d cancelled, %d past due, %d suspended, %d downgraded",
+			summary.InvoicesIssued, summary.PaymentsRequested, summary.PaymentsFailed, summary.FreeRenewed,
+			summary.Cancelled, summary.GraceStarted, summary.Suspended, summary.Downgraded)
+	}
+}
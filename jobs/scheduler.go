@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ========== BACKGROUND JOB SCHEDULER ==========
+
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	run      func()
+}
+
+// Scheduler runs registered jobs on fixed intervals until stopped
+type Scheduler struct {
+	jobs []scheduledJob
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{stop: make(chan struct{})}
+}
+
+// Every registers a job that runs once per interval. Must be called before Start.
+func (s *Scheduler) Every(name string, interval time.Duration, run func()) {
+	s.jobs = append(s.jobs, scheduledJob{name: name, interval: interval, run: run})
+}
+
+// Start launches one goroutine per registered job
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(job)
+		log.Printf("✓ Background job %q scheduled every %s", job.name, job.interval)
+	}
+}
+
+// Stop signals all jobs to finish and waits for running ones to return
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(job scheduledJob) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.runSafely(job)
+		}
+	}
+}
+
+func (s *Scheduler) runSafely(job scheduledJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("❌ Background job %q panicked: %v\n%s", job.name, r, debug.Stack())
+		}
+	}()
+	job.run()
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mohammedrefaat/hamber/shipping"
+	"github.com/mohammedrefaat/hamber/stores"
+)
+
+// ========== SHIPMENT TRACKING ==========
+
+// shipmentBatchSize caps the shipments tracked per run; the least recently tracked go first
+const shipmentBatchSize = 200
+
+// ShipmentTrackingJob polls carriers for open shipments and notifies customers of progress
+type ShipmentTrackingJob struct {
+	store   *stores.DbStore
+	tracker *shipping.Tracker
+}
+
+func NewShipmentTrackingJob(store *stores.DbStore, tracker *shipping.Tracker) *ShipmentTrackingJob {
+	return &ShipmentTrackingJob{
+		store:   store,
+		tracker: tracker,
+	}
+}
+
+// Run performs a single pass over open shipments
+func (j *ShipmentTrackingJob) Run() {
+	shipments, err := j.store.GetTrackableShipments(shipmentBatchSize)
+	if err != nil {
+		log.Printf("Shipments: %v", err)
+		return
+	}
+
+	updated := 0
+	for i := range shipments {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		added, err := j.tracker.Refresh(ctx, &shipments[i])
+		cancel()
+		if err != nil {
+			log.Printf("Shipments: tracking %s %s failed: %v", shipments[i].Carrier, shipments[i].TrackingNumber, err)
+			continue
+		}
+		if len(added) > 0 {
+			updated++
+		}
+	}
+	if updated > 0 {
+		log.Printf("Shipments: %d of %d shipment(s) had tracking updates", updated, len(shipments))
+	}
+}
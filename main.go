@@ -32,7 +32,7 @@ func main() {
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Println("stacktrace from panic: \n" + string(debug.Stack()))
-			fmt.Errorf("recover %v", r)
+			fmt.Printf("recover %v\n", r)
 		}
 	}()
 	srv, err := services.NewServer()
@@ -0,0 +1,108 @@
+// Package money holds the rounding and conversion rules for monetary amounts.
+// Amounts are decimal.Decimal values with two decimal places (piasters for EGP).
+package money
+
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Scale is the number of decimal places kept for every stored amount
+const Scale = 2
+
+// DefaultCurrency is used when no currency is given
+const DefaultCurrency = "EGP"
+
+// ColumnType is the SQL type used for money columns
+const ColumnType = "numeric(14,2)"
+
+// RateScale is the number of decimal places kept for exchange rates
+const RateScale = 8
+
+var minorFactor = decimal.New(1, Scale)
+
+var hundred = decimal.NewFromInt(100)
+
+func init() {
+	// Keep amounts as JSON numbers so existing API clients are unaffected
+	decimal.MarshalJSONWithoutQuotes = true
+}
+
+// Round rounds to the money scale, half away from zero
+func Round(amount decimal.Decimal) decimal.Decimal {
+	return amount.Round(Scale)
+}
+
+// FromFloat converts a float (e.g. parsed from a gateway callback) to a rounded amount
+func FromFloat(value float64) decimal.Decimal {
+	return Round(decimal.NewFromFloat(value))
+}
+
+// FromMinor converts integer minor units (piasters, cents) to an amount
+func FromMinor(minor int64) decimal.Decimal {
+	return decimal.New(minor, -Scale)
+}
+
+// ToMinor converts an amount to integer minor units, as gateways such as Paymob expect
+func ToMinor(amount decimal.Decimal) int64 {
+	return Round(amount).Mul(minorFactor).IntPart()
+}
+
+// Multiply returns the rounded price of quantity units
+func Multiply(price decimal.Decimal, quantity int) decimal.Decimal {
+	return Round(price.Mul(decimal.NewFromInt(int64(quantity))))
+}
+
+// Percent returns the rounded percentage of an amount
+func Percent(amount decimal.Decimal, percent float64) decimal.Decimal {
+	return Round(amount.Mul(decimal.NewFromFloat(percent)).Div(hundred))
+}
+
+// Sum adds amounts exactly
+func Sum(amounts ...decimal.Decimal) decimal.Decimal {
+	total := decimal.Zero
+	for _, amount := range amounts {
+		total = total.Add(amount)
+	}
+	return total
+}
+
+// Float converts an amount for display-only aggregates and legacy APIs
+func Float(amount decimal.Decimal) float64 {
+	f, _ := amount.Float64()
+	return f
+}
+
+// Format renders an amount with exactly two decimal places, e.g. "1250.50"
+func Format(amount decimal.Decimal) string {
+	return Round(amount).StringFixed(Scale)
+}
+
+// Convert converts an amount with a rate expressed as target units per source unit
+func Convert(amount, rate decimal.Decimal) decimal.Decimal {
+	return Round(amount.Mul(rate))
+}
+
+// InverseRate returns the rate for the opposite direction
+func InverseRate(rate decimal.Decimal) decimal.Decimal {
+	return decimal.NewFromInt(1).DivRound(rate, RateScale)
+}
+
+// NormalizeCurrency upper-cases a currency code, e.g. " usd" -> "USD"
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// IsCurrencyCode reports whether code looks like an ISO 4217 code
+func IsCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
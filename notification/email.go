@@ -0,0 +1,119 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+)
+
+// ========== EMAIL SERVICE ==========
+
+// EmailService sends transactional emails through the configured SMTP server
+type EmailService struct {
+	config config.EmailConfig
+}
+
+func NewEmailService(cfg config.EmailConfig) *EmailService {
+	return &EmailService{config: cfg}
+}
+
+// IsConfigured reports whether enough SMTP settings exist to send mail
+func (s *EmailService) IsConfigured() bool {
+	return s != nil && s.config.SMTPHost != "" && s.config.FromEmail != ""
+}
+
+// Attachment is a file sent along with an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Send delivers an HTML email to a single recipient
+func (s *EmailService) Send(to, subject, htmlBody string) error {
+	return s.SendWithAttachments(to, subject, htmlBody)
+}
+
+// SendWithAttachments delivers an HTML email with files attached
+func (s *EmailService) SendWithAttachments(to, subject, htmlBody string, attachments ...Attachment) error {
+	if !s.IsConfigured() {
+		return errors.New("email service is not configured")
+	}
+	if to == "" {
+		return errors.New("email recipient is empty")
+	}
+
+	from := s.config.FromEmail
+	if s.config.FromName != "" {
+		from = fmt.Sprintf("%s <%s>", mime.QEncoding.Encode("utf-8", s.config.FromName), s.config.FromEmail)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(attachments) == 0 {
+		msg.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n\r\n")
+		msg.WriteString(htmlBody)
+		return s.deliver(to, msg.Bytes())
+	}
+
+	parts := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", parts.Boundary())
+
+	body, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/html; charset=\"utf-8\""},
+	})
+	if err != nil {
+		return err
+	}
+	body.Write([]byte(htmlBody))
+
+	for _, attachment := range attachments {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return err
+		}
+		writeBase64Lines(part, attachment.Data)
+	}
+	if err := parts.Close(); err != nil {
+		return err
+	}
+
+	return s.deliver(to, msg.Bytes())
+}
+
+// writeBase64Lines encodes data in the 76 character lines mail servers expect
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
+
+func (s *EmailService) deliver(to string, msg []byte) error {
+	addr := fmt.Sprintf("%s:%d", s.config.SMTPHost, s.config.SMTPPort)
+
+	var auth smtp.Auth
+	if s.config.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", s.config.SMTPUsername, s.config.SMTPPassword, s.config.SMTPHost)
+	}
+
+	return smtp.SendMail(addr, auth, s.config.FromEmail, []string{to}, msg)
+}
@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
 	"github.com/mohammedrefaat/hamber/stores"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/shopspring/decimal"
 )
 
 // NotificationService handles all notification operations
@@ -197,11 +200,11 @@ func (ns *NotificationService) Close() {
 // Helper functions for common notification scenarios
 
 // NotifyNewOrder sends notification for new order
-func (ns *NotificationService) NotifyNewOrder(userID uint, orderID uint, total float64) error {
+func (ns *NotificationService) NotifyNewOrder(userID uint, orderID uint, total decimal.Decimal, currency string) error {
 	return ns.PublishNotification(NotificationMessage{
 		UserID:  userID,
 		Title:   "New Order Created",
-		Message: fmt.Sprintf("Your order #%d has been created successfully. Total: %.2f EGP", orderID, total),
+		Message: fmt.Sprintf("Your order #%d has been created successfully. Total: %s %s", orderID, money.Format(total), currency),
 		Type:    "success",
 		Link:    fmt.Sprintf("/orders/%d", orderID),
 	})
@@ -219,16 +222,39 @@ func (ns *NotificationService) NotifyOrderStatusChange(userID uint, orderID uint
 }
 
 // NotifyPaymentSuccess sends notification for successful payment
-func (ns *NotificationService) NotifyPaymentSuccess(userID uint, paymentID uint, amount float64) error {
+func (ns *NotificationService) NotifyPaymentSuccess(userID uint, paymentID uint, amount decimal.Decimal, currency string) error {
 	return ns.PublishNotification(NotificationMessage{
 		UserID:  userID,
 		Title:   "Payment Successful",
-		Message: fmt.Sprintf("Your payment of %.2f EGP has been processed successfully", amount),
+		Message: fmt.Sprintf("Your payment of %s %s has been processed successfully", money.Format(amount), currency),
 		Type:    "success",
 		Link:    fmt.Sprintf("/payments/%d", paymentID),
 	})
 }
 
+// NotifyOrderPaid sends notification when a storefront order has been paid
+func (ns *NotificationService) NotifyOrderPaid(userID uint, orderID uint, amount decimal.Decimal, currency string) error {
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   "Order Paid",
+		Message: fmt.Sprintf("Order #%d has been paid. Amount: %s %s", orderID, money.Format(amount), currency),
+		Type:    "success",
+		Link:    fmt.Sprintf("/orders/%d", orderID),
+	})
+}
+
+// NotifyDuplicatePayment tells the payee an order was paid twice and the second
+// payment should be refunded
+func (ns *NotificationService) NotifyDuplicatePayment(userID uint, paymentID uint, orderID uint, amount decimal.Decimal, currency string) error {
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   "Duplicate Payment",
+		Message: fmt.Sprintf("Order #%d was already paid; refund the second payment of %s %s", orderID, money.Format(amount), currency),
+		Type:    "warning",
+		Link:    fmt.Sprintf("/payments/%d", paymentID),
+	})
+}
+
 // NotifyPaymentFailed sends notification for failed payment
 func (ns *NotificationService) NotifyPaymentFailed(userID uint, paymentID uint, reason string) error {
 	return ns.PublishNotification(NotificationMessage{
@@ -240,6 +266,17 @@ func (ns *NotificationService) NotifyPaymentFailed(userID uint, paymentID uint,
 	})
 }
 
+// NotifyPaymentReview tells the payee an offline payment is waiting for review
+func (ns *NotificationService) NotifyPaymentReview(userID uint, paymentID uint, summary string) error {
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   "Payment Awaiting Review",
+		Message: summary + ". Confirm or reject it from the payment review queue",
+		Type:    "info",
+		Link:    fmt.Sprintf("/payments/%d", paymentID),
+	})
+}
+
 // NotifyPackageChange sends notification for package change
 func (ns *NotificationService) NotifyPackageChange(userID uint, oldPackage, newPackage string) error {
 	return ns.PublishNotification(NotificationMessage{
@@ -251,17 +288,48 @@ func (ns *NotificationService) NotifyPackageChange(userID uint, oldPackage, newP
 	})
 }
 
-// NotifyAddonSubscription sends notification for addon subscription
+// NotifySubscriptionBilling sends a renewal, dunning or suspension notice
+func (ns *NotificationService) NotifySubscriptionBilling(userID uint, title, message, notifType string) error {
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   title,
+		Message: message,
+		Type:    notifType,
+		Link:    "/profile/subscription",
+	})
+}
+
+// NotifyAddonSubscription sends notification for addon subscription. A zero
+// expiry date is for usage-based add-ons, which do not expire.
 func (ns *NotificationService) NotifyAddonSubscription(userID uint, addonName string, expiryDate time.Time) error {
+	message := fmt.Sprintf("Your %s add-on has been activated", addonName)
+	if !expiryDate.IsZero() {
+		message += fmt.Sprintf(". Valid until %s", expiryDate.Format("2006-01-02"))
+	}
 	return ns.PublishNotification(NotificationMessage{
 		UserID:  userID,
 		Title:   "Add-on Activated",
-		Message: fmt.Sprintf("Your %s add-on has been activated. Valid until %s", addonName, expiryDate.Format("2006-01-02")),
+		Message: message,
 		Type:    "success",
 		Link:    "/profile/addons",
 	})
 }
 
+// NotifyWalletBalance sends notification for a wallet credit or debit
+func (ns *NotificationService) NotifyWalletBalance(userID uint, entry *dbmodels.WalletTransaction, currency string) error {
+	title, direction, notifType := "Wallet Credited", "added to", "success"
+	if entry.Type == dbmodels.WalletEntryType_DEBIT {
+		title, direction, notifType = "Wallet Debited", "deducted from", "info"
+	}
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   title,
+		Message: fmt.Sprintf("%s %s has been %s your wallet (%s). Balance: %s %s", money.Format(entry.Amount), currency, direction, strings.ToLower(strings.ReplaceAll(entry.Reason.String(), "_", " ")), money.Format(entry.BalanceAfter), currency),
+		Type:    notifType,
+		Link:    "/profile/wallet",
+	})
+}
+
 // NotifyEventReminder sends notification for calendar event reminder
 func (ns *NotificationService) NotifyEventReminder(userID uint, eventTitle string, startTime time.Time) error {
 	return ns.PublishNotification(NotificationMessage{
@@ -317,6 +385,72 @@ func (ns *NotificationService) NotifyNewMessage(userID uint, senderName, message
 	})
 }
 
+// NotifyCartReminder reminds a shopper about items left in their cart
+func (ns *NotificationService) NotifyCartReminder(userID uint, itemCount int, restoreLink string) error {
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   "You left items in your cart",
+		Message: fmt.Sprintf("You have %d item(s) waiting in your cart. Complete your order before they sell out!", itemCount),
+		Type:    "info",
+		Link:    restoreLink,
+	})
+}
+
+// NotifyBackInStock tells a shopper that a wishlisted product is available again
+func (ns *NotificationService) NotifyBackInStock(userID uint, productID uint, productName string) error {
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   "Back in stock",
+		Message: fmt.Sprintf("%s from your wishlist is back in stock", productName),
+		Type:    "success",
+		Link:    fmt.Sprintf("/products/%d", productID),
+	})
+}
+
+// NotifyPriceDrop tells a shopper that a wishlisted product got cheaper
+func (ns *NotificationService) NotifyPriceDrop(userID uint, productID uint, productName string, oldPrice, newPrice decimal.Decimal, currency string) error {
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   "Price drop",
+		Message: fmt.Sprintf("%s from your wishlist dropped from %s to %s %s", productName, money.Format(oldPrice), money.Format(newPrice), currency),
+		Type:    "info",
+		Link:    fmt.Sprintf("/products/%d", productID),
+	})
+}
+
+// NotifyNewReview tells a store owner that a review is waiting for moderation
+func (ns *NotificationService) NotifyNewReview(userID uint, reviewID uint, productName string, rating int) error {
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   "New Product Review",
+		Message: fmt.Sprintf("%s received a %d-star review awaiting moderation", productName, rating),
+		Type:    "info",
+		Link:    fmt.Sprintf("/dashboard/reviews/%d", reviewID),
+	})
+}
+
+// NotifyLowStock warns a store owner that products reached their reorder point
+func (ns *NotificationService) NotifyLowStock(userID uint, productCount int, summary string) error {
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   "Low Stock Alert",
+		Message: fmt.Sprintf("%d product(s) reached their reorder point: %s", productCount, summary),
+		Type:    "warning",
+		Link:    "/dashboard/reorder-suggestions",
+	})
+}
+
+// NotifyShipmentUpdate tells a shopper about the progress of a parcel from their order
+func (ns *NotificationService) NotifyShipmentUpdate(userID uint, orderID uint, carrier, trackingNumber, status string) error {
+	return ns.PublishNotification(NotificationMessage{
+		UserID:  userID,
+		Title:   "Shipment Update",
+		Message: fmt.Sprintf("Your order #%d (%s %s) is now %s", orderID, carrier, trackingNumber, status),
+		Type:    "info",
+		Link:    fmt.Sprintf("/orders/%d/shipments", orderID),
+	})
+}
+
 // NotifyWelcome sends welcome notification to new users
 func (ns *NotificationService) NotifyWelcome(userID uint, userName string) error {
 	return ns.PublishNotification(NotificationMessage{
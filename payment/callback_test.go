@@ -0,0 +1,91 @@
+package payment
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+)
+
+func TestPaymobCallbackSignsStatusFields(t *testing.T) {
+	gateway := NewPaymobGateway(config.PaymobConfig{HMACSecret: "paymob-test-secret"})
+	paid := PaymobTransaction{
+		ID:            192036465,
+		Success:       true,
+		AmountCents:   25000,
+		Currency:      "EGP",
+		CreatedAt:     "2025-10-12T09:30:00.000000",
+		IntegrationID: 4097558,
+		Owner:         302852,
+		SourceData:    PaymobSourceData{Pan: "2346", SubType: "MasterCard", Type: "card"},
+		Order:         PaymobOrderInfo{ID: 217503754, MerchantOrderID: "ORD-1-1760000000-a1b2c3"},
+	}
+	callback := func(txn PaymobTransaction) Callback {
+		body, err := json.Marshal(PaymobCallbackRequest{Type: "TRANSACTION", Object: txn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Callback{Body: body, Query: url.Values{"hmac": {gateway.sign(paid)}}}
+	}
+
+	result, err := gateway.VerifyCallback(callback(paid))
+	if err != nil {
+		t.Fatalf("VerifyCallback: %v", err)
+	}
+	if result.Status != dbmodels.PaymentStatus_PAID || result.GatewayOrderID != "217503754" || result.ReferenceNumber != "" {
+		t.Errorf("verified as %s for order %q, reference %q; want PAID for 217503754 with no unsigned reference",
+			result.Status, result.GatewayOrderID, result.ReferenceNumber)
+	}
+
+	tampered := map[string]func(*PaymobTransaction){
+		"is_refunded": func(txn *PaymobTransaction) { txn.IsRefunded = true },
+		"is_voided":   func(txn *PaymobTransaction) { txn.IsVoided = true },
+		"pending":     func(txn *PaymobTransaction) { txn.Pending = true },
+		"id":          func(txn *PaymobTransaction) { txn.ID++ },
+		"order.id":    func(txn *PaymobTransaction) { txn.Order.ID++ },
+	}
+	for field, tamper := range tampered {
+		txn := paid
+		tamper(&txn)
+		if _, err := gateway.VerifyCallback(callback(txn)); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("callback with %s changed: %v, want ErrInvalidSignature", field, err)
+		}
+	}
+}
+
+func TestFawryCallbackIgnoresUnsignedReference(t *testing.T) {
+	gateway := NewFawryGateway(config.FawryConfig{MerchantCode: "1tSa6uxz2nRbgY+b+cZGyA==", SecurityKey: "fawry-test-key"})
+	request := FawryCallbackRequest{
+		RequestID:      "c72827d084ea4b88949d91dd2db4996e",
+		FawryRefNumber: "9990d0642040",
+		MerchantRefNum: "PKG-1-1760000000-a1b2c3",
+		PaymentAmount:  299.99,
+		OrderStatus:    "PAID",
+	}
+	request.MessageSignature = gateway.sign(gateway.config.MerchantCode, request.FawryRefNumber, "299.99", "PAID", gateway.config.SecurityKey)
+
+	// Pointing a genuine callback at another payment changes nothing it is resolved by
+	request.MerchantRefNum = "ORD-7-1760000000-d4e5f6"
+	request.RequestID = "another-request"
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := gateway.VerifyCallback(Callback{Body: body})
+	if err != nil {
+		t.Fatalf("VerifyCallback: %v", err)
+	}
+	if result.ReferenceNumber != "" || result.GatewayOrderID != request.FawryRefNumber || result.EventID != "9990d0642040-PAID" {
+		t.Errorf("resolved by reference %q, order %q, event %q; want only the signed Fawry reference",
+			result.ReferenceNumber, result.GatewayOrderID, result.EventID)
+	}
+
+	request.OrderStatus = "REFUNDED"
+	body, _ = json.Marshal(request)
+	if _, err := gateway.VerifyCallback(Callback{Body: body}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("callback with the status changed: %v, want ErrInvalidSignature", err)
+	}
+}
@@ -2,26 +2,38 @@ package payment
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	config "github.com/mohammedrefaat/hamber/Config"
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/shopspring/decimal"
 )
 
-// ========== FAWRY PAYMENT SERVICE ==========
+// ========== FAWRY GATEWAY ==========
 
-type FawryService struct {
+// FawryGateway charges with Fawry reference numbers paid at Fawry outlets. Our
+// reference is Fawry's merchantRefNum; Fawry's reference number is kept as the
+// gateway order ID.
+type FawryGateway struct {
 	config config.FawryConfig
+	client *http.Client
 }
 
-func NewFawryService(cfg config.FawryConfig) *FawryService {
-	return &FawryService{config: cfg}
+func NewFawryGateway(cfg config.FawryConfig) *FawryGateway {
+	return &FawryGateway{
+		config: cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
 }
 
 type FawryPaymentRequest struct {
@@ -30,7 +42,7 @@ type FawryPaymentRequest struct {
 	CustomerName   string            `json:"customerName"`
 	CustomerMobile string            `json:"customerMobile"`
 	CustomerEmail  string            `json:"customerEmail"`
-	PaymentAmount  float64           `json:"paymentAmount"`
+	PaymentAmount  decimal.Decimal   `json:"paymentAmount"`
 	CurrencyCode   string            `json:"currencyCode"`
 	PaymentMethod  string            `json:"paymentMethod"`
 	Description    string            `json:"description"`
@@ -40,10 +52,10 @@ type FawryPaymentRequest struct {
 }
 
 type FawryChargeItem struct {
-	ItemID      string  `json:"itemId"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Quantity    int     `json:"quantity"`
+	ItemID      string          `json:"itemId"`
+	Description string          `json:"description"`
+	Price       decimal.Decimal `json:"price"`
+	Quantity    int             `json:"quantity"`
 }
 
 type FawryPaymentResponse struct {
@@ -56,92 +68,196 @@ type FawryPaymentResponse struct {
 	OrderStatus     string  `json:"orderStatus"`
 	PaymentMethod   string  `json:"paymentMethod"`
 	ExpirationTime  int64   `json:"expirationTime"`
+	StatusCode      int     `json:"statusCode"`
+	StatusDesc      string  `json:"statusDescription"`
+}
+
+// FawryCallbackRequest is Fawry's server notification
+type FawryCallbackRequest struct {
+	RequestID        string  `json:"requestId"`
+	FawryRefNumber   string  `json:"fawryRefNumber"`
+	MerchantRefNum   string  `json:"merchantRefNumber"`
+	OrderAmount      float64 `json:"orderAmount"`
+	PaymentAmount    float64 `json:"paymentAmount"`
+	OrderStatus      string  `json:"orderStatus"`
+	PaymentMethod    string  `json:"paymentMethod"`
+	MessageSignature string  `json:"messageSignature"`
 }
 
-// Generate Fawry signature
-func (s *FawryService) generateSignature(merchantRefNum string, amount float64) string {
-	// Signature = SHA256(merchantCode + merchantRefNum + customerEmail + paymentAmount + securityKey)
-	data := fmt.Sprintf("%s%s%.2f%s",
-		s.config.MerchantCode,
-		merchantRefNum,
-		amount,
-		s.config.SecurityKey)
+func (s *FawryGateway) Name() string {
+	return "fawry"
+}
 
+// sign is the hex SHA-256 of the concatenated parts, as Fawry signs requests
+func (s *FawryGateway) sign(parts ...string) string {
+	var data string
+	for _, part := range parts {
+		data += part
+	}
 	hash := sha256.Sum256([]byte(data))
 	return hex.EncodeToString(hash[:])
 }
 
-func (s *FawryService) InitiatePayment(payment *dbmodels.Payment, user *dbmodels.User, pkg *dbmodels.Package) (*FawryPaymentResponse, error) {
-	// Generate unique reference number
-	refNum := fmt.Sprintf("PKG-%d-%d-%d", user.ID, pkg.ID, time.Now().Unix())
+func (s *FawryGateway) Initiate(ctx context.Context, req InitiateRequest) (*InitiateResult, error) {
+	payment := req.Payment
 
-	// Generate signature
-	signature := s.generateSignature(refNum, payment.Amount)
+	chargeItems := make([]FawryChargeItem, 0, len(req.Items))
+	for _, item := range req.Items {
+		chargeItems = append(chargeItems, FawryChargeItem{
+			ItemID:      item.ID,
+			Description: item.Name,
+			Price:       item.Price,
+			Quantity:    item.Quantity,
+		})
+	}
 
-	// Prepare request
 	request := FawryPaymentRequest{
 		MerchantCode:   s.config.MerchantCode,
-		MerchantRefNum: refNum,
-		CustomerName:   user.Name,
-		CustomerMobile: user.Phone,
-		CustomerEmail:  user.Email,
+		MerchantRefNum: req.Reference,
+		CustomerName:   req.Customer.Name,
+		CustomerMobile: req.Customer.Phone,
+		CustomerEmail:  req.Customer.Email,
 		PaymentAmount:  payment.Amount,
-		CurrencyCode:   "EGP",
+		CurrencyCode:   payment.Currency,
 		PaymentMethod:  "PAYATFAWRY", // Or "CARD" for card payments
-		Description:    fmt.Sprintf("Package: %s", pkg.Name),
-		ChargeItems: []FawryChargeItem{
-			{
-				ItemID:      fmt.Sprintf("PKG-%d", pkg.ID),
-				Description: pkg.Name,
-				Price:       payment.Amount,
-				Quantity:    1,
-			},
-		},
-		Signature:     signature,
-		PaymentExpiry: time.Now().Add(24*time.Hour).Unix() * 1000, // 24 hours
-	}
-
-	// Make API request
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return nil, err
+		Description:    req.Description,
+		ChargeItems:    chargeItems,
+		// Signature = SHA256(merchantCode + merchantRefNum + paymentAmount + securityKey)
+		Signature:     s.sign(s.config.MerchantCode, req.Reference, money.Format(payment.Amount), s.config.SecurityKey),
+		PaymentExpiry: req.ExpiresAt.Unix() * 1000,
 	}
 
-	apiURL := fmt.Sprintf("%s/ECommerceWeb/Fawry/payments/charge", s.config.APIURL)
-	resp, err := http.Post(apiURL, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
+	var resp FawryPaymentResponse
+	if err := s.do(ctx, http.MethodPost, "/ECommerceWeb/Fawry/payments/charge", request, &resp); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+	return &InitiateResult{
+		ReferenceNumber: resp.ReferenceNumber,
+		GatewayOrderID:  resp.ReferenceNumber,
+		Message:         "Please pay at any Fawry location using reference number: " + resp.ReferenceNumber,
+	}, nil
+}
+
+func (s *FawryGateway) VerifyCallback(cb Callback) (*CallbackResult, error) {
+	var req FawryCallbackRequest
+	if err := json.Unmarshal(cb.Body, &req); err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("fawry API error: %s", string(body))
+	// Signature = SHA256(merchantCode + referenceNumber + paymentAmount + orderStatus + securityKey)
+	expected := s.sign(s.config.MerchantCode, req.FawryRefNumber, fmt.Sprintf("%.2f", req.PaymentAmount), req.OrderStatus, s.config.SecurityKey)
+	if !hmac.Equal([]byte(req.MessageSignature), []byte(expected)) {
+		return nil, ErrInvalidSignature
 	}
 
-	var fawryResp FawryPaymentResponse
-	if err := json.Unmarshal(body, &fawryResp); err != nil {
+	// merchantRefNum and requestId are not signed: the payment is found by the
+	// signed Fawry reference, and the event is keyed by it and the signed status
+	return &CallbackResult{
+		EventID:        req.FawryRefNumber + "-" + req.OrderStatus,
+		GatewayOrderID: req.FawryRefNumber,
+		TransactionID:  req.FawryRefNumber,
+		Status:         fawryStatus(req.OrderStatus),
+		Amount:         money.FromFloat(req.PaymentAmount),
+	}, nil
+}
+
+func (s *FawryGateway) QueryStatus(ctx context.Context, payment *dbmodels.Payment) (*StatusResult, error) {
+	query := url.Values{
+		"merchantCode":      {s.config.MerchantCode},
+		"merchantRefNumber": {payment.ReferenceNumber},
+		"signature":         {s.sign(s.config.MerchantCode, payment.ReferenceNumber, s.config.SecurityKey)},
+	}
+
+	var resp FawryPaymentResponse
+	if err := s.do(ctx, http.MethodGet, "/ECommerceWeb/Fawry/payments/status/v2?"+query.Encode(), nil, &resp); err != nil {
 		return nil, err
 	}
+	return &StatusResult{
+		Status:        fawryStatus(resp.OrderStatus),
+		TransactionID: resp.ReferenceNumber,
+		Amount:        money.FromFloat(resp.PaymentAmount),
+	}, nil
+}
+
+func (s *FawryGateway) Refund(ctx context.Context, payment *dbmodels.Payment, amount decimal.Decimal, reason string) (*RefundResult, error) {
+	fawryRef := payment.PaymobOrderID
+	if fawryRef == "" {
+		fawryRef = payment.TransactionID
+	}
+	if fawryRef == "" {
+		return nil, ErrNotRefundable
+	}
 
-	return &fawryResp, nil
+	request := map[string]interface{}{
+		"merchantCode":    s.config.MerchantCode,
+		"referenceNumber": fawryRef,
+		"refundAmount":    amount,
+		"reason":          reason,
+		// Signature = SHA256(merchantCode + referenceNumber + refundAmount + reason + securityKey)
+		"signature": s.sign(s.config.MerchantCode, fawryRef, money.Format(amount), reason, s.config.SecurityKey),
+	}
+
+	var resp FawryPaymentResponse
+	if err := s.do(ctx, http.MethodPost, "/ECommerceWeb/Fawry/payments/refund", request, &resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 0 && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fawry refund failed: %s", resp.StatusDesc)
+	}
+	return &RefundResult{RefundID: fawryRef, Amount: amount}, nil
 }
 
-func (s *FawryService) VerifyCallback(signature string, refNum string, amount float64, orderStatus string) bool {
-	// Verify signature: SHA256(merchantCode + referenceNumber + paymentAmount + orderStatus + securityKey)
-	expectedSig := fmt.Sprintf("%s%s%.2f%s%s",
-		s.config.MerchantCode,
-		refNum,
-		amount,
-		orderStatus,
-		s.config.SecurityKey)
+func (s *FawryGateway) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
 
-	hash := sha256.Sum256([]byte(expectedSig))
-	calculatedSig := hex.EncodeToString(hash[:])
+	req, err := http.NewRequestWithContext(ctx, method, s.config.APIURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-	return signature == calculatedSig
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUnknownPayment
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fawry API error: %s", string(data))
+	}
+	return json.Unmarshal(data, out)
+}
+
+// fawryStatus maps a Fawry order status to a payment status
+func fawryStatus(status string) dbmodels.PaymentStatus {
+	switch status {
+	case "PAID":
+		return dbmodels.PaymentStatus_PAID
+	case "FAILED":
+		return dbmodels.PaymentStatus_FAILED
+	case "CANCELED":
+		return dbmodels.PaymentStatus_CANCELLED
+	case "EXPIRED":
+		return dbmodels.PaymentStatus_EXPIRED
+	case "REFUNDED":
+		return dbmodels.PaymentStatus_REFUNDED
+	}
+	return dbmodels.PaymentStatus_PENDING
 }
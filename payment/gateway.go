@@ -0,0 +1,105 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/shopspring/decimal"
+)
+
+// ========== GATEWAY INTERFACE ==========
+
+var (
+	ErrInvalidSignature = errors.New("invalid callback signature")
+	ErrUnknownPayment   = errors.New("payment not found at gateway")
+	ErrNotRefundable    = errors.New("payment cannot be refunded")
+)
+
+// Gateway is a payment provider. Controllers work with gateways only through this
+// interface, so a new provider needs an implementation and a registry entry.
+type Gateway interface {
+	Name() string
+	// Initiate registers a pending payment and tells the customer how to pay
+	Initiate(ctx context.Context, req InitiateRequest) (*InitiateResult, error)
+	// VerifyCallback checks a gateway notification's signature and reads its outcome
+	VerifyCallback(cb Callback) (*CallbackResult, error)
+	// QueryStatus asks the gateway for the current state of a payment
+	QueryStatus(ctx context.Context, payment *dbmodels.Payment) (*StatusResult, error)
+	// Refund returns all or part of a paid payment
+	Refund(ctx context.Context, payment *dbmodels.Payment, amount decimal.Decimal, reason string) (*RefundResult, error)
+}
+
+type Customer struct {
+	Name    string
+	Email   string
+	Phone   string
+	Address string
+}
+
+type Item struct {
+	ID          string
+	Name        string
+	Description string
+	Price       decimal.Decimal
+	Quantity    int
+}
+
+// InitiateRequest describes a pending payment. Payment must already be stored, so
+// its ID and amount are known.
+type InitiateRequest struct {
+	Payment     *dbmodels.Payment
+	Reference   string // Our reference for the gateway, e.g. ORD-12-17
+	Description string
+	Customer    Customer
+	Items       []Item
+	ExpiresAt   time.Time
+	Payee       *TransferAccount // Account an offline transfer goes to; the platform's when nil
+}
+
+// InitiateResult tells the customer how to pay. The IDs are stored on the payment
+// so callbacks and status queries can find it.
+type InitiateResult struct {
+	PaymentURL      string // Hosted payment page, if any
+	ReferenceNumber string // Reference the customer pays with, e.g. at a Fawry outlet
+	GatewayOrderID  string // Gateway's own order ID
+	Message         string
+}
+
+// Callback is a gateway notification as received
+type Callback struct {
+	Body   []byte
+	Query  url.Values
+	Header http.Header
+}
+
+// CallbackResult is a verified notification. Any of the reference, order and
+// transaction IDs may identify the payment, so a gateway reports only the IDs
+// its signature covers. EventID identifies the notification itself and is the
+// same when the gateway redelivers it.
+type CallbackResult struct {
+	EventID         string
+	ReferenceNumber string
+	GatewayOrderID  string
+	TransactionID   string
+	Status          dbmodels.PaymentStatus
+	Amount          decimal.Decimal
+	Currency        string // Empty when the gateway does not report it
+}
+
+type StatusResult struct {
+	Status        dbmodels.PaymentStatus
+	TransactionID string
+	Amount        decimal.Decimal
+}
+
+type RefundResult struct {
+	RefundID string
+	Amount   decimal.Decimal
+}
+
+// initiateMessage is the default instruction for hosted payment pages
+const initiateMessage = "Please complete payment using the provided URL"
@@ -0,0 +1,164 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/shopspring/decimal"
+)
+
+// ========== OFFLINE PAYMENTS ==========
+
+// ErrNoPayeeAccount is returned when a transfer has no account to be paid into
+var ErrNoPayeeAccount = errors.New("no account is set up to receive this payment")
+
+// TransferAccount is where a customer sends a bank transfer or InstaPay payment
+type TransferAccount struct {
+	BankName        string
+	AccountName     string
+	AccountNumber   string // Account number or IBAN
+	InstaPayAddress string
+}
+
+// Accepts reports whether the account can receive payments by the method
+func (a *TransferAccount) Accepts(method string) bool {
+	switch method {
+	case dbmodels.BankTransferPaymentMethod:
+		return a.AccountNumber != ""
+	case dbmodels.InstaPayPaymentMethod:
+		return a.InstaPayAddress != ""
+	}
+	return false
+}
+
+// OfflineGateway is a payment method settled outside any provider: cash on
+// delivery, bank transfer or InstaPay. Initiate only tells the customer how to
+// pay; the payment stays pending until it is confirmed from the review queue,
+// and nothing ever calls back.
+type OfflineGateway struct {
+	method      string
+	account     TransferAccount // Platform account, used when a payment has no payee
+	proofWindow time.Duration
+}
+
+// NewOfflineGateways builds the offline methods enabled in configuration
+func NewOfflineGateways(cfg config.OfflineConfig) []*OfflineGateway {
+	proofWindow, err := time.ParseDuration(cfg.ProofWindow)
+	if err != nil || proofWindow <= 0 {
+		proofWindow = 72 * time.Hour
+	}
+	account := TransferAccount{
+		BankName:        cfg.BankName,
+		AccountName:     cfg.AccountName,
+		AccountNumber:   cfg.AccountNumber,
+		InstaPayAddress: cfg.InstaPayAddress,
+	}
+
+	var gateways []*OfflineGateway
+	for method, enabled := range map[string]bool{
+		dbmodels.CashOnDeliveryPaymentMethod: cfg.CashOnDelivery,
+		dbmodels.BankTransferPaymentMethod:   cfg.BankTransfer,
+		dbmodels.InstaPayPaymentMethod:       cfg.InstaPay,
+	} {
+		if enabled {
+			gateways = append(gateways, &OfflineGateway{method: method, account: account, proofWindow: proofWindow})
+		}
+	}
+	return gateways
+}
+
+func (o *OfflineGateway) Name() string {
+	return o.method
+}
+
+// CashOnDelivery reports whether the payment is collected by the courier
+func (o *OfflineGateway) CashOnDelivery() bool {
+	return o.method == dbmodels.CashOnDeliveryPaymentMethod
+}
+
+// Deadline is when a payment started at from expires without proof. Cash on
+// delivery waits for the courier and does not expire.
+func (o *OfflineGateway) Deadline(from time.Time) *time.Time {
+	if o.CashOnDelivery() {
+		return nil
+	}
+	deadline := from.Add(o.proofWindow)
+	return &deadline
+}
+
+// PlatformAccount reports whether the platform's own account can receive the method
+func (o *OfflineGateway) PlatformAccount() bool {
+	return o.CashOnDelivery() || o.account.Accepts(o.method)
+}
+
+func (o *OfflineGateway) Initiate(ctx context.Context, req InitiateRequest) (*InitiateResult, error) {
+	amount := money.Format(req.Payment.Amount) + " " + req.Payment.Currency
+	result := &InitiateResult{
+		ReferenceNumber: req.Reference,
+		GatewayOrderID:  req.Reference,
+	}
+	if o.CashOnDelivery() {
+		result.Message = fmt.Sprintf("Please pay %s in cash to the courier on delivery", amount)
+		return result, nil
+	}
+
+	account := o.account
+	if req.Payee != nil {
+		account = *req.Payee
+	}
+	if !account.Accepts(o.method) {
+		return nil, ErrNoPayeeAccount
+	}
+
+	var instructions []string
+	if o.method == dbmodels.InstaPayPaymentMethod {
+		instructions = append(instructions, fmt.Sprintf("Send %s by InstaPay to %s", amount, account.InstaPayAddress))
+	} else {
+		to := account.AccountNumber
+		if account.BankName != "" {
+			to += " at " + account.BankName
+		}
+		instructions = append(instructions, fmt.Sprintf("Transfer %s to account %s", amount, to))
+	}
+	if account.AccountName != "" {
+		instructions = append(instructions, "in the name of "+account.AccountName)
+	}
+	instructions = append(instructions, fmt.Sprintf("with reference %s, then upload the proof of payment", req.Reference))
+	if !req.ExpiresAt.IsZero() {
+		instructions = append(instructions, "before "+req.ExpiresAt.Format("2006-01-02 15:04"))
+	}
+	result.Message = strings.Join(instructions, " ")
+	return result, nil
+}
+
+// VerifyCallback always fails: offline payments are confirmed from the review
+// queue, never by a callback
+func (o *OfflineGateway) VerifyCallback(cb Callback) (*CallbackResult, error) {
+	return nil, ErrInvalidSignature
+}
+
+// QueryStatus reports the payment's own status, as there is no one else to ask
+func (o *OfflineGateway) QueryStatus(ctx context.Context, payment *dbmodels.Payment) (*StatusResult, error) {
+	return &StatusResult{
+		Status:        payment.PaymentStatus,
+		TransactionID: payment.TransactionID,
+		Amount:        payment.Amount,
+	}, nil
+}
+
+// Refund records a refund the payee returns by hand, in cash or by transfer
+func (o *OfflineGateway) Refund(ctx context.Context, payment *dbmodels.Payment, amount decimal.Decimal, reason string) (*RefundResult, error) {
+	if payment.PaymentStatus != dbmodels.PaymentStatus_PAID {
+		return nil, ErrNotRefundable
+	}
+	return &RefundResult{
+		RefundID: fmt.Sprintf("MANUAL-%s-%d", payment.ReferenceNumber, time.Now().Unix()),
+		Amount:   amount,
+	}, nil
+}
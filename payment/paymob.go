@@ -1,29 +1,39 @@
-// Create a new file: payment/paymob.go
 package payment
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
 
 	config "github.com/mohammedrefaat/hamber/Config"
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/shopspring/decimal"
 )
 
-// ========== PAYMOB PAYMENT SERVICE ==========
+// ========== PAYMOB GATEWAY ==========
 
-type PaymobService struct {
+// PaymobGateway charges cards through Paymob Accept's hosted iframe. Our reference
+// is the Paymob merchant_order_id; Paymob's order ID is kept as the gateway order ID.
+type PaymobGateway struct {
 	config config.PaymobConfig
+	client *http.Client
 }
 
-func NewPaymobService(cfg config.PaymobConfig) *PaymobService {
-	return &PaymobService{config: cfg}
+func NewPaymobGateway(cfg config.PaymobConfig) *PaymobGateway {
+	return &PaymobGateway{
+		config: cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
 }
 
 type PaymobAuthResponse struct {
@@ -73,154 +83,306 @@ type PaymobPaymentKeyResponse struct {
 	Token string `json:"token"`
 }
 
-func (s *PaymobService) Authenticate() (string, error) {
-	reqBody := map[string]string{
-		"api_key": s.config.APIKey,
-	}
+// PaymobTransaction is the transaction object sent in callbacks and returned by inquiries
+type PaymobTransaction struct {
+	ID                   int64            `json:"id"`
+	Success              flexibleBool     `json:"success"`
+	Pending              flexibleBool     `json:"pending"`
+	IsRefunded           flexibleBool     `json:"is_refunded"`
+	IsVoided             flexibleBool     `json:"is_voided"`
+	IsAuth               flexibleBool     `json:"is_auth"`
+	IsCapture            flexibleBool     `json:"is_capture"`
+	IsStandalonePayment  flexibleBool     `json:"is_standalone_payment"`
+	Is3DSecure           flexibleBool     `json:"is_3d_secure"`
+	HasParentTransaction flexibleBool     `json:"has_parent_transaction"`
+	ErrorOccured         flexibleBool     `json:"error_occured"`
+	AmountCents          int64            `json:"amount_cents"`
+	Currency             string           `json:"currency"`
+	CreatedAt            string           `json:"created_at"`
+	IntegrationID        int64            `json:"integration_id"`
+	Owner                int64            `json:"owner"`
+	SourceData           PaymobSourceData `json:"source_data"`
+	HMAC                 string           `json:"hmac"`
+	Order                PaymobOrderInfo  `json:"order"`
+}
 
-	jsonData, _ := json.Marshal(reqBody)
-	resp, err := http.Post(
-		fmt.Sprintf("%s/auth/tokens", s.config.APIURL),
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+type PaymobSourceData struct {
+	Pan     string `json:"pan"`
+	SubType string `json:"sub_type"`
+	Type    string `json:"type"`
+}
 
-	var authResp PaymobAuthResponse
-	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
-		return "", err
+type PaymobOrderInfo struct {
+	ID              int64  `json:"id"`
+	MerchantOrderID string `json:"merchant_order_id"`
+}
+
+type PaymobCallbackRequest struct {
+	Type   string            `json:"type"`
+	Object PaymobTransaction `json:"obj"`
+}
+
+// flexibleBool accepts Paymob flags sent either as JSON booleans or as strings
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	value, err := strconv.Unquote(string(data))
+	if err != nil {
+		value = string(data)
 	}
+	*b = flexibleBool(value == "true")
+	return nil
+}
 
-	return authResp.Token, nil
+func (s *PaymobGateway) Name() string {
+	return "paymob"
 }
 
-func (s *PaymobService) CreateOrder(authToken string, payment *dbmodels.Payment, pkg *dbmodels.Package) (int, error) {
-	orderReq := PaymobOrderRequest{
-		AuthToken:       authToken,
-		DeliveryNeeded:  "false",
-		AmountCents:     int(payment.Amount * 100), // Convert to cents
-		Currency:        "EGP",
-		MerchantOrderID: fmt.Sprintf("PKG-%d-%d", payment.UserID, time.Now().Unix()),
-		Items: []map[string]interface{}{
-			{
-				"name":         pkg.Name,
-				"amount_cents": int(payment.Amount * 100),
-				"description":  pkg.Description,
-				"quantity":     1,
-			},
-		},
-	}
-
-	jsonData, _ := json.Marshal(orderReq)
-	resp, err := http.Post(
-		fmt.Sprintf("%s/ecommerce/orders", s.config.APIURL),
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+func (s *PaymobGateway) Initiate(ctx context.Context, req InitiateRequest) (*InitiateResult, error) {
+	payment := req.Payment
+
+	// Step 1: Authenticate
+	authToken, err := s.authenticate(ctx)
 	if err != nil {
-		return 0, err
+		return nil, errors.New("failed to authenticate with Paymob")
 	}
-	defer resp.Body.Close()
 
-	var orderResp PaymobOrderResponse
-	if err := json.NewDecoder(resp.Body).Decode(&orderResp); err != nil {
-		return 0, err
+	// Step 2: Create order
+	items := make([]map[string]interface{}, 0, len(req.Items))
+	for _, item := range req.Items {
+		items = append(items, map[string]interface{}{
+			"name":         item.Name,
+			"amount_cents": int(money.ToMinor(item.Price)),
+			"description":  item.Description,
+			"quantity":     item.Quantity,
+		})
 	}
 
-	return orderResp.ID, nil
-}
+	amountCents := int(money.ToMinor(payment.Amount))
+	var order PaymobOrderResponse
+	if err := s.do(ctx, "/ecommerce/orders", PaymobOrderRequest{
+		AuthToken:       authToken,
+		DeliveryNeeded:  "false",
+		AmountCents:     amountCents,
+		Currency:        payment.Currency,
+		MerchantOrderID: req.Reference,
+		Items:           items,
+	}, &order); err != nil {
+		return nil, errors.New("failed to create Paymob order")
+	}
 
-func (s *PaymobService) GetPaymentKey(authToken string, orderID int, payment *dbmodels.Payment, user *dbmodels.User) (string, error) {
+	// Step 3: Get payment key
 	integrationID, _ := strconv.Atoi(s.config.IntegrationID)
-
-	billingData := PaymobBillingData{
-		FirstName:      user.Name,
-		LastName:       user.Name,
-		Email:          user.Email,
-		PhoneNumber:    user.Phone,
-		Apartment:      "NA",
-		Floor:          "NA",
-		Street:         "NA",
-		Building:       "NA",
-		ShippingMethod: "NA",
-		PostalCode:     "NA",
-		City:           "NA",
-		Country:        "EG",
-		State:          "NA",
+	expiration := 3600 // 1 hour
+	if !req.ExpiresAt.IsZero() {
+		if seconds := int(time.Until(req.ExpiresAt).Seconds()); seconds > 0 {
+			expiration = seconds
+		}
 	}
 
-	paymentKeyReq := PaymobPaymentKeyRequest{
+	var key PaymobPaymentKeyResponse
+	if err := s.do(ctx, "/acceptance/payment_keys", PaymobPaymentKeyRequest{
 		AuthToken:     authToken,
-		AmountCents:   int(payment.Amount * 100),
-		Expiration:    3600, // 1 hour
-		OrderID:       strconv.Itoa(orderID),
-		BillingData:   billingData,
-		Currency:      "EGP",
+		AmountCents:   amountCents,
+		Expiration:    expiration,
+		OrderID:       strconv.Itoa(order.ID),
+		BillingData:   billingData(req.Customer),
+		Currency:      payment.Currency,
 		IntegrationID: integrationID,
+	}, &key); err != nil {
+		return nil, errors.New("failed to get payment key")
+	}
+
+	// Return iframe URL with payment key
+	return &InitiateResult{
+		PaymentURL: fmt.Sprintf("https://accept.paymob.com/api/acceptance/iframes/%s?payment_token=%s",
+			s.config.IframeID, key.Token),
+		GatewayOrderID: strconv.Itoa(order.ID),
+		Message:        initiateMessage,
+	}, nil
+}
+
+func (s *PaymobGateway) VerifyCallback(cb Callback) (*CallbackResult, error) {
+	var req PaymobCallbackRequest
+	if err := json.Unmarshal(cb.Body, &req); err != nil {
+		return nil, err
 	}
+	txn := req.Object
 
-	jsonData, _ := json.Marshal(paymentKeyReq)
-	resp, err := http.Post(
-		fmt.Sprintf("%s/acceptance/payment_keys", s.config.APIURL),
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+	// Paymob sends the HMAC as a query parameter; older integrations put it in the body
+	signature := cb.Query.Get("hmac")
+	if signature == "" {
+		signature = txn.HMAC
+	}
+	if signature == "" || !hmac.Equal([]byte(signature), []byte(s.sign(txn))) {
+		return nil, ErrInvalidSignature
+	}
+
+	// A transaction is notified again when its state changes, e.g. pending to paid.
+	// merchant_order_id is not signed, so the payment is found by Paymob's order ID.
+	status := txn.status()
+	return &CallbackResult{
+		EventID:        fmt.Sprintf("%d-%s", txn.ID, status),
+		GatewayOrderID: strconv.FormatInt(txn.Order.ID, 10),
+		TransactionID:  strconv.FormatInt(txn.ID, 10),
+		Status:         status,
+		Amount:         money.FromMinor(txn.AmountCents),
+		Currency:       txn.Currency,
+	}, nil
+}
+
+func (s *PaymobGateway) QueryStatus(ctx context.Context, payment *dbmodels.Payment) (*StatusResult, error) {
+	authToken, err := s.authenticate(ctx)
 	if err != nil {
-		return "", err
+		return nil, errors.New("failed to authenticate with Paymob")
 	}
-	defer resp.Body.Close()
 
-	var keyResp PaymobPaymentKeyResponse
-	if err := json.NewDecoder(resp.Body).Decode(&keyResp); err != nil {
-		return "", err
+	request := map[string]interface{}{"auth_token": authToken}
+	if payment.PaymobOrderID != "" {
+		request["order_id"] = payment.PaymobOrderID
+	} else {
+		request["merchant_order_id"] = payment.ReferenceNumber
 	}
 
-	return keyResp.Token, nil
+	var txn PaymobTransaction
+	if err := s.do(ctx, "/ecommerce/orders/transaction_inquiry", request, &txn); err != nil {
+		return nil, err
+	}
+	if txn.ID == 0 {
+		// No transaction yet: the customer has not paid
+		return &StatusResult{Status: dbmodels.PaymentStatus_PENDING}, nil
+	}
+	return &StatusResult{
+		Status:        txn.status(),
+		TransactionID: strconv.FormatInt(txn.ID, 10),
+		Amount:        money.FromMinor(txn.AmountCents),
+	}, nil
 }
 
-func (s *PaymobService) InitiatePayment(payment *dbmodels.Payment, user *dbmodels.User, pkg *dbmodels.Package) (string, error) {
-	// Step 1: Authenticate
-	authToken, err := s.Authenticate()
+func (s *PaymobGateway) Refund(ctx context.Context, payment *dbmodels.Payment, amount decimal.Decimal, reason string) (*RefundResult, error) {
+	if payment.TransactionID == "" {
+		return nil, ErrNotRefundable
+	}
+
+	authToken, err := s.authenticate(ctx)
 	if err != nil {
-		return "", errors.New("failed to authenticate with Paymob")
+		return nil, errors.New("failed to authenticate with Paymob")
 	}
 
-	// Step 2: Create order
-	orderID, err := s.CreateOrder(authToken, payment, pkg)
+	var txn PaymobTransaction
+	if err := s.do(ctx, "/acceptance/void_refund/refund", map[string]interface{}{
+		"auth_token":     authToken,
+		"transaction_id": payment.TransactionID,
+		"amount_cents":   money.ToMinor(amount),
+	}, &txn); err != nil {
+		return nil, err
+	}
+	if !txn.Success {
+		return nil, errors.New("paymob declined the refund")
+	}
+	return &RefundResult{RefundID: strconv.FormatInt(txn.ID, 10), Amount: amount}, nil
+}
+
+func (s *PaymobGateway) authenticate(ctx context.Context) (string, error) {
+	var auth PaymobAuthResponse
+	if err := s.do(ctx, "/auth/tokens", map[string]string{"api_key": s.config.APIKey}, &auth); err != nil {
+		return "", err
+	}
+	return auth.Token, nil
+}
+
+func (s *PaymobGateway) do(ctx context.Context, path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
 	if err != nil {
-		return "", errors.New("failed to create Paymob order")
+		return err
 	}
 
-	// Step 3: Get payment key
-	paymentKey, err := s.GetPaymentKey(authToken, orderID, payment, user)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.APIURL+path, bytes.NewReader(data))
 	if err != nil {
-		return "", errors.New("failed to get payment key")
+		return err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	// Return iframe URL with payment key
-	iframeURL := fmt.Sprintf("https://accept.paymob.com/api/acceptance/iframes/%s?payment_token=%s",
-		s.config.IframeID, paymentKey)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
-	return iframeURL, nil
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUnknownPayment
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("paymob API error (%d): %s", resp.StatusCode, string(respData))
+	}
+	return json.Unmarshal(respData, out)
 }
 
-func (s *PaymobService) VerifyCallback(hmacFromCallback, amountCents, currency, success, orderId, merchantOrderId string) bool {
-	// Concatenate the callback data
-	concatenatedString := fmt.Sprintf("%s%s%s%s%s",
-		amountCents,
-		currency,
-		success,
-		orderId,
-		merchantOrderId)
+// sign returns Paymob's HMAC-SHA512 of a transaction: the values of its fields
+// in alphabetical order of their keys, concatenated. It covers every field the
+// status, event ID and references are read from.
+func (s *PaymobGateway) sign(t PaymobTransaction) string {
+	data := fmt.Sprintf("%d%s%s%t%t%d%d%t%t%t%t%t%t%d%d%t%s%s%s%t",
+		t.AmountCents,
+		t.CreatedAt,
+		t.Currency,
+		bool(t.ErrorOccured),
+		bool(t.HasParentTransaction),
+		t.ID,
+		t.IntegrationID,
+		bool(t.Is3DSecure),
+		bool(t.IsAuth),
+		bool(t.IsCapture),
+		bool(t.IsRefunded),
+		bool(t.IsStandalonePayment),
+		bool(t.IsVoided),
+		t.Order.ID,
+		t.Owner,
+		bool(t.Pending),
+		t.SourceData.Pan,
+		t.SourceData.SubType,
+		t.SourceData.Type,
+		bool(t.Success))
+	mac := hmac.New(sha512.New, []byte(s.config.HMACSecret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
 
-	// Calculate HMAC
-	hash := sha256.New()
-	hash.Write([]byte(concatenatedString))
-	hash.Write([]byte(s.config.HMACSecret))
-	calculatedHMAC := hex.EncodeToString(hash.Sum(nil))
+// status maps a Paymob transaction to a payment status
+func (t PaymobTransaction) status() dbmodels.PaymentStatus {
+	switch {
+	case bool(t.IsRefunded || t.IsVoided):
+		return dbmodels.PaymentStatus_REFUNDED
+	case bool(t.Pending):
+		return dbmodels.PaymentStatus_PENDING
+	case bool(t.Success):
+		return dbmodels.PaymentStatus_PAID
+	}
+	return dbmodels.PaymentStatus_FAILED
+}
 
-	return hmacFromCallback == calculatedHMAC
+func billingData(customer Customer) PaymobBillingData {
+	data := PaymobBillingData{
+		FirstName:      customer.Name,
+		LastName:       customer.Name,
+		Email:          customer.Email,
+		PhoneNumber:    customer.Phone,
+		Apartment:      "NA",
+		Floor:          "NA",
+		Street:         customer.Address,
+		Building:       "NA",
+		ShippingMethod: "NA",
+		PostalCode:     "NA",
+		City:           "NA",
+		Country:        "EG",
+		State:          "NA",
+	}
+	if data.Street == "" {
+		data.Street = "NA"
+	}
+	return data
 }
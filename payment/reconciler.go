@@ -0,0 +1,193 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/mohammedrefaat/hamber/stores"
+)
+
+// ========== RECONCILIATION ==========
+
+// queryTimeout bounds each status query to a gateway
+const queryTimeout = 30 * time.Second
+
+// ApplyFunc applies a status a gateway reported to a stored payment, completing
+// what it paid for and notifying the user. Controllers provide it, so results
+// found here are handled exactly like callbacks.
+type ApplyFunc func(payment *dbmodels.Payment, status dbmodels.PaymentStatus, transactionID string) (*stores.PaymentTransition, error)
+
+// Reconciler catches up on payments whose callback never arrived, expires the
+// ones nobody paid and compares our records with the gateways'
+type Reconciler struct {
+	gateways *Registry
+	store    *stores.DbStore
+	apply    ApplyFunc
+}
+
+func NewReconciler(gateways *Registry, store *stores.DbStore, apply ApplyFunc) *Reconciler {
+	return &Reconciler{
+		gateways: gateways,
+		store:    store,
+		apply:    apply,
+	}
+}
+
+// PendingSummary counts what one pass over pending payments did
+type PendingSummary struct {
+	Checked int `json:"checked"` // Payments whose gateway was queried
+	Settled int `json:"settled"` // Payments the gateway had settled
+	Expired int `json:"expired"` // Payments past their deadline
+	Failed  int `json:"failed"`  // Payments that could not be queried or updated
+}
+
+// ReconcilePending asks the gateway of each pending payment created before
+// staleBefore for its status and applies it. A payment still pending past its
+// deadline is expired; a success reported later still completes it.
+func (r *Reconciler) ReconcilePending(ctx context.Context, staleBefore time.Time, limit int) (*PendingSummary, error) {
+	payments, err := r.store.GetStalePendingPayments(staleBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &PendingSummary{}
+	for i := range payments {
+		pending := &payments[i]
+
+		if r.gateways.Has(pending.PaymentMethod) {
+			status, err := r.query(ctx, pending)
+			r.store.MarkPaymentChecked(pending.ID, time.Now())
+			switch {
+			case err == nil:
+				summary.Checked++
+				if status.Status != dbmodels.PaymentStatus_PENDING {
+					if _, err := r.apply(pending, status.Status, status.TransactionID); err != nil {
+						log.Printf("Payments: applying %s to payment %d failed: %v", status.Status, pending.ID, err)
+						summary.Failed++
+					} else {
+						summary.Settled++
+					}
+					continue
+				}
+			case errors.Is(err, ErrUnknownPayment):
+				// Never reached the gateway, or the gateway forgot it: nothing to settle
+			default:
+				log.Printf("Payments: status query for payment %d failed: %v", pending.ID, err)
+				summary.Failed++
+			}
+		}
+
+		if pending.ExpiresAt == nil || time.Now().Before(*pending.ExpiresAt) {
+			continue
+		}
+		if _, err := r.apply(pending, dbmodels.PaymentStatus_EXPIRED, ""); err != nil {
+			log.Printf("Payments: expiring payment %d failed: %v", pending.ID, err)
+			summary.Failed++
+			continue
+		}
+		summary.Expired++
+	}
+	return summary, nil
+}
+
+// ReportDay compares the payments created on day (in the server's time zone)
+// with their gateways and stores the mismatches, replacing an earlier report for
+// that day. Payments whose gateway is not enabled are left out.
+func (r *Reconciler) ReportDay(ctx context.Context, day time.Time) (*dbmodels.PaymentReconciliation, error) {
+	year, month, date := day.Date()
+	start := time.Date(year, month, date, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 1)
+
+	payments, err := r.store.GetPaymentsCreatedBetween(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &dbmodels.PaymentReconciliation{
+		ReportDate:  start,
+		PeriodStart: start,
+		PeriodEnd:   end,
+	}
+	for i := range payments {
+		ours := &payments[i]
+		if !r.gateways.Has(ours.PaymentMethod) {
+			continue
+		}
+		report.Checked++
+
+		item := r.compare(ctx, ours)
+		if item == nil {
+			report.Matched++
+			continue
+		}
+		if item.Mismatch == dbmodels.ReconciliationMismatch_QUERY_FAILED {
+			report.Failed++
+		} else {
+			report.Mismatched++
+		}
+		report.Items = append(report.Items, *item)
+	}
+
+	if err := r.store.SavePaymentReconciliation(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// compare returns the mismatch between a payment and its gateway, or nil when
+// they agree. Only settlement matters: a payment we expired that the gateway
+// still shows as unpaid agrees.
+func (r *Reconciler) compare(ctx context.Context, ours *dbmodels.Payment) *dbmodels.PaymentReconciliationItem {
+	item := &dbmodels.PaymentReconciliationItem{
+		PaymentID:       ours.ID,
+		Gateway:         ours.PaymentMethod,
+		ReferenceNumber: ours.ReferenceNumber,
+		OurStatus:       ours.PaymentStatus,
+		OurAmount:       ours.Amount,
+	}
+
+	theirs, err := r.query(ctx, ours)
+	if errors.Is(err, ErrUnknownPayment) {
+		if !ours.PaymentStatus.IsSettled() {
+			return nil
+		}
+		item.Mismatch = dbmodels.ReconciliationMismatch_MISSING
+		item.Note = "Payment is unknown to the gateway"
+		return item
+	}
+	if err != nil {
+		item.Mismatch = dbmodels.ReconciliationMismatch_QUERY_FAILED
+		item.Note = err.Error()
+		return item
+	}
+
+	item.GatewayStatus = theirs.Status
+	item.GatewayAmount = theirs.Amount
+	switch {
+	case ours.PaymentStatus.IsSettled() != theirs.Status.IsSettled(),
+		ours.PaymentStatus.IsSettled() && ours.PaymentStatus != theirs.Status:
+		item.Mismatch = dbmodels.ReconciliationMismatch_STATUS
+		item.Note = fmt.Sprintf("Payment is %s here and %s at the gateway", ours.PaymentStatus, theirs.Status)
+		return item
+	case theirs.Status.IsSettled() && theirs.Amount.IsPositive() && !theirs.Amount.Equal(ours.Amount):
+		item.Mismatch = dbmodels.ReconciliationMismatch_AMOUNT
+		item.Note = fmt.Sprintf("Gateway settled %s, expected %s", money.Format(theirs.Amount), money.Format(ours.Amount))
+		return item
+	}
+	return nil
+}
+
+func (r *Reconciler) query(ctx context.Context, p *dbmodels.Payment) (*StatusResult, error) {
+	gateway, err := r.gateways.Get(p.PaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	return gateway.QueryStatus(ctx, p)
+}
@@ -0,0 +1,150 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== GATEWAY REGISTRY ==========
+
+// Registry holds the gateways enabled in configuration. Payment methods are
+// gateway names, so a new gateway only needs to be registered here.
+type Registry struct {
+	gateways map[string]Gateway
+}
+
+// NewRegistry builds the enabled gateways. The sandbox is only registered when
+// enabled explicitly; it is never a fallback for live gateways.
+func NewRegistry(cfg *config.Config) *Registry {
+	registry := &Registry{gateways: map[string]Gateway{}}
+	if cfg.IsFawryEnabled() {
+		registry.Register(NewFawryGateway(cfg.GetFawryConfig()))
+	}
+	if cfg.IsPaymobEnabled() {
+		registry.Register(NewPaymobGateway(cfg.GetPaymobConfig()))
+	}
+	if sandbox := cfg.GetSandboxConfig(); sandbox.Enabled {
+		registry.Register(NewSandboxGateway(sandbox))
+		log.Printf("⚠️ Payments: sandbox gateway enabled, payments are simulated (outcome %s)", sandbox.Outcome)
+	}
+	for _, offline := range NewOfflineGateways(cfg.GetOfflineConfig()) {
+		registry.Register(offline)
+		if !offline.PlatformAccount() {
+			log.Printf("⚠️ Payments: %s has no platform account, it is only available for store orders", offline.Name())
+		}
+	}
+	if len(registry.gateways) == 0 {
+		log.Printf("⚠️ Payments: no payment gateway enabled")
+	}
+	return registry
+}
+
+func (r *Registry) Register(gateway Gateway) {
+	r.gateways[gateway.Name()] = gateway
+}
+
+func (r *Registry) Get(name string) (Gateway, error) {
+	gateway, ok := r.gateways[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported payment method: %s", name)
+	}
+	return gateway, nil
+}
+
+func (r *Registry) Has(name string) bool {
+	_, ok := r.gateways[name]
+	return ok
+}
+
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.gateways))
+	for name := range r.gateways {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Offline returns the gateway of an offline payment method
+func (r *Registry) Offline(name string) (*OfflineGateway, bool) {
+	offline, ok := r.gateways[name].(*OfflineGateway)
+	return offline, ok
+}
+
+// IsOffline reports whether a payment method is settled by hand rather than by a gateway
+func (r *Registry) IsOffline(name string) bool {
+	_, ok := r.Offline(name)
+	return ok
+}
+
+// Sandbox returns the sandbox gateway when it is enabled
+func (r *Registry) Sandbox() (*SandboxGateway, bool) {
+	sandbox, ok := r.gateways["sandbox"].(*SandboxGateway)
+	return sandbox, ok
+}
+
+// Start registers a stored pending payment with its gateway and records the
+// gateway's order ID, so callbacks and status queries can find it. A payment the
+// gateway rejects is marked FAILED. An offline payment is put in the review
+// queue instead, with the deadline for its proof as ExpiresAt. Errors are
+// *stores.CustomError.
+func (r *Registry) Start(ctx context.Context, store *stores.DbStore, p *dbmodels.Payment, req InitiateRequest) (*InitiateResult, error) {
+	gateway, err := r.Get(p.PaymentMethod)
+	if err != nil {
+		return nil, &stores.CustomError{Message: "Unsupported payment method", Code: http.StatusBadRequest}
+	}
+
+	offline, isOffline := gateway.(*OfflineGateway)
+	if isOffline {
+		// Transfers wait for proof only so long; cash on delivery waits for the courier
+		p.ExpiresAt = offline.Deadline(time.Now())
+	}
+
+	req.Payment = p
+	req.Reference = p.ReferenceNumber
+	if p.ExpiresAt != nil {
+		req.ExpiresAt = *p.ExpiresAt
+	}
+
+	result, err := gateway.Initiate(ctx, req)
+	if err != nil {
+		store.UpdatePaymentStatus(p.ID, dbmodels.PaymentStatus_FAILED, "")
+		code := http.StatusInternalServerError
+		if errors.Is(err, ErrNoPayeeAccount) {
+			code = http.StatusBadRequest
+		}
+		return nil, &stores.CustomError{
+			Message: fmt.Sprintf("Failed to initiate %s payment: %v", gateway.Name(), err),
+			Code:    code,
+		}
+	}
+
+	p.PaymobOrderID = result.GatewayOrderID
+	if isOffline {
+		if err := store.StartOfflinePayment(p, offline.CashOnDelivery()); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	// Only this column is written, so a callback that already arrived is not undone
+	if err := store.SetPaymentGatewayOrderID(p.ID, result.GatewayOrderID); err != nil {
+		return nil, &stores.CustomError{Message: "Failed to update payment record", Code: http.StatusInternalServerError}
+	}
+	return result, nil
+}
+
+// NewReference returns a unique merchant reference for a payment, e.g. ORD-12-1718000000-a1b2c3
+func NewReference(prefix string) string {
+	return fmt.Sprintf("%s-%d-%s", prefix, time.Now().Unix(), utils.GenerateToken(3))
+}
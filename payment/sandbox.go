@@ -0,0 +1,270 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/shopspring/decimal"
+)
+
+// ========== SANDBOX GATEWAY ==========
+
+// Sandbox outcomes. A pending payment never calls back, like a customer who
+// walks away, so expiry can be exercised too.
+const (
+	SandboxOutcomeSuccess = "success"
+	SandboxOutcomeFailure = "failure"
+	SandboxOutcomePending = "pending"
+)
+
+// SandboxSignatureHeader carries the HMAC-SHA256 of a simulated callback body
+const SandboxSignatureHeader = "X-Sandbox-Signature"
+
+// SandboxGateway simulates a hosted payment page in memory, for development and
+// tests. The checkout page (or AutoComplete) posts a signed callback to
+// CallbackURL after Delay, so the whole payment flow runs without a merchant account.
+type SandboxGateway struct {
+	config config.SandboxConfig
+	delay  time.Duration
+	client *http.Client
+
+	mu       sync.Mutex
+	seq      int
+	payments map[string]*SandboxPayment
+}
+
+// SandboxPayment is a simulated payment, keyed by our reference
+type SandboxPayment struct {
+	Reference      string
+	GatewayOrderID string
+	TransactionID  string
+	Description    string
+	Amount         decimal.Decimal
+	Currency       string
+	Status         dbmodels.PaymentStatus
+	Refunded       decimal.Decimal
+	CreatedAt      time.Time
+}
+
+// SandboxCallback is the body of a simulated callback
+type SandboxCallback struct {
+	EventID        string          `json:"event_id"`
+	Reference      string          `json:"reference"`
+	GatewayOrderID string          `json:"gateway_order_id"`
+	TransactionID  string          `json:"transaction_id"`
+	Status         string          `json:"status"`
+	Amount         decimal.Decimal `json:"amount"`
+	Currency       string          `json:"currency"`
+}
+
+func NewSandboxGateway(cfg config.SandboxConfig) *SandboxGateway {
+	delay, err := time.ParseDuration(cfg.Delay)
+	if err != nil || delay < 0 {
+		delay = 0
+	}
+	return &SandboxGateway{
+		config:   cfg,
+		delay:    delay,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		payments: map[string]*SandboxPayment{},
+	}
+}
+
+func (s *SandboxGateway) Name() string {
+	return "sandbox"
+}
+
+func (s *SandboxGateway) Initiate(ctx context.Context, req InitiateRequest) (*InitiateResult, error) {
+	s.mu.Lock()
+	s.seq++
+	sandboxPayment := &SandboxPayment{
+		Reference:      req.Reference,
+		GatewayOrderID: fmt.Sprintf("SBX%d%04d", time.Now().Unix(), s.seq),
+		Description:    req.Description,
+		Amount:         req.Payment.Amount,
+		Currency:       req.Payment.Currency,
+		Status:         dbmodels.PaymentStatus_PENDING,
+		CreatedAt:      time.Now(),
+	}
+	s.payments[req.Reference] = sandboxPayment
+	s.mu.Unlock()
+
+	if s.config.AutoComplete {
+		if err := s.Complete(req.Reference, s.config.Outcome); err != nil {
+			return nil, err
+		}
+	}
+
+	return &InitiateResult{
+		PaymentURL:     s.config.CheckoutURL + "/" + url.PathEscape(req.Reference),
+		GatewayOrderID: sandboxPayment.GatewayOrderID,
+		Message:        initiateMessage,
+	}, nil
+}
+
+// Lookup returns a copy of a simulated payment, for the checkout page
+func (s *SandboxGateway) Lookup(reference string) (*SandboxPayment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sandboxPayment, ok := s.payments[reference]
+	if !ok {
+		return nil, ErrUnknownPayment
+	}
+	found := *sandboxPayment
+	return &found, nil
+}
+
+// Complete settles a pending payment with the given outcome and, unless it stays
+// pending, posts the signed callback after the configured delay.
+func (s *SandboxGateway) Complete(reference, outcome string) error {
+	var status dbmodels.PaymentStatus
+	switch outcome {
+	case SandboxOutcomeSuccess:
+		status = dbmodels.PaymentStatus_PAID
+	case SandboxOutcomeFailure:
+		status = dbmodels.PaymentStatus_FAILED
+	case SandboxOutcomePending:
+		return nil
+	default:
+		return fmt.Errorf("unknown sandbox outcome: %s", outcome)
+	}
+
+	s.mu.Lock()
+	sandboxPayment, ok := s.payments[reference]
+	if !ok {
+		s.mu.Unlock()
+		return ErrUnknownPayment
+	}
+	if sandboxPayment.Status != dbmodels.PaymentStatus_PENDING {
+		s.mu.Unlock()
+		return fmt.Errorf("sandbox payment is already %s", sandboxPayment.Status)
+	}
+	sandboxPayment.Status = status
+	sandboxPayment.TransactionID = fmt.Sprintf("%s-TX", sandboxPayment.GatewayOrderID)
+	callback := SandboxCallback{
+		EventID:        sandboxPayment.TransactionID + "-" + status.String(),
+		Reference:      sandboxPayment.Reference,
+		GatewayOrderID: sandboxPayment.GatewayOrderID,
+		TransactionID:  sandboxPayment.TransactionID,
+		Status:         status.String(),
+		Amount:         sandboxPayment.Amount,
+		Currency:       sandboxPayment.Currency,
+	}
+	s.mu.Unlock()
+
+	go func() {
+		time.Sleep(s.delay)
+		if err := s.sendCallback(callback); err != nil {
+			log.Printf("⚠️ Sandbox: callback for %s failed: %v", callback.Reference, err)
+		}
+	}()
+	return nil
+}
+
+func (s *SandboxGateway) sendCallback(callback SandboxCallback) error {
+	body, err := json.Marshal(callback)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.config.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SandboxSignatureHeader, s.Sign(body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("callback returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of a callback body
+func (s *SandboxGateway) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *SandboxGateway) VerifyCallback(cb Callback) (*CallbackResult, error) {
+	signature := cb.Header.Get(SandboxSignatureHeader)
+	if signature == "" || !hmac.Equal([]byte(signature), []byte(s.Sign(cb.Body))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var callback SandboxCallback
+	if err := json.Unmarshal(cb.Body, &callback); err != nil {
+		return nil, err
+	}
+	status, ok := dbmodels.PaymentStatus_value[callback.Status]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment status: %s", callback.Status)
+	}
+
+	return &CallbackResult{
+		EventID:         callback.EventID,
+		ReferenceNumber: callback.Reference,
+		GatewayOrderID:  callback.GatewayOrderID,
+		TransactionID:   callback.TransactionID,
+		Status:          dbmodels.PaymentStatus(status),
+		Amount:          callback.Amount,
+		Currency:        callback.Currency,
+	}, nil
+}
+
+func (s *SandboxGateway) QueryStatus(ctx context.Context, payment *dbmodels.Payment) (*StatusResult, error) {
+	sandboxPayment, err := s.Lookup(payment.ReferenceNumber)
+	if err != nil {
+		return nil, err
+	}
+	return &StatusResult{
+		Status:        sandboxPayment.Status,
+		TransactionID: sandboxPayment.TransactionID,
+		Amount:        sandboxPayment.Amount,
+	}, nil
+}
+
+func (s *SandboxGateway) Refund(ctx context.Context, payment *dbmodels.Payment, amount decimal.Decimal, reason string) (*RefundResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sandboxPayment, ok := s.payments[payment.ReferenceNumber]
+	if !ok {
+		return nil, ErrUnknownPayment
+	}
+	if sandboxPayment.Status != dbmodels.PaymentStatus_PAID {
+		return nil, ErrNotRefundable
+	}
+	remaining := sandboxPayment.Amount.Sub(sandboxPayment.Refunded)
+	if !amount.IsPositive() || amount.GreaterThan(remaining) {
+		return nil, fmt.Errorf("refund amount must be between 0 and %s", money.Format(remaining))
+	}
+
+	sandboxPayment.Refunded = sandboxPayment.Refunded.Add(amount)
+	if sandboxPayment.Refunded.Equal(sandboxPayment.Amount) {
+		sandboxPayment.Status = dbmodels.PaymentStatus_REFUNDED
+	}
+	return &RefundResult{
+		RefundID: fmt.Sprintf("%s-RF%d", sandboxPayment.GatewayOrderID, time.Now().UnixNano()),
+		Amount:   amount,
+	}, nil
+}
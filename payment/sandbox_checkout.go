@@ -0,0 +1,69 @@
+package payment
+
+import (
+	"html/template"
+	"io"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+)
+
+// ========== SANDBOX CHECKOUT PAGE ==========
+
+type sandboxCheckoutPage struct {
+	Payment *SandboxPayment
+	Amount  string
+	Pending bool
+	Message string
+}
+
+var sandboxCheckoutTemplate = template.Must(template.New("sandbox-checkout").Parse(sandboxCheckoutHTML))
+
+// RenderSandboxCheckout writes the simulated hosted payment page. The buttons post
+// the chosen outcome back to the same URL; message reports the last action.
+func RenderSandboxCheckout(out io.Writer, sandboxPayment *SandboxPayment, message string) error {
+	return sandboxCheckoutTemplate.Execute(out, sandboxCheckoutPage{
+		Payment: sandboxPayment,
+		Amount:  money.Format(sandboxPayment.Amount) + " " + sandboxPayment.Currency,
+		Pending: sandboxPayment.Status == dbmodels.PaymentStatus_PENDING,
+		Message: message,
+	})
+}
+
+const sandboxCheckoutHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Sandbox checkout</title>
+    <style>
+        body { font-family: Arial, Tahoma, sans-serif; max-width: 480px; margin: 40px auto; padding: 0 16px; color: #333; }
+        h1 { font-size: 20px; }
+        .notice { background: #fff4e5; color: #8a5300; padding: 10px; border-radius: 6px; font-size: 13px; }
+        .message { background: #e8f0fe; padding: 10px; border-radius: 6px; margin: 16px 0; }
+        table { width: 100%; border-collapse: collapse; margin: 16px 0; }
+        td { padding: 8px 0; border-bottom: 1px solid #eee; }
+        td:first-child { color: #777; }
+        form { display: inline-block; margin-right: 8px; }
+        button { padding: 10px 18px; border: 0; border-radius: 6px; color: #fff; cursor: pointer; }
+        .success { background: #1e7e34; }
+        .failure { background: #b3261e; }
+    </style>
+</head>
+<body>
+    <h1>Sandbox checkout</h1>
+    <p class="notice">This is a simulated payment page. No money is charged.</p>
+    {{if .Message}}<p class="message">{{.Message}}</p>{{end}}
+    <table>
+        <tr><td>Reference</td><td>{{.Payment.Reference}}</td></tr>
+        <tr><td>Description</td><td>{{.Payment.Description}}</td></tr>
+        <tr><td>Amount</td><td>{{.Amount}}</td></tr>
+        <tr><td>Status</td><td>{{.Payment.Status}}</td></tr>
+    </table>
+    {{if .Pending}}
+    <form method="post"><input type="hidden" name="outcome" value="success"><button class="success" type="submit">Pay</button></form>
+    <form method="post"><input type="hidden" name="outcome" value="failure"><button class="failure" type="submit">Decline</button></form>
+    {{end}}
+</body>
+</html>
+`
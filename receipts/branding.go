@@ -0,0 +1,100 @@
+package receipts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ========== BRANDING ==========
+
+// Branding is the store identity printed on a receipt. A copy is kept on each
+// receipt (OrderReceipt.CompanyInfo) so later changes do not alter issued receipts.
+type Branding struct {
+	Name         string `json:"name"`
+	Address      string `json:"address"`
+	Phone        string `json:"phone"`
+	Email        string `json:"email"`
+	Website      string `json:"website"`
+	Logo         string `json:"logo"` // MinIO object name
+	TaxID        string `json:"tax_id"`
+	PrimaryColor string `json:"primary_color,omitempty"`
+	AccentColor  string `json:"accent_color,omitempty"`
+	FooterText   string `json:"footer_text,omitempty"`
+	ReturnPolicy string `json:"return_policy,omitempty"`
+}
+
+// Override replaces the fields that are set in other
+func (b Branding) Override(other Branding) Branding {
+	set := func(field *string, value string) {
+		if value != "" {
+			*field = value
+		}
+	}
+	set(&b.Name, other.Name)
+	set(&b.Address, other.Address)
+	set(&b.Phone, other.Phone)
+	set(&b.Email, other.Email)
+	set(&b.Website, other.Website)
+	set(&b.Logo, other.Logo)
+	set(&b.TaxID, other.TaxID)
+	set(&b.PrimaryColor, other.PrimaryColor)
+	set(&b.AccentColor, other.AccentColor)
+	set(&b.FooterText, other.FooterText)
+	set(&b.ReturnPolicy, other.ReturnPolicy)
+	return b
+}
+
+// Colours used when a store has not chosen its own
+var (
+	DefaultPrimaryColor = Color{R: 34, G: 34, B: 34}
+	DefaultAccentColor  = Color{R: 200, G: 200, B: 200}
+)
+
+type Color struct {
+	R, G, B int
+}
+
+// ParseColor reads a #RRGGBB colour
+func ParseColor(hex string) (Color, bool) {
+	hex = strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(hex) != 6 {
+		return Color{}, false
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return Color{}, false
+	}
+	return Color{R: int(value >> 16), G: int(value >> 8 & 0xFF), B: int(value & 0xFF)}, true
+}
+
+// IsValidColor reports whether hex is empty (use the default) or a #RRGGBB colour
+func IsValidColor(hex string) bool {
+	if hex == "" {
+		return true
+	}
+	_, ok := ParseColor(hex)
+	return ok
+}
+
+func colorOr(hex string, fallback Color) Color {
+	if color, ok := ParseColor(hex); ok {
+		return color
+	}
+	return fallback
+}
+
+func (c Color) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// IsDark reports whether white text reads better than black on the colour
+func (c Color) IsDark() bool {
+	return 299*c.R+587*c.G+114*c.B < 128000
+}
+
+// Image is a decoded logo ready for the PDF renderer
+type Image struct {
+	Data []byte
+	Type string // PNG, JPG or GIF
+}
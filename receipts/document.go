@@ -0,0 +1,225 @@
+package receipts
+
+import (
+	"strings"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/i18n"
+	"github.com/mohammedrefaat/hamber/money"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// ========== DOCUMENT ==========
+
+// Build turns an order into a Document, which is the single definition of what a
+// receipt shows and in which order. RenderHTML and RenderPDF only draw it.
+
+type BlockKind string
+
+const (
+	BlockFields BlockKind = "fields" // Label and value pairs
+	BlockItems  BlockKind = "items"  // Order lines
+	BlockTotals BlockKind = "totals" // Amounts aligned to the trailing side
+	BlockText   BlockKind = "text"   // Free text such as notes
+)
+
+type Field struct {
+	Label  string
+	Value  string
+	Strong bool
+}
+
+type ItemLine struct {
+	Name     string
+	Quantity string
+	Price    string
+	Total    string
+}
+
+type Block struct {
+	Kind    BlockKind
+	Heading string
+	Columns int // Fields side by side, 1 or 2
+	Fields  []Field
+	Header  [4]string // Item table columns: product, quantity, price, total
+	Items   []ItemLine
+	Text    string
+}
+
+// Document is a receipt with every text localized and formatted
+type Document struct {
+	Layout     Layout
+	Locale     i18n.Locale
+	Company    string
+	Contact    []string // Lines under the company name
+	Title      string
+	Blocks     []Block
+	Footer     []string
+	PrintLabel string
+	Primary    Color
+	Accent     Color
+	Logo       *Image   // Drawn on PDFs
+	LogoURL    string   // Linked from HTML
+	VerifyURL  string   // Public page that confirms the receipt is genuine
+	VerifyText string   // Caption under the QR code
+	QR         [][]bool // QR code of VerifyURL without its quiet zone; true is dark
+}
+
+// Data is what a receipt is built from. Order must be loaded with its items and client.
+type Data struct {
+	Order     *dbmodels.Order
+	Branding  Branding
+	Layout    Layout
+	Locale    i18n.Locale
+	Number    string // Empty before the receipt is generated
+	IssuedAt  time.Time
+	Logo      *Image
+	LogoURL   string
+	VerifyURL string // Encoded as a QR code; empty before the receipt is generated
+}
+
+// Build lays out the receipt for data.Layout in data.Locale
+func Build(data Data) *Document {
+	locale, order, branding, layout := data.Locale, data.Order, data.Branding, data.Layout
+	t := locale.T
+
+	doc := &Document{
+		Layout:     layout,
+		Locale:     locale,
+		Company:    branding.Name,
+		Title:      t("receipt.title"),
+		PrintLabel: t("receipt.print"),
+		Primary:    colorOr(branding.PrimaryColor, DefaultPrimaryColor),
+		Accent:     colorOr(branding.AccentColor, DefaultAccentColor),
+		Logo:       data.Logo,
+		LogoURL:    data.LogoURL,
+	}
+
+	// Store details, two to a line on A4 and one per line on roll paper
+	columns := 2
+	if layout.Thermal {
+		columns = 1
+	}
+	if branding.Address != "" {
+		doc.Contact = append(doc.Contact, branding.Address)
+	}
+	var contact []string
+	for _, field := range []Field{
+		{Label: t("receipt.phone"), Value: locale.Digits(branding.Phone)},
+		{Label: t("receipt.email"), Value: branding.Email},
+		{Label: t("receipt.website"), Value: branding.Website},
+		{Label: t("receipt.tax_id"), Value: locale.Digits(branding.TaxID)},
+	} {
+		if field.Value != "" {
+			contact = append(contact, field.Label+": "+field.Value)
+		}
+	}
+	for i := 0; i < len(contact); i += columns {
+		end := i + columns
+		if end > len(contact) {
+			end = len(contact)
+		}
+		doc.Contact = append(doc.Contact, strings.Join(contact[i:end], " | "))
+	}
+
+	number := t("receipt.not_available")
+	if data.Number != "" {
+		number = locale.Digits(data.Number)
+	}
+	doc.Blocks = append(doc.Blocks, Block{
+		Kind:    BlockFields,
+		Columns: columns,
+		Fields: []Field{
+			{Label: t("receipt.number"), Value: number},
+			{Label: t("receipt.date"), Value: locale.Date(data.IssuedAt)},
+			{Label: t("receipt.order_id"), Value: "#" + locale.Number(int(order.ID))},
+			{Label: t("receipt.order_date"), Value: locale.Date(order.CreatedAt)},
+		},
+	})
+
+	doc.Blocks = append(doc.Blocks, Block{
+		Kind:    BlockFields,
+		Heading: t("receipt.customer"),
+		Columns: 1,
+		Fields: nonEmpty(
+			Field{Label: t("receipt.name"), Value: order.Client.Name},
+			Field{Label: t("receipt.email"), Value: order.Client.Email},
+			Field{Label: t("receipt.phone"), Value: locale.Digits(order.Phone)},
+			Field{Label: t("receipt.address"), Value: order.Address},
+		),
+	})
+
+	items := Block{
+		Kind:    BlockItems,
+		Heading: t("receipt.items"),
+		Header:  [4]string{t("receipt.product"), t("receipt.quantity"), t("receipt.price"), t("receipt.total")},
+	}
+	for _, item := range order.Items {
+		items.Items = append(items.Items, ItemLine{
+			Name:     item.Product.Name,
+			Quantity: locale.Number(item.Quantity),
+			Price:    locale.Money(item.Price, order.Currency),
+			Total:    locale.Money(money.Multiply(item.Price, item.Quantity), order.Currency),
+		})
+	}
+	doc.Blocks = append(doc.Blocks, items)
+
+	totals := Block{Kind: BlockTotals}
+	if order.Discount.IsPositive() {
+		totals.Fields = append(totals.Fields, Field{Label: t("receipt.discount"), Value: "-" + locale.Money(order.Discount, order.Currency)})
+	}
+	totals.Fields = append(totals.Fields, Field{Label: t("receipt.total_amount"), Value: locale.Money(order.Total, order.Currency), Strong: true})
+	doc.Blocks = append(doc.Blocks, totals)
+
+	if order.PaymentStatus != "" {
+		paymentDate := ""
+		if order.PaymentDate != nil {
+			paymentDate = locale.Date(*order.PaymentDate)
+		}
+		doc.Blocks = append(doc.Blocks, Block{
+			Kind:    BlockFields,
+			Heading: t("receipt.payment"),
+			Columns: 1,
+			Fields: nonEmpty(
+				Field{Label: t("receipt.payment_status"), Value: t(order.PaymentStatus)},
+				Field{Label: t("receipt.payment_method"), Value: order.PaymentMethodDesc},
+				Field{Label: t("receipt.payment_date"), Value: paymentDate},
+				Field{Label: t("receipt.reference"), Value: order.PaymentRef},
+			),
+		})
+	}
+
+	if order.Notes != "" {
+		doc.Blocks = append(doc.Blocks, Block{Kind: BlockText, Heading: t("receipt.notes"), Text: order.Notes})
+	}
+	if branding.ReturnPolicy != "" {
+		doc.Blocks = append(doc.Blocks, Block{Kind: BlockText, Heading: t("receipt.return_policy"), Text: branding.ReturnPolicy})
+	}
+
+	if data.VerifyURL != "" {
+		if code, err := qrcode.New(data.VerifyURL, qrcode.Medium); err == nil {
+			code.DisableBorder = true
+			doc.QR = code.Bitmap()
+			doc.VerifyURL = data.VerifyURL
+			doc.VerifyText = t("receipt.scan_to_verify")
+		}
+	}
+
+	if branding.FooterText != "" {
+		doc.Footer = append(doc.Footer, branding.FooterText)
+	}
+	doc.Footer = append(doc.Footer, t("receipt.thanks"), t("receipt.computer_generated"))
+
+	return doc
+}
+
+func nonEmpty(fields ...Field) []Field {
+	var kept []Field
+	for _, field := range fields {
+		if field.Value != "" {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
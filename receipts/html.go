@@ -0,0 +1,206 @@
+package receipts
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// ========== HTML ==========
+
+var htmlTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	// Colours and sizes come from ParseColor and the layout table, never from user input
+	"css": func(value string) template.CSS { return template.CSS(value) },
+	"mm":  func(value float64) template.CSS { return template.CSS(fmt.Sprintf("%gmm", value)) },
+	"qr":  qrPath,
+}).Parse(receiptHTML))
+
+// RenderHTML writes the document as a printable page
+func RenderHTML(out io.Writer, doc *Document) error {
+	return htmlTemplate.Execute(out, doc)
+}
+
+const receiptHTML = `<!DOCTYPE html>
+<html lang="{{.Locale.Language}}" dir="{{.Locale.Dir}}">
+<head>
+    <meta charset="UTF-8">
+    <title>{{.Title}}</title>
+    <style>
+        @page {
+            {{if .Layout.Thermal}}size: {{mm .Layout.PageWidth}} auto;{{else}}size: A4;{{end}}
+            margin: {{mm .Layout.PageMargin}};
+        }
+        body {
+            font-family: Arial, "Noto Naskh Arabic", Tahoma, sans-serif;
+            max-width: {{if .Layout.Thermal}}{{mm .Layout.ContentWidth}}{{else}}800px{{end}};
+            margin: 0 auto;
+            padding: {{if .Layout.Thermal}}4px{{else}}20px{{end}};
+            font-size: {{if .Layout.Thermal}}12px{{else}}14px{{end}};
+        }
+        .header {
+            text-align: {{if .Layout.Thermal}}center{{else}}start{{end}};
+            padding: {{if .Layout.Banner}}20px{{else}}0 0 20px{{end}};
+            margin-bottom: 20px;
+            {{if .Layout.Banner}}background: {{css .Primary.Hex}}; color: {{if .Primary.IsDark}}#fff{{else}}#000{{end}};{{else}}border-bottom: 2px solid {{css .Primary.Hex}};{{end}}
+            display: flex;
+            flex-direction: {{if .Layout.Thermal}}column{{else}}row-reverse{{end}};
+            justify-content: space-between;
+            align-items: {{if .Layout.Thermal}}center{{else}}flex-start{{end}};
+            gap: 12px;
+        }
+        .logo {
+            max-width: {{if .Layout.Thermal}}30mm{{else}}35mm{{end}};
+            max-height: {{if .Layout.Thermal}}18mm{{else}}20mm{{end}};
+        }
+        .company-name {
+            font-size: {{if .Layout.Thermal}}16px{{else}}24px{{end}};
+            font-weight: bold;
+            margin-bottom: 10px;
+            {{if not .Layout.Banner}}color: {{css .Primary.Hex}};{{end}}
+        }
+        .receipt-title {
+            font-size: {{if .Layout.Thermal}}15px{{else}}20px{{end}};
+            font-weight: bold;
+            text-align: center;
+            margin: {{if .Layout.Thermal}}8px{{else}}20px{{end}} 0;
+            color: {{css .Primary.Hex}};
+        }
+        .section {
+            margin: {{if .Layout.Thermal}}8px{{else}}20px{{end}} 0;
+            {{if .Layout.Thermal}}padding-bottom: 8px; border-bottom: 1px dashed {{css .Accent.Hex}};{{end}}
+        }
+        .section-title {
+            font-size: {{if .Layout.Thermal}}13px{{else}}16px{{end}};
+            font-weight: bold;
+            margin-bottom: 10px;
+            padding-bottom: 5px;
+            color: {{css .Primary.Hex}};
+            border-bottom: 1px solid {{css .Accent.Hex}};
+        }
+        .fields {
+            display: grid;
+            grid-template-columns: repeat(var(--columns), 1fr);
+            gap: 4px;
+        }
+        table {
+            width: 100%;
+            border-collapse: collapse;
+            margin: 10px 0;
+        }
+        th, td {
+            border: 1px solid #ddd;
+            padding: 8px;
+            text-align: start;
+        }
+        th {
+            background-color: {{css .Accent.Hex}};
+            color: {{if .Accent.IsDark}}#fff{{else}}#000{{end}};
+        }
+        .item-name {
+            font-weight: bold;
+        }
+        .item-line {
+            display: flex;
+            justify-content: space-between;
+            margin-bottom: 6px;
+        }
+        .total {
+            text-align: end;
+            margin-top: 8px;
+        }
+        .total.strong {
+            font-size: {{if .Layout.Thermal}}15px{{else}}18px{{end}};
+            font-weight: bold;
+        }
+        .text {
+            white-space: pre-line;
+        }
+        .footer {
+            text-align: center;
+            margin-top: {{if .Layout.Thermal}}12px{{else}}40px{{end}};
+            padding-top: {{if .Layout.Thermal}}8px{{else}}20px{{end}};
+            border-top: 1px solid {{css .Accent.Hex}};
+            font-size: {{if .Layout.Thermal}}10px{{else}}12px{{end}};
+            color: #666;
+        }
+        .verify {
+            display: inline-block;
+            color: inherit;
+            text-decoration: none;
+        }
+        .verify svg {
+            background: #fff;
+            padding: 8px;
+        }
+        @media print {
+            .no-print {
+                display: none;
+            }
+        }
+    </style>
+</head>
+<body>
+    <div class="header">
+        {{if .LogoURL}}<img class="logo" src="{{.LogoURL}}" alt="">{{end}}
+        <div>
+            <div class="company-name"><bdi>{{.Company}}</bdi></div>
+            {{range .Contact}}<div><bdi>{{.}}</bdi></div>{{end}}
+        </div>
+    </div>
+
+    <div class="receipt-title">{{.Title}}</div>
+
+    {{range .Blocks}}
+    <div class="section">
+        {{if .Heading}}<div class="section-title">{{.Heading}}</div>{{end}}
+        {{if eq .Kind "fields"}}
+        <div class="fields" style="--columns: {{.Columns}}">
+            {{range .Fields}}<div><strong>{{.Label}}:</strong> <bdi>{{.Value}}</bdi></div>{{end}}
+        </div>
+        {{else if eq .Kind "items"}}
+        {{if $.Layout.Thermal}}
+        {{range .Items}}
+        <div class="item-name"><bdi>{{.Name}}</bdi></div>
+        <div class="item-line"><span><bdi>{{.Quantity}}</bdi> × <bdi>{{.Price}}</bdi></span><bdi>{{.Total}}</bdi></div>
+        {{end}}
+        {{else}}
+        <table>
+            <thead>
+                <tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+            </thead>
+            <tbody>
+                {{range .Items}}
+                <tr>
+                    <td><bdi>{{.Name}}</bdi></td>
+                    <td>{{.Quantity}}</td>
+                    <td><bdi>{{.Price}}</bdi></td>
+                    <td><bdi>{{.Total}}</bdi></td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{end}}
+        {{else if eq .Kind "totals"}}
+        {{range .Fields}}<div class="total{{if .Strong}} strong{{end}}">{{.Label}}: <bdi>{{.Value}}</bdi></div>{{end}}
+        {{else if eq .Kind "text"}}
+        <div class="text" dir="auto">{{.Text}}</div>
+        {{end}}
+    </div>
+    {{end}}
+
+    <div class="footer">
+        {{if .QR}}
+        <a class="verify" href="{{.VerifyURL}}">
+            <svg viewBox="0 0 {{len .QR}} {{len .QR}}" width="96" height="96" shape-rendering="crispEdges"><path d="{{qr .QR}}" fill="#000"/></svg>
+            <div>{{.VerifyText}}</div>
+        </a>
+        {{end}}
+        {{range .Footer}}<p dir="auto">{{.}}</p>{{end}}
+    </div>
+
+    <div class="no-print" style="text-align: center; margin-top: 20px;">
+        <button onclick="window.print()">{{.PrintLabel}}</button>
+    </div>
+</body>
+</html>
+`
@@ -0,0 +1,503 @@
+package receipts
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/mohammedrefaat/hamber/i18n"
+)
+
+// ========== PDF ==========
+
+// RenderPDF draws a document with the embedded Unicode font. Arabic is shaped and put
+// in visual order, and right-to-left locales get a mirrored layout. Roll paper is
+// drawn twice: once to measure the content and once on a page cut to fit it.
+func RenderPDF(doc *Document) (*gofpdf.Fpdf, error) {
+	height := doc.Layout.PageHeight
+	if height == 0 {
+		measure := newPDFWriter(doc, 2000)
+		measure.draw()
+		if err := measure.pdf.Error(); err != nil {
+			return nil, err
+		}
+		height = measure.pdf.GetY() + doc.Layout.margin
+	}
+
+	w := newPDFWriter(doc, height)
+	w.draw()
+	return w.pdf, w.pdf.Error()
+}
+
+type pdfWriter struct {
+	pdf    *gofpdf.Fpdf
+	doc    *Document
+	layout Layout
+	width  float64
+}
+
+// pdfColumn is one cell of a table row
+type pdfColumn struct {
+	width float64
+	text  string
+	align string
+}
+
+func newPDFWriter(doc *Document, height float64) *pdfWriter {
+	layout := doc.Layout
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           gofpdf.SizeType{Wd: layout.PageWidth, Ht: height},
+	})
+	pdf.SetMargins(layout.margin, layout.margin, layout.margin)
+	pdf.SetAutoPageBreak(!layout.Thermal, layout.margin)
+	i18n.AddPDFFonts(pdf)
+	pdf.AddPage()
+	return &pdfWriter{pdf: pdf, doc: doc, layout: layout, width: layout.ContentWidth()}
+}
+
+func (w *pdfWriter) draw() {
+	w.header()
+	w.title()
+	for _, block := range w.doc.Blocks {
+		w.block(block)
+	}
+	w.footer()
+}
+
+func (w *pdfWriter) rtl() bool {
+	return w.doc.Locale.IsRTL()
+}
+
+func (w *pdfWriter) font(style string, size float64) {
+	w.pdf.SetFont(i18n.PDFFont, style, size)
+}
+
+func (w *pdfWriter) textColor(color Color) {
+	w.pdf.SetTextColor(color.R, color.G, color.B)
+}
+
+// onColor is black or white, whichever reads better on background
+func (w *pdfWriter) onColor(background Color) {
+	if background.IsDark() {
+		w.pdf.SetTextColor(255, 255, 255)
+		return
+	}
+	w.pdf.SetTextColor(0, 0, 0)
+}
+
+// align mirrors left and right alignment for right-to-left locales; centred layouts
+// centre the header, title and footer
+func (w *pdfWriter) align(align string) string {
+	if !w.rtl() {
+		return align
+	}
+	switch align {
+	case "L", "":
+		return "R"
+	case "R":
+		return "L"
+	}
+	return align
+}
+
+func (w *pdfWriter) leading() string {
+	if w.layout.centered {
+		return "C"
+	}
+	return w.align("L")
+}
+
+// lines wraps text to width and returns each line shaped and in visual order.
+// Wrapping happens before reordering so each line reads correctly on its own.
+func (w *pdfWriter) lines(text string, width float64) []string {
+	maxWidth := width - 2*w.pdf.GetCellMargin()
+	rtl := i18n.StartsRTL(text)
+	var out []string
+	for _, part := range strings.Split(i18n.Shape(text), "\n") {
+		line := ""
+		for _, word := range strings.Fields(part) {
+			if line != "" && w.pdf.GetStringWidth(line+" "+word) > maxWidth {
+				out = append(out, i18n.Reorder(line, rtl))
+				line = word
+				continue
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		out = append(out, i18n.Reorder(line, rtl))
+	}
+	return out
+}
+
+// text writes text over as many lines of the given width as it needs
+func (w *pdfWriter) text(width, h float64, text, align string) {
+	x := w.pdf.GetX()
+	for _, line := range w.lines(text, width) {
+		w.pdf.SetX(x)
+		w.pdf.CellFormat(width, h, line, "", 2, align, false, 0, "")
+	}
+}
+
+// fieldText puts "label: value" in visual order. The value is ordered on its own
+// so an Arabic name reads correctly on an English receipt and the other way round.
+func (w *pdfWriter) fieldText(field Field) string {
+	label := i18n.Visual(field.Label+":", w.rtl())
+	if w.rtl() {
+		return i18n.VisualAuto(field.Value) + " " + label
+	}
+	return label + " " + i18n.VisualAuto(field.Value)
+}
+
+// row writes cells left to right, or right to left for right-to-left locales
+func (w *pdfWriter) row(h float64, columns ...pdfColumn) {
+	if w.rtl() {
+		for i, j := 0, len(columns)-1; i < j; i, j = i+1, j-1 {
+			columns[i], columns[j] = columns[j], columns[i]
+		}
+	}
+	for _, column := range columns {
+		w.pdf.CellFormat(column.width, h, i18n.VisualAuto(column.text), "", 0, w.align(column.align), false, 0, "")
+	}
+	w.pdf.Ln(h)
+}
+
+// tableRow writes a bordered row; cells wrap and the row grows to the tallest cell
+func (w *pdfWriter) tableRow(h float64, fill bool, columns ...pdfColumn) {
+	if w.rtl() {
+		for i, j := 0, len(columns)-1; i < j; i, j = i+1, j-1 {
+			columns[i], columns[j] = columns[j], columns[i]
+		}
+	}
+	cells := make([][]string, len(columns))
+	lines := 1
+	for i, column := range columns {
+		cells[i] = w.lines(column.text, column.width)
+		if len(cells[i]) > lines {
+			lines = len(cells[i])
+		}
+	}
+
+	x, y := w.layout.margin, w.pdf.GetY()
+	if _, pageHeight := w.pdf.GetPageSize(); !w.layout.Thermal && y+h*float64(lines) > pageHeight-w.layout.margin {
+		w.pdf.AddPage()
+		y = w.pdf.GetY()
+	}
+	style := "D"
+	if fill {
+		style = "FD"
+	}
+	for i, column := range columns {
+		w.pdf.Rect(x, y, column.width, h*float64(lines), style)
+		for j, line := range cells[i] {
+			w.pdf.SetXY(x, y+h*float64(j))
+			w.pdf.CellFormat(column.width, h, line, "", 0, w.align(column.align), false, 0, "")
+		}
+		x += column.width
+	}
+	w.pdf.SetXY(w.layout.margin, y+h*float64(lines))
+}
+
+// rule draws a dashed line across the roll, the usual divider on thermal receipts
+func (w *pdfWriter) rule() {
+	y := w.pdf.GetY() + 1
+	w.pdf.SetDrawColor(w.doc.Accent.R, w.doc.Accent.G, w.doc.Accent.B)
+	w.pdf.SetDashPattern([]float64{1, 1}, 0)
+	w.pdf.Line(w.layout.margin, y, w.layout.margin+w.width, y)
+	w.pdf.SetDashPattern([]float64{}, 0)
+	w.pdf.SetDrawColor(0, 0, 0)
+	w.pdf.SetY(y + 2)
+}
+
+// logo registers the store logo and returns its size scaled to fit the box, or
+// false when there is no logo or it cannot be decoded
+func (w *pdfWriter) logo(maxWidth, maxHeight float64) (float64, float64, bool) {
+	if w.doc.Logo == nil {
+		return 0, 0, false
+	}
+	options := gofpdf.ImageOptions{ImageType: w.doc.Logo.Type, ReadDpi: true}
+	info := w.pdf.RegisterImageOptionsReader("logo", options, bytes.NewReader(w.doc.Logo.Data))
+	if w.pdf.Err() || info == nil || info.Width() == 0 || info.Height() == 0 {
+		// A broken logo should not cost the customer their receipt
+		w.pdf.ClearError()
+		return 0, 0, false
+	}
+	width, height := maxWidth, maxWidth*info.Height()/info.Width()
+	if height > maxHeight {
+		width, height = maxHeight*info.Width()/info.Height(), maxHeight
+	}
+	return width, height, true
+}
+
+func (w *pdfWriter) drawLogo(x, y, width, height float64) {
+	options := gofpdf.ImageOptions{ImageType: w.doc.Logo.Type, ReadDpi: true}
+	w.pdf.ImageOptions("logo", x, y, width, height, false, options, 0, "")
+}
+
+func (w *pdfWriter) header() {
+	margin, top := w.layout.margin, w.pdf.GetY()
+	nameSize := w.layout.titleSize + 2
+	nameHeight := w.layout.lineHeight + 4
+	contactHeight := w.layout.lineHeight - 1
+
+	if w.layout.centered {
+		if width, height, ok := w.logo(30, 18); ok {
+			w.drawLogo(margin+(w.width-width)/2, top, width, height)
+			w.pdf.SetY(top + height + 2)
+		}
+		w.font("B", nameSize)
+		w.textColor(w.doc.Primary)
+		w.text(w.width, nameHeight, w.doc.Company, "C")
+		w.pdf.SetTextColor(0, 0, 0)
+		w.font("", w.layout.bodySize)
+		for _, line := range w.doc.Contact {
+			w.text(w.width, contactHeight, line, "C")
+		}
+		w.rule()
+		return
+	}
+
+	// The logo sits on the trailing side, next to the store details
+	logoWidth, logoHeight, hasLogo := w.logo(35, 20)
+	textWidth := w.width
+	if hasLogo {
+		textWidth -= logoWidth + 4
+	}
+	textX := margin
+	logoX := margin + w.width - logoWidth
+	if w.rtl() {
+		textX, logoX = margin+w.width-textWidth, margin
+	}
+
+	textHeight := nameHeight + float64(len(w.doc.Contact))*contactHeight
+	bottom := top + textHeight
+	if hasLogo && top+logoHeight > bottom {
+		bottom = top + logoHeight
+	}
+
+	if w.layout.banner {
+		// The band runs to the page edges and the content sits inside it
+		w.pdf.SetFillColor(w.doc.Primary.R, w.doc.Primary.G, w.doc.Primary.B)
+		w.pdf.Rect(0, 0, w.layout.PageWidth, bottom+margin/2, "F")
+		w.onColor(w.doc.Primary)
+	} else {
+		w.textColor(w.doc.Primary)
+	}
+
+	if hasLogo {
+		w.drawLogo(logoX, top, logoWidth, logoHeight)
+	}
+	w.pdf.SetXY(textX, top)
+	w.font("B", nameSize)
+	w.text(textWidth, nameHeight, w.doc.Company, w.align("L"))
+	if !w.layout.banner {
+		w.pdf.SetTextColor(0, 0, 0)
+	}
+	w.font("", w.layout.bodySize)
+	for _, line := range w.doc.Contact {
+		w.pdf.SetX(textX)
+		w.text(textWidth, contactHeight, line, w.align("L"))
+	}
+	w.pdf.SetTextColor(0, 0, 0)
+
+	if w.layout.banner {
+		bottom += margin / 2
+	}
+	w.pdf.SetXY(margin, bottom+w.layout.lineHeight)
+}
+
+func (w *pdfWriter) title() {
+	w.font("B", w.layout.titleSize)
+	w.textColor(w.doc.Primary)
+	w.text(w.width, w.layout.lineHeight+4, w.doc.Title, w.leading())
+	w.pdf.SetTextColor(0, 0, 0)
+}
+
+func (w *pdfWriter) block(block Block) {
+	h := w.layout.lineHeight
+	if block.Heading != "" {
+		w.font("B", w.layout.headSize)
+		w.textColor(w.doc.Primary)
+		w.text(w.width, h+2, block.Heading, w.align("L"))
+		w.pdf.SetTextColor(0, 0, 0)
+	}
+	w.font("", w.layout.bodySize)
+
+	switch block.Kind {
+	case BlockFields:
+		w.fields(block)
+	case BlockItems:
+		w.items(block)
+	case BlockTotals:
+		w.totals(block)
+	case BlockText:
+		w.text(w.width, h-1, block.Text, w.align("L"))
+	}
+
+	if w.layout.Thermal {
+		w.rule()
+	} else {
+		w.pdf.Ln(h * 0.7)
+	}
+}
+
+func (w *pdfWriter) fields(block Block) {
+	h := w.layout.lineHeight
+	if block.Columns < 2 {
+		for _, field := range block.Fields {
+			text := w.fieldText(field)
+			if w.pdf.GetStringWidth(text) <= w.width-2*w.pdf.GetCellMargin() {
+				w.pdf.CellFormat(w.width, h, text, "", 1, w.align("L"), false, 0, "")
+				continue
+			}
+			// Too long for one line: the label, then the value wrapped under it
+			w.text(w.width, h, field.Label+":", w.align("L"))
+			w.text(w.width, h, field.Value, w.align("L"))
+		}
+		return
+	}
+
+	width := w.width / float64(block.Columns)
+	for i := 0; i < len(block.Fields); i += block.Columns {
+		cells := make([]string, block.Columns)
+		for j := range cells {
+			if i+j < len(block.Fields) {
+				cells[j] = w.fieldText(block.Fields[i+j])
+			}
+		}
+		if w.rtl() {
+			for a, b := 0, len(cells)-1; a < b; a, b = a+1, b-1 {
+				cells[a], cells[b] = cells[b], cells[a]
+			}
+		}
+		for _, cell := range cells {
+			w.pdf.CellFormat(width, h, cell, "", 0, w.align("L"), false, 0, "")
+		}
+		w.pdf.Ln(h)
+	}
+}
+
+func (w *pdfWriter) items(block Block) {
+	h := w.layout.lineHeight
+	if w.layout.Thermal {
+		// Roll paper is too narrow for a table: the product, then quantity × price and the line total
+		for _, item := range block.Items {
+			w.font("B", w.layout.bodySize)
+			w.text(w.width, h, item.Name, w.align("L"))
+			w.font("", w.layout.bodySize)
+			w.row(h,
+				pdfColumn{width: w.width * 0.6, text: item.Quantity + " × " + item.Price, align: "L"},
+				pdfColumn{width: w.width * 0.4, text: item.Total, align: "R"})
+		}
+		return
+	}
+
+	h++
+	widths := [4]float64{w.width * 0.42, w.width * 0.16, w.width * 0.21, w.width * 0.21}
+	aligns := [4]string{"L", "C", "R", "R"}
+	columns := func(texts [4]string) []pdfColumn {
+		out := make([]pdfColumn, len(texts))
+		for i, text := range texts {
+			out[i] = pdfColumn{width: widths[i], text: text, align: aligns[i]}
+		}
+		return out
+	}
+
+	w.font("B", w.layout.bodySize)
+	w.pdf.SetFillColor(w.doc.Accent.R, w.doc.Accent.G, w.doc.Accent.B)
+	w.onColor(w.doc.Accent)
+	w.tableRow(h, true, columns(block.Header)...)
+	w.pdf.SetTextColor(0, 0, 0)
+
+	w.font("", w.layout.bodySize)
+	for _, item := range block.Items {
+		w.tableRow(h, false, columns([4]string{item.Name, item.Quantity, item.Price, item.Total})...)
+	}
+}
+
+func (w *pdfWriter) totals(block Block) {
+	valueWidth := w.width * 0.21
+	if w.layout.Thermal {
+		valueWidth = w.width * 0.45
+	}
+	for _, field := range block.Fields {
+		h := w.layout.lineHeight + 1
+		if field.Strong {
+			w.font("B", w.layout.headSize)
+			h++
+		} else {
+			w.font("", w.layout.bodySize)
+		}
+		w.row(h,
+			pdfColumn{width: w.width - valueWidth, text: field.Label + ":", align: "R"},
+			pdfColumn{width: valueWidth, text: field.Value, align: "R"})
+	}
+}
+
+func (w *pdfWriter) footer() {
+	if !w.layout.Thermal {
+		w.pdf.Ln(w.layout.lineHeight)
+	}
+	w.verification()
+	w.font("", w.layout.smallSize)
+	for _, line := range w.doc.Footer {
+		w.text(w.width, w.layout.lineHeight-1, line, w.leading())
+	}
+}
+
+// qrSize is the printed width of the verification QR code, large enough for a
+// phone camera on roll paper
+const qrSize = 24.0
+
+// verification draws the QR code that opens the public verification page, on the
+// leading side, or centred on roll paper, with its caption underneath
+func (w *pdfWriter) verification() {
+	if len(w.doc.QR) == 0 {
+		return
+	}
+	captionHeight := w.layout.lineHeight - 1
+	if !w.layout.Thermal {
+		_, pageHeight := w.pdf.GetPageSize()
+		if w.pdf.GetY()+qrSize+captionHeight+2 > pageHeight-w.layout.margin {
+			w.pdf.AddPage()
+		}
+	}
+
+	x := w.layout.margin
+	if w.layout.centered {
+		x += (w.width - qrSize) / 2
+	} else if w.rtl() {
+		x += w.width - qrSize
+	}
+	y := w.pdf.GetY() + 2
+	w.drawQR(x, y, qrSize)
+	w.pdf.LinkString(x, y, qrSize, qrSize, w.doc.VerifyURL)
+
+	w.pdf.SetY(y + qrSize + 2)
+	w.font("", w.layout.smallSize)
+	w.text(w.width, captionHeight, w.doc.VerifyText, w.leading())
+	w.pdf.Ln(w.layout.lineHeight / 2)
+}
+
+// drawQR fills each run of dark modules in a row as one rectangle, always black
+// on the white page whatever the store colours are
+func (w *pdfWriter) drawQR(x, y, size float64) {
+	module := size / float64(len(w.doc.QR))
+	w.pdf.SetFillColor(0, 0, 0)
+	for row, modules := range w.doc.QR {
+		for col := 0; col < len(modules); {
+			if !modules[col] {
+				col++
+				continue
+			}
+			start := col
+			for col < len(modules) && modules[col] {
+				col++
+			}
+			w.pdf.Rect(x+float64(start)*module, y+float64(row)*module, float64(col-start)*module, module, "F")
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package receipts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	db "github.com/mohammedrefaat/hamber/Db"
+	"github.com/mohammedrefaat/hamber/i18n"
+	"github.com/mohammedrefaat/hamber/notification"
+	"github.com/mohammedrefaat/hamber/stores"
+	"github.com/mohammedrefaat/hamber/utils"
+)
+
+// ========== RECEIPT SERVICE ==========
+
+// MaxLogoSize bounds the logo uploaded by a store and read from MinIO for each PDF
+const MaxLogoSize = 2 << 20
+
+// ErrNoRecipient is returned when a receipt has nowhere to be sent
+var ErrNoRecipient = errors.New("the order has no customer email")
+
+// Service issues order receipts and delivers them to customers
+type Service struct {
+	store        *stores.DbStore
+	photos       *db.PhotoSrv
+	emailService *notification.EmailService
+	config       config.ReceiptsConfig
+}
+
+func NewService(store *stores.DbStore, photos *db.PhotoSrv, emailService *notification.EmailService, cfg config.ReceiptsConfig) *Service {
+	return &Service{
+		store:        store,
+		photos:       photos,
+		emailService: emailService,
+		config:       cfg,
+	}
+}
+
+// DefaultBranding is used when the store owner cannot be loaded
+func DefaultBranding() Branding {
+	return Branding{
+		Name:    "Hamber Platform",
+		Address: "123 Business St, Cairo, Egypt",
+		Phone:   "+20 123 456 7890",
+		Email:   "info@hamber.local",
+		Website: "www.hamber.local",
+		TaxID:   "TAX-123456",
+	}
+}
+
+func brandingFromModel(saved *dbmodels.ReceiptBranding) Branding {
+	return Branding{
+		Name:         saved.Name,
+		Address:      saved.Address,
+		Phone:        saved.Phone,
+		Email:        saved.Email,
+		Website:      saved.Website,
+		Logo:         saved.Logo,
+		TaxID:        saved.TaxID,
+		PrimaryColor: saved.PrimaryColor,
+		AccentColor:  saved.AccentColor,
+		FooterText:   saved.FooterText,
+		ReturnPolicy: saved.ReturnPolicy,
+	}
+}
+
+// Design returns the branding and layout a store prints receipts with.
+// Details the store has not set come from the owner's profile.
+func (s *Service) Design(ownerID uint) (Branding, Layout) {
+	branding := DefaultBranding()
+	if owner, err := s.store.GetUser(ownerID); err == nil {
+		branding = Branding{
+			Name:    owner.Name,
+			Email:   owner.Email,
+			Phone:   owner.Phone,
+			Website: owner.Website,
+		}
+	}
+
+	saved, err := s.store.GetReceiptBranding(ownerID)
+	if err != nil {
+		return branding, StoreLayout("")
+	}
+	return branding.Override(brandingFromModel(saved)), StoreLayout(saved.Layout)
+}
+
+// Locale is the locale a store prints receipts in when nobody asked for one,
+// e.g. receipts created from a payment callback
+func (s *Service) Locale(ownerID uint) i18n.Locale {
+	return i18n.NewLocale(s.store.GetStoreLocale(ownerID))
+}
+
+// logoObjectName accepts both object names and the public URLs stored by older
+// clients, which end in category/filename
+func logoObjectName(logo string) string {
+	if !strings.Contains(logo, "://") {
+		return logo
+	}
+	parts := strings.Split(strings.Trim(strings.SplitN(logo, "://", 2)[1], "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1]
+}
+
+// LogoURL is the public address of a branding logo, empty without one
+func (s *Service) LogoURL(logo string) string {
+	if logo == "" || s.photos == nil {
+		return ""
+	}
+	return s.photos.GetPublicURL(logoObjectName(logo))
+}
+
+// logo fetches the logo from MinIO for the PDF and returns its public URL for
+// HTML. A missing or unreadable logo leaves the PDF without one.
+func (s *Service) logo(logo string) (*Image, string) {
+	url := s.LogoURL(logo)
+	if url == "" {
+		return nil, ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reader, err := s.photos.GetPhoto(ctx, logoObjectName(logo))
+	if err != nil {
+		return nil, url
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, MaxLogoSize+1))
+	if err != nil || len(data) > MaxLogoSize {
+		return nil, url
+	}
+	imageType := logoImageType(data)
+	if imageType == "" {
+		return nil, url
+	}
+	return &Image{Data: data, Type: imageType}, url
+}
+
+// logoImageType names the formats the PDF renderer can draw
+func logoImageType(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return "PNG"
+	case "image/jpeg":
+		return "JPG"
+	case "image/gif":
+		return "GIF"
+	}
+	return ""
+}
+
+// Document lays out a receipt with the store logo loaded and, once it has a
+// number, the QR code that verifies it
+func (s *Service) Document(order *dbmodels.Order, branding Branding, layout Layout, locale i18n.Locale, number string, issuedAt time.Time) *Document {
+	logo, logoURL := s.logo(branding.Logo)
+	verifyURL := ""
+	if number != "" {
+		verifyURL = s.VerificationURL(number)
+	}
+	return Build(Data{
+		Order:     order,
+		Branding:  branding,
+		Layout:    layout,
+		Locale:    locale,
+		Number:    number,
+		IssuedAt:  issuedAt,
+		Logo:      logo,
+		LogoURL:   logoURL,
+		VerifyURL: verifyURL,
+	})
+}
+
+// IssuedDocument lays out an existing receipt again with the branding it was
+// issued with, in the given layout and locale
+func (s *Service) IssuedDocument(receipt *dbmodels.OrderReceipt, order *dbmodels.Order, layout Layout, locale i18n.Locale) *Document {
+	var branding Branding
+	json.Unmarshal([]byte(receipt.CompanyInfo), &branding)
+	issuedAt := receipt.CreatedAt
+	if receipt.GeneratedAt != nil {
+		issuedAt = *receipt.GeneratedAt
+	}
+	return s.Document(order, branding, layout, locale, receipt.ReceiptNumber, issuedAt)
+}
+
+// Issue renders the PDF for an order and stores the receipt record.
+// The order must be loaded with its items and client.
+func (s *Service) Issue(order *dbmodels.Order, branding Branding, layout Layout, locale i18n.Locale) (*dbmodels.OrderReceipt, error) {
+	// Generate receipt number
+	receiptNumber := fmt.Sprintf("RCP-%d-%d", order.ID, time.Now().Unix())
+	issuedAt := time.Now()
+
+	// Generate PDF
+	doc := s.Document(order, branding, layout, locale, receiptNumber, issuedAt)
+	pdfPath, err := savePDF(doc, receiptNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate PDF")
+	}
+
+	// Save receipt record with a copy of the branding it was printed with
+	brandingJSON, _ := json.Marshal(branding)
+	receipt := &dbmodels.OrderReceipt{
+		OrderID:           order.ID,
+		ReceiptNumber:     receiptNumber,
+		PDFPath:           pdfPath,
+		TemplateVersion:   layout.TemplateVersion(),
+		CompanyInfo:       string(brandingJSON),
+		Language:          locale.Language,
+		Numerals:          locale.Numerals,
+		PublicToken:       utils.GenerateToken(32),
+		VerificationToken: s.VerificationToken(receiptNumber),
+		GeneratedAt:       &issuedAt,
+	}
+
+	if err := s.store.CreateOrderReceipt(receipt); err != nil {
+		return nil, fmt.Errorf("failed to save receipt")
+	}
+
+	return receipt, nil
+}
+
+// IssueForOrder returns the order's receipt, issuing one with the store's design
+// and locale if it has none yet
+func (s *Service) IssueForOrder(order *dbmodels.Order) (*dbmodels.OrderReceipt, error) {
+	if existing, err := s.store.GetOrderReceipt(order.ID); err == nil {
+		return existing, nil
+	}
+	branding, layout := s.Design(order.UserID)
+	return s.Issue(order, branding, layout, s.Locale(order.UserID))
+}
+
+// savePDF renders a receipt and saves it under uploads
+func savePDF(doc *Document, receiptNumber string) (string, error) {
+	pdf, err := RenderPDF(doc)
+	if err != nil {
+		return "", err
+	}
+
+	// Save PDF
+	if err := os.MkdirAll("./uploads/receipts", 0755); err != nil {
+		return "", err
+	}
+	pdfPath := fmt.Sprintf("./uploads/receipts/%s.pdf", receiptNumber)
+	if err := pdf.OutputFileAndClose(pdfPath); err != nil {
+		return "", err
+	}
+
+	return pdfPath, nil
+}
+
+// PDF returns the stored PDF of a receipt, rendering it again from the issued
+// branding if the file is gone. The receipt must be loaded with its order.
+func (s *Service) PDF(receipt *dbmodels.OrderReceipt) ([]byte, error) {
+	if data, err := os.ReadFile(receipt.PDFPath); err == nil {
+		return data, nil
+	}
+
+	locale := i18n.NewLocale(receipt.Language, receipt.Numerals)
+	doc := s.IssuedDocument(receipt, &receipt.Order, LayoutForVersion(receipt.TemplateVersion), locale)
+	pdf, err := RenderPDF(doc)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PublicURL is the link customers open the receipt with. Receipts issued before
+// links existed get their token here.
+func (s *Service) PublicURL(receipt *dbmodels.OrderReceipt) (string, error) {
+	if receipt.PublicToken == "" {
+		token, err := s.store.SetReceiptPublicToken(receipt.ID, utils.GenerateToken(32))
+		if err != nil {
+			return "", err
+		}
+		receipt.PublicToken = token
+	}
+	return s.config.PublicURL + "/" + receipt.PublicToken, nil
+}
+
+// ========== RECEIPT DELIVERY ==========
+
+// Send emails the receipt PDF and its public link and records the attempt, failed
+// or not. An empty recipient sends to the order's client. sentBy is the user who
+// asked for it, nil for automatic sends. The receipt must be loaded with its order.
+func (s *Service) Send(receipt *dbmodels.OrderReceipt, to, trigger string, sentBy *uint) (*dbmodels.ReceiptDelivery, error) {
+	if to == "" {
+		to = receipt.Order.Client.Email
+	}
+	if to == "" {
+		return nil, ErrNoRecipient
+	}
+
+	delivery := &dbmodels.ReceiptDelivery{
+		ReceiptID: receipt.ID,
+		Channel:   "email",
+		Recipient: to,
+		Trigger:   trigger,
+		Status:    dbmodels.ReceiptDeliverySent,
+		SentBy:    sentBy,
+		CreatedAt: time.Now(),
+	}
+
+	err := s.email(receipt, to)
+	if err != nil {
+		delivery.Status = dbmodels.ReceiptDeliveryFailed
+		delivery.Error = err.Error()
+	}
+	if recordErr := s.store.RecordReceiptDelivery(delivery); recordErr != nil {
+		log.Printf("Receipts: failed to record delivery of receipt %d: %v", receipt.ID, recordErr)
+	}
+	return delivery, err
+}
+
+func (s *Service) email(receipt *dbmodels.OrderReceipt, to string) error {
+	if !s.emailService.IsConfigured() {
+		return errors.New("email service is not configured")
+	}
+
+	pdf, err := s.PDF(receipt)
+	if err != nil {
+		return fmt.Errorf("failed to generate PDF: %w", err)
+	}
+	link, err := s.PublicURL(receipt)
+	if err != nil {
+		return err
+	}
+
+	var branding Branding
+	json.Unmarshal([]byte(receipt.CompanyInfo), &branding)
+	locale := i18n.NewLocale(receipt.Language, receipt.Numerals)
+	order := &receipt.Order
+
+	subject := fmt.Sprintf(locale.T("receipt.email_subject"), locale.Number(int(order.ID)), branding.Name)
+	body, err := renderReceiptEmail(receiptEmail{
+		Dir:      locale.Dir(),
+		Store:    branding.Name,
+		Greeting: fmt.Sprintf(locale.T("receipt.email_greeting"), order.Client.Name),
+		Body:     locale.T("receipt.email_body"),
+		Total:    locale.T("receipt.total_amount") + ": " + locale.Money(order.Total, order.Currency),
+		Link:     link,
+		LinkText: locale.T("receipt.email_link"),
+		Color:    colorOr(branding.PrimaryColor, DefaultPrimaryColor).Hex(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.emailService.SendWithAttachments(to, subject, body, notification.Attachment{
+		Filename:    receipt.ReceiptNumber + ".pdf",
+		ContentType: "application/pdf",
+		Data:        pdf,
+	})
+}
+
+// SendAutomatically emails an order's receipt after it was paid or delivered,
+// issuing the receipt first if needed. The customer gets it once: a receipt sent
+// on payment is not sent again on delivery. Stores resend it by hand.
+func (s *Service) SendAutomatically(orderID uint, trigger string) {
+	switch trigger {
+	case dbmodels.ReceiptTriggerPaid:
+		if !s.config.EmailOnPaid {
+			return
+		}
+	case dbmodels.ReceiptTriggerDelivered:
+		if !s.config.EmailOnDelivered {
+			return
+		}
+	default:
+		return
+	}
+	if !s.emailService.IsConfigured() {
+		return
+	}
+
+	order, err := s.store.GetOrderWithItems(orderID)
+	if err != nil {
+		log.Printf("Receipts: order %d not found: %v", orderID, err)
+		return
+	}
+	if order.Client.Email == "" {
+		return
+	}
+
+	receipt, err := s.IssueForOrder(order)
+	if err != nil {
+		log.Printf("Receipts: failed to issue receipt for order %d: %v", orderID, err)
+		return
+	}
+	if s.store.HasAutomaticReceiptDelivery(receipt.ID) {
+		return
+	}
+	receipt.Order = *order
+
+	if _, err := s.Send(receipt, "", trigger, nil); err != nil {
+		log.Printf("Receipts: failed to email receipt %s to %s: %v", receipt.ReceiptNumber, order.Client.Email, err)
+	}
+}
+
+type receiptEmail struct {
+	Dir      string
+	Store    string
+	Greeting string
+	Body     string
+	Total    string
+	Link     string
+	LinkText string
+	Color    string
+}
+
+func renderReceiptEmail(data receiptEmail) (string, error) {
+	tmpl, err := template.New("receipt_email").Funcs(template.FuncMap{
+		"css": func(value string) template.CSS { return template.CSS(value) },
+	}).Parse(receiptEmailTemplate)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+const receiptEmailTemplate = `<!DOCTYPE html>
+<html dir="{{.Dir}}">
+<body style="font-family: Arial, sans-serif; color: #333;">
+    <h2 style="color: {{css .Color}};">{{.Store}}</h2>
+    <p>{{.Greeting}}</p>
+    <p>{{.Body}}</p>
+    <p><strong><bdi>{{.Total}}</bdi></strong></p>
+    <p>
+        <a href="{{.Link}}" style="display: inline-block; padding: 10px 20px; background: {{css .Color}}; color: #fff; text-decoration: none; border-radius: 4px;">{{.LinkText}}</a>
+    </p>
+</body>
+</html>`
@@ -0,0 +1,173 @@
+package receipts
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/i18n"
+	"github.com/shopspring/decimal"
+)
+
+// ========== VERIFICATION ==========
+
+// Verification statuses
+const (
+	VerificationValid = "VALID"
+	VerificationVoid  = "VOID" // The order was cancelled or refunded after the receipt was issued
+)
+
+// Verification is what the public verification page tells about a receipt.
+// It leaves out the customer and the items.
+type Verification struct {
+	ReceiptNumber string          `json:"receipt_number"`
+	Store         string          `json:"store"`
+	IssuedAt      time.Time       `json:"issued_at"`
+	Total         decimal.Decimal `json:"total"`
+	Currency      string          `json:"currency"`
+	Status        string          `json:"status"` // VALID or VOID
+}
+
+// VerificationToken signs a receipt number. The token is printed on the receipt as
+// a QR code; only this platform can produce one for a given number.
+func (s *Service) VerificationToken(number string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.SigningKey))
+	mac.Write([]byte("receipt:" + number))
+	return number + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// VerificationURL is the public page a receipt's QR code opens
+func (s *Service) VerificationURL(number string) string {
+	return s.config.VerifyURL + "/" + s.VerificationToken(number)
+}
+
+// Verify checks a token's signature and describes the receipt it was issued for.
+// It returns false for forged tokens and receipts that no longer exist.
+func (s *Service) Verify(token string) (*Verification, *dbmodels.OrderReceipt, bool) {
+	separator := strings.LastIndex(token, ".")
+	if separator <= 0 {
+		return nil, nil, false
+	}
+	number := token[:separator]
+	if !hmac.Equal([]byte(token), []byte(s.VerificationToken(number))) {
+		return nil, nil, false
+	}
+
+	receipt, err := s.store.GetOrderReceiptByNumber(number)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	var branding Branding
+	json.Unmarshal([]byte(receipt.CompanyInfo), &branding)
+	issuedAt := receipt.CreatedAt
+	if receipt.GeneratedAt != nil {
+		issuedAt = *receipt.GeneratedAt
+	}
+
+	order := receipt.Order
+	status := VerificationValid
+	if order.Status == dbmodels.OrderStatus_CANCELED || strings.EqualFold(order.PaymentStatus, dbmodels.PaymentStatus_REFUNDED.String()) {
+		status = VerificationVoid
+	}
+
+	return &Verification{
+		ReceiptNumber: receipt.ReceiptNumber,
+		Store:         branding.Name,
+		IssuedAt:      issuedAt,
+		Total:         order.Total,
+		Currency:      order.Currency,
+		Status:        status,
+	}, receipt, true
+}
+
+// verificationPage is a Verification with every text localized
+type verificationPage struct {
+	Locale  i18n.Locale
+	Title   string
+	Found   bool
+	Valid   bool
+	Status  string
+	Message string
+	Fields  []Field
+}
+
+var verificationTemplate = template.Must(template.New("verification").Parse(verificationHTML))
+
+// RenderVerification writes the page a scanned QR code opens. A nil verification
+// shows that the receipt could not be verified.
+func RenderVerification(out io.Writer, verification *Verification, locale i18n.Locale) error {
+	t := locale.T
+	page := verificationPage{Locale: locale, Title: t("receipt.verification")}
+	if verification == nil {
+		page.Message = t("receipt.not_verified")
+		return verificationTemplate.Execute(out, page)
+	}
+
+	page.Found = true
+	page.Valid = verification.Status == VerificationValid
+	page.Status = t("receipt.valid")
+	if !page.Valid {
+		page.Status = t("receipt.void")
+	}
+	page.Fields = []Field{
+		{Label: t("receipt.number"), Value: locale.Digits(verification.ReceiptNumber)},
+		{Label: t("receipt.store"), Value: verification.Store},
+		{Label: t("receipt.date"), Value: locale.Date(verification.IssuedAt)},
+		{Label: t("receipt.total_amount"), Value: locale.Money(verification.Total, verification.Currency)},
+	}
+	return verificationTemplate.Execute(out, page)
+}
+
+const verificationHTML = `<!DOCTYPE html>
+<html lang="{{.Locale.Language}}" dir="{{.Locale.Dir}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{.Title}}</title>
+    <style>
+        body { font-family: Arial, "Noto Naskh Arabic", Tahoma, sans-serif; max-width: 480px; margin: 40px auto; padding: 0 16px; color: #333; }
+        h1 { font-size: 20px; }
+        .status { font-size: 22px; font-weight: bold; padding: 12px; border-radius: 6px; text-align: center; margin: 20px 0; }
+        .valid { background: #e6f4ea; color: #1e7e34; }
+        .void, .invalid { background: #fdecea; color: #b3261e; }
+        .field { padding: 8px 0; border-bottom: 1px solid #eee; }
+    </style>
+</head>
+<body>
+    <h1>{{.Title}}</h1>
+    {{if .Found}}
+    <div class="status {{if .Valid}}valid{{else}}void{{end}}">{{.Status}}</div>
+    {{range .Fields}}<div class="field"><strong>{{.Label}}:</strong> <bdi>{{.Value}}</bdi></div>{{end}}
+    {{else}}
+    <div class="status invalid">{{.Message}}</div>
+    {{end}}
+</body>
+</html>
+`
+
+// qrPath is an SVG path drawing the dark modules of a QR code, one run per row
+func qrPath(modules [][]bool) string {
+	var path strings.Builder
+	for y, row := range modules {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	return path.String()
+}
@@ -5,6 +5,7 @@ import (
 	config "github.com/mohammedrefaat/hamber/Config"
 	middleware "github.com/mohammedrefaat/hamber/Middleware"
 	"github.com/mohammedrefaat/hamber/controllers"
+	"github.com/mohammedrefaat/hamber/stores"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
@@ -12,7 +13,7 @@ import (
 	_ "github.com/mohammedrefaat/hamber/docs"
 )
 
-func GetRouter(cfg *config.Config) (*gin.Engine, error) {
+func GetRouter(cfg *config.Config, store *stores.DbStore) (*gin.Engine, error) {
 	router := gin.Default()
 	// Swagger documentation route
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -42,10 +43,38 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 				cart.PUT("/:id", controllers.UpdateCartItem)
 				cart.DELETE("/:id", controllers.RemoveFromCart)
 				cart.DELETE("/clear", controllers.ClearCart)
+				cart.POST("/email", controllers.SaveCartEmail)
+				cart.GET("/restore/:token", controllers.RestoreCart)
 			}
 
-			// Checkout (Requires Auth)
+			// Wishlists (Public with optional auth)
+			wishlists := customerWebsite.Group("/wishlists")
+			{
+				wishlists.GET("/", controllers.GetWishlists)
+				wishlists.POST("/", controllers.CreateWishlist)
+				wishlists.POST("/items", controllers.AddToDefaultWishlist)
+				wishlists.GET("/shared/:token", controllers.GetSharedWishlist)
+				wishlists.GET("/:id", controllers.GetWishlist)
+				wishlists.PUT("/:id", controllers.UpdateWishlist)
+				wishlists.DELETE("/:id", controllers.DeleteWishlist)
+				wishlists.POST("/:id/items", controllers.AddWishlistItem)
+				wishlists.DELETE("/:id/items/:item_id", controllers.RemoveWishlistItem)
+				wishlists.POST("/:id/items/:item_id/move-to-cart", controllers.MoveWishlistItemToCart)
+			}
+
+			// Currencies: rates and prices in the shopper's currency
+			customerWebsite.GET("/exchange-rates", controllers.GetExchangeRates)
+			customerWebsite.GET("/prices", controllers.GetProductPriceQuotes)
+
+			// Product reviews (verified purchases only)
+			customerWebsite.GET("/products/:id/reviews", controllers.GetProductReviews)
+			customerWebsite.POST("/products/:id/reviews", controllers.CreateProductReview)
+
+			// Checkout (guest via X-Session-ID or authenticated)
 			customerWebsite.POST("/checkout", controllers.CreateOrderFromCart) // todo
+			customerWebsite.POST("/orders/:id/pay", controllers.PayOrder)
+			customerWebsite.POST("/orders/:id/payment-proof", controllers.SubmitOrderPaymentProof)
+			customerWebsite.GET("/orders/:id/shipments", controllers.GetCustomerOrderShipments)
 		}
 		// Package routes (public)
 		packages := api.Group("/packages")
@@ -64,6 +93,10 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 		// Public calendar events
 		api.GET("/calendar/public", controllers.GetPublicEvents)
 
+		// Receipt links emailed to customers (public - the token is the access check)
+		api.GET("/receipts/public/:token", controllers.GetPublicReceipt)
+		api.GET("/receipts/verify/:token", controllers.VerifyReceipt)
+
 		// Authentication routes
 		auth := api.Group("/auth")
 		{
@@ -117,8 +150,9 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 		// Payment callback routes (public - called by payment gateways)
 		paymentCallbacks := api.Group("/payment")
 		{
-			paymentCallbacks.POST("/fawry/callback", controllers.FawryCallback)
-			paymentCallbacks.POST("/paymob/callback", controllers.PaymobCallback)
+			paymentCallbacks.POST("/:gateway/callback", controllers.PaymentCallback)
+			paymentCallbacks.GET("/sandbox/checkout/:reference", controllers.SandboxCheckout)
+			paymentCallbacks.POST("/sandbox/checkout/:reference", controllers.SandboxCheckout)
 		}
 		// Banner routes (public viewing)
 		api.GET("/banners/active", controllers.GetActiveBanners)
@@ -132,6 +166,18 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 		// User profile routes
 		protected.GET("/profile", controllers.GetProfile)
 		protected.PUT("/profile", controllers.UpdateProfile)
+		protected.GET("/profile/currency", controllers.GetStoreCurrency)
+		protected.PUT("/profile/currency", controllers.UpdateStoreCurrency)
+		protected.GET("/profile/locale", controllers.GetStoreLocale)
+		protected.PUT("/profile/locale", controllers.UpdateStoreLocale)
+		protected.GET("/profile/receipt-branding", controllers.GetReceiptBranding)
+		protected.PUT("/profile/receipt-branding", controllers.UpdateReceiptBranding)
+		protected.POST("/profile/receipt-branding/logo", controllers.UploadReceiptLogo)
+		protected.DELETE("/profile/receipt-branding/logo", controllers.DeleteReceiptLogo)
+		protected.GET("/profile/receipt-branding/preview", controllers.PreviewReceipt)
+		protected.GET("/profile/einvoice", controllers.GetEInvoiceProfile)
+		protected.PUT("/profile/einvoice", controllers.UpdateEInvoiceProfile)
+		protected.GET("/profile/entitlements", controllers.GetMyEntitlements)
 
 		// Photo routes
 		photos := protected.Group("/photos")
@@ -163,6 +209,32 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 			products.DELETE("/:id", controllers.DeleteProduct)
 			products.PATCH("/:id/quantity", controllers.UpdateProductQuantity)
 			products.GET("/categories", controllers.GetProductCategories)
+			products.GET("/stock-settings", controllers.GetStockSettings)
+			products.PUT("/stock-settings", controllers.SaveStockSetting)
+			products.DELETE("/stock-settings", controllers.DeleteStockSetting)
+			products.PUT("/:id/stock-settings", controllers.UpdateProductStockSettings)
+			products.GET("/:id/prices", controllers.GetProductPrices)
+			products.PUT("/:id/prices", controllers.SaveProductPrice)
+			products.DELETE("/:id/prices/:currency", controllers.DeleteProductPrice)
+		}
+
+		// Client CRM routes (protected)
+		clients := protected.Group("/clients")
+		{
+			clients.GET("/", controllers.GetClients)
+			clients.POST("/", controllers.CreateClient)
+			clients.GET("/duplicates", controllers.GetDuplicateClients)
+			clients.POST("/merge", controllers.MergeClients)
+			clients.POST("/import", controllers.ImportClients)
+			clients.GET("/:id", controllers.GetClient)
+			clients.PUT("/:id", controllers.UpdateClient)
+			clients.DELETE("/:id", controllers.DeleteClient)
+			clients.GET("/:id/timeline", controllers.GetClientTimeline)
+			clients.POST("/:id/notes", controllers.AddClientNote)
+			clients.DELETE("/:id/notes/:note_id", controllers.DeleteClientNote)
+			clients.POST("/:id/addresses", controllers.AddClientAddress)
+			clients.PUT("/:id/addresses/:address_id", controllers.UpdateClientAddress)
+			clients.DELETE("/:id/addresses/:address_id", controllers.DeleteClientAddress)
 		}
 
 		// Order routes (protected)
@@ -173,15 +245,37 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 			orders.GET("/:id", controllers.GetOrder)
 			orders.PATCH("/:id/status", controllers.UpdateOrderStatus)
 			orders.PATCH("/:id/cancel", controllers.CancelOrder)
+
+			// Shipments
+			orders.POST("/:id/shipments", controllers.CreateShipment)
+			orders.GET("/:id/shipments", controllers.GetOrderShipments)
+			orders.GET("/:id/shipments/:shipment_id/label", controllers.DownloadShippingLabel)
+			orders.POST("/:id/shipments/:shipment_id/track", controllers.TrackShipment)
+			orders.POST("/:id/shipments/:shipment_id/cancel", controllers.CancelShipment)
 		}
 
 		// Receipt routes (protected)
 		receipts := protected.Group("/receipts")
 		{
+			receipts.GET("/layouts", controllers.GetReceiptLayouts)
 			receipts.POST("/order/:order_id", controllers.GenerateOrderReceipt)
 			receipts.GET("/order/:order_id", controllers.GetOrderReceipt)
 			receipts.GET("/order/:order_id/download", controllers.DownloadReceipt)
 			receipts.GET("/order/:order_id/html", controllers.GetReceiptHTML)
+			receipts.POST("/order/:order_id/send", middleware.AddonQuota(store, cfg.GetEmailsAddonID(), 1), controllers.SendOrderReceipt)
+		}
+
+		// E-invoices (Egyptian Tax Authority)
+		einvoices := protected.Group("/einvoices")
+		{
+			einvoices.GET("", controllers.GetEInvoiceDocuments)
+			einvoices.GET("/export", controllers.ExportEInvoiceDocuments)
+			einvoices.POST("/orders/:order_id", controllers.IssueOrderEInvoice)
+			einvoices.POST("/orders/:order_id/credit-note", controllers.IssueOrderCreditNote)
+			einvoices.GET("/:id", controllers.GetEInvoiceDocument)
+			einvoices.GET("/:id/download", controllers.DownloadEInvoiceDocument)
+			einvoices.POST("/:id/submit", controllers.SubmitEInvoiceDocument)
+			einvoices.POST("/:id/status", controllers.RefreshEInvoiceStatus)
 		}
 
 		// To do routes (protected)
@@ -216,6 +310,8 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 			addonSubscriptions.DELETE("/:id/cancel", controllers.CancelSubscription)
 			addonSubscriptions.POST("/:id/usage", controllers.LogUsage)
 			addonSubscriptions.GET("/:id/usage", controllers.GetUsageLogs)
+			addonSubscriptions.GET("/:id/quota", controllers.GetUsageQuota)
+			addonSubscriptions.GET("/:id/usage-periods", controllers.GetUsagePeriods)
 		}
 
 		// Notification routes (protected)
@@ -251,14 +347,46 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 			dashboard.GET("/recent-activities", controllers.GetRecentActivities)
 			dashboard.GET("/product-stats", controllers.GetProductStats)
 			dashboard.GET("/client-stats", controllers.GetClientStats)
+			dashboard.GET("/cart-recovery", middleware.AddonQuota(store, cfg.GetReportsAddonID(), 1), controllers.GetCartRecoveryReport)
+			dashboard.GET("/reorder-suggestions", controllers.GetReorderSuggestions)
+			dashboard.GET("/reviews", controllers.GetReviewQueue)
+			dashboard.PUT("/reviews/:id/moderate", controllers.ModerateReview)
+			dashboard.PUT("/reviews/:id/reply", controllers.ReplyToReview)
 		}
 		// Payment routes (protected)
 		payment := protected.Group("/payment")
 		{
 			payment.POST("/change-package", controllers.RequestPackageChange)
+			payment.GET("/change-package/quote", controllers.GetPackageChangeQuote)
 			payment.GET("/status/:id", controllers.GetPaymentStatus)
 			payment.GET("/history", controllers.GetUserPayments)
 			payment.GET("/package-changes", controllers.GetPackageChangeHistory)
+
+			// Renewals of the current package
+			payment.GET("/subscription", controllers.GetMySubscription)
+			payment.POST("/subscription/cancel", controllers.CancelSubscriptionRenewal)
+			payment.POST("/subscription/resume", controllers.ResumeSubscriptionRenewal)
+			payment.GET("/subscription/events", controllers.GetMySubscriptionEvents)
+			payment.GET("/invoices", controllers.GetMyInvoices)
+			payment.POST("/invoices/:id/pay", controllers.PayInvoice)
+
+			// Cash on delivery, bank transfer and InstaPay: proof, review queue
+			// and the store's account for transfers
+			payment.GET("/offline/account", controllers.GetPaymentAccount)
+			payment.PUT("/offline/account", controllers.SavePaymentAccount)
+			payment.GET("/offline/reviews", controllers.GetOfflinePaymentQueue)
+			payment.POST("/offline/:id/proof", controllers.SubmitPaymentProof)
+			payment.GET("/offline/:id/proof", controllers.GetPaymentProof)
+			payment.POST("/offline/:id/confirm", controllers.ConfirmOfflinePayment)
+			payment.POST("/offline/:id/reject", controllers.RejectOfflinePayment)
+		}
+
+		// Prepaid wallet (protected)
+		wallet := protected.Group("/wallet")
+		{
+			wallet.GET("/", controllers.GetMyWallet)
+			wallet.GET("/transactions", controllers.GetMyWalletTransactions)
+			wallet.POST("/top-up", controllers.TopUpWallet)
 		}
 
 		// Admin only routes
@@ -291,8 +419,36 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 			{
 				adminPayment.GET("/", controllers.GetAllPayments)
 				adminPayment.GET("/:id", controllers.GetPaymentStatus)
+				adminPayment.POST("/:id/sync", controllers.SyncPaymentStatus)
+				adminPayment.POST("/:id/refund", controllers.RefundPayment)
+				adminPayment.POST("/reconcile", controllers.ReconcilePendingPayments)
+				adminPayment.GET("/offline", controllers.GetAllOfflinePayments)
+				adminPayment.POST("/:id/confirm", controllers.ConfirmOfflinePayment)
+				adminPayment.POST("/:id/reject", controllers.RejectOfflinePayment)
 			}
 
+			// Wallet balances and adjustments
+			admin.GET("/wallets/:user_id", controllers.GetUserWallet)
+			admin.GET("/wallets/:user_id/transactions", controllers.GetUserWalletTransactions)
+			admin.POST("/wallets/:user_id/adjust", controllers.AdjustWallet)
+
+			// Daily comparison of payments with their gateways
+			admin.GET("/payment-reconciliations", controllers.GetPaymentReconciliations)
+			admin.GET("/payment-reconciliations/:id", controllers.GetPaymentReconciliation)
+			admin.POST("/payment-reconciliations", controllers.RunPaymentReconciliation)
+
+			// Payment gateway callbacks as received
+			admin.GET("/payment-events", controllers.GetPaymentEvents)
+			admin.GET("/payment-events/:id", controllers.GetPaymentEvent)
+			admin.POST("/payment-events/:id/replay", controllers.ReplayPaymentEvent)
+
+			admin.POST("/einvoices/payments/:payment_id", controllers.IssuePaymentEInvoice)
+
+			// Subscription renewals and dunning
+			admin.GET("/billing/invoices", controllers.GetBillingInvoices)
+			admin.GET("/billing/events", controllers.GetBillingEvents)
+			admin.POST("/billing/run", controllers.RunBilling)
+
 			// Contact management
 			adminContact := admin.Group("/contacts")
 			{
@@ -303,6 +459,15 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 				adminContact.GET("/stats", controllers.GetContactStats)
 			}
 
+			// Exchange rates (admin)
+			adminRates := admin.Group("/exchange-rates")
+			{
+				adminRates.GET("/", controllers.GetExchangeRates)
+				adminRates.PUT("/", controllers.SaveExchangeRate)
+				adminRates.POST("/import", controllers.ImportExchangeRates)
+				adminRates.DELETE("/:id", controllers.DeleteExchangeRate)
+			}
+
 			// Add-on management (admin)
 			adminAddons := admin.Group("/addons")
 			{
@@ -311,6 +476,7 @@ func GetRouter(cfg *config.Config) (*gin.Engine, error) {
 				adminAddons.DELETE("/:id", controllers.DeleteAddon)
 				adminAddons.POST("/pricing-tiers", controllers.CreatePricingTier)
 			}
+			admin.DELETE("/addon-subscriptions/:id/usage/:log_id", controllers.ReleaseUsage)
 
 			// Calendar management (admin)
 			adminCalendar := admin.Group("/calendar")
@@ -9,8 +9,14 @@ import (
 	"github.com/gin-gonic/gin"
 	config "github.com/mohammedrefaat/hamber/Config"
 	db "github.com/mohammedrefaat/hamber/Db"
+	"github.com/mohammedrefaat/hamber/billing"
 	"github.com/mohammedrefaat/hamber/controllers"
+	"github.com/mohammedrefaat/hamber/einvoice"
+	"github.com/mohammedrefaat/hamber/jobs"
 	"github.com/mohammedrefaat/hamber/notification"
+	"github.com/mohammedrefaat/hamber/payment"
+	"github.com/mohammedrefaat/hamber/receipts"
+	"github.com/mohammedrefaat/hamber/shipping"
 	"github.com/mohammedrefaat/hamber/stores"
 	"github.com/mohammedrefaat/hamber/utils"
 )
@@ -21,6 +27,7 @@ type Service struct {
 	config       *config.Config
 	photosrv     *db.PhotoSrv
 	notifService *notification.NotificationService
+	scheduler    *jobs.Scheduler
 }
 
 func NewServer() (*Service, error) {
@@ -70,15 +77,76 @@ func NewServer() (*Service, error) {
 		log.Println("ℹ️ RabbitMQ is disabled in configuration")
 	}
 
+	// Initialize email service
+	emailService := notification.NewEmailService(config.Email)
+	if !emailService.IsConfigured() {
+		log.Println("ℹ️ Email is not configured, emails will not be sent")
+	}
+
+	// Receipts are emailed to customers when orders are paid or delivered
+	receiptService := receipts.NewService(StStore, GetPhotoService(), emailService, config.GetReceiptsConfig())
+
+	// E-invoices go to the Tax Authority, or a local stand-in until it is configured
+	einvoiceConfig := config.GetEInvoiceConfig()
+	einvoiceService := einvoice.NewService(StStore, einvoice.NewSubmitter(einvoiceConfig), einvoiceConfig)
+
+	// Payment gateways enabled in configuration
+	paymentRegistry := payment.NewRegistry(config)
+	paymentReconciler := payment.NewReconciler(paymentRegistry, StStore, controllers.ApplyPaymentStatus)
+
+	// Paid packages are renewed through the same gateways
+	renewals := billing.NewRenewals(StStore, paymentRegistry, config, emailService, notifService)
+
+	// Carriers for shipments
+	shipmentTracker := shipping.NewTracker(shipping.NewRegistry(config.GetShippingConfig()), StStore, emailService, notifService, receiptService)
+
 	// Set the global store for controllers
 	controllers.SetStore(&controllers.GlobalService{
 		StStore:      StStore,
 		Config:       config,
 		PhotoSrv:     GetPhotoService(),
 		NotifService: notifService,
+		EmailService: emailService,
+		Shipping:     shipmentTracker,
+		Receipts:     receiptService,
+		EInvoices:    einvoiceService,
+		Payments:     paymentRegistry,
+		Reconciler:   paymentReconciler,
+		Renewals:     renewals,
 	})
 
-	router, err := GetRouter(config)
+	// Background jobs
+	scheduler := jobs.NewScheduler()
+	if config.IsAbandonedCartEnabled() {
+		abandonedCartJob := jobs.NewAbandonedCartJob(StStore, config, emailService, notifService)
+		scheduler.Every("abandoned-cart-reminders", config.GetAbandonedCartCheckInterval(), abandonedCartJob.Run)
+	}
+	if config.IsLowStockAlertEnabled() {
+		lowStockJob := jobs.NewLowStockJob(StStore, emailService, notifService)
+		scheduler.Every("low-stock-alerts", config.GetLowStockCheckInterval(), lowStockJob.Run)
+	}
+	if config.IsShipmentTrackingEnabled() {
+		shipmentJob := jobs.NewShipmentTrackingJob(StStore, shipmentTracker)
+		scheduler.Every("shipment-tracking", config.GetShipmentTrackingInterval(), shipmentJob.Run)
+	}
+	paymentJob := jobs.NewPaymentReconciliationJob(StStore, paymentReconciler, config.GetPaymentStaleAfter())
+	if config.IsPaymentReconciliationEnabled() {
+		scheduler.Every("payment-reconciliation", config.GetPaymentReconciliationInterval(), paymentJob.Run)
+	}
+	if config.IsPaymentReportEnabled() {
+		scheduler.Every("payment-reconciliation-report", config.GetPaymentReportInterval(), paymentJob.RunReport)
+	}
+	if config.IsPackageChangeJobEnabled() {
+		packageChangeJob := jobs.NewPackageChangeJob(StStore, notifService)
+		scheduler.Every("package-changes", config.GetPackageChangeInterval(), packageChangeJob.Run)
+	}
+	if config.IsBillingEnabled() {
+		renewalJob := jobs.NewRenewalJob(renewals)
+		scheduler.Every("subscription-renewals", config.GetBillingCheckInterval(), renewalJob.Run)
+	}
+	scheduler.Start()
+
+	router, err := GetRouter(config, StStore)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +157,7 @@ func NewServer() (*Service, error) {
 		config:       config,
 		photosrv:     GetPhotoService(),
 		notifService: notifService,
+		scheduler:    scheduler,
 	}
 
 	return &serv, nil
@@ -114,6 +183,9 @@ func (c *Service) Run() {
 }
 
 func (c *Service) Shutdown() {
+	if c.scheduler != nil {
+		c.scheduler.Stop()
+	}
 	if c.notifService != nil {
 		c.notifService.Close()
 	}
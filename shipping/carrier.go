@@ -0,0 +1,76 @@
+package shipping
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/shopspring/decimal"
+)
+
+// ========== CARRIER INTERFACE ==========
+
+var (
+	ErrUnknownShipment = errors.New("shipment not found at carrier")
+	ErrNotCancelable   = errors.New("shipment can no longer be canceled")
+)
+
+// Carrier books, tracks and cancels parcels with a courier
+type Carrier interface {
+	Name() string
+	CreateShipment(ctx context.Context, req ShipmentRequest) (*ShipmentResult, error)
+	Track(ctx context.Context, trackingNumber string) (*TrackingInfo, error)
+	Cancel(ctx context.Context, trackingNumber string) error
+}
+
+type Address struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Email   string `json:"email,omitempty"`
+	Address string `json:"address"`
+}
+
+type ParcelItem struct {
+	SKU      string `json:"sku,omitempty"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+// ShipmentRequest describes a parcel to book
+type ShipmentRequest struct {
+	Reference string       `json:"reference"` // Our reference, e.g. ORD-12-1
+	Sender    Address      `json:"sender"`
+	Recipient Address      `json:"recipient"`
+	Items     []ParcelItem `json:"items"`
+	Notes     string       `json:"notes,omitempty"`
+	// Cash the courier collects on delivery, set on the parcel that completes a
+	// cash on delivery order
+	CashOnDelivery *CashCollection `json:"cash_on_delivery,omitempty"`
+}
+
+type CashCollection struct {
+	Amount   decimal.Decimal `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// ShipmentResult is what the carrier returns for a booked parcel.
+// Label is a PDF; carriers that do not supply one get a generated label.
+type ShipmentResult struct {
+	TrackingNumber   string
+	CarrierReference string
+	Label            []byte
+}
+
+type TrackingEvent struct {
+	Status      dbmodels.ShipmentStatus
+	Description string
+	Location    string
+	OccurredAt  time.Time
+}
+
+// TrackingInfo is the current state of a parcel and its checkpoints, oldest first
+type TrackingInfo struct {
+	Status dbmodels.ShipmentStatus
+	Events []TrackingEvent
+}
@@ -0,0 +1,204 @@
+package shipping
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+)
+
+// ========== HTTP CARRIER ==========
+
+// HTTPCarrier adapts a courier exposing a JSON REST API:
+//
+//	POST {base}/shipments                    book a parcel
+//	GET  {base}/shipments/{tracking}/track   current status and checkpoints
+//	POST {base}/shipments/{tracking}/cancel  cancel before pickup
+//
+// Local couriers with a different contract get their own adapter implementing Carrier.
+// Courier status codes are translated with the configured status map.
+type HTTPCarrier struct {
+	config config.CarrierConfig
+	client *http.Client
+}
+
+func NewHTTPCarrier(cfg config.CarrierConfig) *HTTPCarrier {
+	timeout := 15 * time.Second
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	return &HTTPCarrier{
+		config: cfg,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+type httpShipmentResponse struct {
+	TrackingNumber string `json:"tracking_number"`
+	Reference      string `json:"reference"`
+	Label          string `json:"label"`     // Base64 PDF
+	LabelURL       string `json:"label_url"` // Used when the label is not inlined
+}
+
+type httpTrackingResponse struct {
+	Status string `json:"status"`
+	Events []struct {
+		Status      string    `json:"status"`
+		Description string    `json:"description"`
+		Location    string    `json:"location"`
+		Timestamp   time.Time `json:"timestamp"`
+	} `json:"events"`
+}
+
+func (h *HTTPCarrier) Name() string {
+	return h.config.Name
+}
+
+func (h *HTTPCarrier) CreateShipment(ctx context.Context, req ShipmentRequest) (*ShipmentResult, error) {
+	var resp httpShipmentResponse
+	if err := h.do(ctx, http.MethodPost, "/shipments", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.TrackingNumber == "" {
+		return nil, fmt.Errorf("%s: response has no tracking number", h.config.Name)
+	}
+
+	result := &ShipmentResult{
+		TrackingNumber:   resp.TrackingNumber,
+		CarrierReference: resp.Reference,
+	}
+	switch {
+	case resp.Label != "":
+		label, err := base64.StdEncoding.DecodeString(resp.Label)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid label: %w", h.config.Name, err)
+		}
+		result.Label = label
+	case resp.LabelURL != "":
+		label, err := h.download(ctx, resp.LabelURL)
+		if err != nil {
+			return nil, err
+		}
+		result.Label = label
+	default:
+		label, err := RenderLabel(h.config.Name, resp.TrackingNumber, req)
+		if err != nil {
+			return nil, err
+		}
+		result.Label = label
+	}
+	return result, nil
+}
+
+func (h *HTTPCarrier) Track(ctx context.Context, trackingNumber string) (*TrackingInfo, error) {
+	var resp httpTrackingResponse
+	if err := h.do(ctx, http.MethodGet, "/shipments/"+url.PathEscape(trackingNumber)+"/track", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	info := &TrackingInfo{Status: h.status(resp.Status)}
+	for _, event := range resp.Events {
+		info.Events = append(info.Events, TrackingEvent{
+			Status:      h.status(event.Status),
+			Description: event.Description,
+			Location:    event.Location,
+			OccurredAt:  event.Timestamp,
+		})
+	}
+	return info, nil
+}
+
+func (h *HTTPCarrier) Cancel(ctx context.Context, trackingNumber string) error {
+	return h.do(ctx, http.MethodPost, "/shipments/"+url.PathEscape(trackingNumber)+"/cancel", nil, nil)
+}
+
+// status maps a courier status code to a shipment status. Codes already named
+// like ours need no mapping; anything unknown counts as in transit.
+func (h *HTTPCarrier) status(code string) dbmodels.ShipmentStatus {
+	code = strings.TrimSpace(code)
+	if mapped, ok := h.config.StatusMap[code]; ok {
+		code = mapped
+	}
+	if value, ok := dbmodels.ShipmentStatus_value[strings.ToUpper(code)]; ok {
+		return dbmodels.ShipmentStatus(value)
+	}
+	return dbmodels.ShipmentStatus_IN_TRANSIT
+}
+
+func (h *HTTPCarrier) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(h.config.BaseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if h.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.config.APIKey)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrUnknownShipment
+	case resp.StatusCode == http.StatusConflict:
+		return ErrNotCancelable
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("%s API error (%d): %s", h.config.Name, resp.StatusCode, string(data))
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (h *HTTPCarrier) download(ctx context.Context, labelURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, labelURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.config.APIKey)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: label download failed with status %d", h.config.Name, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,54 @@
+package shipping
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// RenderLabel draws a simple A6 shipping label for carriers that do not return one
+func RenderLabel(carrier, trackingNumber string, req ShipmentRequest) ([]byte, error) {
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		UnitStr: "mm",
+		Size:    gofpdf.SizeType{Wd: 105, Ht: 148},
+	})
+	pdf.SetMargins(6, 6, 6)
+	pdf.AddPage()
+
+	pdf.SetFont("Arial", "B", 16)
+	pdf.CellFormat(0, 9, carrier, "", 1, "C", false, 0, "")
+	pdf.SetFont("Courier", "B", 14)
+	pdf.CellFormat(0, 9, trackingNumber, "1", 1, "C", false, 0, "")
+	pdf.Ln(3)
+
+	pdf.SetFont("Arial", "B", 9)
+	pdf.Cell(0, 5, "FROM")
+	pdf.Ln(5)
+	pdf.SetFont("Arial", "", 9)
+	pdf.MultiCell(0, 4, fmt.Sprintf("%s\n%s\n%s", req.Sender.Name, req.Sender.Phone, req.Sender.Address), "", "L", false)
+	pdf.Ln(2)
+
+	pdf.SetFont("Arial", "B", 11)
+	pdf.Cell(0, 6, "TO")
+	pdf.Ln(6)
+	pdf.SetFont("Arial", "", 11)
+	pdf.MultiCell(0, 5, fmt.Sprintf("%s\n%s\n%s", req.Recipient.Name, req.Recipient.Phone, req.Recipient.Address), "", "L", false)
+	pdf.Ln(2)
+
+	pdf.SetFont("Arial", "", 8)
+	pdf.Cell(0, 4, fmt.Sprintf("Ref: %s", req.Reference))
+	pdf.Ln(4)
+	for _, item := range req.Items {
+		pdf.Cell(0, 4, fmt.Sprintf("%d x %s", item.Quantity, item.Name))
+		pdf.Ln(4)
+	}
+	pdf.Cell(0, 4, time.Now().Format("2006-01-02 15:04"))
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
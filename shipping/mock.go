@@ -0,0 +1,100 @@
+package shipping
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+)
+
+// ========== MOCK CARRIER ==========
+
+// mockProgress is the route every mock parcel follows, one step per Track call
+var mockProgress = []TrackingEvent{
+	{Status: dbmodels.ShipmentStatus_IN_TRANSIT, Description: "Picked up by courier", Location: "Origin hub"},
+	{Status: dbmodels.ShipmentStatus_OUT_FOR_DELIVERY, Description: "Out for delivery", Location: "Destination hub"},
+	{Status: dbmodels.ShipmentStatus_DELIVERED, Description: "Delivered", Location: "Recipient address"},
+}
+
+// MockCarrier keeps parcels in memory, for development and tests
+type MockCarrier struct {
+	name    string
+	mu      sync.Mutex
+	seq     int
+	parcels map[string]*TrackingInfo
+}
+
+func NewMockCarrier(name string) *MockCarrier {
+	return &MockCarrier{
+		name:    name,
+		parcels: map[string]*TrackingInfo{},
+	}
+}
+
+func (m *MockCarrier) Name() string {
+	return m.name
+}
+
+func (m *MockCarrier) CreateShipment(ctx context.Context, req ShipmentRequest) (*ShipmentResult, error) {
+	m.mu.Lock()
+	m.seq++
+	trackingNumber := fmt.Sprintf("MOCK%d%04d", time.Now().Unix(), m.seq)
+	m.parcels[trackingNumber] = &TrackingInfo{
+		Status: dbmodels.ShipmentStatus_CREATED,
+		Events: []TrackingEvent{{
+			Status:      dbmodels.ShipmentStatus_CREATED,
+			Description: "Shipment created",
+			OccurredAt:  time.Now(),
+		}},
+	}
+	m.mu.Unlock()
+
+	label, err := RenderLabel(m.name, trackingNumber, req)
+	if err != nil {
+		return nil, err
+	}
+	return &ShipmentResult{TrackingNumber: trackingNumber, Label: label}, nil
+}
+
+// Track advances the parcel one step along its route and returns its history
+func (m *MockCarrier) Track(ctx context.Context, trackingNumber string) (*TrackingInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parcel, ok := m.parcels[trackingNumber]
+	if !ok {
+		return nil, ErrUnknownShipment
+	}
+	if !parcel.Status.IsFinal() {
+		step := mockProgress[len(parcel.Events)-1]
+		step.OccurredAt = time.Now()
+		parcel.Events = append(parcel.Events, step)
+		parcel.Status = step.Status
+	}
+
+	info := &TrackingInfo{Status: parcel.Status, Events: make([]TrackingEvent, len(parcel.Events))}
+	copy(info.Events, parcel.Events)
+	return info, nil
+}
+
+func (m *MockCarrier) Cancel(ctx context.Context, trackingNumber string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parcel, ok := m.parcels[trackingNumber]
+	if !ok {
+		return ErrUnknownShipment
+	}
+	if parcel.Status != dbmodels.ShipmentStatus_CREATED {
+		return ErrNotCancelable
+	}
+	parcel.Status = dbmodels.ShipmentStatus_CANCELED
+	parcel.Events = append(parcel.Events, TrackingEvent{
+		Status:      dbmodels.ShipmentStatus_CANCELED,
+		Description: "Shipment canceled",
+		OccurredAt:  time.Now(),
+	})
+	return nil
+}
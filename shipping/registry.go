@@ -0,0 +1,83 @@
+package shipping
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	config "github.com/mohammedrefaat/hamber/Config"
+)
+
+// ========== CARRIER REGISTRY ==========
+
+// Registry holds the carriers enabled in configuration
+type Registry struct {
+	carriers       map[string]Carrier
+	defaultCarrier string
+}
+
+// NewRegistry builds the enabled carriers. Without any, a mock carrier is
+// registered so shipments can still be recorded.
+func NewRegistry(cfg config.ShippingConfig) *Registry {
+	registry := &Registry{carriers: map[string]Carrier{}}
+	for _, carrierCfg := range cfg.Carriers {
+		if !carrierCfg.Enabled || carrierCfg.Name == "" {
+			continue
+		}
+		switch carrierCfg.Type {
+		case "mock":
+			registry.Register(NewMockCarrier(carrierCfg.Name))
+		case "http":
+			registry.Register(NewHTTPCarrier(carrierCfg))
+		default:
+			log.Printf("⚠️ Shipping: carrier %s has unknown type %q, skipped", carrierCfg.Name, carrierCfg.Type)
+		}
+	}
+	if len(registry.carriers) == 0 {
+		log.Println("⚠️ Shipping: no carrier is enabled; orders are shipped without booking one")
+		return registry
+	}
+
+	registry.defaultCarrier = cfg.DefaultCarrier
+	if _, ok := registry.carriers[registry.defaultCarrier]; !ok {
+		registry.defaultCarrier = registry.Names()[0]
+	}
+	return registry
+}
+
+// HasCarriers reports whether any carrier is enabled to book shipments with
+func (r *Registry) HasCarriers() bool {
+	return len(r.carriers) > 0
+}
+
+func (r *Registry) Register(carrier Carrier) {
+	r.carriers[carrier.Name()] = carrier
+}
+
+// Get returns the named carrier, or the default one when name is empty
+func (r *Registry) Get(name string) (Carrier, error) {
+	if name == "" {
+		name = r.defaultCarrier
+	}
+	if !r.HasCarriers() {
+		return nil, fmt.Errorf("no shipping carrier is enabled")
+	}
+	carrier, ok := r.carriers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown carrier: %s", name)
+	}
+	return carrier, nil
+}
+
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.carriers))
+	for name := range r.carriers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) Default() string {
+	return r.defaultCarrier
+}
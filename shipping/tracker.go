@@ -0,0 +1,158 @@
+package shipping
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/notification"
+	"github.com/mohammedrefaat/hamber/receipts"
+	"github.com/mohammedrefaat/hamber/stores"
+)
+
+// ========== TRACKING ==========
+
+// Tracker refreshes shipments from their carrier and keeps the customer informed
+type Tracker struct {
+	Carriers     *Registry
+	store        *stores.DbStore
+	emailService *notification.EmailService
+	notifService *notification.NotificationService
+	receipts     *receipts.Service
+}
+
+func NewTracker(carriers *Registry, store *stores.DbStore, emailService *notification.EmailService, notifService *notification.NotificationService, receiptService *receipts.Service) *Tracker {
+	return &Tracker{
+		Carriers:     carriers,
+		store:        store,
+		emailService: emailService,
+		notifService: notifService,
+		receipts:     receiptService,
+	}
+}
+
+// Refresh asks the carrier for the shipment's progress, stores new checkpoints and
+// notifies the customer when there are any. It returns the new checkpoints.
+func (t *Tracker) Refresh(ctx context.Context, shipment *dbmodels.Shipment) ([]dbmodels.ShipmentEvent, error) {
+	carrier, err := t.Carriers.Get(shipment.Carrier)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := carrier.Track(ctx, shipment.TrackingNumber)
+	if err != nil {
+		if markErr := t.store.MarkShipmentTracked(shipment.ID); markErr != nil {
+			log.Printf("Shipments: failed to mark shipment %d tracked: %v", shipment.ID, markErr)
+		}
+		return nil, err
+	}
+
+	events := make([]dbmodels.ShipmentEvent, 0, len(info.Events))
+	for _, event := range info.Events {
+		events = append(events, dbmodels.ShipmentEvent{
+			Status:      event.Status,
+			Description: event.Description,
+			Location:    event.Location,
+			OccurredAt:  event.OccurredAt,
+		})
+	}
+
+	added, orderDelivered, err := t.store.RecordShipmentTracking(shipment.ID, info.Status, events)
+	if err != nil {
+		return nil, err
+	}
+	shipment.Status = info.Status
+
+	if len(added) > 0 {
+		t.NotifyCustomer(shipment, added[len(added)-1])
+	}
+	if orderDelivered && t.notifService != nil {
+		if order, err := t.store.GetOrderByID(shipment.OrderID); err == nil {
+			go t.notifService.NotifyOrderStatusChange(order.UserID, order.ID, dbmodels.OrderStatus_DELIVERED.String())
+		}
+	}
+	if orderDelivered && t.receipts != nil {
+		go t.receipts.SendAutomatically(shipment.OrderID, dbmodels.ReceiptTriggerDelivered)
+	}
+	if orderDelivered {
+		t.reportCashCollected(shipment)
+	}
+	return added, nil
+}
+
+// reportCashCollected sends a delivered order's cash on delivery payment to the
+// store for confirmation, as the courier has collected it
+func (t *Tracker) reportCashCollected(shipment *dbmodels.Shipment) {
+	collected, err := t.store.ReportCashCollected(shipment.OrderID, shipment.Carrier+" "+shipment.TrackingNumber)
+	if err != nil {
+		log.Printf("Shipments: cash collection for order %d not recorded: %v", shipment.OrderID, err)
+		return
+	}
+	if collected != nil && t.notifService != nil {
+		go t.notifService.NotifyPaymentReview(shipment.StoreOwnerID, collected.PaymentID,
+			fmt.Sprintf("%s collected cash on delivery for order #%d", shipment.Carrier, shipment.OrderID))
+	}
+}
+
+// NotifyCustomer emails the order's client about a checkpoint and, when the client
+// has an account, sends an in-app notification as well
+func (t *Tracker) NotifyCustomer(shipment *dbmodels.Shipment, event dbmodels.ShipmentEvent) {
+	order, err := t.store.GetOrderByID(shipment.OrderID)
+	if err != nil {
+		log.Printf("Shipments: order %d of shipment %d not found", shipment.OrderID, shipment.ID)
+		return
+	}
+	email := order.Client.Email
+	if email == "" {
+		return
+	}
+
+	status := statusText(event.Status)
+	if t.emailService != nil && t.emailService.IsConfigured() {
+		subject := fmt.Sprintf("Your order #%d is %s", order.ID, status)
+		if err := t.emailService.Send(email, subject, renderShipmentEmail(order, shipment, event)); err != nil {
+			log.Printf("Shipments: email to %s failed: %v", email, err)
+		}
+	}
+
+	if t.notifService == nil {
+		return
+	}
+	customer, err := t.store.GetUserByEmail(email)
+	if err != nil || customer.ID == order.UserID {
+		return
+	}
+	if err := t.notifService.NotifyShipmentUpdate(customer.ID, order.ID, shipment.Carrier, shipment.TrackingNumber, status); err != nil {
+		log.Printf("Shipments: notification for order %d failed: %v", order.ID, err)
+	}
+}
+
+// statusText turns OUT_FOR_DELIVERY into "out for delivery"
+func statusText(status dbmodels.ShipmentStatus) string {
+	return strings.ToLower(strings.ReplaceAll(status.String(), "_", " "))
+}
+
+func renderShipmentEmail(order *dbmodels.Order, shipment *dbmodels.Shipment, event dbmodels.ShipmentEvent) string {
+	location := ""
+	if event.Location != "" {
+		location = "<p>Location: " + html.EscapeString(event.Location) + "</p>"
+	}
+
+	return `<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; color: #333;">
+    <h2>Order #` + fmt.Sprint(order.ID) + ` is ` + statusText(event.Status) + `</h2>
+    <p>Hi ` + html.EscapeString(order.Client.Name) + `,</p>
+    <p>` + html.EscapeString(event.Description) + `</p>
+    ` + location + `
+    <table cellpadding="6" style="border-collapse: collapse;" border="1">
+        <tr><th>Carrier</th><td>` + html.EscapeString(shipment.Carrier) + `</td></tr>
+        <tr><th>Tracking number</th><td>` + html.EscapeString(shipment.TrackingNumber) + `</td></tr>
+        <tr><th>Updated</th><td>` + event.OccurredAt.Format("2006-01-02 15:04") + `</td></tr>
+    </table>
+</body>
+</html>`
+}
@@ -21,16 +21,16 @@ func (store *DbStore) GetDashboardStats(userID uint) (*dbmodels.DashboardStats,
 	store.db.Model(&dbmodels.Order{}).Where("user_id = ? AND status = ?", userID, dbmodels.OrderStatus_DELIVERED).Count(&stats.CompletedOrders)
 
 	// Total Revenue
-	store.db.Model(&dbmodels.Order{}).Where("user_id = ?", userID).Select("COALESCE(SUM(total), 0)").Scan(&stats.TotalRevenue)
+	store.db.Model(&dbmodels.Order{}).Where("user_id = ?", userID).Select("COALESCE(SUM(base_total), 0)").Scan(&stats.TotalRevenue)
 
 	// Monthly Revenue
 	startOfMonth := time.Now().AddDate(0, 0, -time.Now().Day()+1)
-	store.db.Model(&dbmodels.Order{}).Where("user_id = ? AND created_at >= ?", userID, startOfMonth).Select("COALESCE(SUM(total), 0)").Scan(&stats.MonthlyRevenue)
+	store.db.Model(&dbmodels.Order{}).Where("user_id = ? AND created_at >= ?", userID, startOfMonth).Select("COALESCE(SUM(base_total), 0)").Scan(&stats.MonthlyRevenue)
 
 	// Products
 	store.db.Model(&dbmodels.Product{}).Where("user_id = ?", userID).Count(&stats.TotalProducts)
 	store.db.Model(&dbmodels.Product{}).Where("user_id = ? AND is_active = ?", userID, true).Count(&stats.ActiveProducts)
-	store.db.Model(&dbmodels.Product{}).Where("user_id = ? AND quantity < ?", userID, 10).Count(&stats.LowStockCount)
+	stats.LowStockCount = store.CountLowStockProducts(userID)
 
 	// Clients
 	store.db.Model(&dbmodels.Client{}).Where("user_id = ?", userID).Count(&stats.TotalClients)
@@ -66,6 +66,11 @@ func (store *DbStore) GetDashboardStats(userID uint) (*dbmodels.DashboardStats,
 	// Addons
 	store.db.Model(&dbmodels.UserAddonSubscription{}).Where("user_id = ? AND status = ?", userID, dbmodels.AddonSubscriptionStatus_ACTIVE).Count(&stats.ActiveAddons)
 
+	// Abandoned carts
+	store.db.Model(&dbmodels.CartRecovery{}).Where("store_owner_id = ?", userID).Count(&stats.AbandonedCarts)
+	store.db.Model(&dbmodels.CartRecovery{}).Where("store_owner_id = ? AND status = ?", userID, dbmodels.CartRecoveryStatus_RECOVERED).Count(&stats.RecoveredCarts)
+	store.db.Model(&dbmodels.CartRecovery{}).Where("store_owner_id = ? AND status = ?", userID, dbmodels.CartRecoveryStatus_RECOVERED).Select("COALESCE(SUM(recovered_amount), 0)").Scan(&stats.RecoveredRevenue)
+
 	return stats, nil
 }
 
@@ -76,7 +81,7 @@ func (store *DbStore) GetRevenueChartData(userID uint) ([]map[string]interface{}
 	query := `
 		SELECT 
 			TO_CHAR(created_at, 'Mon YYYY') as month,
-			COALESCE(SUM(total), 0) as revenue,
+			COALESCE(SUM(base_total), 0) as revenue,
 			COUNT(*) as order_count
 		FROM orders
 		WHERE user_id = ? AND created_at >= ?
@@ -124,9 +129,10 @@ func (store *DbStore) GetTopSellingProducts(userID uint, limit int) ([]map[strin
 			p.name,
 			p.price,
 			COALESCE(SUM(oi.quantity), 0) as total_sold,
-			COALESCE(SUM(oi.quantity * oi.price), 0) as total_revenue
+			COALESCE(ROUND(SUM(oi.quantity * oi.price / o.exchange_rate), 2), 0) as total_revenue
 		FROM products p
 		LEFT JOIN order_items oi ON p.id = oi.product_id
+		LEFT JOIN orders o ON o.id = oi.order_id
 		WHERE p.user_id = ?
 		GROUP BY p.id, p.name, p.price
 		ORDER BY total_sold DESC
@@ -202,9 +208,7 @@ func (store *DbStore) GetProductStatistics(userID uint) (map[string]interface{},
 	stats["by_category"] = byCategory
 
 	// Low stock
-	var lowStock int64
-	store.db.Model(&dbmodels.Product{}).Where("user_id = ? AND quantity < ?", userID, 10).Count(&lowStock)
-	stats["low_stock"] = lowStock
+	stats["low_stock"] = store.CountLowStockProducts(userID)
 
 	// Out of stock
 	var outOfStock int64
@@ -241,7 +245,7 @@ func (store *DbStore) GetClientStatistics(userID uint) (map[string]interface{},
 			c.name,
 			c.email,
 			COUNT(o.id) as order_count,
-			COALESCE(SUM(o.total), 0) as total_spent
+			COALESCE(SUM(o.base_total), 0) as total_spent
 		FROM clients c
 		LEFT JOIN orders o ON c.id = o.client_id
 		WHERE c.user_id = ?
@@ -257,7 +261,8 @@ func (store *DbStore) GetClientStatistics(userID uint) (map[string]interface{},
 
 // ========== ADMIN DASHBOARD ==========
 
-func (store *DbStore) GetAdminDashboardStats() (map[string]interface{}, error) {
+// GetAdminDashboardStats reports platform totals, with revenue converted into currency
+func (store *DbStore) GetAdminDashboardStats(currency string) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
 	// Users
@@ -273,12 +278,11 @@ func (store *DbStore) GetAdminDashboardStats() (map[string]interface{}, error) {
 
 	// Orders
 	var totalOrders int64
-	var totalRevenue float64
 	store.db.Model(&dbmodels.Order{}).Count(&totalOrders)
-	store.db.Model(&dbmodels.Order{}).Select("COALESCE(SUM(total), 0)").Scan(&totalRevenue)
 
 	stats["total_orders"] = totalOrders
-	stats["total_revenue"] = totalRevenue
+	stats["total_revenue"] = store.sumOrdersInCurrency(store.db.Model(&dbmodels.Order{}), currency)
+	stats["currency"] = currency
 
 	// Products
 	var totalProducts int64
@@ -301,7 +305,8 @@ func (store *DbStore) GetAdminDashboardStats() (map[string]interface{}, error) {
 	return stats, nil
 }
 
-func (store *DbStore) GetPlatformAnalytics() (map[string]interface{}, error) {
+// GetPlatformAnalytics reports platform analytics, with revenue converted into currency
+func (store *DbStore) GetPlatformAnalytics(currency string) (map[string]interface{}, error) {
 	analytics := make(map[string]interface{})
 
 	// User distribution by package
@@ -314,18 +319,20 @@ func (store *DbStore) GetPlatformAnalytics() (map[string]interface{}, error) {
 
 	// Revenue by month (last 12 months)
 	var revenueByMonth []map[string]interface{}
+	rate, args := platformRateExpr("base_currency", currency)
 	query := `
 		SELECT 
 			TO_CHAR(created_at, 'Mon YYYY') as month,
-			COALESCE(SUM(total), 0) as revenue
+			COALESCE(ROUND(SUM(base_total * ` + rate + `), 2), 0) as revenue
 		FROM orders
 		WHERE created_at >= ?
 		GROUP BY TO_CHAR(created_at, 'Mon YYYY'), DATE_TRUNC('month', created_at)
 		ORDER BY DATE_TRUNC('month', created_at) ASC
 	`
 	startDate := time.Now().AddDate(-1, 0, 0)
-	store.db.Raw(query, startDate).Scan(&revenueByMonth)
+	store.db.Raw(query, append(args, startDate)...).Scan(&revenueByMonth)
 	analytics["revenue_by_month"] = revenueByMonth
+	analytics["currency"] = currency
 
 	return analytics, nil
 }
@@ -354,13 +361,16 @@ func (store *DbStore) GetUserGrowthChart() ([]map[string]interface{}, error) {
 	return chartData, nil
 }
 
-func (store *DbStore) GetRevenueBreakdown() (map[string]interface{}, error) {
+// GetRevenueBreakdown groups platform revenue, converted into currency, by payment and order status
+func (store *DbStore) GetRevenueBreakdown(currency string) (map[string]interface{}, error) {
 	breakdown := make(map[string]interface{})
+	rate, args := platformRateExpr("base_currency", currency)
+	revenue := "COALESCE(ROUND(SUM(base_total * " + rate + "), 2), 0) as revenue"
 
 	// Revenue by payment status
 	var byPaymentStatus []map[string]interface{}
 	store.db.Model(&dbmodels.Order{}).
-		Select("payment_status, COALESCE(SUM(total), 0) as revenue, COUNT(*) as count").
+		Select("payment_status, "+revenue+", COUNT(*) as count", args...).
 		Group("payment_status").
 		Scan(&byPaymentStatus)
 	breakdown["by_payment_status"] = byPaymentStatus
@@ -368,10 +378,11 @@ func (store *DbStore) GetRevenueBreakdown() (map[string]interface{}, error) {
 	// Revenue by order status
 	var byOrderStatus []map[string]interface{}
 	store.db.Model(&dbmodels.Order{}).
-		Select("status, COALESCE(SUM(total), 0) as revenue, COUNT(*) as count").
+		Select("status, "+revenue+", COUNT(*) as count", args...).
 		Group("status").
 		Scan(&byOrderStatus)
 	breakdown["by_order_status"] = byOrderStatus
+	breakdown["currency"] = currency
 
 	return breakdown, nil
 }
@@ -142,25 +142,17 @@ func (store *DbStore) CheckExpiredSubscriptions() error {
 
 // ========== ADDON USAGE TRACKING ==========
 
-func (store *DbStore) LogAddonUsage(log *dbmodels.AddonUsageLog) error {
-	// Start transaction
-	tx := store.db.Begin()
-
-	// Create usage log
-	if err := tx.Create(log).Error; err != nil {
-		tx.Rollback()
-		return err
-	}
+// Usage is recorded with ReserveAddonUsage, which enforces the quota
 
-	// Update subscription usage count
-	if err := tx.Model(&dbmodels.UserAddonSubscription{}).
-		Where("id = ?", log.SubscriptionID).
-		UpdateColumn("usage_count", tx.Raw("usage_count + ?", log.UsageAmount)).Error; err != nil {
-		tx.Rollback()
-		return err
+func (store *DbStore) GetAddonUsageLog(id uint) (*dbmodels.AddonUsageLog, error) {
+	var usageLog dbmodels.AddonUsageLog
+	if err := store.db.First(&usageLog, id).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Usage log not found",
+			Code:    http.StatusNotFound,
+		}
 	}
-
-	return tx.Commit().Error
+	return &usageLog, nil
 }
 
 func (store *DbStore) GetAddonUsageLogs(subscriptionID uint, page, limit int) ([]dbmodels.AddonUsageLog, int64, error) {
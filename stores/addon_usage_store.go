@@ -0,0 +1,357 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========== ADD-ON USAGE QUOTAS ==========
+
+// UsageQuota is what is left of a subscription's usage limit and of the
+// overage allowed in its current period
+type UsageQuota struct {
+	SubscriptionID   uint            `json:"subscription_id"`
+	AddonID          uint            `json:"addon_id"`
+	UsageUnit        string          `json:"usage_unit"`
+	Limit            *int            `json:"limit"` // Units included; nil is unlimited
+	Used             int             `json:"used"`
+	Remaining        *int            `json:"remaining"` // Included units left; nil is unlimited
+	OveragePrice     decimal.Decimal `json:"overage_price"`
+	OverageUsed      int             `json:"overage_used"`      // Units past the limit this period
+	OverageRemaining *int            `json:"overage_remaining"` // Units past the limit still allowed this period; nil is no cap
+	PeriodStart      time.Time       `json:"period_start"`
+	PeriodEnd        time.Time       `json:"period_end"`
+}
+
+// usageQuota computes the quota of a subscription with its addon loaded, given
+// the overage already used in the current period
+func usageQuota(subscription *dbmodels.UserAddonSubscription, periodStart, periodEnd time.Time, overageUsed int) *UsageQuota {
+	addon := &subscription.Addon
+	quota := &UsageQuota{
+		SubscriptionID: subscription.ID,
+		AddonID:        subscription.AddonID,
+		UsageUnit:      addon.UsageUnit,
+		Limit:          subscription.UsageLimit,
+		Used:           subscription.UsageCount,
+		OveragePrice:   addon.OveragePrice,
+		OverageUsed:    overageUsed,
+		PeriodStart:    periodStart,
+		PeriodEnd:      periodEnd,
+	}
+	if subscription.UsageLimit != nil {
+		remaining := max(*subscription.UsageLimit-subscription.UsageCount, 0)
+		quota.Remaining = &remaining
+
+		// Overage is uncapped only when it is priced and has no per-period limit
+		if !addon.OveragePrice.IsPositive() || addon.OverageLimit > 0 {
+			overageRemaining := 0
+			if addon.OveragePrice.IsPositive() {
+				overageRemaining = max(addon.OverageLimit-overageUsed, 0)
+			}
+			quota.OverageRemaining = &overageRemaining
+		}
+	}
+	return quota
+}
+
+// GetUsageQuota returns a subscription's quota as of now
+func (store *DbStore) GetUsageQuota(subscriptionID uint) (*UsageQuota, error) {
+	subscription, err := store.GetAddonSubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	periodStart, periodEnd := subscription.Addon.UsagePeriod(subscription.StartDate, time.Now())
+	var period dbmodels.AddonUsagePeriod
+	overageUsed := 0
+	if err := store.db.Where("subscription_id = ? AND period_start = ?", subscription.ID, periodStart).
+		First(&period).Error; err == nil {
+		overageUsed = period.OverageUnits
+	}
+	return usageQuota(subscription, periodStart, periodEnd, overageUsed), nil
+}
+
+// ReserveAddonUsage records units of usage against an active subscription, if
+// they fit its quota. The subscription row is locked, so concurrent reservations
+// cannot go past the limit together. Units past the usage limit are overage,
+// priced in the current period, when the add-on has an overage price; otherwise
+// they are refused with 402. Overage past the add-on's per-period cap is refused
+// with 429. The quota is returned also when the reservation is refused.
+func (store *DbStore) ReserveAddonUsage(subscriptionID uint, units int, description, metadata string) (*dbmodels.AddonUsageLog, *UsageQuota, error) {
+	var usageLog *dbmodels.AddonUsageLog
+	var quota *UsageQuota
+
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		usageLog, quota, err = reserveAddonUsage(tx, subscriptionID, units, description, metadata, time.Now())
+		return err
+	})
+	if err != nil {
+		if _, ok := err.(*CustomError); ok {
+			return nil, quota, err
+		}
+		return nil, nil, &CustomError{
+			Message: "Failed to log usage",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return usageLog, quota, nil
+}
+
+// ReserveUserAddonUsage is ReserveAddonUsage against the user's active
+// subscription to the add-on. Without one the reservation is refused with 402.
+func (store *DbStore) ReserveUserAddonUsage(userID, addonID uint, units int, description string) (*dbmodels.AddonUsageLog, *UsageQuota, error) {
+	var subscription dbmodels.UserAddonSubscription
+	now := time.Now()
+	if err := store.db.Select("id").
+		Where("user_id = ? AND addon_id = ? AND status = ? AND (end_date IS NULL OR end_date > ?)",
+			userID, addonID, dbmodels.AddonSubscriptionStatus_ACTIVE, now).
+		Order("start_date DESC").
+		First(&subscription).Error; err != nil {
+		return nil, nil, &CustomError{
+			Message: "No active subscription to this add-on",
+			Code:    http.StatusPaymentRequired,
+		}
+	}
+	return store.ReserveAddonUsage(subscription.ID, units, description, "")
+}
+
+func reserveAddonUsage(tx *gorm.DB, subscriptionID uint, units int, description, metadata string, now time.Time) (*dbmodels.AddonUsageLog, *UsageQuota, error) {
+	if units < 1 {
+		return nil, nil, &CustomError{Message: "Usage must be at least one unit", Code: http.StatusBadRequest}
+	}
+
+	var subscription dbmodels.UserAddonSubscription
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&subscription, subscriptionID).Error; err != nil {
+		return nil, nil, &CustomError{Message: "Subscription not found", Code: http.StatusNotFound}
+	}
+	if err := tx.First(&subscription.Addon, subscription.AddonID).Error; err != nil {
+		return nil, nil, &CustomError{Message: "Add-on not found", Code: http.StatusNotFound}
+	}
+	if subscription.Status != dbmodels.AddonSubscriptionStatus_ACTIVE ||
+		(subscription.EndDate != nil && !subscription.EndDate.After(now)) {
+		return nil, nil, &CustomError{Message: "Subscription is not active", Code: http.StatusBadRequest}
+	}
+
+	addon := &subscription.Addon
+	periodStart, periodEnd := addon.UsagePeriod(subscription.StartDate, now)
+	period, err := openUsagePeriod(tx, &subscription, periodStart, periodEnd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	overage := 0
+	if subscription.UsageLimit != nil {
+		remaining := max(*subscription.UsageLimit-subscription.UsageCount, 0)
+		if units > remaining {
+			overage = units - remaining
+		}
+	}
+	if overage > 0 {
+		quota := usageQuota(&subscription, periodStart, periodEnd, period.OverageUnits)
+		if !addon.OveragePrice.IsPositive() {
+			return nil, quota, &CustomError{
+				Message: fmt.Sprintf("Usage limit reached: %d %s left", *quota.Remaining, addon.UsageUnit),
+				Code:    http.StatusPaymentRequired,
+			}
+		}
+		if addon.OverageLimit > 0 && period.OverageUnits+overage > addon.OverageLimit {
+			return nil, quota, &CustomError{
+				Message: fmt.Sprintf("Overage limit for this period reached: %d %s left until %s", *quota.OverageRemaining, addon.UsageUnit, periodEnd.Format(time.RFC3339)),
+				Code:    http.StatusTooManyRequests,
+			}
+		}
+	}
+
+	period.UsedUnits += units
+	period.OverageUnits += overage
+	period.OverageAmount = money.Multiply(period.UnitPrice, period.OverageUnits)
+	if err := tx.Model(period).Updates(map[string]interface{}{
+		"used_units":     period.UsedUnits,
+		"overage_units":  period.OverageUnits,
+		"overage_amount": period.OverageAmount,
+	}).Error; err != nil {
+		return nil, nil, err
+	}
+
+	usageLog := &dbmodels.AddonUsageLog{
+		SubscriptionID: subscription.ID,
+		PeriodID:       &period.ID,
+		UsageAmount:    units,
+		OverageUnits:   overage,
+		Description:    description,
+		Metadata:       metadata,
+	}
+	if err := tx.Create(usageLog).Error; err != nil {
+		return nil, nil, err
+	}
+
+	subscription.UsageCount += units
+	if err := tx.Model(&subscription).UpdateColumn("usage_count", subscription.UsageCount).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return usageLog, usageQuota(&subscription, periodStart, periodEnd, period.OverageUnits), nil
+}
+
+// openUsagePeriod returns the subscription's period starting at periodStart,
+// creating it, locked for update
+func openUsagePeriod(tx *gorm.DB, subscription *dbmodels.UserAddonSubscription, periodStart, periodEnd time.Time) (*dbmodels.AddonUsagePeriod, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&dbmodels.AddonUsagePeriod{
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		AddonID:        subscription.AddonID,
+		PeriodStart:    periodStart,
+		PeriodEnd:      periodEnd,
+		UnitPrice:      subscription.Addon.OveragePrice,
+		Currency:       subscription.Addon.Currency,
+		Status:         dbmodels.UsagePeriodStatus_OPEN,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	var period dbmodels.AddonUsagePeriod
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("subscription_id = ? AND period_start = ?", subscription.ID, periodStart).
+		First(&period).Error; err != nil {
+		return nil, err
+	}
+	return &period, nil
+}
+
+// ReleaseAddonUsage gives back the units of a usage log, e.g. when the request
+// they were reserved for failed. Usage already billed is not released.
+func (store *DbStore) ReleaseAddonUsage(logID uint) error {
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		var usageLog dbmodels.AddonUsageLog
+		if err := tx.First(&usageLog, logID).Error; err != nil {
+			return &CustomError{Message: "Usage log not found", Code: http.StatusNotFound}
+		}
+
+		var subscription dbmodels.UserAddonSubscription
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&subscription, usageLog.SubscriptionID).Error; err != nil {
+			return &CustomError{Message: "Subscription not found", Code: http.StatusNotFound}
+		}
+
+		if usageLog.PeriodID != nil {
+			var period dbmodels.AddonUsagePeriod
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&period, *usageLog.PeriodID).Error; err != nil {
+				return err
+			}
+			if period.Status != dbmodels.UsagePeriodStatus_OPEN {
+				return &CustomError{Message: "Usage of a billed period cannot be released", Code: http.StatusConflict}
+			}
+			period.UsedUnits -= usageLog.UsageAmount
+			period.OverageUnits -= usageLog.OverageUnits
+			if err := tx.Model(&period).Updates(map[string]interface{}{
+				"used_units":     period.UsedUnits,
+				"overage_units":  period.OverageUnits,
+				"overage_amount": money.Multiply(period.UnitPrice, period.OverageUnits),
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&subscription).
+			UpdateColumn("usage_count", subscription.UsageCount-usageLog.UsageAmount).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&usageLog).Error
+	})
+	if err != nil {
+		if _, ok := err.(*CustomError); ok {
+			return err
+		}
+		return &CustomError{
+			Message: "Failed to release usage",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// GetUsagePeriods returns a subscription's usage summaries, newest period first
+func (store *DbStore) GetUsagePeriods(subscriptionID uint, page, limit int) ([]dbmodels.AddonUsagePeriod, int64, error) {
+	var periods []dbmodels.AddonUsagePeriod
+	var total int64
+
+	query := store.db.Model(&dbmodels.AddonUsagePeriod{}).Where("subscription_id = ?", subscriptionID)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count usage periods",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Offset(offset).Limit(limit).Order("period_start DESC").Find(&periods).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch usage periods",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return periods, total, nil
+}
+
+// billUsagePeriods adds the overage of the user's ended, unbilled usage periods
+// to a renewal invoice about to be created, converted to its currency, and
+// returns the periods to link once it has an ID. Ended periods without overage
+// are closed.
+func billUsagePeriods(tx *gorm.DB, invoice *dbmodels.SubscriptionInvoice, now time.Time) ([]uint, error) {
+	if err := tx.Model(&dbmodels.AddonUsagePeriod{}).
+		Where("user_id = ? AND status = ? AND period_end <= ? AND overage_amount = 0",
+			invoice.UserID, dbmodels.UsagePeriodStatus_OPEN, now).
+		Update("status", dbmodels.UsagePeriodStatus_CLOSED).Error; err != nil {
+		return nil, err
+	}
+
+	var periods []dbmodels.AddonUsagePeriod
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND status = ? AND period_end <= ? AND invoice_id IS NULL",
+			invoice.UserID, dbmodels.UsagePeriodStatus_OPEN, now).
+		Find(&periods).Error; err != nil {
+		return nil, err
+	}
+
+	usage := decimal.Zero
+	ids := make([]uint, 0, len(periods))
+	for _, period := range periods {
+		rate, err := exchangeRate(tx, period.Currency, invoice.Currency)
+		if err != nil {
+			var customErr *CustomError
+			if errors.As(err, &customErr) && customErr.Code == http.StatusBadRequest {
+				// Left for a later invoice once the rate is set
+				continue
+			}
+			return nil, err
+		}
+		usage = usage.Add(money.Convert(period.OverageAmount, rate))
+		ids = append(ids, period.ID)
+	}
+
+	invoice.UsageAmount = usage
+	invoice.Amount = invoice.Amount.Add(usage)
+	return ids, nil
+}
+
+// releaseInvoiceUsage returns the usage periods billed with the invoices
+// matching the condition to be billed again, before those invoices are voided
+func releaseInvoiceUsage(tx *gorm.DB, query string, args ...interface{}) error {
+	invoices := tx.Model(&dbmodels.SubscriptionInvoice{}).Select("id").Where(query, args...)
+	return tx.Model(&dbmodels.AddonUsagePeriod{}).
+		Where("invoice_id IN (?)", invoices).
+		Updates(map[string]interface{}{
+			"status":     dbmodels.UsagePeriodStatus_OPEN,
+			"invoice_id": nil,
+		}).Error
+}
@@ -0,0 +1,562 @@
+package stores
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========== SUBSCRIPTION BILLING ==========
+
+type InvoiceFilter struct {
+	UserID uint
+	Status *dbmodels.InvoiceStatus
+}
+
+// latestSubscription limits a subscription query to each user's newest subscription
+const latestSubscription = "NOT EXISTS (SELECT 1 FROM subscriptions newer WHERE newer.user_id = subscriptions.user_id AND newer.start_date > subscriptions.start_date)"
+
+func recordSubscriptionEvent(tx *gorm.DB, event *dbmodels.SubscriptionEvent) error {
+	return tx.Create(event).Error
+}
+
+// voidOpenInvoices voids the user's unpaid renewal invoices
+func voidOpenInvoices(tx *gorm.DB, userID uint) error {
+	if err := releaseInvoiceUsage(tx, "user_id = ? AND status = ?", userID, dbmodels.InvoiceStatus_OPEN); err != nil {
+		return err
+	}
+	return tx.Model(&dbmodels.SubscriptionInvoice{}).
+		Where("user_id = ? AND status = ?", userID, dbmodels.InvoiceStatus_OPEN).
+		Updates(map[string]interface{}{
+			"status":          dbmodels.InvoiceStatus_VOID,
+			"next_attempt_at": nil,
+		}).Error
+}
+
+// renewSubscription settles a renewal invoice and starts the period it paid
+// for. Paid before or during the grace period, the new period follows the old
+// one; paid after suspension or downgrade, it starts now and the user gets the
+// package back.
+func renewSubscription(tx *gorm.DB, invoiceID uint, paymentID uint) error {
+	var invoice dbmodels.SubscriptionInvoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, invoiceID).Error; err != nil {
+		return &CustomError{Message: "Invoice not found", Code: http.StatusNotFound}
+	}
+	if invoice.Status == dbmodels.InvoiceStatus_PAID || invoice.Status == dbmodels.InvoiceStatus_VOID {
+		return recordSubscriptionEvent(tx, &dbmodels.SubscriptionEvent{
+			UserID:         invoice.UserID,
+			SubscriptionID: &invoice.SubscriptionID,
+			InvoiceID:      &invoice.ID,
+			PaymentID:      &paymentID,
+			Type:           dbmodels.SubscriptionEventType_DUPLICATE_PAYMENT,
+			Message:        fmt.Sprintf("Invoice is already %s; payment %d should be refunded", invoice.Status, paymentID),
+		})
+	}
+
+	var previous dbmodels.Subscription
+	if err := tx.First(&previous, invoice.SubscriptionID).Error; err != nil {
+		return &CustomError{Message: "Subscription not found", Code: http.StatusNotFound}
+	}
+	var pkg dbmodels.Package
+	if err := tx.First(&pkg, invoice.PackageID).Error; err != nil {
+		return &CustomError{Message: "Package not found", Code: http.StatusNotFound}
+	}
+
+	now := time.Now()
+	start := invoice.PeriodStart
+	eventType := dbmodels.SubscriptionEventType_RENEWED
+	if invoice.Status == dbmodels.InvoiceStatus_UNCOLLECTIBLE ||
+		previous.Status == dbmodels.SubscriptionStatus_SUSPENDED || previous.Status == dbmodels.SubscriptionStatus_ENDED {
+		start = now
+		eventType = dbmodels.SubscriptionEventType_REACTIVATED
+
+		// Replaces the suspended subscription or the free one it was downgraded to
+		if err := tx.Model(&dbmodels.Subscription{}).
+			Where("user_id = ? AND start_date <= ? AND status <> ?", invoice.UserID, now, dbmodels.SubscriptionStatus_ENDED).
+			Updates(map[string]interface{}{
+				"end_date": gorm.Expr("LEAST(end_date, ?)", now),
+				"status":   dbmodels.SubscriptionStatus_ENDED,
+			}).Error; err != nil {
+			return err
+		}
+	} else if err := tx.Model(&previous).Update("status", dbmodels.SubscriptionStatus_ENDED).Error; err != nil {
+		return err
+	}
+
+	subscription := dbmodels.Subscription{
+		UserID:    invoice.UserID,
+		PackageID: invoice.PackageID,
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, pkg.Duration),
+		Price:     invoice.Amount.Sub(invoice.UsageAmount),
+	}
+	if err := tx.Create(&subscription).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&dbmodels.User{}).
+		Where("id = ?", invoice.UserID).
+		Update("package_id", invoice.PackageID).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&invoice).Updates(map[string]interface{}{
+		"status":          dbmodels.InvoiceStatus_PAID,
+		"payment_id":      paymentID,
+		"paid_at":         &now,
+		"next_attempt_at": nil,
+	}).Error; err != nil {
+		return err
+	}
+
+	return recordSubscriptionEvent(tx, &dbmodels.SubscriptionEvent{
+		UserID:         invoice.UserID,
+		SubscriptionID: &subscription.ID,
+		InvoiceID:      &invoice.ID,
+		PaymentID:      &paymentID,
+		Type:           eventType,
+		Message:        fmt.Sprintf("%s until %s", pkg.Name, subscription.EndDate.Format("2006-01-02")),
+	})
+}
+
+// GetRenewableSubscriptions returns paid subscriptions ending before the given
+// time that are renewed and have no renewal invoice yet
+func (store *DbStore) GetRenewableSubscriptions(endingBefore time.Time, limit int) ([]dbmodels.Subscription, error) {
+	var subscriptions []dbmodels.Subscription
+	if err := store.db.Preload("Package").
+		Where("subscriptions.status = ? AND subscriptions.end_date <= ? AND subscriptions.cancel_at_period_end = ?",
+			dbmodels.SubscriptionStatus_ACTIVE, endingBefore, false).
+		Where("EXISTS (SELECT 1 FROM packages WHERE packages.id = subscriptions.package_id AND packages.price > 0)").
+		Where("NOT EXISTS (SELECT 1 FROM subscription_invoices WHERE subscription_invoices.subscription_id = subscriptions.id AND subscription_invoices.status <> ?)",
+			dbmodels.InvoiceStatus_VOID).
+		Where(latestSubscription).
+		Order("subscriptions.end_date ASC").
+		Limit(limit).
+		Find(&subscriptions).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch renewable subscriptions",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return subscriptions, nil
+}
+
+// CreateSubscriptionInvoice stores a renewal invoice and records its issue
+func (store *DbStore) CreateSubscriptionInvoice(invoice *dbmodels.SubscriptionInvoice) error {
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		periodIDs, err := billUsagePeriods(tx, invoice, time.Now())
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(invoice).Error; err != nil {
+			return err
+		}
+		if len(periodIDs) > 0 {
+			if err := tx.Model(&dbmodels.AddonUsagePeriod{}).
+				Where("id IN ?", periodIDs).
+				Updates(map[string]interface{}{
+					"status":     dbmodels.UsagePeriodStatus_INVOICED,
+					"invoice_id": invoice.ID,
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		message := fmt.Sprintf("Renewal of %s due %s", money.Format(invoice.Amount), invoice.DueAt.Format("2006-01-02"))
+		if invoice.UsageAmount.IsPositive() {
+			message += fmt.Sprintf(", including %s of add-on usage", money.Format(invoice.UsageAmount))
+		}
+		return recordSubscriptionEvent(tx, &dbmodels.SubscriptionEvent{
+			UserID:         invoice.UserID,
+			SubscriptionID: &invoice.SubscriptionID,
+			InvoiceID:      &invoice.ID,
+			Type:           dbmodels.SubscriptionEventType_INVOICE_ISSUED,
+			Message:        message,
+		})
+	})
+	if err != nil {
+		return &CustomError{
+			Message: "Failed to create renewal invoice",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// GetDueInvoices returns open invoices whose next payment attempt is due
+func (store *DbStore) GetDueInvoices(now time.Time, maxAttempts, limit int) ([]dbmodels.SubscriptionInvoice, error) {
+	var invoices []dbmodels.SubscriptionInvoice
+	if err := store.db.Preload("Package").Preload("Payment").
+		Where("status = ? AND next_attempt_at <= ? AND attempts < ?", dbmodels.InvoiceStatus_OPEN, now, maxAttempts).
+		Order("next_attempt_at ASC").
+		Limit(limit).
+		Find(&invoices).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch due invoices",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return invoices, nil
+}
+
+// RecordInvoiceAttempt counts a payment attempt on an open invoice, schedules
+// the next one (nil when attempts are exhausted) and records the event
+func (store *DbStore) RecordInvoiceAttempt(invoice *dbmodels.SubscriptionInvoice, paymentID *uint, nextAttemptAt *time.Time, event *dbmodels.SubscriptionEvent) error {
+	now := time.Now()
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_attempt_at": &now,
+			"next_attempt_at": nextAttemptAt,
+		}
+		if paymentID != nil {
+			updates["payment_id"] = *paymentID
+		}
+		if err := tx.Model(&dbmodels.SubscriptionInvoice{}).
+			Where("id = ? AND status = ?", invoice.ID, dbmodels.InvoiceStatus_OPEN).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordSubscriptionEvent(tx, event)
+	})
+	if err != nil {
+		return &CustomError{
+			Message: "Failed to record payment attempt",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// GetEndedSubscriptions returns active subscriptions whose period ended and that
+// nothing replaced
+func (store *DbStore) GetEndedSubscriptions(now time.Time, limit int) ([]dbmodels.Subscription, error) {
+	var subscriptions []dbmodels.Subscription
+	if err := store.db.Preload("Package").
+		Where("subscriptions.status = ? AND subscriptions.end_date <= ?", dbmodels.SubscriptionStatus_ACTIVE, now).
+		Where(latestSubscription).
+		Order("subscriptions.end_date ASC").
+		Limit(limit).
+		Find(&subscriptions).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch ended subscriptions",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return subscriptions, nil
+}
+
+// GetGraceExpiredSubscriptions returns past due subscriptions that ended before the cutoff
+func (store *DbStore) GetGraceExpiredSubscriptions(endedBefore time.Time, limit int) ([]dbmodels.Subscription, error) {
+	var subscriptions []dbmodels.Subscription
+	if err := store.db.Preload("Package").
+		Where("status = ? AND end_date <= ?", dbmodels.SubscriptionStatus_PAST_DUE, endedBefore).
+		Order("end_date ASC").
+		Limit(limit).
+		Find(&subscriptions).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch past due subscriptions",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return subscriptions, nil
+}
+
+// SetSubscriptionStatus moves a subscription to a new status and records why.
+// A nil event records nothing.
+func (store *DbStore) SetSubscriptionStatus(id uint, status dbmodels.SubscriptionStatus, event *dbmodels.SubscriptionEvent) error {
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&dbmodels.Subscription{}).Where("id = ?", id).Update("status", status).Error; err != nil {
+			return err
+		}
+		if event == nil {
+			return nil
+		}
+		return recordSubscriptionEvent(tx, event)
+	})
+	if err != nil {
+		return &CustomError{
+			Message: "Failed to update subscription",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// RenewFreeSubscription starts the next period of a free subscription
+func (store *DbStore) RenewFreeSubscription(previous *dbmodels.Subscription) (*dbmodels.Subscription, error) {
+	next := dbmodels.Subscription{
+		UserID:    previous.UserID,
+		PackageID: previous.PackageID,
+		StartDate: previous.EndDate,
+		EndDate:   previous.EndDate.AddDate(0, 0, previous.Package.Duration),
+		Price:     previous.Package.Price,
+	}
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(previous).Update("status", dbmodels.SubscriptionStatus_ENDED).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&next).Error; err != nil {
+			return err
+		}
+		return recordSubscriptionEvent(tx, &dbmodels.SubscriptionEvent{
+			UserID:         next.UserID,
+			SubscriptionID: &next.ID,
+			Type:           dbmodels.SubscriptionEventType_RENEWED,
+			Message:        fmt.Sprintf("%s until %s", previous.Package.Name, next.EndDate.Format("2006-01-02")),
+		})
+	})
+	if err != nil {
+		return nil, &CustomError{
+			Message: "Failed to renew subscription",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return &next, nil
+}
+
+// DowngradeSubscription ends a subscription and moves the user to the free
+// package. Open invoices are closed with invoiceStatus. A package with a price
+// is refused, as renewals would go on billing it.
+func (store *DbStore) DowngradeSubscription(previous *dbmodels.Subscription, freePackageID uint, invoiceStatus dbmodels.InvoiceStatus, message string) (*dbmodels.Subscription, error) {
+	if freePackageID == 0 {
+		return nil, &CustomError{Message: "No free package is configured", Code: http.StatusInternalServerError}
+	}
+	var free dbmodels.Package
+	if err := store.db.First(&free, freePackageID).Error; err != nil {
+		return nil, &CustomError{Message: "Free package not found", Code: http.StatusNotFound}
+	}
+	if free.Price.IsPositive() {
+		return nil, &CustomError{
+			Message: fmt.Sprintf("The %s package costs %s and cannot be used as the free package", free.Name, money.Format(free.Price)),
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	now := time.Now()
+	next := dbmodels.Subscription{
+		UserID:    previous.UserID,
+		PackageID: free.ID,
+		StartDate: now,
+		EndDate:   now.AddDate(0, 0, free.Duration),
+		Price:     free.Price,
+	}
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if invoiceStatus == dbmodels.InvoiceStatus_VOID {
+			if err := releaseInvoiceUsage(tx, "subscription_id = ? AND status = ?", previous.ID, dbmodels.InvoiceStatus_OPEN); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&dbmodels.SubscriptionInvoice{}).
+			Where("subscription_id = ? AND status = ?", previous.ID, dbmodels.InvoiceStatus_OPEN).
+			Updates(map[string]interface{}{"status": invoiceStatus, "next_attempt_at": nil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(previous).Update("status", dbmodels.SubscriptionStatus_ENDED).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&next).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&dbmodels.User{}).
+			Where("id = ?", previous.UserID).
+			Update("package_id", free.ID).Error; err != nil {
+			return err
+		}
+		return recordSubscriptionEvent(tx, &dbmodels.SubscriptionEvent{
+			UserID:         previous.UserID,
+			SubscriptionID: &next.ID,
+			Type:           dbmodels.SubscriptionEventType_DOWNGRADED,
+			Message:        message,
+		})
+	})
+	if err != nil {
+		return nil, &CustomError{
+			Message: "Failed to downgrade subscription",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return &next, nil
+}
+
+// SuspendSubscription withholds a past due subscription whose invoice was not paid
+func (store *DbStore) SuspendSubscription(subscription *dbmodels.Subscription, message string) error {
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&dbmodels.SubscriptionInvoice{}).
+			Where("subscription_id = ? AND status = ?", subscription.ID, dbmodels.InvoiceStatus_OPEN).
+			Updates(map[string]interface{}{"status": dbmodels.InvoiceStatus_UNCOLLECTIBLE, "next_attempt_at": nil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(subscription).Update("status", dbmodels.SubscriptionStatus_SUSPENDED).Error; err != nil {
+			return err
+		}
+		return recordSubscriptionEvent(tx, &dbmodels.SubscriptionEvent{
+			UserID:         subscription.UserID,
+			SubscriptionID: &subscription.ID,
+			Type:           dbmodels.SubscriptionEventType_SUSPENDED,
+			Message:        message,
+		})
+	})
+	if err != nil {
+		return &CustomError{
+			Message: "Failed to suspend subscription",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// GetLatestSubscription returns the user's newest subscription, current or scheduled
+func (store *DbStore) GetLatestSubscription(userID uint) (*dbmodels.Subscription, error) {
+	var subscription dbmodels.Subscription
+	if err := store.db.Preload("Package").
+		Where("user_id = ?", userID).
+		Order("start_date DESC").
+		First(&subscription).Error; err != nil {
+		return nil, &CustomError{
+			Message: "No subscription found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &subscription, nil
+}
+
+// SetCancelAtPeriodEnd turns renewal of a subscription off or back on. Turning
+// it off voids the open renewal invoice.
+func (store *DbStore) SetCancelAtPeriodEnd(subscription *dbmodels.Subscription, cancel bool) error {
+	event := dbmodels.SubscriptionEvent{
+		UserID:         subscription.UserID,
+		SubscriptionID: &subscription.ID,
+		Type:           dbmodels.SubscriptionEventType_RESUMED,
+		Message:        "Renewal turned back on",
+	}
+	if cancel {
+		event.Type = dbmodels.SubscriptionEventType_CANCELLED
+		event.Message = fmt.Sprintf("Ends %s without renewal", subscription.EndDate.Format("2006-01-02"))
+	}
+
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(subscription).Update("cancel_at_period_end", cancel).Error; err != nil {
+			return err
+		}
+		if cancel {
+			if err := releaseInvoiceUsage(tx, "subscription_id = ? AND status = ?", subscription.ID, dbmodels.InvoiceStatus_OPEN); err != nil {
+				return err
+			}
+			if err := tx.Model(&dbmodels.SubscriptionInvoice{}).
+				Where("subscription_id = ? AND status = ?", subscription.ID, dbmodels.InvoiceStatus_OPEN).
+				Updates(map[string]interface{}{"status": dbmodels.InvoiceStatus_VOID, "next_attempt_at": nil}).Error; err != nil {
+				return err
+			}
+		}
+		return recordSubscriptionEvent(tx, &event)
+	})
+	if err != nil {
+		return &CustomError{
+			Message: "Failed to update subscription",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// GetLastPackagePaymentMethod returns the gateway of the user's latest paid
+// package payment, or "" if there is none
+func (store *DbStore) GetLastPackagePaymentMethod(userID uint) string {
+	var payment dbmodels.Payment
+	if err := store.db.Select("payment_method").
+		Where("user_id = ? AND package_id IS NOT NULL AND payment_status = ? AND transaction_id <> ?",
+			userID, dbmodels.PaymentStatus_PAID, "NO_PAYMENT_REQUIRED").
+		Order("paid_at DESC").
+		First(&payment).Error; err != nil {
+		return ""
+	}
+	return payment.PaymentMethod
+}
+
+func (store *DbStore) GetSubscriptionInvoice(id uint) (*dbmodels.SubscriptionInvoice, error) {
+	var invoice dbmodels.SubscriptionInvoice
+	if err := store.db.Preload("Package").Preload("Payment").First(&invoice, id).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Invoice not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &invoice, nil
+}
+
+// GetSubscriptionInvoices lists renewal invoices newest first
+func (store *DbStore) GetSubscriptionInvoices(filter InvoiceFilter, page, limit int) ([]dbmodels.SubscriptionInvoice, int64, error) {
+	var invoices []dbmodels.SubscriptionInvoice
+	var total int64
+
+	query := store.db.Model(&dbmodels.SubscriptionInvoice{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count invoices",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Preload("Package").
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&invoices).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch invoices",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return invoices, total, nil
+}
+
+// GetSubscriptionEvents lists billing lifecycle events newest first; userID 0 lists all users
+func (store *DbStore) GetSubscriptionEvents(userID uint, page, limit int) ([]dbmodels.SubscriptionEvent, int64, error) {
+	var events []dbmodels.SubscriptionEvent
+	var total int64
+
+	query := store.db.Model(&dbmodels.SubscriptionEvent{})
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count subscription events",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Order("created_at DESC, id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&events).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch subscription events",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return events, total, nil
+}
+
+// RecordSubscriptionEvent stores a lifecycle event outside a transition
+func (store *DbStore) RecordSubscriptionEvent(event *dbmodels.SubscriptionEvent) error {
+	return recordSubscriptionEvent(store.db, event)
+}
@@ -0,0 +1,145 @@
+package stores
+
+import (
+	"net/http"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// ========== ABANDONED CART RECOVERY ==========
+
+// IdleCart is a cart (per user, or per guest session) whose last change is older than the idle threshold
+type IdleCart struct {
+	UserID         *uint
+	SessionID      string
+	StoreOwnerID   uint
+	LastActivityAt time.Time
+	CartTotal      decimal.Decimal
+	ItemCount      int
+}
+
+// GetIdleCarts groups cart items into carts and returns those untouched since idleSince
+func (store *DbStore) GetIdleCarts(idleSince time.Time) ([]IdleCart, error) {
+	var carts []IdleCart
+	query := `
+		SELECT
+			ci.user_id AS user_id,
+			CASE WHEN ci.user_id IS NULL THEN ci.session_id ELSE '' END AS session_id,
+			p.user_id AS store_owner_id,
+			MAX(ci.updated_at) AS last_activity_at,
+			COALESCE(SUM(ci.price * ci.quantity), 0) AS cart_total,
+			COALESCE(SUM(ci.quantity), 0) AS item_count
+		FROM cart_items ci
+		JOIN products p ON p.id = ci.product_id
+		GROUP BY ci.user_id, CASE WHEN ci.user_id IS NULL THEN ci.session_id ELSE '' END, p.user_id
+		HAVING MAX(ci.updated_at) < ?
+	`
+	if err := store.db.Raw(query, idleSince).Scan(&carts).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch idle carts",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return carts, nil
+}
+
+func (store *DbStore) CreateCartRecovery(recovery *dbmodels.CartRecovery) error {
+	return store.db.Create(recovery).Error
+}
+
+func (store *DbStore) UpdateCartRecovery(recovery *dbmodels.CartRecovery) error {
+	return store.db.Save(recovery).Error
+}
+
+// GetOpenCartRecovery returns the open recovery for a user's or guest session's cart
+func (store *DbStore) GetOpenCartRecovery(userID *uint, sessionID string) (*dbmodels.CartRecovery, error) {
+	var recovery dbmodels.CartRecovery
+	query := store.db.Where("status = ?", dbmodels.CartRecoveryStatus_OPEN)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	} else {
+		query = query.Where("user_id IS NULL AND session_id = ?", sessionID)
+	}
+
+	if err := query.Order("created_at DESC").First(&recovery).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Cart recovery not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &recovery, nil
+}
+
+func (store *DbStore) GetCartRecoveryByToken(token string) (*dbmodels.CartRecovery, error) {
+	var recovery dbmodels.CartRecovery
+	if err := store.db.Preload("Coupon").Where("restore_token = ?", token).First(&recovery).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Cart recovery link is invalid",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &recovery, nil
+}
+
+// ExpireEmptyCartRecoveries closes open recoveries whose cart has been emptied without an order
+func (store *DbStore) ExpireEmptyCartRecoveries() error {
+	return store.db.Exec(`
+		UPDATE cart_recoveries cr SET status = ?, updated_at = ?
+		WHERE cr.status = ? AND NOT EXISTS (
+			SELECT 1 FROM cart_items ci
+			WHERE (cr.user_id IS NOT NULL AND ci.user_id = cr.user_id)
+			   OR (cr.user_id IS NULL AND ci.user_id IS NULL AND ci.session_id = cr.session_id)
+		)`,
+		dbmodels.CartRecoveryStatus_EXPIRED, time.Now(), dbmodels.CartRecoveryStatus_OPEN).Error
+}
+
+// MarkCartRecovered attributes an order to the cart's open recovery. Carts that never
+// received a reminder were not really recovered, so their tracking row is removed instead.
+func (store *DbStore) MarkCartRecovered(userID *uint, sessionID string, orderID uint, amount decimal.Decimal) error {
+	recovery, err := store.GetOpenCartRecovery(userID, sessionID)
+	if err != nil {
+		return nil
+	}
+
+	if recovery.ReminderCount == 0 {
+		return store.db.Delete(&dbmodels.CartRecovery{}, recovery.ID).Error
+	}
+
+	now := time.Now()
+	return store.db.Model(&dbmodels.CartRecovery{}).
+		Where("id = ?", recovery.ID).
+		Updates(map[string]interface{}{
+			"status":             dbmodels.CartRecoveryStatus_RECOVERED,
+			"recovered_order_id": orderID,
+			"recovered_amount":   amount,
+			"recovered_at":       &now,
+		}).Error
+}
+
+// GetCartRecoveryStats summarizes recovery for a store since the given time
+func (store *DbStore) GetCartRecoveryStats(storeOwnerID uint, since time.Time) (*dbmodels.CartRecoveryStats, error) {
+	stats := &dbmodels.CartRecoveryStats{}
+
+	base := store.db.Model(&dbmodels.CartRecovery{}).
+		Where("store_owner_id = ? AND created_at >= ?", storeOwnerID, since).
+		Session(&gorm.Session{})
+	if err := base.Count(&stats.AbandonedCarts).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch cart recovery stats",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	base.Where("reminder_count > 0").Count(&stats.RemindedCarts)
+	base.Where("status = ?", dbmodels.CartRecoveryStatus_RECOVERED).Count(&stats.RecoveredCarts)
+	base.Where("status = ?", dbmodels.CartRecoveryStatus_RECOVERED).
+		Select("COALESCE(SUM(recovered_amount), 0)").Scan(&stats.RecoveredRevenue)
+
+	if stats.RemindedCarts > 0 {
+		stats.RecoveryRate = float64(stats.RecoveredCarts) / float64(stats.RemindedCarts) * 100
+	}
+
+	return stats, nil
+}
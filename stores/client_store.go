@@ -0,0 +1,547 @@
+package stores
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm"
+)
+
+// ========== CLIENT MANAGEMENT ==========
+
+// FindOrCreateClient matches a store's client by email, creating one if none exists.
+// Contact details of an existing client are refreshed with the latest non-empty values.
+func (store *DbStore) FindOrCreateClient(storeOwnerID uint, name, email, phone, address string) (*dbmodels.Client, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var client dbmodels.Client
+	err := store.db.Where("user_id = ? AND LOWER(email) = ?", storeOwnerID, email).First(&client).Error
+	if err == nil {
+		updates := map[string]interface{}{}
+		if phone != "" && phone != client.Phone {
+			updates["phone"] = phone
+		}
+		if address != "" && address != client.Address {
+			updates["address"] = address
+		}
+		if len(updates) > 0 {
+			if err := store.db.Model(&client).Updates(updates).Error; err != nil {
+				return nil, &CustomError{
+					Message: "Failed to update client",
+					Code:    http.StatusInternalServerError,
+				}
+			}
+		}
+		return &client, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &CustomError{
+			Message: "Failed to fetch client",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	client = dbmodels.Client{
+		Name:    name,
+		Email:   email,
+		Phone:   phone,
+		Address: address,
+		UserID:  storeOwnerID,
+	}
+	if err := store.db.Create(&client).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to create client",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return &client, nil
+}
+
+// clientMetricsQuery aggregates non-canceled orders per client
+func (store *DbStore) clientMetricsQuery() *gorm.DB {
+	return store.db.Model(&dbmodels.Order{}).
+		Select("client_id, COUNT(*) AS order_count, COALESCE(SUM(base_total), 0) AS lifetime_value, MIN(created_at) AS first_order_at, MAX(created_at) AS last_order_at").
+		Where("status <> ?", dbmodels.OrderStatus_CANCELED).
+		Group("client_id")
+}
+
+// SearchClients lists a store's clients with their order metrics.
+// query matches name, email, phone or company; sort is newest, name, lifetime_value, order_count or last_order.
+func (store *DbStore) SearchClients(storeOwnerID uint, query, tag, sortBy string, page, limit int) ([]dbmodels.ClientListItem, int64, error) {
+	var clients []dbmodels.ClientListItem
+	var total int64
+
+	base := store.db.Table("clients").Where("clients.user_id = ?", storeOwnerID)
+	if query != "" {
+		like := "%" + strings.ToLower(query) + "%"
+		base = base.Where("LOWER(clients.name) LIKE ? OR LOWER(clients.email) LIKE ? OR clients.phone LIKE ? OR LOWER(clients.company) LIKE ?",
+			like, like, like, like)
+	}
+	if tag != "" {
+		base = base.Where("clients.tags LIKE ?", `%"`+tag+`"%`)
+	}
+
+	if err := base.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count clients",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	order := "clients.created_at DESC"
+	switch sortBy {
+	case "name":
+		order = "clients.name ASC"
+	case "lifetime_value":
+		order = "lifetime_value DESC"
+	case "order_count":
+		order = "order_count DESC"
+	case "last_order":
+		order = "m.last_order_at DESC NULLS LAST"
+	}
+
+	offset := (page - 1) * limit
+	if err := base.
+		Select("clients.id, clients.name, clients.email, clients.phone, clients.company, clients.tags, clients.created_at, "+
+			"COALESCE(m.order_count, 0) AS order_count, COALESCE(m.lifetime_value, 0) AS lifetime_value, m.last_order_at").
+		Joins("LEFT JOIN (?) m ON m.client_id = clients.id", store.clientMetricsQuery()).
+		Order(order).
+		Offset(offset).
+		Limit(limit).
+		Scan(&clients).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch clients",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return clients, total, nil
+}
+
+// GetStoreClient returns a client with its addresses, only if it belongs to the store owner
+func (store *DbStore) GetStoreClient(id, storeOwnerID uint) (*dbmodels.Client, error) {
+	var client dbmodels.Client
+	if err := store.db.Preload("Addresses").
+		Where("id = ? AND user_id = ?", id, storeOwnerID).
+		First(&client).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Client not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &client, nil
+}
+
+func (store *DbStore) GetClientMetrics(clientID uint) (*dbmodels.ClientMetrics, error) {
+	var metrics dbmodels.ClientMetrics
+	if err := store.db.Table("(?) AS m", store.clientMetricsQuery().Where("client_id = ?", clientID)).
+		Scan(&metrics).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to compute client metrics",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if metrics.OrderCount > 0 {
+		metrics.AverageOrderValue = metrics.LifetimeValue / float64(metrics.OrderCount)
+	}
+	return &metrics, nil
+}
+
+func (store *DbStore) CreateClient(client *dbmodels.Client) error {
+	client.Email = strings.ToLower(strings.TrimSpace(client.Email))
+
+	var count int64
+	store.db.Model(&dbmodels.Client{}).
+		Where("user_id = ? AND LOWER(email) = ?", client.UserID, client.Email).
+		Count(&count)
+	if count > 0 {
+		return &CustomError{
+			Message: "A client with this email already exists",
+			Code:    http.StatusConflict,
+		}
+	}
+
+	if err := store.db.Create(client).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to create client",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) UpdateClient(client *dbmodels.Client) error {
+	return store.db.Omit("User", "Addresses").Save(client).Error
+}
+
+// DeleteClient removes a client without orders, along with its addresses and notes
+func (store *DbStore) DeleteClient(id uint) error {
+	var orderCount int64
+	store.db.Model(&dbmodels.Order{}).Where("client_id = ?", id).Count(&orderCount)
+	if orderCount > 0 {
+		return &CustomError{
+			Message: "Client has orders and cannot be deleted; merge it into another client instead",
+			Code:    http.StatusConflict,
+		}
+	}
+
+	tx := store.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Where("client_id = ?", id).Delete(&dbmodels.ClientAddress{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("client_id = ?", id).Delete(&dbmodels.ClientNote{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(&dbmodels.Client{}, id).Error; err != nil {
+		tx.Rollback()
+		return &CustomError{
+			Message: "Failed to delete client",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// ========== CLIENT ADDRESSES & NOTES ==========
+
+// SaveClientAddress creates or updates an address; a default address clears the flag on the others
+func (store *DbStore) SaveClientAddress(address *dbmodels.ClientAddress) error {
+	tx := store.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if address.IsDefault {
+		if err := tx.Model(&dbmodels.ClientAddress{}).
+			Where("client_id = ? AND id <> ?", address.ClientID, address.ID).
+			Update("is_default", false).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Save(address).Error; err != nil {
+		tx.Rollback()
+		return &CustomError{
+			Message: "Failed to save address",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+func (store *DbStore) GetClientAddress(id, clientID uint) (*dbmodels.ClientAddress, error) {
+	var address dbmodels.ClientAddress
+	if err := store.db.Where("id = ? AND client_id = ?", id, clientID).First(&address).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Address not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &address, nil
+}
+
+func (store *DbStore) DeleteClientAddress(id uint) error {
+	return store.db.Delete(&dbmodels.ClientAddress{}, id).Error
+}
+
+func (store *DbStore) CreateClientNote(note *dbmodels.ClientNote) error {
+	if err := store.db.Create(note).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to add note",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) GetClientNotes(clientID uint) ([]dbmodels.ClientNote, error) {
+	var notes []dbmodels.ClientNote
+	if err := store.db.Where("client_id = ?", clientID).Order("created_at DESC").Find(&notes).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch notes",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return notes, nil
+}
+
+func (store *DbStore) DeleteClientNote(id, clientID uint) error {
+	result := store.db.Where("id = ? AND client_id = ?", id, clientID).Delete(&dbmodels.ClientNote{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &CustomError{
+			Message: "Note not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+// ========== CLIENT TIMELINE ==========
+
+// GetClientTimeline merges the client's orders, receipts, messages with the store and notes, newest first
+func (store *DbStore) GetClientTimeline(client *dbmodels.Client, limit int) ([]dbmodels.ClientTimelineEntry, error) {
+	var timeline []dbmodels.ClientTimelineEntry
+
+	var orders []dbmodels.Order
+	if err := store.db.Where("client_id = ?", client.ID).Order("created_at DESC").Limit(limit).Find(&orders).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch client orders",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	orderIDs := make([]uint, 0, len(orders))
+	for _, order := range orders {
+		total := order.Total
+		orderIDs = append(orderIDs, order.ID)
+		timeline = append(timeline, dbmodels.ClientTimelineEntry{
+			Type:        "order",
+			ReferenceID: order.ID,
+			Title:       fmt.Sprintf("Order #%d placed", order.ID),
+			Description: order.Status.String(),
+			Amount:      &total,
+			OccurredAt:  order.CreatedAt,
+		})
+	}
+
+	if len(orderIDs) > 0 {
+		var receipts []dbmodels.OrderReceipt
+		store.db.Where("order_id IN ?", orderIDs).Find(&receipts)
+		for _, receipt := range receipts {
+			occurredAt := receipt.CreatedAt
+			if receipt.GeneratedAt != nil {
+				occurredAt = *receipt.GeneratedAt
+			}
+			timeline = append(timeline, dbmodels.ClientTimelineEntry{
+				Type:        "receipt",
+				ReferenceID: receipt.ID,
+				Title:       "Receipt " + receipt.ReceiptNumber,
+				Description: fmt.Sprintf("For order #%d", receipt.OrderID),
+				OccurredAt:  occurredAt,
+			})
+		}
+	}
+
+	// Messages exchanged with a registered user sharing the client's email
+	var userIDs []uint
+	store.db.Model(&dbmodels.User{}).Where("LOWER(email) = ?", strings.ToLower(client.Email)).Pluck("id", &userIDs)
+	if len(userIDs) > 0 {
+		var messages []dbmodels.Message
+		store.db.Where("(sender_id = ? AND receiver_id IN ?) OR (sender_id IN ? AND receiver_id = ?)",
+			client.UserID, userIDs, userIDs, client.UserID).
+			Where("is_draft = ?", false).
+			Order("created_at DESC").
+			Limit(limit).
+			Find(&messages)
+		for _, message := range messages {
+			direction := "Message from client"
+			if message.SenderID == client.UserID {
+				direction = "Message to client"
+			}
+			timeline = append(timeline, dbmodels.ClientTimelineEntry{
+				Type:        "message",
+				ReferenceID: message.ID,
+				Title:       direction,
+				Description: message.Subject,
+				OccurredAt:  message.CreatedAt,
+			})
+		}
+	}
+
+	notes, err := store.GetClientNotes(client.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		timeline = append(timeline, dbmodels.ClientTimelineEntry{
+			Type:        "note",
+			ReferenceID: note.ID,
+			Title:       "Note",
+			Description: note.Body,
+			OccurredAt:  note.CreatedAt,
+		})
+	}
+
+	sort.Slice(timeline, func(i, j int) bool {
+		return timeline[i].OccurredAt.After(timeline[j].OccurredAt)
+	})
+	if len(timeline) > limit {
+		timeline = timeline[:limit]
+	}
+	return timeline, nil
+}
+
+// ========== DUPLICATES & MERGE ==========
+
+// FindDuplicateClients groups a store's clients that share an email or a phone number
+func (store *DbStore) FindDuplicateClients(storeOwnerID uint) ([]dbmodels.ClientDuplicateGroup, error) {
+	var clients []dbmodels.Client
+	if err := store.db.Where("user_id = ?", storeOwnerID).Order("created_at ASC").Find(&clients).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch clients",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	byEmail := map[string][]dbmodels.Client{}
+	byPhone := map[string][]dbmodels.Client{}
+	var emails, phones []string
+	for _, client := range clients {
+		email := strings.ToLower(strings.TrimSpace(client.Email))
+		if email != "" {
+			if _, seen := byEmail[email]; !seen {
+				emails = append(emails, email)
+			}
+			byEmail[email] = append(byEmail[email], client)
+		}
+		phone := strings.TrimSpace(client.Phone)
+		if phone != "" {
+			if _, seen := byPhone[phone]; !seen {
+				phones = append(phones, phone)
+			}
+			byPhone[phone] = append(byPhone[phone], client)
+		}
+	}
+
+	var groups []dbmodels.ClientDuplicateGroup
+	for _, email := range emails {
+		if len(byEmail[email]) > 1 {
+			groups = append(groups, dbmodels.ClientDuplicateGroup{MatchedOn: "email", Value: email, Clients: byEmail[email]})
+		}
+	}
+	for _, phone := range phones {
+		if len(byPhone[phone]) > 1 {
+			groups = append(groups, dbmodels.ClientDuplicateGroup{MatchedOn: "phone", Value: phone, Clients: byPhone[phone]})
+		}
+	}
+	return groups, nil
+}
+
+// MergeClients moves orders, reviews, addresses and notes of the duplicates to the primary
+// client, fills in missing contact details and deletes the duplicates
+func (store *DbStore) MergeClients(primary *dbmodels.Client, duplicates []dbmodels.Client) error {
+	tx := store.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	ids := make([]uint, 0, len(duplicates))
+	for _, duplicate := range duplicates {
+		ids = append(ids, duplicate.ID)
+		if primary.Phone == "" {
+			primary.Phone = duplicate.Phone
+		}
+		if primary.Address == "" {
+			primary.Address = duplicate.Address
+		}
+		if primary.Company == "" {
+			primary.Company = duplicate.Company
+		}
+		primary.Tags = MergeTags(primary.Tags, duplicate.Tags)
+	}
+
+	for _, model := range []interface{}{&dbmodels.Order{}, &dbmodels.ProductReview{}, &dbmodels.ClientNote{}} {
+		if err := tx.Model(model).Where("client_id IN ?", ids).Update("client_id", primary.ID).Error; err != nil {
+			tx.Rollback()
+			return &CustomError{
+				Message: "Failed to move client records",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+	}
+	// Moved addresses never take over the primary's default
+	if err := tx.Model(&dbmodels.ClientAddress{}).Where("client_id IN ?", ids).
+		Updates(map[string]interface{}{"client_id": primary.ID, "is_default": false}).Error; err != nil {
+		tx.Rollback()
+		return &CustomError{
+			Message: "Failed to move client addresses",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	if err := tx.Omit("User", "Addresses").Save(primary).Error; err != nil {
+		tx.Rollback()
+		return &CustomError{
+			Message: "Failed to update client",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if err := tx.Delete(&dbmodels.Client{}, ids).Error; err != nil {
+		tx.Rollback()
+		return &CustomError{
+			Message: "Failed to delete duplicate clients",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// GetStoreClientsByIDs returns the clients among ids that belong to the store owner
+func (store *DbStore) GetStoreClientsByIDs(ids []uint, storeOwnerID uint) ([]dbmodels.Client, error) {
+	var clients []dbmodels.Client
+	if err := store.db.Where("id IN ? AND user_id = ?", ids, storeOwnerID).Find(&clients).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch clients",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return clients, nil
+}
+
+// MergeTags unions two JSON tag arrays, keeping the order of first appearance
+func MergeTags(a, b string) string {
+	var left, right []string
+	json.Unmarshal([]byte(a), &left)
+	json.Unmarshal([]byte(b), &right)
+
+	seen := map[string]bool{}
+	merged := []string{}
+	for _, tag := range append(left, right...) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		merged = append(merged, tag)
+	}
+	out, _ := json.Marshal(merged)
+	return string(out)
+}
+
+// GetClientByEmail returns the store's client with the email, or nil if there is none
+func (store *DbStore) GetClientByEmail(storeOwnerID uint, email string) (*dbmodels.Client, error) {
+	var clients []dbmodels.Client
+	if err := store.db.Where("user_id = ? AND LOWER(email) = ?", storeOwnerID, strings.ToLower(strings.TrimSpace(email))).
+		Limit(1).Find(&clients).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch client",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if len(clients) == 0 {
+		return nil, nil
+	}
+	return &clients[0], nil
+}
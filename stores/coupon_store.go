@@ -0,0 +1,52 @@
+package stores
+
+import (
+	"net/http"
+	"strings"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm"
+)
+
+// ========== COUPON MANAGEMENT ==========
+
+func (store *DbStore) CreateCoupon(coupon *dbmodels.Coupon) error {
+	if err := store.db.Create(coupon).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to create coupon",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) GetCouponByCode(code string) (*dbmodels.Coupon, error) {
+	var coupon dbmodels.Coupon
+	if err := store.db.Where("code = ?", strings.ToUpper(strings.TrimSpace(code))).First(&coupon).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Coupon not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &coupon, nil
+}
+
+// redeemCoupon consumes one use of a coupon, failing if it has no uses left
+func redeemCoupon(tx *gorm.DB, id uint) error {
+	result := tx.Model(&dbmodels.Coupon{}).
+		Where("id = ? AND is_active = ? AND used_count < max_uses", id, true).
+		UpdateColumn("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		return &CustomError{
+			Message: "Failed to redeem coupon",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if result.RowsAffected == 0 {
+		return &CustomError{
+			Message: "Coupon is no longer valid",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========== EXCHANGE RATES ==========
+
+func (store *DbStore) GetExchangeRates() ([]dbmodels.ExchangeRate, error) {
+	var rates []dbmodels.ExchangeRate
+	if err := store.db.Order("base_currency, quote_currency").Find(&rates).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch exchange rates",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return rates, nil
+}
+
+// GetExchangeRate returns how many units of `to` one unit of `from` buys.
+// A rate stored for the opposite direction is inverted.
+func (store *DbStore) GetExchangeRate(from, to string) (decimal.Decimal, error) {
+	return exchangeRate(store.db, from, to)
+}
+
+// exchangeRate is GetExchangeRate within a caller's transaction
+func exchangeRate(tx *gorm.DB, from, to string) (decimal.Decimal, error) {
+	if from == to {
+		return decimal.NewFromInt(1), nil
+	}
+
+	var rate dbmodels.ExchangeRate
+	err := tx.Where("base_currency = ? AND quote_currency = ?", from, to).First(&rate).Error
+	if err == nil {
+		return rate.Rate, nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = tx.Where("base_currency = ? AND quote_currency = ?", to, from).First(&rate).Error
+		if err == nil {
+			return money.InverseRate(rate.Rate), nil
+		}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return decimal.Zero, &CustomError{
+			Message: fmt.Sprintf("No exchange rate from %s to %s", from, to),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return decimal.Zero, &CustomError{
+		Message: "Failed to fetch exchange rate",
+		Code:    http.StatusInternalServerError,
+	}
+}
+
+// saveExchangeRate upserts a rate and drops the row stored for the opposite direction,
+// so each currency pair has a single source of truth
+func saveExchangeRate(tx *gorm.DB, rate *dbmodels.ExchangeRate) error {
+	if err := tx.Where("base_currency = ? AND quote_currency = ?", rate.QuoteCurrency, rate.BaseCurrency).
+		Delete(&dbmodels.ExchangeRate{}).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_by_id", "updated_at"}),
+	}).Create(rate).Error
+}
+
+func (store *DbStore) SaveExchangeRate(rate *dbmodels.ExchangeRate) error {
+	if err := store.db.Transaction(func(tx *gorm.DB) error {
+		return saveExchangeRate(tx, rate)
+	}); err != nil {
+		return &CustomError{
+			Message: "Failed to save exchange rate",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// ImportExchangeRates saves all rates or none
+func (store *DbStore) ImportExchangeRates(rates []dbmodels.ExchangeRate) error {
+	tx := store.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for i := range rates {
+		if err := saveExchangeRate(tx, &rates[i]); err != nil {
+			tx.Rollback()
+			return &CustomError{
+				Message: fmt.Sprintf("Failed to import rate %s/%s", rates[i].BaseCurrency, rates[i].QuoteCurrency),
+				Code:    http.StatusInternalServerError,
+			}
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return &CustomError{
+			Message: "Failed to import exchange rates",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) DeleteExchangeRate(id uint) error {
+	result := store.db.Delete(&dbmodels.ExchangeRate{}, id)
+	if result.Error != nil {
+		return &CustomError{
+			Message: "Failed to delete exchange rate",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if result.RowsAffected == 0 {
+		return &CustomError{
+			Message: "Exchange rate not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+// platformRateExpr converts an order's base currency into the platform currency in SQL.
+// It yields NULL for currencies without a rate, which leaves those orders out of sums.
+func platformRateExpr(column, currency string) (string, []interface{}) {
+	expr := fmt.Sprintf(`(CASE WHEN %[1]s = ? THEN 1 ELSE COALESCE(
+		(SELECT er.rate FROM exchange_rates er WHERE er.base_currency = %[1]s AND er.quote_currency = ?),
+		(SELECT 1 / er.rate FROM exchange_rates er WHERE er.base_currency = ? AND er.quote_currency = %[1]s)) END)`, column)
+	return expr, []interface{}{currency, currency, currency}
+}
+
+// ========== STORE CURRENCY ==========
+
+// GetStoreCurrency returns the store's base currency, or fallback when the store has not set one
+func (store *DbStore) GetStoreCurrency(userID uint, fallback string) string {
+	var currency string
+	store.db.Model(&dbmodels.User{}).Where("id = ?", userID).Pluck("currency", &currency)
+	if currency == "" {
+		return fallback
+	}
+	return currency
+}
+
+func (store *DbStore) UpdateStoreCurrency(userID uint, currency string) error {
+	if err := store.db.Model(&dbmodels.User{}).Where("id = ?", userID).Update("currency", currency).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to update store currency",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// ========== PRICE LISTS ==========
+
+func (store *DbStore) GetProductPrices(productID uint) ([]dbmodels.ProductPrice, error) {
+	var prices []dbmodels.ProductPrice
+	if err := store.db.Where("product_id = ?", productID).Order("currency").Find(&prices).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch product prices",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return prices, nil
+}
+
+// SaveProductPrice creates or replaces the product's price in a currency
+func (store *DbStore) SaveProductPrice(price *dbmodels.ProductPrice) error {
+	if err := store.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price", "discount_price", "updated_at"}),
+	}).Create(price).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to save product price",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) DeleteProductPrice(productID uint, currency string) error {
+	return store.db.Where("product_id = ? AND currency = ?", productID, currency).Delete(&dbmodels.ProductPrice{}).Error
+}
+
+// GetPriceList returns the listed prices of the products in a currency, keyed by product ID
+func (store *DbStore) GetPriceList(productIDs []uint, currency string) (map[uint]dbmodels.ProductPrice, error) {
+	listed := map[uint]dbmodels.ProductPrice{}
+	if len(productIDs) == 0 {
+		return listed, nil
+	}
+
+	var prices []dbmodels.ProductPrice
+	if err := store.db.Where("product_id IN ? AND currency = ?", productIDs, currency).Find(&prices).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch product prices",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	for _, price := range prices {
+		listed[price.ProductID] = price
+	}
+	return listed, nil
+}
+
+// QuoteProducts prices products in a currency, using the price list where one exists and
+// converting the base price with the current exchange rate otherwise
+func (store *DbStore) QuoteProducts(products []dbmodels.Product, storeCurrency, currency string) ([]dbmodels.PriceQuote, error) {
+	rate, err := store.GetExchangeRate(storeCurrency, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	listed := map[uint]dbmodels.ProductPrice{}
+	if currency != storeCurrency {
+		if listed, err = store.GetPriceList(ids, currency); err != nil {
+			return nil, err
+		}
+	}
+
+	quotes := make([]dbmodels.PriceQuote, 0, len(products))
+	for _, product := range products {
+		quote := dbmodels.PriceQuote{
+			ProductID:    product.ID,
+			Currency:     currency,
+			ExchangeRate: rate,
+		}
+		if price, ok := listed[product.ID]; ok {
+			quote.Price = price.Price
+			quote.DiscountPrice = price.DiscountPrice
+			quote.FromPriceList = true
+		} else {
+			quote.Price = money.Convert(product.Price, rate)
+			quote.DiscountPrice = money.Convert(product.DiscountPrice, rate)
+		}
+		quotes = append(quotes, quote)
+	}
+	return quotes, nil
+}
+
+// ========== PLATFORM REVENUE ==========
+
+// sumOrdersInCurrency sums order base totals converted into the platform currency
+func (store *DbStore) sumOrdersInCurrency(query *gorm.DB, currency string) float64 {
+	var total float64
+	expr, args := platformRateExpr("base_currency", currency)
+	query.Select("COALESCE(SUM(base_total * "+expr+"), 0)", args...).Scan(&total)
+	return total
+}
@@ -1,9 +1,12 @@
 package stores
 
 import (
+	"errors"
 	"net/http"
 
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/mohammedrefaat/hamber/money"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -218,18 +221,64 @@ func (store *DbStore) ClearCart(userID *uint, sessionID string) error {
 	return nil
 }
 
-// MigrateGuestCart migrates cart items from a guest session to a logged-in user
+// MigrateGuestCart moves a guest cart to the user after login or registration.
+// Products already in the user's cart have their quantities combined instead of duplicated.
 func (store *DbStore) MigrateGuestCart(sessionID string, userID uint) error {
-	// Update all cart items with the session ID to the user ID
-	if err := store.db.Model(&dbmodels.CartItem{}).
-		Where("session_id = ? AND user_id IS NULL", sessionID).
-		Update("user_id", userID).Error; err != nil {
+	tx := store.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var guestItems []dbmodels.CartItem
+	if err := tx.Where("session_id = ? AND user_id IS NULL", sessionID).Find(&guestItems).Error; err != nil {
+		tx.Rollback()
 		return &CustomError{
 			Message: "Failed to migrate guest cart",
 			Code:    http.StatusInternalServerError,
 		}
 	}
-	return nil
+
+	for _, guestItem := range guestItems {
+		var existing dbmodels.CartItem
+		err := tx.Where("user_id = ? AND product_id = ?", userID, guestItem.ProductID).First(&existing).Error
+		if err == nil {
+			// Combine quantities and drop the guest row
+			if err := tx.Model(&existing).Update("quantity", existing.Quantity+guestItem.Quantity).Error; err != nil {
+				tx.Rollback()
+				return &CustomError{
+					Message: "Failed to merge cart item",
+					Code:    http.StatusInternalServerError,
+				}
+			}
+			if err := tx.Delete(&dbmodels.CartItem{}, guestItem.ID).Error; err != nil {
+				tx.Rollback()
+				return &CustomError{
+					Message: "Failed to merge cart item",
+					Code:    http.StatusInternalServerError,
+				}
+			}
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			tx.Rollback()
+			return &CustomError{
+				Message: "Failed to migrate guest cart",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+
+		if err := tx.Model(&dbmodels.CartItem{}).Where("id = ?", guestItem.ID).Update("user_id", userID).Error; err != nil {
+			tx.Rollback()
+			return &CustomError{
+				Message: "Failed to migrate guest cart",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+	}
+
+	return tx.Commit().Error
 }
 
 // GetCartItemCount returns the total number of items in the cart
@@ -258,21 +307,52 @@ func (store *DbStore) GetCartItemCount(userID *uint, sessionID string) (int64, e
 }
 
 // GetCartTotal calculates the total price of items in the cart
-func (store *DbStore) GetCartTotal(userID *uint, sessionID string) (float64, error) {
-	var total float64
+func (store *DbStore) GetCartTotal(userID *uint, sessionID string) (decimal.Decimal, error) {
+	total := decimal.Zero
 	cartItems, err := store.GetCart(userID, sessionID)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 
 	for _, item := range cartItems {
-		total += item.Price * float64(item.Quantity)
+		total = total.Add(money.Multiply(item.Price, item.Quantity))
 	}
 	return total, nil
 }
 
 // ========== ORDER METHODS ==========
 
+// CreateCheckoutOrder saves a checkout's order with its items and consumes a use
+// of its coupon (couponID 0 for none) in one transaction, so a failed checkout
+// neither leaves a partial order nor uses up the coupon
+func (store *DbStore) CreateCheckoutOrder(order *dbmodels.Order, items []dbmodels.OrderItem, couponID uint) error {
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].OrderID = order.ID
+			if err := tx.Create(&items[i]).Error; err != nil {
+				return err
+			}
+		}
+		if couponID != 0 {
+			return redeemCoupon(tx, couponID)
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(*CustomError); ok {
+			return err
+		}
+		return &CustomError{
+			Message: "Failed to create order",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
 // CreateOrderItem creates a new order item
 func (store *DbStore) CreateOrderItem(orderItem *dbmodels.OrderItem) error {
 	if err := store.db.Create(orderItem).Error; err != nil {
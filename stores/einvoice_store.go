@@ -0,0 +1,127 @@
+package stores
+
+import (
+	"net/http"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm/clause"
+)
+
+// ========== E-INVOICE MANAGEMENT ==========
+
+// EInvoiceFilter narrows a document listing; zero values match everything
+type EInvoiceFilter struct {
+	UserID       uint
+	Source       string
+	DocumentType string
+	Status       string
+	From         *time.Time
+	To           *time.Time
+}
+
+func (store *DbStore) GetEInvoiceProfile(userID uint) (*dbmodels.EInvoiceProfile, error) {
+	var profile dbmodels.EInvoiceProfile
+	if err := store.db.Where("user_id = ?", userID).First(&profile).Error; err != nil {
+		return nil, &CustomError{
+			Message: "E-invoice profile not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &profile, nil
+}
+
+// SaveEInvoiceProfile creates or replaces the store's taxpayer registration
+func (store *DbStore) SaveEInvoiceProfile(profile *dbmodels.EInvoiceProfile) error {
+	if err := store.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"enabled", "issuer_type", "tax_registration_number", "name", "activity_code",
+			"branch_id", "governate", "region_city", "street", "building_number", "postal_code",
+			"item_code_type", "tax_rate", "prices_include_tax", "updated_at",
+		}),
+	}).Create(profile).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to save e-invoice profile",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) GetEInvoiceDocument(id uint) (*dbmodels.EInvoiceDocument, error) {
+	var document dbmodels.EInvoiceDocument
+	if err := store.db.First(&document, id).Error; err != nil {
+		return nil, &CustomError{
+			Message: "E-invoice document not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &document, nil
+}
+
+func (store *DbStore) GetEInvoiceDocumentByInternalID(internalID string) (*dbmodels.EInvoiceDocument, error) {
+	var document dbmodels.EInvoiceDocument
+	if err := store.db.Where("internal_id = ?", internalID).First(&document).Error; err != nil {
+		return nil, &CustomError{
+			Message: "E-invoice document not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &document, nil
+}
+
+// SaveEInvoiceDocument creates a document or replaces a regenerated one
+func (store *DbStore) SaveEInvoiceDocument(document *dbmodels.EInvoiceDocument) error {
+	if err := store.db.Save(document).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to save e-invoice document",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// GetEInvoiceDocuments lists documents, newest first
+func (store *DbStore) GetEInvoiceDocuments(filter EInvoiceFilter, page, limit int) ([]dbmodels.EInvoiceDocument, int64, error) {
+	var documents []dbmodels.EInvoiceDocument
+	var total int64
+
+	query := store.db.Model(&dbmodels.EInvoiceDocument{})
+	if filter.UserID > 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+	if filter.DocumentType != "" {
+		query = query.Where("document_type = ?", filter.DocumentType)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count e-invoice documents",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	if limit > 0 {
+		query = query.Offset((page - 1) * limit).Limit(limit)
+	}
+	if err := query.Order("created_at DESC").Find(&documents).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch e-invoice documents",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return documents, total, nil
+}
@@ -0,0 +1,233 @@
+package stores
+
+import (
+	"fmt"
+	"net/http"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm/clause"
+)
+
+// ========== PACKAGE ENTITLEMENTS ==========
+
+// EntitlementUsage is a package limit and how much of it a user has used
+type EntitlementUsage struct {
+	Resource  dbmodels.Entitlement `json:"resource"`
+	Limit     *int64               `json:"limit"` // nil is unlimited; storage is in bytes
+	Used      int64                `json:"used"`
+	Remaining *int64               `json:"remaining"` // nil is unlimited
+}
+
+// UserEntitlements is what a user's package allows and how much of it is used
+type UserEntitlements struct {
+	PackageID   uint                      `json:"package_id"`
+	PackageName string                    `json:"package_name"`
+	Highlights  []string                  `json:"highlights,omitempty"`
+	Limits      []EntitlementUsage        `json:"limits"`
+	Features    map[dbmodels.Feature]bool `json:"features"`
+}
+
+var entitlementTitles = map[dbmodels.Entitlement]string{
+	dbmodels.Entitlement_PRODUCTS:        "products",
+	dbmodels.Entitlement_BLOGS:           "blog posts",
+	dbmodels.Entitlement_SITES:           "sites",
+	dbmodels.Entitlement_CALENDAR_EVENTS: "calendar events",
+	dbmodels.Entitlement_CLIENTS:         "clients",
+}
+
+var featureTitles = map[dbmodels.Feature]string{
+	dbmodels.Feature_RECEIPTS:       "Receipts",
+	dbmodels.Feature_EINVOICE:       "E-invoicing",
+	dbmodels.Feature_SHIPPING:       "Shipping",
+	dbmodels.Feature_MULTI_CURRENCY: "Multi-currency pricing",
+	dbmodels.Feature_CLIENT_IMPORT:  "Client import",
+}
+
+// entitledPackage returns the package whose entitlements apply to a user: their
+// own, or the free package while their subscription is suspended. Without a
+// free package a suspended user is entitled to nothing.
+func (store *DbStore) entitledPackage(userID, freePackageID uint) (*dbmodels.Package, *dbmodels.PackageEntitlements, error) {
+	var user dbmodels.User
+	if err := store.db.Select("id", "package_id").First(&user, userID).Error; err != nil {
+		return nil, nil, &CustomError{Message: "User not found", Code: http.StatusNotFound}
+	}
+
+	packageID := user.PackageID
+	if latest, err := store.GetLatestSubscription(userID); err == nil && latest.Status == dbmodels.SubscriptionStatus_SUSPENDED {
+		if freePackageID == 0 {
+			return nil, nil, &CustomError{
+				Message: "Your subscription is suspended. Pay the open renewal invoice to reactivate it",
+				Code:    http.StatusPaymentRequired,
+			}
+		}
+		packageID = freePackageID
+	}
+
+	// A package withdrawn from sale still applies to the users already on it
+	var pkg dbmodels.Package
+	if err := store.db.First(&pkg, packageID).Error; err != nil {
+		return nil, nil, &CustomError{Message: "Package not found", Code: http.StatusNotFound}
+	}
+	entitlements, err := pkg.Entitlements()
+	if err != nil {
+		return nil, nil, &CustomError{
+			Message: fmt.Sprintf("The %s package's entitlements are invalid", pkg.Name),
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return &pkg, &entitlements, nil
+}
+
+// entitlementUsed counts how much of a resource a user has
+func (store *DbStore) entitlementUsed(userID uint, resource dbmodels.Entitlement) (int64, error) {
+	var used int64
+	var err error
+	switch resource {
+	case dbmodels.Entitlement_PRODUCTS:
+		err = store.db.Model(&dbmodels.Product{}).Where("user_id = ?", userID).Count(&used).Error
+	case dbmodels.Entitlement_BLOGS:
+		err = store.db.Model(&dbmodels.Blog{}).Where("author_id = ?", userID).Count(&used).Error
+	case dbmodels.Entitlement_SITES:
+		err = store.db.Model(&dbmodels.SiteConfig{}).Where("user_id = ?", userID).Count(&used).Error
+	case dbmodels.Entitlement_CALENDAR_EVENTS:
+		err = store.db.Model(&dbmodels.CalendarEvent{}).Where("user_id = ?", userID).Count(&used).Error
+	case dbmodels.Entitlement_CLIENTS:
+		err = store.db.Model(&dbmodels.Client{}).Where("user_id = ?", userID).Count(&used).Error
+	case dbmodels.Entitlement_STORAGE:
+		err = store.db.Model(&dbmodels.StoredFile{}).Where("user_id = ?", userID).
+			Select("COALESCE(SUM(size), 0)").Scan(&used).Error
+	}
+	if err != nil {
+		return 0, &CustomError{
+			Message: "Failed to count " + string(resource),
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return used, nil
+}
+
+// entitlementUsage counts a user's use of a resource against a limit
+func (store *DbStore) entitlementUsage(userID uint, resource dbmodels.Entitlement, limit *int64) (*EntitlementUsage, error) {
+	used, err := store.entitlementUsed(userID, resource)
+	if err != nil {
+		return nil, err
+	}
+	usage := &EntitlementUsage{Resource: resource, Limit: limit, Used: used}
+	if limit != nil {
+		remaining := max(*limit-used, 0)
+		usage.Remaining = &remaining
+	}
+	return usage, nil
+}
+
+// GetEntitlements returns the limits and features of a user's package with their usage
+func (store *DbStore) GetEntitlements(userID, freePackageID uint) (*UserEntitlements, error) {
+	pkg, entitlements, err := store.entitledPackage(userID, freePackageID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UserEntitlements{
+		PackageID:   pkg.ID,
+		PackageName: pkg.Name,
+		Highlights:  entitlements.Highlights,
+		Features:    make(map[dbmodels.Feature]bool, len(dbmodels.Features)),
+	}
+	for _, resource := range dbmodels.Entitlements {
+		usage, err := store.entitlementUsage(userID, resource, entitlements.Limit(resource))
+		if err != nil {
+			return nil, err
+		}
+		result.Limits = append(result.Limits, *usage)
+	}
+	for _, feature := range dbmodels.Features {
+		result.Features[feature] = entitlements.HasFeature(feature)
+	}
+	return result, nil
+}
+
+// CheckEntitlement checks that a user's package leaves room to add to a resource:
+// a number of items, or bytes for storage. It is refused with 402 and the
+// current usage when it would go over the limit.
+func (store *DbStore) CheckEntitlement(userID, freePackageID uint, resource dbmodels.Entitlement, adding int64) (*EntitlementUsage, error) {
+	pkg, entitlements, err := store.entitledPackage(userID, freePackageID)
+	if err != nil {
+		return nil, err
+	}
+	limit := entitlements.Limit(resource)
+	if limit == nil {
+		return nil, nil
+	}
+
+	usage, err := store.entitlementUsage(userID, resource, limit)
+	if err != nil {
+		return nil, err
+	}
+	if usage.Used+adding > *limit {
+		message := fmt.Sprintf("Your %s package allows up to %d %s; upgrade your package to add more",
+			pkg.Name, *limit, entitlementTitles[resource])
+		if resource == dbmodels.Entitlement_STORAGE {
+			message = fmt.Sprintf("Your %s package allows %d MB of storage; upgrade your package to upload more",
+				pkg.Name, *limit>>20)
+		}
+		return usage, &CustomError{Message: message, Code: http.StatusPaymentRequired}
+	}
+	return usage, nil
+}
+
+// CheckFeature checks that a user's package includes a feature, refusing with 402 when not
+func (store *DbStore) CheckFeature(userID, freePackageID uint, feature dbmodels.Feature) error {
+	pkg, entitlements, err := store.entitledPackage(userID, freePackageID)
+	if err != nil {
+		return err
+	}
+	if !entitlements.HasFeature(feature) {
+		return &CustomError{
+			Message: fmt.Sprintf("%s is not included in your %s package; upgrade your package to use it", featureTitles[feature], pkg.Name),
+			Code:    http.StatusPaymentRequired,
+		}
+	}
+	return nil
+}
+
+// RecordStoredFile counts an uploaded file against the user's storage
+func (store *DbStore) RecordStoredFile(userID uint, fileName string, size int64) error {
+	file := dbmodels.StoredFile{UserID: userID, FileName: fileName, Size: size}
+	if err := store.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&file).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to record stored file",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// ReleaseStoredFiles stops counting files against their user's storage
+func (store *DbStore) ReleaseStoredFiles(fileNames []string) error {
+	if len(fileNames) == 0 {
+		return nil
+	}
+	if err := store.db.Where("file_name IN ?", fileNames).Delete(&dbmodels.StoredFile{}).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to release stored files",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// GetStoredFilesSize returns the bytes counted for the given files
+func (store *DbStore) GetStoredFilesSize(fileNames []string) (int64, error) {
+	var size int64
+	if len(fileNames) == 0 {
+		return 0, nil
+	}
+	if err := store.db.Model(&dbmodels.StoredFile{}).Where("file_name IN ?", fileNames).
+		Select("COALESCE(SUM(size), 0)").Scan(&size).Error; err != nil {
+		return 0, &CustomError{
+			Message: "Failed to count stored files",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return size, nil
+}
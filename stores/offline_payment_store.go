@@ -0,0 +1,308 @@
+package stores
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========== OFFLINE PAYMENTS ==========
+
+type OfflinePaymentFilter struct {
+	StoreID uint // Only order payments of this store; 0 for all payments
+	Status  *dbmodels.OfflinePaymentStatus
+	Method  string
+}
+
+// PaymentProof is what a customer submits as evidence of a transfer
+type PaymentProof struct {
+	File              string // MinIO object name
+	ContentType       string
+	SenderName        string
+	TransferReference string
+	Note              string
+}
+
+// StartOfflinePayment puts a stored pending payment in the review queue, waiting
+// for the courier's collection or the customer's proof, and records its
+// reference and proof deadline
+func (store *DbStore) StartOfflinePayment(payment *dbmodels.Payment, cashOnDelivery bool) error {
+	offline := dbmodels.OfflinePayment{
+		PaymentID: payment.ID,
+		Method:    payment.PaymentMethod,
+		Status:    dbmodels.OfflinePaymentStatus_AWAITING_PROOF,
+	}
+	if cashOnDelivery {
+		offline.Status = dbmodels.OfflinePaymentStatus_AWAITING_COLLECTION
+	}
+
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&dbmodels.Payment{}).Where("id = ?", payment.ID).Updates(map[string]interface{}{
+			"paymob_order_id": payment.PaymobOrderID,
+			"expires_at":      payment.ExpiresAt,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&offline).Error
+	})
+	if err != nil {
+		return &CustomError{
+			Message: "Failed to record offline payment",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// GetOfflinePayment returns the offline record of a payment with the payment
+func (store *DbStore) GetOfflinePayment(paymentID uint) (*dbmodels.OfflinePayment, error) {
+	var offline dbmodels.OfflinePayment
+	if err := store.db.Preload("Payment").Where("payment_id = ?", paymentID).First(&offline).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Offline payment not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &offline, nil
+}
+
+// GetOrderOfflinePayment returns the latest offline payment of an order
+func (store *DbStore) GetOrderOfflinePayment(orderID uint) (*dbmodels.OfflinePayment, error) {
+	var offline dbmodels.OfflinePayment
+	if err := store.db.Preload("Payment").
+		Joins("JOIN payments ON payments.id = offline_payments.payment_id").
+		Where("payments.order_id = ?", orderID).
+		Order("offline_payments.created_at DESC").
+		First(&offline).Error; err != nil {
+		return nil, &CustomError{
+			Message: "No offline payment found for this order",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &offline, nil
+}
+
+// SubmitPaymentProof attaches proof of a transfer and sends it for review. The
+// payment no longer expires once proof is in; proof for a payment that already
+// expired is still taken, as a late transfer still completes it. Proof can be
+// replaced until the payment is reviewed. Returns the replaced proof file, if any.
+func (store *DbStore) SubmitPaymentProof(paymentID uint, proof PaymentProof) (*dbmodels.OfflinePayment, string, error) {
+	var offline dbmodels.OfflinePayment
+	var replaced string
+
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Payment").
+			Where("payment_id = ?", paymentID).
+			First(&offline).Error; err != nil {
+			return &CustomError{Message: "Offline payment not found", Code: http.StatusNotFound}
+		}
+
+		switch {
+		case offline.Method == dbmodels.CashOnDeliveryPaymentMethod:
+			return &CustomError{Message: "Cash on delivery is confirmed by the courier's collection", Code: http.StatusBadRequest}
+		case !offline.Status.IsOpen():
+			return &CustomError{Message: fmt.Sprintf("Payment was already %s", offline.Status), Code: http.StatusConflict}
+		case offline.Payment.PaymentStatus != dbmodels.PaymentStatus_PENDING &&
+			offline.Payment.PaymentStatus != dbmodels.PaymentStatus_EXPIRED:
+			return &CustomError{Message: fmt.Sprintf("Payment is %s", offline.Payment.PaymentStatus), Code: http.StatusConflict}
+		}
+
+		now := time.Now()
+		replaced = offline.ProofFile
+		offline.Status = dbmodels.OfflinePaymentStatus_IN_REVIEW
+		offline.ProofFile = proof.File
+		offline.ProofContentType = proof.ContentType
+		offline.SenderName = proof.SenderName
+		offline.TransferReference = proof.TransferReference
+		offline.Note = proof.Note
+		offline.SubmittedAt = &now
+		if err := tx.Model(&offline).Updates(map[string]interface{}{
+			"status":             offline.Status,
+			"proof_file":         offline.ProofFile,
+			"proof_content_type": offline.ProofContentType,
+			"sender_name":        offline.SenderName,
+			"transfer_reference": offline.TransferReference,
+			"note":               offline.Note,
+			"submitted_at":       offline.SubmittedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		offline.Payment.ExpiresAt = nil
+		return tx.Model(&dbmodels.Payment{}).Where("id = ?", paymentID).Update("expires_at", nil).Error
+	})
+	if err != nil {
+		if customErr, ok := err.(*CustomError); ok {
+			return nil, "", customErr
+		}
+		return nil, "", &CustomError{Message: "Failed to submit payment proof", Code: http.StatusInternalServerError}
+	}
+	return &offline, replaced, nil
+}
+
+// ReportCashCollected sends an order's cash on delivery payment for review once
+// the courier has delivered it. Returns nil when the order has none waiting for
+// collection.
+func (store *DbStore) ReportCashCollected(orderID uint, collectedBy string) (*dbmodels.OfflinePayment, error) {
+	var offline dbmodels.OfflinePayment
+
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "offline_payments"}}).
+			Joins("JOIN payments ON payments.id = offline_payments.payment_id").
+			Where("payments.order_id = ? AND payments.payment_status = ? AND offline_payments.status = ?",
+				orderID, dbmodels.PaymentStatus_PENDING, dbmodels.OfflinePaymentStatus_AWAITING_COLLECTION).
+			First(&offline).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		offline.Status = dbmodels.OfflinePaymentStatus_IN_REVIEW
+		offline.CollectedBy = collectedBy
+		offline.SubmittedAt = &now
+		return tx.Model(&offline).Updates(map[string]interface{}{
+			"status":       offline.Status,
+			"collected_by": offline.CollectedBy,
+			"submitted_at": offline.SubmittedAt,
+		}).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &CustomError{Message: "Failed to record cash collection", Code: http.StatusInternalServerError}
+	}
+	return &offline, nil
+}
+
+// GetOfflinePayments lists offline payments with their payments, oldest
+// submission first so the review queue is worked in order
+func (store *DbStore) GetOfflinePayments(filter OfflinePaymentFilter, page, limit int) ([]dbmodels.OfflinePayment, int64, error) {
+	var payments []dbmodels.OfflinePayment
+	var total int64
+
+	query := store.db.Model(&dbmodels.OfflinePayment{})
+	if filter.StoreID != 0 {
+		query = query.Joins("JOIN payments ON payments.id = offline_payments.payment_id").
+			Where("payments.user_id = ? AND payments.purpose = ?", filter.StoreID, dbmodels.PaymentPurpose_ORDER)
+	}
+	if filter.Status != nil {
+		query = query.Where("offline_payments.status = ?", *filter.Status)
+	}
+	if filter.Method != "" {
+		query = query.Where("offline_payments.method = ?", filter.Method)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count offline payments",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Preload("Payment").
+		Order("offline_payments.submitted_at ASC NULLS LAST, offline_payments.created_at ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&payments).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch offline payments",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return payments, total, nil
+}
+
+// ReviewOfflinePayment confirms or rejects an offline payment in the same
+// transaction as its payment's move to PAID or FAILED, so confirming completes
+// what it paid for exactly like a gateway callback. Proof of a transfer that
+// already expired can still be rejected; the payment then stays expired.
+func (store *DbStore) ReviewOfflinePayment(paymentID, reviewerID uint, confirm bool, reason string) (*PaymentTransition, *dbmodels.OfflinePayment, error) {
+	var transition PaymentTransition
+	var offline dbmodels.OfflinePayment
+
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("payment_id = ?", paymentID).
+			First(&offline).Error; err != nil {
+			return &CustomError{Message: "Offline payment not found", Code: http.StatusNotFound}
+		}
+		if !offline.Status.IsOpen() {
+			return &CustomError{Message: fmt.Sprintf("Payment was already %s", offline.Status), Code: http.StatusConflict}
+		}
+
+		status := dbmodels.PaymentStatus_FAILED
+		offline.Status = dbmodels.OfflinePaymentStatus_REJECTED
+		if confirm {
+			status = dbmodels.PaymentStatus_PAID
+			offline.Status = dbmodels.OfflinePaymentStatus_CONFIRMED
+		}
+		if err := transitionPayment(tx, &transition, paymentID, status, offline.TransferReference, 0); err != nil {
+			return err
+		}
+		if confirm && !transition.Applied {
+			return &CustomError{
+				Message: fmt.Sprintf("Payment is %s and cannot be confirmed", transition.Payment.PaymentStatus),
+				Code:    http.StatusConflict,
+			}
+		}
+		if !confirm {
+			transition.FailureReason = reason
+		}
+
+		now := time.Now()
+		offline.ReviewedBy = &reviewerID
+		offline.ReviewedAt = &now
+		offline.RejectionReason = reason
+		return tx.Model(&offline).Updates(map[string]interface{}{
+			"status":           offline.Status,
+			"reviewed_by":      offline.ReviewedBy,
+			"reviewed_at":      offline.ReviewedAt,
+			"rejection_reason": offline.RejectionReason,
+		}).Error
+	})
+	if err != nil {
+		if customErr, ok := err.(*CustomError); ok {
+			return nil, nil, customErr
+		}
+		return nil, nil, &CustomError{Message: "Failed to review offline payment", Code: http.StatusInternalServerError}
+	}
+	offline.Payment = &transition.Payment
+	return &transition, &offline, nil
+}
+
+// ========== STORE PAYMENT ACCOUNTS ==========
+
+func (store *DbStore) GetPaymentAccount(userID uint) (*dbmodels.PaymentAccount, error) {
+	var account dbmodels.PaymentAccount
+	if err := store.db.Where("user_id = ?", userID).First(&account).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Payment account not set",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &account, nil
+}
+
+// SavePaymentAccount creates or replaces the account a store receives transfers in
+func (store *DbStore) SavePaymentAccount(account *dbmodels.PaymentAccount) error {
+	if err := store.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"bank_name", "account_name", "account_number", "instapay_address", "updated_at",
+		}),
+	}).Create(account).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to save payment account",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/shopspring/decimal"
 )
 
 // ========== ORDER MANAGEMENT ==========
@@ -59,6 +60,18 @@ func (store *DbStore) GetOrderByID(id uint) (*dbmodels.Order, error) {
 	return &order, nil
 }
 
+// GetOrderWithItems loads an order together with its items, products and client
+func (store *DbStore) GetOrderWithItems(id uint) (*dbmodels.Order, error) {
+	var order dbmodels.Order
+	if err := store.db.Preload("User").Preload("Client").Preload("Items.Product").First(&order, id).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Order not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &order, nil
+}
+
 func (store *DbStore) UpdateOrderStatus(id uint, status dbmodels.OrderStatus) error {
 	return store.db.Model(&dbmodels.Order{}).
 		Where("id = ?", id).
@@ -72,23 +85,23 @@ func (store *DbStore) CancelOrder(id uint) error {
 }
 
 type PaymentUpdate struct {
-	PaymentStatus string     `json:"payment_status" binding:"required"`
-	Amount        float64    `json:"amount" binding:"required"`
-	PaymentRef    string     `json:"payment_ref"`
-	PaymentDate   *time.Time `json:"payment_date"`
-	PaymentMethod int64      `json:"payment_method"`
-	PaymentDesc   string     `json:"payment_desc"`
+	PaymentStatus string          `json:"payment_status" binding:"required"`
+	Amount        decimal.Decimal `json:"amount" binding:"required"`
+	PaymentRef    string          `json:"payment_ref"`
+	PaymentDate   *time.Time      `json:"payment_date"`
+	PaymentMethod int64           `json:"payment_method"`
+	PaymentDesc   string          `json:"payment_desc"`
 }
 
 func (store *DbStore) UpdateOrderPayment(id uint, paymentUpdate PaymentUpdate) error {
 	return store.db.Model(&dbmodels.Order{}).
 		Where("id = ?", id).
 		Updates(map[string]interface{}{
-			"payment_status": paymentUpdate.PaymentStatus,
-			"payment_amount": paymentUpdate.Amount,
-			"payment_date":   paymentUpdate.PaymentDate,
-			"payment_method": paymentUpdate.PaymentMethod,
-			"payment_desc":   paymentUpdate.PaymentDesc,
-			"payment_ref":    paymentUpdate.PaymentRef,
+			"payment_status":      paymentUpdate.PaymentStatus,
+			"payment_amount":      paymentUpdate.Amount,
+			"payment_date":        paymentUpdate.PaymentDate,
+			"payment_method_id":   paymentUpdate.PaymentMethod,
+			"payment_method_desc": paymentUpdate.PaymentDesc,
+			"payment_ref":         paymentUpdate.PaymentRef,
 		}).Error
 }
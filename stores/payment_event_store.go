@@ -0,0 +1,121 @@
+package stores
+
+import (
+	"net/http"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========== PAYMENT GATEWAY EVENTS ==========
+
+type PaymentEventFilter struct {
+	Gateway   string
+	Status    *dbmodels.PaymentEventStatus
+	PaymentID uint
+}
+
+// RecordPaymentEvent stores a gateway event unless one with the same gateway and
+// event ID exists. It reports whether the event is new; for a redelivered event,
+// event is replaced by the stored one.
+func (store *DbStore) RecordPaymentEvent(event *dbmodels.PaymentEvent) (bool, error) {
+	result := store.db.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		return false, &CustomError{
+			Message: "Failed to record payment event",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	if err := store.db.Where("gateway = ? AND event_id = ?", event.Gateway, event.EventID).First(event).Error; err != nil {
+		return false, &CustomError{
+			Message: "Failed to load payment event",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return false, nil
+}
+
+// MarkPaymentEvent records a processing attempt outside a payment transition,
+// e.g. a failure that rolled the transition back
+func (store *DbStore) MarkPaymentEvent(id uint, status dbmodels.PaymentEventStatus, message string) error {
+	return markPaymentEvent(store.db, id, status, message)
+}
+
+func markPaymentEvent(tx *gorm.DB, id uint, status dbmodels.PaymentEventStatus, message string) error {
+	if id == 0 {
+		return nil
+	}
+	query := tx.Model(&dbmodels.PaymentEvent{}).Where("id = ?", id)
+	if status != dbmodels.PaymentEventStatus_PROCESSED {
+		// A concurrent delivery of the same event must not undo its processing
+		query = query.Where("status <> ?", dbmodels.PaymentEventStatus_PROCESSED)
+	}
+	now := time.Now()
+	return query.Updates(map[string]interface{}{
+		"status":       status,
+		"error":        message,
+		"attempts":     gorm.Expr("attempts + 1"),
+		"processed_at": &now,
+	}).Error
+}
+
+// SetPaymentEventPayment links an event to the payment it was matched with
+func (store *DbStore) SetPaymentEventPayment(id uint, paymentID uint) error {
+	return store.db.Model(&dbmodels.PaymentEvent{}).
+		Where("id = ?", id).
+		Update("payment_id", paymentID).Error
+}
+
+func (store *DbStore) GetPaymentEvent(id uint) (*dbmodels.PaymentEvent, error) {
+	var event dbmodels.PaymentEvent
+	if err := store.db.First(&event, id).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Payment event not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &event, nil
+}
+
+// GetPaymentEvents lists events newest first
+func (store *DbStore) GetPaymentEvents(filter PaymentEventFilter, page, limit int) ([]dbmodels.PaymentEvent, int64, error) {
+	var events []dbmodels.PaymentEvent
+	var total int64
+
+	query := store.db.Model(&dbmodels.PaymentEvent{})
+	if filter.Gateway != "" {
+		query = query.Where("gateway = ?", filter.Gateway)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.PaymentID != 0 {
+		query = query.Where("payment_id = ?", filter.PaymentID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count payment events",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&events).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch payment events",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return events, total, nil
+}
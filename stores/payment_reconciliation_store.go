@@ -0,0 +1,133 @@
+package stores
+
+import (
+	"net/http"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm"
+)
+
+// ========== PAYMENT RECONCILIATION ==========
+
+// GetStalePendingPayments returns pending payments created before the cutoff,
+// those never or least recently checked with their gateway first
+func (store *DbStore) GetStalePendingPayments(createdBefore time.Time, limit int) ([]dbmodels.Payment, error) {
+	var payments []dbmodels.Payment
+	if err := store.db.
+		Where("payment_status = ? AND created_at < ?", dbmodels.PaymentStatus_PENDING, createdBefore).
+		Order("last_checked_at ASC NULLS FIRST, created_at ASC").
+		Limit(limit).
+		Find(&payments).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch pending payments",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return payments, nil
+}
+
+// MarkPaymentChecked records when a payment's gateway was last asked for its status
+func (store *DbStore) MarkPaymentChecked(id uint, at time.Time) error {
+	return store.db.Model(&dbmodels.Payment{}).
+		Where("id = ?", id).
+		Update("last_checked_at", &at).Error
+}
+
+// GetPaymentsCreatedBetween returns the gateway payments created in [from, to)
+func (store *DbStore) GetPaymentsCreatedBetween(from, to time.Time) ([]dbmodels.Payment, error) {
+	var payments []dbmodels.Payment
+	if err := store.db.
+		Where("created_at >= ? AND created_at < ? AND reference_number <> ''", from, to).
+		Order("id ASC").
+		Find(&payments).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch payments",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return payments, nil
+}
+
+// SavePaymentReconciliation stores a report with its items, replacing any
+// earlier report for the same day
+func (store *DbStore) SavePaymentReconciliation(report *dbmodels.PaymentReconciliation) error {
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		var existing []uint
+		if err := tx.Model(&dbmodels.PaymentReconciliation{}).
+			Where("report_date = ?", report.ReportDate).
+			Pluck("id", &existing).Error; err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			if err := tx.Where("reconciliation_id IN ?", existing).Delete(&dbmodels.PaymentReconciliationItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&dbmodels.PaymentReconciliation{}, existing).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(report).Error
+	})
+	if err != nil {
+		return &CustomError{
+			Message: "Failed to save reconciliation report",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// HasPaymentReconciliation reports whether the report for a day exists
+func (store *DbStore) HasPaymentReconciliation(reportDate time.Time) (bool, error) {
+	var count int64
+	if err := store.db.Model(&dbmodels.PaymentReconciliation{}).
+		Where("report_date = ?", reportDate).
+		Count(&count).Error; err != nil {
+		return false, &CustomError{
+			Message: "Failed to check reconciliation reports",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return count > 0, nil
+}
+
+func (store *DbStore) GetPaymentReconciliation(id uint) (*dbmodels.PaymentReconciliation, error) {
+	var report dbmodels.PaymentReconciliation
+	if err := store.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).First(&report, id).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Reconciliation report not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &report, nil
+}
+
+// GetPaymentReconciliations lists reports newest day first, without their items
+func (store *DbStore) GetPaymentReconciliations(page, limit int) ([]dbmodels.PaymentReconciliation, int64, error) {
+	var reports []dbmodels.PaymentReconciliation
+	var total int64
+
+	query := store.db.Model(&dbmodels.PaymentReconciliation{})
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count reconciliation reports",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Order("report_date DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&reports).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch reconciliation reports",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return reports, total, nil
+}
@@ -1,10 +1,13 @@
 package stores
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ========== PAYMENT MANAGEMENT ==========
@@ -13,6 +16,66 @@ func (store *DbStore) CreatePayment(payment *dbmodels.Payment) error {
 	return store.db.Create(payment).Error
 }
 
+// CreateOrderPayment records a new pending payment for an order, cancelling the
+// order's pending payments so only one is open at a time. A transfer whose proof
+// is in review is not replaced. The order row is locked, so concurrent attempts
+// are serialized.
+func (store *DbStore) CreateOrderPayment(payment *dbmodels.Payment) error {
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		var order dbmodels.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "payment_status").
+			First(&order, *payment.OrderID).Error; err != nil {
+			return &CustomError{Message: "Order not found", Code: http.StatusNotFound}
+		}
+		if order.PaymentStatus == dbmodels.PaymentStatus_PAID.String() {
+			return &CustomError{Message: "Order is already paid", Code: http.StatusBadRequest}
+		}
+
+		var open []uint
+		if err := tx.Model(&dbmodels.Payment{}).
+			Where("order_id = ? AND payment_status = ?", order.ID, dbmodels.PaymentStatus_PENDING).
+			Pluck("id", &open).Error; err != nil {
+			return err
+		}
+		if len(open) > 0 {
+			var inReview int64
+			if err := tx.Model(&dbmodels.OfflinePayment{}).
+				Where("payment_id IN ? AND status = ?", open, dbmodels.OfflinePaymentStatus_IN_REVIEW).
+				Count(&inReview).Error; err != nil {
+				return err
+			}
+			if inReview > 0 {
+				return &CustomError{Message: "A payment for this order is awaiting review", Code: http.StatusConflict}
+			}
+
+			for _, id := range open {
+				var transition PaymentTransition
+				if err := transitionPayment(tx, &transition, id, dbmodels.PaymentStatus_CANCELLED, "", 0); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&dbmodels.OfflinePayment{}).
+				Where("payment_id IN ? AND status NOT IN ?", open,
+					[]dbmodels.OfflinePaymentStatus{dbmodels.OfflinePaymentStatus_CONFIRMED, dbmodels.OfflinePaymentStatus_REJECTED}).
+				Updates(map[string]interface{}{
+					"status":           dbmodels.OfflinePaymentStatus_REJECTED,
+					"rejection_reason": "Replaced by another payment",
+				}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(payment).Error
+	})
+	if err != nil {
+		if _, ok := err.(*CustomError); ok {
+			return err
+		}
+		return &CustomError{Message: "Failed to create payment record", Code: http.StatusInternalServerError}
+	}
+	return nil
+}
+
 func (store *DbStore) GetPayment(id uint) (*dbmodels.Payment, error) {
 	var payment dbmodels.Payment
 	if err := store.db.Preload("User").Preload("Package").First(&payment, id).Error; err != nil {
@@ -48,6 +111,34 @@ func (store *DbStore) GetPaymentByTransactionID(transactionID string) (*dbmodels
 	return &payment, nil
 }
 
+// GetPaymentByGatewayOrderID finds a payment by the order ID its gateway assigned
+func (store *DbStore) GetPaymentByGatewayOrderID(gatewayOrderID string) (*dbmodels.Payment, error) {
+	var payment dbmodels.Payment
+	if err := store.db.Preload("User").Preload("Package").
+		Where("paymob_order_id = ?", gatewayOrderID).First(&payment).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Payment not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &payment, nil
+}
+
+func (store *DbStore) UpdatePayment(payment *dbmodels.Payment) error {
+	return store.db.Save(payment).Error
+}
+
+func (store *DbStore) GetOrderPayments(orderID uint) ([]dbmodels.Payment, error) {
+	var payments []dbmodels.Payment
+	if err := store.db.Where("order_id = ?", orderID).Order("created_at DESC").Find(&payments).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch order payments",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return payments, nil
+}
+
 func (store *DbStore) UpdatePaymentStatus(id uint, status dbmodels.PaymentStatus, transactionID string) error {
 	updates := map[string]interface{}{
 		"payment_status": status,
@@ -67,6 +158,252 @@ func (store *DbStore) UpdatePaymentStatus(id uint, status dbmodels.PaymentStatus
 		Updates(updates).Error
 }
 
+// SetPaymentGatewayOrderID records the order ID a gateway assigned at initiation.
+// Only that column is written, so a callback that already arrived is not undone.
+func (store *DbStore) SetPaymentGatewayOrderID(id uint, gatewayOrderID string) error {
+	return store.db.Model(&dbmodels.Payment{}).
+		Where("id = ?", id).
+		Update("paymob_order_id", gatewayOrderID).Error
+}
+
+// PaymentTransition is the outcome of TransitionPayment
+type PaymentTransition struct {
+	Payment             dbmodels.Payment            // The payment after the transition
+	Previous            dbmodels.PaymentStatus      // Status before the transition
+	Applied             bool                        // False when the transition was not a forward move
+	PackageChangeID     uint                        // Package change completed, or rolled back, by this payment, if any
+	AddonSubscriptionID uint                        // Add-on subscription activated, cancelled or revoked by this payment, if any
+	WalletEntry         *dbmodels.WalletTransaction // Wallet credit or debit posted by this payment, if any
+	FailureReason       string                      // Why the payment failed, when a reviewer gave a reason
+}
+
+// TransitionPayment moves a payment to a new status and, once paid, completes what
+// its purpose says it paid for (an order, a package change, an add-on
+// subscription, a renewal invoice or a wallet top-up), all in one transaction; a package change or
+// add-on subscription whose payment fails or expires is given up. The
+// payment row is locked, so concurrent callbacks are serialized, and only forward
+// transitions are applied. When eventID is set, the gateway event is marked
+// PROCESSED or IGNORED in the same transaction.
+func (store *DbStore) TransitionPayment(paymentID uint, status dbmodels.PaymentStatus, transactionID string, eventID uint) (*PaymentTransition, error) {
+	var transition PaymentTransition
+
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		return transitionPayment(tx, &transition, paymentID, status, transactionID, eventID)
+	})
+	if err != nil {
+		if _, ok := err.(*CustomError); ok {
+			return nil, err
+		}
+		return nil, &CustomError{
+			Message: "Failed to update payment status",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return &transition, nil
+}
+
+// transitionPayment is TransitionPayment within a caller's transaction
+func transitionPayment(tx *gorm.DB, transition *PaymentTransition, paymentID uint, status dbmodels.PaymentStatus, transactionID string, eventID uint) error {
+	payment := &transition.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(payment, paymentID).Error; err != nil {
+		return &CustomError{Message: "Payment not found", Code: http.StatusNotFound}
+	}
+	transition.Previous = payment.PaymentStatus
+
+	if !payment.PaymentStatus.CanTransitionTo(status) {
+		return markPaymentEvent(tx, eventID, dbmodels.PaymentEventStatus_IGNORED,
+			fmt.Sprintf("payment is %s, %s ignored", payment.PaymentStatus, status))
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"payment_status": status}
+	if transactionID != "" {
+		updates["transaction_id"] = transactionID
+		payment.TransactionID = transactionID
+	}
+	if status == dbmodels.PaymentStatus_PAID {
+		updates["paid_at"] = &now
+		payment.PaidAt = &now
+	}
+	if err := tx.Model(payment).Updates(updates).Error; err != nil {
+		return err
+	}
+	payment.PaymentStatus = status
+	transition.Applied = true
+
+	switch payment.Purpose {
+	case dbmodels.PaymentPurpose_ORDER:
+		if payment.OrderID == nil {
+			break
+		}
+		if err := settleOrderPayment(tx, payment, status, now); err != nil {
+			return err
+		}
+	case dbmodels.PaymentPurpose_SUBSCRIPTION_RENEWAL:
+		if status == dbmodels.PaymentStatus_PAID {
+			if err := renewSubscription(tx, *payment.InvoiceID, payment.ID); err != nil {
+				return err
+			}
+		} else if status != dbmodels.PaymentStatus_REFUNDED {
+			// Dunning goes on: the renewal job retries or ends the grace period
+			if err := recordSubscriptionEvent(tx, &dbmodels.SubscriptionEvent{
+				UserID:    payment.UserID,
+				InvoiceID: payment.InvoiceID,
+				PaymentID: &payment.ID,
+				Type:      dbmodels.SubscriptionEventType_PAYMENT_FAILED,
+				Message:   fmt.Sprintf("Renewal payment %s is %s", payment.ReferenceNumber, status),
+			}); err != nil {
+				return err
+			}
+		}
+	case dbmodels.PaymentPurpose_WALLET_TOPUP:
+		if status != dbmodels.PaymentStatus_PAID && status != dbmodels.PaymentStatus_REFUNDED {
+			break
+		}
+		entry := WalletEntry{
+			Type:      dbmodels.WalletEntryType_CREDIT,
+			Reason:    dbmodels.WalletEntryReason_TOP_UP,
+			Amount:    payment.Amount,
+			PaymentID: &payment.ID,
+			Reference: payment.ReferenceNumber,
+		}
+		if status == dbmodels.PaymentStatus_REFUNDED {
+			// The gateway already returned the money, so the balance may go negative
+			entry.Type = dbmodels.WalletEntryType_DEBIT
+			entry.Reason = dbmodels.WalletEntryReason_TOP_UP_REVERT
+			entry.AllowOverdraft = true
+		}
+		posted, err := postWalletEntry(tx, payment.UserID, payment.Currency, entry)
+		if err != nil {
+			return err
+		}
+		transition.WalletEntry = posted
+	case dbmodels.PaymentPurpose_ADDON_SUBSCRIPTION:
+		subscriptionID, err := settleAddonPayment(tx, payment, status, now)
+		if err != nil {
+			return err
+		}
+		transition.AddonSubscriptionID = subscriptionID
+	case dbmodels.PaymentPurpose_PACKAGE_CHANGE:
+		if payment.PackageID == nil {
+			break
+		}
+		if status == dbmodels.PaymentStatus_PAID {
+			var change dbmodels.PackageChange
+			if err := tx.Where("payment_id = ?", payment.ID).First(&change).Error; err != nil {
+				return &CustomError{Message: "Package change not found for payment", Code: http.StatusNotFound}
+			}
+			if err := completePackageChange(tx, change.ID, *payment.PackageID); err != nil {
+				return err
+			}
+			transition.PackageChangeID = change.ID
+		} else if status != dbmodels.PaymentStatus_REFUNDED {
+			// The payment failed, was cancelled or expired: the change it was for is
+			// rolled back. A late success still completes it.
+			result := tx.Model(&dbmodels.PackageChange{}).
+				Where("payment_id = ? AND status = ?", payment.ID, dbmodels.ChangeStatus_PENDING).
+				Update("status", dbmodels.ChangeStatus_REJECTED)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				var change dbmodels.PackageChange
+				if err := tx.Select("id").Where("payment_id = ?", payment.ID).First(&change).Error; err == nil {
+					transition.PackageChangeID = change.ID
+				}
+			}
+		}
+	}
+
+	return markPaymentEvent(tx, eventID, dbmodels.PaymentEventStatus_PROCESSED, "")
+}
+
+// settleOrderPayment records a paid or refunded payment on its order. A second
+// payment of an order that is already paid leaves the order alone and is flagged
+// for refund instead; refunding it later does not refund the order.
+func settleOrderPayment(tx *gorm.DB, payment *dbmodels.Payment, status dbmodels.PaymentStatus, now time.Time) error {
+	switch status {
+	case dbmodels.PaymentStatus_PAID:
+		var order dbmodels.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "payment_status").
+			First(&order, *payment.OrderID).Error; err != nil {
+			return &CustomError{Message: "Order not found for payment", Code: http.StatusNotFound}
+		}
+		if order.PaymentStatus == dbmodels.PaymentStatus_PAID.String() {
+			payment.NeedsRefund = true
+			return tx.Model(payment).Update("needs_refund", true).Error
+		}
+
+		ref := payment.TransactionID
+		if ref == "" {
+			ref = payment.ReferenceNumber
+		}
+		return tx.Model(&dbmodels.Order{}).
+			Where("id = ?", *payment.OrderID).
+			Updates(map[string]interface{}{
+				"payment_status":      status.String(),
+				"payment_amount":      payment.Amount,
+				"payment_date":        &now,
+				"payment_method_desc": payment.PaymentMethod,
+				"payment_ref":         ref,
+			}).Error
+	case dbmodels.PaymentStatus_REFUNDED:
+		if payment.NeedsRefund {
+			payment.NeedsRefund = false
+			return tx.Model(payment).Update("needs_refund", false).Error
+		}
+		return tx.Model(&dbmodels.Order{}).
+			Where("id = ?", *payment.OrderID).
+			Update("payment_status", status.String()).Error
+	}
+	return nil
+}
+
+// settleAddonPayment activates the add-on subscription a payment is for, starting
+// its period now; a failed, cancelled or expired payment cancels it while it is
+// pending and a refund revokes it. A late success still activates it. Returns the
+// subscription ID when it changed.
+func settleAddonPayment(tx *gorm.DB, payment *dbmodels.Payment, status dbmodels.PaymentStatus, now time.Time) (uint, error) {
+	var subscription dbmodels.UserAddonSubscription
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Addon").
+		Where("payment_id = ?", payment.ID).
+		First(&subscription).Error; err != nil {
+		return 0, &CustomError{Message: "Add-on subscription not found for payment", Code: http.StatusNotFound}
+	}
+
+	updates := map[string]interface{}{}
+	switch status {
+	case dbmodels.PaymentStatus_PAID:
+		if subscription.Status != dbmodels.AddonSubscriptionStatus_PENDING &&
+			subscription.Status != dbmodels.AddonSubscriptionStatus_CANCELLED {
+			return 0, nil
+		}
+		updates["status"] = dbmodels.AddonSubscriptionStatus_ACTIVE
+		updates["start_date"] = now
+		if subscription.Addon.PricingType == "time" {
+			updates["end_date"] = now.AddDate(0, 0, subscription.Addon.BillingCycle*subscription.Quantity)
+		}
+	case dbmodels.PaymentStatus_REFUNDED:
+		if subscription.Status != dbmodels.AddonSubscriptionStatus_ACTIVE {
+			return 0, nil
+		}
+		updates["status"] = dbmodels.AddonSubscriptionStatus_CANCELLED
+		updates["end_date"] = now
+	default:
+		if subscription.Status != dbmodels.AddonSubscriptionStatus_PENDING {
+			return 0, nil
+		}
+		updates["status"] = dbmodels.AddonSubscriptionStatus_CANCELLED
+	}
+
+	if err := tx.Model(&subscription).Updates(updates).Error; err != nil {
+		return 0, err
+	}
+	return subscription.ID, nil
+}
+
 func (store *DbStore) GetUserPayments(userID uint, page, limit int) ([]dbmodels.Payment, int64, error) {
 	var payments []dbmodels.Payment
 	var total int64
@@ -116,6 +453,17 @@ func (store *DbStore) GetPackageChange(id uint) (*dbmodels.PackageChange, error)
 	return &change, nil
 }
 
+func (store *DbStore) GetPackageChangeByPaymentID(paymentID uint) (*dbmodels.PackageChange, error) {
+	var change dbmodels.PackageChange
+	if err := store.db.Where("payment_id = ?", paymentID).First(&change).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Package change not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &change, nil
+}
+
 func (store *DbStore) UpdatePackageChangeStatus(id uint, status dbmodels.ChangeStatus) error {
 	updates := map[string]interface{}{
 		"status": status,
@@ -132,44 +480,80 @@ func (store *DbStore) UpdatePackageChangeStatus(id uint, status dbmodels.ChangeS
 }
 
 func (store *DbStore) CompletePackageChange(changeID uint, newPackageID uint) error {
-	// Start transaction
-	tx := store.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+	return store.db.Transaction(func(tx *gorm.DB) error {
+		return completePackageChange(tx, changeID, newPackageID)
+	})
+}
 
+// completePackageChange starts the subscription a change was paid for. A change
+// effective now moves the user to the new package and ends the current
+// subscription; a change effective later (a downgrade at the end of the period)
+// is scheduled, and its subscription starts then.
+func completePackageChange(tx *gorm.DB, changeID uint, newPackageID uint) error {
 	// Get package change
 	var change dbmodels.PackageChange
 	if err := tx.First(&change, changeID).Error; err != nil {
-		tx.Rollback()
 		return &CustomError{
 			Message: "Package change not found",
 			Code:    http.StatusNotFound,
 		}
 	}
 
-	// Update user's package
-	if err := tx.Model(&dbmodels.User{}).
-		Where("id = ?", change.UserID).
-		Update("package_id", newPackageID).Error; err != nil {
-		tx.Rollback()
+	var pkg dbmodels.Package
+	if err := tx.First(&pkg, newPackageID).Error; err != nil {
+		return &CustomError{
+			Message: "Package not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+
+	now := time.Now()
+	startDate := now
+	status := dbmodels.ChangeStatus_COMPLETED
+	if change.EffectiveAt != nil && change.EffectiveAt.After(now) {
+		startDate = *change.EffectiveAt
+		status = dbmodels.ChangeStatus_SCHEDULED
+	} else {
+		// Update user's package
+		if err := tx.Model(&dbmodels.User{}).
+			Where("id = ?", change.UserID).
+			Update("package_id", newPackageID).Error; err != nil {
+			return &CustomError{
+				Message: "Failed to update user package",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+
+		// The unused part of the current period was credited in the price. A
+		// subscription past due or suspended is replaced as well.
+		if err := tx.Model(&dbmodels.Subscription{}).
+			Where("user_id = ? AND start_date <= ? AND status <> ?", change.UserID, now, dbmodels.SubscriptionStatus_ENDED).
+			Updates(map[string]interface{}{
+				"end_date": gorm.Expr("LEAST(end_date, ?)", now),
+				"status":   dbmodels.SubscriptionStatus_ENDED,
+			}).Error; err != nil {
+			return &CustomError{
+				Message: "Failed to end current subscription",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+	}
+
+	// The new package is paid for, so a pending renewal of the old one is not needed
+	if err := voidOpenInvoices(tx, change.UserID); err != nil {
 		return &CustomError{
-			Message: "Failed to update user package",
+			Message: "Failed to void renewal invoices",
 			Code:    http.StatusInternalServerError,
 		}
 	}
 
 	// Update package change status
-	now := time.Now()
 	if err := tx.Model(&dbmodels.PackageChange{}).
 		Where("id = ?", changeID).
 		Updates(map[string]interface{}{
-			"status":      dbmodels.ChangeStatus_COMPLETED,
+			"status":      status,
 			"approved_at": &now,
 		}).Error; err != nil {
-		tx.Rollback()
 		return &CustomError{
 			Message: "Failed to update package change status",
 			Code:    http.StatusInternalServerError,
@@ -177,29 +561,99 @@ func (store *DbStore) CompletePackageChange(changeID uint, newPackageID uint) er
 	}
 
 	// Create subscription record
-	pkg, err := store.GetPackage(newPackageID)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
 	subscription := dbmodels.Subscription{
 		UserID:    change.UserID,
 		PackageID: newPackageID,
-		StartDate: time.Now(),
-		EndDate:   time.Now().AddDate(0, 0, pkg.Duration),
+		StartDate: startDate,
+		EndDate:   startDate.AddDate(0, 0, pkg.Duration),
 		Price:     pkg.Price,
 	}
 
 	if err := tx.Create(&subscription).Error; err != nil {
-		tx.Rollback()
 		return &CustomError{
 			Message: "Failed to create subscription",
 			Code:    http.StatusInternalServerError,
 		}
 	}
 
-	return tx.Commit().Error
+	return nil
+}
+
+// GetActiveSubscription returns the user's subscription covering the given time
+func (store *DbStore) GetActiveSubscription(userID uint, at time.Time) (*dbmodels.Subscription, error) {
+	var subscription dbmodels.Subscription
+	if err := store.db.
+		Where("user_id = ? AND start_date <= ? AND end_date > ?", userID, at, at).
+		Order("start_date DESC").
+		First(&subscription).Error; err != nil {
+		return nil, &CustomError{
+			Message: "No active subscription",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &subscription, nil
+}
+
+// GetScheduledPackageChange returns the user's paid change waiting for the current period to end
+func (store *DbStore) GetScheduledPackageChange(userID uint) (*dbmodels.PackageChange, error) {
+	var change dbmodels.PackageChange
+	if err := store.db.Preload("NewPackage").
+		Where("user_id = ? AND status = ?", userID, dbmodels.ChangeStatus_SCHEDULED).
+		First(&change).Error; err != nil {
+		return nil, &CustomError{
+			Message: "No scheduled package change",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &change, nil
+}
+
+// ApplyScheduledPackageChanges moves users to the package of each scheduled
+// change that became effective, and returns the changes applied
+func (store *DbStore) ApplyScheduledPackageChanges(now time.Time) ([]dbmodels.PackageChange, error) {
+	var due []dbmodels.PackageChange
+	if err := store.db.Preload("OldPackage").Preload("NewPackage").
+		Where("status = ? AND effective_at <= ?", dbmodels.ChangeStatus_SCHEDULED, now).
+		Order("effective_at ASC").
+		Find(&due).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch scheduled package changes",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	applied := make([]dbmodels.PackageChange, 0, len(due))
+	for _, change := range due {
+		completed := false
+		err := store.db.Transaction(func(tx *gorm.DB) error {
+			// Guarded by status, so a concurrent run applies each change once
+			result := tx.Model(&dbmodels.PackageChange{}).
+				Where("id = ? AND status = ?", change.ID, dbmodels.ChangeStatus_SCHEDULED).
+				Update("status", dbmodels.ChangeStatus_COMPLETED)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			completed = true
+			if err := tx.Model(&dbmodels.Subscription{}).
+				Where("user_id = ? AND end_date <= ? AND status <> ?", change.UserID, now, dbmodels.SubscriptionStatus_ENDED).
+				Update("status", dbmodels.SubscriptionStatus_ENDED).Error; err != nil {
+				return err
+			}
+			return tx.Model(&dbmodels.User{}).
+				Where("id = ?", change.UserID).
+				Update("package_id", change.NewPackageID).Error
+		})
+		if err != nil {
+			return applied, &CustomError{
+				Message: "Failed to apply scheduled package change",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+		if completed {
+			applied = append(applied, change)
+		}
+	}
+	return applied, nil
 }
 
 func (store *DbStore) GetUserPackageChanges(userID uint, page, limit int) ([]dbmodels.PackageChange, int64, error) {
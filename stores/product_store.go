@@ -21,7 +21,8 @@ func (store *DbStore) CreateProduct(product *dbmodels.Product) error {
 	return store.db.Create(product).Error
 }
 
-func (store *DbStore) GetProducts(page, limit int, userID uint, category string, isActive *bool) ([]dbmodels.Product, int64, error) {
+// GetProducts lists products. sort is one of newest, rating, reviews, price_asc or price_desc.
+func (store *DbStore) GetProducts(page, limit int, userID uint, category string, isActive *bool, sort string) ([]dbmodels.Product, int64, error) {
 	var products []dbmodels.Product
 	var total int64
 
@@ -44,11 +45,23 @@ func (store *DbStore) GetProducts(page, limit int, userID uint, category string,
 		}
 	}
 
+	order := "created_at DESC"
+	switch sort {
+	case "rating":
+		order = "rating_average DESC, rating_count DESC"
+	case "reviews":
+		order = "rating_count DESC, rating_average DESC"
+	case "price_asc":
+		order = "price ASC"
+	case "price_desc":
+		order = "price DESC"
+	}
+
 	offset := (page - 1) * limit
 	if err := query.Preload("User").
 		Offset(offset).
 		Limit(limit).
-		Order("created_at DESC").
+		Order(order).
 		Find(&products).Error; err != nil {
 		return nil, 0, &CustomError{
 			Message: "Failed to fetch products",
@@ -70,6 +83,18 @@ func (store *DbStore) GetProduct(id uint) (*dbmodels.Product, error) {
 	return &product, nil
 }
 
+// GetActiveProductsByIDs returns the active products among ids
+func (store *DbStore) GetActiveProductsByIDs(ids []uint) ([]dbmodels.Product, error) {
+	var products []dbmodels.Product
+	if err := store.db.Where("id IN ? AND is_active = ?", ids, true).Find(&products).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch products",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return products, nil
+}
+
 func (store *DbStore) UpdateProduct(product *dbmodels.Product) error {
 	return store.db.Save(product).Error
 }
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ========== ORDER RECEIPT MANAGEMENT ==========
@@ -16,6 +18,7 @@ func (store *DbStore) GetOrderReceipt(orderID uint) (*dbmodels.OrderReceipt, err
 	var receipt dbmodels.OrderReceipt
 	if err := store.db.Preload("Order").Preload("Order.Items").Preload("Order.Items.Product").
 		Preload("Order.Client").Preload("Order.User").
+		Preload("Deliveries", func(db *gorm.DB) *gorm.DB { return db.Order("created_at DESC") }).
 		Where("order_id = ?", orderID).First(&receipt).Error; err != nil {
 		return nil, &CustomError{
 			Message: "Receipt not found",
@@ -28,3 +31,165 @@ func (store *DbStore) GetOrderReceipt(orderID uint) (*dbmodels.OrderReceipt, err
 func (store *DbStore) UpdateOrderReceipt(receipt *dbmodels.OrderReceipt) error {
 	return store.db.Save(receipt).Error
 }
+
+// GetOrderReceiptByToken finds a receipt by the token of its public link
+func (store *DbStore) GetOrderReceiptByToken(token string) (*dbmodels.OrderReceipt, error) {
+	var receipt dbmodels.OrderReceipt
+	if token == "" {
+		return nil, &CustomError{Message: "Receipt not found", Code: http.StatusNotFound}
+	}
+	if err := store.db.Preload("Order").Preload("Order.Items").Preload("Order.Items.Product").
+		Preload("Order.Client").
+		Where("public_token = ?", token).First(&receipt).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Receipt not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &receipt, nil
+}
+
+// GetOrderReceiptByNumber finds a receipt with the order it was issued for
+func (store *DbStore) GetOrderReceiptByNumber(number string) (*dbmodels.OrderReceipt, error) {
+	var receipt dbmodels.OrderReceipt
+	if err := store.db.Preload("Order").Where("receipt_number = ?", number).First(&receipt).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Receipt not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &receipt, nil
+}
+
+// SetReceiptPublicToken gives a receipt its public link token unless it already has
+// one. It returns the token in effect.
+func (store *DbStore) SetReceiptPublicToken(receiptID uint, token string) (string, error) {
+	if err := store.db.Model(&dbmodels.OrderReceipt{}).
+		Where("id = ? AND (public_token IS NULL OR public_token = '')", receiptID).
+		Update("public_token", token).Error; err != nil {
+		return "", &CustomError{
+			Message: "Failed to create receipt link",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	var receipt dbmodels.OrderReceipt
+	if err := store.db.Select("public_token").First(&receipt, receiptID).Error; err != nil {
+		return "", &CustomError{
+			Message: "Receipt not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return receipt.PublicToken, nil
+}
+
+// ========== RECEIPT DELIVERIES ==========
+
+// RecordReceiptDelivery stores a delivery attempt; a successful one also becomes the
+// receipt's last delivery
+func (store *DbStore) RecordReceiptDelivery(delivery *dbmodels.ReceiptDelivery) error {
+	return store.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(delivery).Error; err != nil {
+			return &CustomError{
+				Message: "Failed to record receipt delivery",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+		if delivery.Status != dbmodels.ReceiptDeliverySent {
+			return nil
+		}
+		return tx.Model(&dbmodels.OrderReceipt{}).Where("id = ?", delivery.ReceiptID).Updates(map[string]interface{}{
+			"last_sent_at": delivery.CreatedAt,
+			"last_sent_to": delivery.Recipient,
+		}).Error
+	})
+}
+
+// HasAutomaticReceiptDelivery reports whether a receipt already reached the customer
+// without the store resending it
+func (store *DbStore) HasAutomaticReceiptDelivery(receiptID uint) bool {
+	var count int64
+	store.db.Model(&dbmodels.ReceiptDelivery{}).
+		Where("receipt_id = ? AND status = ? AND trigger <> ?", receiptID, dbmodels.ReceiptDeliverySent, dbmodels.ReceiptTriggerManual).
+		Count(&count)
+	return count > 0
+}
+
+func (store *DbStore) GetReceiptDeliveries(receiptID uint) ([]dbmodels.ReceiptDelivery, error) {
+	var deliveries []dbmodels.ReceiptDelivery
+	if err := store.db.Where("receipt_id = ?", receiptID).Order("created_at DESC").Find(&deliveries).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to load receipt deliveries",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return deliveries, nil
+}
+
+// ========== STORE LOCALE ==========
+
+// GetStoreLocale returns the receipt language and numerals chosen by the store; empty values were not set
+func (store *DbStore) GetStoreLocale(userID uint) (string, string) {
+	var user dbmodels.User
+	store.db.Select("language", "numerals").First(&user, userID)
+	return user.Language, user.Numerals
+}
+
+func (store *DbStore) UpdateStoreLocale(userID uint, language, numerals string) error {
+	if err := store.db.Model(&dbmodels.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"language": language,
+		"numerals": numerals,
+	}).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to update receipt language",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// ========== RECEIPT BRANDING ==========
+
+func (store *DbStore) GetReceiptBranding(userID uint) (*dbmodels.ReceiptBranding, error) {
+	var branding dbmodels.ReceiptBranding
+	if err := store.db.Where("user_id = ?", userID).First(&branding).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Receipt branding not set",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &branding, nil
+}
+
+// SaveReceiptBranding creates or replaces the store's branding. The logo is kept;
+// it changes through UpdateReceiptLogo.
+func (store *DbStore) SaveReceiptBranding(branding *dbmodels.ReceiptBranding) error {
+	if err := store.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"layout", "name", "address", "phone", "email", "website", "tax_id",
+			"primary_color", "accent_color", "footer_text", "return_policy", "updated_at",
+		}),
+	}).Create(branding).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to save receipt branding",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// UpdateReceiptLogo sets the logo object, creating the branding row if needed
+func (store *DbStore) UpdateReceiptLogo(userID uint, logo string) error {
+	branding := dbmodels.ReceiptBranding{UserID: userID, Logo: logo}
+	if err := store.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"logo", "updated_at"}),
+	}).Create(&branding).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to update receipt logo",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
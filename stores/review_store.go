@@ -0,0 +1,158 @@
+package stores
+
+import (
+	"math"
+	"net/http"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+)
+
+// ========== PRODUCT REVIEW METHODS ==========
+
+func (store *DbStore) CreateReview(review *dbmodels.ProductReview) error {
+	var count int64
+	store.db.Model(&dbmodels.ProductReview{}).
+		Where("order_id = ? AND product_id = ?", review.OrderID, review.ProductID).
+		Count(&count)
+	if count > 0 {
+		return &CustomError{
+			Message: "This product was already reviewed for this order",
+			Code:    http.StatusConflict,
+		}
+	}
+
+	if err := store.db.Create(review).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to create review",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) GetReview(id uint) (*dbmodels.ProductReview, error) {
+	var review dbmodels.ProductReview
+	if err := store.db.First(&review, id).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Review not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &review, nil
+}
+
+func (store *DbStore) UpdateReview(review *dbmodels.ProductReview) error {
+	return store.db.Omit("Product").Save(review).Error
+}
+
+// GetProductReviews returns the approved reviews of a product. sort is newest, oldest, highest or lowest.
+func (store *DbStore) GetProductReviews(productID uint, page, limit int, sort string) ([]dbmodels.ProductReview, int64, error) {
+	var reviews []dbmodels.ProductReview
+	var total int64
+
+	query := store.db.Model(&dbmodels.ProductReview{}).
+		Where("product_id = ? AND status = ?", productID, dbmodels.ReviewStatus_APPROVED)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count reviews",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	order := "created_at DESC"
+	switch sort {
+	case "oldest":
+		order = "created_at ASC"
+	case "highest":
+		order = "rating DESC, created_at DESC"
+	case "lowest":
+		order = "rating ASC, created_at DESC"
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Order(order).Offset(offset).Limit(limit).Find(&reviews).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch reviews",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return reviews, total, nil
+}
+
+// GetStoreReviews returns reviews of a store's products for moderation, optionally filtered by status
+func (store *DbStore) GetStoreReviews(storeOwnerID uint, status *dbmodels.ReviewStatus, page, limit int) ([]dbmodels.ProductReview, int64, error) {
+	var reviews []dbmodels.ProductReview
+	var total int64
+
+	query := store.db.Model(&dbmodels.ProductReview{}).Where("store_owner_id = ?", storeOwnerID)
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count reviews",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Preload("Product").
+		Order("created_at ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&reviews).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch reviews",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return reviews, total, nil
+}
+
+func (store *DbStore) GetProductRatingSummary(productID uint) (*dbmodels.RatingSummary, error) {
+	var rows []struct {
+		Rating int
+		Count  int
+	}
+	if err := store.db.Model(&dbmodels.ProductReview{}).
+		Select("rating, COUNT(*) as count").
+		Where("product_id = ? AND status = ?", productID, dbmodels.ReviewStatus_APPROVED).
+		Group("rating").
+		Scan(&rows).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch rating summary",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	summary := &dbmodels.RatingSummary{Distribution: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	var sum int
+	for _, row := range rows {
+		summary.Distribution[row.Rating] = row.Count
+		summary.Count += int64(row.Count)
+		sum += row.Rating * row.Count
+	}
+	if summary.Count > 0 {
+		summary.Average = math.Round(float64(sum)/float64(summary.Count)*100) / 100
+	}
+	return summary, nil
+}
+
+// RefreshProductRating recalculates the cached rating average and count on the product
+func (store *DbStore) RefreshProductRating(productID uint) error {
+	summary, err := store.GetProductRatingSummary(productID)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Model(&dbmodels.Product{}).
+		Where("id = ?", productID).
+		Updates(map[string]interface{}{
+			"rating_average": summary.Average,
+			"rating_count":   summary.Count,
+		}).Error
+}
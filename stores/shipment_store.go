@@ -0,0 +1,314 @@
+package stores
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========== SHIPMENT METHODS ==========
+
+// sumShipmentItems totals the quantity of each order item across the order's shipments matching the condition
+func sumShipmentItems(db *gorm.DB, orderID uint, condition string, status dbmodels.ShipmentStatus) (map[uint]int, error) {
+	var rows []struct {
+		OrderItemID uint
+		Quantity    int
+	}
+	err := db.Table("shipment_items si").
+		Select("si.order_item_id, SUM(si.quantity) AS quantity").
+		Joins("JOIN shipments s ON s.id = si.shipment_id").
+		Where("s.order_id = ? AND s.status "+condition+" ?", orderID, status).
+		Group("si.order_item_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		totals[row.OrderItemID] = row.Quantity
+	}
+	return totals, nil
+}
+
+// shippedQuantities counts units in shipments that were not canceled
+func shippedQuantities(db *gorm.DB, orderID uint) (map[uint]int, error) {
+	return sumShipmentItems(db, orderID, "<>", dbmodels.ShipmentStatus_CANCELED)
+}
+
+// GetShippedQuantities returns how many units of each order item are already in a shipment
+func (store *DbStore) GetShippedQuantities(orderID uint) (map[uint]int, error) {
+	shipped, err := shippedQuantities(store.db, orderID)
+	if err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch shipped quantities",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return shipped, nil
+}
+
+// CreateShipment saves a booked shipment with its items and first event. Quantities are checked
+// again with the order locked so concurrent shipments cannot exceed what was ordered.
+// A pending order moves to SHIPPED.
+func (store *DbStore) CreateShipment(shipment *dbmodels.Shipment) error {
+	tx := store.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var order dbmodels.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&order, shipment.OrderID).Error; err != nil {
+		tx.Rollback()
+		return &CustomError{
+			Message: "Order not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+
+	shipped, err := shippedQuantities(tx, order.ID)
+	if err != nil {
+		tx.Rollback()
+		return &CustomError{
+			Message: "Failed to fetch shipped quantities",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	ordered := make(map[uint]int, len(order.Items))
+	for _, item := range order.Items {
+		ordered[item.ID] = item.Quantity
+	}
+	for _, item := range shipment.Items {
+		if shipped[item.OrderItemID]+item.Quantity > ordered[item.OrderItemID] {
+			tx.Rollback()
+			return &CustomError{
+				Message: fmt.Sprintf("Order item %d has only %d unit(s) left to ship", item.OrderItemID, ordered[item.OrderItemID]-shipped[item.OrderItemID]),
+				Code:    http.StatusConflict,
+			}
+		}
+		shipped[item.OrderItemID] += item.Quantity
+	}
+
+	if err := tx.Create(shipment).Error; err != nil {
+		tx.Rollback()
+		return &CustomError{
+			Message: "Failed to save shipment",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	if order.Status == dbmodels.OrderStatus_PENDING {
+		if err := tx.Model(&order).Update("status", dbmodels.OrderStatus_SHIPPED).Error; err != nil {
+			tx.Rollback()
+			return &CustomError{
+				Message: "Failed to update order status",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return &CustomError{
+			Message: "Failed to save shipment",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) GetShipment(id uint) (*dbmodels.Shipment, error) {
+	var shipment dbmodels.Shipment
+	if err := store.db.Preload("Items").
+		Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("occurred_at, id") }).
+		First(&shipment, id).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Shipment not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &shipment, nil
+}
+
+func (store *DbStore) GetOrderShipments(orderID uint) ([]dbmodels.Shipment, error) {
+	var shipments []dbmodels.Shipment
+	if err := store.db.Preload("Items").
+		Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("occurred_at, id") }).
+		Where("order_id = ?", orderID).
+		Order("created_at").
+		Find(&shipments).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch shipments",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return shipments, nil
+}
+
+// GetTrackableShipments returns shipments the carrier may still report on,
+// least recently tracked first
+func (store *DbStore) GetTrackableShipments(limit int) ([]dbmodels.Shipment, error) {
+	var shipments []dbmodels.Shipment
+	err := store.db.Where("status NOT IN ?", []dbmodels.ShipmentStatus{
+		dbmodels.ShipmentStatus_DELIVERED,
+		dbmodels.ShipmentStatus_RETURNED,
+		dbmodels.ShipmentStatus_CANCELED,
+	}).
+		Order("last_tracked_at NULLS FIRST").
+		Limit(limit).
+		Find(&shipments).Error
+	return shipments, err
+}
+
+// RecordShipmentTracking stores the carrier's latest status and the checkpoints not seen before.
+// It returns the new checkpoints and whether the whole order is now delivered, in which case
+// the order is marked DELIVERED.
+func (store *DbStore) RecordShipmentTracking(shipmentID uint, status dbmodels.ShipmentStatus, events []dbmodels.ShipmentEvent) ([]dbmodels.ShipmentEvent, bool, error) {
+	var added []dbmodels.ShipmentEvent
+	orderDelivered := false
+
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		var shipment dbmodels.Shipment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&shipment, shipmentID).Error; err != nil {
+			return err
+		}
+		if shipment.Status == dbmodels.ShipmentStatus_CANCELED {
+			return nil
+		}
+
+		var existing []dbmodels.ShipmentEvent
+		if err := tx.Where("shipment_id = ?", shipmentID).Find(&existing).Error; err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, event := range existing {
+			seen[shipmentEventKey(event)] = true
+		}
+		for _, event := range events {
+			event.ShipmentID = shipmentID
+			key := shipmentEventKey(event)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			added = append(added, event)
+		}
+		if len(added) > 0 {
+			if err := tx.Create(&added).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"status":          status,
+			"last_tracked_at": now,
+		}
+		if status == dbmodels.ShipmentStatus_DELIVERED && shipment.DeliveredAt == nil {
+			updates["delivered_at"] = now
+		}
+		if err := tx.Model(&shipment).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if status != dbmodels.ShipmentStatus_DELIVERED {
+			return nil
+		}
+		delivered, err := orderFullyDelivered(tx, shipment.OrderID)
+		if err != nil || !delivered {
+			return err
+		}
+		result := tx.Model(&dbmodels.Order{}).
+			Where("id = ? AND status = ?", shipment.OrderID, dbmodels.OrderStatus_SHIPPED).
+			Update("status", dbmodels.OrderStatus_DELIVERED)
+		orderDelivered = result.RowsAffected > 0
+		return result.Error
+	})
+	if err != nil {
+		return nil, false, &CustomError{
+			Message: "Failed to record shipment tracking",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return added, orderDelivered, nil
+}
+
+// shipmentEventKey identifies a checkpoint; carriers resend their full history on every poll
+func shipmentEventKey(event dbmodels.ShipmentEvent) string {
+	return fmt.Sprintf("%d|%d|%s", event.Status, event.OccurredAt.Unix(), event.Description)
+}
+
+// orderFullyDelivered reports whether every ordered unit is in a delivered shipment
+func orderFullyDelivered(tx *gorm.DB, orderID uint) (bool, error) {
+	var items []dbmodels.OrderItem
+	if err := tx.Where("order_id = ?", orderID).Find(&items).Error; err != nil {
+		return false, err
+	}
+
+	delivered, err := sumShipmentItems(tx, orderID, "=", dbmodels.ShipmentStatus_DELIVERED)
+	if err != nil {
+		return false, err
+	}
+
+	for _, item := range items {
+		if delivered[item.ID] < item.Quantity {
+			return false, nil
+		}
+	}
+	return len(items) > 0, nil
+}
+
+// CancelShipment marks a shipment canceled so its items can ship again.
+// An order left without any active shipment goes back to PENDING.
+func (store *DbStore) CancelShipment(shipment *dbmodels.Shipment) error {
+	now := time.Now()
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(shipment).Updates(map[string]interface{}{
+			"status":      dbmodels.ShipmentStatus_CANCELED,
+			"canceled_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&dbmodels.ShipmentEvent{
+			ShipmentID:  shipment.ID,
+			Status:      dbmodels.ShipmentStatus_CANCELED,
+			Description: "Shipment canceled",
+			OccurredAt:  now,
+		}).Error; err != nil {
+			return err
+		}
+
+		var active int64
+		if err := tx.Model(&dbmodels.Shipment{}).
+			Where("order_id = ? AND status <> ?", shipment.OrderID, dbmodels.ShipmentStatus_CANCELED).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return nil
+		}
+		return tx.Model(&dbmodels.Order{}).
+			Where("id = ? AND status = ?", shipment.OrderID, dbmodels.OrderStatus_SHIPPED).
+			Update("status", dbmodels.OrderStatus_PENDING).Error
+	})
+	if err != nil {
+		return &CustomError{
+			Message: "Failed to cancel shipment",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	shipment.Status = dbmodels.ShipmentStatus_CANCELED
+	shipment.CanceledAt = &now
+	return nil
+}
+
+// MarkShipmentTracked records a tracking attempt that brought no update, so the
+// shipment moves to the back of the tracking queue
+func (store *DbStore) MarkShipmentTracked(shipmentID uint) error {
+	return store.db.Model(&dbmodels.Shipment{}).Where("id = ?", shipmentID).Update("last_tracked_at", time.Now()).Error
+}
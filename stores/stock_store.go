@@ -0,0 +1,182 @@
+package stores
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========== STOCK LEVELS & REORDER POINTS ==========
+
+// stockSettingsJoin joins each active product with its category and store-wide stock settings
+func (store *DbStore) stockSettingsJoin() *gorm.DB {
+	return store.db.Table("products").
+		Joins("LEFT JOIN stock_settings cs ON cs.user_id = products.user_id AND cs.category = products.category AND cs.category <> ''").
+		Joins("LEFT JOIN stock_settings ds ON ds.user_id = products.user_id AND ds.category = ''").
+		Where("products.is_active = ?", true)
+}
+
+// stockLevelColumns resolves each product's reorder settings: product override, then the
+// category setting, then the store-wide setting, then the package defaults
+const stockLevelColumns = "products.id AS product_id, products.name, products.sku, products.category, products.user_id, products.quantity, products.low_stock_alert_at, " +
+	"COALESCE(products.reorder_point, cs.reorder_point, ds.reorder_point, ?) AS reorder_point, " +
+	"COALESCE(products.reorder_quantity, cs.reorder_quantity, ds.reorder_quantity, ?) AS reorder_quantity"
+
+// lowStockCondition matches products at or below their effective reorder point
+const lowStockCondition = "products.quantity <= COALESCE(products.reorder_point, cs.reorder_point, ds.reorder_point, ?)"
+
+// CountLowStockProducts counts a store's active products at or below their reorder point
+func (store *DbStore) CountLowStockProducts(userID uint) int64 {
+	var count int64
+	store.stockSettingsJoin().
+		Where("products.user_id = ?", userID).
+		Where(lowStockCondition, dbmodels.DefaultReorderPoint).
+		Count(&count)
+	return count
+}
+
+// GetLowStockProducts returns active products at or below their reorder point.
+// userID 0 returns products of all stores.
+func (store *DbStore) GetLowStockProducts(userID uint) ([]dbmodels.StockLevel, error) {
+	var levels []dbmodels.StockLevel
+	query := store.stockSettingsJoin().
+		Select(stockLevelColumns, dbmodels.DefaultReorderPoint, dbmodels.DefaultReorderQuantity).
+		Where(lowStockCondition, dbmodels.DefaultReorderPoint)
+	if userID > 0 {
+		query = query.Where("products.user_id = ?", userID)
+	}
+	if err := query.Order("products.user_id, products.quantity ASC").Scan(&levels).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch low stock products",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return levels, nil
+}
+
+// SetLowStockAlert marks products as alerted (at != nil) or clears the mark (at == nil)
+func (store *DbStore) SetLowStockAlert(productIDs []uint, at *time.Time) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+	return store.db.Model(&dbmodels.Product{}).
+		Where("id IN ?", productIDs).
+		Update("low_stock_alert_at", at).Error
+}
+
+// ClearRestockedAlerts resets the alert mark of products that are back above their reorder point,
+// so they alert again the next time they run low
+func (store *DbStore) ClearRestockedAlerts() error {
+	var ids []uint
+	if err := store.stockSettingsJoin().
+		Where("products.low_stock_alert_at IS NOT NULL").
+		Where("NOT ("+lowStockCondition+")", dbmodels.DefaultReorderPoint).
+		Pluck("products.id", &ids).Error; err != nil {
+		return err
+	}
+	return store.SetLowStockAlert(ids, nil)
+}
+
+// GetReorderSuggestions ranks a store's products by days of stock left, based on units sold
+// in the last windowDays. Suggested orders cover coverDays of sales, at least the reorder quantity.
+func (store *DbStore) GetReorderSuggestions(userID uint, windowDays, coverDays int) ([]dbmodels.StockLevel, error) {
+	since := time.Now().AddDate(0, 0, -windowDays)
+	sales := store.db.Table("order_items").
+		Select("order_items.product_id, SUM(order_items.quantity) AS units_sold").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.status <> ? AND orders.created_at >= ?", dbmodels.OrderStatus_CANCELED, since).
+		Group("order_items.product_id")
+
+	var levels []dbmodels.StockLevel
+	if err := store.stockSettingsJoin().
+		Select(stockLevelColumns+", COALESCE(s.units_sold, 0) AS units_sold",
+			dbmodels.DefaultReorderPoint, dbmodels.DefaultReorderQuantity).
+		Joins("LEFT JOIN (?) s ON s.product_id = products.id", sales).
+		Where("products.user_id = ?", userID).
+		Scan(&levels).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to compute reorder suggestions",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	for i := range levels {
+		level := &levels[i]
+		level.BelowReorder = level.Quantity <= level.ReorderPoint
+		level.DailyVelocity = math.Round(float64(level.UnitsSold)/float64(windowDays)*100) / 100
+		if level.UnitsSold > 0 {
+			daysLeft := math.Round(float64(level.Quantity)/(float64(level.UnitsSold)/float64(windowDays))*10) / 10
+			level.DaysOfStockLeft = &daysLeft
+		}
+
+		need := int(math.Ceil(float64(level.UnitsSold)/float64(windowDays)*float64(coverDays))) - level.Quantity
+		if level.BelowReorder && need < level.ReorderQuantity {
+			need = level.ReorderQuantity
+		}
+		if need > 0 {
+			level.SuggestedOrder = need
+		}
+	}
+
+	// Fastest to run out first; products that have not sold go last, lowest stock first
+	sort.SliceStable(levels, func(i, j int) bool {
+		a, b := levels[i].DaysOfStockLeft, levels[j].DaysOfStockLeft
+		switch {
+		case a != nil && b != nil:
+			return *a < *b
+		case a != nil:
+			return true
+		case b != nil:
+			return false
+		}
+		return levels[i].Quantity < levels[j].Quantity
+	})
+
+	return levels, nil
+}
+
+// ========== STOCK SETTINGS ==========
+
+func (store *DbStore) GetStockSettings(userID uint) ([]dbmodels.StockSetting, error) {
+	var settings []dbmodels.StockSetting
+	if err := store.db.Where("user_id = ?", userID).Order("category ASC").Find(&settings).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch stock settings",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return settings, nil
+}
+
+// SaveStockSetting creates or replaces the setting for the user and category
+func (store *DbStore) SaveStockSetting(setting *dbmodels.StockSetting) error {
+	if err := store.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "category"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reorder_point", "reorder_quantity", "updated_at"}),
+	}).Create(setting).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to save stock setting",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) DeleteStockSetting(userID uint, category string) error {
+	return store.db.Where("user_id = ? AND category = ?", userID, category).Delete(&dbmodels.StockSetting{}).Error
+}
+
+// UpdateProductReorderSettings sets or clears (nil) a product's own reorder point and quantity
+func (store *DbStore) UpdateProductReorderSettings(productID uint, reorderPoint, reorderQuantity *int) error {
+	return store.db.Model(&dbmodels.Product{}).
+		Where("id = ?", productID).
+		Updates(map[string]interface{}{
+			"reorder_point":    reorderPoint,
+			"reorder_quantity": reorderQuantity,
+		}).Error
+}
@@ -0,0 +1,245 @@
+package stores
+
+import (
+	"fmt"
+	"net/http"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========== WALLETS ==========
+
+// WalletEntry is a ledger entry to post to a wallet
+type WalletEntry struct {
+	Type           dbmodels.WalletEntryType
+	Reason         dbmodels.WalletEntryReason
+	Amount         decimal.Decimal // Positive; Type gives the direction
+	PaymentID      *uint
+	Reference      string
+	Note           string
+	CreatedBy      *uint
+	AllowOverdraft bool // Debit even if the balance goes negative
+}
+
+// GetWallet returns the user's wallet, opening an empty one in the given currency
+func (store *DbStore) GetWallet(userID uint, currency string) (*dbmodels.Wallet, error) {
+	wallet := dbmodels.Wallet{UserID: userID, Currency: currency}
+	if err := store.db.Where("user_id = ?", userID).FirstOrCreate(&wallet).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch wallet",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return &wallet, nil
+}
+
+// GetWalletTransactions returns a user's ledger entries, newest first
+func (store *DbStore) GetWalletTransactions(userID uint, page, limit int) ([]dbmodels.WalletTransaction, int64, error) {
+	var entries []dbmodels.WalletTransaction
+	var total int64
+
+	query := store.db.Model(&dbmodels.WalletTransaction{}).Where("user_id = ?", userID)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to count wallet transactions",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Offset(offset).
+		Limit(limit).
+		Order("created_at DESC, id DESC").
+		Find(&entries).Error; err != nil {
+		return nil, 0, &CustomError{
+			Message: "Failed to fetch wallet transactions",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return entries, total, nil
+}
+
+// PostWalletEntry credits or debits a user's wallet, e.g. an admin adjustment.
+// A debit larger than the balance is refused unless the entry allows overdraft.
+func (store *DbStore) PostWalletEntry(userID uint, currency string, entry WalletEntry) (*dbmodels.WalletTransaction, error) {
+	var posted *dbmodels.WalletTransaction
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		posted, err = postWalletEntry(tx, userID, currency, entry)
+		return err
+	})
+	if err != nil {
+		if _, ok := err.(*CustomError); ok {
+			return nil, err
+		}
+		return nil, &CustomError{
+			Message: "Failed to update wallet",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return posted, nil
+}
+
+// postWalletEntry is PostWalletEntry within a caller's transaction. The wallet row
+// is locked, so concurrent entries are applied one at a time.
+func postWalletEntry(tx *gorm.DB, userID uint, currency string, entry WalletEntry) (*dbmodels.WalletTransaction, error) {
+	if !entry.Amount.IsPositive() {
+		return nil, &CustomError{Message: "Wallet amount must be positive", Code: http.StatusBadRequest}
+	}
+
+	// Open the wallet on its first entry; a concurrent opening is not an error
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&dbmodels.Wallet{UserID: userID, Currency: currency}).Error; err != nil {
+		return nil, err
+	}
+	var wallet dbmodels.Wallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		First(&wallet).Error; err != nil {
+		return nil, err
+	}
+	if wallet.Currency != currency {
+		return nil, &CustomError{
+			Message: fmt.Sprintf("Wallet is held in %s, not %s", wallet.Currency, currency),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	balance := wallet.Balance.Add(entry.Amount)
+	if entry.Type == dbmodels.WalletEntryType_DEBIT {
+		balance = wallet.Balance.Sub(entry.Amount)
+		if balance.IsNegative() && !entry.AllowOverdraft {
+			return nil, &CustomError{
+				Message: fmt.Sprintf("Insufficient wallet balance: %s %s available", wallet.Balance.StringFixed(2), wallet.Currency),
+				Code:    http.StatusPaymentRequired,
+			}
+		}
+	}
+
+	if err := tx.Model(&wallet).Update("balance", balance).Error; err != nil {
+		return nil, err
+	}
+
+	posted := &dbmodels.WalletTransaction{
+		WalletID:     wallet.ID,
+		UserID:       userID,
+		Type:         entry.Type,
+		Reason:       entry.Reason,
+		Amount:       entry.Amount,
+		BalanceAfter: balance,
+		PaymentID:    entry.PaymentID,
+		Reference:    entry.Reference,
+		Note:         entry.Note,
+		CreatedBy:    entry.CreatedBy,
+	}
+	if err := tx.Create(posted).Error; err != nil {
+		return nil, err
+	}
+	return posted, nil
+}
+
+// PayWithWallet debits a pending wallet payment from the payer's wallet and
+// completes what it pays for, all in one transaction. The payer is the payment's
+// user, or the shopper for a storefront order. Nothing changes when the balance
+// is short.
+func (store *DbStore) PayWithWallet(paymentID, payerID uint) (*PaymentTransition, error) {
+	var transition PaymentTransition
+
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		var payment dbmodels.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error; err != nil {
+			return &CustomError{Message: "Payment not found", Code: http.StatusNotFound}
+		}
+		if payment.PaymentMethod != dbmodels.WalletPaymentMethod || payment.PaymentStatus != dbmodels.PaymentStatus_PENDING {
+			return &CustomError{Message: "Payment is not a pending wallet payment", Code: http.StatusBadRequest}
+		}
+
+		debit, err := postWalletEntry(tx, payerID, payment.Currency, WalletEntry{
+			Type:      dbmodels.WalletEntryType_DEBIT,
+			Reason:    dbmodels.WalletEntryReason_PAYMENT,
+			Amount:    payment.Amount,
+			PaymentID: &payment.ID,
+			Reference: payment.ReferenceNumber,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := transitionPayment(tx, &transition, paymentID, dbmodels.PaymentStatus_PAID, fmt.Sprintf("WALLET-%d", debit.ID), 0); err != nil {
+			return err
+		}
+		transition.WalletEntry = debit
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(*CustomError); ok {
+			return nil, err
+		}
+		return nil, &CustomError{
+			Message: "Failed to pay from wallet",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return &transition, nil
+}
+
+// RefundToWallet refunds a paid payment into a wallet instead of through its
+// gateway, undoing what it paid for like a gateway refund. A wallet payment goes
+// back to the wallet it was paid from, any other payment to its user. Wallet
+// top-ups cannot be refunded this way.
+func (store *DbStore) RefundToWallet(paymentID uint, note string) (*PaymentTransition, error) {
+	var transition PaymentTransition
+
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		if err := transitionPayment(tx, &transition, paymentID, dbmodels.PaymentStatus_REFUNDED, "", 0); err != nil {
+			return err
+		}
+		payment := &transition.Payment
+		if !transition.Applied || transition.Previous != dbmodels.PaymentStatus_PAID {
+			return &CustomError{Message: "Only paid payments can be refunded", Code: http.StatusBadRequest}
+		}
+		if payment.Purpose == dbmodels.PaymentPurpose_WALLET_TOPUP {
+			return &CustomError{Message: "Wallet top-ups are refunded through their gateway", Code: http.StatusBadRequest}
+		}
+
+		userID := payment.UserID
+		var debit dbmodels.WalletTransaction
+		if err := tx.Where("payment_id = ? AND type = ? AND reason = ?", payment.ID,
+			dbmodels.WalletEntryType_DEBIT, dbmodels.WalletEntryReason_PAYMENT).
+			First(&debit).Error; err == nil {
+			userID = debit.UserID
+		} else if payment.Purpose == dbmodels.PaymentPurpose_ORDER {
+			// The store owner is not who paid for a storefront order
+			return &CustomError{Message: "Only wallet-paid orders can be refunded to a wallet", Code: http.StatusBadRequest}
+		}
+
+		credit, err := postWalletEntry(tx, userID, payment.Currency, WalletEntry{
+			Type:      dbmodels.WalletEntryType_CREDIT,
+			Reason:    dbmodels.WalletEntryReason_REFUND,
+			Amount:    payment.Amount,
+			PaymentID: &payment.ID,
+			Reference: payment.ReferenceNumber,
+			Note:      note,
+		})
+		if err != nil {
+			return err
+		}
+		transition.WalletEntry = credit
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(*CustomError); ok {
+			return nil, err
+		}
+		return nil, &CustomError{
+			Message: "Failed to refund payment to wallet",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return &transition, nil
+}
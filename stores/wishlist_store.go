@@ -0,0 +1,188 @@
+package stores
+
+import (
+	"net/http"
+
+	dbmodels "github.com/mohammedrefaat/hamber/DB_models"
+	"gorm.io/gorm"
+)
+
+// ========== WISHLIST METHODS ==========
+
+// scopeWishlistOwner limits a query to wishlists of a user, or of a guest session
+func scopeWishlistOwner(query *gorm.DB, userID *uint, sessionID string) *gorm.DB {
+	if userID != nil {
+		return query.Where("user_id = ?", *userID)
+	}
+	return query.Where("session_id = ? AND user_id IS NULL", sessionID)
+}
+
+func (store *DbStore) CreateWishlist(wishlist *dbmodels.Wishlist) error {
+	if err := store.db.Create(wishlist).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to create wishlist",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) GetWishlists(userID *uint, sessionID string) ([]dbmodels.Wishlist, error) {
+	var wishlists []dbmodels.Wishlist
+	query := scopeWishlistOwner(store.db.Preload("Items.Product"), userID, sessionID)
+	if err := query.Order("is_default DESC, created_at ASC").Find(&wishlists).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch wishlists",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return wishlists, nil
+}
+
+// GetWishlist returns a wishlist only if it belongs to the given user or guest session
+func (store *DbStore) GetWishlist(id uint, userID *uint, sessionID string) (*dbmodels.Wishlist, error) {
+	var wishlist dbmodels.Wishlist
+	query := scopeWishlistOwner(store.db.Preload("Items.Product"), userID, sessionID)
+	if err := query.First(&wishlist, id).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Wishlist not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &wishlist, nil
+}
+
+func (store *DbStore) GetPublicWishlist(shareToken string) (*dbmodels.Wishlist, error) {
+	var wishlist dbmodels.Wishlist
+	if err := store.db.Preload("Items.Product").
+		Where("share_token = ? AND is_public = ?", shareToken, true).
+		First(&wishlist).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Wishlist not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &wishlist, nil
+}
+
+// GetDefaultWishlist returns the owner's default wishlist, or nil if none exists yet
+func (store *DbStore) GetDefaultWishlist(userID *uint, sessionID string) (*dbmodels.Wishlist, error) {
+	var wishlists []dbmodels.Wishlist
+	query := scopeWishlistOwner(store.db.Model(&dbmodels.Wishlist{}), userID, sessionID)
+	if err := query.Where("is_default = ?", true).Limit(1).Find(&wishlists).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch wishlist",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if len(wishlists) == 0 {
+		return nil, nil
+	}
+	return &wishlists[0], nil
+}
+
+func (store *DbStore) UpdateWishlist(wishlist *dbmodels.Wishlist) error {
+	return store.db.Omit("Items").Save(wishlist).Error
+}
+
+func (store *DbStore) DeleteWishlist(id uint) error {
+	tx := store.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Where("wishlist_id = ?", id).Delete(&dbmodels.WishlistItem{}).Error; err != nil {
+		tx.Rollback()
+		return &CustomError{
+			Message: "Failed to delete wishlist items",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if err := tx.Delete(&dbmodels.Wishlist{}, id).Error; err != nil {
+		tx.Rollback()
+		return &CustomError{
+			Message: "Failed to delete wishlist",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// AddWishlistItem saves a product to a wishlist; adding a product twice returns the existing item
+func (store *DbStore) AddWishlistItem(item *dbmodels.WishlistItem) error {
+	var existing dbmodels.WishlistItem
+	err := store.db.Where("wishlist_id = ? AND product_id = ?", item.WishlistID, item.ProductID).First(&existing).Error
+	if err == nil {
+		*item = existing
+		return nil
+	}
+
+	if err := store.db.Create(item).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to add item to wishlist",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) GetWishlistItem(id uint, wishlistID uint) (*dbmodels.WishlistItem, error) {
+	var item dbmodels.WishlistItem
+	if err := store.db.Preload("Product").
+		Where("id = ? AND wishlist_id = ?", id, wishlistID).
+		First(&item).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Wishlist item not found",
+			Code:    http.StatusNotFound,
+		}
+	}
+	return &item, nil
+}
+
+func (store *DbStore) UpdateWishlistItem(item *dbmodels.WishlistItem) error {
+	return store.db.Omit("Product", "Wishlist").Save(item).Error
+}
+
+func (store *DbStore) DeleteWishlistItem(id uint) error {
+	return store.db.Delete(&dbmodels.WishlistItem{}, id).Error
+}
+
+// GetWishlistItemsForProduct returns registered users' wishlist entries for a product, used for alerts
+func (store *DbStore) GetWishlistItemsForProduct(productID uint) ([]dbmodels.WishlistItem, error) {
+	var items []dbmodels.WishlistItem
+	if err := store.db.Preload("Wishlist").
+		Joins("JOIN wishlists ON wishlists.id = wishlist_items.wishlist_id").
+		Where("wishlist_items.product_id = ? AND wishlists.user_id IS NOT NULL", productID).
+		Find(&items).Error; err != nil {
+		return nil, &CustomError{
+			Message: "Failed to fetch wishlist items",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return items, nil
+}
+
+// MigrateGuestWishlists hands a guest session's wishlists to the user after login or registration
+func (store *DbStore) MigrateGuestWishlists(sessionID string, userID uint) error {
+	// The user's existing default list wins; guest lists become regular lists
+	var defaultCount int64
+	store.db.Model(&dbmodels.Wishlist{}).Where("user_id = ? AND is_default = ?", userID, true).Count(&defaultCount)
+
+	updates := map[string]interface{}{"user_id": userID}
+	if defaultCount > 0 {
+		updates["is_default"] = false
+	}
+
+	if err := store.db.Model(&dbmodels.Wishlist{}).
+		Where("session_id = ? AND user_id IS NULL", sessionID).
+		Updates(updates).Error; err != nil {
+		return &CustomError{
+			Message: "Failed to migrate guest wishlists",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"strconv"
 )
@@ -55,3 +57,10 @@ func MustParseUint(s string) uint {
 	}
 	return val
 }
+
+// GenerateToken returns a random hex token built from n random bytes
+func GenerateToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}